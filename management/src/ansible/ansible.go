@@ -2,15 +2,22 @@ package ansible
 
 import (
 	"io"
+	"io/ioutil"
 	"os"
 	"os/exec"
+	"strconv"
+	"syscall"
+	"time"
 
 	"golang.org/x/net/context"
 
 	"github.com/Sirupsen/logrus"
-	"github.com/contiv/executor"
 )
 
+// killGracePeriod is the time a cancelled playbook run is given to terminate,
+// before it's killed
+var killGracePeriod = 10 * time.Second
+
 // Runner facilitates running a playbook on specified inventory
 type Runner struct {
 	inventory   Inventory
@@ -18,7 +25,17 @@ type Runner struct {
 	user        string
 	privKeyFile string
 	extraVars   string
-	ctxt        context.Context
+	// vaultVars are the ansible-vault encrypted extra vars, that are decrypted
+	// with the password in vaultPasswordFile when the playbook is run
+	vaultVars         []string
+	vaultPasswordFile string
+	// forks is the number of hosts that the playbook is run on in parallel. The
+	// ansible's default is used if it is zero
+	forks int
+	// check, when true, runs the playbook in check mode. The changes that the
+	// playbook would make are reported, with their diff, without making them
+	check bool
+	ctxt  context.Context
 }
 
 // NewRunner returns an instance of Runner for specified playbook and inventory.
@@ -35,6 +52,23 @@ func NewRunner(inventory Inventory, playbook, user, privKeyFile, extraVars strin
 	}
 }
 
+// SetVaultVars sets the ansible-vault encrypted extra vars, that take precedence
+// over the plaintext extra vars, and the file with the vault password
+func (r *Runner) SetVaultVars(vaultVars []string, vaultPasswordFile string) {
+	r.vaultVars = vaultVars
+	r.vaultPasswordFile = vaultPasswordFile
+}
+
+// SetForks sets the number of hosts that the playbook is run on in parallel
+func (r *Runner) SetForks(forks int) {
+	r.forks = forks
+}
+
+// SetCheck sets whether the playbook is run in check mode
+func (r *Runner) SetCheck(check bool) {
+	r.check = check
+}
+
 // Run runs a playbook and return's it's status as well the stdout and
 // stderr outputs respectively.
 func (r *Runner) Run(stdout, stderr io.Writer) error {
@@ -45,17 +79,84 @@ func (r *Runner) Run(stdout, stderr io.Writer) error {
 	defer os.Remove(hostsFile.Name())
 
 	logrus.Debugf("going to run playbook: %q with hosts file: %q and vars: %s", r.playbook, hostsFile.Name(), r.extraVars)
-	cmd := exec.Command("ansible-playbook", "-i", hostsFile.Name(), "--user", r.user,
-		"--private-key", r.privKeyFile, "--extra-vars", r.extraVars, r.playbook)
+	args := []string{"-i", hostsFile.Name(), "--user", r.user, "--private-key", r.privKeyFile,
+		"--extra-vars", r.extraVars}
+	if r.forks > 0 {
+		args = append(args, "--forks", strconv.Itoa(r.forks))
+	}
+	if r.check {
+		args = append(args, "--check", "--diff")
+	}
+	// the encrypted vars are passed through files, that ansible decrypts
+	for _, vars := range r.vaultVars {
+		varsFile, err := newVaultVarsFile(vars)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(varsFile)
+		args = append(args, "--extra-vars", "@"+varsFile)
+	}
+	if len(r.vaultVars) > 0 {
+		args = append(args, "--vault-password-file", r.vaultPasswordFile)
+	}
+	cmd := exec.Command("ansible-playbook", append(args, r.playbook)...)
 	// turn off host key checking as we are in non-interactive mode
 	cmd.Env = append(cmd.Env, "ANSIBLE_HOST_KEY_CHECKING=false")
 	cmd.Stdout = stdout
 	cmd.Stderr = stderr
-	e := executor.New(cmd)
-	res, err := e.Run(r.ctxt)
-	if err != nil {
+	return runCmd(r.ctxt, cmd)
+}
+
+// runCmd runs the command till it exits or the context is done. In the latter
+// case the command, along with the processes it spawned like the ssh connections
+// of ansible, is sent a SIGTERM and then a SIGKILL if it's still running after
+// killGracePeriod. The context's error is returned once the command has exited.
+func runCmd(ctxt context.Context, cmd *exec.Cmd) error {
+	// the command is run in it's own process group, so that the processes it
+	// spawns can be signalled along with it
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	start := time.Now()
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	waitCh := make(chan error, 1)
+	go func() { waitCh <- cmd.Wait() }()
+
+	select {
+	case err := <-waitCh:
+		logrus.Debugf("%v exited after %v. Error: %v", cmd.Args, time.Since(start), err)
 		return err
+	case <-ctxt.Done():
+	}
+
+	pgid := -cmd.Process.Pid
+	logrus.Infof("terminating %v as it was cancelled after %v", cmd.Args, time.Since(start))
+	if err := syscall.Kill(pgid, syscall.SIGTERM); err != nil {
+		logrus.Errorf("failed to terminate %v. Error: %v", cmd.Args, err)
+	}
+	select {
+	case <-waitCh:
+	case <-time.After(killGracePeriod):
+		logrus.Warnf("killing %v as it didn't terminate in %v", cmd.Args, killGracePeriod)
+		if err := syscall.Kill(pgid, syscall.SIGKILL); err != nil {
+			logrus.Errorf("failed to kill %v. Error: %v", cmd.Args, err)
+		}
+		<-waitCh
+	}
+	return ctxt.Err()
+}
+
+// newVaultVarsFile writes the vault encrypted extra vars to a temporary file
+// and returns it's name. The caller is responsible for removing the file
+func newVaultVarsFile(vars string) (string, error) {
+	f, err := ioutil.TempFile("", "vault-vars")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := f.WriteString(vars); err != nil {
+		os.Remove(f.Name())
+		return "", err
 	}
-	logrus.Debugf("executor result: %s", res)
-	return nil
+	return f.Name(), nil
 }
@@ -0,0 +1,104 @@
+// +build unittest
+
+package ansible
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+
+	. "gopkg.in/check.v1"
+)
+
+// fakeLongRunningCmd returns a command that spawns a long running process and
+// waits for it, like ansible waits for the ssh connections. The pids of the
+// command and the process are written to the returned file once they are running
+func fakeLongRunningCmd(c *C, ignoreTerm bool) (*exec.Cmd, string) {
+	pidFile := filepath.Join(c.MkDir(), "pids")
+	script := fmt.Sprintf("sleep 60 & echo $$ $! > %s.tmp; mv %s.tmp %s; wait", pidFile, pidFile, pidFile)
+	if ignoreTerm {
+		script = "trap '' TERM; " + script
+	}
+	return exec.Command("sh", "-c", script), pidFile
+}
+
+// readPids waits for the pids of the fake command to be written and returns them
+func readPids(c *C, pidFile string) []int {
+	for i := 0; i < 100; i++ {
+		if b, err := ioutil.ReadFile(pidFile); err == nil {
+			pids := []int{}
+			for _, f := range strings.Fields(string(b)) {
+				pid, err := strconv.Atoi(f)
+				c.Assert(err, IsNil)
+				pids = append(pids, pid)
+			}
+			return pids
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	c.Fatalf("the fake command didn't start")
+	return nil
+}
+
+// isRunning checks if the process is running, allowing a moment for a signalled
+// process to exit. The zombie processes, that exited but were not reaped yet,
+// are not considered running
+func isRunning(pid int) bool {
+	for i := 0; i < 50; i++ {
+		b, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+		if err != nil {
+			return false
+		}
+		// the state follows the command name, that is in parenthesis
+		fields := strings.Fields(string(b[strings.LastIndex(string(b), ")")+1:]))
+		if len(fields) > 0 && fields[0] == "Z" {
+			return false
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	return true
+}
+
+func (s *ansibleSuite) testRunCmdCancel(c *C, ignoreTerm bool) {
+	cmd, pidFile := fakeLongRunningCmd(c, ignoreTerm)
+	ctxt, cancelFunc := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() { errCh <- runCmd(ctxt, cmd) }()
+
+	pids := readPids(c, pidFile)
+	c.Assert(pids, HasLen, 2)
+	cancelFunc()
+	select {
+	case err := <-errCh:
+		c.Assert(err, Equals, context.Canceled)
+	case <-time.After(5 * time.Second):
+		c.Fatalf("the command didn't return on cancellation")
+	}
+	for _, pid := range pids {
+		c.Assert(isRunning(pid), Equals, false, Commentf("pid: %d", pid))
+	}
+}
+
+func (s *ansibleSuite) TestRunCmdCancel(c *C) {
+	s.testRunCmdCancel(c, false)
+}
+
+func (s *ansibleSuite) TestRunCmdCancelKill(c *C) {
+	defer func(period time.Duration) { killGracePeriod = period }(killGracePeriod)
+	killGracePeriod = 100 * time.Millisecond
+	s.testRunCmdCancel(c, true)
+}
+
+func (s *ansibleSuite) TestRunCmdExit(c *C) {
+	c.Assert(runCmd(context.Background(), exec.Command("true")), IsNil)
+	err := runCmd(context.Background(), exec.Command("false"))
+	c.Assert(err, NotNil)
+	_, ok := err.(*exec.ExitError)
+	c.Assert(ok, Equals, true)
+}
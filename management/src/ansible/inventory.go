@@ -3,7 +3,10 @@ package ansible
 import (
 	"io/ioutil"
 	"os"
+	"strings"
 	"text/template"
+
+	"github.com/contiv/errored"
 )
 
 // InventoryHost contains information about a host in ansible inventory
@@ -30,6 +33,8 @@ type HostGroup string
 // Inventory contains ansible's inventory
 type Inventory struct {
 	Hosts map[HostGroup][]InventoryHost
+	// content, when set, is the inventory in INI format that is used as is
+	content string
 }
 
 // NewInventory returns inventory with specified hosts, grouped by respective groups
@@ -46,6 +51,53 @@ func NewInventory(hosts []InventoryHost) Inventory {
 	return i
 }
 
+// ParseInventory parses an inventory in ansible's INI format. The returned
+// inventory retains the content as is, to be used for running a playbook
+func ParseInventory(content string) (Inventory, error) {
+	i := Inventory{
+		Hosts:   make(map[HostGroup][]InventoryHost),
+		content: content,
+	}
+	group := HostGroup("ungrouped")
+	hostSection := true
+	for n, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			name := strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(line, "["), "]"))
+			if !strings.HasSuffix(line, "]") || name == "" {
+				return Inventory{}, errored.Errorf("invalid group header %q at line %d", line, n+1)
+			}
+			// the ':vars' and ':children' sections don't list hosts
+			hostSection = !strings.Contains(name, ":")
+			group = HostGroup(name)
+			continue
+		}
+		if !hostSection {
+			continue
+		}
+		fields := strings.Fields(line)
+		h := NewInventoryHost(fields[0], "", string(group), map[string]string{})
+		for _, f := range fields[1:] {
+			kv := strings.SplitN(f, "=", 2)
+			if len(kv) != 2 || kv[0] == "" {
+				return Inventory{}, errored.Errorf("invalid host variable %q at line %d, expected key=value", f, n+1)
+			}
+			if kv[0] == "ansible_ssh_host" || kv[0] == "ansible_host" {
+				h.Addr = kv[1]
+			}
+			h.Vars[kv[0]] = kv[1]
+		}
+		i.Hosts[group] = append(i.Hosts[group], h)
+	}
+	if len(i.Hosts) == 0 {
+		return Inventory{}, errored.Errorf("inventory doesn't list any hosts")
+	}
+	return i, nil
+}
+
 // NewInventoryFile creates a hosts file from inventory information. The caller shall
 // delete the file after use
 func NewInventoryFile(inventory Inventory) (*os.File, error) {
@@ -58,6 +110,14 @@ func NewInventoryFile(inventory Inventory) (*os.File, error) {
 	// `ansible` command. This will need to be done different this assumption changes.
 	defer f.Close()
 
+	if inventory.content != "" {
+		if _, err := f.WriteString(inventory.content); err != nil {
+			os.Remove(f.Name())
+			return nil, err
+		}
+		return f, nil
+	}
+
 	templateText := `
 {{/* walk over the groups and print the group name*/}}{{ range $group, $hosts := .Hosts }}[{{ $group }}]
 {{/* walk over the hosts in the group and print the host name and address*/}}{{ range $i, $host := $hosts }}{{ $host.Alias }} ansible_ssh_host={{ $host.Addr }} {{ range $var, $val := $host.Vars }} {{ $var }}={{ $val }} {{ end }}
@@ -119,3 +119,45 @@ func (s *ansibleSuite) TestInventoryFile(c *C) {
 	c.Assert(f, NotNil)
 	MatchFile(c, f, multiHostWithVarsMultiGroupsFile)
 }
+
+func (s *ansibleSuite) TestParseInventory(c *C) {
+	content := `
+# comment
+[service-master]
+node1 ansible_ssh_host=1.1.1.1 foo=bar
+
+[service-worker]
+node2 ansible_ssh_host=1.1.1.2
+node3
+
+[service-worker:vars]
+baz=qux
+`
+	i, err := ParseInventory(content)
+	c.Assert(err, IsNil)
+	c.Assert(i.Hosts, HasLen, 2)
+	c.Assert(i.Hosts["service-master"], DeepEquals, []InventoryHost{
+		NewInventoryHost("node1", "1.1.1.1", "service-master",
+			map[string]string{"ansible_ssh_host": "1.1.1.1", "foo": "bar"}),
+	})
+	c.Assert(i.Hosts["service-worker"], HasLen, 2)
+
+	// the inventory file has the content as is
+	f, err := NewInventoryFile(i)
+	c.Assert(err, IsNil)
+	MatchFile(c, f, content)
+}
+
+func (s *ansibleSuite) TestParseInventoryErrors(c *C) {
+	tests := map[string]string{
+		"empty":          "",
+		"no-hosts":       "[service-master]\n",
+		"invalid-header": "[service-master\nnode1\n",
+		"empty-header":   "[]\nnode1\n",
+		"invalid-var":    "[service-master]\nnode1 ansible_ssh_host\n",
+	}
+	for key, content := range tests {
+		_, err := ParseInventory(content)
+		c.Assert(err, NotNil, Commentf("key: %s", key))
+	}
+}
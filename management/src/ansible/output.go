@@ -0,0 +1,58 @@
+package ansible
+
+import (
+	"regexp"
+	"strings"
+)
+
+// TaskResult denotes the result of a task on a host as reported in playbook output
+type TaskResult string
+
+const (
+	// TaskOk is the result of a task that ran successfully without changes
+	TaskOk TaskResult = "ok"
+	// TaskChanged is the result of a task that ran successfully and made changes
+	TaskChanged TaskResult = "changed"
+	// TaskSkipped is the result of a task that was skipped
+	TaskSkipped TaskResult = "skipping"
+	// TaskFailed is the result of a task that failed
+	TaskFailed TaskResult = "failed"
+	// TaskUnreachable is the result of a task that couldn't be run as host was unreachable
+	TaskUnreachable TaskResult = "unreachable"
+)
+
+var taskResultRegexp = regexp.MustCompile(`^(ok|changed|skipping|fatal|failed|unreachable):\s+\[([^\]\s]+)`)
+
+var taskHeaderRegexp = regexp.MustCompile(`^(?:TASK|RUNNING HANDLER) \[(.*)\]`)
+
+// ParseTaskHeader parses a line of playbook output and returns the name of the
+// task, if the line begins one.
+func ParseTaskHeader(line string) (string, bool) {
+	m := taskHeaderRegexp.FindStringSubmatch(line)
+	if m == nil {
+		return "", false
+	}
+	return m[1], true
+}
+
+// ParseTaskResult parses a line of playbook output and returns the host and the
+// task result, if the line reports one.
+func ParseTaskResult(line string) (string, TaskResult, bool) {
+	m := taskResultRegexp.FindStringSubmatch(strings.TrimSpace(line))
+	if m == nil {
+		return "", "", false
+	}
+	result := TaskResult(m[1])
+	if m[1] == "fatal" {
+		result = TaskFailed
+		if strings.Contains(line, "UNREACHABLE!") {
+			result = TaskUnreachable
+		}
+	}
+	return m[2], result, true
+}
+
+// IsFailure returns true if the task result denotes a failure on the host
+func (r TaskResult) IsFailure() bool {
+	return r == TaskFailed || r == TaskUnreachable
+}
@@ -0,0 +1,47 @@
+// +build unittest
+
+package ansible
+
+import . "gopkg.in/check.v1"
+
+func (s *ansibleSuite) TestParseTaskResult(c *C) {
+	tests := map[string]struct {
+		host   string
+		result TaskResult
+		ok     bool
+	}{
+		"ok: [node1]":                                        {"node1", TaskOk, true},
+		"changed: [node1] => (item=foo)":                     {"node1", TaskChanged, true},
+		"skipping: [node2]":                                  {"node2", TaskSkipped, true},
+		"ok: [node1 -> localhost]":                           {"node1", TaskOk, true},
+		`fatal: [node1]: FAILED! => {"changed": false}`:      {"node1", TaskFailed, true},
+		`fatal: [node2]: UNREACHABLE! => {"changed": false}`: {"node2", TaskUnreachable, true},
+		"failed: [node3] (item=bar) => {}":                   {"node3", TaskFailed, true},
+		"TASK [setup] *******":                               {"", "", false},
+	}
+
+	for line, test := range tests {
+		host, result, ok := ParseTaskResult(line)
+		c.Assert(ok, Equals, test.ok, Commentf("line: %s", line))
+		c.Assert(host, Equals, test.host, Commentf("line: %s", line))
+		c.Assert(result, Equals, test.result, Commentf("line: %s", line))
+	}
+}
+
+func (s *ansibleSuite) TestParseTaskHeader(c *C) {
+	tests := map[string]struct {
+		task string
+		ok   bool
+	}{
+		"TASK [setup] *******":                       {"setup", true},
+		"RUNNING HANDLER [restart docker] *********": {"restart docker", true},
+		"PLAY [all] *******":                         {"", false},
+		"ok: [node1]":                                {"", false},
+	}
+
+	for line, test := range tests {
+		task, ok := ParseTaskHeader(line)
+		c.Assert(ok, Equals, test.ok, Commentf("line: %s", line))
+		c.Assert(task, Equals, test.task, Commentf("line: %s", line))
+	}
+}
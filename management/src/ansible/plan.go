@@ -0,0 +1,68 @@
+package ansible
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// diffHeader starts the diff of a change, as reported by a playbook run with '--diff'
+const diffHeader = "--- before"
+
+// TaskChange is a change that a task would make on a host, as reported by a
+// playbook run in check mode
+type TaskChange struct {
+	Task string `json:"task"`
+	// Diff is the diff of the change, if the task reports one
+	Diff string `json:"diff,omitempty"`
+}
+
+// Plan contains the changes that the tasks would make on each host, in the
+// order of the tasks, keyed by inventory name of the host
+type Plan map[string][]TaskChange
+
+// ParsePlan parses the changes reported by one or more playbook runs in check
+// mode, i.e. with '--check --diff'. The diff of a change is reported before
+// the task's result on the host, so it's attributed to the host with the
+// result that follows it.
+func ParsePlan(r io.Reader) (Plan, error) {
+	plan := Plan{}
+	var (
+		task   string
+		diff   []string
+		inDiff bool
+	)
+	// takeDiff returns the diff reported since the last result and resets it
+	takeDiff := func() string {
+		d := strings.TrimSpace(strings.Join(diff, "\n"))
+		diff, inDiff = nil, false
+		return d
+	}
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 4096), 1<<20)
+	for s.Scan() {
+		line := s.Text()
+		if name, ok := ParseTaskHeader(line); ok {
+			task = name
+			takeDiff()
+			continue
+		}
+		if host, result, ok := ParseTaskResult(line); ok {
+			d := takeDiff()
+			if result == TaskChanged && task != "" {
+				plan[host] = append(plan[host], TaskChange{Task: task, Diff: d})
+			}
+			continue
+		}
+		if strings.HasPrefix(line, diffHeader) {
+			inDiff = true
+		}
+		if inDiff {
+			diff = append(diff, line)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
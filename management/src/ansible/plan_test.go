@@ -0,0 +1,61 @@
+// +build unittest
+
+package ansible
+
+import (
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *ansibleSuite) TestParsePlan(c *C) {
+	out := `
+PLAY [cluster-node] ************************************************************
+
+TASK [setup] *******************************************************************
+ok: [node1]
+ok: [node2]
+
+TASK [base : install packages] *************************************************
+changed: [node1] => (item=ntp)
+skipping: [node2]
+
+TASK [base : copy ntp config] **************************************************
+--- before: /etc/ntp.conf
++++ after: /etc/ntp.conf
+@@ -1 +1 @@
+-server 1.1.1.1
++server 2.2.2.2
+
+changed: [node1]
+--- before: /etc/ntp.conf
++++ after: /etc/ntp.conf
+@@ -1 +1 @@
+-server 3.3.3.3
++server 2.2.2.2
+
+changed: [node2]
+
+RUNNING HANDLER [base : restart ntp] *******************************************
+changed: [node1]
+fatal: [node2]: FAILED! => {"changed": false}
+
+PLAY RECAP *********************************************************************
+node1                      : ok=4    changed=3    unreachable=0    failed=0
+node2                      : ok=2    changed=1    unreachable=0    failed=1
+`
+	plan, err := ParsePlan(strings.NewReader(out))
+	c.Assert(err, IsNil)
+	c.Assert(plan, DeepEquals, Plan{
+		"node1": {
+			{Task: "base : install packages"},
+			{Task: "base : copy ntp config",
+				Diff: "--- before: /etc/ntp.conf\n+++ after: /etc/ntp.conf\n@@ -1 +1 @@\n-server 1.1.1.1\n+server 2.2.2.2"},
+			{Task: "base : restart ntp"},
+		},
+		"node2": {
+			{Task: "base : copy ntp config",
+				Diff: "--- before: /etc/ntp.conf\n+++ after: /etc/ntp.conf\n@@ -1 +1 @@\n-server 3.3.3.3\n+server 2.2.2.2"},
+		},
+	})
+}
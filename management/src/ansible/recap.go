@@ -0,0 +1,80 @@
+package ansible
+
+import (
+	"bufio"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const recapHeader = "PLAY RECAP"
+
+var recapLineRegexp = regexp.MustCompile(`^(\S+)\s+:\s+ok=(\d+)\s+changed=(\d+)\s+unreachable=(\d+)\s+failed=(\d+)`)
+
+// HostRecap contains the per host task counts as reported in the play recap of
+// a playbook run
+type HostRecap struct {
+	Ok          int `json:"ok"`
+	Changed     int `json:"changed"`
+	Unreachable int `json:"unreachable"`
+	Failed      int `json:"failed"`
+}
+
+// IsFailed returns true if one or more tasks failed or the host was unreachable
+func (h HostRecap) IsFailed() bool {
+	return h.Failed > 0 || h.Unreachable > 0
+}
+
+// Recap contains the task counts of all hosts, keyed by inventory name of the host
+type Recap map[string]HostRecap
+
+// ParseRecap parses the play recap(s) from the output of one or more playbook runs.
+// The counts for a host are accumulated if it appears in more than one recap.
+func ParseRecap(r io.Reader) (Recap, error) {
+	recap := Recap{}
+	inRecap := false
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if strings.HasPrefix(line, recapHeader) {
+			inRecap = true
+			continue
+		}
+		if !inRecap {
+			continue
+		}
+		m := recapLineRegexp.FindStringSubmatch(line)
+		if m == nil {
+			// recap ends at the first line that is not a host's recap
+			inRecap = line == ""
+			continue
+		}
+		counts := [4]int{}
+		for i := range counts {
+			// the regexp only matches digits, so ignoring the error is safe here
+			counts[i], _ = strconv.Atoi(m[i+2])
+		}
+		h := recap[m[1]]
+		h.Ok += counts[0]
+		h.Changed += counts[1]
+		h.Unreachable += counts[2]
+		h.Failed += counts[3]
+		recap[m[1]] = h
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return recap, nil
+}
+
+// FailedHosts returns the names of hosts that had failed tasks or were unreachable
+func (r Recap) FailedHosts() []string {
+	hosts := []string{}
+	for name, h := range r {
+		if h.IsFailed() {
+			hosts = append(hosts, name)
+		}
+	}
+	return hosts
+}
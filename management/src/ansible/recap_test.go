@@ -0,0 +1,44 @@
+// +build unittest
+
+package ansible
+
+import (
+	"sort"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *ansibleSuite) TestParseRecap(c *C) {
+	out := `
+PLAY [cluster-node] ************************************************************
+
+TASK [setup] *******************************************************************
+ok: [node1]
+fatal: [node2]: UNREACHABLE! => {"changed": false, "unreachable": true}
+
+PLAY RECAP *********************************************************************
+node1                      : ok=5    changed=2    unreachable=0    failed=0
+node2                      : ok=0    changed=0    unreachable=1    failed=0
+
+PLAY [cluster-node] ************************************************************
+
+PLAY RECAP *********************************************************************
+node1                      : ok=1    changed=1    unreachable=0    failed=1
+`
+	recap, err := ParseRecap(strings.NewReader(out))
+	c.Assert(err, IsNil)
+	c.Assert(recap, DeepEquals, Recap{
+		"node1": {Ok: 6, Changed: 3, Unreachable: 0, Failed: 1},
+		"node2": {Ok: 0, Changed: 0, Unreachable: 1, Failed: 0},
+	})
+	failed := recap.FailedHosts()
+	sort.Strings(failed)
+	c.Assert(failed, DeepEquals, []string{"node1", "node2"})
+}
+
+func (s *ansibleSuite) TestParseRecapNoRecap(c *C) {
+	recap, err := ParseRecap(strings.NewReader("node1 : ok=1 changed=0 unreachable=0 failed=0\n"))
+	c.Assert(err, IsNil)
+	c.Assert(len(recap), Equals, 0)
+}
@@ -0,0 +1,41 @@
+package boltdb
+
+import "github.com/boltdb/bolt"
+
+// PutAnnotations creates or updates the annotations record of the node with
+// specified name
+func (c *Client) PutAnnotations(name string, info []byte) error {
+	return c.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(annotationsBucket))
+		return b.Put([]byte(name), info)
+	})
+}
+
+// GetAllAnnotations queries and returns the annotations records of all the
+// nodes, keyed by node name
+func (c *Client) GetAllAnnotations() (map[string][]byte, error) {
+	vals := map[string][]byte{}
+
+	if err := c.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(annotationsBucket))
+		return b.ForEach(func(k, v []byte) error {
+			// the value is only valid for the life of the transaction, so copy it
+			val := make([]byte, len(v))
+			copy(val, v)
+			vals[string(k)] = val
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+
+	return vals, nil
+}
+
+// DeleteAnnotations deletes the annotations record of the node with specified name
+func (c *Client) DeleteAnnotations(name string) error {
+	return c.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(annotationsBucket))
+		return b.Delete([]byte(name))
+	})
+}
@@ -0,0 +1,38 @@
+package boltdb
+
+import "github.com/boltdb/bolt"
+
+// AppendAuditRecord appends a record to the audit log. The records are never
+// updated or deleted
+func (c *Client) AppendAuditRecord(info []byte) error {
+	return c.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(auditBucket))
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		// the sequence is encoded like the job ids, to keep the records ordered
+		return b.Put(jobKey(seq), info)
+	})
+}
+
+// GetAllAuditRecords queries and returns all the records of the audit log, in
+// the order they were appended
+func (c *Client) GetAllAuditRecords() ([][]byte, error) {
+	var vals [][]byte
+
+	if err := c.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(auditBucket))
+		return b.ForEach(func(k, v []byte) error {
+			// the value is only valid for the life of the transaction, so copy it
+			val := make([]byte, len(v))
+			copy(val, v)
+			vals = append(vals, val)
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+
+	return vals, nil
+}
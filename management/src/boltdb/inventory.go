@@ -9,7 +9,13 @@ import (
 )
 
 const (
-	assetsBucket = "assets"
+	assetsBucket      = "assets"
+	jobsBucket        = "jobs"
+	annotationsBucket = "annotations"
+	auditBucket       = "audit"
+	nodeHistoryBucket = "node_history"
+	maintenanceBucket = "maintenance"
+	labelsBucket      = "labels"
 )
 
 // Config denotes the configuration for boltdb client
@@ -46,8 +52,13 @@ func NewClientFromConfig(config Config) (*Client, error) {
 	}
 
 	if err := db.Update(func(tx *bolt.Tx) error {
-		_, err := tx.CreateBucketIfNotExists([]byte(assetsBucket))
-		return err
+		for _, bucket := range []string{assetsBucket, jobsBucket, annotationsBucket, auditBucket,
+			nodeHistoryBucket, maintenanceBucket, labelsBucket} {
+			if _, err := tx.CreateBucketIfNotExists([]byte(bucket)); err != nil {
+				return err
+			}
+		}
+		return nil
 	}); err != nil {
 		return nil, err
 	}
@@ -110,6 +121,14 @@ func (c *Client) GetAsset(tag string) (Asset, error) {
 	return a, nil
 }
 
+// DeleteAsset deletes the asset with specified tag
+func (c *Client) DeleteAsset(tag string) error {
+	return c.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(assetsBucket))
+		return b.Delete([]byte(tag))
+	})
+}
+
 // GetAllAssets queries and returns a all the assets
 func (c *Client) GetAllAssets() (interface{}, error) {
 	var (
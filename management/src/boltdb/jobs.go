@@ -0,0 +1,51 @@
+package boltdb
+
+import (
+	"encoding/binary"
+
+	"github.com/boltdb/bolt"
+)
+
+// jobKey returns the key for a job record. The keys are big-endian encoded
+// so that bolt's byte ordering of keys matches the ordering of job ids.
+func jobKey(id uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, id)
+	return key
+}
+
+// PutJob creates or updates the record of the job with specified id
+func (c *Client) PutJob(id uint64, info []byte) error {
+	return c.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(jobsBucket))
+		return b.Put(jobKey(id), info)
+	})
+}
+
+// GetAllJobs queries and returns the records of all the jobs, ordered by job id
+func (c *Client) GetAllJobs() ([][]byte, error) {
+	var vals [][]byte
+
+	if err := c.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(jobsBucket))
+		return b.ForEach(func(k, v []byte) error {
+			// the value is only valid for the life of the transaction, so copy it
+			val := make([]byte, len(v))
+			copy(val, v)
+			vals = append(vals, val)
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+
+	return vals, nil
+}
+
+// DeleteJob deletes the record of the job with specified id
+func (c *Client) DeleteJob(id uint64) error {
+	return c.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(jobsBucket))
+		return b.Delete(jobKey(id))
+	})
+}
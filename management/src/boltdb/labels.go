@@ -0,0 +1,41 @@
+package boltdb
+
+import "github.com/boltdb/bolt"
+
+// PutLabels creates or updates the labels record of the node with
+// specified name
+func (c *Client) PutLabels(name string, info []byte) error {
+	return c.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(labelsBucket))
+		return b.Put([]byte(name), info)
+	})
+}
+
+// GetAllLabels queries and returns the labels records of all the
+// nodes, keyed by node name
+func (c *Client) GetAllLabels() (map[string][]byte, error) {
+	vals := map[string][]byte{}
+
+	if err := c.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(labelsBucket))
+		return b.ForEach(func(k, v []byte) error {
+			// the value is only valid for the life of the transaction, so copy it
+			val := make([]byte, len(v))
+			copy(val, v)
+			vals[string(k)] = val
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+
+	return vals, nil
+}
+
+// DeleteLabels deletes the labels record of the node with specified name
+func (c *Client) DeleteLabels(name string) error {
+	return c.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(labelsBucket))
+		return b.Delete([]byte(name))
+	})
+}
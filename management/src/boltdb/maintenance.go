@@ -0,0 +1,41 @@
+package boltdb
+
+import "github.com/boltdb/bolt"
+
+// PutMaintenance creates or updates the maintenance record of the node with
+// specified name
+func (c *Client) PutMaintenance(name string, info []byte) error {
+	return c.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(maintenanceBucket))
+		return b.Put([]byte(name), info)
+	})
+}
+
+// GetAllMaintenance queries and returns the maintenance records of all the
+// nodes in maintenance, keyed by node name
+func (c *Client) GetAllMaintenance() (map[string][]byte, error) {
+	vals := map[string][]byte{}
+
+	if err := c.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(maintenanceBucket))
+		return b.ForEach(func(k, v []byte) error {
+			// the value is only valid for the life of the transaction, so copy it
+			val := make([]byte, len(v))
+			copy(val, v)
+			vals[string(k)] = val
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+
+	return vals, nil
+}
+
+// DeleteMaintenance deletes the maintenance record of the node with specified name
+func (c *Client) DeleteMaintenance(name string) error {
+	return c.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(maintenanceBucket))
+		return b.Delete([]byte(name))
+	})
+}
@@ -0,0 +1,33 @@
+package boltdb
+
+import "github.com/boltdb/bolt"
+
+// PutNodeHistory creates or updates the history record of the node with
+// specified name
+func (c *Client) PutNodeHistory(name string, info []byte) error {
+	return c.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(nodeHistoryBucket))
+		return b.Put([]byte(name), info)
+	})
+}
+
+// GetAllNodeHistory queries and returns the history records of all the nodes,
+// keyed by node name
+func (c *Client) GetAllNodeHistory() (map[string][]byte, error) {
+	vals := map[string][]byte{}
+
+	if err := c.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(nodeHistoryBucket))
+		return b.ForEach(func(k, v []byte) error {
+			// the value is only valid for the life of the transaction, so copy it
+			val := make([]byte, len(v))
+			copy(val, v)
+			vals[string(k)] = val
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+
+	return vals, nil
+}
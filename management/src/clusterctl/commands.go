@@ -12,7 +12,12 @@ var (
 		cli.StringFlag{
 			Name:  "url, u",
 			Value: manager.DefaultConfig().Manager.Addr,
-			Usage: "cluster manager's REST service url",
+			Usage: "cluster manager's REST service url. Use 'unix:/path/to/sock' form for a unix socket",
+		},
+		cli.StringFlag{
+			Name:  "base-path",
+			Value: "",
+			Usage: "path prefix, like '/clusterm', that cluster manager's REST service is served under, if any",
 		},
 	}
 
@@ -37,12 +42,25 @@ var (
 			Name:  "follow, f",
 			Usage: "stream job logs (just like tail -f). Only applicable for an active job",
 		},
+		cli.StringFlag{
+			Name:  "stream, s",
+			Value: "",
+			Usage: "stream only the specified output of job logs when following. Possible values: stdout or stderr",
+		},
 	}
 
 	postFlags = []cli.Flag{
 		extraVarsFlag,
 	}
 
+	decommissionFlags = []cli.Flag{
+		extraVarsFlag,
+		cli.BoolFlag{
+			Name:  "force, f",
+			Usage: "decommission the node(s) even if they include the last master node of the cluster",
+		},
+	}
+
 	postHostGroupFlags = []cli.Flag{
 		extraVarsFlag,
 		cli.StringFlag{
@@ -50,6 +68,23 @@ var (
 			Value: "",
 			Usage: "host-group of the node(s). Possible values: service-master or service-worker",
 		},
+		cli.StringFlag{
+			Name:  "playbook, p",
+			Value: "",
+			Usage: "playbook to run instead of the default configuration playbook. It should be one of the playbooks allowed by clusterm configuration",
+		},
+	}
+
+	configSetFlags = []cli.Flag{
+		cli.StringFlag{
+			Name:  "version, v",
+			Value: "",
+			Usage: "version of the configuration, as shown by 'config get', that the configuration being set is based on. The set fails if the configuration has changed since",
+		},
+		cli.BoolFlag{
+			Name:  "force, f",
+			Usage: "set the configuration whatever version the current configuration is at",
+		},
 	}
 
 	commands = []cli.Command{
@@ -70,7 +105,7 @@ var (
 					Aliases: []string{"d"},
 					Usage:   "decommission a node",
 					Action:  doAction(newPostActioner(validateOneArg, nodeDecommission)),
-					Flags:   postFlags,
+					Flags:   decommissionFlags,
 				},
 				{
 					Name:    "update",
@@ -105,14 +140,14 @@ var (
 					Aliases: []string{"d"},
 					Usage:   "decommission a set of nodes",
 					Action:  doAction(newPostActioner(validateMultiNodeNames, nodesDecommission)),
-					Flags:   postFlags,
+					Flags:   decommissionFlags,
 				},
 				{
 					Name:    "update",
 					Aliases: []string{"u"},
 					Usage:   "update a set of nodes",
 					Action:  doAction(newPostActioner(validateMultiNodeNames, nodesUpdate)),
-					Flags:   postFlags,
+					Flags:   postHostGroupFlags,
 				},
 				{
 					Name:    "get",
@@ -121,6 +156,12 @@ var (
 					Action:  doAction(newGetActioner(nodesGet)),
 					Flags:   getFlags,
 				},
+				{
+					Name:   "discovered",
+					Usage:  "get status information for the discovered nodes that are not commissioned yet",
+					Action: doAction(newGetActioner(nodesDiscoveredGet)),
+					Flags:  getFlags,
+				},
 			},
 		},
 		{
@@ -142,6 +183,12 @@ var (
 					Action:  doAction(newPostActioner(validateZeroArgs, globalsSet)),
 					Flags:   postFlags,
 				},
+				{
+					Name:    "validate",
+					Aliases: []string{"v"},
+					Usage:   "validate global info without setting it. Expects an arg with the file containing the globals or '-' for stdin",
+					Action:  doAction(newPostActioner(validateOneArg, globalsValidate)),
+				},
 			},
 		},
 		{
@@ -152,10 +199,29 @@ var (
 				{
 					Name:    "get",
 					Aliases: []string{"g"},
-					Usage:   "get job info. Expects an arg with value 'active' or 'last'",
+					Usage:   "get job info. Expects an arg with value 'active', 'last' or a job id",
 					Action:  doAction(newGetActioner(jobGet)),
 					Flags:   getJobFlags,
 				},
+				{
+					Name:    "list",
+					Aliases: []string{"l"},
+					Usage:   "list the active and recent jobs",
+					Action:  doAction(newGetActioner(jobsGet)),
+					Flags:   getFlags,
+				},
+				{
+					Name:    "retry",
+					Aliases: []string{"r"},
+					Usage:   "retry a job on the nodes that failed in it. Expects an arg with value 'last'",
+					Action:  doAction(newPostActioner(validateOneArg, jobRetry)),
+				},
+				{
+					Name:    "cancel",
+					Aliases: []string{"c"},
+					Usage:   "cancel a scheduled or running job. Expects an arg with value 'active' or a job id",
+					Action:  doAction(newPostActioner(validateOneArg, jobCancel)),
+				},
 			},
 		},
 		{
@@ -182,6 +248,7 @@ var (
 					Aliases: []string{"s"},
 					Usage:   "set clusterm configuration. use '-' as the arg to read JSON configuration from stdin, else provide a path to the file containing JSON configuration",
 					Action:  doAction(newPostActioner(validateOneArg, configSet)),
+					Flags:   configSetFlags,
 				},
 			},
 		},
@@ -199,8 +266,13 @@ func errInvalidIPAddr(a string) error {
 type parsedFlags struct {
 	extraVars  string
 	hostGroup  string
+	playbook   string
+	force      bool
 	jsonOutput bool
 	streamLogs bool
+	logStream  string
+	// configVersion is the version of the configuration that a config set is based on
+	configVersion string
 }
 
 type actioner interface {
@@ -211,11 +283,11 @@ type actioner interface {
 
 func doAction(a actioner) func(*cli.Context) {
 	return func(c *cli.Context) {
-		cClient := manager.NewClient(c.GlobalString("url"))
+		cClient := manager.NewClient(c.GlobalString("url")).WithBasePath(c.GlobalString("base-path"))
 		a.procArgs(c)
 		a.procFlags(c)
 		if err := a.action(cClient); err != nil {
-			logrus.Fatalf(err.Error())
+			logrus.Fatal(err)
 		}
 	}
 }
@@ -14,15 +14,18 @@ import (
 )
 
 type nodeInfo struct {
-	Mon map[string]interface{} `json:"monitoring_state"`
-	Inv map[string]interface{} `json:"inventory_state"`
-	Cfg map[string]interface{} `json:"configuration_state"`
+	Mon  map[string]interface{} `json:"monitoring_state"`
+	Inv  map[string]interface{} `json:"inventory_state"`
+	Cfg  map[string]interface{} `json:"configuration_state"`
+	Tags map[string]interface{} `json:"tags"`
 }
 
 type nodesInfo map[string]nodeInfo
 
 type jobInfo map[string]interface{}
 
+type jobsInfo []jobInfo
+
 type globalInfo map[string]interface{}
 
 type configInfo map[string]interface{}
@@ -107,6 +110,8 @@ var (
 	{{- template "typePrint" newPrintHelper $indent .Mon }}
 	{{- $invName }}: Configuration State{{ "\n" }}
 	{{- template "typePrint" newPrintHelper $indent .Cfg }}
+	{{- $invName }}: Tags{{ "\n" }}
+	{{- template "typePrint" newPrintHelper $indent .Tags }}
 {{ end }}
 `
 	nodeTemplate = template.Must(template.Must(typeTemplate.Clone()).Parse(nodePrint))
@@ -120,7 +125,16 @@ var (
 	jobPrint = `
 Description: {{ .desc }}
 Status: {{ .status }}
+Progress: {{ .progress }}%
 Error: {{ .error }}
+{{- with .summary }}
+Summary:
+{{ template "typePrint" newPrintHelper "    " . }}
+{{- end }}
+{{- with .node_status }}
+Node Status:
+{{ template "typePrint" newPrintHelper "    " . }}
+{{- end }}
 Logs:
 {{ template "typePrint" newPrintHelper "    " .logs }}
 `
@@ -129,9 +143,24 @@ Logs:
 	shortJobPrint = `
 Description: {{ .desc }}
 Status: {{ .status }}
+Progress: {{ .progress }}%
 Error: {{ .error }}
+{{- with .node_status }}
+Node Status:
+{{ template "typePrint" newPrintHelper "    " . }}
+{{- end }}
 `
 	shortJobTemplate = template.Must(template.Must(typeTemplate.Clone()).Parse(shortJobPrint))
+
+	multiJobPrint = `
+{{- range . }}
+Id: {{ .id }} Status: {{ .status }} Progress: {{ .progress }}%
+Description: {{ .desc }}
+{{- if .error }}
+Error: {{ .error }}
+{{- end }}
+{{ end }}`
+	multiJobTemplate = template.Must(template.Must(typeTemplate.Clone()).Parse(multiJobPrint))
 )
 
 type getCallback func(c *manager.Client, arg string, flags parsedFlags) error
@@ -149,6 +178,7 @@ func newGetActioner(getCb getCallback) *getActioner {
 func (nga *getActioner) procFlags(c *cli.Context) {
 	nga.flags.jsonOutput = c.Bool("json")
 	nga.flags.streamLogs = c.Bool("follow")
+	nga.flags.logStream = c.String("stream")
 	return
 }
 
@@ -210,6 +240,19 @@ func nodesGet(c *manager.Client, noop string, flags parsedFlags) error {
 	return ppJSON(out)
 }
 
+func nodesDiscoveredGet(c *manager.Client, noop string, flags parsedFlags) error {
+	out, err := c.GetDiscoveredNodes()
+	if err != nil {
+		return err
+	}
+
+	if !flags.jsonOutput {
+		return printTemplate(out, multiNodeTemplate, &nodesInfo{})
+	}
+
+	return ppJSON(out)
+}
+
 func globalsGet(c *manager.Client, noop string, flags parsedFlags) error {
 	out, err := c.GetGlobals()
 	if err != nil {
@@ -239,7 +282,7 @@ func jobGet(c *manager.Client, job string, flags parsedFlags) error {
 		if err := printTemplate(out, shortJobTemplate, &jobInfo{}); err != nil {
 			return err
 		}
-		logs, err := c.StreamLogs(job)
+		logs, err := c.StreamLogsWithStream(job, manager.LogStream(flags.logStream))
 		if err != nil {
 			return err
 		}
@@ -264,15 +307,32 @@ func jobGet(c *manager.Client, job string, flags parsedFlags) error {
 	return ppJSON(out)
 }
 
+func jobsGet(c *manager.Client, noop string, flags parsedFlags) error {
+	out, err := c.GetJobs()
+	if err != nil {
+		return err
+	}
+
+	if !flags.jsonOutput {
+		return printTemplate(out, multiJobTemplate, &jobsInfo{})
+	}
+
+	return ppJSON(out)
+}
+
 func configGet(c *manager.Client, noop string, flags parsedFlags) error {
-	out, err := c.GetConfig()
+	out, version, err := c.GetConfigWithVersion()
 	if err != nil {
 		return err
 	}
 
+	// the version is printed apart from the json output, so that the output
+	// can be edited and set as is
 	if !flags.jsonOutput {
+		fmt.Printf("version: %d\n", version)
 		return printTemplate(out, configTemplate, &configInfo{})
 	}
 
+	fmt.Fprintf(os.Stderr, "version: %d\n", version)
 	return ppJSON(out)
 }
@@ -3,8 +3,12 @@
 package main
 
 import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 
+	"github.com/contiv/cluster/management/src/clusterm/manager"
 	. "gopkg.in/check.v1"
 )
 
@@ -49,3 +53,27 @@ func (s *mainSuite) TestCommandArgValidationError(c *C) {
 		c.Assert(err.Error(), Equals, test.exptdErr.Error(), Commentf("test key: %s", key))
 	}
 }
+
+func (s *mainSuite) TestConfigSetVersion(c *C) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"7"`)
+		w.Write([]byte("{}"))
+	}))
+	defer srv.Close()
+	client := manager.NewClient(strings.TrimPrefix(srv.URL, "http://"))
+
+	// the specified version is used as is
+	version, err := configSetVersion(client, parsedFlags{configVersion: "3", force: true})
+	c.Assert(err, IsNil)
+	c.Assert(version, Equals, uint64(3))
+
+	_, err = configSetVersion(client, parsedFlags{configVersion: "foo"})
+	c.Assert(err, ErrorMatches, "invalid configuration version.*")
+
+	// the current version is used only when the set is forced
+	_, err = configSetVersion(client, parsedFlags{})
+	c.Assert(err, ErrorMatches, ".*version of the configuration being set is not specified.*")
+	version, err = configSetVersion(client, parsedFlags{force: true})
+	c.Assert(err, IsNil)
+	c.Assert(version, Equals, uint64(7))
+}
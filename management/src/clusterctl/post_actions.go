@@ -2,9 +2,12 @@ package main
 
 import (
 	"bufio"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"net"
 	"os"
+	"strconv"
 
 	"github.com/codegangsta/cli"
 	"github.com/contiv/cluster/management/src/clusterm/manager"
@@ -31,6 +34,9 @@ func newPostActioner(validateCb validateCallback, postCb postCallback) *postActi
 func (npa *postActioner) procFlags(c *cli.Context) {
 	npa.flags.extraVars = c.String("extra-vars")
 	npa.flags.hostGroup = c.String("host-group")
+	npa.flags.playbook = c.String("playbook")
+	npa.flags.force = c.Bool("force")
+	npa.flags.configVersion = c.String("version")
 }
 
 func (npa *postActioner) procArgs(c *cli.Context) {
@@ -44,6 +50,18 @@ func (npa *postActioner) action(c *manager.Client) error {
 	return npa.postCb(c, npa.args, npa.flags)
 }
 
+// printJobID prints the id of the job triggered by a request, so that the job
+// can be looked up afterwards
+func printJobID(jobID string, err error) error {
+	if err != nil {
+		return err
+	}
+	if jobID != "" {
+		fmt.Printf("job: %s\n", jobID)
+	}
+	return nil
+}
+
 func validateOneArg(args []string) error {
 	if len(args) != 1 {
 		return errUnexpectedArgCount("1", len(args))
@@ -53,17 +71,20 @@ func validateOneArg(args []string) error {
 
 func nodeCommission(c *manager.Client, args []string, flags parsedFlags) error {
 	nodeName := args[0]
-	return c.PostNodeCommission(nodeName, flags.extraVars, flags.hostGroup)
+	return printJobID(c.PostNodesCommissionWithPlaybook([]string{nodeName}, flags.extraVars, flags.hostGroup, flags.playbook))
 }
 
 func nodeDecommission(c *manager.Client, args []string, flags parsedFlags) error {
 	nodeName := args[0]
-	return c.PostNodeDecommission(nodeName, flags.extraVars)
+	if flags.force {
+		return printJobID(c.PostNodesDecommissionForce([]string{nodeName}, flags.extraVars))
+	}
+	return printJobID(c.PostNodeDecommission(nodeName, flags.extraVars))
 }
 
 func nodeUpdate(c *manager.Client, args []string, flags parsedFlags) error {
 	nodeName := args[0]
-	return c.PostNodeUpdate(nodeName, flags.extraVars, flags.hostGroup)
+	return printJobID(c.PostNodesUpdateWithPlaybook([]string{nodeName}, flags.extraVars, flags.hostGroup, flags.playbook))
 }
 
 func validateMultiNodeNames(args []string) error {
@@ -74,15 +95,18 @@ func validateMultiNodeNames(args []string) error {
 }
 
 func nodesCommission(c *manager.Client, args []string, flags parsedFlags) error {
-	return c.PostNodesCommission(args, flags.extraVars, flags.hostGroup)
+	return printJobID(c.PostNodesCommissionWithPlaybook(args, flags.extraVars, flags.hostGroup, flags.playbook))
 }
 
 func nodesDecommission(c *manager.Client, args []string, flags parsedFlags) error {
-	return c.PostNodesDecommission(args, flags.extraVars)
+	if flags.force {
+		return printJobID(c.PostNodesDecommissionForce(args, flags.extraVars))
+	}
+	return printJobID(c.PostNodesDecommission(args, flags.extraVars))
 }
 
 func nodesUpdate(c *manager.Client, args []string, flags parsedFlags) error {
-	return c.PostNodesUpdate(args, flags.extraVars, flags.hostGroup)
+	return printJobID(c.PostNodesUpdateWithPlaybook(args, flags.extraVars, flags.hostGroup, flags.playbook))
 }
 
 func validateMultiNodeAddrs(args []string) error {
@@ -98,7 +122,15 @@ func validateMultiNodeAddrs(args []string) error {
 }
 
 func nodesDiscover(c *manager.Client, args []string, flags parsedFlags) error {
-	return c.PostNodesDiscover(args, flags.extraVars)
+	return printJobID(c.PostNodesDiscover(args, flags.extraVars))
+}
+
+func jobRetry(c *manager.Client, args []string, noop parsedFlags) error {
+	return printJobID(c.RetryFailedNodes(args[0]))
+}
+
+func jobCancel(c *manager.Client, args []string, noop parsedFlags) error {
+	return c.CancelJob(args[0])
 }
 
 func validateZeroArgs(args []string) error {
@@ -112,7 +144,38 @@ func globalsSet(c *manager.Client, noop []string, flags parsedFlags) error {
 	return c.PostGlobals(flags.extraVars)
 }
 
-func configSet(c *manager.Client, args []string, noop parsedFlags) error {
+func globalsValidate(c *manager.Client, args []string, noop parsedFlags) error {
+	var reader io.Reader
+
+	if args[0] == "-" {
+		reader = bufio.NewReader(os.Stdin)
+	} else {
+		f, err := os.Open(args[0])
+		if err != nil {
+			return errored.Errorf("failed to open globals file. Error: %v", err)
+		}
+		defer func() { f.Close() }()
+		reader = bufio.NewReader(f)
+	}
+
+	globals, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return errored.Errorf("failed to read globals. Error: %v", err)
+	}
+	report, err := c.ValidateGlobals(string(globals))
+	if err != nil {
+		return err
+	}
+	for _, p := range report.Problems {
+		fmt.Println(p)
+	}
+	if !report.Valid {
+		return errored.Errorf("globals are not valid, found %d problem(s)", len(report.Problems))
+	}
+	return nil
+}
+
+func configSet(c *manager.Client, args []string, flags parsedFlags) error {
 	var reader io.Reader
 
 	if args[0] == "-" {
@@ -131,5 +194,27 @@ func configSet(c *manager.Client, args []string, noop parsedFlags) error {
 		return err
 	}
 
-	return c.PostConfig(config)
+	version, err := configSetVersion(c, flags)
+	if err != nil {
+		return err
+	}
+	return c.PostConfig(config, version)
+}
+
+// configSetVersion returns the version of the configuration that the set is
+// based on, as specified. The configuration is replaced, whatever version it's
+// at, only if the set is forced
+func configSetVersion(c *manager.Client, flags parsedFlags) (uint64, error) {
+	if flags.configVersion != "" {
+		version, err := strconv.ParseUint(flags.configVersion, 10, 64)
+		if err != nil {
+			return 0, errored.Errorf("invalid configuration version %q. Expected a version as shown by 'config get'", flags.configVersion)
+		}
+		return version, nil
+	}
+	if !flags.force {
+		return 0, errored.Errorf("the version of the configuration being set is not specified. Specify the version, as shown by 'config get', or force the set")
+	}
+	_, version, err := c.GetConfigWithVersion()
+	return version, err
 }
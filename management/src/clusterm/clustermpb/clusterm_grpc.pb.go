@@ -0,0 +1,353 @@
+// The gRPC front-end of clusterm. It is served, alongside the REST api, when
+// the grpc_addr is set in clusterm's configuration.
+//
+// The Go code in clusterm.pb.go and clusterm_grpc.pb.go is generated from
+// this file by 'make generate-proto', with the protoc, protoc-gen-go and
+// protoc-gen-go-grpc versions pinned in the Makefile. 'make check-proto'
+// checks that the generated code is up to date with this file.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             v3.21.12
+// source: clusterm.proto
+
+package clustermpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	Clusterm_Commission_FullMethodName   = "/clustermpb.Clusterm/Commission"
+	Clusterm_Decommission_FullMethodName = "/clustermpb.Clusterm/Decommission"
+	Clusterm_Update_FullMethodName       = "/clustermpb.Clusterm/Update"
+	Clusterm_Discover_FullMethodName     = "/clustermpb.Clusterm/Discover"
+	Clusterm_GetNode_FullMethodName      = "/clustermpb.Clusterm/GetNode"
+	Clusterm_GetNodes_FullMethodName     = "/clustermpb.Clusterm/GetNodes"
+	Clusterm_GetJob_FullMethodName       = "/clustermpb.Clusterm/GetJob"
+)
+
+// ClustermClient is the client API for Clusterm service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type ClustermClient interface {
+	// Commission commissions the nodes, like a POST to commission/nodes
+	Commission(ctx context.Context, in *NodesRequest, opts ...grpc.CallOption) (*JobRef, error)
+	// Decommission decommissions the nodes, like a POST to decommission/nodes
+	Decommission(ctx context.Context, in *NodesRequest, opts ...grpc.CallOption) (*JobRef, error)
+	// Update updates the configuration of the nodes, like a POST to update/nodes
+	Update(ctx context.Context, in *NodesRequest, opts ...grpc.CallOption) (*JobRef, error)
+	// Discover discovers the nodes at the addresses, like a POST to discover/nodes
+	Discover(ctx context.Context, in *NodesRequest, opts ...grpc.CallOption) (*JobRef, error)
+	// GetNode returns the info of a node, like a GET of info/node/{tag}
+	GetNode(ctx context.Context, in *NodeRequest, opts ...grpc.CallOption) (*Node, error)
+	// GetNodes returns the info of the known nodes, like a GET of info/nodes
+	GetNodes(ctx context.Context, in *NodesFilter, opts ...grpc.CallOption) (*Nodes, error)
+	// GetJob returns the info of a job, like a GET of info/job/{job}
+	GetJob(ctx context.Context, in *JobRequest, opts ...grpc.CallOption) (*Job, error)
+}
+
+type clustermClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewClustermClient(cc grpc.ClientConnInterface) ClustermClient {
+	return &clustermClient{cc}
+}
+
+func (c *clustermClient) Commission(ctx context.Context, in *NodesRequest, opts ...grpc.CallOption) (*JobRef, error) {
+	out := new(JobRef)
+	err := c.cc.Invoke(ctx, Clusterm_Commission_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *clustermClient) Decommission(ctx context.Context, in *NodesRequest, opts ...grpc.CallOption) (*JobRef, error) {
+	out := new(JobRef)
+	err := c.cc.Invoke(ctx, Clusterm_Decommission_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *clustermClient) Update(ctx context.Context, in *NodesRequest, opts ...grpc.CallOption) (*JobRef, error) {
+	out := new(JobRef)
+	err := c.cc.Invoke(ctx, Clusterm_Update_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *clustermClient) Discover(ctx context.Context, in *NodesRequest, opts ...grpc.CallOption) (*JobRef, error) {
+	out := new(JobRef)
+	err := c.cc.Invoke(ctx, Clusterm_Discover_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *clustermClient) GetNode(ctx context.Context, in *NodeRequest, opts ...grpc.CallOption) (*Node, error) {
+	out := new(Node)
+	err := c.cc.Invoke(ctx, Clusterm_GetNode_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *clustermClient) GetNodes(ctx context.Context, in *NodesFilter, opts ...grpc.CallOption) (*Nodes, error) {
+	out := new(Nodes)
+	err := c.cc.Invoke(ctx, Clusterm_GetNodes_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *clustermClient) GetJob(ctx context.Context, in *JobRequest, opts ...grpc.CallOption) (*Job, error) {
+	out := new(Job)
+	err := c.cc.Invoke(ctx, Clusterm_GetJob_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ClustermServer is the server API for Clusterm service.
+// All implementations must embed UnimplementedClustermServer
+// for forward compatibility
+type ClustermServer interface {
+	// Commission commissions the nodes, like a POST to commission/nodes
+	Commission(context.Context, *NodesRequest) (*JobRef, error)
+	// Decommission decommissions the nodes, like a POST to decommission/nodes
+	Decommission(context.Context, *NodesRequest) (*JobRef, error)
+	// Update updates the configuration of the nodes, like a POST to update/nodes
+	Update(context.Context, *NodesRequest) (*JobRef, error)
+	// Discover discovers the nodes at the addresses, like a POST to discover/nodes
+	Discover(context.Context, *NodesRequest) (*JobRef, error)
+	// GetNode returns the info of a node, like a GET of info/node/{tag}
+	GetNode(context.Context, *NodeRequest) (*Node, error)
+	// GetNodes returns the info of the known nodes, like a GET of info/nodes
+	GetNodes(context.Context, *NodesFilter) (*Nodes, error)
+	// GetJob returns the info of a job, like a GET of info/job/{job}
+	GetJob(context.Context, *JobRequest) (*Job, error)
+	mustEmbedUnimplementedClustermServer()
+}
+
+// UnimplementedClustermServer must be embedded to have forward compatible implementations.
+type UnimplementedClustermServer struct {
+}
+
+func (UnimplementedClustermServer) Commission(context.Context, *NodesRequest) (*JobRef, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Commission not implemented")
+}
+func (UnimplementedClustermServer) Decommission(context.Context, *NodesRequest) (*JobRef, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Decommission not implemented")
+}
+func (UnimplementedClustermServer) Update(context.Context, *NodesRequest) (*JobRef, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Update not implemented")
+}
+func (UnimplementedClustermServer) Discover(context.Context, *NodesRequest) (*JobRef, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Discover not implemented")
+}
+func (UnimplementedClustermServer) GetNode(context.Context, *NodeRequest) (*Node, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetNode not implemented")
+}
+func (UnimplementedClustermServer) GetNodes(context.Context, *NodesFilter) (*Nodes, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetNodes not implemented")
+}
+func (UnimplementedClustermServer) GetJob(context.Context, *JobRequest) (*Job, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetJob not implemented")
+}
+func (UnimplementedClustermServer) mustEmbedUnimplementedClustermServer() {}
+
+// UnsafeClustermServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ClustermServer will
+// result in compilation errors.
+type UnsafeClustermServer interface {
+	mustEmbedUnimplementedClustermServer()
+}
+
+func RegisterClustermServer(s grpc.ServiceRegistrar, srv ClustermServer) {
+	s.RegisterService(&Clusterm_ServiceDesc, srv)
+}
+
+func _Clusterm_Commission_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(NodesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClustermServer).Commission(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Clusterm_Commission_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClustermServer).Commission(ctx, req.(*NodesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Clusterm_Decommission_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(NodesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClustermServer).Decommission(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Clusterm_Decommission_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClustermServer).Decommission(ctx, req.(*NodesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Clusterm_Update_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(NodesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClustermServer).Update(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Clusterm_Update_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClustermServer).Update(ctx, req.(*NodesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Clusterm_Discover_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(NodesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClustermServer).Discover(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Clusterm_Discover_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClustermServer).Discover(ctx, req.(*NodesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Clusterm_GetNode_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(NodeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClustermServer).GetNode(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Clusterm_GetNode_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClustermServer).GetNode(ctx, req.(*NodeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Clusterm_GetNodes_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(NodesFilter)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClustermServer).GetNodes(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Clusterm_GetNodes_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClustermServer).GetNodes(ctx, req.(*NodesFilter))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Clusterm_GetJob_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(JobRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClustermServer).GetJob(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Clusterm_GetJob_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClustermServer).GetJob(ctx, req.(*JobRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Clusterm_ServiceDesc is the grpc.ServiceDesc for Clusterm service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Clusterm_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "clustermpb.Clusterm",
+	HandlerType: (*ClustermServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Commission",
+			Handler:    _Clusterm_Commission_Handler,
+		},
+		{
+			MethodName: "Decommission",
+			Handler:    _Clusterm_Decommission_Handler,
+		},
+		{
+			MethodName: "Update",
+			Handler:    _Clusterm_Update_Handler,
+		},
+		{
+			MethodName: "Discover",
+			Handler:    _Clusterm_Discover_Handler,
+		},
+		{
+			MethodName: "GetNode",
+			Handler:    _Clusterm_GetNode_Handler,
+		},
+		{
+			MethodName: "GetNodes",
+			Handler:    _Clusterm_GetNodes_Handler,
+		},
+		{
+			MethodName: "GetJob",
+			Handler:    _Clusterm_GetJob_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "clusterm.proto",
+}
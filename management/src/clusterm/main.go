@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"syscall"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/codegangsta/cli"
@@ -103,6 +104,18 @@ func startDaemon(c *cli.Context) {
 
 	// start manager's processing loop
 	if err := mgr.Run(); err != nil {
+		if serr, ok := err.(*manager.StoppedError); ok {
+			logrus.Infof("%s", serr)
+			os.Exit(exitStatus(serr.Signal))
+		}
 		logrus.Fatalf("encountered an error: %s", err)
 	}
 }
+
+// exitStatus returns the conventional exit status of a process stopped by a signal
+func exitStatus(sig os.Signal) int {
+	if s, ok := sig.(syscall.Signal); ok {
+		return 128 + int(s)
+	}
+	return 1
+}
@@ -0,0 +1,130 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// annotationStore persists the annotations of the nodes
+type annotationStore interface {
+	PutAnnotations(name string, info []byte) error
+	GetAllAnnotations() (map[string][]byte, error)
+	DeleteAnnotations(name string) error
+}
+
+// restoreAnnotations restores the annotations of the nodes from the annotation
+// store. The annotations are attached to the nodes as they are discovered.
+func (m *Manager) restoreAnnotations() error {
+	m.annotations = map[string]map[string]string{}
+	if m.annotationStore == nil {
+		return nil
+	}
+
+	infos, err := m.annotationStore.GetAllAnnotations()
+	if err != nil {
+		return err
+	}
+
+	for name, info := range infos {
+		annotations := map[string]string{}
+		if err := json.Unmarshal(info, &annotations); err != nil {
+			logrus.Errorf("failed to restore annotations of node %q from %s. Error: %v", name, info, err)
+			continue
+		}
+		m.annotations[name] = annotations
+	}
+	return nil
+}
+
+// hasAnnotations checks if the node has all the specified annotations with matching values
+func (n *node) hasAnnotations(annotations map[string]string) bool {
+	for k, v := range annotations {
+		if val, ok := n.Annotations[k]; !ok || val != v {
+			return false
+		}
+	}
+	return true
+}
+
+// setAnnotationsEvent sets or deletes the annotations of a node. The annotations
+// are free-form metadata about a node, that are persisted across restarts of
+// clusterm and are not used by the configuration subsystem
+type setAnnotationsEvent struct {
+	mgr  *Manager
+	name string
+	// set are the annotations to be added or updated
+	set map[string]string
+	// del are the keys of annotations to be deleted. All annotations are deleted
+	// if delAll is true
+	del    []string
+	delAll bool
+}
+
+// newSetAnnotationsEvent creates and returns setAnnotationsEvent
+func newSetAnnotationsEvent(mgr *Manager, name string, set map[string]string, del []string,
+	delAll bool) *setAnnotationsEvent {
+	return &setAnnotationsEvent{
+		mgr:    mgr,
+		name:   name,
+		set:    set,
+		del:    del,
+		delAll: delAll,
+	}
+}
+
+func (e *setAnnotationsEvent) String() string {
+	return fmt.Sprintf("setAnnotationsEvent: node: %s set: %v delete: %v delete-all: %v",
+		e.name, e.set, e.del, e.delAll)
+}
+
+func (e *setAnnotationsEvent) process() error {
+	node, err := e.mgr.findNode(e.name)
+	if err != nil {
+		return errBadRequest(err)
+	}
+
+	annotations := map[string]string{}
+	if !e.delAll {
+		for k, v := range e.mgr.annotations[e.name] {
+			annotations[k] = v
+		}
+		for _, k := range e.del {
+			delete(annotations, k)
+		}
+	}
+	for k, v := range e.set {
+		annotations[k] = v
+	}
+
+	if e.mgr.annotationStore != nil {
+		if len(annotations) == 0 {
+			err = e.mgr.annotationStore.DeleteAnnotations(e.name)
+		} else {
+			var info []byte
+			if info, err = json.Marshal(annotations); err != nil {
+				return err
+			}
+			err = e.mgr.annotationStore.PutAnnotations(e.name, info)
+		}
+		if err != nil {
+			logrus.Errorf("failed to save annotations of node %q. Error: %v", e.name, err)
+			return err
+		}
+	}
+
+	e.mgr.nodesMutex.Lock()
+	defer e.mgr.nodesMutex.Unlock()
+	if len(annotations) == 0 {
+		delete(e.mgr.annotations, e.name)
+		node.Annotations = nil
+		return nil
+	}
+	if e.mgr.annotations == nil {
+		e.mgr.annotations = map[string]map[string]string{}
+	}
+	e.mgr.annotations[e.name] = annotations
+	node.Annotations = annotations
+	return nil
+}
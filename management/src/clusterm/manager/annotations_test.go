@@ -0,0 +1,96 @@
+// +build unittest
+
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+
+	. "gopkg.in/check.v1"
+)
+
+type annotationsSuite struct {
+}
+
+var _ = Suite(&annotationsSuite{})
+
+// fakeAnnotationStore keeps the annotations in memory
+type fakeAnnotationStore struct {
+	infos map[string][]byte
+	err   error
+}
+
+func (s *fakeAnnotationStore) PutAnnotations(name string, info []byte) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.infos[name] = info
+	return nil
+}
+
+func (s *fakeAnnotationStore) GetAllAnnotations() (map[string][]byte, error) {
+	return s.infos, s.err
+}
+
+func (s *fakeAnnotationStore) DeleteAnnotations(name string) error {
+	if s.err != nil {
+		return s.err
+	}
+	delete(s.infos, name)
+	return nil
+}
+
+func (s *annotationsSuite) TestSetDeleteAnnotations(c *C) {
+	store := &fakeAnnotationStore{infos: map[string][]byte{}}
+	m := &Manager{
+		nodes:           map[string]*node{"node1": {}},
+		annotationStore: store,
+	}
+	c.Assert(m.restoreAnnotations(), IsNil)
+
+	e := newSetAnnotationsEvent(m, "node1", map[string]string{"rack": "r1", "owner": "foo"}, nil, false)
+	c.Assert(e.process(), IsNil)
+	exptd := map[string]string{"rack": "r1", "owner": "foo"}
+	c.Assert(m.nodes["node1"].Annotations, DeepEquals, exptd)
+	c.Assert(m.annotations["node1"], DeepEquals, exptd)
+	stored := map[string]string{}
+	c.Assert(json.Unmarshal(store.infos["node1"], &stored), IsNil)
+	c.Assert(stored, DeepEquals, exptd)
+
+	// the annotations are restored on restart
+	m2 := &Manager{annotationStore: store}
+	c.Assert(m2.restoreAnnotations(), IsNil)
+	c.Assert(m2.annotations["node1"], DeepEquals, exptd)
+
+	e = newSetAnnotationsEvent(m, "node1", nil, []string{"owner"}, false)
+	c.Assert(e.process(), IsNil)
+	c.Assert(m.nodes["node1"].Annotations, DeepEquals, map[string]string{"rack": "r1"})
+
+	e = newSetAnnotationsEvent(m, "node1", nil, nil, true)
+	c.Assert(e.process(), IsNil)
+	c.Assert(m.nodes["node1"].Annotations, IsNil)
+	c.Assert(m.annotations, HasLen, 0)
+	c.Assert(store.infos, HasLen, 0)
+}
+
+func (s *annotationsSuite) TestSetAnnotationsErrors(c *C) {
+	m := &Manager{nodes: map[string]*node{"node1": {}}}
+	e := newSetAnnotationsEvent(m, "node2", map[string]string{"rack": "r1"}, nil, false)
+	err := e.process()
+	c.Assert(err, NotNil)
+	c.Assert(httpStatus(err), Equals, 400)
+
+	// the annotations are not updated if they fail to be saved
+	m.annotationStore = &fakeAnnotationStore{err: fmt.Errorf("test error")}
+	e = newSetAnnotationsEvent(m, "node1", map[string]string{"rack": "r1"}, nil, false)
+	c.Assert(e.process(), ErrorMatches, "test error")
+	c.Assert(m.nodes["node1"].Annotations, IsNil)
+}
+
+func (s *annotationsSuite) TestHasAnnotations(c *C) {
+	n := &node{Annotations: map[string]string{"rack": "r1", "owner": "foo"}}
+	c.Assert(n.hasAnnotations(nil), Equals, true)
+	c.Assert(n.hasAnnotations(map[string]string{"rack": "r1"}), Equals, true)
+	c.Assert(n.hasAnnotations(map[string]string{"rack": "r2"}), Equals, false)
+	c.Assert(n.hasAnnotations(map[string]string{"row": "1"}), Equals, false)
+}
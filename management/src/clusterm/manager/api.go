@@ -2,26 +2,40 @@ package manager
 
 import (
 	"bytes"
+	"crypto/sha1"
+	"crypto/subtle"
 	"encoding/json"
+	"fmt"
 	"io"
 	"io/ioutil"
+	"mime"
 	"net"
 	"net/http"
 	"net/http/pprof"
+	"os"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
 	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/contiv/cluster/management/src/configuration"
 	"github.com/contiv/cluster/management/src/monitor"
 	"github.com/contiv/errored"
 	"github.com/gorilla/mux"
+	"golang.org/x/net/context"
 )
 
 // MonitorNode contains the info about a node in monitor event.
 type MonitorNode struct {
-	Label    string `json:"label"`
-	Serial   string `json:"serial"`
-	MgmtAddr string `json:"addr"`
+	Label    string            `json:"label"`
+	Serial   string            `json:"serial"`
+	MgmtAddr string            `json:"addr"`
+	Tags     map[string]string `json:"tags,omitempty"`
 }
 
 // MonitorEvent wraps the info about monitor event type and respective nodes
@@ -32,13 +46,323 @@ type MonitorEvent struct {
 
 // APIRequest is the general request body expected by clusterm from it's client
 type APIRequest struct {
-	Nodes     []string     `json:"nodes,omitempty"`
-	Addrs     []string     `json:"addrs,omitempty"`
-	HostGroup string       `json:"host_group,omitempty"`
-	ExtraVars string       `json:"extra_vars,omitempty"`
-	Job       string       `json:"job,omitempty"`
-	Event     MonitorEvent `json:"monitor_event,omitempty"`
-	Config    *Config      `json:"config,omitempty"`
+	Nodes     []string `json:"nodes,omitempty"`
+	Addrs     []string `json:"addrs,omitempty"`
+	HostGroup string   `json:"host_group,omitempty"`
+	// HostGroups are the host-groups that the nodes of a commission or update
+	// request are added to, for the nodes that belong to several groups. It
+	// may be used along with HostGroup, which is then the first group
+	HostGroups []string          `json:"host_groups,omitempty"`
+	ExtraVars  string            `json:"extra_vars,omitempty"`
+	Job        string            `json:"job,omitempty"`
+	Event      MonitorEvent      `json:"monitor_event,omitempty"`
+	Config     *Config           `json:"config,omitempty"`
+	Tags       map[string]string `json:"tags,omitempty"`
+	Playbook   string            `json:"playbook,omitempty"`
+	Stream     LogStream         `json:"stream,omitempty"`
+	// ConfigVersion is the version of the configuration, as returned in the
+	// ETag of a GET request, that a config request is based on. The request is
+	// rejected if the configuration has changed since. It may also be passed
+	// in the If-Match header
+	ConfigVersion *uint64 `json:"config_version,omitempty"`
+	// Timeout is the duration, like "30m", after which the job triggered by the request
+	// is cancelled. It also bounds the wait for the request to be processed
+	Timeout string `json:"timeout,omitempty"`
+	// Fields limits the node info returned by a GET request to the specified fields
+	Fields []string `json:"fields,omitempty"`
+	// IdempotencyKey identifies the retries of a POST request. It is passed in a header
+	IdempotencyKey string `json:"-"`
+	// Async, when true, makes a POST request return without waiting for the
+	// triggered job to start. It is passed as a query variable
+	Async bool `json:"-"`
+	// Wait, when true, makes a monitor event request wait for the event to be
+	// processed and return it's outcome. It is passed as a query variable
+	Wait bool `json:"-"`
+	// Drain, when set, specifies whether the nodes shall be drained before they
+	// are decommissioned. The nodes are drained by default if a drain playbook is configured
+	Drain *bool `json:"drain,omitempty"`
+	// DrainTimeout is the duration, like "10m", after which draining the nodes fails
+	DrainTimeout string `json:"drain_timeout,omitempty"`
+	// ContinueOnError, when true, makes a decommission request skip the nodes
+	// that can't be decommissioned, and a commission request skip the nodes
+	// that fail the preflight check, instead of failing for all the nodes. The
+	// skipped nodes are reported in a NodesError
+	ContinueOnError bool `json:"continue_on_error,omitempty"`
+	// Remove, when true, makes a decommission request remove the nodes from
+	// the inventory once they are cleaned up. By default, the nodes are kept
+	// as decommissioned
+	Remove bool `json:"remove,omitempty"`
+	// Force, when true, makes a decommission request decommission the last
+	// master node of the cluster, like when tearing the cluster down. Such a
+	// request fails with a LastMasterError by default
+	Force bool `json:"force,omitempty"`
+	// WaitRejoin, when true, makes a reboot job wait for the rebooted nodes
+	// to rejoin the cluster before it completes
+	WaitRejoin bool `json:"wait_rejoin,omitempty"`
+	// Verify, when set, specifies whether the nodes of a commission request shall
+	// be verified once they are configured. The nodes are verified by default
+	// if a verify playbook is configured
+	Verify *bool `json:"verify,omitempty"`
+	// VerifyPlaybook, if set, is the playbook that the nodes of a commission
+	// request are verified with, instead of the configured one. It shall be
+	// one of the known playbooks
+	VerifyPlaybook string `json:"verify_playbook,omitempty"`
+	// WaitReady, when true, makes a commission job wait for the configured
+	// nodes to be part of the cluster before it completes
+	WaitReady bool `json:"wait_ready,omitempty"`
+	// Check, when true, makes a commission or update request run the playbook
+	// in check mode. The changes that the job would make on the nodes are
+	// reported as the job's plan, and the nodes are left as is
+	Check bool `json:"check,omitempty"`
+	// RejoinTimeout is the duration, like "10m", after which the rebooted or
+	// commissioned nodes that have not (re)joined the cluster are considered failed
+	RejoinTimeout string `json:"rejoin_timeout,omitempty"`
+	// ConnectTimeout is the duration, like "10s", for which a discover request
+	// waits to connect to each address. The unreachable addresses are skipped
+	ConnectTimeout string `json:"connect_timeout,omitempty"`
+	// Forks is the number of nodes that the job triggered by the request
+	// configures in parallel. The configured default is used if it is zero
+	Forks int `json:"forks,omitempty"`
+	// SSHUser, if set, is the user that the job triggered by the request
+	// connects to the nodes as, instead of the configured one
+	SSHUser string `json:"ssh_user,omitempty"`
+	// SSHKeyRef, if set, is the name of the private key in the configured
+	// keystore that the job triggered by the request connects to the nodes
+	// with, instead of the configured one
+	SSHKeyRef string `json:"ssh_key_ref,omitempty"`
+	// RunAt is the time, in RFC3339 format, at which the job triggered by a
+	// commission or update request is scheduled to run
+	RunAt string `json:"run_at,omitempty"`
+	// Delay is the duration, like "2h", after which the job triggered by a
+	// commission or update request is scheduled to run
+	Delay string `json:"delay,omitempty"`
+	// State filters the jobs returned by a GET request by their status, like
+	// 'scheduled'. It is passed as a query variable
+	State string `json:"-"`
+	// Grep is the regular expression that the job log lines returned by a GET
+	// request are filtered against. It is passed as a query variable
+	Grep string `json:"-"`
+	// Context is the number of lines, before and after each matching line, that
+	// are returned along with the filtered job log lines. It is passed as a query variable
+	Context int `json:"-"`
+	// Offset is the byte offset in the job logs that a GET request returns the
+	// logs from, including the ones written so far. It is passed as a query variable
+	Offset *int64 `json:"-"`
+	// Raw, when true, makes a GET request of the globals return their stored
+	// value as is, without parsing it. It is passed as a query variable
+	Raw bool `json:"-"`
+	// List, when true, makes a GET request of all nodes return them as a list
+	// ordered by node name, instead of a map keyed by node name. It is passed
+	// as a query variable
+	List bool `json:"-"`
+	// Inventory, if set, is the ansible inventory in INI format that a commission
+	// or update request runs with, instead of the managed inventory. The managed
+	// inventory is left as is. It's accepted only if enabled in the configuration
+	Inventory string `json:"inventory,omitempty"`
+	// Version is the version that the nodes are upgraded to, as part of an upgrade request
+	Version string `json:"version,omitempty"`
+	// Selector, like 'rack=r1,role=worker', selects the nodes that a commission,
+	// decommission or update request acts upon by their tags, labels or annotations.
+	// It is an alternative to specifying the node names and can't be used along with them.
+	// In a GET request of the selected nodes, it is passed as a query variable
+	Selector string `json:"selector,omitempty"`
+	// Serials, like 'FCH1234V5XY', select the nodes that a commission or update
+	// request acts upon by their serial number. It is an alternative to
+	// specifying the node names and can't be used along with them or a selector
+	Serials []string `json:"serials,omitempty"`
+	// IgnoreMissing, when true, makes a request run on the specified nodes that
+	// exist, instead of failing when some of them don't exist
+	IgnoreMissing bool `json:"ignore_missing,omitempty"`
+	// Level is the log level, like "debug", to be set as part of a log level request
+	Level string `json:"level,omitempty"`
+	// Annotations are the node annotations to be set. In a GET request, they
+	// filter the nodes by their annotations
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// AnnotationKeys are the keys of node annotations to be deleted. All
+	// annotations are deleted if none are specified
+	AnnotationKeys []string `json:"annotation_keys,omitempty"`
+	// CommissionPlan is the plan of a bulk commission request
+	CommissionPlan *CommissionPlan `json:"commission_plan,omitempty"`
+	// Bundle is the exported inventory to be imported
+	Bundle *InventoryExport `json:"bundle,omitempty"`
+	// DryRun, when true, makes an import request report the changes without
+	// making them
+	DryRun bool `json:"dry_run,omitempty"`
+	// Maintenance is whether a node is to be put in maintenance or taken out
+	// of it, as part of a node maintenance request
+	Maintenance *bool `json:"maintenance,omitempty"`
+	// Preflight, when true, makes a commission request check that the nodes'
+	// management address is reachable before the job is triggered. The request
+	// fails with a NodesError listing the unreachable nodes
+	Preflight bool `json:"preflight,omitempty"`
+	// Labels are the node labels to be set, as part of a node labels request
+	Labels map[string]string `json:"labels,omitempty"`
+	// MergeLabels, when true, makes a node labels request add or update the
+	// labels instead of replacing all of them
+	MergeLabels bool `json:"merge_labels,omitempty"`
+}
+
+// apiError associates a http status code with the error returned by an api handler
+type apiError struct {
+	status     int
+	code       string // identifies the error to the clients, one of the ErrCode* constants
+	err        error
+	retryAfter int // seconds after which the request can be retried, if non-zero
+}
+
+func (e *apiError) Error() string {
+	return e.err.Error()
+}
+
+// errBadRequest wraps an error that is the result of an invalid request
+func errBadRequest(err error) error {
+	return &apiError{status: http.StatusBadRequest, code: ErrCodeBadRequest, err: err}
+}
+
+// errServiceUnavailable wraps an error that is the result of clusterm being
+// temporarily unable to service a request. The request can be retried after
+// specified seconds.
+func errServiceUnavailable(err error, retryAfter int) error {
+	return &apiError{status: http.StatusServiceUnavailable, code: ErrCodeServiceUnavailable, err: err,
+		retryAfter: retryAfter}
+}
+
+// httpStatus returns the http status code to be used for an error returned by
+// an api handler. It defaults to internal server error.
+func httpStatus(err error) int {
+	switch e := err.(type) {
+	case *apiError:
+		return e.status
+	case *TimeoutError:
+		return http.StatusGatewayTimeout
+	case *LastMasterError:
+		return http.StatusPreconditionFailed
+	case *NodesError:
+		if len(e.Accepted) > 0 {
+			return http.StatusMultiStatus
+		}
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+// writeError writes the http response for an error returned by an api handler
+func writeError(w http.ResponseWriter, err error) {
+	if e, ok := err.(*NodesError); ok {
+		writeNodesError(w, e)
+		return
+	}
+	if e, ok := err.(*apiError); ok {
+		if e.retryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(e.retryAfter))
+		}
+		writeAPIError(w, e)
+		return
+	}
+	http.Error(w, err.Error(), httpStatus(err))
+}
+
+// writeAPIError writes the error as a JSON body with it's code and message,
+// like '{"code":"bad_request","error":"..."}', that the client parses as APIError
+func writeAPIError(w http.ResponseWriter, e *apiError) {
+	out, err := json.Marshal(&APIError{Code: e.code, Message: e.Error()})
+	if err != nil {
+		http.Error(w, e.Error(), e.status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(e.status)
+	if _, err := w.Write(out); err != nil {
+		logrus.Errorf("failed to write response bytes '%s'. Error: %v", out, err)
+	}
+}
+
+// errRequestTooLarge is the error returned when the request body is larger
+// than the specified limit
+func errRequestTooLarge(limit int64) error {
+	return &apiError{
+		status: http.StatusRequestEntityTooLarge,
+		code:   ErrCodeRequestTooLarge,
+		err:    errored.Errorf("request body is larger than the limit of %d bytes", limit),
+	}
+}
+
+// limitRequestBody wraps a handler to fail reading the request body beyond
+// the size returned by limit, so that a large body doesn't exhaust clusterm's
+// memory. The limit is read for each request, so that a change is effective
+// without restarting the server
+func limitRequestBody(limit func() int64, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Body != nil {
+			limit := limit()
+			r.Body = &limitedBody{ReadCloser: http.MaxBytesReader(w, r.Body, limit), limit: limit}
+		}
+		h(w, r)
+	}
+}
+
+// limitedBody is a request body limited in size. Reading it beyond the limit
+// fails with errRequestTooLarge
+type limitedBody struct {
+	io.ReadCloser
+	limit int64
+	read  int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.read += int64(n)
+	if err != nil && err != io.EOF && b.read >= b.limit {
+		// the body is read upto the limit before reading it fails
+		return n, errRequestTooLarge(b.limit)
+	}
+	return n, err
+}
+
+// requireContentType wraps a handler to serve only the requests whose body is
+// of the specified media type. The parameters of the media type, like the
+// charset, are ignored. Rest of the requests are responded with 415
+func requireContentType(mediaType string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		contentType := r.Header.Get("Content-Type")
+		if contentType == "" {
+			http.Error(w, fmt.Sprintf("missing Content-Type header, the request body shall be of type %s",
+				mediaType), http.StatusUnsupportedMediaType)
+			return
+		}
+		if mt, _, err := mime.ParseMediaType(contentType); err != nil || mt != mediaType {
+			http.Error(w, fmt.Sprintf("unsupported Content-Type %q, the request body shall be of type %s",
+				contentType, mediaType), http.StatusUnsupportedMediaType)
+			return
+		}
+		h(w, r)
+	}
+}
+
+// maxRequestBodySize returns the configured limit of the request body size
+func (m *Manager) maxRequestBodySize() int64 {
+	config := m.getConfig()
+	if config == nil || config.Manager.MaxRequestBodySize < 1 {
+		return DefaultConfig().Manager.MaxRequestBodySize
+	}
+	return config.Manager.MaxRequestBodySize
+}
+
+// requireToken wraps a handler to serve only the requests that carry the
+// specified token as a bearer token in the Authorization header
+func requireToken(token string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		reqToken := ""
+		if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+			reqToken = strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+		}
+		if token == "" || subtle.ConstantTimeCompare([]byte(reqToken), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "missing or invalid token", http.StatusUnauthorized)
+			return
+		}
+		h(w, r)
+	}
 }
 
 // errInvalidJSON is the error returned when an invalid json value is specified for
@@ -47,6 +371,12 @@ func errInvalidJSON(name string, err error) error {
 	return errored.Errorf("%q should be a valid json. Error: %s", name, err)
 }
 
+// errNotJSONObject is the error returned when a json value that is not an object
+// is specified for the extra variables or the globals
+func errNotJSONObject(name string) error {
+	return errored.Errorf("%s must be a JSON object", name)
+}
+
 // errJobNotExist is the error returned when a job with specified label doesn't exists
 func errJobNotExist(job string) error {
 	return errored.Errorf("info for %q job doesn't exist", job)
@@ -58,228 +388,1674 @@ func errInvalidJobLabel(job string) error {
 	return errored.Errorf("Invalid or empty job label specified: %q", job)
 }
 
+// errJobNotRetriable is the error returned when a retry is requested for a job
+// that can't be retried
+func errJobNotRetriable(job string) error {
+	return errored.Errorf("%q job can't be retried. Only a completed commission, update or reboot job can be retried", job)
+}
+
+// errJobNoFailedNodes is the error returned when a retry is requested for a job
+// that doesn't have any failed nodes
+func errJobNoFailedNodes(job string) error {
+	return errored.Errorf("%q job doesn't have any failed nodes to retry, it succeeded on all nodes", job)
+}
+
 // errInvalidEventName is the error returned when an invalid or empty event name
 // is specified as part of monitor event request
 func errInvalidEventName(event string) error {
 	return errored.Errorf("Invalid or empty event name specified: %q", event)
 }
 
+// errNoEventNodes is the error returned when no nodes are specified as part
+// of monitor event request
+func errNoEventNodes() error {
+	return errored.Errorf("No nodes specified in the monitor event")
+}
+
+// errInvalidEventNodeField is the error returned when an invalid or empty value
+// is specified for a field of a node, as part of monitor event request
+func errInvalidEventNodeField(field, val string) error {
+	return errored.Errorf("Invalid or empty node %s specified in the monitor event: %q", field, val)
+}
+
+// errInvalidTagFilter is the error returned when an invalid tag filter is
+// specified as part of node info request
+func errInvalidTagFilter(filter string) error {
+	return errored.Errorf("Invalid tag filter specified: %q. Expected format: key=value", filter)
+}
+
+// errNoVersion is the error returned when no version is specified as part
+// of an upgrade request
+func errNoVersion() error {
+	return errored.Errorf("No version specified, the version to upgrade the nodes to is expected")
+}
+
+// errUnknownNodes is the error returned when one or more nodes specified
+// as part of a request don't exist
+func errUnknownNodes(names []string) error {
+	return errored.Errorf("Unknown node(s) specified: %v", names)
+}
+
+// errNoBundle is the error returned when no bundle is specified as part of
+// an inventory import request
+func errNoBundle() error {
+	return errored.Errorf("no inventory bundle specified")
+}
+
+// errInvalidJobState is the error returned when an invalid job state is
+// specified as part of a jobs request
+func errInvalidJobState(state string) error {
+	return errored.Errorf("Invalid job state specified: %q. Expected one of %s, %s, %s, %s, %s or %s",
+		state, Scheduled, Queued, Running, Complete, Errored, Interrupted)
+}
+
+// errNoVaultPassword is the error returned when vault encrypted extra vars
+// are specified but no vault password is configured to decrypt them
+func errNoVaultPassword() error {
+	return errored.Errorf("vault encrypted extra vars are not accepted as no vault password file is configured")
+}
+
+// errNoAnnotations is the error returned when no annotations are specified as
+// part of a node annotations request
+func errNoAnnotations() error {
+	return errored.Errorf("no annotations specified")
+}
+
+// errNoDrainPlaybook is the error returned when the nodes are asked to be
+// drained but no drain playbook is configured
+func errNoDrainPlaybook() error {
+	return errored.Errorf("nodes can't be drained as no drain playbook is configured")
+}
+
+// errNoVerifyPlaybook is the error returned when the nodes are asked to be
+// verified but no verify playbook is configured
+func errNoVerifyPlaybook() error {
+	return errored.Errorf("nodes can't be verified as no verify playbook is configured")
+}
+
+// errNoRebootPlaybook is the error returned when the nodes are asked to be
+// rebooted but no reboot playbook is configured
+func errNoRebootPlaybook() error {
+	return errored.Errorf("nodes can't be rebooted as no reboot playbook is configured")
+}
+
+// errInvalidAsync is the error returned when an invalid async value is
+// specified as part of a request
+func errInvalidAsync(async string) error {
+	return errored.Errorf("invalid async value %q. Expected a boolean like 'true' or 'false'", async)
+}
+
+// errInvalidWait is the error returned when an invalid wait value is
+// specified as part of a request
+func errInvalidWait(wait string) error {
+	return errored.Errorf("invalid wait value %q. Expected a boolean like 'true' or 'false'", wait)
+}
+
+// errInvalidRaw is the error returned when an invalid raw value is
+// specified as part of a globals request
+func errInvalidRaw(raw string) error {
+	return errored.Errorf("invalid raw value %q. Expected a boolean like 'true' or 'false'", raw)
+}
+
+// errInvalidList is the error returned when an invalid list value is
+// specified as part of a nodes info request
+func errInvalidList(list string) error {
+	return errored.Errorf("invalid list value %q. Expected a boolean like 'true' or 'false'", list)
+}
+
+// errTooManyRediscoverAddrs is the error returned when more than one address
+// is specified as part of a node rediscover request
+func errTooManyRediscoverAddrs(addrs []string) error {
+	return errored.Errorf("a node can be rediscovered at only one address, specified: %v", addrs)
+}
+
+// errNoRediscoverAddr is the error returned when the address of a node to be
+// rediscovered is neither known nor specified
+func errNoRediscoverAddr(name string) error {
+	return errored.Errorf("mgmt address of node %q is not known, specify the address to rediscover it at", name)
+}
+
+// errNoNodeNames is the error returned when no node names are specified
+// as part of a batch node info request
+func errNoNodeNames() error {
+	return errored.Errorf("No node names specified. Expected comma separated node names in 'names' query parameter")
+}
+
+// errInvalidSSHUser is the error returned when an invalid ssh user is specified
+// to connect to the nodes as part of a request
+func errInvalidSSHUser(user string) error {
+	return errored.Errorf("Invalid ssh user specified: %q", user)
+}
+
+// errUnknownKeyRef is the error returned when the specified key reference
+// doesn't name a key in the keystore. The keystore itself is not revealed
+func errUnknownKeyRef(keyRef string) error {
+	return errored.Errorf("Unknown ssh key reference specified: %q", keyRef)
+}
+
+// errConnectionNotSupported is the error returned when the ssh connection is
+// specified in a request but the configuration subsystem can't set it per request
+func errConnectionNotSupported() error {
+	return errored.Errorf("the ssh connection can't be specified per request for the configuration subsystem")
+}
+
+// errInvalidPlaybook is the error returned when a playbook that is not one of the
+// known playbooks is specified as part of commission or update request
+func errInvalidPlaybook(playbook string) error {
+	return errored.Errorf("Invalid or unknown playbook specified: %q", playbook)
+}
+
+// errInvalidForks is the error returned when the specified forks are not
+// within the allowed range
+func errInvalidForks(forks int) error {
+	return errored.Errorf("Invalid forks specified: %d. Expected a value between 1 and %d", forks, maxAnsibleForks)
+}
+
+// errInvalidLogStream is the error returned when an invalid log stream is
+// specified as part of job log request
+func errInvalidLogStream(stream LogStream) error {
+	return errored.Errorf("Invalid log stream specified: %q. Expected stdout or stderr", stream)
+}
+
+// errInvalidGrep is the error returned when an invalid regular expression is
+// specified to search the logs
+func errInvalidGrep(grep string, err error) error {
+	return errored.Errorf("Invalid grep expression specified: %q. Error: %v", grep, err)
+}
+
+// errInvalidContext is the error returned when an invalid number of context
+// lines is specified to search the logs
+func errInvalidContext(context string) error {
+	return errored.Errorf("Invalid context specified: %q. Expected a non-negative number of lines", context)
+}
+
+// errInvalidOffset is the error returned when an invalid offset is specified
+// to return the logs from
+func errInvalidOffset(offset string) error {
+	return errored.Errorf("Invalid offset specified: %q. Expected a non-negative number of bytes", offset)
+}
+
+// errOffsetWithStream is the error returned when an offset is specified to
+// return the logs of a single stream from
+func errOffsetWithStream(stream LogStream) error {
+	return errored.Errorf("An offset can't be specified along with the log stream %q. The offset is in the logs of all streams", stream)
+}
+
+// errInvalidTimeout is the error returned when an invalid timeout is
+// specified as part of a request
+func errInvalidTimeout(timeout string) error {
+	return errored.Errorf("Invalid timeout specified: %q. Expected a positive duration like 30m", timeout)
+}
+
+// errInvalidLogLevel is the error returned when an invalid log level is
+// specified as part of log level update request
+func errInvalidLogLevel(level string) error {
+	return errored.Errorf("Invalid log level specified: %q. Expected one of %s, %s, %s, %s, %s or %s",
+		level, logrus.PanicLevel, logrus.FatalLevel, logrus.ErrorLevel, logrus.WarnLevel,
+		logrus.InfoLevel, logrus.DebugLevel)
+}
+
 // errNilConfig is the error returned when a nil configuration value is
 // specified as part of clusterm configuration update request
 func errNilConfig() error {
 	return errored.Errorf("nil value specified for clusterm configuration")
 }
 
-func (m *Manager) apiLoop(servingCh chan struct{}) error {
+// apiRoute describes a REST endpoint served by clusterm
+type apiRoute struct {
+	url  string
+	hdrs []string
+	hdlr http.HandlerFunc
+	// summary and resp describe the endpoint in the OpenAPI spec. resp is a
+	// value of the type that the endpoint responds with, if any
+	summary string
+	resp    interface{}
+}
+
+// apiRoutes returns the REST endpoints served by clusterm, keyed by http method
+func (m *Manager) apiRoutes() map[string][]apiRoute {
 	//set following headers for requests expecting a body
 	jsonContentHdrs := []string{"Content-Type", "application/json"}
 	//set following headers for requests that don't expect a body like get node info.
 	emptyHdrs := []string{}
-	reqs := map[string][]struct {
-		url  string
-		hdrs []string
-		hdlr http.HandlerFunc
-	}{
+	return map[string][]apiRoute{
 		"GET": {
-			{"/" + getNodeInfo, emptyHdrs, get(m.oneNode)},
-			{"/" + GetNodesInfo, emptyHdrs, get(m.allNodes)},
-			{"/" + GetGlobals, emptyHdrs, get(m.globalsGet)},
-			{"/" + getJob, emptyHdrs, get(m.jobGet)},
-			{"/" + getJobLog, emptyHdrs, get(m.logsGet)},
-			{"/" + GetPostConfig, emptyHdrs, get(m.configGet)},
-			{"/" + getDebugPrefix + "/", emptyHdrs, pprof.Index},
-			{"/" + getDebugPrefix + "/cmdline", emptyHdrs, pprof.Cmdline},
-			{"/" + getDebugPrefix + "/profile", emptyHdrs, pprof.Profile},
-			{"/" + getDebugPrefix + "/symbol", emptyHdrs, pprof.Symbol},
-			{"/" + getDebugPrefix + "/trace", emptyHdrs, pprof.Trace},
-			{"/" + getDebug, emptyHdrs, pprof.Index},
+			{"/" + getNodeHistory, emptyHdrs, get(m.nodeHistoryGet),
+				"Get the history of events of a node, oldest first", []NodeEvent{}},
+			{"/" + getNodeExtraVars, emptyHdrs, get(m.nodeExtraVarsGet),
+				"Get the effective extra vars of a node", NodeExtraVars{}},
+			{"/" + getNodeInfo, emptyHdrs, yamlNegotiated(get(m.oneNode)),
+				"Get the info of a node", map[string]interface{}{}},
+			{"/" + GetNodesInfo, emptyHdrs,
+				ndjsonNegotiated(yamlNegotiated(getWithETag(m.allNodes)), streaming(get(m.allNodesNDJSON))),
+				"Get the info of all the known nodes, keyed by node name. The nodes are streamed one per line " +
+					"if newline delimited JSON is accepted", map[string]interface{}{}},
+			{"/" + GetNodesDiscovered, emptyHdrs, yamlNegotiated(get(m.discoveredNodes)),
+				"Get the info of the nodes that are discovered but not commissioned yet, keyed by node name",
+				map[string]interface{}{}},
+			{"/" + GetNodesBatchInfo, emptyHdrs, get(m.batchNodes),
+				"Get the info of a batch of nodes", NodesBatchInfo{}},
+			{"/" + GetNodesDiff, emptyHdrs, get(m.nodesDiff),
+				"Get the differences between the info of two nodes", []NodeDiff{}},
+			{"/" + GetNodesResolve, emptyHdrs, get(m.selectorResolve),
+				"Get the nodes that a node selector selects, without acting upon them", SelectorResolution{}},
+			{"/" + GetNodesEvents, emptyHdrs, streaming(eventStream(get(m.nodeEventsGet))),
+				"Stream the transitions in the state of nodes as server-sent events", ""},
+			{"/" + GetInventoryExport, emptyHdrs, get(m.inventoryExport),
+				"Export the nodes, globals and configuration", InventoryExport{}},
+			{"/" + GetGlobals, emptyHdrs, yamlNegotiated(get(m.globalsGet)),
+				"Get the global extra vars", map[string]interface{}{}},
+			{"/" + getJob, emptyHdrs, yamlNegotiated(get(m.jobGet)),
+				"Get the info of a job", JobInfo{}},
+			{"/" + GetJobs, emptyHdrs, get(m.jobsGet),
+				"Get the info of the active and recent jobs", []JobInfo{}},
+			{"/" + getJobLog, emptyHdrs, streaming(get(m.logsGet)),
+				"Stream the logs of a job", ""},
+			{"/" + GetPostConfig, emptyHdrs, yamlNegotiated(m.withConfigVersion(get(m.configGet))),
+				"Get the configuration of clusterm", Config{}},
+			{"/" + GetMetrics, emptyHdrs, get(m.metricsGet),
+				"Get the runtime metrics of clusterm", Metrics{}},
+			{"/" + GetStatus, emptyHdrs, yamlNegotiated(get(m.statusGet)),
+				"Get a summary of clusterm's state", Status{}},
+			{"/" + GetPutLogLevel, emptyHdrs, get(m.logLevelGet),
+				"Get the log level of clusterm", LogLevel{}},
+			{"/" + GetAudit, emptyHdrs, m.auditGet,
+				"Get the audit log of the mutating API calls", []AuditRecord{}},
+			{"/" + GetReadyz, emptyHdrs, get(m.readyzGet),
+				"Check whether clusterm is ready to act upon the nodes", ""},
+			{"/" + GetOpenAPI, emptyHdrs, get(m.openAPIGet),
+				"Get the OpenAPI spec of the REST API", map[string]interface{}{}},
 		},
 		"POST": {
-			{"/" + PostNodesCommission, jsonContentHdrs, post(m.nodesCommission)},
-			{"/" + PostNodesDecommission, jsonContentHdrs, post(m.nodesDecommission)},
-			{"/" + PostNodesUpdate, jsonContentHdrs, post(m.nodesUpdate)},
-			{"/" + PostNodesDiscover, jsonContentHdrs, post(m.nodesDiscover)},
-			{"/" + PostGlobals, jsonContentHdrs, post(m.globalsSet)},
-			{"/" + PostMonitorEvent, jsonContentHdrs, post(m.monitorEvent)},
-			{"/" + GetPostConfig, jsonContentHdrs, post(m.configSet)},
+			{"/" + PostNodesCommission, jsonContentHdrs, m.whenReady(postJob(m.nodesCommission)),
+				"Commission the nodes", JobRef{}},
+			{"/" + PostNodesCommissionBulk, jsonContentHdrs, m.whenReady(postJob(m.nodesCommissionBulk)),
+				"Commission the groups of nodes in a plan, one group after the other", JobRef{}},
+			{"/" + PostNodesDecommission, jsonContentHdrs, m.whenReady(postJob(m.nodesDecommission)),
+				"Decommission the nodes", JobRef{}},
+			{"/" + PostNodesDecommissionImpact, jsonContentHdrs, postWithResponse(m.nodesDecommissionImpact),
+				"Get the impact of decommissioning the nodes, without decommissioning them", DecommissionImpact{}},
+			{"/" + PostNodesUpdate, jsonContentHdrs, m.whenReady(postJob(m.nodesUpdate)),
+				"Update the configuration of the nodes", JobRef{}},
+			{"/" + PostNodesUpgrade, jsonContentHdrs, m.whenReady(postJob(m.nodesUpgrade)),
+				"Upgrade the nodes to a version", JobRef{}},
+			{"/" + PostNodesDiscover, jsonContentHdrs, m.whenReady(postJob(m.nodesDiscover)),
+				"Discover the nodes by their address", JobRef{}},
+			{"/" + postNodeRediscover, jsonContentHdrs, m.whenReady(postJob(m.nodeRediscover)),
+				"Discover a known node again, at it's known or the specified address", JobRef{}},
+			{"/" + PostNodesReboot, jsonContentHdrs, m.whenReady(postJob(m.nodesReboot)),
+				"Reboot the nodes", JobRef{}},
+			{"/" + PostGlobals, jsonContentHdrs, post(m.globalsSet),
+				"Set the global extra vars", nil},
+			{"/" + PostMonitorEvent, jsonContentHdrs, post(m.monitorEvent),
+				"Post a node monitoring event", nil},
+			{"/" + postJobRetry, jsonContentHdrs, m.whenReady(postJob(m.jobRetry)),
+				"Retry a job on the nodes it failed on", JobRef{}},
+			{"/" + postJobCancel, jsonContentHdrs, post(m.jobCancel),
+				"Cancel a scheduled or running job", nil},
+			{"/" + GetPostConfig, jsonContentHdrs, post(m.configSet),
+				"Set the configuration of clusterm", nil},
+			{"/" + postDeleteNodeAnnotations, jsonContentHdrs, post(m.nodeAnnotationsSet),
+				"Set the annotations of a node", nil},
+			{"/" + postNodeMaintenance, jsonContentHdrs, post(m.nodeMaintenanceSet),
+				"Put a node in maintenance or take it out", nil},
+			{"/" + PostConfigValidate, jsonContentHdrs, m.configValidate,
+				"Validate a configuration without applying it", nil},
+			{"/" + PostGlobalsValidate, jsonContentHdrs, m.globalsValidate,
+				"Validate the globals without applying them", GlobalsValidationReport{}},
+			{"/" + PostConfigDiff, jsonContentHdrs, postWithResponse(m.configDiff),
+				"Get the changes a configuration makes to the current configuration", []ConfigChange{}},
+			{"/" + PostInventoryImport, jsonContentHdrs, postWithResponse(m.inventoryImport),
+				"Import the nodes and globals from an exported inventory", InventoryImportReport{}},
 		},
+		"DELETE": {
+			{"/" + postDeleteNodeAnnotations, jsonContentHdrs, post(m.nodeAnnotationsDelete),
+				"Delete the annotations of a node", nil},
+			{"/" + getJob, emptyHdrs, post(m.jobCancel),
+				"Cancel a scheduled or running job", nil},
+		},
+		"PUT": {
+			{"/" + GetPutLogLevel, jsonContentHdrs, post(m.logLevelSet),
+				"Set the log level of clusterm", nil},
+			{"/" + putNodeLabels, jsonContentHdrs, post(m.nodeLabelsSet),
+				"Set the labels of a node", nil},
+		},
+	}
+}
+
+// apiRouter returns the router of the REST endpoints served by clusterm. The
+// requests that trigger a job are timed out after jobWriteTimeout
+func (m *Manager) apiRouter(jobWriteTimeout time.Duration) *mux.Router {
+	// paths are the methods that each path is served for
+	paths := map[string][]string{}
+	r := mux.NewRouter()
+	for method, items := range m.apiRoutes() {
+		for _, item := range items {
+			hdlr := item.hdlr
+			// the content type is checked by the handler, instead of being
+			// matched by the router, so that the mismatching requests are
+			// responded with a clear error instead of a 404
+			hdrs := []string{}
+			for i := 0; i+1 < len(item.hdrs); i += 2 {
+				if http.CanonicalHeaderKey(item.hdrs[i]) == "Content-Type" {
+					hdlr = requireContentType(item.hdrs[i+1], hdlr)
+					continue
+				}
+				hdrs = append(hdrs, item.hdrs[i], item.hdrs[i+1])
+			}
+			if method != "GET" {
+				// all the calls, except GET, are recorded in the audit log
+				// and their request body is limited in size
+				hdlr = limitRequestBody(m.maxRequestBodySize, m.audited(hdlr))
+			}
+			if _, ok := item.resp.(JobRef); ok {
+				// the requests that trigger a job wait for it to start
+				hdlr = withWriteTimeout(jobWriteTimeout, hdlr)
+			}
+			r.Headers(hdrs...).Path(item.url).Methods(method).HandlerFunc(hdlr)
+			paths[item.url] = append(paths[item.url], method)
+		}
+	}
+
+	// the debug endpoints expose the internals of clusterm, so they are served
+	// only when enabled and to the requests that carry the debug token
+	if m.config.Manager.DebugEndpoints {
+		debugReqs := map[string]http.HandlerFunc{
+			"/" + getDebugPrefix + "/":        pprof.Index,
+			"/" + getDebugPrefix + "/cmdline": pprof.Cmdline,
+			"/" + getDebugPrefix + "/profile": pprof.Profile,
+			"/" + getDebugPrefix + "/symbol":  pprof.Symbol,
+			"/" + getDebugPrefix + "/trace":   pprof.Trace,
+			"/" + getDebug:                    pprof.Index,
+		}
+		for url, hdlr := range debugReqs {
+			r.Path(url).Methods("GET").HandlerFunc(requireToken(m.debugToken, hdlr))
+			paths[url] = append(paths[url], "GET")
+		}
+	}
+
+	r.NotFoundHandler = methodNotAllowedHandler(paths)
+	return r
+}
+
+// methodNotAllowedHandler returns the handler for the requests that match no
+// route. The requests for a known path, with a method it's not served for, are
+// responded with 405 and the methods it's served for in the Allow header. Rest
+// of the requests are responded with 404. The allowed methods are keyed by the
+// path, that may have variables like the path of a route
+func methodNotAllowedHandler(allowed map[string][]string) http.Handler {
+	routes := map[*mux.Route][]string{}
+	router := mux.NewRouter()
+	for path, methods := range allowed {
+		routes[router.Path(path)] = methods
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		methods := map[string]bool{}
+		for route, routeMethods := range routes {
+			if route.Match(r, &mux.RouteMatch{}) {
+				for _, method := range routeMethods {
+					methods[method] = true
+				}
+			}
+		}
+		if len(methods) == 0 || methods[r.Method] {
+			// the request didn't match for another reason, like it's headers
+			http.NotFound(w, r)
+			return
+		}
+		allow := []string{}
+		for method := range methods {
+			allow = append(allow, method)
+		}
+		sort.Strings(allow)
+		w.Header().Set("Allow", strings.Join(allow, ", "))
+		http.Error(w, fmt.Sprintf("method %s is not allowed for %s", r.Method, r.URL.Path),
+			http.StatusMethodNotAllowed)
+	})
+}
+
+func (m *Manager) apiLoop(servingCh chan struct{}) error {
+	readHeaderTimeout, writeTimeout, jobWriteTimeout := m.serverTimeouts()
+	r := m.apiRouter(jobWriteTimeout)
+
+	l, err := listen(m.addr, m.config.Manager.ListenBacklog, !m.config.Manager.DisableReuseAddr)
+	if err != nil {
+		logrus.Errorf("Error setting up listener. Error: %s", err)
+		return err
+	}
+
+	// the write timeout is set per request, instead of for the server, so that
+	// the routes can override it, like the streamed responses do
+	srv := &http.Server{
+		Handler:           withWriteTimeout(writeTimeout, withBasePath(m.basePath, gzipHandler(r)).ServeHTTP),
+		ReadHeaderTimeout: readHeaderTimeout,
+		ConnContext:       withConn,
+	}
+	var stoppedCh <-chan os.Signal
+	if _, ok := unixSocketPath(m.addr); ok {
+		stoppedCh = stopOnSignal(srv)
+	}
+
+	//signal that socket is being served. This doesn't imply that the manager
+	//is ready to act upon the nodes, which is signalled by readyCh instead
+	servingCh <- struct{}{}
+
+	if err := srv.Serve(l); err != nil {
+		if err == http.ErrServerClosed && stoppedCh != nil {
+			// the server may be closed before it serves the listener, in
+			// which case the listener is left open
+			l.Close()
+			return &StoppedError{Signal: <-stoppedCh}
+		}
+		logrus.Errorf("Error listening for http requests. Error: %s", err)
+		return err
+	}
+
+	return nil
+}
+
+// basePathKey is the key of the base path in the context of a request
+type basePathKey struct{}
+
+// withBasePath serves the requests under the base path with the handler, with
+// the base path stripped from their url. The rest of the requests are not
+// found. The base path is kept in the request's context, see requestBasePath
+func withBasePath(basePath string, h http.Handler) http.Handler {
+	if basePath == "" {
+		return h
+	}
+	return http.StripPrefix(basePath, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/") {
+			// like '/clustermfoo' for the base path '/clusterm'
+			http.NotFound(w, r)
+			return
+		}
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), basePathKey{}, basePath)))
+	}))
+}
+
+// requestBasePath returns the base path that the request was served under, if any
+func requestBasePath(r *http.Request) string {
+	basePath, _ := r.Context().Value(basePathKey{}).(string)
+	return basePath
+}
+
+// connKey is the key of the connection in the context of a request
+type connKey struct{}
+
+// withConn keeps the connection, that the requests are received on, in their
+// context so that the handlers can set the write deadline of the responses,
+// see withWriteTimeout. It is the ConnContext of the api server
+func withConn(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, connKey{}, c)
+}
+
+// withWriteTimeout sets the deadline for writing the responses of the handler.
+// There is no deadline if the timeout is zero, so a handler wrapped by it
+// overrides the deadline set by a handler that wraps it. The deadline is set
+// only if the connection is kept in the request's context, see withConn
+func withWriteTimeout(timeout time.Duration, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		deadline := time.Time{}
+		if timeout > 0 {
+			deadline = time.Now().Add(timeout)
+		}
+		if conn, ok := r.Context().Value(connKey{}).(net.Conn); ok {
+			if err := conn.SetWriteDeadline(deadline); err != nil {
+				logrus.Debugf("failed to set the write deadline of the response. Error: %v", err)
+			}
+		}
+		h(w, r)
+	}
+}
+
+// streaming exempts the streamed responses, like the logs of a running job,
+// from the write timeout so that they can stay open
+func streaming(h http.HandlerFunc) http.HandlerFunc {
+	return withWriteTimeout(0, h)
+}
+
+// listen sets up the listener on the specified address. The address is a tcp
+// address unless it is of form 'unix:/path/to/sock', in which case a unix
+// socket is setup after cleaning up a stale socket file, if any.
+// The listening socket's backlog is set to the specified one, unless it is
+// zero. Go sets SO_REUSEADDR on the tcp sockets, it's cleared unless reuseAddr is set.
+func listen(addr string, backlog int, reuseAddr bool) (net.Listener, error) {
+	lc := &net.ListenConfig{}
+	if !reuseAddr {
+		lc.Control = clearReuseAddr
+	}
+	network, address := "tcp", addr
+	if path, ok := unixSocketPath(addr); ok {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return nil, errored.Errorf("failed to remove stale socket file %q. Error: %v", path, err)
+		}
+		network, address = "unix", path
+	}
+	l, err := lc.Listen(context.Background(), network, address)
+	if err != nil {
+		return nil, err
+	}
+	if err := setListenBacklog(l, backlog); err != nil {
+		l.Close()
+		return nil, errored.Errorf("failed to set the listen backlog to %d. Error: %v", backlog, err)
+	}
+	return l, nil
+}
+
+// clearReuseAddr clears SO_REUSEADDR on a tcp socket before it's bound. The
+// unix sockets are left as is
+func clearReuseAddr(network, address string, c syscall.RawConn) error {
+	if !strings.HasPrefix(network, "tcp") {
+		return nil
+	}
+	var serr error
+	if err := c.Control(func(fd uintptr) {
+		serr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 0)
+	}); err != nil {
+		return err
+	}
+	return serr
+}
+
+// setListenBacklog sets the backlog of the listening socket, by listening on
+// it again with the specified backlog. The backlog is left as is if it is zero.
+// This is linux specific: linux updates the backlog of a socket that listen(2)
+// is called on again, while POSIX leaves it unspecified. net.ListenConfig's
+// Control can't be used instead, as it runs before the socket is bound and Go
+// listens with it's own backlog. So the backlog is left as is on other systems
+func setListenBacklog(l net.Listener, backlog int) error {
+	sc, ok := l.(syscall.Conn)
+	if !ok || backlog <= 0 {
+		return nil
+	}
+	if runtime.GOOS != "linux" {
+		logrus.Warnf("the listen backlog is set only on linux, leaving it as is on %s", runtime.GOOS)
+		return nil
+	}
+	rc, err := sc.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var lerr error
+	if err := rc.Control(func(fd uintptr) {
+		lerr = syscall.Listen(int(fd), backlog)
+	}); err != nil {
+		return err
+	}
+	return lerr
+}
+
+type postCallback func(req *APIRequest) error
+
+// parsePostRequest forms the APIRequest from the body, url and query variables
+// and the headers of a POST request. The extra vars are validated as well
+func parsePostRequest(r *http.Request) (*APIRequest, error) {
+	req, err := decodePostRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	req.ExtraVars, err = validateAndSanitizeEmptyExtraVars("extra_vars", req.ExtraVars)
+	if err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// decodePostRequest forms the APIRequest like parsePostRequest, leaving the
+// extra vars as is
+func decodePostRequest(r *http.Request) (*APIRequest, error) {
+	// process data from request body, if any
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	req := &APIRequest{}
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, req); err != nil {
+			return nil, err
+		}
+	}
+
+	// process data from url, if any
+	vars := mux.Vars(r)
+	if vars["tag"] != "" {
+		req.Nodes = append(req.Nodes, vars["tag"])
+	}
+	if vars["addr"] != "" {
+		req.Addrs = append(req.Addrs, vars["addr"])
+	}
+	if vars["job"] != "" {
+		req.Job = strings.TrimSpace(vars["job"])
+	}
+
+	req.IdempotencyKey = strings.TrimSpace(r.Header.Get(idempotencyKeyHeader))
+	if match := strings.TrimSpace(r.Header.Get("If-Match")); match != "" && req.ConfigVersion == nil {
+		version, err := parseConfigVersion(match)
+		if err != nil {
+			return nil, errBadRequest(err)
+		}
+		req.ConfigVersion = &version
+	}
+
+	// process query variables
+	if async := r.URL.Query().Get("async"); async != "" {
+		if req.Async, err = strconv.ParseBool(async); err != nil {
+			return nil, errBadRequest(errInvalidAsync(async))
+		}
+	}
+	if wait := r.URL.Query().Get("wait"); wait != "" {
+		if req.Wait, err = strconv.ParseBool(wait); err != nil {
+			return nil, errBadRequest(errInvalidWait(wait))
+		}
+	}
+	return req, nil
+}
+
+func post(postCb postCallback) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req, err := parsePostRequest(r)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		// call the handler
+		if err := postCb(req); err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+}
+
+type postWithResponseCallback func(req *APIRequest) (io.Reader, error)
+
+// postWithResponse is like post but writes the response returned by the handler
+func postWithResponse(postCb postWithResponseCallback) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req, err := parsePostRequest(r)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		out, err := postCb(req)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		body, err := ioutil.ReadAll(out)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if _, err := w.Write(body); err != nil {
+			logrus.Errorf("failed to write response bytes '%s'. Error: %v", body, err)
+		}
+	}
+}
+
+// JobRef refers to the job triggered by a request
+type JobRef struct {
+	// ID is the job's id, that can be used as the job label to get it's info
+	ID string `json:"id"`
+	// Discover is the outcome of a discover request for each of it's
+	// addresses. It's set once the job is triggered, i.e. not for an async request
+	Discover *DiscoverResult `json:"discover,omitempty"`
+}
+
+type postJobCallback func(req *APIRequest) (*Job, error)
+
+// postJob is like post but for the requests that trigger a job. It responds
+// with the reference to the triggered job in the body and the Location header.
+// For an async request, it responds with '202 Accepted' as the job is yet to
+// be triggered.
+func postJob(postCb postJobCallback) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req, err := parsePostRequest(r)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		// call the handler
+		j, err := postCb(req)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if j == nil {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		setAuditJobID(w, strconv.FormatUint(j.id, 10))
+
+		ref := JobRef{ID: strconv.FormatUint(j.id, 10), Discover: j.discoverResult()}
+		out, err := json.Marshal(ref)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		status := http.StatusOK
+		if req.Async {
+			status = http.StatusAccepted
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Location", requestBasePath(r)+"/"+GetJobPrefix+"/"+ref.ID)
+		w.WriteHeader(status)
+		if _, err := w.Write(out); err != nil {
+			logrus.Errorf("failed to write response bytes '%s'. Error: %v", out, err)
+		}
+	}
+}
+
+func validateAndSanitizeEmptyExtraVars(errorPrefix, extraVars string) (string, error) {
+	if strings.TrimSpace(extraVars) == "" {
+		return configuration.DefaultValidJSON, nil
+	}
+
+	// the vault encrypted extra vars are decrypted only when a playbook is run
+	if configuration.IsVaultEncrypted(extraVars) {
+		return extraVars, nil
+	}
+
+	// extra vars string should be valid json and a json object at the top
+	// level, as ansible expects the extra vars to be a set of key value pairs.
+	var vars interface{}
+	if err := json.Unmarshal([]byte(extraVars), &vars); err != nil {
+		logrus.Errorf("failed to parse json: '%s'. Error: %v", extraVars, err)
+		return "", errInvalidJSON(errorPrefix, err)
+	}
+	if _, ok := vars.(map[string]interface{}); !ok {
+		return "", errNotJSONObject(errorPrefix)
+	}
+	return extraVars, nil
+}
+
+// validateVaultExtraVars checks that the vault encrypted extra vars, if
+// specified, can be decrypted with a configured vault password
+func (m *Manager) validateVaultExtraVars(extraVars string) error {
+	if !configuration.IsVaultEncrypted(extraVars) {
+		return nil
+	}
+	if config := m.getConfig(); config == nil || config.Ansible.VaultPasswordFile == "" {
+		return errBadRequest(errNoVaultPassword())
+	}
+	return nil
+}
+
+// validatePlaybook checks that the playbook, if specified, is one of the known playbooks
+func (m *Manager) validatePlaybook(playbook string) error {
+	if playbook != "" && !m.configuration.IsValidPlaybook(playbook) {
+		return errBadRequest(errInvalidPlaybook(playbook))
+	}
+	return nil
+}
+
+// parseTimeout parses a timeout duration, that is expected to be positive
+func parseTimeout(timeout string) (time.Duration, error) {
+	d, err := time.ParseDuration(timeout)
+	if err != nil || d <= 0 {
+		return 0, errInvalidTimeout(timeout)
+	}
+	return d, nil
+}
+
+// requestRejoinTimeout returns the rejoin timeout specified in the request, or
+// the default one if not specified
+func requestRejoinTimeout(req *APIRequest) (time.Duration, error) {
+	if req.RejoinTimeout == "" {
+		return defaultRejoinTimeout, nil
+	}
+	d, err := parseTimeout(req.RejoinTimeout)
+	if err != nil {
+		return 0, errBadRequest(err)
+	}
+	return d, nil
+}
+
+// requestHostGroups returns the primary host-group specified in the request,
+// followed by the extra groups the nodes are added to
+func requestHostGroups(req *APIRequest) (string, []string) {
+	groups := []string{}
+	for _, g := range joinHostGroups(req.HostGroup, req.HostGroups) {
+		if !inHostGroup(groups, g) {
+			groups = append(groups, g)
+		}
+	}
+	if len(groups) == 0 {
+		return "", nil
+	}
+	return groups[0], groups[1:]
+}
+
+// requestHostGroups returns the host-groups specified in the request like
+// requestHostGroups, with the default host-group as the primary one if the
+// request doesn't specify any
+func (m *Manager) requestHostGroups(req *APIRequest) (string, []string) {
+	config := m.getConfig()
+	hostGroup, extraGroups := requestHostGroups(req)
+	if hostGroup == "" && config != nil {
+		hostGroup = config.Manager.DefaultHostGroup
+	}
+	return hostGroup, extraGroups
+}
+
+// requestConnectTimeout returns the connect timeout specified in the request,
+// or the default one if not specified
+func requestConnectTimeout(req *APIRequest) (time.Duration, error) {
+	if req.ConnectTimeout == "" {
+		return defaultConnectTimeout, nil
+	}
+	d, err := parseTimeout(req.ConnectTimeout)
+	if err != nil {
+		return 0, errBadRequest(err)
+	}
+	return d, nil
+}
+
+// requestForks returns the forks specified in the request, if any
+func requestForks(req *APIRequest) (int, error) {
+	if req.Forks < 0 || req.Forks > maxAnsibleForks {
+		return 0, errBadRequest(errInvalidForks(req.Forks))
+	}
+	return req.Forks, nil
+}
+
+// sshUserRegexp matches the valid ssh user names
+var sshUserRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_.-]*$`)
+
+// requestConnection returns the ssh user and key reference specified in the
+// request, if any. The key reference is validated against the keystore
+func (m *Manager) requestConnection(req *APIRequest) (string, string, error) {
+	if req.SSHUser == "" && req.SSHKeyRef == "" {
+		return "", "", nil
+	}
+	s, ok := m.configuration.(configuration.ConnectionSetter)
+	if !ok {
+		return "", "", errBadRequest(errConnectionNotSupported())
+	}
+	if req.SSHUser != "" && !sshUserRegexp.MatchString(req.SSHUser) {
+		return "", "", errBadRequest(errInvalidSSHUser(req.SSHUser))
+	}
+	if req.SSHKeyRef != "" && !s.IsValidKeyRef(req.SSHKeyRef) {
+		return "", "", errBadRequest(errUnknownKeyRef(req.SSHKeyRef))
+	}
+	return req.SSHUser, req.SSHKeyRef, nil
+}
+
+// requestTimeout returns the timeout specified in the request, if any
+func requestTimeout(req *APIRequest) (time.Duration, error) {
+	if req.Timeout == "" {
+		return 0, nil
+	}
+	d, err := parseTimeout(req.Timeout)
+	if err != nil {
+		return 0, errBadRequest(err)
+	}
+	return d, nil
+}
+
+// validateRequestNodes makes sure that the nodes specified in the request exist.
+// If the request asks to ignore the missing nodes, they are dropped from the
+// request instead, as long as atleast one of the nodes exists
+func (m *Manager) validateRequestNodes(req *APIRequest) error {
+	m.nodesMutex.RLock()
+	defer m.nodesMutex.RUnlock()
+	known := []string{}
+	unknown := []string{}
+	for _, name := range req.Nodes {
+		if _, err := m.findNode(name); err != nil {
+			unknown = append(unknown, name)
+			continue
+		}
+		known = append(known, name)
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+	if !req.IgnoreMissing || len(known) == 0 {
+		return &apiError{status: http.StatusBadRequest, code: ErrCodeUnknownNodes, err: errUnknownNodes(unknown)}
+	}
+	logrus.Warnf("ignoring the unknown node(s) %v specified in the request", unknown)
+	req.Nodes = known
+	return nil
+}
+
+// requestDrain returns the playbook to drain the nodes with and the drain
+// timeout, as specified in the request. The playbook is empty if the nodes
+// shall not be drained
+func (m *Manager) requestDrain(req *APIRequest) (string, time.Duration, error) {
+	if req.Drain != nil && !*req.Drain {
+		return "", 0, nil
+	}
+	playbook := ""
+	if config := m.getConfig(); config != nil {
+		playbook = config.Ansible.DrainPlaybook
+	}
+	if playbook == "" {
+		if req.Drain != nil {
+			return "", 0, errBadRequest(errNoDrainPlaybook())
+		}
+		return "", 0, nil
+	}
+	if req.DrainTimeout == "" {
+		return playbook, 0, nil
+	}
+	timeout, err := parseTimeout(req.DrainTimeout)
+	if err != nil {
+		return "", 0, errBadRequest(err)
+	}
+	return playbook, timeout, nil
+}
+
+// requestVerify returns the playbook to verify the commissioned nodes with, as
+// specified in the request. The playbook is empty if the nodes shall not be verified
+func (m *Manager) requestVerify(req *APIRequest) (string, error) {
+	if req.Verify != nil && !*req.Verify {
+		return "", nil
+	}
+	if req.VerifyPlaybook != "" {
+		if err := m.validatePlaybook(req.VerifyPlaybook); err != nil {
+			return "", err
+		}
+		return req.VerifyPlaybook, nil
+	}
+	playbook := ""
+	if config := m.getConfig(); config != nil {
+		playbook = config.Ansible.VerifyPlaybook
+	}
+	if playbook == "" && req.Verify != nil {
+		return "", errBadRequest(errNoVerifyPlaybook())
+	}
+	return playbook, nil
+}
+
+// enqueueJobEvent enqueues an event that triggers a job and waits for it to be
+// processed. It returns the triggered job.
+// If the request carries the idempotency key of a recent job, the event is not
+// enqueued and the outcome of the original request, that started the job, is
+// returned instead.
+// If the request is async, it doesn't wait for the event to be processed and
+// returns a placeholder job with the id that the triggered job will have.
+func (m *Manager) enqueueJobEvent(req *APIRequest, e jobEvent, timeout time.Duration) (*Job, error) {
+	forks, err := requestForks(req)
+	if err != nil {
+		return nil, err
+	}
+	e.setForks(forks)
+	sshUser, sshKeyRef, err := m.requestConnection(req)
+	if err != nil {
+		return nil, err
+	}
+	e.setConnection(sshUser, sshKeyRef)
+
+	queuedAt := time.Now()
+	e.setQueuedAt(queuedAt)
+	if !req.Async && req.IdempotencyKey == "" {
+		me := newWaitableEventWithTimeout(e, timeout)
+		if err := m.enqueue(me); err != nil {
+			return nil, err
+		}
+		if err := me.waitForCompletion(); err != nil {
+			return nil, err
+		}
+		return e.triggeredJob(), nil
+	}
+
+	// the job's id is reserved along with the idempotency key, if any, so that
+	// the retries of the request find the placeholder job until it's triggered
+	pending, reserved := m.newPendingJob(e.String(), req.IdempotencyKey, func(j *Job) {
+		j.queuedAt = queuedAt
+	})
+	if !reserved {
+		logrus.Infof("request with idempotency key %q was already processed. Job: %s", req.IdempotencyKey, pending)
+		return pending, nil
+	}
+	e.setIdempotencyKey(req.IdempotencyKey)
+	e.setJobID(pending.id)
+	ae := &asyncJobEvent{jobEvent: e, mgr: m, pending: pending}
+	if req.Async {
+		if err := m.enqueue(ae); err != nil {
+			m.removePendingJob(pending)
+			return nil, err
+		}
+		return pending, nil
+	}
+
+	me := newWaitableEventWithTimeout(ae, timeout)
+	if err := m.enqueue(me); err != nil {
+		m.removePendingJob(pending)
+		return nil, err
+	}
+	if err := me.waitForCompletion(); err != nil {
+		return nil, err
+	}
+	return e.triggeredJob(), nil
+}
+
+// validatePlaybookRequest validates the extra vars, the playbook, the inventory
+// override and the check mode of a request that runs a playbook on the nodes
+func (m *Manager) validatePlaybookRequest(req *APIRequest) error {
+	if err := m.validateVaultExtraVars(req.ExtraVars); err != nil {
+		return err
+	}
+	if err := m.validatePlaybook(req.Playbook); err != nil {
+		return err
+	}
+	if err := m.validateInventoryOverride(req.Inventory); err != nil {
+		return err
+	}
+	return m.validateCheck(req.Check)
+}
+
+// resolveRequestNodes resolves the serials and the selector of the request to
+// the nodes and makes sure that the nodes exist
+func (m *Manager) resolveRequestNodes(req *APIRequest) error {
+	if err := m.resolveRequestSerials(req); err != nil {
+		return err
+	}
+	if err := m.resolveRequestSelector(req); err != nil {
+		return err
+	}
+	return m.validateRequestNodes(req)
+}
+
+func (m *Manager) nodesCommission(req *APIRequest) (*Job, error) {
+	if err := m.validatePlaybookRequest(req); err != nil {
+		return nil, err
+	}
+	verifyPlaybook, err := m.requestVerify(req)
+	if err != nil {
+		return nil, err
+	}
+	timeout, err := requestTimeout(req)
+	if err != nil {
+		return nil, err
+	}
+	runAt, err := requestRunAt(req)
+	if err != nil {
+		return nil, err
+	}
+	readyTimeout, err := requestRejoinTimeout(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.resolveRequestNodes(req); err != nil {
+		return nil, err
+	}
+	var preflight, skipped map[string]string
+	if req.Preflight {
+		if preflight, skipped, err = m.preflightRequest(req); err != nil {
+			return nil, err
+		}
+	}
+	hostGroup, extraGroups := m.requestHostGroups(req)
+	e := newCommissionEvent(m, req.Nodes, req.ExtraVars, hostGroup, req.Playbook, timeout)
+	e.extraGroups = extraGroups
+	e.inventory = req.Inventory
+	e.check = req.Check
+	e.waitReady, e.readyTimeout = req.WaitReady, readyTimeout
+	e.verifyPlaybook = verifyPlaybook
+	e.preflight = preflight
+	if !runAt.IsZero() {
+		return m.scheduleJobEvent(req, e, runAt)
+	}
+	j, err := m.enqueueJobEvent(req, e, timeout)
+	if err != nil || req.Async || len(skipped) == 0 {
+		// the skipped nodes of an async request are reported in the job's summary
+		return j, err
+	}
+	nerr := &NodesError{Accepted: append([]string{}, req.Nodes...), Failed: skipped}
+	if j != nil {
+		nerr.JobID = strconv.FormatUint(j.id, 10)
+	}
+	return j, nerr
+}
+
+func (m *Manager) nodesCommissionBulk(req *APIRequest) (*Job, error) {
+	plan := req.CommissionPlan
+	if plan == nil || len(plan.Groups) == 0 {
+		return nil, errBadRequest(errEmptyCommissionPlan())
+	}
+	for i := range plan.Groups {
+		g := &plan.Groups[i]
+		var err error
+		if g.ExtraVars, err = validateAndSanitizeEmptyExtraVars("extra_vars", g.ExtraVars); err != nil {
+			return nil, errBadRequest(err)
+		}
+		if err := m.validateVaultExtraVars(g.ExtraVars); err != nil {
+			return nil, err
+		}
+		if err := m.validateRequestNodes(&APIRequest{Nodes: g.Nodes}); err != nil {
+			return nil, err
+		}
+	}
+	timeout, err := requestTimeout(req)
+	if err != nil {
+		return nil, err
+	}
+	return m.enqueueJobEvent(req, newBulkCommissionEvent(m, plan, timeout), timeout)
+}
+
+func (m *Manager) nodesDecommission(req *APIRequest) (*Job, error) {
+	if err := m.validateVaultExtraVars(req.ExtraVars); err != nil {
+		return nil, err
+	}
+	timeout, err := requestTimeout(req)
+	if err != nil {
+		return nil, err
+	}
+	drainPlaybook, drainTimeout, err := m.requestDrain(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.resolveRequestSelector(req); err != nil {
+		return nil, err
+	}
+	if err := m.validateRequestNodes(req); err != nil {
+		return nil, err
+	}
+	e := newDecommissionEvent(m, req.Nodes, req.ExtraVars, drainPlaybook, drainTimeout, timeout)
+	e.continueOnError = req.ContinueOnError
+	e.remove = req.Remove
+	e.force = req.Force
+	j, err := m.enqueueJobEvent(req, e, timeout)
+	if err != nil || req.Async {
+		// the skipped nodes of an async request are reported in the job's summary
+		return j, err
+	}
+	return j, e.nodesError()
+}
+
+func (m *Manager) nodesUpdate(req *APIRequest) (*Job, error) {
+	if err := m.validatePlaybookRequest(req); err != nil {
+		return nil, err
+	}
+	timeout, err := requestTimeout(req)
+	if err != nil {
+		return nil, err
+	}
+	runAt, err := requestRunAt(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.resolveRequestNodes(req); err != nil {
+		return nil, err
+	}
+	hostGroup, extraGroups := m.requestHostGroups(req)
+	e := newUpdateEvent(m, req.Nodes, req.ExtraVars, hostGroup, req.Playbook, timeout)
+	e.extraGroups = extraGroups
+	e.inventory = req.Inventory
+	e.check = req.Check
+	if !runAt.IsZero() {
+		return m.scheduleJobEvent(req, e, runAt)
+	}
+	return m.enqueueJobEvent(req, e, timeout)
+}
+
+func (m *Manager) nodesUpgrade(req *APIRequest) (*Job, error) {
+	if err := m.validateVaultExtraVars(req.ExtraVars); err != nil {
+		return nil, err
+	}
+	req.Version = strings.TrimSpace(req.Version)
+	if req.Version == "" {
+		return nil, errBadRequest(errNoVersion())
+	}
+	timeout, err := requestTimeout(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.validateRequestNodes(req); err != nil {
+		return nil, err
+	}
+	return m.enqueueJobEvent(req, newUpgradeEvent(m, req.Nodes, req.Version, req.ExtraVars,
+		req.HostGroup, timeout), timeout)
+}
+
+func (m *Manager) nodesReboot(req *APIRequest) (*Job, error) {
+	if err := m.validateVaultExtraVars(req.ExtraVars); err != nil {
+		return nil, err
+	}
+	playbook := ""
+	if config := m.getConfig(); config != nil {
+		playbook = config.Ansible.RebootPlaybook
+	}
+	if playbook == "" {
+		return nil, errBadRequest(errNoRebootPlaybook())
+	}
+	timeout, err := requestTimeout(req)
+	if err != nil {
+		return nil, err
+	}
+	rejoinTimeout, err := requestRejoinTimeout(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.validateRequestNodes(req); err != nil {
+		return nil, err
+	}
+	return m.enqueueJobEvent(req, newRebootEvent(m, req.Nodes, req.ExtraVars, playbook, req.WaitRejoin,
+		rejoinTimeout, timeout), timeout)
+}
+
+func (m *Manager) nodesDiscover(req *APIRequest) (*Job, error) {
+	if err := m.validateVaultExtraVars(req.ExtraVars); err != nil {
+		return nil, err
+	}
+	timeout, err := requestTimeout(req)
+	if err != nil {
+		return nil, err
+	}
+	connectTimeout, err := requestConnectTimeout(req)
+	if err != nil {
+		return nil, err
+	}
+	e := newDiscoverEvent(m, req.Addrs, req.ExtraVars, timeout)
+	e.connectTimeout = connectTimeout
+	return m.enqueueJobEvent(req, e, timeout)
+}
+
+// nodeRediscover triggers the discovery of a known node. The node is discovered
+// at the address in the request, if any, like when it's mgmt address changed.
+// Else it is discovered at it's known address
+func (m *Manager) nodeRediscover(req *APIRequest) (*Job, error) {
+	if len(req.Addrs) > 1 {
+		return nil, errBadRequest(errTooManyRediscoverAddrs(req.Addrs))
+	}
+	m.nodesMutex.RLock()
+	node, err := m.findNode(req.Nodes[0])
+	addr := ""
+	if err == nil && node.Mon != nil {
+		addr = node.Mon.GetMgmtAddress()
+	}
+	m.nodesMutex.RUnlock()
+	if err != nil {
+		return nil, errBadRequest(err)
+	}
+	if len(req.Addrs) == 1 {
+		addr = req.Addrs[0]
+	}
+	if addr == "" {
+		return nil, errBadRequest(errNoRediscoverAddr(req.Nodes[0]))
+	}
+	req.Addrs = []string{addr}
+	return m.nodesDiscover(req)
+}
+
+func (m *Manager) globalsSet(req *APIRequest) error {
+	if report := m.validateGlobals(req.ExtraVars); !report.Valid {
+		return errBadRequest(errInvalidGlobals(report.Problems))
+	}
+	me := newWaitableEvent(newSetGlobalsEvent(m, req.ExtraVars))
+	if err := m.enqueue(me); err != nil {
+		return err
+	}
+	return me.waitForCompletion()
+}
+
+func (m *Manager) nodeAnnotationsSet(req *APIRequest) error {
+	if len(req.Annotations) == 0 {
+		return errBadRequest(errNoAnnotations())
+	}
+	me := newWaitableEvent(newSetAnnotationsEvent(m, req.Nodes[0], req.Annotations, nil, false))
+	if err := m.enqueue(me); err != nil {
+		return err
+	}
+	return me.waitForCompletion()
+}
+
+func (m *Manager) nodeAnnotationsDelete(req *APIRequest) error {
+	me := newWaitableEvent(newSetAnnotationsEvent(m, req.Nodes[0], nil, req.AnnotationKeys,
+		len(req.AnnotationKeys) == 0))
+	if err := m.enqueue(me); err != nil {
+		return err
+	}
+	return me.waitForCompletion()
+}
+
+func (m *Manager) inventoryImport(req *APIRequest) (io.Reader, error) {
+	if req.Bundle == nil {
+		return nil, errBadRequest(errNoBundle())
+	}
+	e := newImportInventoryEvent(m, req.Bundle, req.DryRun)
+	me := newWaitableEvent(e)
+	if err := m.enqueue(me); err != nil {
+		return nil, err
+	}
+	if err := me.waitForCompletion(); err != nil {
+		return nil, err
+	}
+	out, err := json.Marshal(e.report)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(out), nil
+}
+
+// normalizeMonitorNode validates the node specified in a monitor event and
+// returns it with the surrounding whitespace trimmed from it's fields. The
+// management address shall be an IP or a host:port.
+func normalizeMonitorNode(node MonitorNode) (MonitorNode, error) {
+	node.Label = strings.TrimSpace(node.Label)
+	if node.Label == "" {
+		return node, errInvalidEventNodeField("label", node.Label)
+	}
+	node.Serial = strings.TrimSpace(node.Serial)
+	if node.Serial == "" {
+		return node, errInvalidEventNodeField("serial", node.Serial)
+	}
+	node.MgmtAddr = strings.TrimSpace(node.MgmtAddr)
+	if net.ParseIP(node.MgmtAddr) != nil {
+		return node, nil
+	}
+	host, port, err := net.SplitHostPort(node.MgmtAddr)
+	if err != nil || host == "" {
+		return node, errInvalidEventNodeField("addr", node.MgmtAddr)
+	}
+	if p, err := strconv.ParseUint(port, 10, 16); err != nil || p == 0 {
+		return node, errInvalidEventNodeField("addr", node.MgmtAddr)
+	}
+	return node, nil
+}
+
+func (m *Manager) monitorEvent(req *APIRequest) error {
+	var (
+		e     event
+		nodes []monitor.SubsysNode
+	)
+
+	name := strings.ToLower(req.Event.Name)
+	if name != strings.ToLower(monitor.Discovered.String()) &&
+		name != strings.ToLower(monitor.Disappeared.String()) {
+		return errInvalidEventName(req.Event.Name)
+	}
+
+	if len(req.Event.Nodes) == 0 {
+		return errBadRequest(errNoEventNodes())
+	}
+	for _, node := range req.Event.Nodes {
+		node, err := normalizeMonitorNode(node)
+		if err != nil {
+			return errBadRequest(err)
+		}
+		nodes = append(nodes, monitor.NewNodeWithTags(node.Label, node.Serial, node.MgmtAddr, node.Tags))
+	}
+
+	if name == strings.ToLower(monitor.Discovered.String()) {
+		e = newDiscoveredEvent(m, nodes)
+	} else {
+		e = newDisappearedEvent(m, nodes)
+	}
+
+	if !req.Wait {
+		return m.queueMonitorEvent(e)
+	}
+
+	me := newWaitableEvent(e)
+	if err := m.queueMonitorEvent(me); err != nil {
+		return err
+	}
+	return me.waitForCompletion()
+}
+
+// queueMonitorEvent adds a monitor event to the request queue, waiting for the
+// configured duration for room in the queue if it's full. The event is dropped
+// if the queue stays full, so that a backed up clusterm rejects the monitor
+// events instead of holding up the monitor
+func (m *Manager) queueMonitorEvent(e event) error {
+	if err := m.enqueueWithTimeout(e, m.monitorEnqueueTimeout()); err != nil {
+		atomic.AddUint64(&m.droppedMonitorEvents, 1)
+		logrus.Warnf("dropping the monitor event, %s. Error: %v", e, err)
+		return err
+	}
+	return nil
+}
+
+// jobRetry re-runs a job on the nodes that failed in it. The retried job is
+// cancelled after the timeout specified in the request or, if none, the timeout
+// of the original job
+func (m *Manager) jobRetry(req *APIRequest) (*Job, error) {
+	j, err := m.findJob(req.Job)
+	if err != nil {
+		return nil, err
+	}
+	timeout, err := requestTimeout(req)
+	if err != nil {
+		return nil, err
+	}
+	if timeout == 0 {
+		timeout = j.timeout
+	}
+
+	summary := j.Summary()
+	if summary == nil || j.retryEvent == nil {
+		return nil, errBadRequest(errJobNotRetriable(req.Job))
+	}
+	failedNodes := summary.Hosts.FailedHosts()
+	// the nodes that failed the verification are retried as well
+	failedNodes = append(failedNodes, summary.Verification.FailedHosts()...)
+	if len(failedNodes) == 0 {
+		return nil, errBadRequest(errJobNoFailedNodes(req.Job))
+	}
+
+	return m.enqueueJobEvent(req, j.retryEvent(failedNodes, timeout), timeout)
+}
+
+// jobCancel cancels a scheduled job before it runs, or a running job. The
+// playbook run by a running job is terminated, along with the processes it spawned
+func (m *Manager) jobCancel(req *APIRequest) error {
+	j, err := m.findJob(req.Job)
+	if err != nil {
+		return err
+	}
+	if m.cancelScheduledJob(j.id) {
+		return nil
+	}
+	if err := j.Cancel(); err != nil {
+		return errBadRequest(errJobNotCancellable(req.Job))
+	}
+	return nil
+}
+
+func (m *Manager) configSet(req *APIRequest) error {
+	if req.Config == nil {
+		return errNilConfig()
+	}
+	if req.ConfigVersion == nil {
+		return errConfigVersionRequired()
+	}
+
+	e := newSetConfigEvent(m, req.Config)
+	e.version = *req.ConfigVersion
+	me := newWaitableEvent(e)
+	if err := m.enqueue(me); err != nil {
+		return err
+	}
+	return me.waitForCompletion()
+}
+
+// configDiff returns the changes that the clusterm configuration in the request
+// makes to the current configuration, if it is applied
+func (m *Manager) configDiff(req *APIRequest) (io.Reader, error) {
+	if req.Config == nil {
+		return nil, errBadRequest(errNilConfig())
+	}
+	config, err := DefaultConfig().MergeFromConfig(req.Config)
+	if err != nil {
+		return nil, errBadRequest(err)
 	}
-
-	r := mux.NewRouter()
-	for method, items := range reqs {
-		for _, item := range items {
-			r.Headers(item.hdrs...).Path(item.url).Methods(method).HandlerFunc(item.hdlr)
-		}
+	changes, err := diffConfig(m.getConfig(), config)
+	if err != nil {
+		return nil, err
 	}
-
-	l, err := net.Listen("tcp", m.addr)
+	out, err := json.Marshal(changes)
 	if err != nil {
-		logrus.Errorf("Error setting up listener. Error: %s", err)
-		return err
+		return nil, err
 	}
 
-	//signal that socket is being served
-	servingCh <- struct{}{}
+	return bytes.NewReader(out), nil
+}
 
-	if err := http.Serve(l, r); err != nil {
-		logrus.Errorf("Error listening for http requests. Error: %s", err)
-		return err
-	}
+// ConfigValidationError is the error returned, as the response body, for a
+// clusterm configuration that fails the validation
+type ConfigValidationError struct {
+	Message string `json:"error"`
+}
 
-	return nil
+// Error returns the problems found with the configuration
+func (e *ConfigValidationError) Error() string {
+	return e.Message
 }
 
-type postCallback func(req *APIRequest) error
+// configValidate validates the clusterm configuration in the request, the same
+// way as it is validated when updated, without applying it
+func (m *Manager) configValidate(w http.ResponseWriter, r *http.Request) {
+	req, err := parsePostRequest(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
 
-func post(postCb postCallback) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		// process data from request body, if any
-		body, err := ioutil.ReadAll(r.Body)
+	if _, err := validateConfig(m.getConfig(), req.Config); err != nil {
+		out, err := json.Marshal(&ConfigValidationError{Message: err.Error()})
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, err)
 			return
 		}
-
-		req := APIRequest{}
-		if len(body) > 0 {
-			if err := json.Unmarshal(body, &req); err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		if _, err := w.Write(out); err != nil {
+			logrus.Errorf("failed to write response bytes '%s'. Error: %v", out, err)
 		}
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
 
-		// process data from url, if any
-		vars := mux.Vars(r)
-		if vars["tag"] != "" {
-			req.Nodes = append(req.Nodes, vars["tag"])
-		}
-		if vars["addr"] != "" {
-			req.Addrs = append(req.Addrs, vars["addr"])
-		}
+type getCallback func(req *APIRequest) (io.Reader, error)
 
-		// process query variables
-		req.ExtraVars, err = validateAndSanitizeEmptyExtraVars("extra_vars", req.ExtraVars)
-		if err != nil {
-			http.Error(w,
-				err.Error(),
-				http.StatusInternalServerError)
-			return
+// parseGetRequest forms the APIRequest from the url and query variables of a GET request
+func parseGetRequest(r *http.Request) (*APIRequest, error) {
+	vars := mux.Vars(r)
+	tags, err := parseTagFilters(r.URL.Query()["tag"])
+	if err != nil {
+		return nil, err
+	}
+	annotations, err := parseTagFilters(r.URL.Query()["annotation"])
+	if err != nil {
+		return nil, err
+	}
+	fields := parseListValues(r.URL.Query()["fields"])
+	if err := validateNodeFields(fields); err != nil {
+		return nil, errBadRequest(err)
+	}
+	contextLines := 0
+	if val := r.URL.Query().Get("context"); val != "" {
+		if contextLines, err = strconv.Atoi(val); err != nil || contextLines < 0 {
+			return nil, errBadRequest(errInvalidContext(val))
 		}
-
-		// call the handler
-		if err := postCb(&req); err != nil {
-			http.Error(w,
-				err.Error(),
-				http.StatusInternalServerError)
-			return
+	}
+	var offset *int64
+	if val := r.URL.Query().Get("offset"); val != "" {
+		o, err := strconv.ParseInt(val, 10, 64)
+		if err != nil || o < 0 {
+			return nil, errBadRequest(errInvalidOffset(val))
 		}
-		w.WriteHeader(http.StatusOK)
-		return
+		offset = &o
 	}
-}
-
-func validateAndSanitizeEmptyExtraVars(errorPrefix, extraVars string) (string, error) {
-	if strings.TrimSpace(extraVars) == "" {
-		return configuration.DefaultValidJSON, nil
+	raw, err := parseBoolQuery(r, "raw", errInvalidRaw)
+	if err != nil {
+		return nil, err
 	}
-
-	// extra vars string should be valid json.
-	vars := &map[string]interface{}{}
-	if err := json.Unmarshal([]byte(extraVars), vars); err != nil {
-		logrus.Errorf("failed to parse json: '%s'. Error: %v", extraVars, err)
-		return "", errInvalidJSON(errorPrefix, err)
+	list, err := parseBoolQuery(r, "list", errInvalidList)
+	if err != nil {
+		return nil, err
 	}
-	return extraVars, nil
-}
-
-func (m *Manager) nodesCommission(req *APIRequest) error {
-	me := newWaitableEvent(newCommissionEvent(m, req.Nodes, req.ExtraVars, req.HostGroup))
-	m.reqQ <- me
-	return me.waitForCompletion()
+	return &APIRequest{
+		Nodes:       parseGetNodes(r),
+		Job:         strings.TrimSpace(vars["job"]),
+		Tags:        tags,
+		Annotations: annotations,
+		Stream:      LogStream(r.URL.Query().Get("stream")),
+		Grep:        r.URL.Query().Get("grep"),
+		Context:     contextLines,
+		Offset:      offset,
+		Fields:      fields,
+		State:       strings.TrimSpace(r.URL.Query().Get("state")),
+		Raw:         raw,
+		List:        list,
+		Selector:    strings.TrimSpace(r.URL.Query().Get("selector")),
+	}, nil
 }
 
-func (m *Manager) nodesDecommission(req *APIRequest) error {
-	me := newWaitableEvent(newDecommissionEvent(m, req.Nodes, req.ExtraVars))
-	m.reqQ <- me
-	return me.waitForCompletion()
-}
-
-func (m *Manager) nodesUpdate(req *APIRequest) error {
-	me := newWaitableEvent(newUpdateEvent(m, req.Nodes, req.ExtraVars, req.HostGroup))
-	m.reqQ <- me
-	return me.waitForCompletion()
-}
-
-func (m *Manager) nodesDiscover(req *APIRequest) error {
-	me := newWaitableEvent(newDiscoverEvent(m, req.Addrs, req.ExtraVars))
-	m.reqQ <- me
-	return me.waitForCompletion()
-}
-
-func (m *Manager) globalsSet(req *APIRequest) error {
-	me := newWaitableEvent(newSetGlobalsEvent(m, req.ExtraVars))
-	m.reqQ <- me
-	return me.waitForCompletion()
-}
-
-func (m *Manager) monitorEvent(req *APIRequest) error {
-	var (
-		e     event
-		nodes []monitor.SubsysNode
-	)
-
-	for _, node := range req.Event.Nodes {
-		nodes = append(nodes, monitor.NewNode(node.Label, node.Serial, node.MgmtAddr))
+// parseGetNodes returns the nodes specified in the url of a GET request, like
+// the node being looked up, the names of the nodes or the nodes being compared
+func parseGetNodes(r *http.Request) []string {
+	if a, b := r.URL.Query().Get("a"), r.URL.Query().Get("b"); a != "" || b != "" {
+		// the nodes to be compared
+		return []string{strings.TrimSpace(a), strings.TrimSpace(b)}
 	}
-
-	switch strings.ToLower(req.Event.Name) {
-	case strings.ToLower(monitor.Discovered.String()):
-		e = newDiscoveredEvent(m, nodes)
-	case strings.ToLower(monitor.Disappeared.String()):
-		e = newDisappearedEvent(m, nodes)
-	default:
-		return errInvalidEventName(req.Event.Name)
+	if names := parseListValues(r.URL.Query()["names"]); len(names) > 0 {
+		return names
 	}
-
-	// XXX: revisit, do we need to process monitor events as waitable-events?
-	m.reqQ <- e
-	return nil
+	return []string{strings.TrimSpace(mux.Vars(r)["tag"])}
 }
 
-func (m *Manager) configSet(req *APIRequest) error {
-	if req.Config == nil {
-		return errNilConfig()
+// parseBoolQuery parses the boolean query variable of a request. It is false
+// if the variable is not specified
+func parseBoolQuery(r *http.Request, key string, errInvalid func(string) error) (bool, error) {
+	val := r.URL.Query().Get(key)
+	if val == "" {
+		return false, nil
 	}
-
-	me := newWaitableEvent(newSetConfigEvent(m, req.Config))
-	m.reqQ <- me
-	return me.waitForCompletion()
+	b, err := strconv.ParseBool(val)
+	if err != nil {
+		return false, errBadRequest(errInvalid(val))
+	}
+	return b, nil
 }
 
-type getCallback func(req *APIRequest) (io.Reader, error)
-
 func get(getCb getCallback) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		vars := mux.Vars(r)
-		req := &APIRequest{
-			Nodes: []string{strings.TrimSpace(vars["tag"])},
-			Job:   strings.TrimSpace(vars["job"]),
+		req, err := parseGetRequest(r)
+		if err != nil {
+			writeError(w, err)
+			return
 		}
 		out, err := getCb(req)
 		if err != nil {
-			http.Error(w,
-				err.Error(),
-				http.StatusInternalServerError)
+			writeError(w, err)
 			return
 		}
+		if rc, ok := out.(io.Closer); ok {
+			// a streamed response, like the logs of a running job, is closed
+			// once the client goes away so that the writer at the other end
+			// of the stream is not blocked
+			defer closeOnDone(r, rc)()
+		}
 		// can't use a zero value of slice here as the byte Reader returned by
 		// bytes package checks for 0 length slice and returns without error
 		buf := make([]byte, 128)
 		for {
 			n, err := out.Read(buf)
+			if r.Context().Err() != nil {
+				// the client went away, the stream is closed on return
+				logrus.Debugf("client of %q went away, stopping the response", r.URL.Path)
+				return
+			}
 			if n > 0 {
 				if _, err := w.Write(buf[:n]); err != nil {
-					logrus.Errorf("failed to write response bytes '%s'. Error: %v", buf, err)
+					if r.Context().Err() != nil {
+						logrus.Debugf("client of %q went away, stopping the response. Error: %v", r.URL.Path, err)
+						return
+					}
+					logrus.Errorf("failed to write response bytes '%s'. Error: %v", buf[:n], err)
+					return
 				}
 				if f, ok := w.(http.Flusher); ok {
 					f.Flush()
@@ -292,36 +2068,239 @@ func get(getCb getCallback) http.HandlerFunc {
 	}
 }
 
+// closeOnDone closes the reader when the request's client goes away. The
+// returned func closes the reader once the response is done.
+func closeOnDone(r *http.Request, rc io.Closer) func() {
+	doneCh := make(chan struct{})
+	go func() {
+		select {
+		case <-r.Context().Done():
+			rc.Close()
+		case <-doneCh:
+		}
+	}()
+	return func() {
+		close(doneCh)
+		rc.Close()
+	}
+}
+
+// getWithETag is like get but sets an ETag, computed as a hash of the response,
+// and returns a '304 Not Modified' response without the body if the ETag
+// matches the one in request's If-None-Match header.
+// Note: this reads the complete response before writing it, so it shall not
+// be used with streaming responses.
+func getWithETag(getCb getCallback) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req, err := parseGetRequest(r)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		out, err := getCb(req)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		body, err := ioutil.ReadAll(out)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		etag := fmt.Sprintf("\"%x\"", sha1.Sum(body))
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		if _, err := w.Write(body); err != nil {
+			logrus.Errorf("failed to write response bytes '%s'. Error: %v", body, err)
+		}
+	}
+}
+
 func (m *Manager) oneNode(req *APIRequest) (io.Reader, error) {
+	m.nodesMutex.RLock()
+	defer m.nodesMutex.RUnlock()
 	node, err := m.findNode(req.Nodes[0])
 	if err != nil {
 		return nil, err
 	}
 
-	out, err := json.Marshal(node)
+	out, err := json.Marshal(node.selectFields(req.Fields))
 	if err != nil {
 		return nil, err
 	}
 	return bytes.NewReader(out), nil
 }
 
-func (m *Manager) allNodes(noop *APIRequest) (io.Reader, error) {
-	out, err := json.Marshal(m.nodes)
+// parseListValues parses the values, like node names, specified as a list of
+// comma separated values
+func parseListValues(vals []string) []string {
+	names := []string{}
+	for _, val := range vals {
+		for _, name := range strings.Split(val, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// parseTagFilters parses the tag filters of form 'key=value' into a map
+func parseTagFilters(filters []string) (map[string]string, error) {
+	if len(filters) == 0 {
+		return nil, nil
+	}
+	tags := map[string]string{}
+	for _, filter := range filters {
+		kv := strings.SplitN(filter, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			return nil, errBadRequest(errInvalidTagFilter(filter))
+		}
+		tags[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+	return tags, nil
+}
+
+// allNodes returns the info of all known nodes as a map keyed by node name, or
+// as a list ordered by node name if requested. Either form is encoded the same
+// for the same info, as the map keys are encoded in sorted order, so that the
+// ETag of the response is stable
+func (m *Manager) allNodes(req *APIRequest) (io.Reader, error) {
+	m.nodesMutex.RLock()
+	defer m.nodesMutex.RUnlock()
+	if req.List {
+		return m.allNodesList(req)
+	}
+	nodes := map[string]interface{}{}
+	for name, node := range m.nodes {
+		if node.hasTags(req.Tags) && node.hasAnnotations(req.Annotations) {
+			nodes[name] = node.selectFields(req.Fields)
+		}
+	}
+	out, err := json.Marshal(nodes)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(out), nil
+}
+
+// allNodesList returns the info of all known nodes as a list ordered by node
+// name. It is expected to be called with the nodes locked
+func (m *Manager) allNodesList(req *APIRequest) (io.Reader, error) {
+	names := make([]string, 0, len(m.nodes))
+	for name := range m.nodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	nodes := []NodeStreamEntry{}
+	for _, name := range names {
+		node := m.nodes[name]
+		if !node.hasTags(req.Tags) || !node.hasAnnotations(req.Annotations) {
+			continue
+		}
+		info, err := json.Marshal(node.selectFields(req.Fields))
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, NodeStreamEntry{Name: name, Info: info})
+	}
+	out, err := json.Marshal(nodes)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(out), nil
+}
+
+// discoveredNodes returns the info of the nodes that are discovered but are
+// not commissioned yet, keyed by node name
+func (m *Manager) discoveredNodes(req *APIRequest) (io.Reader, error) {
+	m.nodesMutex.RLock()
+	defer m.nodesMutex.RUnlock()
+	nodes := map[string]interface{}{}
+	for name, node := range m.nodes {
+		if node.isUnmanaged() {
+			nodes[name] = node.selectFields(req.Fields)
+		}
+	}
+	out, err := json.Marshal(nodes)
 	if err != nil {
 		return nil, err
 	}
 	return bytes.NewReader(out), nil
 }
 
-func (m *Manager) globalsGet(noop *APIRequest) (io.Reader, error) {
+// NodesBatchInfo is the info returned for a batch of nodes
+type NodesBatchInfo struct {
+	// Nodes is the info of the nodes that were found, keyed by node name
+	Nodes map[string]*node `json:"nodes"`
+	// NotFound lists the names of the nodes that were not found
+	NotFound []string `json:"not_found"`
+}
+
+func (m *Manager) batchNodes(req *APIRequest) (io.Reader, error) {
+	m.nodesMutex.RLock()
+	defer m.nodesMutex.RUnlock()
+	info := NodesBatchInfo{
+		Nodes:    map[string]*node{},
+		NotFound: []string{},
+	}
+	for _, name := range req.Nodes {
+		if name == "" {
+			continue
+		}
+		node, err := m.findNode(name)
+		if err != nil {
+			info.NotFound = append(info.NotFound, name)
+			continue
+		}
+		info.Nodes[name] = node
+	}
+	if len(info.Nodes) == 0 && len(info.NotFound) == 0 {
+		return nil, errBadRequest(errNoNodeNames())
+	}
+
+	out, err := json.Marshal(info)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(out), nil
+}
+
+// globalsGet returns the global extra vars. The stored globals that are not
+// valid JSON, like after a bad manual edit, are returned as is along with the
+// parse error, so that they can be seen and fixed. Their extra vars are null
+func (m *Manager) globalsGet(req *APIRequest) (io.Reader, error) {
 	globals := m.configuration.GetGlobals()
 	globalData := struct {
 		ExtraVars map[string]interface{} `json:"extra_vars"`
+		// VaultEncrypted is true if the globals are vault encrypted, in which
+		// case they are not revealed
+		VaultEncrypted bool `json:"vault_encrypted,omitempty"`
+		// Raw is the stored value of the globals, when requested or when it
+		// can't be parsed
+		Raw string `json:"raw,omitempty"`
+		// ParseError is the reason the stored value of the globals can't be parsed
+		ParseError string `json:"parse_error,omitempty"`
 	}{
 		ExtraVars: make(map[string]interface{}),
 	}
-	if err := json.Unmarshal([]byte(globals), &globalData.ExtraVars); err != nil {
-		return nil, err
+	switch {
+	case configuration.IsVaultEncrypted(globals):
+		globalData.VaultEncrypted = true
+	case req.Raw:
+		globalData.ExtraVars = nil
+		globalData.Raw = globals
+	default:
+		if err := json.Unmarshal([]byte(globals), &globalData.ExtraVars); err != nil {
+			logrus.Warnf("failed to parse the stored globals %q. Error: %v", globals, err)
+			globalData.ExtraVars = nil
+			globalData.Raw = globals
+			globalData.ParseError = err.Error()
+		}
 	}
 	out, err := json.Marshal(globalData)
 	if err != nil {
@@ -330,19 +2309,75 @@ func (m *Manager) globalsGet(noop *APIRequest) (io.Reader, error) {
 	return bytes.NewReader(out), nil
 }
 
-func (m *Manager) jobGet(req *APIRequest) (io.Reader, error) {
+// InventoryExport is the bundle of the info of all known nodes, globals and
+// configuration of clusterm
+type InventoryExport struct {
+	// Version is the version of the export format
+	Version    int       `json:"version"`
+	ExportedAt time.Time `json:"exported_at"`
+	// Nodes is the info of all known nodes, keyed by node name
+	Nodes   json.RawMessage `json:"nodes"`
+	Globals json.RawMessage `json:"globals"`
+	Config  *Config         `json:"config"`
+}
+
+func (m *Manager) inventoryExport(noop *APIRequest) (io.Reader, error) {
+	export := InventoryExport{
+		Version:    inventoryExportVersion,
+		ExportedAt: time.Now().UTC(),
+		Config:     m.getConfig(),
+	}
+	for _, item := range []struct {
+		cb  getCallback
+		out *json.RawMessage
+	}{
+		{m.allNodes, &export.Nodes},
+		{m.globalsGet, &export.Globals},
+	} {
+		r, err := item.cb(&APIRequest{})
+		if err != nil {
+			return nil, err
+		}
+		if *item.out, err = ioutil.ReadAll(r); err != nil {
+			return nil, err
+		}
+	}
+	out, err := json.Marshal(export)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(out), nil
+}
+
+// findJob returns the job associated with the specified label
+func (m *Manager) findJob(label string) (*Job, error) {
 	var j *Job
-	switch req.Job {
+	switch label {
 	case jobLabelActive:
-		j = m.activeJob
+		// when multiple jobs are active, the most recently started one is returned
+		if jobs := m.getActiveJobs(); len(jobs) > 0 {
+			j = jobs[0]
+		}
 	case jobLabelLast:
-		j = m.lastJob
+		j = m.getLastJob()
 	default:
-		return nil, errInvalidJobLabel(req.Job)
+		id, err := strconv.ParseUint(label, 10, 64)
+		if err != nil {
+			return nil, errInvalidJobLabel(label)
+		}
+		j = m.findJobByID(id)
 	}
 
 	if j == nil {
-		return nil, errJobNotExist(req.Job)
+		return nil, errJobNotExist(label)
+	}
+	return j, nil
+}
+
+func (m *Manager) jobGet(req *APIRequest) (io.Reader, error) {
+	j, err := m.findJob(req.Job)
+	if err != nil {
+		return nil, err
 	}
 
 	out, err := json.Marshal(j)
@@ -353,31 +2388,143 @@ func (m *Manager) jobGet(req *APIRequest) (io.Reader, error) {
 	return bytes.NewReader(out), nil
 }
 
+func (m *Manager) jobsGet(req *APIRequest) (io.Reader, error) {
+	var state JobStatus
+	if req.State != "" {
+		var ok bool
+		if state, ok = jobStatusFromString(strings.Title(strings.ToLower(req.State))); !ok {
+			return nil, errBadRequest(errInvalidJobState(req.State))
+		}
+	}
+
+	jobs := []JobInfo{}
+	for _, list := range [][]*Job{m.getScheduledJobs(), m.getActiveJobs(), m.getJobHistory()} {
+		for _, j := range list {
+			info := j.info(false)
+			if req.State != "" && info.Status != state.String() {
+				continue
+			}
+			jobs = append(jobs, info)
+		}
+	}
+
+	out, err := json.Marshal(jobs)
+	if err != nil {
+		return nil, err
+	}
+
+	return bytes.NewReader(out), nil
+}
+
 func (m *Manager) logsGet(req *APIRequest) (io.Reader, error) {
-	var j *Job
-	switch req.Job {
-	case jobLabelActive:
-		j = m.activeJob
-	case jobLabelLast:
-		j = m.lastJob
-	default:
-		return nil, errInvalidJobLabel(req.Job)
+	if !req.Stream.IsValid() {
+		return nil, errBadRequest(errInvalidLogStream(req.Stream))
 	}
 
-	if j == nil {
-		return nil, errJobNotExist(req.Job)
+	var re *regexp.Regexp
+	if req.Grep != "" {
+		var err error
+		if re, err = regexp.Compile(req.Grep); err != nil {
+			return nil, errBadRequest(errInvalidGrep(req.Grep, err))
+		}
+	}
+
+	if req.Offset != nil && req.Stream != LogStreamAll {
+		return nil, errBadRequest(errOffsetWithStream(req.Stream))
 	}
 
-	r, w := io.Pipe()
-	if err := j.PipeLogs(w); err != nil {
+	j, err := m.findJob(req.Job)
+	if err != nil {
 		return nil, err
 	}
 
+	var r io.ReadCloser
+	if req.Offset != nil {
+		// the logs written so far are returned as well, so the job need not be running
+		r = j.LogsFrom(*req.Offset)
+	} else {
+		pr, pw := io.Pipe()
+		if err := j.PipeStreamLogs(req.Stream, pw); err != nil {
+			return nil, err
+		}
+		r = pr
+	}
+
+	if re != nil {
+		return grepLogs(r, re, req.Context), nil
+	}
 	return r, nil
 }
 
+// Metrics contains the runtime metrics of clusterm
+type Metrics struct {
+	// ReqQueueDepth is the number of requests pending processing
+	ReqQueueDepth int `json:"req_queue_depth"`
+	// ReqQueueCapacity is the number of requests that can be pending processing
+	ReqQueueCapacity int `json:"req_queue_capacity"`
+	// ActiveJobs is the number of jobs that are running
+	ActiveJobs int `json:"active_jobs"`
+	// UnreachableNodes is the number of nodes that missed their heartbeats
+	UnreachableNodes int `json:"unreachable_nodes"`
+	// DroppedMonitorEvents is the number of monitor events that were rejected
+	// as the request queue was full
+	DroppedMonitorEvents uint64 `json:"dropped_monitor_events"`
+}
+
+func (m *Manager) metricsGet(noop *APIRequest) (io.Reader, error) {
+	m.nodesMutex.RLock()
+	defer m.nodesMutex.RUnlock()
+	out, err := json.Marshal(Metrics{
+		ReqQueueDepth:        len(m.reqQ),
+		ReqQueueCapacity:     cap(m.reqQ),
+		ActiveJobs:           len(m.getActiveJobs()),
+		UnreachableNodes:     m.unreachableNodesCount(),
+		DroppedMonitorEvents: atomic.LoadUint64(&m.droppedMonitorEvents),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return bytes.NewReader(out), nil
+}
+
+// LogLevel contains the log level of clusterm
+type LogLevel struct {
+	Level string `json:"level"`
+}
+
+func (m *Manager) logLevelGet(noop *APIRequest) (io.Reader, error) {
+	out, err := json.Marshal(LogLevel{Level: logrus.GetLevel().String()})
+	if err != nil {
+		return nil, err
+	}
+
+	return bytes.NewReader(out), nil
+}
+
+func (m *Manager) logLevelSet(req *APIRequest) error {
+	level, err := logrus.ParseLevel(strings.TrimSpace(req.Level))
+	if err != nil {
+		return errBadRequest(errInvalidLogLevel(req.Level))
+	}
+	logrus.SetLevel(level)
+	logrus.Infof("log level set to %q", level)
+	return nil
+}
+
+// withConfigVersion wraps a handler to return the version of the current
+// configuration as the ETag of the response. The version is read before the
+// configuration, so a configuration that changes in between is returned with
+// the older version and a config request based on it is rejected
+func (m *Manager) withConfigVersion(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", formatConfigVersion(m.currentConfigVersion()))
+		h(w, r)
+	}
+}
+
 func (m *Manager) configGet(noop *APIRequest) (io.Reader, error) {
-	out, err := json.Marshal(m.config)
+	out, err := json.Marshal(m.getConfig())
 	if err != nil {
 		return nil, err
 	}
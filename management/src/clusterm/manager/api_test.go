@@ -2,7 +2,34 @@
 
 package manager
 
-import . "gopkg.in/check.v1"
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/contiv/cluster/management/src/ansible"
+	"github.com/contiv/cluster/management/src/configuration"
+	"github.com/contiv/cluster/management/src/inventory"
+	"github.com/contiv/cluster/management/src/mock"
+	"github.com/contiv/cluster/management/src/monitor"
+	"github.com/golang/mock/gomock"
+	"golang.org/x/net/context"
+	. "gopkg.in/check.v1"
+)
 
 type apiSuite struct {
 }
@@ -97,6 +124,14 @@ func (s *apiSuite) TestGetHandlerErrorCase(c *C) {
 			},
 			exptdErr: errJobNotExist("active"),
 		},
+		"logs-invalid-stream": {
+			cb: m.logsGet,
+			arg: &APIRequest{
+				Job:    "active",
+				Stream: LogStream("foo"),
+			},
+			exptdErr: errInvalidLogStream("foo"),
+		},
 	}
 
 	for key, test := range tests {
@@ -105,3 +140,1658 @@ func (s *apiSuite) TestGetHandlerErrorCase(c *C) {
 		c.Assert(err.Error(), Equals, test.exptdErr.Error(), Commentf("key: %s", key))
 	}
 }
+
+func (s *apiSuite) TestAllNodesTagFilter(c *C) {
+	m := Manager{
+		nodes: map[string]*node{
+			"node1": {
+				Mon:  monitor.NewNodeWithTags("node1", "s1", "1.1.1.1", map[string]string{"rack": "r1"}),
+				Tags: map[string]string{"rack": "r1"},
+			},
+			"node2": {
+				Mon:  monitor.NewNodeWithTags("node2", "s2", "1.1.1.2", map[string]string{"rack": "r2"}),
+				Tags: map[string]string{"rack": "r2"},
+			},
+		},
+	}
+
+	tags, err := parseTagFilters([]string{"rack=r1"})
+	c.Assert(err, IsNil)
+	out, err := m.allNodes(&APIRequest{Tags: tags})
+	c.Assert(err, IsNil)
+	body, err := ioutil.ReadAll(out)
+	c.Assert(err, IsNil)
+	nodes := map[string]interface{}{}
+	c.Assert(json.Unmarshal(body, &nodes), IsNil)
+	c.Assert(len(nodes), Equals, 1)
+	_, ok := nodes["node1"]
+	c.Assert(ok, Equals, true)
+}
+
+func (s *apiSuite) TestDiscoveredNodes(c *C) {
+	newNode := func(name string, status inventory.AssetStatus, state inventory.AssetState) *node {
+		return &node{
+			Mon: monitor.NewNode(name, name, ""),
+			Inv: inventory.NewAssetWithState(nil, name, status, state),
+		}
+	}
+	m := &Manager{
+		nodes: map[string]*node{
+			"node1": newNode("node1", inventory.Unallocated, inventory.Discovered),
+			"node2": newNode("node2", inventory.Allocated, inventory.Discovered),
+			"node3": newNode("node3", inventory.Unallocated, inventory.Disappeared),
+		},
+	}
+
+	// only the discovered nodes that are not commissioned are returned
+	out, err := m.discoveredNodes(&APIRequest{})
+	c.Assert(err, IsNil)
+	nodes := map[string]map[string]interface{}{}
+	c.Assert(json.NewDecoder(out).Decode(&nodes), IsNil)
+	c.Assert(len(nodes), Equals, 1)
+	c.Assert(nodes["node1"]["unmanaged"], Equals, true)
+
+	// all nodes are flagged in the info of all nodes
+	out, err = m.allNodes(&APIRequest{Fields: []string{"unmanaged"}})
+	c.Assert(err, IsNil)
+	nodes = map[string]map[string]interface{}{}
+	c.Assert(json.NewDecoder(out).Decode(&nodes), IsNil)
+	c.Assert(nodes, DeepEquals, map[string]map[string]interface{}{
+		"node1": {"unmanaged": true},
+		"node2": {"unmanaged": false},
+		"node3": {"unmanaged": false},
+	})
+}
+
+// TestConcurrentNodesGet hammers the node and config endpoints while the
+// events update the nodes and the config is changed. It's meant to be run
+// with the race detector, that flags any unsynchronized access to them
+func (s *apiSuite) TestConcurrentNodesGet(c *C) {
+	ctrl := gomock.NewController(c)
+	defer ctrl.Finish()
+	mClient := mock.NewMockSubsysClient(ctrl)
+	mClient.EXPECT().CreateAsset(gomock.Any(), gomock.Any()).AnyTimes()
+	mClient.EXPECT().SetAssetStatus(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+	m := &Manager{
+		inventory: inventory.NewGeneralSubsys(mClient),
+		nodes:     map[string]*node{},
+		config:    DefaultConfig(),
+		reqQ:      make(chan event, 10),
+	}
+	router := m.apiRouter(0)
+
+	// the events add new nodes and update the reachability of the known ones
+	const numEvents = 200
+	eventsDone := make(chan struct{})
+	go func() {
+		defer close(eventsDone)
+		for i := 0; i < numEvents; i++ {
+			m.processEvent(<-m.reqQ)
+		}
+	}()
+	go func() {
+		for i := 0; i < numEvents; i++ {
+			var e event = newDiscoveredEvent(m, []monitor.SubsysNode{
+				monitor.NewNode(fmt.Sprintf("node%d", i/2), "s", "1.1.1.1")})
+			if i%2 == 1 {
+				e = &heartbeatResultEvent{mgr: m, results: map[string]error{
+					fmt.Sprintf("node%d-s", i/2): fmt.Errorf("probe failed")}}
+			}
+			m.reqQ <- e
+			if i%50 == 0 {
+				m.setConfig(DefaultConfig())
+			}
+		}
+	}()
+
+	wg := sync.WaitGroup{}
+	for _, url := range []string{GetNodesInfo, GetNodesDiscovered, GetNodeInfoPrefix + "/node0-s",
+		GetPostConfig, GetStatus, GetMetrics} {
+		wg.Add(1)
+		go func(url string) {
+			defer wg.Done()
+			for {
+				select {
+				case <-eventsDone:
+					return
+				default:
+				}
+				r, err := http.NewRequest("GET", "/"+url, nil)
+				c.Check(err, IsNil)
+				router.ServeHTTP(httptest.NewRecorder(), r)
+			}
+		}(url)
+	}
+	wg.Wait()
+
+	out, err := m.allNodes(&APIRequest{})
+	c.Assert(err, IsNil)
+	nodes := map[string]interface{}{}
+	c.Assert(json.NewDecoder(out).Decode(&nodes), IsNil)
+	c.Assert(nodes, HasLen, numEvents/2)
+}
+
+// TestNodesGetDuringInventoryUpdate checks that the nodes can be looked up
+// while an event waits on the inventory to update a node's state
+func (s *apiSuite) TestNodesGetDuringInventoryUpdate(c *C) {
+	ctrl := gomock.NewController(c)
+	defer ctrl.Finish()
+	updating := make(chan struct{})
+	release := make(chan struct{})
+	mClient := mock.NewMockSubsysClient(ctrl)
+	mClient.EXPECT().SetAssetStatus("node1-s", gomock.Any(), gomock.Any(), gomock.Any()).Do(
+		func(name, status, state, description string) {
+			close(updating)
+			<-release
+		}).Return(nil)
+	inv := inventory.NewGeneralSubsys(mClient)
+	c.Assert(inv.RestoreAsset("node1-s", inventory.NewAssetWithState(mClient, "node1-s",
+		inventory.Allocated, inventory.Discovered)), IsNil)
+	mon := monitor.NewNode("node1", "s", "1.1.1.1")
+	m := &Manager{
+		inventory: inv,
+		nodes: map[string]*node{
+			"node1-s": {Mon: mon, Inv: inv.GetAsset("node1-s")},
+		},
+	}
+
+	processed := make(chan error)
+	go func() {
+		processed <- m.processEvent(newDisappearedEvent(m, []monitor.SubsysNode{mon}))
+	}()
+	<-updating
+
+	looked := make(chan error)
+	go func() {
+		_, err := m.allNodes(&APIRequest{})
+		looked <- err
+	}()
+	select {
+	case err := <-looked:
+		c.Assert(err, IsNil)
+	case <-time.After(5 * time.Second):
+		c.Fatalf("timeout looking up the nodes while the inventory is updated")
+	}
+
+	close(release)
+	c.Assert(<-processed, IsNil)
+	status, state := m.nodes["node1-s"].Inv.GetStatus()
+	c.Assert(status, Equals, inventory.Allocated)
+	c.Assert(state, Equals, inventory.Disappeared)
+}
+
+// decodeAPIError decodes the JSON error body of a failed request
+func decodeAPIError(c *C, w *httptest.ResponseRecorder) APIError {
+	c.Assert(w.Header().Get("Content-Type"), Equals, "application/json")
+	e := APIError{}
+	c.Assert(json.NewDecoder(w.Body).Decode(&e), IsNil)
+	return e
+}
+
+func (s *apiSuite) TestNodeFieldSelection(c *C) {
+	m := &Manager{
+		nodes: map[string]*node{
+			"node1": {
+				Mon:  monitor.NewNode("node1", "s1", "1.1.1.1"),
+				Tags: map[string]string{"rack": "r1"},
+			},
+		},
+	}
+
+	out, err := m.oneNode(&APIRequest{Nodes: []string{"node1"}, Fields: []string{"name", "addr"}})
+	c.Assert(err, IsNil)
+	info := map[string]interface{}{}
+	c.Assert(json.NewDecoder(out).Decode(&info), IsNil)
+	c.Assert(info, DeepEquals, map[string]interface{}{"name": "node1", "addr": "1.1.1.1"})
+
+	out, err = m.allNodes(&APIRequest{Fields: []string{"serial"}})
+	c.Assert(err, IsNil)
+	nodes := map[string]map[string]interface{}{}
+	c.Assert(json.NewDecoder(out).Decode(&nodes), IsNil)
+	c.Assert(nodes, DeepEquals, map[string]map[string]interface{}{"node1": {"serial": "s1"}})
+
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("GET", "/"+GetNodesInfo+"?fields=name,foo", nil)
+	c.Assert(err, IsNil)
+	get(m.allNodes)(w, r)
+	c.Assert(w.Code, Equals, http.StatusBadRequest)
+	c.Assert(decodeAPIError(c, w), DeepEquals, APIError{Code: ErrCodeBadRequest,
+		Message: errInvalidNodeField("foo").Error()})
+}
+
+func (s *apiSuite) TestAllNodesOrdered(c *C) {
+	m := &Manager{nodes: map[string]*node{}}
+	for _, name := range []string{"node3", "node1", "node2", "node10"} {
+		m.nodes[name] = &node{
+			Mon:  monitor.NewNode(name, "s-"+name, "1.1.1.1"),
+			Tags: map[string]string{"rack": "r1", "zone": "z1", "role": "worker"},
+		}
+	}
+	m.nodes["node2"].Tags["rack"] = "r2"
+
+	// the map form is encoded the same every time, so it's ETag is stable
+	out, err := m.allNodes(&APIRequest{})
+	c.Assert(err, IsNil)
+	first, err := ioutil.ReadAll(out)
+	c.Assert(err, IsNil)
+	for i := 0; i < 10; i++ {
+		out, err := m.allNodes(&APIRequest{})
+		c.Assert(err, IsNil)
+		body, err := ioutil.ReadAll(out)
+		c.Assert(err, IsNil)
+		c.Assert(string(body), Equals, string(first))
+	}
+
+	out, err = m.allNodes(&APIRequest{List: true, Fields: []string{"serial"}})
+	c.Assert(err, IsNil)
+	body, err := ioutil.ReadAll(out)
+	c.Assert(err, IsNil)
+	c.Assert(string(body), Equals, `[{"name":"node1","info":{"serial":"s-node1"}},`+
+		`{"name":"node10","info":{"serial":"s-node10"}},`+
+		`{"name":"node2","info":{"serial":"s-node2"}},`+
+		`{"name":"node3","info":{"serial":"s-node3"}}]`)
+
+	// the list is filtered like the map
+	out, err = m.allNodes(&APIRequest{List: true, Tags: map[string]string{"rack": "r2"}, Fields: []string{"name"}})
+	c.Assert(err, IsNil)
+	body, err = ioutil.ReadAll(out)
+	c.Assert(err, IsNil)
+	c.Assert(string(body), Equals, `[{"name":"node2","info":{"name":"node2"}}]`)
+
+	out, err = m.allNodes(&APIRequest{List: true, Tags: map[string]string{"rack": "r3"}})
+	c.Assert(err, IsNil)
+	body, err = ioutil.ReadAll(out)
+	c.Assert(err, IsNil)
+	c.Assert(string(body), Equals, `[]`)
+
+	_, err = parseGetRequest(httptest.NewRequest("GET", "/"+GetNodesInfo+"?list=foo", nil))
+	c.Assert(httpStatus(err), Equals, http.StatusBadRequest)
+}
+
+func (s *apiSuite) TestBatchNodes(c *C) {
+	m := Manager{
+		nodes: map[string]*node{
+			"node1": {Mon: monitor.NewNode("node1", "s1", "1.1.1.1")},
+			"node2": {Mon: monitor.NewNode("node2", "s2", "1.1.1.2")},
+		},
+	}
+
+	out, err := m.batchNodes(&APIRequest{Nodes: parseListValues([]string{"node1, node3", "node2"})})
+	c.Assert(err, IsNil)
+	body, err := ioutil.ReadAll(out)
+	c.Assert(err, IsNil)
+	info := struct {
+		Nodes    map[string]interface{} `json:"nodes"`
+		NotFound []string               `json:"not_found"`
+	}{}
+	c.Assert(json.Unmarshal(body, &info), IsNil)
+	c.Assert(len(info.Nodes), Equals, 2)
+	for _, name := range []string{"node1", "node2"} {
+		_, ok := info.Nodes[name]
+		c.Assert(ok, Equals, true)
+	}
+	c.Assert(info.NotFound, DeepEquals, []string{"node3"})
+
+	_, err = m.batchNodes(&APIRequest{Nodes: []string{""}})
+	c.Assert(err, NotNil)
+	c.Assert(httpStatus(err), Equals, 400)
+}
+
+func (s *apiSuite) TestParseTagFiltersError(c *C) {
+	for _, filter := range []string{"rack", "=r1"} {
+		_, err := parseTagFilters([]string{filter})
+		c.Assert(err, NotNil)
+		c.Assert(err.Error(), Equals, errInvalidTagFilter(filter).Error())
+		c.Assert(httpStatus(err), Equals, 400)
+	}
+}
+
+func (s *apiSuite) TestPostInvalidPlaybook(c *C) {
+	m := Manager{
+		configuration: configuration.NewAnsibleSubsys(&configuration.AnsibleSubsysConfig{
+			ConfigurePlaybook: "site.yml",
+		}),
+	}
+	for _, cb := range []postJobCallback{m.nodesCommission, m.nodesUpdate} {
+		_, err := cb(&APIRequest{Nodes: []string{"node1"}, Playbook: "foo.yml"})
+		c.Assert(err, NotNil)
+		c.Assert(err.Error(), Equals, errInvalidPlaybook("foo.yml").Error())
+		c.Assert(httpStatus(err), Equals, 400)
+	}
+}
+
+func (s *apiSuite) TestJobRetryErrorCase(c *C) {
+	passedJob := NewJob("", nil, nil)
+	passedJob.summary = &JobSummary{
+		Hosts:  ansible.Recap{"node1": {Ok: 1}},
+		Passed: true,
+	}
+	passedJob.retryEvent = func(nodeNames []string, timeout time.Duration) jobEvent { return nil }
+	tests := map[string]struct {
+		lastJob  *Job
+		exptdErr error
+	}{
+		"not-complete": {
+			lastJob:  NewJob("", nil, nil),
+			exptdErr: errJobNotRetriable(jobLabelLast),
+		},
+		"no-failed-nodes": {
+			lastJob:  passedJob,
+			exptdErr: errJobNoFailedNodes(jobLabelLast),
+		},
+	}
+
+	for key, test := range tests {
+		m := Manager{lastJob: test.lastJob}
+		_, err := m.jobRetry(&APIRequest{Job: jobLabelLast})
+		c.Assert(err, NotNil, Commentf("key: %s", key))
+		c.Assert(err.Error(), Equals, test.exptdErr.Error(), Commentf("key: %s", key))
+		c.Assert(httpStatus(err), Equals, 400, Commentf("key: %s", key))
+	}
+}
+
+func (s *apiSuite) TestJobRetryTimeout(c *C) {
+	tests := map[string]struct {
+		reqTimeout   string
+		exptdTimeout time.Duration
+	}{
+		"job-timeout":     {reqTimeout: "", exptdTimeout: 30 * time.Minute},
+		"request-timeout": {reqTimeout: "1h", exptdTimeout: time.Hour},
+	}
+
+	for key, test := range tests {
+		var retryTimeout time.Duration
+		failedJob := NewJob("", nil, nil)
+		failedJob.timeout = 30 * time.Minute
+		failedJob.summary = &JobSummary{Hosts: ansible.Recap{"node1": {Failed: 1}}}
+		m := &Manager{lastJob: failedJob, reqQ: make(chan event, 1)}
+		failedJob.retryEvent = func(nodeNames []string, timeout time.Duration) jobEvent {
+			retryTimeout = timeout
+			return newCommissionEvent(m, nodeNames, "", "", "", timeout)
+		}
+		_, err := m.jobRetry(&APIRequest{Job: jobLabelLast, Timeout: test.reqTimeout, Async: true})
+		c.Assert(err, IsNil, Commentf("key: %s", key))
+		c.Assert(retryTimeout, Equals, test.exptdTimeout, Commentf("key: %s", key))
+	}
+}
+
+// fakeAnsiblePlaybook puts an ansible-playbook command in the PATH, that spawns
+// a long running process and waits for it, like ansible waits for the ssh
+// connections. The pids of the command and the process are written to the
+// returned file once they are running. The returned func restores the PATH
+func fakeAnsiblePlaybook(c *C) (string, func()) {
+	dir := c.MkDir()
+	pidFile := filepath.Join(dir, "pids")
+	script := fmt.Sprintf("#!/bin/sh\nsleep 60 & echo $$ $! > %s.tmp; mv %s.tmp %s; wait\n",
+		pidFile, pidFile, pidFile)
+	c.Assert(ioutil.WriteFile(filepath.Join(dir, "ansible-playbook"), []byte(script), 0755), IsNil)
+	path := os.Getenv("PATH")
+	c.Assert(os.Setenv("PATH", dir+":"+path), IsNil)
+	return pidFile, func() { os.Setenv("PATH", path) }
+}
+
+// processRunning checks if the process is running, allowing a moment for a
+// signalled process to exit. The zombie processes are not considered running
+func processRunning(pid int) bool {
+	for i := 0; i < 50; i++ {
+		b, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+		if err != nil {
+			return false
+		}
+		// the state follows the command name, that is in parenthesis
+		fields := strings.Fields(string(b[bytes.LastIndexByte(b, ')')+1:]))
+		if len(fields) > 0 && fields[0] == "Z" {
+			return false
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	return true
+}
+
+func (s *apiSuite) TestCancelActiveJob(c *C) {
+	pidFile, restorePath := fakeAnsiblePlaybook(c)
+	defer restorePath()
+	subsys := configuration.NewAnsibleSubsys(&configuration.AnsibleSubsysConfig{
+		ConfigurePlaybook: "site.yml",
+		PlaybookLocation:  c.MkDir(),
+		ExtraVariables:    configuration.DefaultValidJSON,
+	})
+	m := &Manager{config: DefaultConfig()}
+	doneCh := make(chan error, 1)
+	j, err := m.checkAndSetActiveJob("commission", []string{"node1"}, 0,
+		func(cancelCh CancelChannel, logs io.Writer) error {
+			hosts := []*configuration.AnsibleHost{
+				configuration.NewAnsibleHost("node1", "1.2.3.4", ansibleMasterGroupName, nil),
+			}
+			outReader, cancelFunc, errCh := subsys.Configure(hosts, configuration.DefaultValidJSON)
+			return logOutputAndReturnStatus(outReader, errCh, cancelCh, cancelFunc, logs)
+		}, func(status JobStatus, err error) { doneCh <- err })
+	c.Assert(err, IsNil)
+	go j.Run()
+
+	pids := []int{}
+	for i := 0; i < 100 && len(pids) == 0; i++ {
+		if b, err := ioutil.ReadFile(pidFile); err == nil {
+			for _, f := range strings.Fields(string(b)) {
+				pid, err := strconv.Atoi(f)
+				c.Assert(err, IsNil)
+				pids = append(pids, pid)
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	c.Assert(pids, HasLen, 2)
+
+	r, err := http.NewRequest("DELETE", "/"+GetJobPrefix+"/"+jobLabelActive, strings.NewReader(""))
+	c.Assert(err, IsNil)
+	w := httptest.NewRecorder()
+	m.apiRouter(0).ServeHTTP(w, r)
+	c.Assert(w.Code, Equals, http.StatusOK, Commentf("body: %s", w.Body.String()))
+
+	select {
+	case err := <-doneCh:
+		c.Assert(err, Equals, errJobCancelled)
+	case <-time.After(5 * time.Second):
+		c.Fatalf("the job didn't finish on cancellation")
+	}
+	for _, pid := range pids {
+		c.Assert(processRunning(pid), Equals, false, Commentf("pid: %d", pid))
+	}
+
+	// a job that is done can't be cancelled
+	c.Assert(m.jobCancel(&APIRequest{Job: strconv.FormatUint(j.id, 10)}), NotNil)
+}
+
+func (s *apiSuite) TestPostIdempotencyKey(c *C) {
+	j := NewJob("job1", nil, nil)
+	j.idempotencyKey = "key1"
+	// the request queue is left nil, so an enqueue would fail
+	m := &Manager{jobHistory: []*Job{j}, nodes: map[string]*node{"node1": {}}}
+
+	// a retried request returns the original outcome without being enqueued
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("POST", "/"+PostNodesDecommission, strings.NewReader(`{"nodes":["node1"]}`))
+	c.Assert(err, IsNil)
+	r.Header.Set(idempotencyKeyHeader, "key1")
+	postJob(m.nodesDecommission)(w, r)
+	c.Assert(w.Code, Equals, http.StatusOK)
+
+	// a request with a different or an expired key is enqueued
+	for _, key := range []string{"key2", "key1"} {
+		_, err := m.nodesDecommission(&APIRequest{Nodes: []string{"node1"}, IdempotencyKey: key})
+		c.Assert(err, NotNil)
+		c.Assert(httpStatus(err), Equals, http.StatusServiceUnavailable)
+		j.createdAt = time.Now().Add(-idempotencyKeyTTL)
+	}
+}
+
+func (s *apiSuite) TestIdempotencyKeyReserved(c *C) {
+	m := &Manager{reqQ: make(chan event, 2), nodes: map[string]*node{"node1": {}}}
+
+	// a retry of an async request, that is not processed yet, gets the same job
+	j1, err := m.nodesDecommission(&APIRequest{Nodes: []string{"node1"}, IdempotencyKey: "key1", Async: true})
+	c.Assert(err, IsNil)
+	j2, err := m.nodesDecommission(&APIRequest{Nodes: []string{"node1"}, IdempotencyKey: "key1", Async: true})
+	c.Assert(err, IsNil)
+	c.Assert(j2, Equals, j1)
+	c.Assert(m.reqQ, HasLen, 1)
+
+	// so does a retry of a request that is waiting to be processed
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := m.nodesDecommission(&APIRequest{Nodes: []string{"node1"}, IdempotencyKey: "key2"})
+		errCh <- err
+	}()
+	for len(m.reqQ) < 2 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	j3, err := m.nodesDecommission(&APIRequest{Nodes: []string{"node1"}, IdempotencyKey: "key2"})
+	c.Assert(err, IsNil)
+	c.Assert(j3, Not(Equals), j1)
+	c.Assert(m.reqQ, HasLen, 2)
+
+	<-m.reqQ
+	(<-m.reqQ).(wrapperEvent).abort(fmt.Errorf("aborted"))
+	c.Assert(<-errCh, ErrorMatches, "aborted")
+	status, err := j3.Status()
+	c.Assert(status, Equals, Errored)
+	c.Assert(err, ErrorMatches, "aborted")
+}
+
+func (s *apiSuite) TestJobTriggerSetActiveJob(c *C) {
+	m := &Manager{config: DefaultConfig()}
+	e := newDecommissionEvent(m, []string{"node1"}, "", "", 0, 0)
+	e.setIdempotencyKey("key1")
+	e.setJobID(100)
+	j, err := e.checkAndSetActiveJob(m, "job1", []string{"node1"}, 0, nil, nil)
+	c.Assert(err, IsNil)
+	c.Assert(e.triggeredJob(), Equals, j)
+	c.Assert(m.findJobByIdempotencyKey("key1"), Equals, j)
+	c.Assert(m.findJobByID(100), Equals, j)
+	c.Assert(m.getActiveJobs(), DeepEquals, []*Job{j})
+	// the reserved id is used instead of the next one
+	c.Assert(m.jobSeq, Equals, uint64(0))
+}
+
+func (s *apiSuite) TestPostJobRef(c *C) {
+	j := NewJob("", nil, nil)
+	j.id = 5
+	cb := func(req *APIRequest) (*Job, error) { return j, nil }
+
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("POST", "/"+PostNodesCommission, strings.NewReader(`{"nodes":["node1"]}`))
+	c.Assert(err, IsNil)
+	postJob(cb)(w, r)
+	c.Assert(w.Code, Equals, http.StatusOK)
+	c.Assert(w.Header().Get("Location"), Equals, "/"+GetJobPrefix+"/5")
+	ref := JobRef{}
+	c.Assert(json.Unmarshal(w.Body.Bytes(), &ref), IsNil)
+	c.Assert(ref.ID, Equals, "5")
+
+	// a request that doesn't trigger a job has no reference in the response
+	w = httptest.NewRecorder()
+	r, err = http.NewRequest("POST", "/"+PostNodesCommission, strings.NewReader(`{"nodes":["node1"]}`))
+	c.Assert(err, IsNil)
+	postJob(func(req *APIRequest) (*Job, error) { return nil, nil })(w, r)
+	c.Assert(w.Code, Equals, http.StatusOK)
+	c.Assert(w.Header().Get("Location"), Equals, "")
+	c.Assert(w.Body.Len(), Equals, 0)
+}
+
+func (s *apiSuite) TestPostAsync(c *C) {
+	m := &Manager{config: DefaultConfig(), reqQ: make(chan event, 1), nodes: map[string]*node{"node1": {}}}
+
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("POST", "/"+PostNodesDecommission+"?async=true", strings.NewReader(`{"nodes":["node1"]}`))
+	c.Assert(err, IsNil)
+	postJob(m.nodesDecommission)(w, r)
+	c.Assert(w.Code, Equals, http.StatusAccepted)
+	c.Assert(w.Header().Get("Location"), Equals, "/"+GetJobPrefix+"/1")
+	ref := JobRef{}
+	c.Assert(json.Unmarshal(w.Body.Bytes(), &ref), IsNil)
+	c.Assert(ref.ID, Equals, "1")
+
+	j, err := m.findJob(ref.ID)
+	c.Assert(err, IsNil)
+	status, _ := j.Status()
+	c.Assert(status, Equals, Queued)
+
+	// the failure to process the request is recorded in the job's status. The
+	// node is removed before the request is processed
+	delete(m.nodes, "node1")
+	c.Assert((<-m.reqQ).process(), NotNil)
+	j, err = m.findJob(ref.ID)
+	c.Assert(err, IsNil)
+	status, errVal := j.Status()
+	c.Assert(status, Equals, Errored)
+	c.Assert(errVal.Error(), Equals, nodeNotExistsError("node1").Error())
+
+	w = httptest.NewRecorder()
+	r, err = http.NewRequest("POST", "/"+PostNodesDecommission+"?async=foo", strings.NewReader(`{"nodes":["node1"]}`))
+	c.Assert(err, IsNil)
+	postJob(m.nodesDecommission)(w, r)
+	c.Assert(w.Code, Equals, http.StatusBadRequest)
+}
+
+func (s *apiSuite) TestRequestBodyLimit(c *C) {
+	store := &fakeAuditStore{}
+	m := &Manager{config: DefaultConfig(), auditStore: store}
+	m.config.Manager.MaxRequestBodySize = 32
+	called := false
+	h := limitRequestBody(m.maxRequestBodySize, m.audited(post(func(req *APIRequest) error {
+		called = true
+		return nil
+	})))
+
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("POST", "/"+PostGlobals, strings.NewReader(`{"extra_vars":"{\"foo\":\"a long value\"}"}`))
+	c.Assert(err, IsNil)
+	h(w, r)
+	c.Assert(w.Code, Equals, http.StatusRequestEntityTooLarge)
+	c.Assert(called, Equals, false)
+	// the rejected request is audited as well
+	records, err := m.getAuditRecords(time.Time{}, time.Time{})
+	c.Assert(err, IsNil)
+	c.Assert(records, HasLen, 1)
+	c.Assert(records[0].Status, Equals, http.StatusRequestEntityTooLarge)
+
+	w = httptest.NewRecorder()
+	r, err = http.NewRequest("POST", "/"+PostGlobals, strings.NewReader(`{"extra_vars":"{}"}`))
+	c.Assert(err, IsNil)
+	h(w, r)
+	c.Assert(w.Code, Equals, http.StatusOK)
+	c.Assert(called, Equals, true)
+
+	// a change in the configured limit applies to the subsequent requests
+	m.config.Manager.MaxRequestBodySize = 16
+	called = false
+	w = httptest.NewRecorder()
+	r, err = http.NewRequest("POST", "/"+PostGlobals, strings.NewReader(`{"extra_vars":"{}"}`))
+	c.Assert(err, IsNil)
+	h(w, r)
+	c.Assert(w.Code, Equals, http.StatusRequestEntityTooLarge)
+	c.Assert(called, Equals, false)
+
+	// the default limit applies if none is configured
+	c.Assert((&Manager{}).maxRequestBodySize(), Equals, DefaultConfig().Manager.MaxRequestBodySize)
+}
+
+func (s *apiSuite) TestValidateExtraVars(c *C) {
+	for _, extraVars := range []string{"", "  ", `{}`, `{"foo":"bar"}`} {
+		_, err := validateAndSanitizeEmptyExtraVars("extra_vars", extraVars)
+		c.Assert(err, IsNil, Commentf("extra vars: %q", extraVars))
+	}
+
+	for _, extraVars := range []string{`[{"foo":"bar"}]`, `"42"`, `42`, `true`, `null`} {
+		_, err := validateAndSanitizeEmptyExtraVars("extra_vars", extraVars)
+		c.Assert(err, NotNil, Commentf("extra vars: %q", extraVars))
+		c.Assert(err.Error(), Equals, errNotJSONObject("extra_vars").Error())
+	}
+
+	_, err := validateAndSanitizeEmptyExtraVars("extra_vars", `{"foo":`)
+	c.Assert(err, NotNil)
+	c.Assert(strings.Contains(err.Error(), "should be a valid json"), Equals, true)
+}
+
+func (s *apiSuite) TestVaultExtraVars(c *C) {
+	vaultVars := "$ANSIBLE_VAULT;1.1;AES256\n6231336539666234"
+	out, err := validateAndSanitizeEmptyExtraVars("extra_vars", vaultVars)
+	c.Assert(err, IsNil)
+	c.Assert(out, Equals, vaultVars)
+
+	// the encrypted vars are rejected when no vault password is configured
+	m := &Manager{config: DefaultConfig()}
+	err = m.validateVaultExtraVars(vaultVars)
+	c.Assert(err, NotNil)
+	c.Assert(httpStatus(err), Equals, http.StatusBadRequest)
+	c.Assert(m.validateVaultExtraVars(`{"foo":"bar"}`), IsNil)
+	m.config.Ansible.VaultPasswordFile = "/etc/clusterm/vault-pass"
+	c.Assert(m.validateVaultExtraVars(vaultVars), IsNil)
+
+	// the encrypted globals are not revealed
+	m.configuration = configuration.NewAnsibleSubsys(&configuration.AnsibleSubsysConfig{})
+	c.Assert(m.configuration.SetGlobals(vaultVars), IsNil)
+	r, err := m.globalsGet(&APIRequest{})
+	c.Assert(err, IsNil)
+	body, err := ioutil.ReadAll(r)
+	c.Assert(err, IsNil)
+	c.Assert(string(body), Equals, `{"extra_vars":{},"vault_encrypted":true}`)
+
+	e := newUpdateEvent(m, []string{"node1"}, vaultVars, "", "", 0)
+	c.Assert(strings.Contains(e.String(), "ANSIBLE_VAULT"), Equals, false)
+}
+
+func (s *apiSuite) TestGlobalsGetUnparsable(c *C) {
+	m := &Manager{configuration: configuration.NewAnsibleSubsys(&configuration.AnsibleSubsysConfig{})}
+	c.Assert(m.configuration.SetGlobals(`{"foo":"bar"}`), IsNil)
+	r, err := m.globalsGet(&APIRequest{})
+	c.Assert(err, IsNil)
+	body, err := ioutil.ReadAll(r)
+	c.Assert(err, IsNil)
+	c.Assert(string(body), Equals, `{"extra_vars":{"foo":"bar"}}`)
+
+	// the stored value is returned as is, without being parsed
+	r, err = m.globalsGet(&APIRequest{Raw: true})
+	c.Assert(err, IsNil)
+	body, err = ioutil.ReadAll(r)
+	c.Assert(err, IsNil)
+	c.Assert(string(body), Equals, `{"extra_vars":null,"raw":"{\"foo\":\"bar\"}"}`)
+
+	// the globals that can't be parsed are returned along with the parse error
+	c.Assert(m.configuration.SetGlobals(`{"foo":`), IsNil)
+	r, err = m.globalsGet(&APIRequest{})
+	c.Assert(err, IsNil)
+	globals := map[string]interface{}{}
+	c.Assert(json.NewDecoder(r).Decode(&globals), IsNil)
+	c.Assert(globals["extra_vars"], IsNil)
+	c.Assert(globals["raw"], Equals, `{"foo":`)
+	c.Assert(globals["parse_error"], Equals, "unexpected end of JSON input")
+
+	req, err := parseGetRequest(httptest.NewRequest("GET", "/"+GetGlobals+"?raw=yes", nil))
+	c.Assert(err, NotNil)
+	c.Assert(httpStatus(err), Equals, http.StatusBadRequest)
+	req, err = parseGetRequest(httptest.NewRequest("GET", "/"+GetGlobals+"?raw=true", nil))
+	c.Assert(err, IsNil)
+	c.Assert(req.Raw, Equals, true)
+}
+
+func (s *apiSuite) TestMonitorEventWait(c *C) {
+	m := &Manager{reqQ: make(chan event, 1)}
+	m.RegisterHook(&recordingHook{preErr: fmt.Errorf("test error")})
+	go func() {
+		m.processEvent(<-m.reqQ)
+	}()
+
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("POST", "/"+PostMonitorEvent+"?wait=true",
+		strings.NewReader(`{"monitor_event":{"name":"discovered",`+
+			`"nodes":[{"label":"node1","serial":"s1","addr":"1.1.1.1"}]}}`))
+	c.Assert(err, IsNil)
+	post(m.monitorEvent)(w, r)
+	// the error in processing the event is returned
+	c.Assert(w.Code, Equals, http.StatusInternalServerError)
+	c.Assert(strings.TrimSpace(w.Body.String()), Equals, "test error")
+
+	w = httptest.NewRecorder()
+	r, err = http.NewRequest("POST", "/"+PostMonitorEvent+"?wait=foo", strings.NewReader(`{}`))
+	c.Assert(err, IsNil)
+	post(m.monitorEvent)(w, r)
+	c.Assert(w.Code, Equals, http.StatusBadRequest)
+}
+
+func (s *apiSuite) TestMonitorEventQueueFull(c *C) {
+	config := DefaultConfig()
+	config.Manager.MonitorEnqueueTimeout = "10ms"
+	m := &Manager{config: config, reqQ: make(chan event, 1)}
+	c.Assert(m.enqueue(&blockingEvent{}), IsNil)
+
+	// the event is rejected, instead of blocking, once the wait for room in
+	// the queue elapses
+	for _, query := range []string{"", "?wait=true"} {
+		w := httptest.NewRecorder()
+		r, err := http.NewRequest("POST", "/"+PostMonitorEvent+query,
+			strings.NewReader(`{"monitor_event":{"name":"discovered",`+
+				`"nodes":[{"label":"node1","serial":"s1","addr":"1.1.1.1"}]}}`))
+		c.Assert(err, IsNil)
+		post(m.monitorEvent)(w, r)
+		c.Assert(w.Code, Equals, http.StatusServiceUnavailable, Commentf("query: %q", query))
+		c.Assert(w.Header().Get("Retry-After"), Equals, strconv.Itoa(reqQueueRetryAfter))
+	}
+
+	out, err := m.metricsGet(&APIRequest{})
+	c.Assert(err, IsNil)
+	metrics := Metrics{}
+	c.Assert(json.NewDecoder(out).Decode(&metrics), IsNil)
+	c.Assert(metrics.DroppedMonitorEvents, Equals, uint64(2))
+
+	// the event is queued once there is room in the queue
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		<-m.reqQ
+	}()
+	m.config.Manager.MonitorEnqueueTimeout = "1s"
+	err = m.monitorEvent(&APIRequest{Event: MonitorEvent{Name: "discovered",
+		Nodes: []MonitorNode{{Label: "node1", Serial: "s1", MgmtAddr: "1.1.1.1"}}}})
+	c.Assert(err, IsNil)
+	c.Assert(m.reqQ, HasLen, 1)
+}
+
+func (s *apiSuite) TestMonitorEventInvalidNodes(c *C) {
+	m := &Manager{reqQ: make(chan event, 1)}
+	valid := MonitorNode{Label: "node1", Serial: "s1", MgmtAddr: "1.1.1.1"}
+	tests := map[string]struct {
+		nodes    []MonitorNode
+		exptdErr error
+	}{
+		"no-nodes":      {nil, errNoEventNodes()},
+		"empty-label":   {[]MonitorNode{{Label: " ", Serial: "s1", MgmtAddr: "1.1.1.1"}}, errInvalidEventNodeField("label", "")},
+		"empty-serial":  {[]MonitorNode{{Label: "node1", MgmtAddr: "1.1.1.1"}}, errInvalidEventNodeField("serial", "")},
+		"empty-addr":    {[]MonitorNode{{Label: "node1", Serial: "s1"}}, errInvalidEventNodeField("addr", "")},
+		"bad-addr":      {[]MonitorNode{{Label: "node1", Serial: "s1", MgmtAddr: "1.1.1"}}, errInvalidEventNodeField("addr", "1.1.1")},
+		"no-host":       {[]MonitorNode{{Label: "node1", Serial: "s1", MgmtAddr: ":22"}}, errInvalidEventNodeField("addr", ":22")},
+		"bad-port":      {[]MonitorNode{{Label: "node1", Serial: "s1", MgmtAddr: "host1:ssh"}}, errInvalidEventNodeField("addr", "host1:ssh")},
+		"port-too-high": {[]MonitorNode{{Label: "node1", Serial: "s1", MgmtAddr: "host1:70000"}}, errInvalidEventNodeField("addr", "host1:70000")},
+		"second-node":   {[]MonitorNode{valid, {Label: "node2", MgmtAddr: "1.1.1.2"}}, errInvalidEventNodeField("serial", "")},
+	}
+	for key, test := range tests {
+		err := m.monitorEvent(&APIRequest{Event: MonitorEvent{Name: "discovered", Nodes: test.nodes}})
+		c.Assert(err, NotNil, Commentf("key: %s", key))
+		c.Assert(err.Error(), Equals, test.exptdErr.Error(), Commentf("key: %s", key))
+		c.Assert(httpStatus(err), Equals, http.StatusBadRequest, Commentf("key: %s", key))
+	}
+	c.Assert(m.reqQ, HasLen, 0)
+}
+
+func (s *apiSuite) TestNormalizeMonitorNode(c *C) {
+	for addr, exptd := range map[string]string{
+		" 1.1.1.1 ":      "1.1.1.1",
+		"::1":            "::1",
+		"1.1.1.1:22":     "1.1.1.1:22",
+		"[::1]:22":       "[::1]:22",
+		"host1.lab:2222": "host1.lab:2222",
+	} {
+		node, err := normalizeMonitorNode(MonitorNode{Label: " node1", Serial: "s1 ", MgmtAddr: addr})
+		c.Assert(err, IsNil, Commentf("addr: %q", addr))
+		c.Assert(node.MgmtAddr, Equals, exptd)
+		c.Assert(node.Label, Equals, "node1")
+		c.Assert(node.Serial, Equals, "s1")
+	}
+}
+
+func (s *apiSuite) TestRequestDrain(c *C) {
+	yes, no := true, false
+	m := &Manager{config: DefaultConfig()}
+
+	// no drain by default, when no drain playbook is configured
+	playbook, _, err := m.requestDrain(&APIRequest{})
+	c.Assert(err, IsNil)
+	c.Assert(playbook, Equals, "")
+	_, _, err = m.requestDrain(&APIRequest{Drain: &yes})
+	c.Assert(err, NotNil)
+	c.Assert(httpStatus(err), Equals, 400)
+
+	m.config.Ansible.DrainPlaybook = "drain.yml"
+	playbook, timeout, err := m.requestDrain(&APIRequest{DrainTimeout: "5m"})
+	c.Assert(err, IsNil)
+	c.Assert(playbook, Equals, "drain.yml")
+	c.Assert(timeout, Equals, 5*time.Minute)
+	playbook, _, err = m.requestDrain(&APIRequest{Drain: &no})
+	c.Assert(err, IsNil)
+	c.Assert(playbook, Equals, "")
+	_, _, err = m.requestDrain(&APIRequest{DrainTimeout: "foo"})
+	c.Assert(err, NotNil)
+	c.Assert(httpStatus(err), Equals, 400)
+}
+
+func (s *apiSuite) TestRequestVerify(c *C) {
+	yes, no := true, false
+	m := &Manager{config: DefaultConfig()}
+	m.config.Ansible.AllowedPlaybooks = []string{"smoke.yml"}
+	m.configuration = configuration.NewAnsibleSubsys(&m.config.Ansible)
+
+	// no verification by default, when no verify playbook is configured
+	playbook, err := m.requestVerify(&APIRequest{})
+	c.Assert(err, IsNil)
+	c.Assert(playbook, Equals, "")
+	_, err = m.requestVerify(&APIRequest{Verify: &yes})
+	c.Assert(err, NotNil)
+	c.Assert(httpStatus(err), Equals, 400)
+
+	m.config.Ansible.VerifyPlaybook = "verify.yml"
+	playbook, err = m.requestVerify(&APIRequest{})
+	c.Assert(err, IsNil)
+	c.Assert(playbook, Equals, "verify.yml")
+	playbook, err = m.requestVerify(&APIRequest{Verify: &no})
+	c.Assert(err, IsNil)
+	c.Assert(playbook, Equals, "")
+
+	// the playbook in the request shall be one of the known playbooks
+	playbook, err = m.requestVerify(&APIRequest{VerifyPlaybook: "smoke.yml"})
+	c.Assert(err, IsNil)
+	c.Assert(playbook, Equals, "smoke.yml")
+	_, err = m.requestVerify(&APIRequest{VerifyPlaybook: "foo.yml"})
+	c.Assert(err, NotNil)
+	c.Assert(httpStatus(err), Equals, 400)
+}
+
+func (s *apiSuite) TestRequestConnection(c *C) {
+	m := &Manager{config: DefaultConfig()}
+	m.config.Ansible.SSHKeys = map[string]string{"batch2": "/etc/clusterm/batch2_rsa"}
+	m.configuration = configuration.NewAnsibleSubsys(&m.config.Ansible)
+
+	// the configured connection is used by default
+	user, keyRef, err := m.requestConnection(&APIRequest{})
+	c.Assert(err, IsNil)
+	c.Assert(user, Equals, "")
+	c.Assert(keyRef, Equals, "")
+
+	user, keyRef, err = m.requestConnection(&APIRequest{SSHUser: "ops", SSHKeyRef: "batch2"})
+	c.Assert(err, IsNil)
+	c.Assert(user, Equals, "ops")
+	c.Assert(keyRef, Equals, "batch2")
+
+	// the key reference shall name a key in the keystore
+	_, _, err = m.requestConnection(&APIRequest{SSHKeyRef: "batch3"})
+	c.Assert(err, NotNil)
+	c.Assert(err.Error(), Equals, errUnknownKeyRef("batch3").Error())
+	c.Assert(httpStatus(err), Equals, 400)
+	c.Assert(strings.Contains(err.Error(), "batch2_rsa"), Equals, false)
+
+	_, _, err = m.requestConnection(&APIRequest{SSHUser: "ops; rm -rf /"})
+	c.Assert(err, NotNil)
+	c.Assert(httpStatus(err), Equals, 400)
+
+	// the connection can't be specified if the configuration subsystem doesn't support it
+	m.configuration = &fakeConfigSubsys{}
+	_, _, err = m.requestConnection(&APIRequest{SSHUser: "ops"})
+	c.Assert(err, NotNil)
+	c.Assert(httpStatus(err), Equals, 400)
+}
+
+func (s *apiSuite) TestValidateGlobals(c *C) {
+	m := &Manager{config: DefaultConfig()}
+	for _, extraVars := range []string{"", `{}`, `{"foo":"bar"}`} {
+		report := m.validateGlobals(extraVars)
+		c.Assert(report.Valid, Equals, true, Commentf("globals: %q", extraVars))
+		c.Assert(report.Problems, HasLen, 0)
+	}
+	for _, extraVars := range []string{`{"foo":`, `["foo"]`, "$ANSIBLE_VAULT;1.1;AES256\n6231336539666234"} {
+		report := m.validateGlobals(extraVars)
+		c.Assert(report.Valid, Equals, false, Commentf("globals: %q", extraVars))
+		c.Assert(report.Problems, HasLen, 1)
+		c.Assert(report.Problems[0].Key, Equals, "")
+	}
+
+	// all the problems with the keys are reported
+	m.config.Manager.GlobalsSchema = map[string]string{
+		"env":         "object",
+		"service_vip": "string",
+		"replicas":    "number",
+	}
+	report := m.validateGlobals(`{"service_vip":10,"replicas":3,"foo":"bar","env":{}}`)
+	c.Assert(report.Valid, Equals, false)
+	c.Assert(report.Problems, DeepEquals, []GlobalsProblem{
+		{Key: "foo", Message: "unknown key"},
+		{Key: "service_vip", Message: "expected a value of type string, got number"},
+	})
+
+	// the invalid globals are not set
+	err := m.globalsSet(&APIRequest{ExtraVars: `{"foo":"bar"}`})
+	c.Assert(err, NotNil)
+	c.Assert(httpStatus(err), Equals, 400)
+	c.Assert(err.Error(), Equals, errInvalidGlobals([]GlobalsProblem{{Key: "foo", Message: "unknown key"}}).Error())
+
+	// the report is returned even if the globals are not valid JSON
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("POST", "/"+PostGlobalsValidate, strings.NewReader(`{"extra_vars":"{\"foo\":"}`))
+	c.Assert(err, IsNil)
+	m.globalsValidate(w, r)
+	c.Assert(w.Code, Equals, http.StatusOK)
+	report = &GlobalsValidationReport{}
+	c.Assert(json.Unmarshal(w.Body.Bytes(), report), IsNil)
+	c.Assert(report.Valid, Equals, false)
+	c.Assert(report.Problems, HasLen, 1)
+}
+
+func (s *apiSuite) TestRebootNoPlaybook(c *C) {
+	m := &Manager{config: DefaultConfig()}
+	_, err := m.nodesReboot(&APIRequest{Nodes: []string{"node1"}})
+	c.Assert(err, NotNil)
+	c.Assert(err.Error(), Equals, errNoRebootPlaybook().Error())
+	c.Assert(httpStatus(err), Equals, 400)
+
+	m.config.Ansible.RebootPlaybook = "reboot.yml"
+	_, err = m.nodesReboot(&APIRequest{Nodes: []string{"node1"}, RejoinTimeout: "foo"})
+	c.Assert(err, NotNil)
+	c.Assert(httpStatus(err), Equals, 400)
+}
+
+func (s *apiSuite) TestPostUnknownNodes(c *C) {
+	// the request queue is left nil, so an enqueue would fail
+	m := &Manager{config: DefaultConfig(), nodes: map[string]*node{"node1": {}}}
+	m.config.Ansible.RebootPlaybook = "reboot.yml"
+	for _, cb := range []postJobCallback{m.nodesCommission, m.nodesDecommission, m.nodesUpdate, m.nodesReboot} {
+		_, err := cb(&APIRequest{Nodes: []string{"node1", "node2", "node3"}})
+		c.Assert(err, NotNil)
+		c.Assert(err.Error(), Equals, errUnknownNodes([]string{"node2", "node3"}).Error())
+		c.Assert(httpStatus(err), Equals, 400)
+
+		// the unknown nodes are ignored, if requested, as long as a node is known
+		req := &APIRequest{Nodes: []string{"node1", "node2"}, IgnoreMissing: true}
+		_, err = cb(req)
+		c.Assert(httpStatus(err), Equals, http.StatusServiceUnavailable)
+		c.Assert(req.Nodes, DeepEquals, []string{"node1"})
+		_, err = cb(&APIRequest{Nodes: []string{"node2"}, IgnoreMissing: true})
+		c.Assert(httpStatus(err), Equals, 400)
+	}
+}
+
+func (s *apiSuite) TestPostInvalidTimeout(c *C) {
+	m := Manager{}
+	for _, cb := range []postJobCallback{m.nodesCommission, m.nodesDecommission, m.nodesUpdate, m.nodesDiscover} {
+		for _, timeout := range []string{"foo", "-1m", "0s"} {
+			_, err := cb(&APIRequest{Nodes: []string{"node1"}, Timeout: timeout})
+			c.Assert(err, NotNil)
+			c.Assert(err.Error(), Equals, errInvalidTimeout(timeout).Error())
+			c.Assert(httpStatus(err), Equals, 400)
+		}
+	}
+}
+
+func (s *apiSuite) TestPostDiscoverInvalidConnectTimeout(c *C) {
+	m := Manager{}
+	for _, timeout := range []string{"foo", "-1s", "0s"} {
+		_, err := m.nodesDiscover(&APIRequest{Addrs: []string{"1.1.1.1"}, ConnectTimeout: timeout})
+		c.Assert(err, NotNil)
+		c.Assert(err.Error(), Equals, errInvalidTimeout(timeout).Error())
+		c.Assert(httpStatus(err), Equals, 400)
+	}
+}
+
+func (s *apiSuite) TestPostInvalidForks(c *C) {
+	m := &Manager{}
+	e := newCommissionEvent(m, []string{"node1"}, "{}", ansibleMasterGroupName, "", 0)
+	for _, forks := range []int{-1, maxAnsibleForks + 1} {
+		for _, async := range []bool{false, true} {
+			_, err := m.enqueueJobEvent(&APIRequest{Forks: forks, Async: async}, e, 0)
+			c.Assert(err, NotNil)
+			c.Assert(err.Error(), Equals, errInvalidForks(forks).Error())
+			c.Assert(httpStatus(err), Equals, 400)
+		}
+		_, err := m.scheduleJobEvent(&APIRequest{Forks: forks}, e, time.Now().Add(time.Hour))
+		c.Assert(err, NotNil)
+		c.Assert(httpStatus(err), Equals, 400)
+	}
+}
+
+func (s *apiSuite) TestWriteTimeout(c *C) {
+	slowHdlr := func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		w.Write([]byte("done"))
+	}
+
+	newServer := func(h http.HandlerFunc) *httptest.Server {
+		srv := httptest.NewUnstartedServer(h)
+		srv.Config.ConnContext = withConn
+		srv.Start()
+		return srv
+	}
+
+	// the response can't be written past the deadline
+	srv := newServer(withWriteTimeout(50*time.Millisecond, slowHdlr))
+	_, err := http.Get(srv.URL)
+	srv.Close()
+	c.Assert(err, NotNil)
+
+	// a streamed response is exempt from the deadline of a wrapping handler
+	srv = newServer(withWriteTimeout(50*time.Millisecond, streaming(slowHdlr)))
+	defer srv.Close()
+	resp, err := http.Get(srv.URL)
+	c.Assert(err, IsNil)
+	defer resp.Body.Close()
+	out, err := ioutil.ReadAll(resp.Body)
+	c.Assert(err, IsNil)
+	c.Assert(string(out), Equals, "done")
+}
+
+// blockingEvent is an event whose processing blocks until it is signalled
+type blockingEvent struct {
+	doneCh chan struct{}
+}
+
+func (e *blockingEvent) String() string {
+	return "blockingEvent"
+}
+
+func (e *blockingEvent) process() error {
+	<-e.doneCh
+	return nil
+}
+
+func (s *apiSuite) TestWaitForCompletionTimeout(c *C) {
+	be := &blockingEvent{doneCh: make(chan struct{})}
+	me := newWaitableEventWithTimeout(be, 100*time.Millisecond)
+	go me.process()
+	err := me.waitForCompletion()
+	c.Assert(err, NotNil)
+	c.Assert(IsTimeoutError(err), Equals, true)
+	c.Assert(httpStatus(err), Equals, 504)
+	// the processing doesn't block once the wait has timed out
+	close(be.doneCh)
+}
+
+func (s *apiSuite) TestGzipHandler(c *C) {
+	flushedCh := make(chan struct{})
+	doneCh := make(chan struct{})
+	hdlr := gzipHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("chunk1"))
+		w.(http.Flusher).Flush()
+		flushedCh <- struct{}{}
+		<-doneCh
+		w.Write([]byte("chunk2"))
+	}))
+
+	// response is not compressed if client doesn't accept it
+	r, err := http.NewRequest("GET", "/"+GetNodesInfo, nil)
+	c.Assert(err, IsNil)
+	w := httptest.NewRecorder()
+	go func() { <-flushedCh; doneCh <- struct{}{} }()
+	hdlr.ServeHTTP(w, r)
+	c.Assert(w.Header().Get("Content-Encoding"), Equals, "")
+	c.Assert(w.Body.String(), Equals, "chunk1chunk2")
+
+	// response is compressed and flushed data is readable before the response ends
+	r.Header.Set("Accept-Encoding", "deflate, gzip;q=1.0")
+	w = httptest.NewRecorder()
+	go hdlr.ServeHTTP(w, r)
+	<-flushedCh
+	c.Assert(w.Header().Get("Content-Encoding"), Equals, "gzip")
+	gr, err := gzip.NewReader(bytes.NewReader(w.Body.Bytes()))
+	c.Assert(err, IsNil)
+	buf := make([]byte, len("chunk1"))
+	_, err = io.ReadFull(gr, buf)
+	c.Assert(err, IsNil)
+	c.Assert(string(buf), Equals, "chunk1")
+	doneCh <- struct{}{}
+}
+
+func (s *apiSuite) TestConfigValidate(c *C) {
+	m := &Manager{config: DefaultConfig()}
+	tests := map[string]struct {
+		body     string
+		exptdErr error
+	}{
+		"valid":           {body: `{"config":{"ansible":{"playbook_location":"/tmp"}}}`},
+		"nil-config":      {body: `{}`, exptdErr: errNilConfig()},
+		"manager-changed": {body: `{"config":{"manager":{"addr":"0.0.0.0:1234"}}}`, exptdErr: configChangeNotPermittedError("manager")},
+		"serf-changed":    {body: `{"config":{"serf":{"Addr":"1.1.1.1:7373"}}}`, exptdErr: configChangeNotPermittedError("serf")},
+	}
+	for key, test := range tests {
+		r, err := http.NewRequest("POST", "/"+PostConfigValidate, strings.NewReader(test.body))
+		c.Assert(err, IsNil)
+		w := httptest.NewRecorder()
+		m.configValidate(w, r)
+		if test.exptdErr == nil {
+			c.Assert(w.Code, Equals, http.StatusOK, Commentf("key: %s", key))
+			continue
+		}
+		c.Assert(w.Code, Equals, http.StatusBadRequest, Commentf("key: %s", key))
+		verr := &ConfigValidationError{}
+		c.Assert(json.Unmarshal(w.Body.Bytes(), verr), IsNil, Commentf("key: %s", key))
+		c.Assert(verr.Message, Equals, test.exptdErr.Error(), Commentf("key: %s", key))
+	}
+	// the config is not applied
+	c.Assert(m.config, DeepEquals, DefaultConfig())
+}
+
+func (s *apiSuite) TestInventoryExport(c *C) {
+	cfg := configuration.NewAnsibleSubsys(&configuration.AnsibleSubsysConfig{})
+	c.Assert(cfg.SetGlobals(`{"foo":"bar"}`), IsNil)
+	m := &Manager{
+		config:        DefaultConfig(),
+		configuration: cfg,
+		nodes: map[string]*node{
+			"node1": {Mon: monitor.NewNode("node1", "s1", "1.1.1.1")},
+		},
+	}
+
+	out, err := m.inventoryExport(&APIRequest{})
+	c.Assert(err, IsNil)
+	export := InventoryExport{}
+	c.Assert(json.NewDecoder(out).Decode(&export), IsNil)
+	c.Assert(export.Version, Equals, inventoryExportVersion)
+	c.Assert(export.Config, DeepEquals, DefaultConfig())
+	c.Assert(string(export.Globals), Equals, `{"extra_vars":{"foo":"bar"}}`)
+	nodes, err := m.allNodes(&APIRequest{})
+	c.Assert(err, IsNil)
+	exptdNodes, err := ioutil.ReadAll(nodes)
+	c.Assert(err, IsNil)
+	c.Assert(string(export.Nodes), Equals, string(exptdNodes))
+}
+
+func (s *apiSuite) TestConfigDiff(c *C) {
+	m := &Manager{config: DefaultConfig()}
+	_, err := m.configDiff(&APIRequest{})
+	c.Assert(err, NotNil)
+	c.Assert(httpStatus(err), Equals, 400)
+
+	// the candidate config is merged with the defaults before it is compared
+	out, err := m.configDiff(&APIRequest{Config: &Config{Manager: clustermConfig{JobWorkers: 3}}})
+	c.Assert(err, IsNil)
+	changes := []ConfigChange{}
+	c.Assert(json.NewDecoder(out).Decode(&changes), IsNil)
+	c.Assert(changes, DeepEquals, []ConfigChange{{Field: "manager.job_workers", From: 1.0, To: 3.0}})
+}
+
+func (s *apiSuite) TestLogLevel(c *C) {
+	defer logrus.SetLevel(logrus.GetLevel())
+	m := &Manager{}
+
+	c.Assert(m.logLevelSet(&APIRequest{Level: "warning"}), IsNil)
+	out, err := m.logLevelGet(&APIRequest{})
+	c.Assert(err, IsNil)
+	level := LogLevel{}
+	c.Assert(json.NewDecoder(out).Decode(&level), IsNil)
+	c.Assert(level.Level, Equals, logrus.WarnLevel.String())
+
+	for _, lvl := range []string{"", "foo"} {
+		err := m.logLevelSet(&APIRequest{Level: lvl})
+		c.Assert(err, NotNil)
+		c.Assert(err.Error(), Equals, errInvalidLogLevel(lvl).Error())
+		c.Assert(httpStatus(err), Equals, 400)
+	}
+	c.Assert(logrus.GetLevel(), Equals, logrus.WarnLevel)
+}
+
+func (s *apiSuite) TestRequireToken(c *C) {
+	okHdlr := func(w http.ResponseWriter, r *http.Request) {}
+	for token, exptd := range map[string]int{
+		"":              http.StatusUnauthorized,
+		"Bearer foo":    http.StatusUnauthorized,
+		"secret":        http.StatusUnauthorized,
+		"Basic secret":  http.StatusUnauthorized,
+		"Bearer secret": http.StatusOK,
+	} {
+		r, err := http.NewRequest("GET", "/"+getDebugPrefix+"/", nil)
+		c.Assert(err, IsNil)
+		if token != "" {
+			r.Header.Set("Authorization", token)
+		}
+		w := httptest.NewRecorder()
+		requireToken("secret", okHdlr)(w, r)
+		c.Assert(w.Code, Equals, exptd, Commentf("token: %s", token))
+
+		// nothing is served if token is not set
+		w = httptest.NewRecorder()
+		requireToken("", okHdlr)(w, r)
+		c.Assert(w.Code, Equals, http.StatusUnauthorized, Commentf("token: %s", token))
+	}
+}
+
+func (s *apiSuite) TestJSONToYAML(c *C) {
+	tests := map[string]string{
+		`{"b":{"d":[1,"x"],"c":true},"a":null,"e":{},"f":[]}`: "a: null\nb:\n  c: true\n  d:\n    - 1\n    - x\ne: {}\nf: []\n",
+		`[{"a":"1.1.1.1","b":"yes"},["no"]]`:                  "-\n  a: \"1.1.1.1\"\n  b: \"yes\"\n-\n  - \"no\"\n",
+		`"foo: bar"`:                                          "\"foo: bar\"\n",
+		`{}`:                                                  "{}\n",
+	}
+	for in, exptd := range tests {
+		out, err := jsonToYAML([]byte(in))
+		c.Assert(err, IsNil, Commentf("json: %s", in))
+		c.Assert(string(out), Equals, exptd, Commentf("json: %s", in))
+	}
+	_, err := jsonToYAML([]byte(`{`))
+	c.Assert(err, NotNil)
+}
+
+func (s *apiSuite) TestYAMLNegotiated(c *C) {
+	m := &Manager{
+		nodes: map[string]*node{
+			"node1": {Mon: monitor.NewNode("node1", "s1", "1.1.1.1")},
+		},
+	}
+	hdlr := yamlNegotiated(getWithETag(m.allNodes))
+
+	// json by default
+	r, err := http.NewRequest("GET", "/"+GetNodesInfo, nil)
+	c.Assert(err, IsNil)
+	w := httptest.NewRecorder()
+	hdlr(w, r)
+	c.Assert(w.Code, Equals, http.StatusOK)
+	c.Assert(w.Header().Get("Content-Type"), Not(Equals), yamlContentType)
+	out, err := jsonToYAML(w.Body.Bytes())
+	c.Assert(err, IsNil)
+
+	for _, accept := range []string{"application/yaml", "text/html, application/x-yaml;q=0.9"} {
+		r.Header.Set("Accept", accept)
+		w = httptest.NewRecorder()
+		hdlr(w, r)
+		c.Assert(w.Code, Equals, http.StatusOK)
+		c.Assert(w.Header().Get("Content-Type"), Equals, yamlContentType)
+		c.Assert(w.Body.String(), Equals, string(out))
+	}
+
+	// json is preferred if it is listed first
+	r.Header.Set("Accept", "application/json, application/yaml")
+	w = httptest.NewRecorder()
+	hdlr(w, r)
+	c.Assert(w.Header().Get("Content-Type"), Not(Equals), yamlContentType)
+
+	// errors are not converted
+	r, err = http.NewRequest("GET", "/"+GetNodeInfoPrefix+"/foo", nil)
+	c.Assert(err, IsNil)
+	r.Header.Set("Accept", "application/yaml")
+	w = httptest.NewRecorder()
+	yamlNegotiated(get(m.oneNode))(w, r)
+	c.Assert(w.Code, Not(Equals), http.StatusOK)
+	c.Assert(w.Header().Get("Content-Type"), Not(Equals), yamlContentType)
+}
+
+func (s *apiSuite) TestNDJSONNegotiated(c *C) {
+	m := &Manager{
+		nodes: map[string]*node{
+			"node2": {Mon: monitor.NewNode("node2", "s2", "2.2.2.2"), Tags: map[string]string{"rack": "r1"}},
+			"node1": {Mon: monitor.NewNode("node1", "s1", "1.1.1.1"), Tags: map[string]string{"rack": "r1"}},
+			"node3": {Mon: monitor.NewNode("node3", "s3", "3.3.3.3")},
+		},
+	}
+	hdlr := ndjsonNegotiated(yamlNegotiated(getWithETag(m.allNodes)), streaming(get(m.allNodesNDJSON)))
+
+	// json by default
+	r, err := http.NewRequest("GET", "/"+GetNodesInfo, nil)
+	c.Assert(err, IsNil)
+	w := httptest.NewRecorder()
+	hdlr(w, r)
+	c.Assert(w.Code, Equals, http.StatusOK)
+	c.Assert(w.Header().Get("Content-Type"), Not(Equals), ndjsonContentType)
+	nodes := map[string]interface{}{}
+	c.Assert(json.Unmarshal(w.Body.Bytes(), &nodes), IsNil)
+	c.Assert(nodes, HasLen, 3)
+
+	r, err = http.NewRequest("GET", "/"+GetNodesInfo+"?tag=rack%3Dr1", nil)
+	c.Assert(err, IsNil)
+	r.Header.Set("Accept", "application/x-ndjson")
+	w = httptest.NewRecorder()
+	hdlr(w, r)
+	c.Assert(w.Code, Equals, http.StatusOK)
+	c.Assert(w.Header().Get("Content-Type"), Equals, ndjsonContentType)
+	lines := strings.Split(strings.TrimSuffix(w.Body.String(), "\n"), "\n")
+	c.Assert(lines, HasLen, 2)
+	for i, name := range []string{"node1", "node2"} {
+		entry := &NodeStreamEntry{}
+		c.Assert(json.Unmarshal([]byte(lines[i]), entry), IsNil)
+		c.Assert(entry.Name, Equals, name)
+		info := map[string]interface{}{}
+		c.Assert(json.Unmarshal(entry.Info, &info), IsNil)
+		c.Assert(info["tags"], DeepEquals, map[string]interface{}{"rack": "r1"})
+	}
+}
+
+func (s *apiSuite) TestGetWithETag(c *C) {
+	m := &Manager{
+		nodes: map[string]*node{
+			"node1": {Mon: monitor.NewNode("node1", "s1", "1.1.1.1")},
+		},
+	}
+	hdlr := getWithETag(m.allNodes)
+
+	r, err := http.NewRequest("GET", "/"+GetNodesInfo, nil)
+	c.Assert(err, IsNil)
+	w := httptest.NewRecorder()
+	hdlr(w, r)
+	c.Assert(w.Code, Equals, http.StatusOK)
+	c.Assert(w.Body.Len(), Not(Equals), 0)
+	etag := w.Header().Get("ETag")
+	c.Assert(etag, Not(Equals), "")
+
+	// unchanged nodes
+	r.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	hdlr(w, r)
+	c.Assert(w.Code, Equals, http.StatusNotModified)
+	c.Assert(w.Body.Len(), Equals, 0)
+
+	// changed nodes
+	m.nodes["node2"] = &node{Mon: monitor.NewNode("node2", "s2", "1.1.1.2")}
+	w = httptest.NewRecorder()
+	hdlr(w, r)
+	c.Assert(w.Code, Equals, http.StatusOK)
+	c.Assert(w.Header().Get("ETag"), Not(Equals), etag)
+}
+
+func (s *apiSuite) TestPostReqQueueFull(c *C) {
+	m := &Manager{reqQ: make(chan event, 1), nodes: map[string]*node{"node1": {}}}
+	// fill the queue
+	c.Assert(m.enqueue(&blockingEvent{}), IsNil)
+
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("POST", "/"+PostNodesDecommission, strings.NewReader(`{"nodes":["node1"]}`))
+	c.Assert(err, IsNil)
+	postJob(m.nodesDecommission)(w, r)
+	c.Assert(w.Code, Equals, http.StatusServiceUnavailable)
+	c.Assert(w.Header().Get("Retry-After"), Equals, strconv.Itoa(reqQueueRetryAfter))
+	c.Assert(decodeAPIError(c, w), DeepEquals, APIError{Code: ErrCodeServiceUnavailable,
+		Message: errReqQueueFull(1).Error()})
+
+	out, err := m.metricsGet(&APIRequest{})
+	c.Assert(err, IsNil)
+	metrics := Metrics{}
+	c.Assert(json.NewDecoder(out).Decode(&metrics), IsNil)
+	c.Assert(metrics, DeepEquals, Metrics{ReqQueueDepth: 1, ReqQueueCapacity: 1})
+}
+
+// endlessReader is a stream that never ends, it records if it is closed
+type endlessReader struct {
+	sync.Mutex
+	closed bool
+}
+
+func (r *endlessReader) Read(p []byte) (int, error) {
+	return copy(p, "foo"), nil
+}
+
+func (r *endlessReader) Close() error {
+	r.Lock()
+	defer r.Unlock()
+	r.closed = true
+	return nil
+}
+
+func (r *endlessReader) isClosed() bool {
+	r.Lock()
+	defer r.Unlock()
+	return r.closed
+}
+
+func (s *apiSuite) TestGetStreamStopsOnCancel(c *C) {
+	src := &endlessReader{}
+	ctx, cancel := context.WithCancel(context.Background())
+	r, err := http.NewRequest("GET", "/"+getJobLog, nil)
+	c.Assert(err, IsNil)
+	r = r.WithContext(ctx)
+
+	doneCh := make(chan struct{})
+	go func() {
+		defer close(doneCh)
+		get(func(req *APIRequest) (io.Reader, error) { return src, nil })(httptest.NewRecorder(), r)
+	}()
+	cancel()
+	select {
+	case <-doneCh:
+	case <-time.After(5 * time.Second):
+		c.Fatalf("the stream was not stopped after the request was cancelled")
+	}
+	c.Assert(src.isClosed(), Equals, true)
+}
+
+func (s *apiSuite) TestGetStreamClosedOnDisconnect(c *C) {
+	pr, pw := io.Pipe()
+	srvr := httptest.NewServer(get(func(req *APIRequest) (io.Reader, error) {
+		return pr, nil
+	}))
+	defer srvr.Close()
+
+	// the response headers are sent with the first write to the stream
+	go pw.Write([]byte("foo"))
+	clstrC := NewClient(strings.TrimPrefix(srvr.URL, "http://"))
+	resp, err := clstrC.StreamLogs(jobLabelActive)
+	c.Assert(err, IsNil)
+	buf := make([]byte, 3)
+	_, err = io.ReadFull(resp, buf)
+	c.Assert(err, IsNil)
+	c.Assert(string(buf), Equals, "foo")
+	c.Assert(resp.Close(), IsNil)
+
+	// the writer is unblocked, and fails, once the client goes away. A write
+	// racing with the disconnect may still be consumed.
+	errCh := make(chan error, 1)
+	go func() {
+		for {
+			if _, err := pw.Write([]byte("bar")); err != nil {
+				errCh <- err
+				return
+			}
+		}
+	}()
+	select {
+	case err := <-errCh:
+		c.Assert(err, Equals, io.ErrClosedPipe)
+	case <-time.After(5 * time.Second):
+		c.Fatalf("the stream was not closed after the client went away")
+	}
+}
+
+func (s *apiSuite) TestConfigVersion(c *C) {
+	m := &Manager{config: DefaultConfig()}
+
+	// the version of the configuration is returned as the ETag
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("GET", "/"+GetPostConfig, nil)
+	c.Assert(err, IsNil)
+	m.withConfigVersion(get(m.configGet))(w, r)
+	c.Assert(w.Code, Equals, http.StatusOK)
+	c.Assert(w.Header().Get("ETag"), Equals, `"0"`)
+
+	// a config request shall specify the version it is based on
+	err = m.configSet(&APIRequest{Config: DefaultConfig()})
+	c.Assert(err, NotNil)
+	c.Assert(httpStatus(err), Equals, http.StatusPreconditionRequired)
+
+	e := newSetConfigEvent(m, DefaultConfig())
+	c.Assert(e.process(), IsNil)
+	c.Assert(m.currentConfigVersion(), Equals, uint64(1))
+
+	// a request based on an older version is rejected
+	e = newSetConfigEvent(m, DefaultConfig())
+	err = e.process()
+	c.Assert(err, NotNil)
+	c.Assert(httpStatus(err), Equals, http.StatusConflict)
+	c.Assert(err.Error(), Equals, errConfigVersionMismatch(0, 1).Error())
+}
+
+func (s *apiSuite) TestParseConfigVersionHeader(c *C) {
+	r, err := http.NewRequest("POST", "/"+GetPostConfig, strings.NewReader(`{}`))
+	c.Assert(err, IsNil)
+	r.Header.Set("If-Match", `"5"`)
+	req, err := parsePostRequest(r)
+	c.Assert(err, IsNil)
+	c.Assert(*req.ConfigVersion, Equals, uint64(5))
+
+	// the version in the body takes precedence over the header
+	r, err = http.NewRequest("POST", "/"+GetPostConfig, strings.NewReader(`{"config_version":6}`))
+	c.Assert(err, IsNil)
+	r.Header.Set("If-Match", `"5"`)
+	req, err = parsePostRequest(r)
+	c.Assert(err, IsNil)
+	c.Assert(*req.ConfigVersion, Equals, uint64(6))
+
+	r, err = http.NewRequest("POST", "/"+GetPostConfig, strings.NewReader(`{}`))
+	c.Assert(err, IsNil)
+	r.Header.Set("If-Match", "foo")
+	_, err = parsePostRequest(r)
+	c.Assert(err, NotNil)
+	c.Assert(httpStatus(err), Equals, http.StatusBadRequest)
+}
+
+func (s *apiSuite) TestContentType(c *C) {
+	m := &Manager{config: DefaultConfig()}
+	r := m.apiRouter(0)
+	tests := map[string]struct {
+		contentType string
+		exptdStatus int
+		exptdBody   string
+	}{
+		"json":         {"application/json", http.StatusOK, `"valid":true`},
+		"json-charset": {"application/json; charset=utf-8", http.StatusOK, `"valid":true`},
+		"json-case":    {"Application/JSON", http.StatusOK, `"valid":true`},
+		"missing":      {"", http.StatusUnsupportedMediaType, "missing Content-Type header"},
+		"text":         {"text/plain", http.StatusUnsupportedMediaType, `unsupported Content-Type "text/plain"`},
+		"malformed":    {"application/json; charset", http.StatusUnsupportedMediaType, "unsupported Content-Type"},
+	}
+	for key, test := range tests {
+		req, err := http.NewRequest("POST", "/"+PostGlobalsValidate, strings.NewReader(`{"extra_vars":"{}"}`))
+		c.Assert(err, IsNil, Commentf("test: %s", key))
+		if test.contentType != "" {
+			req.Header.Set("Content-Type", test.contentType)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		c.Assert(w.Code, Equals, test.exptdStatus, Commentf("test: %s", key))
+		c.Assert(strings.Contains(w.Body.String(), test.exptdBody), Equals, true,
+			Commentf("test: %s body: %s", key, w.Body.String()))
+	}
+}
+
+func (s *apiSuite) TestBasePath(c *C) {
+	m := &Manager{config: DefaultConfig(), reqQ: make(chan event, 2), basePath: "/clusterm"}
+	srv := httptest.NewServer(withBasePath(m.basePath, m.apiRouter(0)))
+	defer srv.Close()
+
+	// the client prefixes it's requests with the base path
+	clstrC := NewClient(srv.Listener.Addr().String()).WithBasePath("clusterm/")
+	metrics, err := clstrC.GetMetrics()
+	c.Assert(err, IsNil)
+	c.Assert(metrics.ReqQueueCapacity, Equals, 2)
+
+	// the endpoints are not served at the root
+	_, err = NewClient(srv.Listener.Addr().String()).GetMetrics()
+	c.Assert(err, NotNil)
+	for _, path := range []string{"/" + GetMetrics, "/clustermfoo/" + GetMetrics, "/clusterm"} {
+		resp, err := http.Get(srv.URL + path)
+		c.Assert(err, IsNil, Commentf("path: %s", path))
+		resp.Body.Close()
+		c.Assert(resp.StatusCode, Equals, http.StatusNotFound, Commentf("path: %s", path))
+	}
+
+	// the base path is known to the handlers, like to form the job urls
+	var basePath string
+	h := withBasePath("/clusterm", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Assert(r.URL.Path, Equals, "/"+GetJobPrefix+"/1")
+		basePath = requestBasePath(r)
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/clusterm/"+GetJobPrefix+"/1", nil))
+	c.Assert(basePath, Equals, "/clusterm")
+}
+
+// serveAndStop starts serving on the address, like clusterm does, and stops
+// after serving a request. The served connection is closed on the server's
+// end first, so it lingers in TIME_WAIT once the server stops
+func serveAndStop(c *C, addr string, reuseAddr bool) error {
+	l, err := listen(addr, 16, reuseAddr)
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})}
+	go srv.Serve(l)
+	resp, err := http.Get("http://" + addr)
+	c.Assert(err, IsNil)
+	c.Assert(resp.Body.Close(), IsNil)
+	c.Assert(srv.Close(), IsNil)
+	return nil
+}
+
+func (s *apiSuite) TestListenRestart(c *C) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	addr := l.Addr().String()
+	c.Assert(l.Close(), IsNil)
+
+	// a restart binds the address right away with SO_REUSEADDR, that is set by default
+	reuseAddr := !DefaultConfig().Manager.DisableReuseAddr
+	c.Assert(serveAndStop(c, addr, reuseAddr), IsNil)
+	c.Assert(serveAndStop(c, addr, reuseAddr), IsNil)
+
+	// the restart fails while the connection of the previous run lingers, without it
+	c.Assert(serveAndStop(c, addr, false), ErrorMatches, ".*address already in use")
+}
+
+func (s *apiSuite) TestStopOnSignal(c *C) {
+	sock := filepath.Join(c.MkDir(), "clusterm.sock")
+	m := &Manager{config: DefaultConfig(), addr: "unix:" + sock}
+	servingCh := make(chan struct{}, 1)
+	errCh := make(chan error, 1)
+	go func() { errCh <- m.apiLoop(servingCh) }()
+	<-servingCh
+	_, err := os.Stat(sock)
+	c.Assert(err, IsNil)
+
+	// the api loop returns on a signal, leaving the exit to the caller
+	c.Assert(syscall.Kill(os.Getpid(), syscall.SIGTERM), IsNil)
+	select {
+	case err := <-errCh:
+		serr, ok := err.(*StoppedError)
+		c.Assert(ok, Equals, true, Commentf("error: %v", err))
+		c.Assert(serr.Signal, Equals, syscall.SIGTERM)
+	case <-time.After(5 * time.Second):
+		c.Fatalf("the api loop didn't return on a signal")
+	}
+	_, err = os.Stat(sock)
+	c.Assert(os.IsNotExist(err), Equals, true, Commentf("error: %v", err))
+}
+
+func (s *apiSuite) TestMethodNotAllowed(c *C) {
+	m := &Manager{config: DefaultConfig()}
+	r := m.apiRouter(0)
+	tests := map[string]struct {
+		method      string
+		path        string
+		exptdStatus int
+		exptdAllow  string
+	}{
+		"get-commission":  {"GET", "/" + PostNodesCommission, http.StatusMethodNotAllowed, "POST"},
+		"post-nodes":      {"POST", "/" + GetNodesInfo, http.StatusMethodNotAllowed, "GET"},
+		"post-node":       {"POST", "/" + GetNodeInfoPrefix + "/node1", http.StatusMethodNotAllowed, "GET"},
+		"delete-config":   {"DELETE", "/" + GetPostConfig, http.StatusMethodNotAllowed, "GET, POST"},
+		"unknown-path":    {"GET", "/foo", http.StatusNotFound, ""},
+		"post-wrong-hdrs": {"POST", "/" + PostNodesCommission, http.StatusUnsupportedMediaType, ""},
+		"debug-disabled":  {"GET", "/" + getDebugPrefix + "/cmdline", http.StatusNotFound, ""},
+	}
+	for key, test := range tests {
+		req, err := http.NewRequest(test.method, test.path, nil)
+		c.Assert(err, IsNil, Commentf("test: %s", key))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		c.Assert(w.Code, Equals, test.exptdStatus, Commentf("test: %s", key))
+		c.Assert(w.Header().Get("Allow"), Equals, test.exptdAllow, Commentf("test: %s", key))
+	}
+}
@@ -0,0 +1,247 @@
+package manager
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/contiv/errored"
+	"github.com/gorilla/mux"
+)
+
+// auditStore persists the audit log of the mutating API calls. The log is
+// append-only
+type auditStore interface {
+	AppendAuditRecord(info []byte) error
+	GetAllAuditRecords() ([][]byte, error)
+}
+
+// maxAuditErrorLen is the length to which the error in an audit record is truncated
+const maxAuditErrorLen = 512
+
+// AuditRecord describes a mutating API call and it's outcome
+type AuditRecord struct {
+	Time       time.Time `json:"time"`
+	RemoteAddr string    `json:"remote_addr"`
+	// RequestID is the id of the request, if the client passed one in the
+	// X-Request-Id header
+	RequestID      string   `json:"request_id,omitempty"`
+	IdempotencyKey string   `json:"idempotency_key,omitempty"`
+	Method         string   `json:"method"`
+	Endpoint       string   `json:"endpoint"`
+	Nodes          []string `json:"nodes,omitempty"`
+	// JobID is the id of the job that the request created, if any
+	JobID  string `json:"job_id,omitempty"`
+	Status int    `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// auditResponseWriter records the outcome of a request for it's audit record
+type auditResponseWriter struct {
+	http.ResponseWriter
+	record *AuditRecord
+	errBuf bytes.Buffer
+}
+
+func (w *auditResponseWriter) WriteHeader(code int) {
+	if w.record.Status == 0 {
+		w.record.Status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *auditResponseWriter) Write(b []byte) (int, error) {
+	if w.record.Status == 0 {
+		w.record.Status = http.StatusOK
+	}
+	if w.record.Status >= http.StatusBadRequest && w.errBuf.Len() < maxAuditErrorLen {
+		w.errBuf.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// auditError returns the error to be recorded for an error response body. It
+// is the message of a JSON error body, or the body as is otherwise
+func auditError(body []byte) string {
+	e := APIError{}
+	if err := json.Unmarshal(body, &e); err == nil && e.Message != "" {
+		return e.Message
+	}
+	return strings.TrimSpace(string(body))
+}
+
+// errReader fails all reads with the specified error
+type errReader struct {
+	err error
+}
+
+func (r errReader) Read(p []byte) (int, error) {
+	return 0, r.err
+}
+
+// setAuditJobID records the id of the job created by a request in it's audit
+// record, if the request is audited
+func setAuditJobID(w http.ResponseWriter, id string) {
+	if aw, ok := w.(*auditResponseWriter); ok {
+		aw.record.JobID = id
+	}
+}
+
+// audited wraps a handler of a mutating API call to record the call and it's
+// outcome in the audit log. The record is written once the handler returns,
+// irrespective of the handler's success.
+func (m *Manager) audited(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		record := &AuditRecord{
+			Time:           time.Now(),
+			RemoteAddr:     r.RemoteAddr,
+			RequestID:      strings.TrimSpace(r.Header.Get(requestIDHeader)),
+			IdempotencyKey: strings.TrimSpace(r.Header.Get(idempotencyKeyHeader)),
+			Method:         r.Method,
+			Endpoint:       r.URL.Path,
+		}
+
+		// read the nodes from the request, the body is restored for the handler
+		var body []byte
+		if r.Body != nil {
+			var err error
+			var rest io.Reader = bytes.NewReader(nil)
+			if body, err = ioutil.ReadAll(r.Body); err != nil {
+				logrus.Errorf("failed to read request body for audit. Error: %v", err)
+				// the handler fails reading the body as well
+				rest = errReader{err: err}
+			}
+			r.Body = ioutil.NopCloser(io.MultiReader(bytes.NewReader(body), rest))
+		}
+		req := &APIRequest{}
+		if len(body) > 0 {
+			// the handler reports malformed requests, the nodes are just not recorded
+			_ = json.Unmarshal(body, req)
+		}
+		if tag := mux.Vars(r)["tag"]; tag != "" {
+			req.Nodes = append(req.Nodes, tag)
+		}
+		record.Nodes = req.Nodes
+
+		logrus.Infof("audit: %s %s from %s for nodes %v", record.Method, record.Endpoint,
+			record.RemoteAddr, record.Nodes)
+		aw := &auditResponseWriter{ResponseWriter: w, record: record}
+		defer func() {
+			p := recover()
+			if p != nil {
+				// the handler failed without writing a response
+				record.Status = http.StatusInternalServerError
+				aw.errBuf.Reset()
+				fmt.Fprintf(&aw.errBuf, "%v", p)
+			}
+			if record.Status == 0 {
+				record.Status = http.StatusOK
+			}
+			if aw.errBuf.Len() > 0 {
+				record.Error = auditError(aw.errBuf.Bytes())
+				if len(record.Error) > maxAuditErrorLen {
+					record.Error = record.Error[:maxAuditErrorLen]
+				}
+			}
+			m.appendAuditRecord(record)
+			if p != nil {
+				panic(p)
+			}
+		}()
+		h(aw, r)
+	}
+}
+
+// appendAuditRecord appends the record to the audit log. Failures are logged,
+// with the record, as the outcome of the request can't be changed anymore
+func (m *Manager) appendAuditRecord(record *AuditRecord) {
+	info, err := json.Marshal(record)
+	if err != nil {
+		logrus.Errorf("failed to marshal audit record %+v. Error: %v", record, err)
+		return
+	}
+	logrus.Infof("audit: %s", info)
+	if m.auditStore == nil {
+		return
+	}
+	if err := m.auditStore.AppendAuditRecord(info); err != nil {
+		logrus.Errorf("failed to save audit record %s. Error: %v", info, err)
+	}
+}
+
+// getAuditRecords returns the audit records within the specified time range.
+// A zero time leaves that end of the range open.
+func (m *Manager) getAuditRecords(since, until time.Time) ([]AuditRecord, error) {
+	records := []AuditRecord{}
+	if m.auditStore == nil {
+		return records, nil
+	}
+	infos, err := m.auditStore.GetAllAuditRecords()
+	if err != nil {
+		return nil, err
+	}
+	for _, info := range infos {
+		record := AuditRecord{}
+		if err := json.Unmarshal(info, &record); err != nil {
+			logrus.Errorf("failed to read audit record from %s. Error: %v", info, err)
+			continue
+		}
+		if (!since.IsZero() && record.Time.Before(since)) || (!until.IsZero() && record.Time.After(until)) {
+			continue
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// errInvalidTime is the error returned when an invalid time is specified as
+// part of a request
+func errInvalidTime(name, value string) error {
+	return errored.Errorf("Invalid %s time specified: %q. Expected a RFC3339 time like 2016-01-02T15:04:05Z",
+		name, value)
+}
+
+// parseTimeRange parses the 'since' and 'until' times of a request
+func parseTimeRange(r *http.Request) (since, until time.Time, err error) {
+	if v := r.URL.Query().Get("since"); v != "" {
+		if since, err = time.Parse(time.RFC3339, v); err != nil {
+			return since, until, errInvalidTime("since", v)
+		}
+	}
+	if v := r.URL.Query().Get("until"); v != "" {
+		if until, err = time.Parse(time.RFC3339, v); err != nil {
+			return since, until, errInvalidTime("until", v)
+		}
+	}
+	return since, until, nil
+}
+
+// auditGet returns the audit records, optionally filtered by the 'since' and
+// 'until' times
+func (m *Manager) auditGet(w http.ResponseWriter, r *http.Request) {
+	since, until, err := parseTimeRange(r)
+	if err != nil {
+		writeError(w, errBadRequest(err))
+		return
+	}
+	records, err := m.getAuditRecords(since, until)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	out, err := json.Marshal(records)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(out); err != nil {
+		logrus.Errorf("failed to write response bytes '%s'. Error: %v", out, err)
+	}
+}
@@ -0,0 +1,132 @@
+// +build unittest
+
+package manager
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type auditSuite struct {
+}
+
+var _ = Suite(&auditSuite{})
+
+// fakeAuditStore keeps the audit records in memory
+type fakeAuditStore struct {
+	infos [][]byte
+}
+
+func (s *fakeAuditStore) AppendAuditRecord(info []byte) error {
+	s.infos = append(s.infos, info)
+	return nil
+}
+
+func (s *fakeAuditStore) GetAllAuditRecords() ([][]byte, error) {
+	return s.infos, nil
+}
+
+func (s *auditSuite) getRecords(c *C, m *Manager) []AuditRecord {
+	records, err := m.getAuditRecords(time.Time{}, time.Time{})
+	c.Assert(err, IsNil)
+	return records
+}
+
+func (s *auditSuite) TestAuditedJob(c *C) {
+	m := &Manager{auditStore: &fakeAuditStore{}}
+	h := m.audited(postJob(func(req *APIRequest) (*Job, error) {
+		return &Job{id: 5}, nil
+	}))
+	r, err := http.NewRequest("POST", "/"+PostNodesCommission, strings.NewReader(`{"nodes":["node1","node2"]}`))
+	c.Assert(err, IsNil)
+	r.RemoteAddr = "1.2.3.4:5678"
+	r.Header.Set(requestIDHeader, "req1")
+	w := httptest.NewRecorder()
+	h(w, r)
+	c.Assert(w.Code, Equals, http.StatusOK)
+
+	records := s.getRecords(c, m)
+	c.Assert(records, HasLen, 1)
+	c.Assert(records[0].RemoteAddr, Equals, "1.2.3.4:5678")
+	c.Assert(records[0].RequestID, Equals, "req1")
+	c.Assert(records[0].Method, Equals, "POST")
+	c.Assert(records[0].Endpoint, Equals, "/"+PostNodesCommission)
+	c.Assert(records[0].Nodes, DeepEquals, []string{"node1", "node2"})
+	c.Assert(records[0].JobID, Equals, "5")
+	c.Assert(records[0].Status, Equals, http.StatusOK)
+	c.Assert(records[0].Error, Equals, "")
+}
+
+func (s *auditSuite) TestAuditedError(c *C) {
+	m := &Manager{auditStore: &fakeAuditStore{}}
+	h := m.audited(post(func(req *APIRequest) error {
+		// the request body is passed on to the handler
+		c.Assert(req.Nodes, DeepEquals, []string{"node1"})
+		return errBadRequest(errNoAnnotations())
+	}))
+	r, err := http.NewRequest("POST", "/"+PostGlobals, strings.NewReader(`{"nodes":["node1"]}`))
+	c.Assert(err, IsNil)
+	w := httptest.NewRecorder()
+	h(w, r)
+	c.Assert(w.Code, Equals, http.StatusBadRequest)
+
+	records := s.getRecords(c, m)
+	c.Assert(records, HasLen, 1)
+	c.Assert(records[0].Status, Equals, http.StatusBadRequest)
+	c.Assert(records[0].Error, Equals, errNoAnnotations().Error())
+	c.Assert(records[0].JobID, Equals, "")
+}
+
+func (s *auditSuite) TestAuditedPanic(c *C) {
+	m := &Manager{auditStore: &fakeAuditStore{}}
+	h := m.audited(func(w http.ResponseWriter, r *http.Request) {
+		panic("test panic")
+	})
+	r, err := http.NewRequest("POST", "/"+PostGlobals, nil)
+	c.Assert(err, IsNil)
+	c.Assert(func() { h(httptest.NewRecorder(), r) }, PanicMatches, "test panic")
+
+	records := s.getRecords(c, m)
+	c.Assert(records, HasLen, 1)
+	c.Assert(records[0].Status, Equals, http.StatusInternalServerError)
+	c.Assert(records[0].Error, Equals, "test panic")
+}
+
+func (s *auditSuite) TestAuditGet(c *C) {
+	store := &fakeAuditStore{}
+	m := &Manager{auditStore: store}
+	base := time.Date(2016, 1, 2, 15, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		m.appendAuditRecord(&AuditRecord{Time: base.Add(time.Duration(i) * time.Hour), Endpoint: "/test"})
+	}
+
+	tests := map[string]struct {
+		query       string
+		exptdStatus int
+		exptdCount  int
+	}{
+		"all":          {query: "", exptdStatus: http.StatusOK, exptdCount: 3},
+		"since":        {query: "?since=2016-01-02T16:00:00Z", exptdStatus: http.StatusOK, exptdCount: 2},
+		"until":        {query: "?until=2016-01-02T15:30:00Z", exptdStatus: http.StatusOK, exptdCount: 1},
+		"since-until":  {query: "?since=2016-01-02T15:30:00Z&until=2016-01-02T16:30:00Z", exptdStatus: http.StatusOK, exptdCount: 1},
+		"invalid-time": {query: "?since=yesterday", exptdStatus: http.StatusBadRequest},
+	}
+	for key, test := range tests {
+		r, err := http.NewRequest("GET", "/"+GetAudit+test.query, nil)
+		c.Assert(err, IsNil)
+		w := httptest.NewRecorder()
+		m.auditGet(w, r)
+		c.Assert(w.Code, Equals, test.exptdStatus, Commentf("key: %s", key))
+		if test.exptdStatus != http.StatusOK {
+			continue
+		}
+		records := []AuditRecord{}
+		c.Assert(json.Unmarshal(w.Body.Bytes(), &records), IsNil, Commentf("key: %s", key))
+		c.Assert(records, HasLen, test.exptdCount, Commentf("key: %s", key))
+	}
+}
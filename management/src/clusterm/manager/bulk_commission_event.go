@@ -0,0 +1,268 @@
+package manager
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/contiv/cluster/management/src/configuration"
+	"github.com/contiv/errored"
+)
+
+func errEmptyCommissionPlan() error {
+	return errored.Errorf("the commission plan shall have atleast one group of nodes")
+}
+
+func errNodeInSeveralGroups(name string) error {
+	return errored.Errorf("node %q is part of more than one group of the commission plan", name)
+}
+
+func errPhaseFailed(phase int, err error) error {
+	return errored.Errorf("phase %d of the commission failed. Error: %v", phase, err)
+}
+
+// CommissionPlan describes the commission of several groups of nodes, like
+// during the initial bring-up of a cluster. The groups are commissioned one
+// after the other, in phases
+type CommissionPlan struct {
+	// Groups are commissioned in the specified order, except that the groups
+	// of masters are commissioned before the rest
+	Groups []CommissionPlanGroup `json:"groups"`
+	// ContinueOnError, when true, makes the later groups to be commissioned even
+	// if an earlier one fails. By default, the later groups are skipped
+	ContinueOnError bool `json:"continue_on_error,omitempty"`
+}
+
+// CommissionPlanGroup is a group of nodes that are commissioned together
+type CommissionPlanGroup struct {
+	Nodes     []string `json:"nodes"`
+	HostGroup string   `json:"host_group"`
+	ExtraVars string   `json:"extra_vars,omitempty"`
+}
+
+// nodeNames returns the names of the nodes in all the groups of the plan
+func (p *CommissionPlan) nodeNames() []string {
+	names := []string{}
+	for _, g := range p.Groups {
+		names = append(names, g.Nodes...)
+	}
+	return names
+}
+
+// orderedGroups returns the groups in the order they are commissioned in
+func (p *CommissionPlan) orderedGroups() []CommissionPlanGroup {
+	groups := append([]CommissionPlanGroup{}, p.Groups...)
+	sort.Stable(byMasterGroupFirst(groups))
+	return groups
+}
+
+type byMasterGroupFirst []CommissionPlanGroup
+
+func (s byMasterGroupFirst) Len() int      { return len(s) }
+func (s byMasterGroupFirst) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byMasterGroupFirst) Less(i, j int) bool {
+	return s[i].HostGroup == ansibleMasterGroupName && s[j].HostGroup != ansibleMasterGroupName
+}
+
+// bulkCommissionEvent triggers the commission of the groups of nodes in a
+// plan, one group after the other, as a single job
+type bulkCommissionEvent struct {
+	jobTrigger
+	mgr     *Manager
+	plan    *CommissionPlan
+	timeout time.Duration // the job is cancelled if it runs longer than this
+
+	_phases []*commissionEvent
+	// _commissioned are the names of the nodes in the phases that succeeded
+	_commissioned []string
+}
+
+// newBulkCommissionEvent creates and returns bulkCommissionEvent
+func newBulkCommissionEvent(mgr *Manager, plan *CommissionPlan, timeout time.Duration) *bulkCommissionEvent {
+	return &bulkCommissionEvent{
+		mgr:     mgr,
+		plan:    plan,
+		timeout: timeout,
+	}
+}
+
+func (e *bulkCommissionEvent) String() string {
+	groups := []string{}
+	for _, g := range e.plan.Groups {
+		groups = append(groups, fmt.Sprintf("%s:%v extra-vars:%v", g.HostGroup, g.Nodes,
+			configuration.RedactExtraVars(g.ExtraVars)))
+	}
+	return fmt.Sprintf("bulkCommissionEvent: groups: %v continue-on-error: %v", groups, e.plan.ContinueOnError)
+}
+
+func (e *bulkCommissionEvent) process() error {
+	// err shouldn't be redefined below
+	var (
+		err error
+		job *Job
+	)
+
+	nodeNames := e.plan.nodeNames()
+	job, err = e.checkAndSetActiveJob(
+		e.mgr,
+		e.String(),
+		nodeNames,
+		e.timeout,
+		e.bulkRunner,
+		func(status JobStatus, errRet error) {
+			if status == Errored {
+				logrus.Errorf("bulk commission job failed. Error: %v", errRet)
+			}
+			// set the assets of the nodes in the phases that failed, or were
+			// skipped, as unallocated
+			commissioned := map[string]bool{}
+			for _, name := range e._commissioned {
+				commissioned[name] = true
+			}
+			for _, name := range nodeNames {
+				setStatus := e.mgr.inventory.SetAssetUnallocated
+				if commissioned[name] {
+					setStatus = e.mgr.inventory.SetAssetCommissioned
+				}
+				e.mgr.setAssetsStatusBestEffort([]string{name}, setStatus)
+			}
+		})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			e.mgr.resetActiveJob(job)
+		}
+	}()
+	e.setPlaybook(e.mgr, configuration.ActionConfigure, "")
+
+	// validate event data
+	if err = e.eventValidate(); err != nil {
+		return err
+	}
+
+	// prepare the inventory of each phase
+	if err = e.preparePhases(); err != nil {
+		return err
+	}
+
+	// set assets as provisioning
+	if err = e.mgr.setAssetsStatusAtomic(nodeNames, e.mgr.inventory.SetAssetProvisioning,
+		e.mgr.inventory.SetAssetUnallocated); err != nil {
+		return err
+	}
+
+	for _, phase := range e._phases {
+		e.mgr.setLastExtraVars(phase.nodeNames, phase.extraVars)
+	}
+
+	// trigger the commission of the phases
+	go e.mgr.runActiveJob(job)
+
+	return nil
+}
+
+// jobNodes returns the nodes the triggered job acts upon
+func (e *bulkCommissionEvent) jobNodes() ([]string, bool) {
+	return e.plan.nodeNames(), false
+}
+
+// eventValidate validates the plan and it's nodes
+func (e *bulkCommissionEvent) eventValidate() error {
+	if len(e.plan.Groups) == 0 {
+		return errEmptyCommissionPlan()
+	}
+	seen := map[string]bool{}
+	for _, g := range e.plan.Groups {
+		if !IsValidHostGroup(g.HostGroup) {
+			return errored.Errorf("invalid or empty host-group specified: %q", g.HostGroup)
+		}
+		if len(g.Nodes) == 0 {
+			return errored.Errorf("atleast one node should be specified in host-group %q", g.HostGroup)
+		}
+		for _, name := range g.Nodes {
+			if seen[name] {
+				return errNodeInSeveralGroups(name)
+			}
+			seen[name] = true
+		}
+	}
+	if _, err := e.mgr.commonEventValidate(e.plan.nodeNames()); err != nil {
+		return err
+	}
+
+	// when workers are being configured, make sure that there is atleast one
+	// service-master, either in the plan or in the cluster
+	for _, g := range e.plan.Groups {
+		if g.HostGroup == ansibleMasterGroupName {
+			return nil
+		}
+	}
+	if e.mgr.isMasterCommissioned(e.plan.nodeNames()) {
+		return nil
+	}
+	return errored.Errorf("Cannot commission worker nodes without existence of a master node in the cluster, make sure atleast one master node is commissioned or is part of the plan.")
+}
+
+// preparePhases prepares the commission of each group of nodes, in the order
+// they are commissioned in
+func (e *bulkCommissionEvent) preparePhases() error {
+	e._phases = []*commissionEvent{}
+	for _, g := range e.plan.orderedGroups() {
+		phase := newCommissionEvent(e.mgr, g.Nodes, g.ExtraVars, g.HostGroup, "", e.timeout)
+		phase.forks = e.forks
+		phase.setConnection(e.sshUser, e.sshKeyRef)
+		enodes, err := e.mgr.commonEventValidate(g.Nodes)
+		if err != nil {
+			return err
+		}
+		phase._enodes = enodes
+		if err := phase.prepareInventory(); err != nil {
+			return err
+		}
+		e._phases = append(e._phases, phase)
+	}
+	return nil
+}
+
+// bulkRunner is the job runner that commissions the groups of nodes one after
+// the other. The nodes of a phase that fails are cleaned up and, unless the
+// plan says otherwise, the later phases are skipped
+func (e *bulkCommissionEvent) bulkRunner(cancelCh CancelChannel, jobLogs io.Writer) error {
+	var firstErr error
+	for i, phase := range e._phases {
+		fmt.Fprintf(jobLogs, "==> phase %d/%d: commissioning nodes %v in host-group %q\n",
+			i+1, len(e._phases), phase.nodeNames, phase.hostGroup)
+		err := phase.configureOrCleanupOnErrorRunner(cancelCh, jobLogs)
+		if err == nil {
+			e._commissioned = append(e._commissioned, phase.nodeNames...)
+			continue
+		}
+		fmt.Fprintf(jobLogs, "==> phase %d failed. Error: %v\n", i+1, err)
+		for _, name := range phase.nodeNames {
+			e.job.failNode(name)
+		}
+		if firstErr == nil {
+			firstErr = errPhaseFailed(i+1, err)
+		}
+		if err == errJobCancelled || !e.plan.ContinueOnError {
+			e.skipPhases(e._phases[i+1:], jobLogs)
+			return firstErr
+		}
+	}
+	return firstErr
+}
+
+// skipPhases fails the nodes of the phases that are skipped
+func (e *bulkCommissionEvent) skipPhases(phases []*commissionEvent, jobLogs io.Writer) {
+	for _, phase := range phases {
+		fmt.Fprintf(jobLogs, "==> skipping the commission of nodes %v in host-group %q\n",
+			phase.nodeNames, phase.hostGroup)
+		for _, name := range phase.nodeNames {
+			e.job.failNode(name)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+// +build unittest
+
+package manager
+
+import (
+	"bytes"
+
+	"github.com/contiv/errored"
+	. "gopkg.in/check.v1"
+)
+
+type bulkCommissionSuite struct {
+}
+
+var _ = Suite(&bulkCommissionSuite{})
+
+func (s *bulkCommissionSuite) TestOrderedGroups(c *C) {
+	plan := &CommissionPlan{Groups: []CommissionPlanGroup{
+		{Nodes: []string{"node1"}, HostGroup: ansibleWorkerGroupName},
+		{Nodes: []string{"node2"}, HostGroup: ansibleMasterGroupName},
+		{Nodes: []string{"node3"}, HostGroup: ansibleWorkerGroupName},
+		{Nodes: []string{"node4"}, HostGroup: ansibleMasterGroupName},
+	}}
+	order := []string{}
+	for _, g := range plan.orderedGroups() {
+		order = append(order, g.Nodes...)
+	}
+	// the masters come first, otherwise the order of the plan is kept
+	c.Assert(order, DeepEquals, []string{"node2", "node4", "node1", "node3"})
+	c.Assert(plan.nodeNames(), DeepEquals, []string{"node1", "node2", "node3", "node4"})
+}
+
+func (s *bulkCommissionSuite) TestValidatePlan(c *C) {
+	m := &Manager{nodes: map[string]*node{}}
+	tests := map[string]struct {
+		plan     *CommissionPlan
+		exptdErr error
+	}{
+		"empty": {&CommissionPlan{}, errEmptyCommissionPlan()},
+		"node-in-several-groups": {&CommissionPlan{Groups: []CommissionPlanGroup{
+			{Nodes: []string{"node1"}, HostGroup: ansibleMasterGroupName},
+			{Nodes: []string{"node1"}, HostGroup: ansibleWorkerGroupName},
+		}}, errNodeInSeveralGroups("node1")},
+		"invalid-host-group": {&CommissionPlan{Groups: []CommissionPlanGroup{
+			{Nodes: []string{"node1"}, HostGroup: "etcd"},
+		}}, errored.Errorf("invalid or empty host-group specified: %q", "etcd")},
+	}
+	for key, test := range tests {
+		err := newBulkCommissionEvent(m, test.plan, 0).eventValidate()
+		c.Assert(err, NotNil, Commentf("key: %s", key))
+		c.Assert(err.Error(), Equals, test.exptdErr.Error(), Commentf("key: %s", key))
+	}
+}
+
+func newTestBulkCommissionEvent(cfg *fakeConfigSubsys, continueOnError bool) *bulkCommissionEvent {
+	m := &Manager{configuration: cfg}
+	e := newBulkCommissionEvent(m, &CommissionPlan{ContinueOnError: continueOnError}, 0)
+	e._phases = []*commissionEvent{
+		newCommissionEvent(m, []string{"node1"}, "", ansibleMasterGroupName, "master.yml", 0),
+		newCommissionEvent(m, []string{"node2", "node3"}, "", ansibleWorkerGroupName, "worker.yml", 0),
+	}
+	e.job = NewJob("", nil, nil)
+	e.job.setNodes([]string{"node1", "node2", "node3"})
+	return e
+}
+
+func (s *bulkCommissionSuite) TestBulkRunner(c *C) {
+	cfg := &fakeConfigSubsys{}
+	e := newTestBulkCommissionEvent(cfg, false)
+	var logs bytes.Buffer
+	c.Assert(e.bulkRunner(make(CancelChannel), &logs), IsNil)
+	c.Assert(cfg.ran, DeepEquals, []string{"master.yml", "worker.yml"})
+	c.Assert(e._commissioned, DeepEquals, []string{"node1", "node2", "node3"})
+}
+
+func (s *bulkCommissionSuite) TestBulkRunnerHaltsOnError(c *C) {
+	phaseErr := errored.Errorf("master failed")
+	cfg := &fakeConfigSubsys{errs: map[string]error{"master.yml": phaseErr}}
+	e := newTestBulkCommissionEvent(cfg, false)
+	var logs bytes.Buffer
+	err := e.bulkRunner(make(CancelChannel), &logs)
+	c.Assert(err, NotNil)
+	c.Assert(err.Error(), Equals, errPhaseFailed(1, phaseErr).Error())
+	// the failed phase is cleaned up and the later phases are skipped
+	c.Assert(cfg.ran, DeepEquals, []string{"master.yml", "cleanup"})
+	c.Assert(e._commissioned, HasLen, 0)
+	c.Assert(e.job.NodeStatus(), DeepEquals, map[string]NodeStatus{
+		"node1": NodeFailed, "node2": NodeFailed, "node3": NodeFailed})
+}
+
+func (s *bulkCommissionSuite) TestBulkRunnerContinueOnError(c *C) {
+	phaseErr := errored.Errorf("master failed")
+	cfg := &fakeConfigSubsys{errs: map[string]error{"master.yml": phaseErr}}
+	e := newTestBulkCommissionEvent(cfg, true)
+	var logs bytes.Buffer
+	err := e.bulkRunner(make(CancelChannel), &logs)
+	c.Assert(err, NotNil)
+	c.Assert(err.Error(), Equals, errPhaseFailed(1, phaseErr).Error())
+	c.Assert(cfg.ran, DeepEquals, []string{"master.yml", "cleanup", "worker.yml"})
+	c.Assert(e._commissioned, DeepEquals, []string{"node2", "node3"})
+}
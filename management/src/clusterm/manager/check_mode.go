@@ -0,0 +1,34 @@
+package manager
+
+import (
+	"github.com/contiv/cluster/management/src/configuration"
+	"github.com/contiv/errored"
+)
+
+// errCheckNotSupported is the error returned when a check mode run is requested
+// but the configuration subsystem can't run the playbooks in check mode
+func errCheckNotSupported() error {
+	return errored.Errorf("the configuration subsystem doesn't support running in check mode")
+}
+
+// validateCheck makes sure that the playbooks can be run in check mode, if requested
+func (m *Manager) validateCheck(check bool) error {
+	if !check {
+		return nil
+	}
+	if _, ok := m.configuration.(configuration.CheckModeRunner); !ok {
+		return errBadRequest(errCheckNotSupported())
+	}
+	return nil
+}
+
+// withCheck returns the configuration subsystem that runs the playbooks in
+// check mode. It fails instead of returning a subsystem that would make the
+// changes for real
+func withCheck(c configuration.Subsys) (configuration.Subsys, error) {
+	checker, ok := c.(configuration.CheckModeRunner)
+	if !ok {
+		return nil, errCheckNotSupported()
+	}
+	return checker.WithCheck(), nil
+}
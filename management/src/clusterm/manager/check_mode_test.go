@@ -0,0 +1,91 @@
+// +build unittest
+
+package manager
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+
+	"github.com/contiv/cluster/management/src/configuration"
+	"github.com/contiv/errored"
+	. "gopkg.in/check.v1"
+	"golang.org/x/net/context"
+)
+
+type checkModeSuite struct {
+}
+
+var _ = Suite(&checkModeSuite{})
+
+// fakeCheckSubsys is a fakeConfigSubsys that can run the playbooks in check
+// mode. The playbooks run in check mode are recorded with a 'check:' prefix
+type fakeCheckSubsys struct {
+	*fakeConfigSubsys
+	check bool
+}
+
+func (f *fakeCheckSubsys) WithCheck() configuration.Subsys {
+	return &fakeCheckSubsys{fakeConfigSubsys: f.fakeConfigSubsys, check: true}
+}
+
+func (f *fakeCheckSubsys) RunPlaybook(nodes configuration.SubsysHosts, playbook,
+	extraVars string) (io.Reader, context.CancelFunc, chan error) {
+	if f.check {
+		playbook = "check:" + playbook
+	}
+	return f.fakeConfigSubsys.RunPlaybook(nodes, playbook, extraVars)
+}
+
+func (s *checkModeSuite) TestValidateCheck(c *C) {
+	m := &Manager{configuration: &fakeConfigSubsys{}}
+	c.Assert(m.validateCheck(false), IsNil)
+	err := m.validateCheck(true)
+	c.Assert(err, NotNil)
+	c.Assert(httpStatus(err), Equals, http.StatusBadRequest)
+
+	m = &Manager{configuration: &fakeCheckSubsys{fakeConfigSubsys: &fakeConfigSubsys{}}}
+	c.Assert(m.validateCheck(true), IsNil)
+}
+
+func (s *checkModeSuite) TestConfigureInCheckMode(c *C) {
+	cfg := &fakeConfigSubsys{}
+	m := &Manager{configuration: &fakeCheckSubsys{fakeConfigSubsys: cfg}}
+	var logs bytes.Buffer
+	outReader, cancelFunc, errCh := configure(m.configuration, nil, "site.yml", "", true)
+	c.Assert(logOutputAndReturnStatus(outReader, errCh, make(CancelChannel), cancelFunc, &logs), IsNil)
+	outReader, cancelFunc, errCh = configure(m.configuration, nil, "site.yml", "", false)
+	c.Assert(logOutputAndReturnStatus(outReader, errCh, make(CancelChannel), cancelFunc, &logs), IsNil)
+	c.Assert(cfg.ran, DeepEquals, []string{"check:site.yml", "site.yml"})
+
+	// the playbook is not run for real, when check mode is not supported
+	cfg = &fakeConfigSubsys{}
+	m = &Manager{configuration: cfg}
+	outReader, cancelFunc, errCh = configure(m.configuration, nil, "site.yml", "", true)
+	err := logOutputAndReturnStatus(outReader, errCh, make(CancelChannel), cancelFunc, &logs)
+	c.Assert(err, NotNil)
+	c.Assert(err.Error(), Equals, errCheckNotSupported().Error())
+	c.Assert(cfg.ran, HasLen, 0)
+}
+
+func (s *checkModeSuite) TestCommissionCheckRunner(c *C) {
+	cfg := &fakeConfigSubsys{errs: map[string]error{"check:site.yml": errored.Errorf("check failed")}}
+	e := newCommissionEvent(&Manager{configuration: &fakeCheckSubsys{fakeConfigSubsys: cfg}},
+		[]string{"node1"}, "", "", "site.yml", 0)
+	e.check = true
+	// there is no cleanup on failure in check mode
+	var logs bytes.Buffer
+	c.Assert(e.runner()(make(CancelChannel), &logs), NotNil)
+	c.Assert(cfg.ran, DeepEquals, []string{"check:site.yml"})
+}
+
+func (s *checkModeSuite) TestUpdateCheckRunner(c *C) {
+	cfg := &fakeConfigSubsys{}
+	e := newUpdateEvent(&Manager{configuration: &fakeCheckSubsys{fakeConfigSubsys: cfg}},
+		[]string{"node1"}, "", "", "site.yml", 0)
+	e.check = true
+	// only the configuration playbook is run in check mode
+	var logs bytes.Buffer
+	c.Assert(e.runner()(make(CancelChannel), &logs), IsNil)
+	c.Assert(cfg.ran, DeepEquals, []string{"check:site.yml"})
+}
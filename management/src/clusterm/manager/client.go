@@ -6,60 +6,417 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/contiv/cluster/management/src/ansible"
 	"github.com/contiv/errored"
 )
 
-var httpErrorResp = func(rsrc string, req *APIRequest, status string, body []byte) error {
-	return errored.Errorf("Request URL: %s Request Body: %+v Response status: %q. Response body: %s", rsrc, req, status, body)
+var httpErrorResp = func(rsrc string, req *APIRequest, resp *http.Response, body []byte) error {
+	return newAPIError(resp, body,
+		fmt.Sprintf("Request URL: %s Request Body: %+v Response status: %q. Response body: %s", rsrc, req, resp.Status, body))
+}
+
+// APIError is the error returned by the client when cluster manager fails a
+// request. It exposes the response's status along with the error's code and
+// message, as found in a JSON error body like '{"code":"...","error":"..."}'.
+// The message is the response body as is, and the code is empty, for a plain
+// text error body.
+type APIError struct {
+	// StatusCode is the http status code of the response, like 400
+	StatusCode int `json:"-"`
+	// Code identifies the error, if the response body carries it
+	Code    string `json:"code,omitempty"`
+	Message string `json:"error"`
+	// desc describes the failed request along with it's response
+	desc string
+}
+
+// Error returns the description of the failed request along with it's response
+func (e *APIError) Error() string {
+	return e.desc
+}
+
+// The codes of the common errors that cluster manager fails the requests with.
+// They are stable, so the clients can check the Code of an APIError against them
+const (
+	// ErrCodeBadRequest is the code of a request that is not valid
+	ErrCodeBadRequest = "bad_request"
+	// ErrCodeUnknownNodes is the code of a request that specifies nodes that don't exist
+	ErrCodeUnknownNodes = "unknown_nodes"
+	// ErrCodeNodeNotFound is the code of a request for a node that doesn't exist
+	ErrCodeNodeNotFound = "node_not_found"
+	// ErrCodeRequestTooLarge is the code of a request whose body is over the size limit
+	ErrCodeRequestTooLarge = "request_too_large"
+	// ErrCodeServiceUnavailable is the code of a request that can't be served
+	// at the moment, like when the request queue is full. It can be retried
+	ErrCodeServiceUnavailable = "service_unavailable"
+	// ErrCodeConfigVersionRequired is the code of a configuration change that
+	// doesn't specify the version it is based on
+	ErrCodeConfigVersionRequired = "config_version_required"
+	// ErrCodeConfigVersionMismatch is the code of a configuration change that
+	// is based on a version other than the current one
+	ErrCodeConfigVersionMismatch = "config_version_mismatch"
+	// ErrCodeInventoryOverrideDisabled is the code of a request that specifies
+	// an inventory while the inventory override is not enabled
+	ErrCodeInventoryOverrideDisabled = "inventory_override_disabled"
+	// ErrCodeNotSupported is the code of a request that the subsystems don't support
+	ErrCodeNotSupported = "not_supported"
+)
+
+// IsAPIError checks if the error is an APIError
+func IsAPIError(err error) bool {
+	_, ok := err.(*APIError)
+	return ok
+}
+
+// newAPIError returns the APIError for the response of a failed request
+func newAPIError(resp *http.Response, body []byte, desc string) *APIError {
+	e := &APIError{StatusCode: resp.StatusCode, desc: desc}
+	trimmed := bytes.TrimSpace(body)
+	if bytes.HasPrefix(trimmed, []byte("{")) {
+		if err := json.Unmarshal(trimmed, e); err == nil && (e.Message != "" || e.Code != "") {
+			return e
+		}
+		e.Code = ""
+	}
+	e.Message = string(trimmed)
+	return e
 }
 
 // Client provides the methods for issuing post and get requests to cluster manager
 type Client struct {
 	url   string
 	httpC *http.Client
+
+	// nodesCache is the last node info received from GetAllNodes along with
+	// it's ETag, used to skip receiving the info again if it didn't change
+	nodesCacheMutex sync.Mutex
+	nodesETag       string
+	nodesCache      []byte
+
+	// idempotencyKey, when set, is sent with the POST requests
+	idempotencyKey string
+	// accept, when set, is sent as the Accept header of the GET requests
+	accept string
+	// cache, when set, caches the node info received by this client
+	cache *nodeInfoCache
+	// basePath is the path prefix that cluster manager serves the REST endpoints under, if any
+	basePath string
+}
+
+const (
+	// defaultMaxIdleConns is the number of idle connections to cluster manager,
+	// that a client keeps for reuse. As all the requests are to the same host,
+	// it's large enough for the commands that fan out requests, like for node info
+	defaultMaxIdleConns = 16
+	// defaultIdleConnTimeout is the duration after which an idle connection is closed
+	defaultIdleConnTimeout = 90 * time.Second
+)
+
+// newTransport returns a transport that keeps up to maxIdleConns idle connections
+// to cluster manager, for the specified duration. The transport honors the proxy
+// set in the environment, see WithProxy
+func newTransport(maxIdleConns int, idleConnTimeout time.Duration) *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = http.ProxyFromEnvironment
+	t.MaxIdleConns = maxIdleConns
+	t.MaxIdleConnsPerHost = maxIdleConns
+	t.IdleConnTimeout = idleConnTimeout
+	return t
 }
 
-// NewClient instantiates a REST based rpc client for cluster manager
+// defaultHTTPClient is shared by the clients of cluster manager's tcp address,
+// so that the connections are reused across the clients as well
+var defaultHTTPClient = &http.Client{Transport: newTransport(defaultMaxIdleConns, defaultIdleConnTimeout)}
+
+// NewClient instantiates a REST based rpc client for cluster manager. The url
+// is the tcp address of cluster manager, or of form 'unix:/path/to/sock' when
+// cluster manager is served on a unix socket.
+// The client reuses it's connections, the number of idle connections it keeps
+// can be tuned using WithMaxIdleConns and WithIdleConnTimeout.
+// The client of a tcp address issues it's requests through the proxy set in the
+// HTTP_PROXY and NO_PROXY environment variables, if any. Note that the requests
+// to localhost are never proxied this way, see WithProxy to use a proxy anyway.
 func NewClient(url string) *Client {
-	return &Client{url: url, httpC: http.DefaultClient}
+	path, ok := unixSocketPath(url)
+	if !ok {
+		return NewClientWithHTTPClient(url, defaultHTTPClient)
+	}
+	t := newTransport(defaultMaxIdleConns, defaultIdleConnTimeout)
+	t.Proxy = nil
+	// the default transport's DialContext takes precedence over Dial
+	t.DialContext = nil
+	t.Dial = func(_, _ string) (net.Conn, error) {
+		return net.Dial("unix", path)
+	}
+	return NewClientWithHTTPClient(url, &http.Client{Transport: t})
+}
+
+// NewClientWithHTTPClient instantiates a REST based rpc client for cluster manager
+// that uses the specified http client to issue requests. This allows using a
+// custom transport for proxies, TLS configuration or instrumentation.
+// Note that for a 'unix:' url, the http client is expected to dial the socket.
+func NewClientWithHTTPClient(url string, httpC *http.Client) *Client {
+	return &Client{url: url, httpC: httpC}
+}
+
+// WithIdempotencyKey returns a client that sends the specified idempotency key
+// with the POST requests. A request retried with the same key, like after a
+// network failure, returns the outcome of the original request instead of
+// triggering the job again.
+func (c *Client) WithIdempotencyKey(key string) *Client {
+	cc := c.clone()
+	cc.idempotencyKey = key
+	return cc
+}
+
+// WithBasePath returns a client that prefixes the url of it's requests with
+// the specified base path, like "/clusterm", that cluster manager serves the
+// REST endpoints under. See the base_path configuration of cluster manager.
+func (c *Client) WithBasePath(basePath string) *Client {
+	cc := c.clone()
+	cc.basePath = cleanBasePath(basePath)
+	return cc
+}
+
+// WithAccept returns a client that requests the GET responses in the specified
+// media type, like 'application/yaml'. The responses are JSON by default.
+func (c *Client) WithAccept(mediaType string) *Client {
+	cc := c.clone()
+	cc.accept = mediaType
+	return cc
+}
+
+// WithCache returns a client that caches the node info it receives, for the
+// specified duration. The repeated GetNode and GetAllNodes requests within the
+// duration return the cached info, without issuing a request. The cache is
+// invalidated by the POST and PUT requests issued by the client, as well as by
+// InvalidateCache.
+// Note that the cache is per client instance, it is not shared with other
+// clients, including the ones derived from the returned client using the With
+// methods. So the changes made through other clients, or by other users, are
+// seen only once the cached info expires.
+func (c *Client) WithCache(ttl time.Duration) *Client {
+	cc := c.clone()
+	cc.cache = newNodeInfoCache(ttl)
+	return cc
+}
+
+// InvalidateCache drops the node info cached by the client, if any. The
+// subsequent requests for node info are issued to cluster manager.
+func (c *Client) InvalidateCache() {
+	c.cache.invalidate()
+}
+
+// clone returns a copy of the client. The copy has it's own cache, if the
+// client has one
+func (c *Client) clone() *Client {
+	cc := &Client{url: c.url, httpC: c.httpC, idempotencyKey: c.idempotencyKey, accept: c.accept,
+		basePath: c.basePath}
+	if c.cache != nil {
+		cc.cache = newNodeInfoCache(c.cache.ttl)
+	}
+	return cc
+}
+
+// WithMaxIdleConns returns a client that keeps up to the specified number of
+// idle connections to cluster manager for reuse. It has no effect on a client
+// with a custom transport, see NewClientWithHTTPClient.
+func (c *Client) WithMaxIdleConns(n int) *Client {
+	return c.withTransport(func(t *http.Transport) {
+		t.MaxIdleConns = n
+		t.MaxIdleConnsPerHost = n
+	})
+}
+
+// WithIdleConnTimeout returns a client that closes it's idle connections to
+// cluster manager after the specified duration. It has no effect on a client
+// with a custom transport, see NewClientWithHTTPClient.
+func (c *Client) WithIdleConnTimeout(d time.Duration) *Client {
+	return c.withTransport(func(t *http.Transport) {
+		t.IdleConnTimeout = d
+	})
+}
+
+// WithProxy returns a client that issues it's requests through the HTTP proxy
+// at the specified url, like 'http://proxy:3128', instead of the proxy set in
+// the environment. An empty url disables the proxy. Like the other transport
+// options, it has no effect on a client with a custom transport that is not an
+// *http.Transport. For a custom transport with TLS configuration, the TLS
+// configuration is kept and applies to the connections to an 'https' proxy.
+// It has no effect on the client of a unix socket either.
+func (c *Client) WithProxy(proxyURL string) *Client {
+	if _, ok := unixSocketPath(c.url); ok {
+		return c.clone()
+	}
+	proxy := func(*http.Request) (*url.URL, error) { return nil, nil }
+	if proxyURL != "" {
+		u, err := url.Parse(proxyURL)
+		if err != nil || u.Host == "" {
+			// the requests fail, instead of silently bypassing the proxy
+			proxy = func(*http.Request) (*url.URL, error) { return nil, errInvalidProxy(proxyURL) }
+		} else {
+			proxy = http.ProxyURL(u)
+		}
+	}
+	return c.withTransport(func(t *http.Transport) {
+		t.Proxy = proxy
+	})
+}
+
+func errInvalidProxy(proxyURL string) error {
+	return errored.Errorf("invalid proxy url: %q", proxyURL)
+}
+
+// withTransport returns a client with a copy of the receiver's transport, that
+// is tuned by the specified function. The returned client doesn't share the
+// connections with the receiver.
+func (c *Client) withTransport(tune func(t *http.Transport)) *Client {
+	rt := c.httpC.Transport
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	httpC := *c.httpC
+	if t, ok := rt.(*http.Transport); ok {
+		t = t.Clone()
+		tune(t)
+		httpC.Transport = t
+	}
+	cc := c.clone()
+	cc.httpC = &httpC
+	return cc
+}
+
+// newGetRequest returns a GET request for the specified resource
+func (c *Client) newGetRequest(rsrc string) (*http.Request, error) {
+	httpReq, err := http.NewRequest("GET", c.formURL(rsrc), nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.accept != "" {
+		httpReq.Header.Set("Accept", c.accept)
+	}
+	return httpReq, nil
 }
 
 func (c *Client) formURL(rsrc string) string {
-	return fmt.Sprintf("http://%s/%s", c.url, rsrc)
+	host := urlHost(c.url)
+	if _, ok := unixSocketPath(c.url); ok {
+		// the host is not used for dialing a unix socket but is needed to form a valid url
+		host = "localhost"
+	}
+	return fmt.Sprintf("http://%s%s/%s", host, c.basePath, rsrc)
 }
 
 func (c *Client) doPost(rsrc string, req *APIRequest) error {
+	_, err := c.doPostWithResponse(rsrc, req)
+	return err
+}
+
+// doPostWithResponse issues a POST request and returns the response body
+func (c *Client) doPostWithResponse(rsrc string, req *APIRequest) ([]byte, error) {
+	return c.doRequestWithResponse("POST", rsrc, req)
+}
+
+// doPut issues a PUT request
+func (c *Client) doPut(rsrc string, req *APIRequest) error {
+	_, err := c.doRequestWithResponse("PUT", rsrc, req)
+	return err
+}
+
+// doRequestWithResponse issues a request, with the specified method and a
+// json body, and returns the response body
+func (c *Client) doRequestWithResponse(method, rsrc string, req *APIRequest) ([]byte, error) {
+	resp, body, err := c.doRequest(method, rsrc, req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
+		return nil, httpErrorResp(rsrc, req, resp, body)
+	}
+	return body, nil
+}
 
+// doRequest issues a request, with the specified method and a json body, and
+// returns the response along with it's body
+func (c *Client) doRequest(method, rsrc string, req *APIRequest) (*http.Response, []byte, error) {
 	var reqJSON bytes.Buffer
 	if err := json.NewEncoder(&reqJSON).Encode(req); err != nil {
-		return err
+		return nil, nil, err
 	}
 
-	var (
-		resp *http.Response
-		err  error
-	)
-	resp, err = c.httpC.Post(c.formURL(rsrc), "application/json", &reqJSON)
-	defer resp.Body.Close()
+	httpReq, err := http.NewRequest(method, c.formURL(rsrc), &reqJSON)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if c.idempotencyKey != "" {
+		httpReq.Header.Set(idempotencyKeyHeader, c.idempotencyKey)
+	}
+	resp, err := c.httpC.Do(httpReq)
+	// the request may have changed the nodes, even if it's response is not received
+	c.InvalidateCache()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			body = []byte{}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
+			// report the failed request even if it's body can't be read
+			return resp, []byte{}, nil
 		}
-		return httpErrorResp(rsrc, req, resp.Status, body)
+		return nil, nil, err
+	}
+	return resp, body, nil
+}
+
+// doPostJob issues a POST request that triggers a job and returns the id of
+// the job. The id is empty if the request didn't trigger a job
+func (c *Client) doPostJob(rsrc string, req *APIRequest) (string, error) {
+	body, err := c.doPostWithResponse(rsrc, req)
+	if err != nil {
+		return "", err
 	}
+	return jobIDFromResponse(body)
+}
+
+// doPostAsync issues an async POST request and returns the id of the job that
+// the request triggers
+func (c *Client) doPostAsync(rsrc string, req *APIRequest) (string, error) {
+	return c.doPostJob(rsrc+"?async=true", req)
+}
 
-	return nil
+// jobIDFromResponse returns the id of the job from the job reference in the
+// response body, if any
+func jobIDFromResponse(body []byte) (string, error) {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return "", nil
+	}
+	ref := JobRef{}
+	if err := json.Unmarshal(body, &ref); err != nil {
+		return "", err
+	}
+	return ref.ID, nil
 }
 
+// doGet issues a GET request for the specified resource. Note that the
+// http transport requests a gzip encoded response and transparently
+// decompresses it, as long as the Accept-Encoding header is not set here.
 func (c *Client) doGet(rsrc string) (io.ReadCloser, error) {
-	resp, err := c.httpC.Get(c.formURL(rsrc))
+	httpReq, err := c.newGetRequest(rsrc)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.httpC.Do(httpReq)
 	if err != nil {
 		return nil, err
 	}
@@ -70,150 +427,1163 @@ func (c *Client) doGet(rsrc string) (io.ReadCloser, error) {
 			body = []byte{}
 		}
 		resp.Body.Close()
-		return nil, httpErrorResp(rsrc, nil, resp.Status, body)
+		return nil, httpErrorResp(rsrc, nil, resp, body)
 	}
 
 	return resp.Body, nil
 }
 
 // PostNodeCommission posts the request to commission a node
-func (c *Client) PostNodeCommission(nodeName, extraVars, hostGroup string) error {
+func (c *Client) PostNodeCommission(nodeName, extraVars, hostGroup string) (string, error) {
 	req := &APIRequest{
 		Nodes:     []string{nodeName},
 		HostGroup: hostGroup,
 		ExtraVars: extraVars,
 	}
-	return c.doPost(PostNodesCommission, req)
+	return c.doPostJob(PostNodesCommission, req)
 }
 
 // PostNodesCommission posts the request to commission a set of nodes
-func (c *Client) PostNodesCommission(nodeNames []string, extraVars, hostGroup string) error {
+func (c *Client) PostNodesCommission(nodeNames []string, extraVars, hostGroup string) (string, error) {
 	req := &APIRequest{
 		Nodes:     nodeNames,
 		HostGroup: hostGroup,
 		ExtraVars: extraVars,
 	}
-	return c.doPost(PostNodesCommission, req)
+	return c.doPostJob(PostNodesCommission, req)
 }
 
-// PostNodeDecommission posts the request to decommission a node
-func (c *Client) PostNodeDecommission(nodeName, extraVars string) error {
+// PostNodesCommissionWaitReady posts the request to commission a set of nodes.
+// If waitReady is true, the triggered job completes only after the nodes are
+// part of the cluster, as seen by the monitoring subsystem, or fails for the
+// nodes that don't join within the ready timeout. The default timeout is used
+// if readyTimeout is empty.
+func (c *Client) PostNodesCommissionWaitReady(nodeNames []string, extraVars, hostGroup string,
+	waitReady bool, readyTimeout string) (string, error) {
 	req := &APIRequest{
-		Nodes:     []string{nodeName},
+		Nodes:         nodeNames,
+		HostGroup:     hostGroup,
+		ExtraVars:     extraVars,
+		WaitReady:     waitReady,
+		RejoinTimeout: readyTimeout,
+	}
+	return c.doPostJob(PostNodesCommission, req)
+}
+
+// PostNodesCommissionWithVerify posts the request to commission a set of nodes,
+// specifying whether the nodes shall be verified once they are configured. If
+// verifyPlaybook is empty, the nodes are verified with the configured playbook.
+// The nodes that fail the verification are reported as such in the job.
+func (c *Client) PostNodesCommissionWithVerify(nodeNames []string, extraVars, hostGroup string,
+	verify bool, verifyPlaybook string) (string, error) {
+	req := &APIRequest{
+		Nodes:          nodeNames,
+		HostGroup:      hostGroup,
+		ExtraVars:      extraVars,
+		Verify:         &verify,
+		VerifyPlaybook: verifyPlaybook,
+	}
+	return c.doPostJob(PostNodesCommission, req)
+}
+
+// PostNodesCommissionGroups posts the request to commission a set of nodes
+// that belong to several host-groups, like a node that is both a master and a
+// worker. The nodes are listed under each of the groups in ansible's inventory.
+func (c *Client) PostNodesCommissionGroups(nodeNames []string, extraVars string, hostGroups []string) (string, error) {
+	req := &APIRequest{
+		Nodes:      nodeNames,
+		ExtraVars:  extraVars,
+		HostGroups: hostGroups,
+	}
+	return c.doPostJob(PostNodesCommission, req)
+}
+
+// PostNodesCommissionWithForks posts the request to commission a set of nodes,
+// configuring at most forks nodes in parallel
+func (c *Client) PostNodesCommissionWithForks(nodeNames []string, extraVars, hostGroup string, forks int) (string, error) {
+	req := &APIRequest{
+		Nodes:     nodeNames,
+		HostGroup: hostGroup,
 		ExtraVars: extraVars,
+		Forks:     forks,
 	}
-	return c.doPost(PostNodesDecommission, req)
+	return c.doPostJob(PostNodesCommission, req)
 }
 
-// PostNodesDecommission posts the request to decommission a set of nodes
-func (c *Client) PostNodesDecommission(nodeNames []string, extraVars string) error {
+// PostNodesCommissionWithConnection posts the request to commission a set of
+// nodes, connecting to them as sshUser with the key that sshKeyRef names in the
+// keystore. The configured user or key is used if the respective one is empty
+func (c *Client) PostNodesCommissionWithConnection(nodeNames []string, extraVars, hostGroup,
+	sshUser, sshKeyRef string) (string, error) {
 	req := &APIRequest{
 		Nodes:     nodeNames,
+		HostGroup: hostGroup,
 		ExtraVars: extraVars,
+		SSHUser:   sshUser,
+		SSHKeyRef: sshKeyRef,
 	}
-	return c.doPost(PostNodesDecommission, req)
+	return c.doPostJob(PostNodesCommission, req)
 }
 
-// PostNodeUpdate posts the request to update a node and optionally change
-// it's host-group when it is specified.
-func (c *Client) PostNodeUpdate(nodeName, extraVars, hostGroup string) error {
+// PostNodesCommissionBySerial posts the request to commission a set of nodes,
+// that are identified by their serial number instead of their name. The
+// request fails if a serial doesn't match exactly one known node
+func (c *Client) PostNodesCommissionBySerial(serials []string, extraVars, hostGroup string) (string, error) {
 	req := &APIRequest{
-		Nodes:     []string{nodeName},
+		Serials:   serials,
+		HostGroup: hostGroup,
 		ExtraVars: extraVars,
+	}
+	return c.doPostJob(PostNodesCommission, req)
+}
+
+// PostNodesCommissionWithPreflight posts the request to commission a set of
+// nodes, after checking that their management address is reachable. The request
+// fails with a NodesError listing the unreachable nodes, unless continueOnError
+// is true, in which case they are skipped and the rest are commissioned. The
+// result of the check is reported in the job's summary. If any node fails the
+// check, the returned error is a *NodesError that reports the outcome for every node.
+func (c *Client) PostNodesCommissionWithPreflight(nodeNames []string, extraVars, hostGroup string,
+	continueOnError bool) (string, error) {
+	req := &APIRequest{
+		Nodes:           nodeNames,
+		HostGroup:       hostGroup,
+		ExtraVars:       extraVars,
+		Preflight:       true,
+		ContinueOnError: continueOnError,
+	}
+	resp, body, err := c.doRequest("POST", PostNodesCommission, req)
+	if err != nil {
+		return "", err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusAccepted:
+		return jobIDFromResponse(body)
+	case http.StatusMultiStatus, http.StatusConflict:
+		nerr := &NodesError{}
+		if err := json.Unmarshal(body, nerr); err == nil {
+			return nerr.JobID, nerr
+		}
+	}
+	return "", httpErrorResp(PostNodesCommission, req, resp, body)
+}
+
+// PostNodesCommissionCheck posts the request to run the commission of a set of
+// nodes in check mode. The nodes are left as is and the changes that the
+// commission would make are reported as the plan of the job
+func (c *Client) PostNodesCommissionCheck(nodeNames []string, extraVars, hostGroup string) (string, error) {
+	req := &APIRequest{
+		Nodes:     nodeNames,
 		HostGroup: hostGroup,
+		ExtraVars: extraVars,
+		Check:     true,
 	}
-	return c.doPost(PostNodesUpdate, req)
+	return c.doPostJob(PostNodesCommission, req)
 }
 
-// PostNodesUpdate posts the request to update a set of node and optionally change
-// their host-group when it is specified.
-func (c *Client) PostNodesUpdate(nodeNames []string, extraVars, hostGroup string) error {
+// PostNodesCommissionWithPlaybook posts the request to commission a set of nodes
+// using the specified playbook instead of the default configuration playbook
+func (c *Client) PostNodesCommissionWithPlaybook(nodeNames []string, extraVars, hostGroup, playbook string) (string, error) {
 	req := &APIRequest{
 		Nodes:     nodeNames,
+		HostGroup: hostGroup,
 		ExtraVars: extraVars,
+		Playbook:  playbook,
+	}
+	return c.doPostJob(PostNodesCommission, req)
+}
+
+// PostNodesCommissionAsync posts the request to commission a set of nodes, without
+// waiting for the commission job to start. It returns the id of the job, that can
+// be used as the job label to poll the job's status
+func (c *Client) PostNodesCommissionAsync(nodeNames []string, extraVars, hostGroup string) (string, error) {
+	req := &APIRequest{
+		Nodes:     nodeNames,
 		HostGroup: hostGroup,
+		ExtraVars: extraVars,
 	}
-	return c.doPost(PostNodesUpdate, req)
+	return c.doPostAsync(PostNodesCommission, req)
 }
 
-// PostNodesDiscover posts the request to provision a set of nodes for discovery
-func (c *Client) PostNodesDiscover(nodeAddrs []string, extraVars string) error {
+// PostNodesUpdateAt posts the request to update a set of nodes at the specified
+// time, like in a maintenance window. It returns the id of the scheduled job,
+// that can be cancelled until it runs.
+func (c *Client) PostNodesUpdateAt(nodeNames []string, extraVars, hostGroup string, runAt time.Time) (string, error) {
 	req := &APIRequest{
-		Addrs:     nodeAddrs,
+		Nodes:     nodeNames,
 		ExtraVars: extraVars,
+		HostGroup: hostGroup,
+		RunAt:     runAt.Format(time.RFC3339),
 	}
-	return c.doPost(PostNodesDiscover, req)
+	return c.doPostAsync(PostNodesUpdate, req)
 }
 
-// PostGlobals posts the request to set global extra vars
-func (c *Client) PostGlobals(extraVars string) error {
+// PostNodeDecommission posts the request to decommission a node
+func (c *Client) PostNodeDecommission(nodeName, extraVars string) (string, error) {
 	req := &APIRequest{
+		Nodes:     []string{nodeName},
 		ExtraVars: extraVars,
 	}
-	return c.doPost(PostGlobals, req)
+	return c.doPostDecommission(req)
 }
 
-// PostMonitorEvent posts a monitor event for one or more nodes.
-func (c *Client) PostMonitorEvent(event string, nodes []MonitorNode) error {
+// PostNodesCommissionBulk posts the request to commission the groups of nodes
+// in the plan, one group after the other with the masters first. The groups
+// are commissioned as a single job, whose id is returned
+func (c *Client) PostNodesCommissionBulk(plan *CommissionPlan) (string, error) {
 	req := &APIRequest{
-		Event: MonitorEvent{
-			Name:  event,
-			Nodes: nodes,
-		},
+		CommissionPlan: plan,
 	}
-	return c.doPost(PostMonitorEvent, req)
+	return c.doPostJob(PostNodesCommissionBulk, req)
 }
 
-// PostConfig posts the request to set clusterm configuration
-func (c *Client) PostConfig(config *Config) error {
+// PostNodesDecommissionWithDrain posts the request to decommission a set of nodes,
+// specifying whether the nodes shall be drained first and the drain timeout, like
+// "10m". An empty drain timeout means no timeout for draining the nodes
+func (c *Client) PostNodesDecommissionWithDrain(nodeNames []string, extraVars string, drain bool,
+	drainTimeout string) (string, error) {
 	req := &APIRequest{
-		Config: config,
+		Nodes:        nodeNames,
+		ExtraVars:    extraVars,
+		Drain:        &drain,
+		DrainTimeout: drainTimeout,
 	}
-	return c.doPost(GetPostConfig, req)
+	return c.doPostDecommission(req)
 }
 
-func (c *Client) readAll(rsrc string) ([]byte, error) {
-	resp, err := c.doGet(rsrc)
+// DecommissionImpact posts the request to get the impact of decommissioning a
+// set of nodes, like the host-groups that lose members. The nodes are not
+// decommissioned
+func (c *Client) DecommissionImpact(nodeNames []string) (*DecommissionImpact, error) {
+	req := &APIRequest{
+		Nodes: nodeNames,
+	}
+	body, err := c.doPostWithResponse(PostNodesDecommissionImpact, req)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Close()
+	impact := &DecommissionImpact{}
+	if err := json.Unmarshal(body, impact); err != nil {
+		return nil, err
+	}
+	return impact, nil
+}
 
-	body, err := ioutil.ReadAll(resp)
+// PostNodesDecommission posts the request to decommission a set of nodes. If
+// the nodes include the last master node of the cluster, the returned error is
+// a *LastMasterError, see PostNodesDecommissionForce
+func (c *Client) PostNodesDecommission(nodeNames []string, extraVars string) (string, error) {
+	req := &APIRequest{
+		Nodes:     nodeNames,
+		ExtraVars: extraVars,
+	}
+	return c.doPostDecommission(req)
+}
+
+// PostNodesDecommissionForce posts the request to decommission a set of nodes,
+// even if they include the last master node of the cluster, like when tearing
+// the cluster down
+func (c *Client) PostNodesDecommissionForce(nodeNames []string, extraVars string) (string, error) {
+	req := &APIRequest{
+		Nodes:     nodeNames,
+		ExtraVars: extraVars,
+		Force:     true,
+	}
+	return c.doPostDecommission(req)
+}
+
+// doPostDecommission posts a decommission request and returns the id of the
+// triggered job. The refusal to decommission the last master node is returned
+// as a *LastMasterError
+func (c *Client) doPostDecommission(req *APIRequest) (string, error) {
+	resp, body, err := c.doRequest("POST", PostNodesDecommission, req)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
-	return body, err
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusAccepted:
+		return jobIDFromResponse(body)
+	case http.StatusPreconditionFailed:
+		return "", &LastMasterError{desc: strings.TrimSpace(string(body))}
+	}
+	return "", httpErrorResp(PostNodesDecommission, req, resp, body)
 }
 
-// GetNode requests info of a specified node
-func (c *Client) GetNode(nodeName string) ([]byte, error) {
-	return c.readAll(fmt.Sprintf("%s/%s", GetNodeInfoPrefix, nodeName))
+// PostNodesDecommissionAndRemove posts the request to decommission a set of
+// nodes and remove them from the inventory once they are cleaned up, like
+// before re-imaging them. The nodes are known afresh if they are discovered again
+func (c *Client) PostNodesDecommissionAndRemove(nodeNames []string, extraVars string) (string, error) {
+	req := &APIRequest{
+		Nodes:     nodeNames,
+		ExtraVars: extraVars,
+		Remove:    true,
+	}
+	return c.doPostDecommission(req)
 }
 
-// GetAllNodes requests info of all known nodes
-func (c *Client) GetAllNodes() ([]byte, error) {
-	return c.readAll(GetNodesInfo)
+// PostNodesDecommissionContinueOnError posts the request to decommission a set
+// of nodes, skipping the nodes that can't be decommissioned instead of failing
+// for all of them. If any node is skipped, the returned error is a *NodesError
+// that reports the outcome for every node.
+func (c *Client) PostNodesDecommissionContinueOnError(nodeNames []string, extraVars string) (string, error) {
+	req := &APIRequest{
+		Nodes:           nodeNames,
+		ExtraVars:       extraVars,
+		ContinueOnError: true,
+	}
+	resp, body, err := c.doRequest("POST", PostNodesDecommission, req)
+	if err != nil {
+		return "", err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusAccepted:
+		return jobIDFromResponse(body)
+	case http.StatusMultiStatus, http.StatusConflict:
+		nerr := &NodesError{}
+		if err := json.Unmarshal(body, nerr); err == nil {
+			return nerr.JobID, nerr
+		}
+	case http.StatusPreconditionFailed:
+		return "", &LastMasterError{desc: strings.TrimSpace(string(body))}
+	}
+	return "", httpErrorResp(PostNodesDecommission, req, resp, body)
 }
 
-// GetGlobals requests the value global extra vars
-func (c *Client) GetGlobals() ([]byte, error) {
-	return c.readAll(GetGlobals)
+// PostNodesReboot posts the request to reboot a set of nodes. If waitRejoin is
+// true, the triggered job completes only after the nodes rejoin the cluster
+func (c *Client) PostNodesReboot(nodeNames []string, extraVars string, waitRejoin bool) (string, error) {
+	req := &APIRequest{
+		Nodes:      nodeNames,
+		ExtraVars:  extraVars,
+		WaitRejoin: waitRejoin,
+	}
+	return c.doPostJob(PostNodesReboot, req)
 }
 
-// GetConfig requests the value of current clusterm configuration
-func (c *Client) GetConfig() ([]byte, error) {
-	return c.readAll(GetPostConfig)
+// SetNodeAnnotations adds or updates the annotations of a node. The existing
+// annotations with other keys are left as is.
+func (c *Client) SetNodeAnnotations(nodeName string, annotations map[string]string) error {
+	req := &APIRequest{
+		Annotations: annotations,
+	}
+	return c.doPost(fmt.Sprintf("%s/%s", PostDeleteNodeAnnotationsPrefix, nodeName), req)
 }
 
-// GetJob requests the info of a provisioning job specified by jobLabel.
-// Accepted values of jobLabel are "active" and "last"
-func (c *Client) GetJob(jobLabel string) ([]byte, error) {
-	return c.readAll(fmt.Sprintf("%s/%s", GetJobPrefix, jobLabel))
+// SetNodeMaintenance puts a node in maintenance, or takes it out of it. The
+// nodes in maintenance are left as is by the monitoring events and are not
+// selected by node selectors
+func (c *Client) SetNodeMaintenance(nodeName string, maintenance bool) error {
+	req := &APIRequest{
+		Maintenance: &maintenance,
+	}
+	return c.doPost(fmt.Sprintf("%s/%s", PostNodeMaintenancePrefix, nodeName), req)
 }
 
-// StreamLogs requests the log stream of a provisioning job specified by jobLabel.
-// It is caller's responsibility to Close the returned stream
-func (c *Client) StreamLogs(jobLabel string) (io.ReadCloser, error) {
-	return c.doGet(fmt.Sprintf("%s/%s", GetJobLogPrefix, jobLabel))
+// SetNodeLabels sets the labels of a node, replacing the existing ones. The
+// labels select the node, like the tags. All labels of the node are deleted
+// if no labels are specified.
+func (c *Client) SetNodeLabels(nodeName string, labels map[string]string) error {
+	req := &APIRequest{
+		Labels: labels,
+	}
+	return c.doPut(fmt.Sprintf("%s/%s", PutNodeLabelsPrefix, nodeName), req)
+}
+
+// MergeNodeLabels adds or updates the labels of a node. The existing labels
+// with other keys are left as is.
+func (c *Client) MergeNodeLabels(nodeName string, labels map[string]string) error {
+	req := &APIRequest{
+		Labels:      labels,
+		MergeLabels: true,
+	}
+	return c.doPut(fmt.Sprintf("%s/%s", PutNodeLabelsPrefix, nodeName), req)
+}
+
+// DeleteNodeAnnotations deletes the annotations of a node with the specified
+// keys. All annotations of the node are deleted if no keys are specified.
+func (c *Client) DeleteNodeAnnotations(nodeName string, keys []string) error {
+	req := &APIRequest{
+		AnnotationKeys: keys,
+	}
+	_, err := c.doRequestWithResponse("DELETE",
+		fmt.Sprintf("%s/%s", PostDeleteNodeAnnotationsPrefix, nodeName), req)
+	return err
+}
+
+// SetLogLevel sets the log level of clusterm, like "debug", at runtime
+func (c *Client) SetLogLevel(level string) error {
+	req := &APIRequest{
+		Level: level,
+	}
+	return c.doPut(GetPutLogLevel, req)
+}
+
+// PostNodeUpdate posts the request to update a node and optionally change
+// it's host-group when it is specified.
+func (c *Client) PostNodeUpdate(nodeName, extraVars, hostGroup string) (string, error) {
+	req := &APIRequest{
+		Nodes:     []string{nodeName},
+		ExtraVars: extraVars,
+		HostGroup: hostGroup,
+	}
+	return c.doPostJob(PostNodesUpdate, req)
+}
+
+// PostNodesUpdate posts the request to update a set of node and optionally change
+// their host-group when it is specified.
+func (c *Client) PostNodesUpdate(nodeNames []string, extraVars, hostGroup string) (string, error) {
+	req := &APIRequest{
+		Nodes:     nodeNames,
+		ExtraVars: extraVars,
+		HostGroup: hostGroup,
+	}
+	return c.doPostJob(PostNodesUpdate, req)
+}
+
+// PostNodesUpdateCheck posts the request to run the update of a set of nodes in
+// check mode. The nodes are left as is and the changes that the update would
+// make are reported as the plan of the job
+func (c *Client) PostNodesUpdateCheck(nodeNames []string, extraVars, hostGroup string) (string, error) {
+	req := &APIRequest{
+		Nodes:     nodeNames,
+		ExtraVars: extraVars,
+		HostGroup: hostGroup,
+		Check:     true,
+	}
+	return c.doPostJob(PostNodesUpdate, req)
+}
+
+// PostNodesUpgrade posts the request to upgrade a set of nodes to the specified version
+func (c *Client) PostNodesUpgrade(nodeNames []string, version, hostGroup string) (string, error) {
+	req := &APIRequest{
+		Nodes:     nodeNames,
+		Version:   version,
+		HostGroup: hostGroup,
+	}
+	return c.doPostJob(PostNodesUpgrade, req)
+}
+
+// PostNodesUpdateBySelector posts the request to update the nodes selected by
+// their tags or annotations, like 'rack=r1,role=worker'
+func (c *Client) PostNodesUpdateBySelector(selector, extraVars, hostGroup string) (string, error) {
+	req := &APIRequest{
+		Selector:  selector,
+		ExtraVars: extraVars,
+		HostGroup: hostGroup,
+	}
+	return c.doPostJob(PostNodesUpdate, req)
+}
+
+// PostNodesUpdateWithPlaybook posts the request to update a set of nodes using
+// the specified playbook instead of the default configuration playbook
+func (c *Client) PostNodesUpdateWithPlaybook(nodeNames []string, extraVars, hostGroup, playbook string) (string, error) {
+	req := &APIRequest{
+		Nodes:     nodeNames,
+		ExtraVars: extraVars,
+		HostGroup: hostGroup,
+		Playbook:  playbook,
+	}
+	return c.doPostJob(PostNodesUpdate, req)
+}
+
+// PostNodesDiscover posts the request to provision a set of nodes for discovery
+func (c *Client) PostNodesDiscover(nodeAddrs []string, extraVars string) (string, error) {
+	req := &APIRequest{
+		Addrs:     nodeAddrs,
+		ExtraVars: extraVars,
+	}
+	return c.doPostJob(PostNodesDiscover, req)
+}
+
+// PostNodesDiscoverWithResult posts the request to provision a set of nodes for
+// discovery and returns the reference to the triggered job, along with the
+// addresses that are discovered afresh, the ones of the known nodes that are
+// updated and the ones that are skipped as duplicates
+func (c *Client) PostNodesDiscoverWithResult(nodeAddrs []string, extraVars string) (*JobRef, error) {
+	req := &APIRequest{
+		Addrs:     nodeAddrs,
+		ExtraVars: extraVars,
+	}
+	body, err := c.doPostWithResponse(PostNodesDiscover, req)
+	if err != nil {
+		return nil, err
+	}
+	ref := &JobRef{}
+	if err := json.Unmarshal(body, ref); err != nil {
+		return nil, err
+	}
+	return ref, nil
+}
+
+// PostNodesDiscoverWithConnectTimeout posts the request to provision a set of
+// nodes for discovery. The addresses that can't be connected to within the
+// connect timeout are skipped and reported as unreachable in the job's recap.
+// The default timeout is used if connectTimeout is empty.
+func (c *Client) PostNodesDiscoverWithConnectTimeout(nodeAddrs []string, extraVars,
+	connectTimeout string) (string, error) {
+	req := &APIRequest{
+		Addrs:          nodeAddrs,
+		ExtraVars:      extraVars,
+		ConnectTimeout: connectTimeout,
+	}
+	return c.doPostJob(PostNodesDiscover, req)
+}
+
+// PostNodesDiscoverWithConnection posts the request to provision a set of nodes
+// for discovery, connecting to them as sshUser with the key that sshKeyRef
+// names in the keystore. The configured user or key is used if the respective
+// one is empty
+func (c *Client) PostNodesDiscoverWithConnection(nodeAddrs []string, extraVars,
+	sshUser, sshKeyRef string) (string, error) {
+	req := &APIRequest{
+		Addrs:     nodeAddrs,
+		ExtraVars: extraVars,
+		SSHUser:   sshUser,
+		SSHKeyRef: sshKeyRef,
+	}
+	return c.doPostJob(PostNodesDiscover, req)
+}
+
+// RediscoverNode posts the request to discover a known node again, at it's
+// known mgmt address. The node's record is updated once it's discovered
+func (c *Client) RediscoverNode(nodeName string) (string, error) {
+	return c.RediscoverNodeAt(nodeName, "")
+}
+
+// RediscoverNodeAt posts the request to discover a known node again, at the
+// specified mgmt address, like when the node's address changed. The node is
+// discovered at it's known address if addr is empty
+func (c *Client) RediscoverNodeAt(nodeName, addr string) (string, error) {
+	req := &APIRequest{}
+	if addr != "" {
+		req.Addrs = []string{addr}
+	}
+	return c.doPostJob(fmt.Sprintf("%s/%s", PostNodeRediscoverPrefix, nodeName), req)
+}
+
+// PostGlobals posts the request to set global extra vars
+func (c *Client) PostGlobals(extraVars string) error {
+	req := &APIRequest{
+		ExtraVars: extraVars,
+	}
+	return c.doPost(PostGlobals, req)
+}
+
+// ValidateGlobals posts the request to validate the global extra vars without
+// setting them. The problems found with them, if any, are reported
+func (c *Client) ValidateGlobals(extraVars string) (*GlobalsValidationReport, error) {
+	req := &APIRequest{
+		ExtraVars: extraVars,
+	}
+	body, err := c.doPostWithResponse(PostGlobalsValidate, req)
+	if err != nil {
+		return nil, err
+	}
+	report := &GlobalsValidationReport{}
+	if err := json.Unmarshal(body, report); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// PostMonitorEvent posts a monitor event for one or more nodes. It returns
+// before the event is processed.
+func (c *Client) PostMonitorEvent(event string, nodes []MonitorNode) error {
+	req := &APIRequest{
+		Event: MonitorEvent{
+			Name:  event,
+			Nodes: nodes,
+		},
+	}
+	return c.doPost(PostMonitorEvent, req)
+}
+
+// PostMonitorEventAndWait posts a monitor event for one or more nodes and waits
+// for it to be processed. It returns the error in processing the event, if any.
+func (c *Client) PostMonitorEventAndWait(event string, nodes []MonitorNode) error {
+	req := &APIRequest{
+		Event: MonitorEvent{
+			Name:  event,
+			Nodes: nodes,
+		},
+	}
+	return c.doPost(PostMonitorEvent+"?wait=true", req)
+}
+
+// RetryFailedNodes posts the request to retry a provisioning job, specified by jobLabel,
+// on the nodes that failed in that job. Accepted value of jobLabel is "last"
+func (c *Client) RetryFailedNodes(jobLabel string) (string, error) {
+	return c.doPostJob(fmt.Sprintf("%s/%s", PostJobRetryPrefix, jobLabel), &APIRequest{})
+}
+
+// CancelScheduledJob posts the request to cancel a scheduled job, specified by
+// it's id, before it runs
+func (c *Client) CancelScheduledJob(jobLabel string) error {
+	return c.doPost(fmt.Sprintf("%s/%s", PostJobCancelPrefix, jobLabel), &APIRequest{})
+}
+
+// CancelJob requests to cancel a job, specified by jobLabel. A scheduled job is
+// cancelled before it runs and the playbook of a running job is terminated.
+// jobLabel can be 'active' or a job id
+func (c *Client) CancelJob(jobLabel string) error {
+	_, err := c.doRequestWithResponse("DELETE", fmt.Sprintf("%s/%s", GetJobPrefix, jobLabel), &APIRequest{})
+	return err
+}
+
+// PostConfig posts the request to set clusterm configuration. The version is
+// the version of the configuration, as returned by GetConfigWithVersion, that
+// the configuration is based on. The request fails with a '409 Conflict' if
+// the configuration has changed since
+func (c *Client) PostConfig(config *Config, version uint64) error {
+	req := &APIRequest{
+		Config:        config,
+		ConfigVersion: &version,
+	}
+	return c.doPost(GetPostConfig, req)
+}
+
+// ValidateConfig posts the request to validate a clusterm configuration without
+// applying it. A configuration that fails the validation is reported as a
+// *ConfigValidationError
+func (c *Client) ValidateConfig(config *Config) error {
+	req := &APIRequest{
+		Config: config,
+	}
+	resp, body, err := c.doRequest("POST", PostConfigValidate, req)
+	if err != nil {
+		return err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusBadRequest:
+		verr := &ConfigValidationError{}
+		if err := json.Unmarshal(body, verr); err == nil && verr.Message != "" {
+			return verr
+		}
+	}
+	return httpErrorResp(PostConfigValidate, req, resp, body)
+}
+
+// DiffConfig posts the request to get the changes that a clusterm configuration
+// makes to the current configuration, without applying it
+func (c *Client) DiffConfig(config *Config) ([]ConfigChange, error) {
+	req := &APIRequest{
+		Config: config,
+	}
+	body, err := c.doPostWithResponse(PostConfigDiff, req)
+	if err != nil {
+		return nil, err
+	}
+	changes := []ConfigChange{}
+	if err := json.Unmarshal(body, &changes); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// ExportInventory requests the info of all known nodes along with the globals
+// and configuration of clusterm. The response is an InventoryExport, with
+// the nodes info as returned by GetAllNodes
+func (c *Client) ExportInventory() ([]byte, error) {
+	return c.readAll(GetInventoryExport)
+}
+
+// ImportInventory posts the request to restore the nodes and globals from an
+// inventory bundle, as returned by ExportInventory. The nodes that are already
+// known are left as is. If dryRun is true, the changes are reported without
+// being made.
+func (c *Client) ImportInventory(bundle []byte, dryRun bool) (*InventoryImportReport, error) {
+	req := &APIRequest{
+		Bundle: &InventoryExport{},
+		DryRun: dryRun,
+	}
+	if err := json.Unmarshal(bundle, req.Bundle); err != nil {
+		return nil, err
+	}
+	body, err := c.doPostWithResponse(PostInventoryImport, req)
+	if err != nil {
+		return nil, err
+	}
+	report := &InventoryImportReport{}
+	if err := json.Unmarshal(body, report); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+func (c *Client) readAll(rsrc string) ([]byte, error) {
+	resp, err := c.doGet(rsrc)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Close()
+
+	body, err := ioutil.ReadAll(resp)
+	if err != nil {
+		return nil, err
+	}
+	return body, err
+}
+
+// GetNode requests info of a specified node. If the client has a cache, see
+// WithCache, the cached info is returned if it's not expired.
+func (c *Client) GetNode(nodeName string) ([]byte, error) {
+	rsrc := fmt.Sprintf("%s/%s", GetNodeInfoPrefix, nodeName)
+	if body, ok := c.cache.get(rsrc); ok {
+		return body, nil
+	}
+	body, err := c.readAll(rsrc)
+	if err != nil {
+		return nil, err
+	}
+	c.cache.set(rsrc, body)
+	return body, nil
+}
+
+// GetNodeHistory requests the history of events of the node with specified
+// name, like it's discovery and commission, oldest first
+func (c *Client) GetNodeHistory(nodeName string) ([]NodeEvent, error) {
+	body, err := c.readAll(fmt.Sprintf("%s/%s/history", GetNodeInfoPrefix, nodeName))
+	if err != nil {
+		return nil, err
+	}
+	history := []NodeEvent{}
+	if err := json.Unmarshal(body, &history); err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+// GetNodeExtraVars requests the extra vars that the runs on the node with
+// specified name receive, after merging the configured, global and request
+// extra vars
+func (c *Client) GetNodeExtraVars(nodeName string) (*NodeExtraVars, error) {
+	body, err := c.readAll(fmt.Sprintf("%s/%s/extravars", GetNodeInfoPrefix, nodeName))
+	if err != nil {
+		return nil, err
+	}
+	vars := &NodeExtraVars{}
+	if err := json.Unmarshal(body, vars); err != nil {
+		return nil, err
+	}
+	return vars, nil
+}
+
+// GetAllNodes requests info of all known nodes. If the client has a cache, see
+// WithCache, the cached info is returned if it's not expired.
+func (c *Client) GetAllNodes() ([]byte, error) {
+	if body, ok := c.cache.get(GetNodesInfo); ok {
+		return body, nil
+	}
+	body, _, err := c.GetAllNodesIfChanged()
+	if err != nil {
+		return nil, err
+	}
+	c.cache.set(GetNodesInfo, body)
+	return body, nil
+}
+
+// GetAllNodesList requests the info of all known nodes as a list ordered by
+// node name. Unlike the map returned by GetAllNodes, the list keeps it's order
+// when it's decoded, like to diff two listings
+func (c *Client) GetAllNodesList() ([]NodeStreamEntry, error) {
+	body, err := c.readAll(GetNodesInfo + "?list=true")
+	if err != nil {
+		return nil, err
+	}
+	nodes := []NodeStreamEntry{}
+	if err := json.Unmarshal(body, &nodes); err != nil {
+		return nil, err
+	}
+	return nodes, nil
+}
+
+// NodesStream is the stream of the info of all known nodes, see StreamAllNodes
+type NodesStream struct {
+	body io.ReadCloser
+	d    *json.Decoder
+}
+
+// Next returns the info of the next node in the stream. It returns io.EOF once
+// the info of all nodes is read
+func (s *NodesStream) Next() (*NodeStreamEntry, error) {
+	entry := &NodeStreamEntry{}
+	if err := s.d.Decode(entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// Close closes the stream. Closing the stream before it's read to EOF stops the
+// listing and releases the connection.
+func (s *NodesStream) Close() error {
+	return s.body.Close()
+}
+
+// StreamAllNodes requests info of all known nodes as a stream of newline
+// delimited JSON, so that neither the client nor cluster manager hold the info
+// of all nodes in memory, like when iterating over a large cluster. The nodes
+// are read one at a time, in the order of node names, using Next.
+// It is caller's responsibility to Close the returned stream
+func (c *Client) StreamAllNodes() (*NodesStream, error) {
+	body, err := c.WithAccept(ndjsonContentType).doGet(GetNodesInfo)
+	if err != nil {
+		return nil, err
+	}
+	return &NodesStream{body: body, d: json.NewDecoder(body)}, nil
+}
+
+// GetAllNodesIfChanged requests info of all known nodes. The info is requested
+// conditionally using the ETag of the last received info. If the info didn't
+// change since then, the last received info is returned and the returned bool
+// is false. This allows the pollers to skip re-parsing the unchanged info.
+func (c *Client) GetAllNodesIfChanged() ([]byte, bool, error) {
+	c.nodesCacheMutex.Lock()
+	defer c.nodesCacheMutex.Unlock()
+
+	httpReq, err := c.newGetRequest(GetNodesInfo)
+	if err != nil {
+		return nil, false, err
+	}
+	if c.nodesETag != "" {
+		httpReq.Header.Set("If-None-Match", c.nodesETag)
+	}
+	resp, err := c.httpC.Do(httpReq)
+	if err != nil {
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, false, err
+	}
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		return append([]byte{}, c.nodesCache...), false, nil
+	case http.StatusOK:
+		c.nodesETag = resp.Header.Get("ETag")
+		c.nodesCache = body
+		return append([]byte{}, body...), true, nil
+	default:
+		return nil, false, httpErrorResp(GetNodesInfo, nil, resp, body)
+	}
+}
+
+// DiffNodes requests the differences between the info of the two nodes, like
+// their inventory vars, tags, annotations and state
+func (c *Client) DiffNodes(a, b string) ([]NodeDiff, error) {
+	vals := url.Values{}
+	vals.Set("a", a)
+	vals.Set("b", b)
+	body, err := c.readAll(fmt.Sprintf("%s?%s", GetNodesDiff, vals.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	diffs := []NodeDiff{}
+	if err := json.Unmarshal(body, &diffs); err != nil {
+		return nil, err
+	}
+	return diffs, nil
+}
+
+// ResolveSelector requests the names of the nodes that a node selector, like
+// 'rack=r1,role=worker', selects, without acting upon them. The nodes in
+// maintenance are not selected, like by the requests that act upon the nodes.
+func (c *Client) ResolveSelector(selector string) ([]string, error) {
+	vals := url.Values{}
+	vals.Set("selector", selector)
+	body, err := c.readAll(fmt.Sprintf("%s?%s", GetNodesResolve, vals.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	resolution := &SelectorResolution{}
+	if err := json.Unmarshal(body, resolution); err != nil {
+		return nil, err
+	}
+	return resolution.Nodes, nil
+}
+
+// GetNodeWithFields requests info of a specified node, limited to the specified
+// fields like 'name', 'addr' and 'status'
+func (c *Client) GetNodeWithFields(nodeName string, fields []string) ([]byte, error) {
+	return c.readAll(fmt.Sprintf("%s/%s?fields=%s", GetNodeInfoPrefix, nodeName,
+		url.QueryEscape(strings.Join(fields, ","))))
+}
+
+// GetAllNodesWithFields requests info of all known nodes, limited to the
+// specified fields like 'name', 'addr' and 'status'
+func (c *Client) GetAllNodesWithFields(fields []string) ([]byte, error) {
+	return c.readAll(fmt.Sprintf("%s?fields=%s", GetNodesInfo,
+		url.QueryEscape(strings.Join(fields, ","))))
+}
+
+// GetDiscoveredNodes requests info of the nodes that are discovered but are not
+// commissioned yet, i.e. the candidates awaiting commission
+func (c *Client) GetDiscoveredNodes() ([]byte, error) {
+	return c.readAll(GetNodesDiscovered)
+}
+
+// GetNodes requests info of the specified nodes in a single request. The
+// returned info contains the nodes keyed by name and the names of the
+// nodes that were not found
+func (c *Client) GetNodes(nodeNames []string) ([]byte, error) {
+	return c.readAll(fmt.Sprintf("%s?names=%s", GetNodesBatchInfo,
+		url.QueryEscape(strings.Join(nodeNames, ","))))
+}
+
+// GetGlobals requests the value global extra vars
+func (c *Client) GetGlobals() ([]byte, error) {
+	return c.readAll(GetGlobals)
+}
+
+// GetGlobalsRaw requests the stored value of global extra vars as is, without
+// it being parsed, like to fix the globals that are not valid JSON
+func (c *Client) GetGlobalsRaw() ([]byte, error) {
+	return c.readAll(GetGlobals + "?raw=true")
+}
+
+// GetOpenAPISpec requests the OpenAPI spec, in json, of clusterm's REST API
+func (c *Client) GetOpenAPISpec() ([]byte, error) {
+	return c.readAll(GetOpenAPI)
+}
+
+// GetConfig requests the value of current clusterm configuration
+func (c *Client) GetConfig() ([]byte, error) {
+	return c.readAll(GetPostConfig)
+}
+
+// GetConfigWithVersion requests the value of current clusterm configuration
+// along with it's version, to be passed to PostConfig
+func (c *Client) GetConfigWithVersion() ([]byte, uint64, error) {
+	httpReq, err := c.newGetRequest(GetPostConfig)
+	if err != nil {
+		return nil, 0, err
+	}
+	resp, err := c.httpC.Do(httpReq)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, httpErrorResp(GetPostConfig, nil, resp, body)
+	}
+	version, err := parseConfigVersion(resp.Header.Get("ETag"))
+	if err != nil {
+		return nil, 0, err
+	}
+	return body, version, nil
+}
+
+// GetJob requests the info of a provisioning job specified by jobLabel.
+// Accepted values of jobLabel are "active" and "last"
+func (c *Client) GetJob(jobLabel string) ([]byte, error) {
+	return c.readAll(fmt.Sprintf("%s/%s", GetJobPrefix, jobLabel))
+}
+
+// GetJobs requests the info of the active and recent provisioning jobs, most recent first
+func (c *Client) GetJobs() ([]byte, error) {
+	return c.readAll(GetJobs)
+}
+
+// ListJobs requests the info of the active and recent provisioning jobs, most
+// recent first. Unlike GetJobs, it returns the parsed job info.
+func (c *Client) ListJobs() ([]JobInfo, error) {
+	body, err := c.GetJobs()
+	if err != nil {
+		return nil, err
+	}
+	jobs := []JobInfo{}
+	if err := json.Unmarshal(body, &jobs); err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// GetJobByID requests the info of a provisioning job specified by it's id, or
+// a label like 'active' or 'last'. Unlike GetJob, it returns the parsed job info.
+func (c *Client) GetJobByID(id string) (*JobInfo, error) {
+	body, err := c.GetJob(id)
+	if err != nil {
+		return nil, err
+	}
+	job := &JobInfo{}
+	if err := json.Unmarshal(body, job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// GetJobPlan requests the changes that a check mode job would make on each
+// node. The plan is empty for the jobs that were not run in check mode
+func (c *Client) GetJobPlan(jobLabel string) (ansible.Plan, error) {
+	job, err := c.GetJobByID(jobLabel)
+	if err != nil {
+		return nil, err
+	}
+	return job.Plan, nil
+}
+
+// GetAudit requests the audit log of the mutating API calls, optionally within
+// the specified time range. A zero time leaves that end of the range open.
+func (c *Client) GetAudit(since, until time.Time) ([]byte, error) {
+	query := url.Values{}
+	if !since.IsZero() {
+		query.Set("since", since.Format(time.RFC3339))
+	}
+	if !until.IsZero() {
+		query.Set("until", until.Format(time.RFC3339))
+	}
+	rsrc := GetAudit
+	if len(query) > 0 {
+		rsrc += "?" + query.Encode()
+	}
+	return c.readAll(rsrc)
+}
+
+// GetJobsWithState requests the status of the jobs in the specified state,
+// like 'scheduled'
+func (c *Client) GetJobsWithState(state string) ([]byte, error) {
+	return c.readAll(fmt.Sprintf("%s?state=%s", GetJobs, url.QueryEscape(state)))
+}
+
+// GetMetrics requests the runtime metrics of clusterm
+func (c *Client) GetMetrics() (*Metrics, error) {
+	body, err := c.readAll(GetMetrics)
+	if err != nil {
+		return nil, err
+	}
+	metrics := &Metrics{}
+	if err := json.Unmarshal(body, metrics); err != nil {
+		return nil, err
+	}
+	return metrics, nil
+}
+
+// GetStatus requests a summary of clusterm's state, like the request queue
+// depth, the active jobs and the number of nodes in each state
+func (c *Client) GetStatus() (*Status, error) {
+	body, err := c.readAll(GetStatus)
+	if err != nil {
+		return nil, err
+	}
+	status := &Status{}
+	if err := json.Unmarshal(body, status); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// IsReady returns true if cluster manager has completed the initial sync of the
+// nodes and is ready to act upon them
+func (c *Client) IsReady() (bool, error) {
+	httpReq, err := c.newGetRequest(GetReadyz)
+	if err != nil {
+		return false, err
+	}
+	resp, err := c.httpC.Do(httpReq)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		// the body is drained for the connection to be reused
+		io.Copy(ioutil.Discard, resp.Body)
+		return true, nil
+	case http.StatusServiceUnavailable:
+		return false, nil
+	default:
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			body = []byte{}
+		}
+		return false, httpErrorResp(GetReadyz, nil, resp, body)
+	}
+}
+
+// GetLogLevel requests the current log level of clusterm
+func (c *Client) GetLogLevel() (string, error) {
+	body, err := c.readAll(GetPutLogLevel)
+	if err != nil {
+		return "", err
+	}
+	level := &LogLevel{}
+	if err := json.Unmarshal(body, level); err != nil {
+		return "", err
+	}
+	return level.Level, nil
+}
+
+// GetJobNodeStatus requests the status of the nodes in a provisioning job specified
+// by jobLabel. It returns a map of node name to its status
+func (c *Client) GetJobNodeStatus(jobLabel string) (map[string]NodeStatus, error) {
+	body, err := c.GetJob(jobLabel)
+	if err != nil {
+		return nil, err
+	}
+	job := struct {
+		NodeStatus map[string]NodeStatus `json:"node_status"`
+	}{}
+	if err := json.Unmarshal(body, &job); err != nil {
+		return nil, err
+	}
+	return job.NodeStatus, nil
+}
+
+// StreamLogs requests the log stream of a provisioning job specified by jobLabel.
+// It is caller's responsibility to Close the returned stream. Closing the stream
+// before it's read to EOF stops following the logs and releases the connection.
+func (c *Client) StreamLogs(jobLabel string) (io.ReadCloser, error) {
+	return c.doGet(fmt.Sprintf("%s/%s", GetJobLogPrefix, jobLabel))
+}
+
+// StreamLogsWithStream requests the log stream of a provisioning job specified by
+// jobLabel, limited to the specified stream i.e. stdout or stderr of the job.
+// It is caller's responsibility to Close the returned stream
+func (c *Client) StreamLogsWithStream(jobLabel string, stream LogStream) (io.ReadCloser, error) {
+	rsrc := fmt.Sprintf("%s/%s", GetJobLogPrefix, jobLabel)
+	if stream != LogStreamAll {
+		rsrc = fmt.Sprintf("%s?stream=%s", rsrc, url.QueryEscape(string(stream)))
+	}
+	return c.doGet(rsrc)
+}
+
+// StreamLogsFrom requests the logs of a provisioning job specified by jobLabel,
+// starting at the specified byte offset. The logs written so far are returned,
+// followed by the logs as they are written if the job is running. This allows
+// resuming the logs from where they were left off, like after a reconnect.
+// It is caller's responsibility to Close the returned stream
+func (c *Client) StreamLogsFrom(jobLabel string, offset int64) (io.ReadCloser, error) {
+	return c.doGet(fmt.Sprintf("%s/%s?offset=%d", GetJobLogPrefix, jobLabel, offset))
+}
+
+// StreamLogsWithGrep requests the log stream of a provisioning job specified by
+// jobLabel, limited to the lines that match the regular expression grep. The
+// specified number of context lines before and after each match are included.
+// It is caller's responsibility to Close the returned stream
+func (c *Client) StreamLogsWithGrep(jobLabel string, stream LogStream, grep string, contextLines int) (io.ReadCloser, error) {
+	vals := url.Values{}
+	vals.Set("grep", grep)
+	if contextLines > 0 {
+		vals.Set("context", strconv.Itoa(contextLines))
+	}
+	if stream != LogStreamAll {
+		vals.Set("stream", string(stream))
+	}
+	return c.doGet(fmt.Sprintf("%s/%s?%s", GetJobLogPrefix, jobLabel, vals.Encode()))
+}
+
+// StreamNodeEvents requests the stream of transitions in the state of nodes, as
+// server-sent events whose data is a NodeEvent in json. It is caller's
+// responsibility to Close the returned stream, which unsubscribes from the events.
+func (c *Client) StreamNodeEvents() (io.ReadCloser, error) {
+	return c.doGet(GetNodesEvents)
 }
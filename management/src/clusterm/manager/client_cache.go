@@ -0,0 +1,69 @@
+package manager
+
+import (
+	"sync"
+	"time"
+)
+
+// nodeInfoCache caches the node info received by a client, keyed by the
+// requested resource. The methods are no-op on a nil cache, so that the
+// clients without a cache don't need to special case it.
+type nodeInfoCache struct {
+	ttl     time.Duration
+	mutex   sync.Mutex
+	entries map[string]nodeInfoCacheEntry
+}
+
+type nodeInfoCacheEntry struct {
+	body      []byte
+	expiresAt time.Time
+}
+
+// newNodeInfoCache returns a cache that retains the node info for the specified duration
+func newNodeInfoCache(ttl time.Duration) *nodeInfoCache {
+	return &nodeInfoCache{
+		ttl:     ttl,
+		entries: map[string]nodeInfoCacheEntry{},
+	}
+}
+
+// get returns a copy of the cached info of the specified resource, if it's not expired
+func (nc *nodeInfoCache) get(rsrc string) ([]byte, bool) {
+	if nc == nil {
+		return nil, false
+	}
+	nc.mutex.Lock()
+	defer nc.mutex.Unlock()
+	entry, ok := nc.entries[rsrc]
+	if !ok {
+		return nil, false
+	}
+	if !time.Now().Before(entry.expiresAt) {
+		delete(nc.entries, rsrc)
+		return nil, false
+	}
+	return append([]byte{}, entry.body...), true
+}
+
+// set caches the info of the specified resource
+func (nc *nodeInfoCache) set(rsrc string, body []byte) {
+	if nc == nil {
+		return
+	}
+	nc.mutex.Lock()
+	defer nc.mutex.Unlock()
+	nc.entries[rsrc] = nodeInfoCacheEntry{
+		body:      append([]byte{}, body...),
+		expiresAt: time.Now().Add(nc.ttl),
+	}
+}
+
+// invalidate drops all the cached info
+func (nc *nodeInfoCache) invalidate() {
+	if nc == nil {
+		return
+	}
+	nc.mutex.Lock()
+	defer nc.mutex.Unlock()
+	nc.entries = map[string]nodeInfoCacheEntry{}
+}
@@ -6,13 +6,20 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/contiv/cluster/management/src/ansible"
 	"github.com/mapuri/serf/client"
 
 	. "gopkg.in/check.v1"
@@ -161,7 +168,7 @@ func (s *managerSuite) TestPostMultiNodesSuccess(c *C) {
 		extraVars string
 		hostGroup string
 		exptdBody []byte
-		cb        func(names []string, extraVars string, hostGroup string) error
+		cb        func(names []string, extraVars string, hostGroup string) (string, error)
 	}{
 		"commission": {
 			expURLStr: fmt.Sprintf("http://%s/%s", baseURL, PostNodesCommission),
@@ -235,7 +242,8 @@ func (s *managerSuite) TestPostMultiNodesSuccess(c *C) {
 		httpS, httpC := getHTTPTestClientAndServer(c, okReturner(c, expURL, test.exptdBody))
 		defer httpS.Close()
 		clstrC.httpC = httpC
-		c.Assert(test.cb(test.nodeNames, test.extraVars, test.hostGroup), IsNil, Commentf("test: %s", testname))
+		_, err = test.cb(test.nodeNames, test.extraVars, test.hostGroup)
+		c.Assert(err, IsNil, Commentf("test: %s", testname))
 	}
 
 	tests := map[string]struct {
@@ -243,7 +251,7 @@ func (s *managerSuite) TestPostMultiNodesSuccess(c *C) {
 		nodeNames []string
 		extraVars string
 		exptdBody []byte
-		cb        func(names []string, extraVars string) error
+		cb        func(names []string, extraVars string) (string, error)
 	}{
 		"decommission": {
 			expURLStr: fmt.Sprintf("http://%s/%s", baseURL, PostNodesDecommission),
@@ -281,8 +289,100 @@ func (s *managerSuite) TestPostMultiNodesSuccess(c *C) {
 		httpS, httpC := getHTTPTestClientAndServer(c, okReturner(c, expURL, test.exptdBody))
 		defer httpS.Close()
 		clstrC.httpC = httpC
-		c.Assert(test.cb(test.nodeNames, test.extraVars), IsNil, Commentf("test: %s", testname))
+		_, err = test.cb(test.nodeNames, test.extraVars)
+		c.Assert(err, IsNil, Commentf("test: %s", testname))
+	}
+}
+
+func (s *managerSuite) TestPostWithPlaybookSuccess(c *C) {
+	clstrC := Client{
+		url: baseURL,
+	}
+
+	reqBody := APIRequest{
+		Nodes:     []string{testNodeName},
+		HostGroup: ansibleMasterGroupName,
+		Playbook:  "custom.yml",
+	}
+	var reqJSON bytes.Buffer
+	c.Assert(json.NewEncoder(&reqJSON).Encode(reqBody), IsNil)
+
+	tests := map[string]struct {
+		expURLStr string
+		cb        func(names []string, extraVars, hostGroup, playbook string) (string, error)
+	}{
+		"commission": {
+			expURLStr: fmt.Sprintf("http://%s/%s", baseURL, PostNodesCommission),
+			cb:        clstrC.PostNodesCommissionWithPlaybook,
+		},
+		"update": {
+			expURLStr: fmt.Sprintf("http://%s/%s", baseURL, PostNodesUpdate),
+			cb:        clstrC.PostNodesUpdateWithPlaybook,
+		},
+	}
+	for testname, test := range tests {
+		expURL, err := url.Parse(test.expURLStr)
+		c.Assert(err, IsNil, Commentf("test: %s", testname))
+
+		httpS, httpC := getHTTPTestClientAndServer(c, okReturner(c, expURL, reqJSON.Bytes()))
+		defer httpS.Close()
+		clstrC.httpC = httpC
+		_, err = test.cb([]string{testNodeName}, "", ansibleMasterGroupName, "custom.yml")
+		c.Assert(err, IsNil,
+			Commentf("test: %s", testname))
+	}
+}
+
+func (s *managerSuite) TestSetNodeMaintenance(c *C) {
+	expURLStr := fmt.Sprintf("http://%s/%s/%s", baseURL, PostNodeMaintenancePrefix, testNodeName)
+	expURL, err := url.Parse(expURLStr)
+	c.Assert(err, IsNil)
+	maintenance := true
+	var reqBody bytes.Buffer
+	c.Assert(json.NewEncoder(&reqBody).Encode(&APIRequest{Maintenance: &maintenance}), IsNil)
+	httpS, httpC := getHTTPTestClientAndServer(c, okReturner(c, expURL, reqBody.Bytes()))
+	defer httpS.Close()
+	clstrC := Client{
+		url:   baseURL,
+		httpC: httpC,
+	}
+
+	err = clstrC.SetNodeMaintenance(testNodeName, true)
+	c.Assert(err, IsNil)
+}
+
+func (s *managerSuite) TestSetNodeLabels(c *C) {
+	expURLStr := fmt.Sprintf("http://%s/%s/%s", baseURL, PutNodeLabelsPrefix, testNodeName)
+	expURL, err := url.Parse(expURLStr)
+	c.Assert(err, IsNil)
+	labels := map[string]string{"rack": "r1"}
+	var reqBody bytes.Buffer
+	c.Assert(json.NewEncoder(&reqBody).Encode(&APIRequest{Labels: labels, MergeLabels: true}), IsNil)
+	httpS, httpC := getHTTPTestClientAndServer(c, okReturner(c, expURL, reqBody.Bytes()))
+	defer httpS.Close()
+	clstrC := Client{
+		url:   baseURL,
+		httpC: httpC,
 	}
+
+	err = clstrC.MergeNodeLabels(testNodeName, labels)
+	c.Assert(err, IsNil)
+}
+
+func (s *managerSuite) TestNewClientWithHTTPClient(c *C) {
+	reqs := 0
+	httpS, httpC := getHTTPTestClientAndServer(c,
+		func(w http.ResponseWriter, r *http.Request) {
+			reqs++
+			w.Write(testGetData)
+		})
+	defer httpS.Close()
+
+	// baseURL is only reachable through the proxy of the test http client
+	clstrC := NewClientWithHTTPClient(baseURL, httpC)
+	_, err := clstrC.GetGlobals()
+	c.Assert(err, IsNil)
+	c.Assert(reqs, Equals, 1)
 }
 
 func (s *managerSuite) TestPostGlobalsWithVarsSuccess(c *C) {
@@ -348,12 +448,32 @@ func (s *managerSuite) TestPostMonitorEvent(c *C) {
 	c.Assert(err, IsNil)
 }
 
+func (s *managerSuite) TestPostMonitorEventAndWait(c *C) {
+	httpS, httpC := getHTTPTestClientAndServer(c,
+		func(w http.ResponseWriter, r *http.Request) {
+			c.Assert(r.URL.Path, Equals, "/"+PostMonitorEvent)
+			c.Assert(r.URL.Query().Get("wait"), Equals, "true")
+			http.Error(w, "test error", http.StatusInternalServerError)
+		})
+	defer httpS.Close()
+	clstrC := Client{
+		url:   baseURL,
+		httpC: httpC,
+	}
+
+	err := clstrC.PostMonitorEventAndWait("discovered", []MonitorNode{{Label: "foo"}})
+	c.Assert(err, ErrorMatches, "(?s).*test error.*")
+}
+
 func (s *managerSuite) TestPostConfigSuccess(c *C) {
 	expURLStr := fmt.Sprintf("http://%s/%s", baseURL, GetPostConfig)
 	expURL, err := url.Parse(expURLStr)
 	c.Assert(err, IsNil)
+	version := uint64(3)
+	req := testReqConfigBody
+	req.ConfigVersion = &version
 	var reqConfigBody bytes.Buffer
-	c.Assert(json.NewEncoder(&reqConfigBody).Encode(testReqConfigBody), IsNil)
+	c.Assert(json.NewEncoder(&reqConfigBody).Encode(req), IsNil)
 	httpS, httpC := getHTTPTestClientAndServer(c, okReturner(c, expURL, reqConfigBody.Bytes()))
 	defer httpS.Close()
 	clstrC := Client{
@@ -361,7 +481,43 @@ func (s *managerSuite) TestPostConfigSuccess(c *C) {
 		httpC: httpC,
 	}
 
-	err = clstrC.PostConfig(testReqConfigBody.Config)
+	err = clstrC.PostConfig(testReqConfigBody.Config, version)
+	c.Assert(err, IsNil)
+}
+
+func (s *managerSuite) TestGetConfigWithVersion(c *C) {
+	httpS, httpC := getHTTPTestClientAndServer(c,
+		func(w http.ResponseWriter, r *http.Request) {
+			c.Assert(r.URL.Path, Equals, "/"+GetPostConfig)
+			w.Header().Set("ETag", `"7"`)
+			w.Write([]byte(`{"manager":{}}`))
+		})
+	defer httpS.Close()
+	clstrC := Client{
+		url:   baseURL,
+		httpC: httpC,
+	}
+
+	body, version, err := clstrC.GetConfigWithVersion()
+	c.Assert(err, IsNil)
+	c.Assert(string(body), Equals, `{"manager":{}}`)
+	c.Assert(version, Equals, uint64(7))
+}
+
+func (s *managerSuite) TestRetryFailedNodesSuccess(c *C) {
+	expURLStr := fmt.Sprintf("http://%s/%s/%s", baseURL, PostJobRetryPrefix, testJobLabel)
+	expURL, err := url.Parse(expURLStr)
+	c.Assert(err, IsNil)
+	var reqEmptyBody bytes.Buffer
+	c.Assert(json.NewEncoder(&reqEmptyBody).Encode(testReqEmptyBody), IsNil)
+	httpS, httpC := getHTTPTestClientAndServer(c, okReturner(c, expURL, reqEmptyBody.Bytes()))
+	defer httpS.Close()
+	clstrC := Client{
+		url:   baseURL,
+		httpC: httpC,
+	}
+
+	_, err = clstrC.RetryFailedNodes(testJobLabel)
 	c.Assert(err, IsNil)
 }
 
@@ -377,10 +533,93 @@ func (s *managerSuite) TestPostError(c *C) {
 		url:   baseURL,
 		httpC: httpC,
 	}
-	err = clstrC.PostNodesUpdate([]string{testNodeName}, "", "")
+	_, err = clstrC.PostNodesUpdate([]string{testNodeName}, "", "")
 	c.Assert(err, ErrorMatches, ".*test failure\n")
 }
 
+func (s *managerSuite) TestPostErrorStructured(c *C) {
+	tests := map[string]struct {
+		contentType string
+		body        string
+		exptd       *APIError
+	}{
+		"json": {"application/json", `{"code":"unknown_nodes","error":"Unknown node(s) specified: [node1]"}`,
+			&APIError{StatusCode: http.StatusBadRequest, Code: "unknown_nodes", Message: "Unknown node(s) specified: [node1]"}},
+		"json-no-code": {"application/json", `{"error":"invalid globals"}`,
+			&APIError{StatusCode: http.StatusBadRequest, Message: "invalid globals"}},
+		"plain-text": {"text/plain", "test failure\n",
+			&APIError{StatusCode: http.StatusBadRequest, Message: "test failure"}},
+		"other-json": {"application/json", `{"foo":"bar"}`,
+			&APIError{StatusCode: http.StatusBadRequest, Message: `{"foo":"bar"}`}},
+	}
+	for key, test := range tests {
+		httpS, httpC := getHTTPTestClientAndServer(c,
+			func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", test.contentType)
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(test.body))
+			})
+		clstrC := Client{
+			url:   baseURL,
+			httpC: httpC,
+		}
+
+		for _, post := range []func() error{
+			func() error { _, err := clstrC.PostNodesCommission([]string{"node1"}, "", ""); return err },
+			func() error { return clstrC.PostGlobals("{}") },
+			func() error { return clstrC.PostConfig(DefaultConfig(), 0) },
+		} {
+			err := post()
+			c.Assert(IsAPIError(err), Equals, true, Commentf("test: %s", key))
+			apiErr := err.(*APIError)
+			c.Assert(apiErr.StatusCode, Equals, test.exptd.StatusCode, Commentf("test: %s", key))
+			c.Assert(apiErr.Code, Equals, test.exptd.Code, Commentf("test: %s", key))
+			c.Assert(apiErr.Message, Equals, test.exptd.Message, Commentf("test: %s", key))
+			// the error describes the request and it's response as before
+			c.Assert(strings.Contains(err.Error(), "Response body: "+test.body), Equals, true,
+				Commentf("test: %s", key))
+		}
+		httpS.Close()
+	}
+}
+
+func (s *managerSuite) TestAPIErrorRoundTrip(c *C) {
+	readyCh := make(chan struct{})
+	close(readyCh)
+	m := &Manager{
+		config:  DefaultConfig(),
+		readyCh: readyCh,
+		reqQ:    make(chan event, 1),
+		nodes:   map[string]*node{"node1": {}},
+	}
+	// fill the queue
+	c.Assert(m.enqueue(&blockingEvent{}), IsNil)
+	httpS, httpC := getHTTPTestClientAndServer(c, m.apiRouter(0).ServeHTTP)
+	defer httpS.Close()
+	clstrC := Client{
+		url:   baseURL,
+		httpC: httpC,
+	}
+
+	tests := map[string]struct {
+		nodes []string
+		exptd *APIError
+	}{
+		"unknown-nodes": {[]string{"node2"}, &APIError{StatusCode: http.StatusBadRequest,
+			Code: ErrCodeUnknownNodes, Message: errUnknownNodes([]string{"node2"}).Error()}},
+		"queue-full": {[]string{"node1"}, &APIError{StatusCode: http.StatusServiceUnavailable,
+			Code: ErrCodeServiceUnavailable, Message: errReqQueueFull(1).Error()}},
+	}
+	for key, test := range tests {
+		_, err := clstrC.PostNodesDecommission(test.nodes, "")
+		c.Assert(IsAPIError(err), Equals, true, Commentf("test: %s", key))
+		apiErr := err.(*APIError)
+		c.Assert(apiErr.StatusCode, Equals, test.exptd.StatusCode, Commentf("test: %s", key))
+		c.Assert(apiErr.Code, Equals, test.exptd.Code, Commentf("test: %s", key))
+		c.Assert(apiErr.Message, Equals, test.exptd.Message, Commentf("test: %s", key))
+	}
+}
+
 func (s *managerSuite) TestGetNodeSuccess(c *C) {
 	expURLStr := fmt.Sprintf("http://%s/%s/%s", baseURL, GetNodeInfoPrefix, testNodeName)
 	expURL, err := url.Parse(expURLStr)
@@ -429,6 +668,99 @@ func (s *managerSuite) TestGetGlobalsSuccess(c *C) {
 	c.Assert(resp, DeepEquals, testGetData)
 }
 
+func (s *managerSuite) TestGetAllNodesList(c *C) {
+	exptdNodes := []NodeStreamEntry{
+		{Name: "node1", Info: json.RawMessage(`{"serial":"s1"}`)},
+		{Name: "node2", Info: json.RawMessage(`{"serial":"s2"}`)},
+	}
+	httpS, httpC := getHTTPTestClientAndServer(c,
+		func(w http.ResponseWriter, r *http.Request) {
+			c.Assert(r.URL.Path, Equals, "/"+GetNodesInfo)
+			c.Assert(r.URL.Query().Get("list"), Equals, "true")
+			c.Assert(json.NewEncoder(w).Encode(exptdNodes), IsNil)
+		})
+	defer httpS.Close()
+	clstrC := Client{
+		url:   baseURL,
+		httpC: httpC,
+	}
+
+	nodes, err := clstrC.GetAllNodesList()
+	c.Assert(err, IsNil)
+	c.Assert(nodes, DeepEquals, exptdNodes)
+}
+
+func (s *managerSuite) TestResolveSelector(c *C) {
+	httpS, httpC := getHTTPTestClientAndServer(c,
+		func(w http.ResponseWriter, r *http.Request) {
+			c.Assert(r.URL.Path, Equals, "/"+GetNodesResolve)
+			c.Assert(r.URL.Query().Get("selector"), Equals, "rack=r1,role=worker")
+			w.Write([]byte(`{"selector":"rack=r1,role=worker","nodes":["node1","node2"]}`))
+		})
+	defer httpS.Close()
+	clstrC := Client{
+		url:   baseURL,
+		httpC: httpC,
+	}
+
+	nodes, err := clstrC.ResolveSelector("rack=r1,role=worker")
+	c.Assert(err, IsNil)
+	c.Assert(nodes, DeepEquals, []string{"node1", "node2"})
+}
+
+func (s *managerSuite) TestGetGlobalsRaw(c *C) {
+	expURLStr := fmt.Sprintf("http://%s/%s?raw=true", baseURL, GetGlobals)
+	expURL, err := url.Parse(expURLStr)
+	c.Assert(err, IsNil)
+	httpS, httpC := getHTTPTestClientAndServer(c, okGetReturner(c, expURL))
+	defer httpS.Close()
+	clstrC := Client{
+		url:   baseURL,
+		httpC: httpC,
+	}
+
+	resp, err := clstrC.GetGlobalsRaw()
+	c.Assert(err, IsNil)
+	c.Assert(resp, DeepEquals, testGetData)
+}
+
+func (s *managerSuite) TestExportInventorySuccess(c *C) {
+	expURLStr := fmt.Sprintf("http://%s/%s", baseURL, GetInventoryExport)
+	expURL, err := url.Parse(expURLStr)
+	c.Assert(err, IsNil)
+	httpS, httpC := getHTTPTestClientAndServer(c, okGetReturner(c, expURL))
+	defer httpS.Close()
+	clstrC := Client{
+		url:   baseURL,
+		httpC: httpC,
+	}
+
+	resp, err := clstrC.ExportInventory()
+	c.Assert(err, IsNil)
+	c.Assert(resp, DeepEquals, testGetData)
+}
+
+func (s *managerSuite) TestImportInventory(c *C) {
+	httpS, httpC := getHTTPTestClientAndServer(c,
+		func(w http.ResponseWriter, r *http.Request) {
+			c.Assert(r.URL.Path, Equals, "/"+PostInventoryImport)
+			req := &APIRequest{}
+			c.Assert(json.NewDecoder(r.Body).Decode(req), IsNil)
+			c.Assert(req.DryRun, Equals, true)
+			c.Assert(req.Bundle.Version, Equals, inventoryExportVersion)
+			w.Write([]byte(`{"dry_run":true,"nodes_added":["node1"]}`))
+		})
+	defer httpS.Close()
+	clstrC := Client{
+		url:   baseURL,
+		httpC: httpC,
+	}
+
+	report, err := clstrC.ImportInventory([]byte(`{"version":1,"nodes":{"node1":{}}}`), true)
+	c.Assert(err, IsNil)
+	c.Assert(report, DeepEquals, &InventoryImportReport{DryRun: true, NodesAdded: []string{"node1"}})
+}
+
 func (s *managerSuite) TestGetConfigSuccess(c *C) {
 	expURLStr := fmt.Sprintf("http://%s/%s", baseURL, GetPostConfig)
 	expURL, err := url.Parse(expURLStr)
@@ -461,8 +793,63 @@ func (s *managerSuite) TestGetJobSuccess(c *C) {
 	c.Assert(resp, DeepEquals, testGetData)
 }
 
-func (s *managerSuite) TestStreamLogsSuccess(c *C) {
-	expURLStr := fmt.Sprintf("http://%s/%s/%s", baseURL, GetJobLogPrefix, testJobLabel)
+func (s *managerSuite) TestListJobsAndGetJobByID(c *C) {
+	jobJSON := `{"id":5,"desc":"test job","task":"commission","status":"Complete","error":"",` +
+		`"summary":{"hosts":{"node1":{"ok":3,"changed":1,"unreachable":0,"failed":0}},"passed":true},` +
+		`"node_status":{"node1":"ok"},"progress":100,"created_at":"2016-01-02T15:04:05Z"}`
+	httpS, httpC := getHTTPTestClientAndServer(c,
+		func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/" + GetJobs:
+				w.Write([]byte("[" + jobJSON + "]"))
+			case "/" + GetJobPrefix + "/5":
+				w.Write([]byte(jobJSON))
+			default:
+				c.Fatalf("unexpected path %q", r.URL.Path)
+			}
+		})
+	defer httpS.Close()
+	clstrC := Client{
+		url:   baseURL,
+		httpC: httpC,
+	}
+
+	jobs, err := clstrC.ListJobs()
+	c.Assert(err, IsNil)
+	c.Assert(jobs, HasLen, 1)
+	c.Assert(jobs[0].ID, Equals, uint64(5))
+
+	job, err := clstrC.GetJobByID("5")
+	c.Assert(err, IsNil)
+	c.Assert(job.Status, Equals, Complete.String())
+	c.Assert(job.NodeStatus, DeepEquals, map[string]NodeStatus{"node1": NodeOk})
+	c.Assert(job.Summary, NotNil)
+	c.Assert(job.Summary.Passed, Equals, true)
+	c.Assert(job.Summary.Hosts["node1"].Changed, Equals, 1)
+}
+
+func (s *managerSuite) TestGetJobNodeStatusSuccess(c *C) {
+	expURLStr := fmt.Sprintf("http://%s/%s/%s", baseURL, GetJobPrefix, testJobLabel)
+	expURL, err := url.Parse(expURLStr)
+	c.Assert(err, IsNil)
+	httpS, httpC := getHTTPTestClientAndServer(c,
+		func(w http.ResponseWriter, r *http.Request) {
+			c.Assert(r.URL.Path, Equals, expURL.Path)
+			w.Write([]byte(`{"status":"Running","node_status":{"node1":"ok","node2":"running"}}`))
+		})
+	defer httpS.Close()
+	clstrC := Client{
+		url:   baseURL,
+		httpC: httpC,
+	}
+
+	resp, err := clstrC.GetJobNodeStatus(testJobLabel)
+	c.Assert(err, IsNil)
+	c.Assert(resp, DeepEquals, map[string]NodeStatus{"node1": NodeOk, "node2": NodeRunning})
+}
+
+func (s *managerSuite) TestStreamLogsWithStreamSuccess(c *C) {
+	expURLStr := fmt.Sprintf("http://%s/%s/%s?stream=stderr", baseURL, GetJobLogPrefix, testJobLabel)
 	expURL, err := url.Parse(expURLStr)
 	c.Assert(err, IsNil)
 	httpS, httpC := getHTTPTestClientAndServer(c, okGetReturner(c, expURL))
@@ -472,24 +859,1192 @@ func (s *managerSuite) TestStreamLogsSuccess(c *C) {
 		httpC: httpC,
 	}
 
-	resp, err := clstrC.StreamLogs(testJobLabel)
+	resp, err := clstrC.StreamLogsWithStream(testJobLabel, LogStreamStderr)
 	c.Assert(err, IsNil)
 	body, err := ioutil.ReadAll(resp)
 	c.Assert(err, IsNil)
 	c.Assert(body, DeepEquals, testGetData)
 }
 
-func (s *managerSuite) TestGetError(c *C) {
+func (s *managerSuite) TestStreamLogsFromSuccess(c *C) {
+	expURLStr := fmt.Sprintf("http://%s/%s/%s?offset=1024", baseURL, GetJobLogPrefix, testJobLabel)
+	expURL, err := url.Parse(expURLStr)
+	c.Assert(err, IsNil)
+	httpS, httpC := getHTTPTestClientAndServer(c, okGetReturner(c, expURL))
+	defer httpS.Close()
+	clstrC := Client{
+		url:   baseURL,
+		httpC: httpC,
+	}
+
+	resp, err := clstrC.StreamLogsFrom(testJobLabel, 1024)
+	c.Assert(err, IsNil)
+	body, err := ioutil.ReadAll(resp)
+	c.Assert(err, IsNil)
+	c.Assert(body, DeepEquals, testGetData)
+}
+
+func (s *managerSuite) TestStreamLogsWithGrepSuccess(c *C) {
+	expURLStr := fmt.Sprintf("http://%s/%s/%s?grep=%s&context=2&stream=stdout", baseURL, GetJobLogPrefix, testJobLabel, url.QueryEscape("fatal: .*"))
+	expURL, err := url.Parse(expURLStr)
+	c.Assert(err, IsNil)
+	httpS, httpC := getHTTPTestClientAndServer(c, okGetReturner(c, expURL))
+	defer httpS.Close()
+	clstrC := Client{
+		url:   baseURL,
+		httpC: httpC,
+	}
+
+	resp, err := clstrC.StreamLogsWithGrep(testJobLabel, LogStreamStdout, "fatal: .*", 2)
+	c.Assert(err, IsNil)
+	body, err := ioutil.ReadAll(resp)
+	c.Assert(err, IsNil)
+	c.Assert(body, DeepEquals, testGetData)
+}
+
+func (s *managerSuite) TestIsReady(c *C) {
+	ready := false
+	httpS, httpC := getHTTPTestClientAndServer(c,
+		func(w http.ResponseWriter, r *http.Request) {
+			c.Assert(r.URL.Path, Equals, "/"+GetReadyz)
+			if !ready {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		})
+	defer httpS.Close()
+	clstrC := Client{
+		url:   baseURL,
+		httpC: httpC,
+	}
+
+	ok, err := clstrC.IsReady()
+	c.Assert(err, IsNil)
+	c.Assert(ok, Equals, false)
+
+	ready = true
+	ok, err = clstrC.IsReady()
+	c.Assert(err, IsNil)
+	c.Assert(ok, Equals, true)
+}
+
+func (s *managerSuite) TestGetAllNodesIfChanged(c *C) {
+	testETag := `"1234"`
+	httpS, httpC := getHTTPTestClientAndServer(c,
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("ETag", testETag)
+			if r.Header.Get("If-None-Match") == testETag {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Write(testGetData)
+		})
+	defer httpS.Close()
+	clstrC := Client{
+		url:   baseURL,
+		httpC: httpC,
+	}
+
+	resp, changed, err := clstrC.GetAllNodesIfChanged()
+	c.Assert(err, IsNil)
+	c.Assert(changed, Equals, true)
+	c.Assert(resp, DeepEquals, testGetData)
+
+	resp, changed, err = clstrC.GetAllNodesIfChanged()
+	c.Assert(err, IsNil)
+	c.Assert(changed, Equals, false)
+	c.Assert(resp, DeepEquals, testGetData)
+}
+
+func (s *managerSuite) TestGetNodeWithFieldsSuccess(c *C) {
 	expURLStr := fmt.Sprintf("http://%s/%s/%s", baseURL, GetNodeInfoPrefix, testNodeName)
 	expURL, err := url.Parse(expURLStr)
 	c.Assert(err, IsNil)
-	httpS, httpC := getHTTPTestClientAndServer(c, failureReturner(c, expURL, []byte{}))
+	httpS, httpC := getHTTPTestClientAndServer(c,
+		func(w http.ResponseWriter, r *http.Request) {
+			c.Assert(r.URL.Path, Equals, expURL.Path)
+			c.Assert(r.URL.Query().Get("fields"), Equals, "name,addr")
+			w.Write(testGetData)
+		})
 	defer httpS.Close()
 	clstrC := Client{
 		url:   baseURL,
 		httpC: httpC,
 	}
 
-	_, err = clstrC.GetNode(testNodeName)
-	c.Assert(err, ErrorMatches, ".*test failure\n")
+	resp, err := clstrC.GetNodeWithFields(testNodeName, []string{"name", "addr"})
+	c.Assert(err, IsNil)
+	c.Assert(resp, DeepEquals, testGetData)
+}
+
+func (s *managerSuite) TestPostNodesDecommissionWithDrain(c *C) {
+	drain := true
+	var reqJSON bytes.Buffer
+	c.Assert(json.NewEncoder(&reqJSON).Encode(&APIRequest{
+		Nodes:        []string{testNodeName},
+		Drain:        &drain,
+		DrainTimeout: "5m",
+	}), IsNil)
+	expURL, err := url.Parse(fmt.Sprintf("http://%s/%s", baseURL, PostNodesDecommission))
+	c.Assert(err, IsNil)
+	httpS, httpC := getHTTPTestClientAndServer(c, okReturner(c, expURL, reqJSON.Bytes()))
+	defer httpS.Close()
+	clstrC := Client{
+		url:   baseURL,
+		httpC: httpC,
+	}
+
+	_, err = clstrC.PostNodesDecommissionWithDrain([]string{testNodeName}, "", true, "5m")
+	c.Assert(err, IsNil)
+}
+
+func (s *managerSuite) TestPostNodesCommissionWithVerify(c *C) {
+	verify := true
+	var reqJSON bytes.Buffer
+	c.Assert(json.NewEncoder(&reqJSON).Encode(&APIRequest{
+		Nodes:          []string{testNodeName},
+		HostGroup:      ansibleMasterGroupName,
+		Verify:         &verify,
+		VerifyPlaybook: "verify.yml",
+	}), IsNil)
+	expURL, err := url.Parse(fmt.Sprintf("http://%s/%s", baseURL, PostNodesCommission))
+	c.Assert(err, IsNil)
+	httpS, httpC := getHTTPTestClientAndServer(c, okReturner(c, expURL, reqJSON.Bytes()))
+	defer httpS.Close()
+	clstrC := Client{
+		url:   baseURL,
+		httpC: httpC,
+	}
+
+	_, err = clstrC.PostNodesCommissionWithVerify([]string{testNodeName}, "", ansibleMasterGroupName,
+		true, "verify.yml")
+	c.Assert(err, IsNil)
+}
+
+func (s *managerSuite) TestValidateConfig(c *C) {
+	httpS, httpC := getHTTPTestClientAndServer(c,
+		func(w http.ResponseWriter, r *http.Request) {
+			c.Assert(r.URL.Path, Equals, "/"+PostConfigValidate)
+			req := &APIRequest{}
+			c.Assert(json.NewDecoder(r.Body).Decode(req), IsNil)
+			if req.Config.Manager.Addr == "" {
+				return
+			}
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"test failure"}`))
+		})
+	defer httpS.Close()
+	clstrC := Client{
+		url:   baseURL,
+		httpC: httpC,
+	}
+
+	c.Assert(clstrC.ValidateConfig(&Config{}), IsNil)
+	err := clstrC.ValidateConfig(DefaultConfig())
+	c.Assert(err, DeepEquals, &ConfigValidationError{Message: "test failure"})
+}
+
+func (s *managerSuite) TestDecommissionImpact(c *C) {
+	httpS, httpC := getHTTPTestClientAndServer(c,
+		func(w http.ResponseWriter, r *http.Request) {
+			c.Assert(r.URL.Path, Equals, "/"+PostNodesDecommissionImpact)
+			req := &APIRequest{}
+			c.Assert(json.NewDecoder(r.Body).Decode(req), IsNil)
+			c.Assert(req.Nodes, DeepEquals, []string{testNodeName})
+			w.Write([]byte(`{"nodes":["` + testNodeName + `"],"host_groups":[],"quorum_affected":true,"last_master":true}`))
+		})
+	defer httpS.Close()
+	clstrC := Client{
+		url:   baseURL,
+		httpC: httpC,
+	}
+
+	impact, err := clstrC.DecommissionImpact([]string{testNodeName})
+	c.Assert(err, IsNil)
+	c.Assert(impact, DeepEquals, &DecommissionImpact{
+		Nodes:          []string{testNodeName},
+		HostGroups:     []HostGroupImpact{},
+		QuorumAffected: true,
+		LastMaster:     true,
+	})
+}
+
+func (s *managerSuite) TestDiffConfig(c *C) {
+	httpS, httpC := getHTTPTestClientAndServer(c,
+		func(w http.ResponseWriter, r *http.Request) {
+			c.Assert(r.URL.Path, Equals, "/"+PostConfigDiff)
+			w.Write([]byte(`[{"field":"ansible.user","from":"vagrant","to":"foo"}]`))
+		})
+	defer httpS.Close()
+	clstrC := Client{
+		url:   baseURL,
+		httpC: httpC,
+	}
+
+	changes, err := clstrC.DiffConfig(DefaultConfig())
+	c.Assert(err, IsNil)
+	c.Assert(changes, DeepEquals, []ConfigChange{{Field: "ansible.user", From: "vagrant", To: "foo"}})
+}
+
+func (s *managerSuite) TestValidateGlobals(c *C) {
+	httpS, httpC := getHTTPTestClientAndServer(c,
+		func(w http.ResponseWriter, r *http.Request) {
+			c.Assert(r.URL.Path, Equals, "/"+PostGlobalsValidate)
+			req := &APIRequest{}
+			c.Assert(json.NewDecoder(r.Body).Decode(req), IsNil)
+			c.Assert(req.ExtraVars, Equals, `{"foo":1}`)
+			w.Write([]byte(`{"valid":false,"problems":[{"key":"foo","message":"unknown key"}]}`))
+		})
+	defer httpS.Close()
+	clstrC := Client{
+		url:   baseURL,
+		httpC: httpC,
+	}
+
+	report, err := clstrC.ValidateGlobals(`{"foo":1}`)
+	c.Assert(err, IsNil)
+	c.Assert(report, DeepEquals, &GlobalsValidationReport{
+		Problems: []GlobalsProblem{{Key: "foo", Message: "unknown key"}},
+	})
+}
+
+func (s *managerSuite) TestLogLevel(c *C) {
+	httpS, httpC := getHTTPTestClientAndServer(c,
+		func(w http.ResponseWriter, r *http.Request) {
+			c.Assert(r.URL.Path, Equals, "/"+GetPutLogLevel)
+			switch r.Method {
+			case "PUT":
+				req := &APIRequest{}
+				c.Assert(json.NewDecoder(r.Body).Decode(req), IsNil)
+				c.Assert(req.Level, Equals, "debug")
+			case "GET":
+				w.Write([]byte(`{"level":"info"}`))
+			default:
+				c.Fatalf("unexpected method %q", r.Method)
+			}
+		})
+	defer httpS.Close()
+	clstrC := Client{
+		url:   baseURL,
+		httpC: httpC,
+	}
+
+	c.Assert(clstrC.SetLogLevel("debug"), IsNil)
+	level, err := clstrC.GetLogLevel()
+	c.Assert(err, IsNil)
+	c.Assert(level, Equals, "info")
+}
+
+func (s *managerSuite) TestNodeAnnotations(c *C) {
+	httpS, httpC := getHTTPTestClientAndServer(c,
+		func(w http.ResponseWriter, r *http.Request) {
+			c.Assert(r.URL.Path, Equals, "/"+PostDeleteNodeAnnotationsPrefix+"/"+testNodeName)
+			req := &APIRequest{}
+			c.Assert(json.NewDecoder(r.Body).Decode(req), IsNil)
+			switch r.Method {
+			case "POST":
+				c.Assert(req.Annotations, DeepEquals, map[string]string{"rack": "r1"})
+			case "DELETE":
+				c.Assert(req.AnnotationKeys, DeepEquals, []string{"rack"})
+			default:
+				c.Fatalf("unexpected method %q", r.Method)
+			}
+		})
+	defer httpS.Close()
+	clstrC := Client{
+		url:   baseURL,
+		httpC: httpC,
+	}
+
+	c.Assert(clstrC.SetNodeAnnotations(testNodeName, map[string]string{"rack": "r1"}), IsNil)
+	c.Assert(clstrC.DeleteNodeAnnotations(testNodeName, []string{"rack"}), IsNil)
+}
+
+func (s *managerSuite) TestGetAudit(c *C) {
+	httpS, httpC := getHTTPTestClientAndServer(c,
+		func(w http.ResponseWriter, r *http.Request) {
+			c.Assert(r.URL.Path, Equals, "/"+GetAudit)
+			c.Assert(r.URL.Query().Get("since"), Equals, "2016-01-02T15:04:05Z")
+			c.Assert(r.URL.Query().Get("until"), Equals, "")
+			w.Write([]byte(`[]`))
+		})
+	defer httpS.Close()
+	clstrC := Client{
+		url:   baseURL,
+		httpC: httpC,
+	}
+
+	out, err := clstrC.GetAudit(time.Date(2016, 1, 2, 15, 4, 5, 0, time.UTC), time.Time{})
+	c.Assert(err, IsNil)
+	c.Assert(string(out), Equals, `[]`)
+}
+
+func (s *managerSuite) TestPostNodesUpdateAt(c *C) {
+	runAt := time.Date(2099, 1, 2, 15, 4, 5, 0, time.UTC)
+	httpS, httpC := getHTTPTestClientAndServer(c,
+		func(w http.ResponseWriter, r *http.Request) {
+			c.Assert(r.URL.Path, Equals, "/"+PostNodesUpdate)
+			req := &APIRequest{}
+			c.Assert(json.NewDecoder(r.Body).Decode(req), IsNil)
+			c.Assert(req.RunAt, Equals, "2099-01-02T15:04:05Z")
+			w.WriteHeader(http.StatusAccepted)
+			w.Write([]byte(`{"id":"7"}`))
+		})
+	defer httpS.Close()
+	clstrC := Client{
+		url:   baseURL,
+		httpC: httpC,
+	}
+
+	id, err := clstrC.PostNodesUpdateAt([]string{testNodeName}, "", "", runAt)
+	c.Assert(err, IsNil)
+	c.Assert(id, Equals, "7")
+}
+
+func (s *managerSuite) TestPostNodesUpgrade(c *C) {
+	expURL, err := url.Parse(fmt.Sprintf("http://%s/%s", baseURL, PostNodesUpgrade))
+	c.Assert(err, IsNil)
+	var reqJSON bytes.Buffer
+	c.Assert(json.NewEncoder(&reqJSON).Encode(&APIRequest{
+		Nodes:     []string{testNodeName},
+		Version:   "1.2.0",
+		HostGroup: ansibleMasterGroupName,
+	}), IsNil)
+	httpS, httpC := getHTTPTestClientAndServer(c, okReturner(c, expURL, reqJSON.Bytes()))
+	defer httpS.Close()
+	clstrC := Client{
+		url:   baseURL,
+		httpC: httpC,
+	}
+
+	_, err = clstrC.PostNodesUpgrade([]string{testNodeName}, "1.2.0", ansibleMasterGroupName)
+	c.Assert(err, IsNil)
+}
+
+func (s *managerSuite) TestPostNodesUpdateBySelector(c *C) {
+	expURL, err := url.Parse(fmt.Sprintf("http://%s/%s", baseURL, PostNodesUpdate))
+	c.Assert(err, IsNil)
+	var reqJSON bytes.Buffer
+	c.Assert(json.NewEncoder(&reqJSON).Encode(&APIRequest{
+		Selector:  "rack=r1,role=worker",
+		ExtraVars: testExtraVars,
+		HostGroup: ansibleMasterGroupName,
+	}), IsNil)
+	httpS, httpC := getHTTPTestClientAndServer(c, okReturner(c, expURL, reqJSON.Bytes()))
+	defer httpS.Close()
+	clstrC := Client{
+		url:   baseURL,
+		httpC: httpC,
+	}
+
+	_, err = clstrC.PostNodesUpdateBySelector("rack=r1,role=worker", testExtraVars, ansibleMasterGroupName)
+	c.Assert(err, IsNil)
+}
+
+func (s *managerSuite) TestCancelScheduledJob(c *C) {
+	expURL, err := url.Parse(fmt.Sprintf("http://%s/%s/7", baseURL, PostJobCancelPrefix))
+	c.Assert(err, IsNil)
+	var reqJSON bytes.Buffer
+	c.Assert(json.NewEncoder(&reqJSON).Encode(&APIRequest{}), IsNil)
+	httpS, httpC := getHTTPTestClientAndServer(c, okReturner(c, expURL, reqJSON.Bytes()))
+	defer httpS.Close()
+	clstrC := Client{
+		url:   baseURL,
+		httpC: httpC,
+	}
+
+	c.Assert(clstrC.CancelScheduledJob("7"), IsNil)
+}
+
+func (s *managerSuite) TestCancelJob(c *C) {
+	httpS, httpC := getHTTPTestClientAndServer(c,
+		func(w http.ResponseWriter, r *http.Request) {
+			c.Assert(r.Method, Equals, "DELETE")
+			c.Assert(r.URL.Path, Equals, "/"+GetJobPrefix+"/"+jobLabelActive)
+			w.WriteHeader(http.StatusOK)
+		})
+	defer httpS.Close()
+	clstrC := Client{
+		url:   baseURL,
+		httpC: httpC,
+	}
+
+	c.Assert(clstrC.CancelJob(jobLabelActive), IsNil)
+}
+
+func (s *managerSuite) TestGetWithAccept(c *C) {
+	httpS, httpC := getHTTPTestClientAndServer(c,
+		func(w http.ResponseWriter, r *http.Request) {
+			c.Assert(r.Header.Get("Accept"), Equals, "application/yaml")
+			w.Write([]byte("foo: bar\n"))
+		})
+	defer httpS.Close()
+	clstrC := NewClientWithHTTPClient(baseURL, httpC).WithAccept("application/yaml")
+
+	out, err := clstrC.GetNode(testNodeName)
+	c.Assert(err, IsNil)
+	c.Assert(string(out), Equals, "foo: bar\n")
+}
+
+func (s *managerSuite) TestStreamAllNodes(c *C) {
+	httpS, httpC := getHTTPTestClientAndServer(c,
+		func(w http.ResponseWriter, r *http.Request) {
+			c.Assert(r.URL.Path, Equals, "/"+GetNodesInfo)
+			c.Assert(r.Header.Get("Accept"), Equals, "application/x-ndjson")
+			w.Write([]byte(`{"name":"node1","info":{"tags":{}}}` + "\n" +
+				`{"name":"node2","info":{"tags":{}}}` + "\n"))
+		})
+	defer httpS.Close()
+	clstrC := Client{
+		url:   baseURL,
+		httpC: httpC,
+	}
+
+	stream, err := clstrC.StreamAllNodes()
+	c.Assert(err, IsNil)
+	defer stream.Close()
+	for _, name := range []string{"node1", "node2"} {
+		entry, err := stream.Next()
+		c.Assert(err, IsNil)
+		c.Assert(entry.Name, Equals, name)
+		c.Assert(string(entry.Info), Equals, `{"tags":{}}`)
+	}
+	_, err = stream.Next()
+	c.Assert(err, Equals, io.EOF)
+}
+
+func (s *managerSuite) TestPostNodesReboot(c *C) {
+	var reqJSON bytes.Buffer
+	c.Assert(json.NewEncoder(&reqJSON).Encode(&APIRequest{
+		Nodes:      []string{testNodeName},
+		WaitRejoin: true,
+	}), IsNil)
+	expURL, err := url.Parse(fmt.Sprintf("http://%s/%s", baseURL, PostNodesReboot))
+	c.Assert(err, IsNil)
+	httpS, httpC := getHTTPTestClientAndServer(c, okReturner(c, expURL, reqJSON.Bytes()))
+	defer httpS.Close()
+	clstrC := Client{
+		url:   baseURL,
+		httpC: httpC,
+	}
+
+	_, err = clstrC.PostNodesReboot([]string{testNodeName}, "", true)
+	c.Assert(err, IsNil)
+}
+
+func (s *managerSuite) TestRediscoverNode(c *C) {
+	expURL, err := url.Parse(fmt.Sprintf("http://%s/%s/%s", baseURL, PostNodeRediscoverPrefix, testNodeName))
+	c.Assert(err, IsNil)
+	for addr, req := range map[string]*APIRequest{
+		"":        {},
+		"1.1.1.2": {Addrs: []string{"1.1.1.2"}},
+	} {
+		var reqJSON bytes.Buffer
+		c.Assert(json.NewEncoder(&reqJSON).Encode(req), IsNil)
+		httpS, httpC := getHTTPTestClientAndServer(c, okReturner(c, expURL, reqJSON.Bytes()))
+		defer httpS.Close()
+		clstrC := Client{
+			url:   baseURL,
+			httpC: httpC,
+		}
+
+		_, err = clstrC.RediscoverNodeAt(testNodeName, addr)
+		c.Assert(err, IsNil, Commentf("addr: %q", addr))
+	}
+}
+
+func (s *managerSuite) TestPostNodesCommissionGroups(c *C) {
+	var reqJSON bytes.Buffer
+	c.Assert(json.NewEncoder(&reqJSON).Encode(&APIRequest{
+		Nodes:      []string{testNodeName},
+		HostGroups: []string{ansibleMasterGroupName, ansibleWorkerGroupName},
+	}), IsNil)
+	expURL, err := url.Parse(fmt.Sprintf("http://%s/%s", baseURL, PostNodesCommission))
+	c.Assert(err, IsNil)
+	httpS, httpC := getHTTPTestClientAndServer(c, okReturner(c, expURL, reqJSON.Bytes()))
+	defer httpS.Close()
+	clstrC := Client{
+		url:   baseURL,
+		httpC: httpC,
+	}
+
+	_, err = clstrC.PostNodesCommissionGroups([]string{testNodeName}, "",
+		[]string{ansibleMasterGroupName, ansibleWorkerGroupName})
+	c.Assert(err, IsNil)
+}
+
+func (s *managerSuite) TestPostNodesCommissionWithForks(c *C) {
+	var reqJSON bytes.Buffer
+	c.Assert(json.NewEncoder(&reqJSON).Encode(&APIRequest{
+		Nodes:     []string{testNodeName},
+		HostGroup: ansibleMasterGroupName,
+		Forks:     20,
+	}), IsNil)
+	expURL, err := url.Parse(fmt.Sprintf("http://%s/%s", baseURL, PostNodesCommission))
+	c.Assert(err, IsNil)
+	httpS, httpC := getHTTPTestClientAndServer(c, okReturner(c, expURL, reqJSON.Bytes()))
+	defer httpS.Close()
+	clstrC := Client{
+		url:   baseURL,
+		httpC: httpC,
+	}
+
+	_, err = clstrC.PostNodesCommissionWithForks([]string{testNodeName}, "", ansibleMasterGroupName, 20)
+	c.Assert(err, IsNil)
+}
+
+func (s *managerSuite) TestPostNodesCommissionWithConnection(c *C) {
+	var reqJSON bytes.Buffer
+	c.Assert(json.NewEncoder(&reqJSON).Encode(&APIRequest{
+		Nodes:     []string{testNodeName},
+		HostGroup: ansibleMasterGroupName,
+		SSHUser:   "ops",
+		SSHKeyRef: "batch2",
+	}), IsNil)
+	expURL, err := url.Parse(fmt.Sprintf("http://%s/%s", baseURL, PostNodesCommission))
+	c.Assert(err, IsNil)
+	httpS, httpC := getHTTPTestClientAndServer(c, okReturner(c, expURL, reqJSON.Bytes()))
+	defer httpS.Close()
+	clstrC := Client{
+		url:   baseURL,
+		httpC: httpC,
+	}
+
+	_, err = clstrC.PostNodesCommissionWithConnection([]string{testNodeName}, "", ansibleMasterGroupName,
+		"ops", "batch2")
+	c.Assert(err, IsNil)
+}
+
+func (s *managerSuite) TestPostNodesDiscoverWithConnection(c *C) {
+	var reqJSON bytes.Buffer
+	c.Assert(json.NewEncoder(&reqJSON).Encode(&APIRequest{
+		Addrs:     []string{"192.168.2.10"},
+		SSHUser:   "ops",
+		SSHKeyRef: "batch2",
+	}), IsNil)
+	expURL, err := url.Parse(fmt.Sprintf("http://%s/%s", baseURL, PostNodesDiscover))
+	c.Assert(err, IsNil)
+	httpS, httpC := getHTTPTestClientAndServer(c, okReturner(c, expURL, reqJSON.Bytes()))
+	defer httpS.Close()
+	clstrC := Client{
+		url:   baseURL,
+		httpC: httpC,
+	}
+
+	_, err = clstrC.PostNodesDiscoverWithConnection([]string{"192.168.2.10"}, "", "ops", "batch2")
+	c.Assert(err, IsNil)
+}
+
+func (s *managerSuite) TestPostNodesDiscoverWithResult(c *C) {
+	httpS, httpC := getHTTPTestClientAndServer(c,
+		func(w http.ResponseWriter, r *http.Request) {
+			c.Assert(r.URL.Path, Equals, "/"+PostNodesDiscover)
+			w.Write([]byte(`{"id":"5","discover":{"discovered":["1.1.1.2"],` +
+				`"updated":{"1.1.1.1":"node1"},"skipped":{"1.1.1.3":"repeated"}}}`))
+		})
+	defer httpS.Close()
+	clstrC := Client{
+		url:   baseURL,
+		httpC: httpC,
+	}
+
+	ref, err := clstrC.PostNodesDiscoverWithResult([]string{"1.1.1.1", "1.1.1.2", "1.1.1.3", "1.1.1.3"}, "")
+	c.Assert(err, IsNil)
+	c.Assert(ref, DeepEquals, &JobRef{
+		ID: "5",
+		Discover: &DiscoverResult{
+			Discovered: []string{"1.1.1.2"},
+			Updated:    map[string]string{"1.1.1.1": "node1"},
+			Skipped:    map[string]string{"1.1.1.3": "repeated"},
+		},
+	})
+}
+
+func (s *managerSuite) TestPostNodesCommissionAsync(c *C) {
+	httpS, httpC := getHTTPTestClientAndServer(c,
+		func(w http.ResponseWriter, r *http.Request) {
+			c.Assert(r.URL.Path, Equals, "/"+PostNodesCommission)
+			c.Assert(r.URL.Query().Get("async"), Equals, "true")
+			w.WriteHeader(http.StatusAccepted)
+			w.Write([]byte(`{"id":"5"}`))
+		})
+	defer httpS.Close()
+	clstrC := Client{
+		url:   baseURL,
+		httpC: httpC,
+	}
+
+	jobID, err := clstrC.PostNodesCommissionAsync([]string{testNodeName}, "", ansibleMasterGroupName)
+	c.Assert(err, IsNil)
+	c.Assert(jobID, Equals, "5")
+}
+
+func (s *managerSuite) TestPostReturnsJobID(c *C) {
+	httpS, httpC := getHTTPTestClientAndServer(c,
+		func(w http.ResponseWriter, r *http.Request) {
+			c.Assert(r.URL.Path, Equals, "/"+PostNodesCommission)
+			c.Assert(r.URL.Query().Get("async"), Equals, "")
+			w.Write([]byte(`{"id":"7"}`))
+		})
+	defer httpS.Close()
+	clstrC := Client{
+		url:   baseURL,
+		httpC: httpC,
+	}
+
+	jobID, err := clstrC.PostNodesCommission([]string{testNodeName}, "", ansibleMasterGroupName)
+	c.Assert(err, IsNil)
+	c.Assert(jobID, Equals, "7")
+}
+
+func (s *managerSuite) TestPostWithIdempotencyKey(c *C) {
+	httpS, httpC := getHTTPTestClientAndServer(c,
+		func(w http.ResponseWriter, r *http.Request) {
+			c.Assert(r.Header.Get(idempotencyKeyHeader), Equals, "key1")
+		})
+	defer httpS.Close()
+	clstrC := Client{
+		url:   baseURL,
+		httpC: httpC,
+	}
+
+	_, err := clstrC.WithIdempotencyKey("key1").PostNodeDecommission(testNodeName, "")
+	c.Assert(err, IsNil)
+}
+
+func (s *managerSuite) TestUnixSocketClient(c *C) {
+	path := filepath.Join(c.MkDir(), "clusterm.sock")
+	// a stale socket file shall be cleaned up
+	c.Assert(ioutil.WriteFile(path, []byte{}, 0600), IsNil)
+
+	l, err := listen(unixAddrPrefix+path, 0, true)
+	c.Assert(err, IsNil)
+	httpS := httptest.NewUnstartedServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			c.Assert(r.URL.Path, Equals, "/"+GetGlobals)
+			w.Write(testGetData)
+		}))
+	httpS.Listener = l
+	httpS.Start()
+	defer httpS.Close()
+
+	resp, err := NewClient(unixAddrPrefix + path).GetGlobals()
+	c.Assert(err, IsNil)
+	c.Assert(resp, DeepEquals, testGetData)
+
+	httpS.Close()
+	_, err = os.Stat(path)
+	c.Assert(os.IsNotExist(err), Equals, true)
+}
+
+func (s *managerSuite) TestGetNodesBatchSuccess(c *C) {
+	expURLStr := fmt.Sprintf("http://%s/%s", baseURL, GetNodesBatchInfo)
+	expURL, err := url.Parse(expURLStr)
+	c.Assert(err, IsNil)
+	httpS, httpC := getHTTPTestClientAndServer(c,
+		func(w http.ResponseWriter, r *http.Request) {
+			c.Assert(r.URL.Path, Equals, expURL.Path)
+			c.Assert(r.URL.Query().Get("names"), Equals, "node1,node2")
+			w.Write(testGetData)
+		})
+	defer httpS.Close()
+	clstrC := Client{
+		url:   baseURL,
+		httpC: httpC,
+	}
+
+	resp, err := clstrC.GetNodes([]string{"node1", "node2"})
+	c.Assert(err, IsNil)
+	c.Assert(resp, DeepEquals, testGetData)
+}
+
+func (s *managerSuite) TestGetDiscoveredNodesSuccess(c *C) {
+	expURLStr := fmt.Sprintf("http://%s/%s", baseURL, GetNodesDiscovered)
+	expURL, err := url.Parse(expURLStr)
+	c.Assert(err, IsNil)
+	httpS, httpC := getHTTPTestClientAndServer(c,
+		func(w http.ResponseWriter, r *http.Request) {
+			c.Assert(r.URL.Path, Equals, expURL.Path)
+			w.Write(testGetData)
+		})
+	defer httpS.Close()
+	clstrC := Client{
+		url:   baseURL,
+		httpC: httpC,
+	}
+
+	resp, err := clstrC.GetDiscoveredNodes()
+	c.Assert(err, IsNil)
+	c.Assert(resp, DeepEquals, testGetData)
+}
+
+func (s *managerSuite) TestGetNodeHistorySuccess(c *C) {
+	expURL, err := url.Parse(fmt.Sprintf("http://%s/%s/%s/history", baseURL, GetNodeInfoPrefix, testNodeName))
+	c.Assert(err, IsNil)
+	httpS, httpC := getHTTPTestClientAndServer(c,
+		func(w http.ResponseWriter, r *http.Request) {
+			c.Assert(r.URL.Path, Equals, expURL.Path)
+			w.Write([]byte(`[{"node":"node1","event":"commissioned","old_state":{"status":"Provisioning"},` +
+				`"new_state":{"status":"Allocated"}}]`))
+		})
+	defer httpS.Close()
+	clstrC := Client{
+		url:   baseURL,
+		httpC: httpC,
+	}
+
+	history, err := clstrC.GetNodeHistory(testNodeName)
+	c.Assert(err, IsNil)
+	c.Assert(history, HasLen, 1)
+	c.Assert(history[0].Event, Equals, NodeEventCommissioned)
+	c.Assert(history[0].NewState.Status, Equals, "Allocated")
+}
+
+func (s *managerSuite) TestGetMetricsSuccess(c *C) {
+	expURLStr := fmt.Sprintf("http://%s/%s", baseURL, GetMetrics)
+	expURL, err := url.Parse(expURLStr)
+	c.Assert(err, IsNil)
+	httpS, httpC := getHTTPTestClientAndServer(c,
+		func(w http.ResponseWriter, r *http.Request) {
+			c.Assert(r.URL.Path, Equals, expURL.Path)
+			w.Write([]byte(`{"req_queue_depth":2,"req_queue_capacity":100,"active_jobs":1}`))
+		})
+	defer httpS.Close()
+	clstrC := Client{
+		url:   baseURL,
+		httpC: httpC,
+	}
+
+	resp, err := clstrC.GetMetrics()
+	c.Assert(err, IsNil)
+	c.Assert(*resp, DeepEquals, Metrics{ReqQueueDepth: 2, ReqQueueCapacity: 100, ActiveJobs: 1})
+}
+
+func (s *managerSuite) TestGetStatusSuccess(c *C) {
+	expURLStr := fmt.Sprintf("http://%s/%s", baseURL, GetStatus)
+	expURL, err := url.Parse(expURLStr)
+	c.Assert(err, IsNil)
+	httpS, httpC := getHTTPTestClientAndServer(c,
+		func(w http.ResponseWriter, r *http.Request) {
+			c.Assert(r.URL.Path, Equals, expURL.Path)
+			w.Write([]byte(`{"ready":true,"uptime":"1m0s","req_queue_depth":1,"active_jobs":[2],` +
+				`"nodes_by_state":{"Discovered":3},"last_job":{"id":1,"status":"Complete"}}`))
+		})
+	defer httpS.Close()
+	clstrC := Client{
+		url:   baseURL,
+		httpC: httpC,
+	}
+
+	resp, err := clstrC.GetStatus()
+	c.Assert(err, IsNil)
+	c.Assert(*resp, DeepEquals, Status{
+		Ready:         true,
+		Uptime:        "1m0s",
+		ReqQueueDepth: 1,
+		ActiveJobs:    []uint64{2},
+		NodesByState:  map[string]int{"Discovered": 3},
+		LastJob:       &JobOutcome{ID: 1, Status: "Complete"},
+	})
+}
+
+func (s *managerSuite) TestStreamLogsSuccess(c *C) {
+	expURLStr := fmt.Sprintf("http://%s/%s/%s", baseURL, GetJobLogPrefix, testJobLabel)
+	expURL, err := url.Parse(expURLStr)
+	c.Assert(err, IsNil)
+	httpS, httpC := getHTTPTestClientAndServer(c, okGetReturner(c, expURL))
+	defer httpS.Close()
+	clstrC := Client{
+		url:   baseURL,
+		httpC: httpC,
+	}
+
+	resp, err := clstrC.StreamLogs(testJobLabel)
+	c.Assert(err, IsNil)
+	body, err := ioutil.ReadAll(resp)
+	c.Assert(err, IsNil)
+	c.Assert(body, DeepEquals, testGetData)
+}
+
+func (s *managerSuite) TestGetError(c *C) {
+	expURLStr := fmt.Sprintf("http://%s/%s/%s", baseURL, GetNodeInfoPrefix, testNodeName)
+	expURL, err := url.Parse(expURLStr)
+	c.Assert(err, IsNil)
+	httpS, httpC := getHTTPTestClientAndServer(c, failureReturner(c, expURL, []byte{}))
+	defer httpS.Close()
+	clstrC := Client{
+		url:   baseURL,
+		httpC: httpC,
+	}
+
+	_, err = clstrC.GetNode(testNodeName)
+	c.Assert(err, ErrorMatches, ".*test failure\n")
+}
+
+func (s *managerSuite) TestClientReusesConnections(c *C) {
+	var (
+		mutex sync.Mutex
+		conns int
+	)
+	httpS := httptest.NewUnstartedServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Write(testGetData)
+		}))
+	httpS.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			mutex.Lock()
+			defer mutex.Unlock()
+			conns++
+		}
+	}
+	httpS.Start()
+	defer httpS.Close()
+
+	clstrC := NewClient(httpS.Listener.Addr().String()).WithMaxIdleConns(4).WithIdleConnTimeout(time.Minute)
+	for i := 0; i < 5; i++ {
+		resp, err := clstrC.GetGlobals()
+		c.Assert(err, IsNil)
+		c.Assert(resp, DeepEquals, testGetData)
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	c.Assert(conns, Equals, 1)
+}
+
+func (s *managerSuite) TestClientTransportTuning(c *C) {
+	clstrC := NewClient(baseURL)
+	c.Assert(clstrC.httpC, Equals, defaultHTTPClient)
+
+	tunedC := clstrC.WithMaxIdleConns(4).WithIdleConnTimeout(time.Minute)
+	t := tunedC.httpC.Transport.(*http.Transport)
+	c.Assert(t.MaxIdleConns, Equals, 4)
+	c.Assert(t.MaxIdleConnsPerHost, Equals, 4)
+	c.Assert(t.IdleConnTimeout, Equals, time.Minute)
+
+	// the shared transport is left as is
+	t = defaultHTTPClient.Transport.(*http.Transport)
+	c.Assert(t.MaxIdleConns, Equals, defaultMaxIdleConns)
+	c.Assert(t.IdleConnTimeout, Equals, defaultIdleConnTimeout)
+}
+
+func (s *managerSuite) TestClientCache(c *C) {
+	reqs := map[string]int{}
+	httpS, httpC := getHTTPTestClientAndServer(c,
+		func(w http.ResponseWriter, r *http.Request) {
+			reqs[r.URL.Path]++
+			if r.Method == "GET" {
+				w.Write(testGetData)
+			}
+		})
+	defer httpS.Close()
+	clstrC := NewClientWithHTTPClient(baseURL, httpC).WithCache(time.Minute)
+	nodePath := "/" + GetNodeInfoPrefix + "/node1"
+
+	for i := 0; i < 3; i++ {
+		resp, err := clstrC.GetNode("node1")
+		c.Assert(err, IsNil)
+		c.Assert(resp, DeepEquals, testGetData)
+		resp, err = clstrC.GetAllNodes()
+		c.Assert(err, IsNil)
+		c.Assert(resp, DeepEquals, testGetData)
+	}
+	c.Assert(reqs[nodePath], Equals, 1)
+	c.Assert(reqs["/"+GetNodesInfo], Equals, 1)
+
+	// the cache is bypassed after a mutating request
+	_, err := clstrC.PostNodeCommission("node1", "", "")
+	c.Assert(err, IsNil)
+	_, err = clstrC.GetNode("node1")
+	c.Assert(err, IsNil)
+	c.Assert(reqs[nodePath], Equals, 2)
+
+	clstrC.InvalidateCache()
+	_, err = clstrC.GetAllNodes()
+	c.Assert(err, IsNil)
+	c.Assert(reqs["/"+GetNodesInfo], Equals, 2)
+
+	// the cache is not shared with the derived clients
+	_, err = clstrC.WithAccept("application/yaml").GetNode("node1")
+	c.Assert(err, IsNil)
+	c.Assert(reqs[nodePath], Equals, 3)
+}
+
+func (s *managerSuite) TestClientCacheExpiry(c *C) {
+	reqs := 0
+	httpS, httpC := getHTTPTestClientAndServer(c,
+		func(w http.ResponseWriter, r *http.Request) {
+			reqs++
+			w.Write(testGetData)
+		})
+	defer httpS.Close()
+	clstrC := NewClientWithHTTPClient(baseURL, httpC).WithCache(time.Millisecond)
+
+	_, err := clstrC.GetNode("node1")
+	c.Assert(err, IsNil)
+	time.Sleep(5 * time.Millisecond)
+	_, err = clstrC.GetNode("node1")
+	c.Assert(err, IsNil)
+	c.Assert(reqs, Equals, 2)
+
+	// a client without a cache always issues the request
+	clstrC = NewClientWithHTTPClient(baseURL, httpC)
+	_, err = clstrC.GetNode("node1")
+	c.Assert(err, IsNil)
+	_, err = clstrC.GetNode("node1")
+	c.Assert(err, IsNil)
+	c.Assert(reqs, Equals, 4)
+}
+
+func (s *managerSuite) TestPostNodesDecommissionContinueOnError(c *C) {
+	exptdErr := &NodesError{
+		Accepted: []string{"node1"},
+		Failed:   map[string]string{"node2": "node is not discovered"},
+		JobID:    "1",
+	}
+	httpS, httpC := getHTTPTestClientAndServer(c,
+		func(w http.ResponseWriter, r *http.Request) {
+			c.Assert(r.URL.Path, Equals, "/"+PostNodesDecommission)
+			req := &APIRequest{}
+			c.Assert(json.NewDecoder(r.Body).Decode(req), IsNil)
+			c.Assert(req.ContinueOnError, Equals, true)
+			writeError(w, exptdErr)
+		})
+	defer httpS.Close()
+	clstrC := Client{
+		url:   baseURL,
+		httpC: httpC,
+	}
+
+	_, err := clstrC.PostNodesDecommissionContinueOnError([]string{"node1", "node2"}, "")
+	c.Assert(IsNodesError(err), Equals, true)
+	c.Assert(err, DeepEquals, exptdErr)
+}
+
+func (s *managerSuite) TestPostNodesCommissionBySerial(c *C) {
+	httpS, httpC := getHTTPTestClientAndServer(c,
+		func(w http.ResponseWriter, r *http.Request) {
+			c.Assert(r.URL.Path, Equals, "/"+PostNodesCommission)
+			req := &APIRequest{}
+			c.Assert(json.NewDecoder(r.Body).Decode(req), IsNil)
+			c.Assert(req.Serials, DeepEquals, []string{"s1", "s2"})
+			c.Assert(req.Nodes, IsNil)
+			c.Assert(req.HostGroup, Equals, "service-master")
+			w.Write([]byte(`{"id":"1"}`))
+		})
+	defer httpS.Close()
+	clstrC := Client{
+		url:   baseURL,
+		httpC: httpC,
+	}
+
+	id, err := clstrC.PostNodesCommissionBySerial([]string{"s1", "s2"}, "", "service-master")
+	c.Assert(err, IsNil)
+	c.Assert(id, Equals, "1")
+}
+
+func (s *managerSuite) TestPostNodesCommissionWithPreflight(c *C) {
+	exptdErr := &NodesError{
+		Accepted: []string{},
+		Failed:   map[string]string{"node2": "connection refused"},
+	}
+	httpS, httpC := getHTTPTestClientAndServer(c,
+		func(w http.ResponseWriter, r *http.Request) {
+			c.Assert(r.URL.Path, Equals, "/"+PostNodesCommission)
+			req := &APIRequest{}
+			c.Assert(json.NewDecoder(r.Body).Decode(req), IsNil)
+			c.Assert(req.Preflight, Equals, true)
+			c.Assert(req.ContinueOnError, Equals, false)
+			writeError(w, exptdErr)
+		})
+	defer httpS.Close()
+	clstrC := Client{
+		url:   baseURL,
+		httpC: httpC,
+	}
+
+	_, err := clstrC.PostNodesCommissionWithPreflight([]string{"node1", "node2"}, "", "", false)
+	c.Assert(IsNodesError(err), Equals, true)
+	c.Assert(err, DeepEquals, exptdErr)
+}
+
+func (s *managerSuite) TestDiffNodes(c *C) {
+	exptdDiffs := []NodeDiff{{Field: "tags.rack", A: "r1", B: "r2"}}
+	httpS, httpC := getHTTPTestClientAndServer(c,
+		func(w http.ResponseWriter, r *http.Request) {
+			c.Assert(r.URL.Path, Equals, "/"+GetNodesDiff)
+			c.Assert(r.URL.Query().Get("a"), Equals, "node1")
+			c.Assert(r.URL.Query().Get("b"), Equals, "node2")
+			c.Assert(json.NewEncoder(w).Encode(exptdDiffs), IsNil)
+		})
+	defer httpS.Close()
+	clstrC := Client{
+		url:   baseURL,
+		httpC: httpC,
+	}
+
+	diffs, err := clstrC.DiffNodes("node1", "node2")
+	c.Assert(err, IsNil)
+	c.Assert(diffs, DeepEquals, exptdDiffs)
+}
+
+func (s *managerSuite) TestGetJobPlan(c *C) {
+	expURLStr := fmt.Sprintf("http://%s/%s/%s", baseURL, GetJobPrefix, testJobLabel)
+	expURL, err := url.Parse(expURLStr)
+	c.Assert(err, IsNil)
+	httpS, httpC := getHTTPTestClientAndServer(c,
+		func(w http.ResponseWriter, r *http.Request) {
+			c.Assert(r.URL.Path, Equals, expURL.Path)
+			w.Write([]byte(`{"status":"Complete","plan":{"node1":[{"task":"install docker","diff":"--- before"}]}}`))
+		})
+	defer httpS.Close()
+	clstrC := Client{
+		url:   baseURL,
+		httpC: httpC,
+	}
+
+	plan, err := clstrC.GetJobPlan(testJobLabel)
+	c.Assert(err, IsNil)
+	c.Assert(plan, DeepEquals, ansible.Plan{"node1": {{Task: "install docker", Diff: "--- before"}}})
+}
+
+func (s *managerSuite) TestPostNodesCommissionCheck(c *C) {
+	expURLStr := fmt.Sprintf("http://%s/%s", baseURL, PostNodesCommission)
+	expURL, err := url.Parse(expURLStr)
+	c.Assert(err, IsNil)
+	httpS, httpC := getHTTPTestClientAndServer(c,
+		func(w http.ResponseWriter, r *http.Request) {
+			c.Assert(r.URL.Path, Equals, expURL.Path)
+			req := &APIRequest{}
+			c.Assert(json.NewDecoder(r.Body).Decode(req), IsNil)
+			c.Assert(req.Check, Equals, true)
+			c.Assert(req.Nodes, DeepEquals, []string{"node1"})
+		})
+	defer httpS.Close()
+	clstrC := Client{
+		url:   baseURL,
+		httpC: httpC,
+	}
+
+	_, err = clstrC.PostNodesCommissionCheck([]string{"node1"}, "", ansibleMasterGroupName)
+	c.Assert(err, IsNil)
+}
+
+func (s *managerSuite) TestPostNodesCommissionBulk(c *C) {
+	expURLStr := fmt.Sprintf("http://%s/%s", baseURL, PostNodesCommissionBulk)
+	expURL, err := url.Parse(expURLStr)
+	c.Assert(err, IsNil)
+	plan := &CommissionPlan{Groups: []CommissionPlanGroup{
+		{Nodes: []string{"node1"}, HostGroup: ansibleMasterGroupName},
+		{Nodes: []string{"node2"}, HostGroup: ansibleWorkerGroupName, ExtraVars: `{"foo":"bar"}`},
+	}}
+	httpS, httpC := getHTTPTestClientAndServer(c,
+		func(w http.ResponseWriter, r *http.Request) {
+			c.Assert(r.URL.Path, Equals, expURL.Path)
+			req := &APIRequest{}
+			c.Assert(json.NewDecoder(r.Body).Decode(req), IsNil)
+			c.Assert(req.CommissionPlan, DeepEquals, plan)
+		})
+	defer httpS.Close()
+	clstrC := Client{
+		url:   baseURL,
+		httpC: httpC,
+	}
+
+	_, err = clstrC.PostNodesCommissionBulk(plan)
+	c.Assert(err, IsNil)
+}
+
+func (s *managerSuite) TestGetNodeExtraVarsSuccess(c *C) {
+	expURL, err := url.Parse(fmt.Sprintf("http://%s/%s/%s/extravars", baseURL, GetNodeInfoPrefix, testNodeName))
+	c.Assert(err, IsNil)
+	httpS, httpC := getHTTPTestClientAndServer(c,
+		func(w http.ResponseWriter, r *http.Request) {
+			c.Assert(r.URL.Path, Equals, expURL.Path)
+			w.Write([]byte(`{"extra_vars":{"foo":"bar"},"vault_encrypted":true}`))
+		})
+	defer httpS.Close()
+	clstrC := Client{
+		url:   baseURL,
+		httpC: httpC,
+	}
+
+	vars, err := clstrC.GetNodeExtraVars(testNodeName)
+	c.Assert(err, IsNil)
+	c.Assert(vars.ExtraVars, DeepEquals, map[string]interface{}{"foo": "bar"})
+	c.Assert(vars.VaultEncrypted, Equals, true)
+}
+
+func (s *managerSuite) TestPostNodesDecommissionLastMaster(c *C) {
+	expURLStr := fmt.Sprintf("http://%s/%s", baseURL, PostNodesDecommission)
+	expURL, err := url.Parse(expURLStr)
+	c.Assert(err, IsNil)
+	httpS, httpC := getHTTPTestClientAndServer(c,
+		func(w http.ResponseWriter, r *http.Request) {
+			c.Assert(r.URL.Path, Equals, expURL.Path)
+			req := &APIRequest{}
+			c.Assert(json.NewDecoder(r.Body).Decode(req), IsNil)
+			if req.Force {
+				w.Write([]byte(`{"id":"1"}`))
+				return
+			}
+			writeError(w, errLastMaster(req.Nodes))
+		})
+	defer httpS.Close()
+	clstrC := Client{
+		url:   baseURL,
+		httpC: httpC,
+	}
+
+	_, err = clstrC.PostNodesDecommission([]string{"node1"}, "")
+	c.Assert(IsLastMasterError(err), Equals, true)
+	c.Assert(err.Error(), Equals, errLastMaster([]string{"node1"}).Error())
+
+	id, err := clstrC.PostNodesDecommissionForce([]string{"node1"}, "")
+	c.Assert(err, IsNil)
+	c.Assert(id, Equals, "1")
+}
+
+func (s *managerSuite) TestWithProxy(c *C) {
+	proxied := []string{}
+	proxyS := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			// the proxy receives the requests for cluster manager's address
+			c.Assert(r.URL.Host, Equals, baseURL)
+			proxied = append(proxied, r.URL.Path)
+			w.Write(testGetData)
+		}))
+	defer proxyS.Close()
+
+	clstrC := NewClient(baseURL).WithProxy(proxyS.URL)
+	body, err := clstrC.GetNode(testNodeName)
+	c.Assert(err, IsNil)
+	c.Assert(body, DeepEquals, testGetData)
+
+	// the logs are streamed through the proxy as well
+	r, err := clstrC.StreamLogs(testJobLabel)
+	c.Assert(err, IsNil)
+	body, err = ioutil.ReadAll(r)
+	c.Assert(err, IsNil)
+	c.Assert(r.Close(), IsNil)
+	c.Assert(body, DeepEquals, testGetData)
+	c.Assert(proxied, DeepEquals, []string{
+		fmt.Sprintf("/%s/%s", GetNodeInfoPrefix, testNodeName),
+		fmt.Sprintf("/%s/%s", GetJobLogPrefix, testJobLabel),
+	})
+
+	// an invalid proxy fails the requests
+	_, err = NewClient(baseURL).WithProxy("proxy:3128").GetNode(testNodeName)
+	c.Assert(err, ErrorMatches, ".*invalid proxy url.*")
+}
+
+func (s *managerSuite) TestWithProxyDisabled(c *C) {
+	req, err := http.NewRequest("GET", "http://"+baseURL, nil)
+	c.Assert(err, IsNil)
+	proxyURL, err := NewClient(baseURL).WithProxy("").httpC.Transport.(*http.Transport).Proxy(req)
+	c.Assert(err, IsNil)
+	c.Assert(proxyURL, IsNil)
+
+	// the environment's proxy is honored by default
+	c.Assert(NewClient(baseURL).httpC.Transport.(*http.Transport).Proxy, NotNil)
+	// the unix socket clients are never proxied
+	c.Assert(NewClient("unix:/tmp/clusterm.sock").WithProxy("http://proxy:3128").httpC.Transport.(*http.Transport).Proxy, IsNil)
 }
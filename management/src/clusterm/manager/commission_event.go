@@ -3,9 +3,13 @@ package manager
 import (
 	"fmt"
 	"io"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/contiv/cluster/management/src/configuration"
+	"github.com/contiv/cluster/management/src/inventory"
 	"github.com/contiv/errored"
 )
 
@@ -13,40 +17,96 @@ func errActiveJob(desc string) error {
 	return errored.Errorf("there is already an active job, please try in sometime. Job: %s", desc)
 }
 
+func errConflictingJob(name, desc string) error {
+	return errored.Errorf("node %q is part of an active job, please try in sometime. Job: %s", name, desc)
+}
+
+func errVerificationFailed(err error) error {
+	return errored.Errorf("the verification of the configured nodes failed. Error: %v", err)
+}
+
+func errNodesNotJoined(nodeNames []string, timeout time.Duration) error {
+	return errored.Errorf("nodes %v didn't join the cluster within %s of commission", nodeNames, timeout)
+}
+
 // commissionEvent triggers the commission workflow
 type commissionEvent struct {
+	jobTrigger
 	mgr       *Manager
 	nodeNames []string
 	extraVars string
 	hostGroup string
+	// extraGroups are the host-groups the nodes are added to, in addition to hostGroup
+	extraGroups []string
+	playbook    string
+	timeout     time.Duration // the job is cancelled if it runs longer than this
+	// inventory, if set, is the ansible inventory that is used for the run
+	// instead of the managed one
+	inventory string
+	// waitReady, when true, makes the job wait for the configured nodes to be
+	// part of the cluster, upto the ready timeout
+	waitReady    bool
+	readyTimeout time.Duration
+	// check, when true, runs the playbook in check mode. The job reports the
+	// changes it would make as it's plan, and the nodes are left as is
+	check bool
+	// verifyPlaybook, if set, is run after the nodes are configured to verify
+	// them, like that their services are up. The nodes that fail the
+	// verification are not commissioned
+	verifyPlaybook string
+	// preflight is the result of the preflight check of the nodes, keyed by
+	// node name. It is nil if the nodes were not checked
+	preflight map[string]string
 
 	_hosts  configuration.SubsysHosts
 	_enodes map[string]*node
 }
 
 // newCommissionEvent creates and returns commissionEvent
-func newCommissionEvent(mgr *Manager, nodeNames []string, extraVars, hostGroup string) *commissionEvent {
+func newCommissionEvent(mgr *Manager, nodeNames []string, extraVars, hostGroup, playbook string,
+	timeout time.Duration) *commissionEvent {
 	return &commissionEvent{
 		mgr:       mgr,
 		nodeNames: nodeNames,
 		extraVars: extraVars,
 		hostGroup: hostGroup,
+		playbook:  playbook,
+		timeout:   timeout,
 	}
 }
 
 func (e *commissionEvent) String() string {
-	return fmt.Sprintf("commissionEvent: nodes:%v extra-vars:%v host-group:%v",
-		e.nodeNames, e.extraVars, e.hostGroup)
+	return fmt.Sprintf("commissionEvent: nodes:%v extra-vars:%v host-groups:%v playbook:%v wait-ready:%v check:%v verify-playbook:%v",
+		e.nodeNames, configuration.RedactExtraVars(e.extraVars), e.hostGroups(), e.playbook, e.waitReady, e.check,
+		e.verifyPlaybook)
 }
 
 func (e *commissionEvent) process() error {
 	// err shouldn't be redefined below
-	var err error
+	var (
+		err error
+		job *Job
+	)
+
+	// an identical request that is already in flight, is not run again
+	key := e.jobInFlightKey()
+	if aj := e.mgr.findInFlightJob(key); aj != nil {
+		logrus.Infof("an identical job is already active, not running it again. Job: %s", aj)
+		e.job = aj
+		return nil
+	}
 
-	err = e.mgr.checkAndSetActiveJob(
+	job, err = e.checkAndSetActiveJob(
+		e.mgr,
 		e.String(),
-		e.configureOrCleanupOnErrorRunner,
+		e.nodeNames,
+		e.timeout,
+		e.runner(),
 		func(status JobStatus, errRet error) {
+			if e.check {
+				// the nodes are left as is in check mode
+				return
+			}
 			if status == Errored {
 				logrus.Errorf("configuration job failed. Error: %v", errRet)
 				// set assets as unallocated
@@ -61,9 +121,26 @@ func (e *commissionEvent) process() error {
 	}
 	defer func() {
 		if err != nil {
-			e.mgr.resetActiveJob()
+			e.mgr.resetActiveJob(job)
 		}
 	}()
+	e.setPlaybook(e.mgr, configureAction(e.playbook), e.playbook)
+
+	job.inFlightKey = key
+	job.check = e.check
+	job.hostGroups = e.hostGroups()
+	job.preflight = e.preflight
+
+	// the job can be retried on the subset of nodes that fail
+	job.retryEvent = func(nodeNames []string, timeout time.Duration) jobEvent {
+		re := newCommissionEvent(e.mgr, nodeNames, e.extraVars, e.hostGroup, e.playbook, timeout)
+		re.extraGroups = e.extraGroups
+		re.inventory = e.inventory
+		re.waitReady, re.readyTimeout = e.waitReady, e.readyTimeout
+		re.check = e.check
+		re.verifyPlaybook = e.verifyPlaybook
+		return re
+	}
 
 	// validate event data
 	if err = e.eventValidate(); err != nil {
@@ -75,18 +152,42 @@ func (e *commissionEvent) process() error {
 		return err
 	}
 
-	// set assets as provisioning
-	if err = e.mgr.setAssetsStatusAtomic(e.nodeNames, e.mgr.inventory.SetAssetProvisioning,
-		e.mgr.inventory.SetAssetUnallocated); err != nil {
-		return err
+	// set assets as provisioning, unless the nodes are left as is
+	if !e.check {
+		if err = e.mgr.setAssetsStatusAtomic(e.nodeNames, e.mgr.inventory.SetAssetProvisioning,
+			e.mgr.inventory.SetAssetUnallocated); err != nil {
+			return err
+		}
 	}
 
+	e.mgr.setLastExtraVars(e.nodeNames, e.extraVars)
+
 	// trigger node configuration
-	go e.mgr.runActiveJob()
+	go e.mgr.runActiveJob(job)
 
 	return nil
 }
 
+// jobNodes returns the nodes the triggered job acts upon
+func (e *commissionEvent) jobNodes() ([]string, bool) {
+	return e.nodeNames, false
+}
+
+// jobInFlightKey returns the key that identifies the identical requests for the triggered job
+func (e *commissionEvent) jobInFlightKey() string {
+	kind := "commission"
+	if e.check {
+		kind = "commission-check"
+	}
+	return inFlightKey(kind, e.nodeNames, strings.Join(e.hostGroups(), ","), e.playbook,
+		e.extraVars+e.inventory+e.verifyPlaybook)
+}
+
+// hostGroups returns all the host-groups the nodes are added to
+func (e *commissionEvent) hostGroups() []string {
+	return joinHostGroups(e.hostGroup, e.extraGroups)
+}
+
 func (e *commissionEvent) eventValidate() error {
 	var err error
 	e._enodes, err = e.mgr.commonEventValidate(e.nodeNames)
@@ -97,51 +198,76 @@ func (e *commissionEvent) eventValidate() error {
 	if !IsValidHostGroup(e.hostGroup) {
 		return errored.Errorf("invalid or empty host-group specified: %q", e.hostGroup)
 	}
+	for _, group := range e.extraGroups {
+		if !IsValidHostGroup(group) {
+			return errored.Errorf("invalid host-group specified: %q", group)
+		}
+	}
 
 	// when workers are being configured, make sure that there is atleast one service-master
-	if e.hostGroup == ansibleWorkerGroupName {
-		masterCommissioned := false
-		for name := range e.mgr.nodes {
-			if _, ok := e._enodes[name]; ok {
-				// skip nodes in the event
-				continue
-			}
+	groups := e.hostGroups()
+	if inHostGroup(groups, ansibleWorkerGroupName) && !inHostGroup(groups, ansibleMasterGroupName) {
+		if !e.mgr.isMasterCommissioned(e.nodeNames) {
+			return errored.Errorf("Cannot commission a worker node without existence of a master node in the cluster, make sure atleast one master node is commissioned.")
+		}
+	}
+	return nil
+}
 
-			isDiscoveredAndAllocated, err := e.mgr.isDiscoveredAndAllocatedNode(name)
-			if err != nil || !isDiscoveredAndAllocated {
-				if err != nil {
-					logrus.Debugf("a node check failed for %q. Error: %s", name, err)
-				}
-				// skip hosts that are not yet provisioned or not in discovered state
-				continue
-			}
+// isMasterCommissioned returns true if atleast one of the nodes, other than
+// the specified ones, is a commissioned service-master
+func (m *Manager) isMasterCommissioned(except []string) bool {
+	skip := map[string]bool{}
+	for _, name := range except {
+		skip[name] = true
+	}
+	for name := range m.nodes {
+		if skip[name] {
+			// skip the specified nodes
+			continue
+		}
 
-			isMasterNode, err := e.mgr.isMasterNode(name)
-			if err != nil || !isMasterNode {
-				if err != nil {
-					logrus.Debugf("a node check failed for %q. Error: %s", name, err)
-				}
-				//skip the hosts that are not in master group
-				continue
+		isDiscoveredAndAllocated, err := m.isDiscoveredAndAllocatedNode(name)
+		if err != nil || !isDiscoveredAndAllocated {
+			if err != nil {
+				logrus.Debugf("a node check failed for %q. Error: %s", name, err)
 			}
-
-			// found a master node
-			masterCommissioned = true
-			break
+			// skip hosts that are not yet provisioned or not in discovered state
+			continue
 		}
-		if !masterCommissioned {
-			return errored.Errorf("Cannot commission a worker node without existence of a master node in the cluster, make sure atleast one master node is commissioned.")
+
+		isMasterNode, err := m.isMasterNode(name)
+		if err != nil || !isMasterNode {
+			if err != nil {
+				logrus.Debugf("a node check failed for %q. Error: %s", name, err)
+			}
+			//skip the hosts that are not in master group
+			continue
 		}
+
+		// found a master node
+		return true
 	}
-	return nil
+	return false
 }
 
 // prepareInventory adds the specified nodes to the specified host-group
 func (e *commissionEvent) prepareInventory() error {
+	if e.inventory != "" {
+		// the managed inventory is left as is
+		e._hosts = configuration.AnsibleInventory(e.inventory)
+		return nil
+	}
 	hosts := []*configuration.AnsibleHost{}
+	e.mgr.nodesMutex.Lock()
+	defer e.mgr.nodesMutex.Unlock()
 	for _, node := range e._enodes {
 		hostInfo := node.Cfg.(*configuration.AnsibleHost)
-		hostInfo.SetGroup(e.hostGroup)
+		if e.check {
+			// the node's host-groups are not changed in check mode
+			hostInfo = hostInfo.Clone()
+		}
+		hostInfo.SetGroups(e.hostGroups())
 		hosts = append(hosts, hostInfo)
 	}
 	e._hosts = hosts
@@ -149,16 +275,35 @@ func (e *commissionEvent) prepareInventory() error {
 	return nil
 }
 
+// runner returns the job runner for the event
+func (e *commissionEvent) runner() JobRunner {
+	if e.check {
+		return e.checkRunner
+	}
+	return e.configureOrCleanupOnErrorRunner
+}
+
+// checkRunner is the job runner that runs the configuration playbook on one or
+// more nodes in check mode. There is nothing to cleanup on failure
+func (e *commissionEvent) checkRunner(cancelCh CancelChannel, jobLogs io.Writer) error {
+	outReader, cancelFunc, errCh := configure(e.subsys(e.mgr), e._hosts, e.playbook, e.extraVars, true)
+	return logOutputAndReturnStatus(outReader, errCh, cancelCh, cancelFunc, jobLogs)
+}
+
 // configureOrCleanupOnErrorRunner is the job runner that runs configuration playbooks on one or more nodes.
-// It runs cleanup playbook on failure
+// It runs cleanup playbook on failure. The configured nodes are then verified,
+// if a verify playbook is set
 func (e *commissionEvent) configureOrCleanupOnErrorRunner(cancelCh CancelChannel, jobLogs io.Writer) error {
-	outReader, cancelFunc, errCh := e.mgr.configuration.Configure(e._hosts, e.extraVars)
+	outReader, cancelFunc, errCh := configure(e.subsys(e.mgr), e._hosts, e.playbook, e.extraVars, false)
 	cfgErr := logOutputAndReturnStatus(outReader, errCh, cancelCh, cancelFunc, jobLogs)
 	if cfgErr == nil {
-		return nil
+		if err := e.waitReadyNodes(cancelCh, jobLogs); err != nil {
+			return err
+		}
+		return e.verifyNodes(cancelCh, jobLogs)
 	}
 	logrus.Errorf("configuration failed, starting cleanup. Error: %s", cfgErr)
-	outReader, cancelFunc, errCh = e.mgr.configuration.Cleanup(e._hosts, e.extraVars)
+	outReader, cancelFunc, errCh = e.subsys(e.mgr).Cleanup(e._hosts, e.extraVars)
 	if err := logOutputAndReturnStatus(outReader, errCh, cancelCh, cancelFunc, jobLogs); err != nil {
 		logrus.Errorf("cleanup failed. Error: %s", err)
 	}
@@ -166,3 +311,63 @@ func (e *commissionEvent) configureOrCleanupOnErrorRunner(cancelCh CancelChannel
 	//return the error status from provisioning
 	return cfgErr
 }
+
+// waitReadyNodes waits, if requested, for the configured nodes to be part of
+// the cluster as seen by the monitoring subsystem
+func (e *commissionEvent) waitReadyNodes(cancelCh CancelChannel, jobLogs io.Writer) error {
+	if !e.waitReady {
+		return nil
+	}
+	fmt.Fprintf(jobLogs, "==> waiting upto %s for nodes %v to join the cluster\n", e.readyTimeout, e.nodeNames)
+	pending, err := waitForNodes(cancelCh, jobLogs, e.readyTimeout, e.pendingJoin)
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		return errNodesNotJoined(pending, e.readyTimeout)
+	}
+	fmt.Fprintf(jobLogs, "==> all nodes joined the cluster\n")
+	return nil
+}
+
+// verifyNodes runs the verify playbook, if set, on the configured nodes. The
+// nodes are not cleaned up if the verification fails, so that they can be
+// looked into
+func (e *commissionEvent) verifyNodes(cancelCh CancelChannel, jobLogs io.Writer) error {
+	if e.verifyPlaybook == "" {
+		return nil
+	}
+	if e.job != nil {
+		// the verification is summarized separately from the main run
+		e.job.beginVerification()
+	}
+	fmt.Fprintf(jobLogs, "==> verify phase: verifying nodes %v using playbook %q\n", e.nodeNames, e.verifyPlaybook)
+	outReader, cancelFunc, errCh := e.subsys(e.mgr).RunPlaybook(e._hosts, e.verifyPlaybook, e.extraVars)
+	if err := logOutputAndReturnStatus(outReader, errCh, cancelCh, cancelFunc, jobLogs); err != nil {
+		fmt.Fprintf(jobLogs, "==> verify phase failed. Error: %v\n", err)
+		if err == errJobCancelled {
+			return err
+		}
+		return errVerificationFailed(err)
+	}
+	fmt.Fprintf(jobLogs, "==> all nodes passed the verification\n")
+	return nil
+}
+
+// pendingJoin returns the sorted names of the nodes that are not discovered
+func (e *commissionEvent) pendingJoin() []string {
+	e.mgr.nodesMutex.RLock()
+	defer e.mgr.nodesMutex.RUnlock()
+	pending := []string{}
+	for name, node := range e._enodes {
+		if node.Inv == nil {
+			pending = append(pending, name)
+			continue
+		}
+		if _, state := node.Inv.GetStatus(); state != inventory.Discovered {
+			pending = append(pending, name)
+		}
+	}
+	sort.Strings(pending)
+	return pending
+}
@@ -0,0 +1,172 @@
+// +build unittest
+
+package manager
+
+import (
+	"bytes"
+	"strings"
+	"time"
+
+	"github.com/contiv/cluster/management/src/ansible"
+	"github.com/contiv/cluster/management/src/configuration"
+	"github.com/contiv/cluster/management/src/inventory"
+	"github.com/contiv/errored"
+	. "gopkg.in/check.v1"
+)
+
+type commissionSuite struct {
+}
+
+var _ = Suite(&commissionSuite{})
+
+func newTestCommissionEvent(cfg *fakeConfigSubsys, waitReady bool, readyTimeout time.Duration) *commissionEvent {
+	e := newCommissionEvent(&Manager{configuration: cfg}, []string{"node1", "node2"}, "", "", "site.yml", 0)
+	e.waitReady, e.readyTimeout = waitReady, readyTimeout
+	e._enodes = map[string]*node{
+		"node1": {Inv: inventory.NewAssetWithState(nil, "node1", inventory.Provisioning, inventory.Discovered)},
+		"node2": {Inv: inventory.NewAssetWithState(nil, "node2", inventory.Provisioning, inventory.Disappeared)},
+	}
+	return e
+}
+
+func (s *commissionSuite) TestCommissionWaitReady(c *C) {
+	defer func(interval time.Duration) { rejoinPollInterval = interval }(rejoinPollInterval)
+	rejoinPollInterval = time.Millisecond
+
+	cfg := &fakeConfigSubsys{}
+	e := newTestCommissionEvent(cfg, true, time.Minute)
+	// node2 joins once configured
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		e.mgr.nodesMutex.Lock()
+		defer e.mgr.nodesMutex.Unlock()
+		e._enodes["node2"].Inv = inventory.NewAssetWithState(nil, "node2", inventory.Provisioning,
+			inventory.Discovered)
+	}()
+	var logs bytes.Buffer
+	c.Assert(e.configureOrCleanupOnErrorRunner(make(CancelChannel), &logs), IsNil)
+	c.Assert(cfg.ran, DeepEquals, []string{"site.yml"})
+}
+
+func (s *commissionSuite) TestCommissionReadyTimeout(c *C) {
+	defer func(interval time.Duration) { rejoinPollInterval = interval }(rejoinPollInterval)
+	rejoinPollInterval = time.Millisecond
+
+	e := newTestCommissionEvent(&fakeConfigSubsys{}, true, 20*time.Millisecond)
+	var logs bytes.Buffer
+	err := e.configureOrCleanupOnErrorRunner(make(CancelChannel), &logs)
+	c.Assert(err, NotNil)
+	c.Assert(err.Error(), Equals, errNodesNotJoined([]string{"node2"}, 20*time.Millisecond).Error())
+
+	// the node that didn't join is failed in the recap
+	recap, err := ansible.ParseRecap(&logs)
+	c.Assert(err, IsNil)
+	c.Assert(recap.FailedHosts(), DeepEquals, []string{"node2"})
+}
+
+func (s *commissionSuite) TestCommissionNoWaitReady(c *C) {
+	e := newTestCommissionEvent(&fakeConfigSubsys{}, false, time.Minute)
+	var logs bytes.Buffer
+	c.Assert(e.configureOrCleanupOnErrorRunner(make(CancelChannel), &logs), IsNil)
+}
+
+func (s *commissionSuite) TestCommissionVerify(c *C) {
+	cfg := &fakeConfigSubsys{}
+	e := newTestCommissionEvent(cfg, false, time.Minute)
+	e.verifyPlaybook = "verify.yml"
+	e.job = NewJob("", nil, nil)
+	var logs bytes.Buffer
+	c.Assert(e.configureOrCleanupOnErrorRunner(make(CancelChannel), &logs), IsNil)
+	c.Assert(cfg.ran, DeepEquals, []string{"site.yml", "verify.yml"})
+	c.Assert(strings.Contains(logs.String(), "==> verify phase"), Equals, true)
+}
+
+func (s *commissionSuite) TestCommissionVerifyFailure(c *C) {
+	verifyErr := errored.Errorf("service not running")
+	cfg := &fakeConfigSubsys{errs: map[string]error{"verify.yml": verifyErr}}
+	e := newTestCommissionEvent(cfg, false, time.Minute)
+	e.verifyPlaybook = "verify.yml"
+	var logs bytes.Buffer
+	err := e.configureOrCleanupOnErrorRunner(make(CancelChannel), &logs)
+	c.Assert(err, NotNil)
+	c.Assert(err.Error(), Equals, errVerificationFailed(verifyErr).Error())
+	// the nodes are not cleaned up if the verification fails
+	c.Assert(cfg.ran, DeepEquals, []string{"site.yml", "verify.yml"})
+
+	// the nodes are not verified if the configuration fails
+	cfg = &fakeConfigSubsys{errs: map[string]error{"site.yml": verifyErr}}
+	e = newTestCommissionEvent(cfg, false, time.Minute)
+	e.verifyPlaybook = "verify.yml"
+	c.Assert(e.configureOrCleanupOnErrorRunner(make(CancelChannel), &logs), Equals, verifyErr)
+	c.Assert(cfg.ran, DeepEquals, []string{"site.yml", "cleanup"})
+}
+
+func (s *commissionSuite) TestRequestHostGroups(c *C) {
+	tests := []struct {
+		req         APIRequest
+		hostGroup   string
+		extraGroups []string
+	}{
+		{APIRequest{}, "", nil},
+		{APIRequest{HostGroup: ansibleMasterGroupName}, ansibleMasterGroupName, []string{}},
+		{APIRequest{HostGroups: []string{ansibleMasterGroupName, ansibleWorkerGroupName}},
+			ansibleMasterGroupName, []string{ansibleWorkerGroupName}},
+		// the singular host-group comes first and the duplicates are dropped
+		{APIRequest{HostGroup: ansibleWorkerGroupName,
+			HostGroups: []string{ansibleMasterGroupName, ansibleWorkerGroupName}},
+			ansibleWorkerGroupName, []string{ansibleMasterGroupName}},
+	}
+	for _, test := range tests {
+		hostGroup, extraGroups := requestHostGroups(&test.req)
+		c.Assert(hostGroup, Equals, test.hostGroup, Commentf("request: %+v", test.req))
+		c.Assert(extraGroups, DeepEquals, test.extraGroups, Commentf("request: %+v", test.req))
+	}
+}
+
+func (s *commissionSuite) TestRequestDefaultHostGroup(c *C) {
+	m := &Manager{}
+	hostGroup, _ := m.requestHostGroups(&APIRequest{})
+	c.Assert(hostGroup, Equals, "")
+
+	m.config = DefaultConfig()
+	m.config.Manager.DefaultHostGroup = ansibleWorkerGroupName
+	hostGroup, extraGroups := m.requestHostGroups(&APIRequest{})
+	c.Assert(hostGroup, Equals, ansibleWorkerGroupName)
+	c.Assert(extraGroups, IsNil)
+	// the host-group in the request takes precedence over the default one
+	hostGroup, _ = m.requestHostGroups(&APIRequest{HostGroup: ansibleMasterGroupName})
+	c.Assert(hostGroup, Equals, ansibleMasterGroupName)
+
+	// the job records the effective host-groups in it's summary
+	j := NewJob("", nil, nil)
+	j.hostGroups = newCommissionEvent(m, nil, "", hostGroup, "", 0).hostGroups()
+	j.summarize()
+	c.Assert(j.Summary().HostGroups, DeepEquals, []string{ansibleMasterGroupName})
+}
+
+func (s *commissionSuite) TestCommissionHostGroups(c *C) {
+	m := &Manager{
+		nodes: map[string]*node{
+			"node1": {
+				Inv: inventory.NewAssetWithState(nil, "node1", inventory.Unallocated, inventory.Discovered),
+				Cfg: configuration.NewAnsibleHost("node1", "1.1.1.1", "", map[string]string{}),
+			},
+		},
+	}
+	e := newCommissionEvent(m, []string{"node1"}, "", ansibleMasterGroupName, "", 0)
+	e.extraGroups = []string{"etcd"}
+	c.Assert(e.eventValidate(), ErrorMatches, `invalid host-group specified: "etcd"`)
+
+	// a node that is both a master and a worker doesn't need another master
+	e.extraGroups = []string{ansibleWorkerGroupName}
+	c.Assert(e.eventValidate(), IsNil)
+	c.Assert(e.prepareInventory(), IsNil)
+	c.Assert(m.nodes["node1"].Cfg.GetGroups(), DeepEquals,
+		[]string{ansibleMasterGroupName, ansibleWorkerGroupName})
+	isMaster, err := m.isMasterNode("node1")
+	c.Assert(err, IsNil)
+	c.Assert(isMaster, Equals, true)
+	isWorker, err := m.isWorkerNode("node1")
+	c.Assert(err, IsNil)
+	c.Assert(isWorker, Equals, true)
+}
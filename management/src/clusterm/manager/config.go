@@ -15,6 +15,92 @@ import (
 
 type clustermConfig struct {
 	Addr string `json:"addr"`
+	// JobWorkers is the number of jobs that can run concurrently, and the
+	// number of workers processing the requests. Jobs acting upon overlapping
+	// set of nodes are never run concurrently, the later request is held until
+	// the earlier job is done.
+	JobWorkers int `json:"job_workers,omitempty"`
+	// JobTimeout is the duration, like "1h", after which a job is cancelled.
+	// Jobs are not timed out if it is empty
+	JobTimeout string `json:"job_timeout,omitempty"`
+	// ReqQueueSize is the number of requests that can be pending processing.
+	// Requests received when the queue is full are rejected
+	ReqQueueSize int `json:"req_queue_size,omitempty"`
+	// DebugEndpoints enables the profiling endpoints under 'debug/pprof'. They are
+	// disabled by default as they expose the internals of clusterm, like heap dumps
+	DebugEndpoints bool `json:"debug_endpoints,omitempty"`
+	// DebugTokenFile is the file containing the token that the requests to the
+	// debug endpoints shall carry as a bearer token. It is required if the debug
+	// endpoints are enabled
+	DebugTokenFile string `json:"debug_token_file,omitempty"`
+	// MaxRequestBodySize is the size, in bytes, of the largest request body
+	// that clusterm accepts. The requests with larger bodies are rejected
+	MaxRequestBodySize int64 `json:"max_request_body_size,omitempty"`
+	// AllowInventoryOverride enables the commission and update requests to
+	// specify an ansible inventory for their run, instead of the managed
+	// inventory. It is disabled by default as it bypasses the node model
+	AllowInventoryOverride bool `json:"allow_inventory_override,omitempty"`
+	// HeartbeatInterval is the duration, like "30s", between the probes of the
+	// commissioned nodes' management address. The probes are disabled if it is empty
+	HeartbeatInterval string `json:"heartbeat_interval,omitempty"`
+	// HeartbeatMissThreshold is the number of probes a node may miss in a row,
+	// before it is marked unreachable
+	HeartbeatMissThreshold int `json:"heartbeat_miss_threshold,omitempty"`
+	// GRPCAddr, like "0.0.0.0:9008", is the address that the gRPC front-end is
+	// served at, alongside the REST api. The gRPC front-end is not served if it
+	// is empty. A change to it takes effect on restart
+	GRPCAddr string `json:"grpc_addr,omitempty"`
+	// AnsibleForks is the number of nodes that a job configures in parallel,
+	// unless specified in the request
+	AnsibleForks int `json:"ansible_forks,omitempty"`
+	// ReadHeaderTimeout is the duration, like "10s", within which a client
+	// shall send the headers of a request. It guards against the clients that
+	// hold the connections open by sending the headers slowly
+	ReadHeaderTimeout string `json:"read_header_timeout,omitempty"`
+	// WriteTimeout is the duration, like "1m", within which the response of a
+	// request shall be written. The streamed responses, like the job logs and
+	// node events, are exempt from it
+	WriteTimeout string `json:"write_timeout,omitempty"`
+	// JobWriteTimeout is the duration, like "10m", within which the response of
+	// a request that triggers a job shall be written. It is longer than the
+	// WriteTimeout as the requests wait for their job to be started
+	JobWriteTimeout string `json:"job_write_timeout,omitempty"`
+	// DefaultHostGroup is the host-group, like "service-worker", that the nodes
+	// are commissioned or updated in when the request doesn't specify one
+	DefaultHostGroup string `json:"default_host_group,omitempty"`
+	// JobHistorySize is the number of most recent jobs that are kept in the job
+	// history, along with their logs
+	JobHistorySize int `json:"job_history_size,omitempty"`
+	// JobLogsMaxBytes is the total size, in bytes, of the logs of the jobs kept
+	// in the job history. The oldest jobs are pruned once it's exceeded. The size
+	// is not limited if it is zero
+	JobLogsMaxBytes int64 `json:"job_logs_max_bytes,omitempty"`
+	// JobHistoryMaxAge is the duration, like "168h", after which a finished job
+	// is pruned from the job history. The jobs are not pruned by age if it is empty
+	JobHistoryMaxAge string `json:"job_history_max_age,omitempty"`
+	// GlobalsSchema maps the known keys of the globals to the type of their
+	// values, one of 'string', 'number', 'bool', 'object' or 'array'. The
+	// globals with other keys are rejected. The keys are not checked if it is empty
+	GlobalsSchema map[string]string `json:"globals_schema,omitempty"`
+	// MonitorEnqueueTimeout is the duration, like "5s", for which a monitor
+	// event waits for room in the request queue when it's full. The event is
+	// dropped and rejected once it elapses, so that the monitor backs off. The
+	// event is rejected right away if it is empty
+	MonitorEnqueueTimeout string `json:"monitor_enqueue_timeout,omitempty"`
+	// BasePath, like "/clusterm", is the path prefix that all the REST endpoints
+	// are served under, like when clusterm is mounted under a prefix by a
+	// shared reverse proxy. The endpoints are served at the root if it is empty.
+	// A change to it takes effect on restart
+	BasePath string `json:"base_path,omitempty"`
+	// ListenBacklog is the length of the queue of the connections that are
+	// pending acceptance on the listening socket. The system default, like
+	// net.core.somaxconn on linux, is used if it is zero. It is only applied
+	// on linux, the system default is used elsewhere
+	ListenBacklog int `json:"listen_backlog,omitempty"`
+	// DisableReuseAddr clears SO_REUSEADDR on the listening tcp socket. It is
+	// set by default so that a restarted clusterm binds the address right away,
+	// instead of failing while the connections of the previous run linger
+	DisableReuseAddr bool `json:"disable_reuse_addr,omitempty"`
 }
 
 type inventorySubsysConfig struct {
@@ -50,7 +136,19 @@ func DefaultConfig() *Config {
 			PrivKeyFile:       "/vagrant/management/src/demo/files/insecure_private_key",
 		},
 		Manager: clustermConfig{
-			Addr: "0.0.0.0:9007",
+			Addr:         "0.0.0.0:9007",
+			JobWorkers:   1,
+			ReqQueueSize: 100,
+			// large enough for the extra vars and configuration in practice
+			MaxRequestBodySize:     4 << 20,
+			HeartbeatInterval:      "30s",
+			HeartbeatMissThreshold: 3,
+			AnsibleForks:           5,
+			ReadHeaderTimeout:      "10s",
+			WriteTimeout:           "1m",
+			JobWriteTimeout:        "10m",
+			JobHistorySize:         maxJobHistory,
+			MonitorEnqueueTimeout:  "5s",
 		},
 	}
 }
@@ -0,0 +1,119 @@
+package manager
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// redactedValue replaces the values of sensitive configuration fields in a diff
+const redactedValue = "<redacted>"
+
+// sensitiveConfigFields are the configuration fields whose values are not
+// revealed in a diff. The field names are lower case json paths
+var sensitiveConfigFields = map[string]struct{}{
+	"serf.authkey":               {},
+	"inventory.collins.password": {},
+}
+
+// ConfigChange describes the change to a configuration field. The field is
+// identified by it's json path, like 'ansible.playbook_location'. A nil value
+// means that the field is not set.
+type ConfigChange struct {
+	Field string      `json:"field"`
+	From  interface{} `json:"from"`
+	To    interface{} `json:"to"`
+}
+
+// diffConfig returns the changes from one configuration to another, sorted by
+// the field
+func diffConfig(from, to *Config) ([]ConfigChange, error) {
+	fromFields, err := flattenConfig(from)
+	if err != nil {
+		return nil, err
+	}
+	toFields, err := flattenConfig(to)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := []ConfigChange{}
+	for _, field := range unionFields(fromFields, toFields) {
+		change := ConfigChange{Field: field, From: fromFields[field], To: toFields[field]}
+		if reflect.DeepEqual(change.From, change.To) {
+			continue
+		}
+		if _, ok := sensitiveConfigFields[strings.ToLower(field)]; ok {
+			change.From, change.To = redact(change.From), redact(change.To)
+		}
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
+
+// unionFields returns the sorted names of the fields in either of the flattened values
+func unionFields(a, b map[string]interface{}) []string {
+	fields := []string{}
+	for field := range a {
+		fields = append(fields, field)
+	}
+	for field := range b {
+		if _, ok := a[field]; !ok {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// redact returns the redacted value for a value that is set
+func redact(v interface{}) interface{} {
+	if v == nil || v == "" {
+		return v
+	}
+	return redactedValue
+}
+
+// flattenConfig returns the configuration values keyed by their json path
+func flattenConfig(c *Config) (map[string]interface{}, error) {
+	return flattenValue(c)
+}
+
+// flattenValue returns the values in the json encoding of a value, keyed by
+// their json path
+func flattenValue(val interface{}) (map[string]interface{}, error) {
+	out, err := json.Marshal(val)
+	if err != nil {
+		return nil, err
+	}
+	var v interface{}
+	d := json.NewDecoder(bytes.NewReader(out))
+	// preserve the numbers as is
+	d.UseNumber()
+	if err := d.Decode(&v); err != nil {
+		return nil, err
+	}
+	fields := map[string]interface{}{}
+	flattenJSON("", v, fields)
+	return fields, nil
+}
+
+// flattenJSON adds the values in a decoded json value to fields, keyed by
+// their path from the specified prefix. Only the objects are flattened, the
+// empty objects have no fields to be added.
+func flattenJSON(prefix string, v interface{}, fields map[string]interface{}) {
+	obj, ok := v.(map[string]interface{})
+	if !ok {
+		fields[prefix] = v
+		return
+	}
+	for k, val := range obj {
+		path := k
+		if prefix != "" {
+			path = prefix + "." + k
+		}
+		flattenJSON(path, val, fields)
+	}
+}
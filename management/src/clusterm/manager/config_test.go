@@ -3,6 +3,7 @@
 package manager
 
 import (
+	"encoding/json"
 	"strings"
 
 	"github.com/contiv/cluster/management/src/boltdb"
@@ -93,3 +94,28 @@ func (s *configSuite) TestMergeConfigSuccessBoltdbInventory(c *C) {
 	c.Assert(dst.Inventory.BoltDB, DeepEquals, exptdDst.Inventory.BoltDB)
 	c.Assert(dst.Inventory.Collins, Equals, (*collins.Config)(nil))
 }
+
+func (s *configSuite) TestDiffConfig(c *C) {
+	from := DefaultConfig()
+	to := DefaultConfig()
+	changes, err := diffConfig(from, to)
+	c.Assert(err, IsNil)
+	c.Assert(changes, DeepEquals, []ConfigChange{})
+
+	to.Ansible.PlaybookLocation = "foo"
+	to.Ansible.AllowedPlaybooks = []string{"bar.yml"}
+	to.Manager.JobWorkers = 2
+	to.Serf.AuthKey = "secret"
+	to.Inventory.Collins = &collins.Config{URL: "http://foo", Password: "secret"}
+	changes, err = diffConfig(from, to)
+	c.Assert(err, IsNil)
+	c.Assert(changes, DeepEquals, []ConfigChange{
+		{Field: "ansible.allowed_playbooks", From: nil, To: []interface{}{"bar.yml"}},
+		{Field: "ansible.playbook_location", From: "/vagrant/vendor/ansible", To: "foo"},
+		{Field: "inventory.collins.password", From: nil, To: redactedValue},
+		{Field: "inventory.collins.url", From: nil, To: "http://foo"},
+		{Field: "inventory.collins.user", From: nil, To: ""},
+		{Field: "manager.job_workers", From: json.Number("1"), To: json.Number("2")},
+		{Field: "serf.AuthKey", From: "", To: redactedValue},
+	})
+}
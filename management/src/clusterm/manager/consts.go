@@ -2,60 +2,183 @@
 
 package manager
 
+import "time"
+
 const (
 	// PostNodesCommission is the prefix for the POST REST endpoint
 	// to commission one or more assets
 	PostNodesCommission = "commission/nodes"
 
+	// PostNodesCommissionBulk is the prefix for the POST REST endpoint
+	// to commission the groups of nodes in a plan, one group after the other
+	PostNodesCommissionBulk = "commission/nodes/bulk"
+
 	// PostNodesDecommission is the prefix for the POST REST endpoint
 	// to decommission one or more assets
 	PostNodesDecommission = "decommission/nodes"
 
+	// PostNodesDecommissionImpact is the prefix for the POST REST endpoint
+	// to get the impact of decommissioning one or more assets, without
+	// decommissioning them
+	PostNodesDecommissionImpact = "decommission/nodes/impact"
+
 	// PostNodesUpdate is the prefix for the POST REST endpoint
 	// to update configuration of one or more assets
 	PostNodesUpdate = "update/nodes"
 
+	// PostNodesUpgrade is the prefix for the POST REST endpoint
+	// to upgrade one or more assets to a specific version
+	PostNodesUpgrade = "upgrade/nodes"
+
 	// PostNodesDiscover is the prefix for the POST REST endpoint
 	// to provision one or more specified nodes for discovery
 	PostNodesDiscover = "discover/nodes"
 
+	// PostNodeRediscoverPrefix is the prefix for the POST REST endpoint
+	// to provision a known asset for discovery again, like after it's
+	// management address changed
+	PostNodeRediscoverPrefix = "rediscover/node"
+	postNodeRediscover       = PostNodeRediscoverPrefix + "/{tag}"
+
+	// PostNodesReboot is the prefix for the POST REST endpoint
+	// to reboot one or more assets
+	PostNodesReboot = "reboot/nodes"
+
 	// PostGlobals is the prefix for the POST REST endpoint
 	// to set global configuration values
 	PostGlobals = "globals"
 
+	// PostGlobalsValidate is the prefix for the POST REST endpoint
+	// to validate the global configuration values without setting them
+	PostGlobalsValidate = "globals/validate"
+
 	// PostMonitorEvent is the prefix for the POST REST endpoint
 	// to post a monitor event for one or more nodes.
 	PostMonitorEvent = "monitor/event"
 
+	// PostJobRetryPrefix is the prefix for the POST REST endpoint
+	// to retry a provisioning job on the nodes that failed in it. {job} value
+	// can be 'last'
+	PostJobRetryPrefix = "retry/job"
+	postJobRetry       = PostJobRetryPrefix + "/{job}"
+
+	// PostJobCancelPrefix is the prefix for the POST REST endpoint
+	// to cancel a scheduled provisioning job before it runs, or a running one
+	PostJobCancelPrefix = "cancel/job"
+	postJobCancel       = PostJobCancelPrefix + "/{job}"
+
 	// GetNodeInfoPrefix is the prefix for the GET REST endpoint
 	// to fetch info for an asset
 	GetNodeInfoPrefix = "info/node"
 	getNodeInfo       = GetNodeInfoPrefix + "/{tag}"
+	getNodeHistory    = GetNodeInfoPrefix + "/{tag}/history"
+	getNodeExtraVars  = GetNodeInfoPrefix + "/{tag}/extravars"
 
 	// GetNodesInfo is the prefix for the GET REST endpoint
 	// to fetch info for all know assets
 	GetNodesInfo = "info/nodes"
 
+	// GetNodesDiff is the prefix for the GET REST endpoint
+	// to fetch the differences between the info of two nodes
+	GetNodesDiff = "info/nodes/diff"
+
+	// GetNodesResolve is the prefix for the GET REST endpoint to fetch the
+	// nodes that a node selector selects, without acting upon them
+	GetNodesResolve = "info/nodes/resolve"
+
+	// GetNodesDiscovered is the prefix for the GET REST endpoint to fetch info
+	// for the assets that are discovered but are not commissioned yet
+	GetNodesDiscovered = "info/nodes/discovered"
+
+	// GetNodesEvents is the prefix for the GET REST endpoint to stream the
+	// transitions in the state of nodes, as server-sent events
+	GetNodesEvents = "info/nodes/events"
+
+	// GetNodesBatchInfo is the prefix for the GET REST endpoint
+	// to fetch info for a batch of assets, specified by a 'names' query
+	// parameter with comma separated node names
+	GetNodesBatchInfo = "info/batch/nodes"
+
+	// GetInventoryExport is the prefix for the GET REST endpoint
+	// to export the info of all known assets along with the globals and
+	// configuration of clusterm, in a versioned format
+	GetInventoryExport = "inventory/export"
+
+	// PostInventoryImport is the prefix for the POST REST endpoint
+	// to restore the assets and globals from an exported inventory
+	PostInventoryImport = "inventory/import"
+
 	// GetGlobals is the prefix for the GET REST endpoint
 	// to fetch the global configuration values
 	GetGlobals = "info/globals"
 
 	// GetJobPrefix is the prefix for the GET REST endpoint
-	// to fetch the status and logs of a provisioning job. {job} value can be
-	// 'active' or 'last'
+	// to fetch the status and logs of a provisioning job, and the DELETE REST
+	// endpoint to cancel it. {job} value can be 'active', 'last' or a job id
 	GetJobPrefix = "info/job"
 	getJob       = GetJobPrefix + "/{job}"
 
+	// GetJobs is the prefix for the GET REST endpoint
+	// to fetch the status of recent provisioning jobs
+	GetJobs = "info/jobs"
+
 	// GetJobLogPrefix is the prefix for the GET REST endpoint
 	// to stream the logs of a provisioning job. {job} value can be
 	// 'active'
 	GetJobLogPrefix = "info/logs"
 	getJobLog       = GetJobLogPrefix + "/{job}"
 
+	// GetMetrics is the prefix for the GET REST endpoint
+	// to fetch the runtime metrics of clusterm, like request queue depth
+	GetMetrics = "info/metrics"
+
+	// GetStatus is the prefix for the GET REST endpoint
+	// to fetch a summary of clusterm's state, like the active jobs and node counts
+	GetStatus = "info/status"
+
+	// GetReadyz is the prefix for the GET REST endpoint to check whether
+	// clusterm is ready, i.e. it has synced the nodes with the monitoring subsystem
+	GetReadyz = "readyz"
+
+	// GetOpenAPI is the prefix for the GET REST endpoint
+	// to fetch the OpenAPI spec of clusterm's REST API
+	GetOpenAPI = "openapi.json"
+
+	// GetAudit is the prefix for the GET REST endpoint
+	// to fetch the audit log of the mutating API calls
+	GetAudit = "audit"
+
 	// GetPostConfig is the prefix for the REST endpoint
 	// to GET current or POST updated clusterm's configuration
 	GetPostConfig = "config"
 
+	// PostDeleteNodeAnnotationsPrefix is the prefix for the REST endpoint
+	// to POST new or updated, or DELETE the annotations of an asset
+	PostDeleteNodeAnnotationsPrefix = "annotations/node"
+	postDeleteNodeAnnotations       = PostDeleteNodeAnnotationsPrefix + "/{tag}"
+
+	// PostNodeMaintenancePrefix is the prefix for the POST REST endpoint
+	// to put a node in maintenance or to take it out
+	PostNodeMaintenancePrefix = "maintenance/node"
+	postNodeMaintenance       = PostNodeMaintenancePrefix + "/{tag}"
+
+	// PutNodeLabelsPrefix is the prefix for the PUT REST endpoint
+	// to set the labels of a node
+	PutNodeLabelsPrefix = "labels/node"
+	putNodeLabels       = PutNodeLabelsPrefix + "/{tag}"
+
+	// PostConfigValidate is the prefix for the POST REST endpoint
+	// to validate a clusterm configuration without applying it
+	PostConfigValidate = "config/validate"
+
+	// PostConfigDiff is the prefix for the POST REST endpoint
+	// to get the changes a clusterm configuration makes to the current configuration
+	PostConfigDiff = "config/diff"
+
+	// GetPutLogLevel is the prefix for the REST endpoint
+	// to GET current or PUT updated log level of clusterm
+	GetPutLogLevel = "loglevel"
+
 	// GetDebug is the prefix for the GET REST endpoint
 	// to fetch the debug/profile information for clusterm
 	// as provided by net/http/pprof package
@@ -71,9 +194,56 @@ const (
 	ansibleDiscoverGroupName = "cluster-node"
 	ansibleNodeNameHostVar   = "node_name"
 	ansibleNodeAddrHostVar   = "node_addr"
+	// ansibleUpgradeVersionHostVar is the host variable that carries the version
+	// that a node is upgraded to
+	ansibleUpgradeVersionHostVar = "upgrade_version"
+
+	// unixAddrPrefix is the prefix of clusterm address, when it is served
+	// on a unix socket instead of tcp
+	unixAddrPrefix = "unix:"
 
 	jobLabelActive = "active"
 	jobLabelLast   = "last"
+
+	// inventoryExportVersion is the version of the format of exported inventory.
+	// It shall be bumped on incompatible changes to the format
+	inventoryExportVersion = 1
+
+	// maxJobHistory is the number of most recent jobs that are kept in the job
+	// history, unless configured otherwise
+	maxJobHistory = 20
+	// jobHistoryCleanInterval is the interval at which the jobs older than the
+	// configured max age are pruned from the job history
+	jobHistoryCleanInterval = time.Minute
+
+	// defaultExpectedTasks is the number of tasks that a job is estimated to
+	// run when no completed run of it's playbook is known, for it's progress
+	defaultExpectedTasks = 20
+
+	// maxNodeHistory is the number of most recent events that are kept in the
+	// history of a node
+	maxNodeHistory = 100
+
+	// requestIDHeader is the request header that carries the client's id of a
+	// request, that is recorded in the audit log
+	requestIDHeader = "X-Request-Id"
+
+	// idempotencyKeyHeader is the request header that carries the idempotency key
+	idempotencyKeyHeader = "Idempotency-Key"
+	// idempotencyKeyTTL is the duration for which the retry of a request, with the
+	// same idempotency key, returns the outcome of the original request
+	idempotencyKeyTTL = 24 * time.Hour
+
+	// defaultRejoinTimeout is the duration for which a reboot job waits for the
+	// rebooted nodes to rejoin the cluster, unless specified in the request
+	defaultRejoinTimeout = 10 * time.Minute
+
+	// defaultConnectTimeout is the duration for which a discover job waits to
+	// connect to each of the addresses, unless specified in the request
+	defaultConnectTimeout = 10 * time.Second
+
+	// maxAnsibleForks is the largest number of nodes that a job may configure in parallel
+	maxAnsibleForks = 500
 )
 
 // JobStatus corresponds to possible status values of a job
@@ -88,4 +258,8 @@ const (
 	Complete
 	// Errored is the status of the job that ends with error including user triggered cancellation
 	Errored
+	// Interrupted is the status of the job that was queued or running when clusterm stopped
+	Interrupted
+	// Scheduled is the status of the job that is held back until it's scheduled time
+	Scheduled
 )
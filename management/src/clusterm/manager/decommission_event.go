@@ -3,61 +3,137 @@ package manager
 import (
 	"fmt"
 	"io"
+	"sort"
+	"strconv"
+	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/contiv/cluster/management/src/configuration"
 	"github.com/contiv/errored"
 )
 
+func errDrainTimedOut(timeout time.Duration) error {
+	return errored.Errorf("draining the nodes timed out after %s", timeout)
+}
+
+// LastMasterError is the error returned when decommissioning the nodes would
+// leave the cluster without a master node, unless the decommission is forced.
+// It allows distinguishing the refusal from other failures
+type LastMasterError struct {
+	desc string
+}
+
+// Error returns the master nodes that can't be decommissioned
+func (e *LastMasterError) Error() string {
+	return e.desc
+}
+
+// IsLastMasterError checks if the error is a LastMasterError
+func IsLastMasterError(err error) bool {
+	_, ok := err.(*LastMasterError)
+	return ok
+}
+
+func errLastMaster(nodeNames []string) error {
+	return &LastMasterError{desc: fmt.Sprintf("decommissioning the node(s) %v will leave no master node in the cluster. "+
+		"Force the decommission to decommission the last master node anyway", nodeNames)}
+}
+
 // decommissionEvent triggers the decommission workflow
 type decommissionEvent struct {
+	jobTrigger
 	mgr       *Manager
 	nodeNames []string
 	extraVars string
+	timeout   time.Duration // the job is cancelled if it runs longer than this
+	// drainPlaybook, if set, is run to drain the nodes before they are cleaned up
+	drainPlaybook string
+	drainTimeout  time.Duration // the drain fails if it runs longer than this, if non-zero
+	// continueOnError, when true, makes the nodes that fail validation to be
+	// skipped, instead of failing the decommission of all the nodes
+	continueOnError bool
+	// remove, when true, removes the decommissioned nodes from the inventory,
+	// instead of keeping them as decommissioned
+	remove bool
+	// force, when true, allows decommissioning the last master node
+	force bool
 
-	_hosts  configuration.SubsysHosts
-	_enodes map[string]*node
+	_hosts    configuration.SubsysHosts
+	_enodes   map[string]*node
+	_drainErr error
+	// _names are the names of the nodes that are decommissioned
+	_names []string
+	// _skipped are the reasons the nodes were skipped, keyed by node name
+	_skipped map[string]string
 }
 
 // newDecommissionEvent creates and returns decommissionEvent
-func newDecommissionEvent(mgr *Manager, nodeNames []string, extraVars string) *decommissionEvent {
+func newDecommissionEvent(mgr *Manager, nodeNames []string, extraVars, drainPlaybook string,
+	drainTimeout, timeout time.Duration) *decommissionEvent {
 	return &decommissionEvent{
-		mgr:       mgr,
-		nodeNames: nodeNames,
-		extraVars: extraVars,
+		mgr:           mgr,
+		nodeNames:     nodeNames,
+		extraVars:     extraVars,
+		timeout:       timeout,
+		drainPlaybook: drainPlaybook,
+		drainTimeout:  drainTimeout,
 	}
 }
 
 func (e *decommissionEvent) String() string {
-	return fmt.Sprintf("decommissionEvent: nodes:%v extra-vars: %v", e.nodeNames, e.extraVars)
+	return fmt.Sprintf("decommissionEvent: nodes:%v extra-vars: %v drain-playbook: %q continue-on-error: %v remove: %v force: %v",
+		e.nodeNames, configuration.RedactExtraVars(e.extraVars), e.drainPlaybook, e.continueOnError, e.remove, e.force)
 }
 
 func (e *decommissionEvent) process() error {
 	// err shouldn't be redefined below
-	var err error
+	var (
+		err error
+		job *Job
+	)
 
-	err = e.mgr.checkAndSetActiveJob(
+	job, err = e.checkAndSetActiveJob(
+		e.mgr,
 		e.String(),
+		e.nodeNames,
+		e.timeout,
 		e.cleanupRunner,
 		func(status JobStatus, errRet error) {
 			if status == Errored {
 				logrus.Errorf("cleanup job failed. Error: %v", errRet)
 			}
 
+			if e._drainErr != nil {
+				// the nodes were not cleaned up, set assets back as commissioned
+				e.mgr.setAssetsStatusBestEffort(e._names, e.mgr.inventory.SetAssetCommissioned)
+				return
+			}
+
+			if e.continueOnError {
+				e.setAssetsStatusPerNode()
+				e.removeDecommissionedNodes()
+				return
+			}
+
 			// set assets as decommissioned
-			e.mgr.setAssetsStatusBestEffort(e.nodeNames, e.mgr.inventory.SetAssetDecommissioned)
+			e.mgr.setAssetsStatusBestEffort(e._names, e.mgr.inventory.SetAssetDecommissioned)
+			if status != Errored {
+				// the nodes that failed the cleanup are kept for a retry
+				e.removeDecommissionedNodes()
+			}
 		})
 	if err != nil {
 		return err
 	}
 	defer func() {
 		if err != nil {
-			e.mgr.resetActiveJob()
+			e.mgr.resetActiveJob(job)
 		}
 	}()
+	e.setPlaybook(e.mgr, configuration.ActionCleanup, "")
 
 	// validate event data
-	if e._enodes, err = e.mgr.commonEventValidate(e.nodeNames); err != nil {
+	if err = e.eventValidate(); err != nil {
 		return err
 	}
 
@@ -67,30 +143,148 @@ func (e *decommissionEvent) process() error {
 	}
 
 	// set assets as cancelled
-	if err = e.mgr.setAssetsStatusAtomic(e.nodeNames, e.mgr.inventory.SetAssetCancelled,
+	if err = e.mgr.setAssetsStatusAtomic(e._names, e.mgr.inventory.SetAssetCancelled,
 		e.mgr.inventory.SetAssetCommissioned); err != nil {
 		return err
 	}
 
+	// the skipped nodes are failed in the job
+	for name := range e._skipped {
+		job.failNode(name)
+	}
+
 	// trigger node cleanup
-	go e.mgr.runActiveJob()
+	go e.mgr.runActiveJob(job)
+
+	return nil
+}
+
+// jobNodes returns the nodes the triggered job acts upon
+func (e *decommissionEvent) jobNodes() ([]string, bool) {
+	return e.nodeNames, false
+}
 
+// eventValidate validates the nodes of the event. If continueOnError is set, the
+// nodes that fail validation are skipped, as long as there is atleast one valid node
+func (e *decommissionEvent) eventValidate() error {
+	if !e.continueOnError {
+		var err error
+		e._enodes, err = e.mgr.commonEventValidate(e.nodeNames)
+		e._names = e.nodeNames
+		return err
+	}
+
+	e._enodes = map[string]*node{}
+	e._names = []string{}
+	e._skipped = map[string]string{}
+	for _, name := range e.nodeNames {
+		enodes, err := e.mgr.commonEventValidate([]string{name})
+		if err != nil {
+			logrus.Infof("skipping decommission of node %q. Error: %v", name, err)
+			e._skipped[name] = err.Error()
+			continue
+		}
+		e._enodes[name] = enodes[name]
+		e._names = append(e._names, name)
+	}
+	if len(e._names) == 0 {
+		return e.nodesError()
+	}
 	return nil
 }
 
-// prepareInventory validates that after the cleanup on the nodes in the event,
+// nodesError returns the error that reports the skipped nodes, if any
+func (e *decommissionEvent) nodesError() error {
+	if len(e._skipped) == 0 {
+		return nil
+	}
+	nerr := &NodesError{
+		Accepted: append([]string{}, e._names...),
+		Failed:   e._skipped,
+	}
+	if e.job != nil && len(e._names) > 0 {
+		nerr.JobID = strconv.FormatUint(e.job.id, 10)
+	}
+	return nerr
+}
+
+// setAssetsStatusPerNode sets the assets of the nodes that were cleaned up as
+// decommissioned, while the rest are set back as commissioned. The skipped
+// nodes are recorded in the job's summary.
+func (e *decommissionEvent) setAssetsStatusPerNode() {
+	status := e.job.NodeStatus()
+	for _, name := range e._names {
+		setStatus := e.mgr.inventory.SetAssetDecommissioned
+		if status[name] != NodeOk {
+			setStatus = e.mgr.inventory.SetAssetCommissioned
+		}
+		e.mgr.setAssetsStatusBestEffort([]string{name}, setStatus)
+	}
+
+	if len(e._skipped) == 0 {
+		return
+	}
+	e.job.Lock()
+	defer e.job.Unlock()
+	if e.job.summary == nil {
+		e.job.summary = &JobSummary{}
+	}
+	e.job.summary.NodeErrors = e._skipped
+	e.job.summary.Passed = false
+}
+
+// removeDecommissionedNodes triggers the removal of the nodes that got
+// decommissioned, if requested. When continuing on error, the nodes that
+// failed the cleanup are not decommissioned and are not removed either
+func (e *decommissionEvent) removeDecommissionedNodes() {
+	if !e.remove {
+		return
+	}
+	names := []string{}
+	status := e.job.NodeStatus()
+	for _, name := range e._names {
+		if !e.continueOnError || status[name] == NodeOk {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return
+	}
+	if err := e.mgr.enqueue(newRemoveNodesEvent(e.mgr, names)); err != nil {
+		logrus.Errorf("failed to remove the decommissioned nodes %v. Error: %v", names, err)
+	}
+}
+
+// prepareInventory validates that the nodes in the event can be decommissioned,
+// see validateNodesLeft, and prepares the inventory for the cleanup
+func (e *decommissionEvent) prepareInventory() error {
+	if err := e.mgr.validateNodesLeft(e._enodes, e.force); err != nil {
+		return err
+	}
+
+	// prepare the inventory
+	hosts := []*configuration.AnsibleHost{}
+	for _, node := range e._enodes {
+		hosts = append(hosts, node.Cfg.(*configuration.AnsibleHost))
+	}
+	e._hosts = hosts
+
+	return nil
+}
+
+// validateNodesLeft validates that after the cleanup on the specified nodes,
 // one of following is still true:
-// - all nodes have been cleaned up; OR
+// - all nodes have been cleaned up, forcibly if the last master is among them; OR
 // - there is atleast one master node left
-func (e *decommissionEvent) prepareInventory() error {
+func (m *Manager) validateNodesLeft(enodes map[string]*node, force bool) error {
 	mastersLeft := 0
 	workersLeft := 0
-	for name := range e.mgr.nodes {
-		if _, ok := e._enodes[name]; ok {
-			// skip the node in the event
+	for name := range m.nodes {
+		if _, ok := enodes[name]; ok {
+			// skip the node being decommissioned
 			continue
 		}
-		isDiscoveredAndAllocated, err := e.mgr.isDiscoveredAndAllocatedNode(name)
+		isDiscoveredAndAllocated, err := m.isDiscoveredAndAllocatedNode(name)
 		if err != nil || !isDiscoveredAndAllocated {
 			if err != nil {
 				logrus.Debugf("a node check failed for %q. Error: %s", name, err)
@@ -98,7 +292,7 @@ func (e *decommissionEvent) prepareInventory() error {
 			// skip hosts that are not yet provisioned or not in discovered state
 			continue
 		}
-		isWorkerNode, err := e.mgr.isWorkerNode(name)
+		isWorkerNode, err := m.isWorkerNode(name)
 		if err != nil {
 			// skip this node
 			logrus.Debugf("a node check failed for %q. Error: %s", name, err)
@@ -115,21 +309,83 @@ func (e *decommissionEvent) prepareInventory() error {
 		return errored.Errorf("decommissioning the specified node(s) will leave only worker nodes in the cluster, make sure all worker nodes are decommissioned before last master node.")
 	}
 
-	// prepare the inventory
-	hosts := []*configuration.AnsibleHost{}
-	for _, node := range e._enodes {
-		hosts = append(hosts, node.Cfg.(*configuration.AnsibleHost))
+	if mastersLeft <= 0 && !force {
+		masters := m.commissionedMasters(enodes)
+		if len(masters) > 0 {
+			return errLastMaster(masters)
+		}
 	}
-	e._hosts = hosts
-
 	return nil
 }
 
-// cleanupRunner is the job runner that runs cleanup playbooks on one or more nodes
+// commissionedMasters returns the names of the commissioned master nodes among
+// the specified nodes, sorted
+func (m *Manager) commissionedMasters(enodes map[string]*node) []string {
+	masters := []string{}
+	for name := range enodes {
+		if ok, err := m.isDiscoveredAndAllocatedNode(name); err != nil || !ok {
+			continue
+		}
+		if ok, err := m.isMasterNode(name); err == nil && ok {
+			masters = append(masters, name)
+		}
+	}
+	sort.Strings(masters)
+	return masters
+}
+
+// cleanupRunner is the job runner that runs cleanup playbooks on one or more nodes.
+// The nodes are drained first, if a drain playbook is set, and are not cleaned
+// up if the drain fails
 func (e *decommissionEvent) cleanupRunner(cancelCh CancelChannel, jobLogs io.Writer) error {
-	outReader, cancelFunc, errCh := e.mgr.configuration.Cleanup(e._hosts, e.extraVars)
+	if e.drainPlaybook != "" {
+		fmt.Fprintf(jobLogs, "==> drain phase: draining nodes %v using playbook %q\n", e._names, e.drainPlaybook)
+		if err := e.drain(cancelCh, jobLogs); err != nil {
+			e._drainErr = err
+			fmt.Fprintf(jobLogs, "==> drain phase failed, skipping teardown. Error: %v\n", err)
+			return err
+		}
+		fmt.Fprintf(jobLogs, "==> teardown phase: cleaning up nodes %v\n", e._names)
+	}
+	outReader, cancelFunc, errCh := e.subsys(e.mgr).Cleanup(e._hosts, e.extraVars)
 	if err := logOutputAndReturnStatus(outReader, errCh, cancelCh, cancelFunc, jobLogs); err != nil {
 		return err
 	}
 	return nil
 }
+
+// drain runs the drain playbook on the nodes and waits for it to report that
+// the nodes are empty, upto the drain timeout
+func (e *decommissionEvent) drain(cancelCh CancelChannel, jobLogs io.Writer) error {
+	// the drain is cancelled if the job is cancelled or the drain times out
+	drainCancelCh := make(CancelChannel)
+	timedOutCh := make(chan struct{}, 1)
+	doneCh := make(chan struct{})
+	defer close(doneCh)
+	go func() {
+		var timeoutCh <-chan time.Time
+		if e.drainTimeout > 0 {
+			timeoutCh = time.After(e.drainTimeout)
+		}
+		select {
+		case <-cancelCh:
+		case <-timeoutCh:
+			timedOutCh <- struct{}{}
+		case <-doneCh:
+			return
+		}
+		select {
+		case drainCancelCh <- struct{}{}:
+		case <-doneCh:
+		}
+	}()
+
+	outReader, cancelFunc, errCh := e.subsys(e.mgr).RunPlaybook(e._hosts, e.drainPlaybook, e.extraVars)
+	err := logOutputAndReturnStatus(outReader, errCh, drainCancelCh, cancelFunc, jobLogs)
+	select {
+	case <-timedOutCh:
+		return errDrainTimedOut(e.drainTimeout)
+	default:
+	}
+	return err
+}
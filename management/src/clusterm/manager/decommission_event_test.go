@@ -0,0 +1,183 @@
+// +build unittest
+
+package manager
+
+import (
+	"bytes"
+	"io"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/contiv/cluster/management/src/configuration"
+	"github.com/contiv/cluster/management/src/inventory"
+	"github.com/contiv/errored"
+	. "gopkg.in/check.v1"
+)
+
+type decommissionSuite struct {
+}
+
+var _ = Suite(&decommissionSuite{})
+
+// fakeConfigSubsys records the playbooks it is asked to run and fails the ones
+// specified. The cleanup is recorded as 'cleanup' playbook. A 'blocking' playbook
+// runs until it is cancelled.
+type fakeConfigSubsys struct {
+	configuration.Subsys
+	ran  []string
+	errs map[string]error
+}
+
+func (f *fakeConfigSubsys) RunPlaybook(nodes configuration.SubsysHosts, playbook,
+	extraVars string) (io.Reader, context.CancelFunc, chan error) {
+	f.ran = append(f.ran, playbook)
+	errCh := make(chan error, 1)
+	if playbook != "blocking" {
+		errCh <- f.errs[playbook]
+		return nil, func() {}, errCh
+	}
+	r, w := io.Pipe()
+	return r, func() {
+		w.Close()
+		errCh <- errored.Errorf("cancelled")
+	}, errCh
+}
+
+func (f *fakeConfigSubsys) Cleanup(nodes configuration.SubsysHosts,
+	extraVars string) (io.Reader, context.CancelFunc, chan error) {
+	return f.RunPlaybook(nodes, "cleanup", extraVars)
+}
+
+func (s *decommissionSuite) TestDrainBeforeCleanup(c *C) {
+	cfg := &fakeConfigSubsys{}
+	e := newDecommissionEvent(&Manager{configuration: cfg}, []string{"node1"}, "", "drain.yml", 0, 0)
+	var logs bytes.Buffer
+	c.Assert(e.cleanupRunner(make(CancelChannel), &logs), IsNil)
+	c.Assert(cfg.ran, DeepEquals, []string{"drain.yml", "cleanup"})
+	c.Assert(strings.Contains(logs.String(), "==> drain phase"), Equals, true)
+	c.Assert(strings.Contains(logs.String(), "==> teardown phase"), Equals, true)
+
+	// no drain if drain playbook is not set
+	cfg = &fakeConfigSubsys{}
+	e = newDecommissionEvent(&Manager{configuration: cfg}, []string{"node1"}, "", "", 0, 0)
+	c.Assert(e.cleanupRunner(make(CancelChannel), &logs), IsNil)
+	c.Assert(cfg.ran, DeepEquals, []string{"cleanup"})
+}
+
+func (s *decommissionSuite) TestDrainFailure(c *C) {
+	drainErr := errored.Errorf("node not empty")
+	cfg := &fakeConfigSubsys{errs: map[string]error{"drain.yml": drainErr}}
+	e := newDecommissionEvent(&Manager{configuration: cfg}, []string{"node1"}, "", "drain.yml", 0, 0)
+	var logs bytes.Buffer
+	c.Assert(e.cleanupRunner(make(CancelChannel), &logs), Equals, drainErr)
+	c.Assert(e._drainErr, Equals, drainErr)
+	// the nodes are not cleaned up if drain fails
+	c.Assert(cfg.ran, DeepEquals, []string{"drain.yml"})
+}
+
+func (s *decommissionSuite) TestDrainTimeout(c *C) {
+	cfg := &fakeConfigSubsys{}
+	e := newDecommissionEvent(&Manager{configuration: cfg}, []string{"node1"}, "", "blocking",
+		10*time.Millisecond, 0)
+	var logs bytes.Buffer
+	err := e.cleanupRunner(make(CancelChannel), &logs)
+	c.Assert(err, NotNil)
+	c.Assert(err.Error(), Equals, errDrainTimedOut(10*time.Millisecond).Error())
+	c.Assert(cfg.ran, DeepEquals, []string{"blocking"})
+}
+
+func newContinueOnErrorTestManager() *Manager {
+	newNode := func(name string, state inventory.AssetState) *node {
+		return &node{
+			Cfg: configuration.NewAnsibleHost(name, "", ansibleMasterGroupName, map[string]string{}),
+			Inv: inventory.NewAssetWithState(nil, name, inventory.Allocated, state),
+		}
+	}
+	return &Manager{
+		nodes: map[string]*node{
+			"node1": newNode("node1", inventory.Discovered),
+			"node2": newNode("node2", inventory.Disappeared),
+			"node3": newNode("node3", inventory.Disappeared),
+		},
+	}
+}
+
+func (s *decommissionSuite) TestDecommissionContinueOnError(c *C) {
+	m := newContinueOnErrorTestManager()
+	e := newDecommissionEvent(m, []string{"node1", "node2"}, "", "", 0, 0)
+	e.continueOnError = true
+	c.Assert(e.eventValidate(), IsNil)
+	c.Assert(e._names, DeepEquals, []string{"node1"})
+	c.Assert(e._skipped, HasLen, 1)
+	c.Assert(e._skipped["node2"], Not(Equals), "")
+
+	err := e.nodesError()
+	c.Assert(IsNodesError(err), Equals, true)
+	c.Assert(err.(*NodesError).Accepted, DeepEquals, []string{"node1"})
+	c.Assert(httpStatus(err), Equals, http.StatusMultiStatus)
+
+	// the decommission fails for all the nodes, if continue on error is not set
+	e = newDecommissionEvent(m, []string{"node1", "node2"}, "", "", 0, 0)
+	c.Assert(e.eventValidate(), NotNil)
+	c.Assert(e.nodesError(), IsNil)
+}
+
+func (s *decommissionSuite) TestDecommissionContinueOnErrorAllFailed(c *C) {
+	e := newDecommissionEvent(newContinueOnErrorTestManager(), []string{"node2", "node3"}, "", "", 0, 0)
+	e.continueOnError = true
+	err := e.eventValidate()
+	c.Assert(IsNodesError(err), Equals, true)
+	c.Assert(err.(*NodesError).Accepted, HasLen, 0)
+	c.Assert(err.(*NodesError).Failed, HasLen, 2)
+	c.Assert(httpStatus(err), Equals, http.StatusConflict)
+
+	// the per node outcome is written as json
+	w := httptest.NewRecorder()
+	writeError(w, err)
+	c.Assert(w.Code, Equals, http.StatusConflict)
+	nerr := &NodesError{}
+	c.Assert(json.Unmarshal(w.Body.Bytes(), nerr), IsNil)
+	c.Assert(nerr, DeepEquals, err)
+}
+
+func newLastMasterTestManager(groups map[string]string) *Manager {
+	m := &Manager{nodes: map[string]*node{}}
+	for name, group := range groups {
+		m.nodes[name] = &node{
+			Cfg: configuration.NewAnsibleHost(name, "", group, map[string]string{}),
+			Inv: inventory.NewAssetWithState(nil, name, inventory.Allocated, inventory.Discovered),
+		}
+	}
+	return m
+}
+
+func (s *decommissionSuite) TestDecommissionLastMaster(c *C) {
+	// a single master topology
+	m := newLastMasterTestManager(map[string]string{"node1": ansibleMasterGroupName})
+	e := newDecommissionEvent(m, []string{"node1"}, "", "", 0, 0)
+	c.Assert(e.eventValidate(), IsNil)
+	err := e.prepareInventory()
+	c.Assert(IsLastMasterError(err), Equals, true)
+	c.Assert(err.Error(), Equals, errLastMaster([]string{"node1"}).Error())
+	c.Assert(httpStatus(err), Equals, http.StatusPreconditionFailed)
+
+	// the decommission of the last master can be forced
+	e = newDecommissionEvent(m, []string{"node1"}, "", "", 0, 0)
+	e.force = true
+	c.Assert(e.eventValidate(), IsNil)
+	c.Assert(e.prepareInventory(), IsNil)
+
+	// a master can be decommissioned as long as another one is left
+	m = newLastMasterTestManager(map[string]string{
+		"node1": ansibleMasterGroupName,
+		"node2": ansibleMasterGroupName,
+	})
+	e = newDecommissionEvent(m, []string{"node1"}, "", "", 0, 0)
+	c.Assert(e.eventValidate(), IsNil)
+	c.Assert(e.prepareInventory(), IsNil)
+}
@@ -0,0 +1,117 @@
+package manager
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"sort"
+)
+
+// HostGroupImpact is the change in the commissioned members of a host-group,
+// that decommissioning a set of nodes makes
+type HostGroupImpact struct {
+	HostGroup string   `json:"host_group"`
+	Before    int      `json:"before"`
+	After     int      `json:"after"`
+	Removed   []string `json:"removed"`
+}
+
+// DecommissionImpact is the impact that decommissioning a set of nodes has on
+// the cluster. It is computed from the nodes' state, nothing is decommissioned
+type DecommissionImpact struct {
+	// Nodes are the commissioned nodes that would be decommissioned
+	Nodes []string `json:"nodes"`
+	// Skipped are the nodes that are not commissioned, they are left as is
+	Skipped []string `json:"skipped,omitempty"`
+	// HostGroups are the host-groups that lose members
+	HostGroups []HostGroupImpact `json:"host_groups"`
+	// QuorumAffected is true if the master nodes left are not a majority of
+	// the current master nodes
+	QuorumAffected bool `json:"quorum_affected"`
+	// LastMaster is true if the last master nodes would be decommissioned,
+	// which needs the decommission to be forced
+	LastMaster bool `json:"last_master"`
+	// Blocked, if set, is the reason the decommission would be rejected
+	Blocked string `json:"blocked,omitempty"`
+}
+
+// decommissionImpact computes the impact of decommissioning the specified nodes.
+// The caller shall hold the nodes for reading
+func (m *Manager) decommissionImpact(nodeNames []string) *DecommissionImpact {
+	impact := &DecommissionImpact{Nodes: []string{}, HostGroups: []HostGroupImpact{}}
+	enodes := map[string]*node{}
+	for _, name := range nodeNames {
+		if ok, err := m.isDiscoveredAndAllocatedNode(name); err != nil || !ok {
+			impact.Skipped = append(impact.Skipped, name)
+			continue
+		}
+		enodes[name] = m.nodes[name]
+		impact.Nodes = append(impact.Nodes, name)
+	}
+	sort.Strings(impact.Nodes)
+	sort.Strings(impact.Skipped)
+
+	groups := map[string]*HostGroupImpact{}
+	for name, n := range m.nodes {
+		if ok, err := m.isDiscoveredAndAllocatedNode(name); err != nil || !ok || n.Cfg == nil {
+			continue
+		}
+		for _, group := range n.Cfg.GetGroups() {
+			g, ok := groups[group]
+			if !ok {
+				g = &HostGroupImpact{HostGroup: group, Removed: []string{}}
+				groups[group] = g
+			}
+			g.Before++
+			if _, ok := enodes[name]; ok {
+				g.Removed = append(g.Removed, name)
+				continue
+			}
+			g.After++
+		}
+	}
+	for _, g := range groups {
+		if len(g.Removed) == 0 {
+			continue
+		}
+		sort.Strings(g.Removed)
+		impact.HostGroups = append(impact.HostGroups, *g)
+	}
+	sort.Sort(byHostGroup(impact.HostGroups))
+
+	// the master nodes form the quorum of the cluster
+	if g, ok := groups[ansibleMasterGroupName]; ok {
+		impact.QuorumAffected = g.After < g.Before/2+1
+	}
+
+	if err := m.validateNodesLeft(enodes, false); err != nil {
+		impact.LastMaster = IsLastMasterError(err)
+		impact.Blocked = err.Error()
+	}
+	return impact
+}
+
+type byHostGroup []HostGroupImpact
+
+func (s byHostGroup) Len() int           { return len(s) }
+func (s byHostGroup) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byHostGroup) Less(i, j int) bool { return s[i].HostGroup < s[j].HostGroup }
+
+func (m *Manager) nodesDecommissionImpact(req *APIRequest) (io.Reader, error) {
+	if err := m.resolveRequestSelector(req); err != nil {
+		return nil, err
+	}
+	if err := m.validateRequestNodes(req); err != nil {
+		return nil, err
+	}
+
+	m.nodesMutex.RLock()
+	impact := m.decommissionImpact(req.Nodes)
+	m.nodesMutex.RUnlock()
+
+	out, err := json.Marshal(impact)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(out), nil
+}
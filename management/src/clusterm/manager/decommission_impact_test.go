@@ -0,0 +1,72 @@
+// +build unittest
+
+package manager
+
+import (
+	"encoding/json"
+	"io/ioutil"
+
+	"github.com/contiv/cluster/management/src/inventory"
+	. "gopkg.in/check.v1"
+)
+
+type decommissionImpactSuite struct {
+}
+
+var _ = Suite(&decommissionImpactSuite{})
+
+func (s *decommissionImpactSuite) TestDecommissionImpact(c *C) {
+	m := newLastMasterTestManager(map[string]string{
+		"node1": ansibleMasterGroupName,
+		"node2": ansibleMasterGroupName,
+		"node3": ansibleMasterGroupName,
+		"node4": ansibleWorkerGroupName,
+		"node5": ansibleWorkerGroupName,
+	})
+	m.nodes["node6"] = &node{
+		Inv: inventory.NewAssetWithState(nil, "node6", inventory.Unallocated, inventory.Discovered),
+	}
+
+	impact := m.decommissionImpact([]string{"node4", "node6", "node1"})
+	c.Assert(impact, DeepEquals, &DecommissionImpact{
+		Nodes:   []string{"node1", "node4"},
+		Skipped: []string{"node6"},
+		HostGroups: []HostGroupImpact{
+			{HostGroup: ansibleMasterGroupName, Before: 3, After: 2, Removed: []string{"node1"}},
+			{HostGroup: ansibleWorkerGroupName, Before: 2, After: 1, Removed: []string{"node4"}},
+		},
+	})
+
+	// losing the majority of the masters affects the quorum
+	impact = m.decommissionImpact([]string{"node1", "node2"})
+	c.Assert(impact.QuorumAffected, Equals, true)
+	c.Assert(impact.LastMaster, Equals, false)
+	c.Assert(impact.Blocked, Equals, "")
+
+	// the masters can't be decommissioned while the workers are left
+	impact = m.decommissionImpact([]string{"node1", "node2", "node3"})
+	c.Assert(impact.QuorumAffected, Equals, true)
+	c.Assert(impact.LastMaster, Equals, false)
+	c.Assert(impact.Blocked, Not(Equals), "")
+
+	// the last master can be decommissioned only if forced
+	impact = m.decommissionImpact([]string{"node1", "node2", "node3", "node4", "node5"})
+	c.Assert(impact.LastMaster, Equals, true)
+	c.Assert(impact.Blocked, Equals, errLastMaster([]string{"node1", "node2", "node3"}).Error())
+}
+
+func (s *decommissionImpactSuite) TestNodesDecommissionImpact(c *C) {
+	m := newLastMasterTestManager(map[string]string{"node1": ansibleMasterGroupName})
+	out, err := m.nodesDecommissionImpact(&APIRequest{Nodes: []string{"node1"}})
+	c.Assert(err, IsNil)
+	body, err := ioutil.ReadAll(out)
+	c.Assert(err, IsNil)
+	impact := &DecommissionImpact{}
+	c.Assert(json.Unmarshal(body, impact), IsNil)
+	c.Assert(impact.Nodes, DeepEquals, []string{"node1"})
+	c.Assert(impact.LastMaster, Equals, true)
+
+	_, err = m.nodesDecommissionImpact(&APIRequest{Nodes: []string{"node2"}})
+	c.Assert(err, NotNil)
+	c.Assert(httpStatus(err), Equals, 400)
+}
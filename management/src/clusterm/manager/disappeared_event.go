@@ -3,6 +3,7 @@ package manager
 import (
 	"fmt"
 
+	"github.com/Sirupsen/logrus"
 	"github.com/contiv/cluster/management/src/monitor"
 )
 
@@ -32,9 +33,18 @@ func (e *disappearedEvent) process() error {
 	if err != nil {
 		return err
 	}
+	defer e.mgr.trackNodeState(name)()
 
 	// update node's monitoring info to the one received in the event.
+	e.mgr.nodesMutex.Lock()
 	node.Mon = e.nodes[0]
+	e.mgr.nodesMutex.Unlock()
+
+	if node.Maintenance {
+		// the node is expected to go away while in maintenance
+		logrus.Infof("node %q is in maintenance, leaving it's inventory state as is", name)
+		return nil
+	}
 
 	if err := e.mgr.inventory.SetAssetDisappeared(name); err != nil {
 		// XXX. Log this to collins
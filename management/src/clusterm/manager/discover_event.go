@@ -3,40 +3,81 @@ package manager
 import (
 	"fmt"
 	"io"
+	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/contiv/cluster/management/src/configuration"
 	"github.com/contiv/errored"
 )
 
+func errDuplicateAddr(addr string) error {
+	return errored.Errorf("address %s is repeated in the request", addr)
+}
+
+func errNoReachableAddrs(addrs []string) error {
+	return errored.Errorf("none of the addresses %v could be connected to", addrs)
+}
+
+// DiscoverResult is the outcome of a discover request for each of it's
+// addresses. The addresses that are repeated in the request are skipped as
+// duplicates.
+type DiscoverResult struct {
+	// Discovered are the addresses that are not known, that are discovered afresh
+	Discovered []string `json:"discovered,omitempty"`
+	// Updated are the addresses of the known nodes, that are discovered again
+	// to update the nodes, keyed by address with the node name as value
+	Updated map[string]string `json:"updated,omitempty"`
+	// Skipped are the addresses that are skipped as duplicates, keyed by
+	// address with the reason as value
+	Skipped map[string]string `json:"skipped,omitempty"`
+}
+
 // discoverEvent triggers the node discovery workflow
 type discoverEvent struct {
+	jobTrigger
 	mgr       *Manager
 	nodeAddrs []string
 	extraVars string
+	timeout   time.Duration // the job is cancelled if it runs longer than this
+	// connectTimeout is the duration for which each address is waited upon to
+	// be connected to. The addresses that can't be connected to are skipped
+	connectTimeout time.Duration
+	// result is the outcome of the discovery for each of the addresses, once
+	// the event is processed
+	result *DiscoverResult
 
 	_hosts configuration.SubsysHosts
 }
 
 // newDiscoverEvent creates and returns discoverEvent
-func newDiscoverEvent(mgr *Manager, nodeAddrs []string, extraVars string) *discoverEvent {
+func newDiscoverEvent(mgr *Manager, nodeAddrs []string, extraVars string, timeout time.Duration) *discoverEvent {
 	return &discoverEvent{
-		mgr:       mgr,
-		nodeAddrs: nodeAddrs,
-		extraVars: extraVars,
+		mgr:            mgr,
+		nodeAddrs:      nodeAddrs,
+		extraVars:      extraVars,
+		timeout:        timeout,
+		connectTimeout: defaultConnectTimeout,
 	}
 }
 
 func (e *discoverEvent) String() string {
-	return fmt.Sprintf("discoverEvent: addr: %v extra-vars: %v", e.nodeAddrs, e.extraVars)
+	return fmt.Sprintf("discoverEvent: addr: %v extra-vars: %v", e.nodeAddrs,
+		configuration.RedactExtraVars(e.extraVars))
 }
 
 func (e *discoverEvent) process() error {
 	// err shouldn't be redefined below
-	var err error
+	var (
+		err error
+		job *Job
+	)
 
-	err = e.mgr.checkAndSetActiveJob(
+	nodeNames, _ := e.jobNodes()
+	job, err = e.checkAndSetActiveJob(
+		e.mgr,
 		e.String(),
+		nodeNames,
+		e.timeout,
 		e.discoverRunner,
 		func(status JobStatus, errRet error) {
 			if status == Errored {
@@ -48,22 +89,15 @@ func (e *discoverEvent) process() error {
 	}
 	defer func() {
 		if err != nil {
-			e.mgr.resetActiveJob()
+			e.mgr.resetActiveJob(job)
 		}
 	}()
+	e.setPlaybook(e.mgr, configuration.ActionConfigure, "")
 
-	// validate
-	existingNodes := []string{}
-	for _, addr := range e.nodeAddrs {
-		node, err := e.mgr.findNodeByMgmtAddr(addr)
-		if err == nil {
-			existingNodes = append(existingNodes, fmt.Sprintf("%s:%s", node.Inv.GetTag(), addr))
-		}
-	}
-	if len(existingNodes) > 0 {
-		err = errored.Errorf("one or more nodes already exist with the specified management addresses. Existing nodes: %v", existingNodes)
-		return err
-	}
+	e.result = e.resolveAddrs()
+	job.Lock()
+	job.discover = e.result
+	job.Unlock()
 
 	// prepare inventory
 	if err = e.pepareInventory(); err != nil {
@@ -71,11 +105,64 @@ func (e *discoverEvent) process() error {
 	}
 
 	// trigger node discovery provisioning
-	go e.mgr.runActiveJob()
+	go e.mgr.runActiveJob(job)
 
 	return nil
 }
 
+// jobNodes returns the nodes the triggered job acts upon. These are the known
+// nodes that are re-discovered, as found when the event is claimed. The nodes
+// discovered afresh are not known yet, so they don't conflict with other jobs
+func (e *discoverEvent) jobNodes() ([]string, bool) {
+	e.mgr.nodesMutex.RLock()
+	defer e.mgr.nodesMutex.RUnlock()
+	nodeNames := []string{}
+	for _, addr := range e.nodeAddrs {
+		if node, err := e.mgr.findNodeByMgmtAddr(addr); err == nil {
+			nodeNames = append(nodeNames, node.Inv.GetTag())
+		}
+	}
+	return nodeNames, false
+}
+
+// resolveAddrs sorts the addresses into the ones that are discovered afresh,
+// the ones of known nodes and the duplicates. The addresses of the existing
+// nodes are re-discovered. The nodes are updated, instead of being duplicated,
+// once the monitoring subsystem reports them as discovered. The duplicates are
+// dropped from the addresses to discover.
+func (e *discoverEvent) resolveAddrs() *DiscoverResult {
+	result := &DiscoverResult{}
+	addrs := []string{}
+	seenAddrs := map[string]bool{}
+	for _, addr := range e.nodeAddrs {
+		if seenAddrs[addr] {
+			logrus.Warnf("skipping the duplicate address %s", addr)
+			if result.Skipped == nil {
+				result.Skipped = map[string]string{}
+			}
+			result.Skipped[addr] = errDuplicateAddr(addr).Error()
+			continue
+		}
+		seenAddrs[addr] = true
+
+		node, err := e.mgr.findNodeByMgmtAddr(addr)
+		if err != nil {
+			result.Discovered = append(result.Discovered, addr)
+			addrs = append(addrs, addr)
+			continue
+		}
+		name := node.Inv.GetTag()
+		logrus.Infof("re-discovering existing node %q at %s", name, addr)
+		if result.Updated == nil {
+			result.Updated = map[string]string{}
+		}
+		result.Updated[addr] = name
+		addrs = append(addrs, addr)
+	}
+	e.nodeAddrs = addrs
+	return result
+}
+
 // pepareInventory prepares the inventory
 func (e *discoverEvent) pepareInventory() error {
 	hosts := []*configuration.AnsibleHost{}
@@ -93,10 +180,44 @@ func (e *discoverEvent) pepareInventory() error {
 	return nil
 }
 
+// reachableHosts probes the addresses concurrently and returns the hosts whose
+// address could be connected to within the connect timeout. The unreachable
+// addresses are recorded in the job's recap, so that they don't hold up the
+// discovery of rest of the hosts.
+func (e *discoverEvent) reachableHosts(jobLogs io.Writer) []*configuration.AnsibleHost {
+	addrs := map[string]string{}
+	for _, addr := range e.nodeAddrs {
+		addrs[addr] = addr
+	}
+	results := probeNodes(addrs, func(addr string) error {
+		return e.mgr.probeNode(addr, e.connectTimeout)
+	})
+
+	all := e._hosts.([]*configuration.AnsibleHost)
+	hosts := []*configuration.AnsibleHost{}
+	unreachable := []string{}
+	for i, addr := range e.nodeAddrs {
+		if err := results[addr]; err != nil {
+			logrus.Warnf("skipping the discovery of unreachable address %s. Error: %v", addr, err)
+			unreachable = append(unreachable, addr)
+			continue
+		}
+		hosts = append(hosts, all[i])
+	}
+	if len(unreachable) > 0 {
+		logUnreachableRecap(jobLogs, "connect", unreachable)
+	}
+	return hosts
+}
+
 // discoverRunner is the job runner that runs configuration plabooks on one or more nodes
 // It adds the node(s) to contiv-node hostgroup
 func (e *discoverEvent) discoverRunner(cancelCh CancelChannel, jobLogs io.Writer) error {
-	outReader, cancelFunc, errCh := e.mgr.configuration.Configure(e._hosts, e.extraVars)
+	hosts := e.reachableHosts(jobLogs)
+	if len(hosts) == 0 {
+		return errNoReachableAddrs(e.nodeAddrs)
+	}
+	outReader, cancelFunc, errCh := e.subsys(e.mgr).Configure(hosts, e.extraVars)
 	if err := logOutputAndReturnStatus(outReader, errCh, cancelCh, cancelFunc, jobLogs); err != nil {
 		logrus.Errorf("discover failed. Error: %s", err)
 		return err
@@ -0,0 +1,207 @@
+// +build unittest
+
+package manager
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/contiv/cluster/management/src/ansible"
+	"github.com/contiv/cluster/management/src/configuration"
+	"github.com/contiv/cluster/management/src/inventory"
+	"github.com/contiv/cluster/management/src/mock"
+	"github.com/contiv/cluster/management/src/monitor"
+	"github.com/golang/mock/gomock"
+	"golang.org/x/net/context"
+	. "gopkg.in/check.v1"
+)
+
+type discoverSuite struct {
+}
+
+var _ = Suite(&discoverSuite{})
+
+// fakeDiscoverSubsys records the hosts it is asked to configure
+type fakeDiscoverSubsys struct {
+	configuration.Subsys
+	hosts []*configuration.AnsibleHost
+}
+
+func (f *fakeDiscoverSubsys) Configure(nodes configuration.SubsysHosts,
+	extraVars string) (io.Reader, context.CancelFunc, chan error) {
+	f.hosts = nodes.([]*configuration.AnsibleHost)
+	errCh := make(chan error, 1)
+	errCh <- nil
+	return nil, func() {}, errCh
+}
+
+func newDiscoverTestManager(cfg configuration.Subsys, unreachable ...string) *Manager {
+	return &Manager{
+		configuration: cfg,
+		probeNode: func(addr string, timeout time.Duration) error {
+			for _, u := range unreachable {
+				if addr == u {
+					return errors.New("i/o timeout")
+				}
+			}
+			return nil
+		},
+	}
+}
+
+func (s *discoverSuite) TestDiscoverSkipsUnreachable(c *C) {
+	cfg := &fakeDiscoverSubsys{}
+	e := newDiscoverEvent(newDiscoverTestManager(cfg, "1.1.1.2"),
+		[]string{"1.1.1.1", "1.1.1.2", "1.1.1.3"}, "", 0)
+	c.Assert(e.pepareInventory(), IsNil)
+
+	var logs bytes.Buffer
+	c.Assert(e.discoverRunner(make(CancelChannel), &logs), IsNil)
+	c.Assert(cfg.hosts, HasLen, 2)
+	c.Assert(cfg.hosts[0].GetTag(), Equals, "node1")
+	c.Assert(cfg.hosts[1].GetTag(), Equals, "node3")
+
+	recap, err := ansible.ParseRecap(&logs)
+	c.Assert(err, IsNil)
+	c.Assert(recap, DeepEquals, ansible.Recap{"1.1.1.2": {Unreachable: 1}})
+}
+
+func (s *discoverSuite) TestDiscoverNoneReachable(c *C) {
+	cfg := &fakeDiscoverSubsys{}
+	addrs := []string{"1.1.1.1", "1.1.1.2"}
+	e := newDiscoverEvent(newDiscoverTestManager(cfg, addrs...), addrs, "", 0)
+	c.Assert(e.pepareInventory(), IsNil)
+
+	var logs bytes.Buffer
+	err := e.discoverRunner(make(CancelChannel), &logs)
+	c.Assert(err.Error(), Equals, errNoReachableAddrs(addrs).Error())
+	c.Assert(cfg.hosts, IsNil)
+}
+
+func (s *discoverSuite) TestDiscoverResolveAddrs(c *C) {
+	ctrl := gomock.NewController(c)
+	defer ctrl.Finish()
+	mClient := mock.NewMockSubsysClient(ctrl)
+
+	m := newDiscoverTestManager(&fakeDiscoverSubsys{})
+	m.nodes = map[string]*node{
+		"node1-s1": {
+			Inv: inventory.NewAssetWithState(mClient, "node1-s1", inventory.Allocated, inventory.Disappeared),
+			Mon: monitor.NewNode("node1", "s1", "1.1.1.1"),
+		},
+	}
+	e := newDiscoverEvent(m, []string{"1.1.1.2", "1.1.1.1", "1.1.1.2", "1.1.1.3", "1.1.1.1"}, "", 0)
+
+	// the known node is updated and the repeated addresses are skipped
+	result := e.resolveAddrs()
+	c.Assert(result, DeepEquals, &DiscoverResult{
+		Discovered: []string{"1.1.1.2", "1.1.1.3"},
+		Updated:    map[string]string{"1.1.1.1": "node1-s1"},
+		Skipped: map[string]string{
+			"1.1.1.2": errDuplicateAddr("1.1.1.2").Error(),
+			"1.1.1.1": errDuplicateAddr("1.1.1.1").Error(),
+		},
+	})
+	c.Assert(e.nodeAddrs, DeepEquals, []string{"1.1.1.2", "1.1.1.1", "1.1.1.3"})
+	c.Assert(e.pepareInventory(), IsNil)
+	c.Assert(e._hosts, HasLen, 3)
+
+	// the result is in the job's reference and summary
+	j := NewJob("", nil, nil)
+	j.discover = result
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("POST", "/"+PostNodesDiscover, strings.NewReader(`{"addrs":["1.1.1.1"]}`))
+	c.Assert(err, IsNil)
+	postJob(func(req *APIRequest) (*Job, error) { return j, nil })(w, r)
+	ref := JobRef{}
+	c.Assert(json.Unmarshal(w.Body.Bytes(), &ref), IsNil)
+	c.Assert(ref.Discover, DeepEquals, result)
+	j.summarize()
+	c.Assert(j.Summary().Discover, DeepEquals, result)
+}
+
+func (s *discoverSuite) TestRediscoveredNodeAddrChanged(c *C) {
+	ctrl := gomock.NewController(c)
+	defer ctrl.Finish()
+	mClient := mock.NewMockSubsysClient(ctrl)
+	mClient.EXPECT().SetAssetStatus(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+
+	inv := inventory.NewGeneralSubsys(mClient)
+	a := inventory.NewAssetWithState(mClient, "node1-s1", inventory.Allocated, inventory.Disappeared)
+	c.Assert(inv.RestoreAsset("node1-s1", a), IsNil)
+	m := &Manager{
+		inventory: inv,
+		nodes: map[string]*node{
+			"node1-s1": {
+				Inv: a,
+				Mon: monitor.NewNode("node1", "s1", "1.1.1.1"),
+				Cfg: configuration.NewAnsibleHost("node1-s1", "1.1.1.1", ansibleMasterGroupName,
+					map[string]string{
+						ansibleNodeNameHostVar: "node1-s1",
+						ansibleNodeAddrHostVar: "1.1.1.1",
+					}),
+			},
+		},
+	}
+
+	// the existing node is updated, instead of being duplicated
+	mon := monitor.NewNode("node1", "s1", "1.1.1.2")
+	c.Assert(newDiscoveredEvent(m, []monitor.SubsysNode{mon}).process(), IsNil)
+	c.Assert(m.nodes, HasLen, 1)
+	c.Assert(m.nodes["node1-s1"].Mon.GetMgmtAddress(), Equals, "1.1.1.2")
+	out, err := json.Marshal(m.nodes["node1-s1"].Cfg)
+	c.Assert(err, IsNil)
+	host := map[string]interface{}{}
+	c.Assert(json.Unmarshal(out, &host), IsNil)
+	c.Assert(host["ssh_address"], Equals, "1.1.1.2")
+	c.Assert(host["inventory_vars"].(map[string]interface{})[ansibleNodeAddrHostVar], Equals, "1.1.1.2")
+
+	// the change of address is recorded in the node's history
+	history := m.nodeHistory["node1-s1"]
+	c.Assert(history, HasLen, 2)
+	c.Assert(history[0].Event, Equals, NodeEventChanged)
+	c.Assert(history[1].Event, Equals, NodeEventDiscovered)
+
+	// the node is not changed if it's rediscovered at the same address
+	c.Assert(newDiscoveredEvent(m, []monitor.SubsysNode{mon}).process(), IsNil)
+	c.Assert(m.nodeHistory["node1-s1"], HasLen, 2)
+}
+
+func (s *discoverSuite) TestNodeRediscover(c *C) {
+	m := &Manager{
+		config: DefaultConfig(),
+		reqQ:   make(chan event, 1),
+		nodes: map[string]*node{
+			"node1": {Mon: monitor.NewNode("node1", "s1", "1.1.1.1")},
+			"node2": {},
+		},
+	}
+	rediscoverAddrs := func() []string {
+		e := (<-m.reqQ).(*asyncJobEvent).jobEvent.(*discoverEvent)
+		return e.nodeAddrs
+	}
+
+	// the node is discovered at it's known address, unless one is specified
+	_, err := m.nodeRediscover(&APIRequest{Nodes: []string{"node1"}, Async: true})
+	c.Assert(err, IsNil)
+	c.Assert(rediscoverAddrs(), DeepEquals, []string{"1.1.1.1"})
+	_, err = m.nodeRediscover(&APIRequest{Nodes: []string{"node1"}, Addrs: []string{"1.1.1.2"}, Async: true})
+	c.Assert(err, IsNil)
+	c.Assert(rediscoverAddrs(), DeepEquals, []string{"1.1.1.2"})
+
+	for _, req := range []*APIRequest{
+		{Nodes: []string{"node3"}},
+		{Nodes: []string{"node2"}},
+		{Nodes: []string{"node1"}, Addrs: []string{"1.1.1.2", "1.1.1.3"}},
+	} {
+		_, err = m.nodeRediscover(req)
+		c.Assert(err, NotNil)
+		c.Assert(httpStatus(err), Equals, 400)
+	}
+}
@@ -2,6 +2,7 @@ package manager
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/contiv/cluster/management/src/configuration"
@@ -29,7 +30,39 @@ func (e *discoveredEvent) String() string {
 func (e *discoveredEvent) process() error {
 	//XXX: need to form the name that adheres to collins tag requirements
 	name := e.nodes[0].GetLabel() + "-" + e.nodes[0].GetSerial()
+	defer e.mgr.trackNodeState(name)()
 
+	enode, addrChanged, err := e.updateNode(name)
+	if err != nil {
+		return err
+	}
+
+	if enode.Inv == nil {
+		if err := e.mgr.inventory.AddAsset(name); err != nil {
+			// XXX. Log this to collins
+			logrus.Errorf("adding asset %q to discovered in inventory failed. Error: %s", name, err)
+			return err
+		}
+		e.mgr.nodesMutex.Lock()
+		enode.Inv = e.mgr.inventory.GetAsset(name)
+		e.mgr.nodesMutex.Unlock()
+	} else if err := e.mgr.inventory.SetAssetDiscovered(name); err != nil {
+		// XXX. Log this to collins
+		logrus.Errorf("setting asset %q to discovered in inventory failed. Error: %s", name, err)
+		return err
+	}
+	if addrChanged {
+		e.mgr.publishNodeChange(name)
+	}
+	return nil
+}
+
+// updateNode adds the discovered node, or updates it if it exists, with the
+// info received in the event. It returns the node and true if it's mgmt
+// address changed. The node's inventory state is left to the caller to update.
+func (e *discoveredEvent) updateNode(name string) (*node, bool, error) {
+	e.mgr.nodesMutex.Lock()
+	defer e.mgr.nodesMutex.Unlock()
 	enode, err := e.mgr.findNode(name)
 	if err != nil && err.Error() == nodeNotExistsError(name).Error() {
 		e.mgr.nodes[name] = &node{
@@ -43,23 +76,29 @@ func (e *discoveredEvent) process() error {
 		}
 		enode = e.mgr.nodes[name]
 	} else if err != nil {
-		return err
+		return nil, false, err
 	}
 
-	// update node's monitoring info to the one received in the event
-	enode.Mon = e.nodes[0]
-	enode.Inv = e.mgr.inventory.GetAsset(name)
-	if enode.Inv == nil {
-		if err := e.mgr.inventory.AddAsset(name); err != nil {
-			// XXX. Log this to collins
-			logrus.Errorf("adding asset %q to discovered in inventory failed. Error: %s", name, err)
-			return err
+	// a re-discovered node may be reported at a different mgmt address, in
+	// which case it's configuration is updated to connect at the new address
+	addrChanged := false
+	if enode.Mon != nil && enode.Mon.GetMgmtAddress() != e.nodes[0].GetMgmtAddress() {
+		addrChanged = true
+		if host, ok := enode.Cfg.(*configuration.AnsibleHost); ok {
+			host.SetAddr(e.nodes[0].GetMgmtAddress())
+			host.SetVar(ansibleNodeAddrHostVar, e.nodes[0].GetMgmtAddress())
 		}
-		enode.Inv = e.mgr.inventory.GetAsset(name)
-	} else if err := e.mgr.inventory.SetAssetDiscovered(name); err != nil {
-		// XXX. Log this to collins
-		logrus.Errorf("setting asset %q to discovered in inventory failed. Error: %s", name, err)
-		return err
+		logrus.Infof("mgmt address of node %q changed from %s to %s", name,
+			enode.Mon.GetMgmtAddress(), e.nodes[0].GetMgmtAddress())
 	}
-	return nil
+
+	// update node's monitoring info and tags to the one received in the event
+	enode.Mon = e.nodes[0]
+	enode.Tags = e.nodes[0].GetTags()
+	enode.Annotations = e.mgr.annotations[name]
+	enode.Maintenance = e.mgr.maintenance[name]
+	enode.Labels = e.mgr.labels[name]
+	enode.discoveredAt = time.Now()
+	enode.Inv = e.mgr.inventory.GetAsset(name)
+	return enode, addrChanged, nil
 }
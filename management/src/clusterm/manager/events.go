@@ -1,6 +1,19 @@
 package manager
 
-import "github.com/Sirupsen/logrus"
+import (
+	"time"
+
+	"github.com/contiv/cluster/management/src/configuration"
+	"github.com/contiv/errored"
+)
+
+// reqQueueRetryAfter is the number of seconds after which a request, that
+// was rejected due to a full request queue, may be retried
+const reqQueueRetryAfter = 5
+
+func errReqQueueFull(capacity int) error {
+	return errored.Errorf("request queue is full with %d pending requests, please try in sometime", capacity)
+}
 
 // event associates an event to corresponding processing logic
 type event interface {
@@ -8,12 +21,177 @@ type event interface {
 	process() error
 }
 
+// jobEvent is implemented by the events that trigger a job
+type jobEvent interface {
+	event
+	setIdempotencyKey(key string)
+	setJobID(id uint64)
+	setQueuedAt(t time.Time)
+	setForks(forks int)
+	setConnection(user, keyRef string)
+	setScheduled()
+	triggeredJob() *Job
+}
+
+// jobTrigger is embedded in the events that trigger a job. It records the
+// triggered job, so that it can be referred to after the event is processed
+type jobTrigger struct {
+	idempotencyKey string    // the key is recorded with the triggered job, if set
+	jobID          uint64    // the id reserved for the triggered job, if non-zero
+	queuedAt       time.Time // the time the event was queued, if known
+	forks          int       // the nodes the job configures in parallel, the configured default if zero
+	sshUser        string    // the user the nodes are connected as, the configured default if empty
+	sshKeyRef      string    // the keystore reference of the key the nodes are connected with, if set
+	scheduled      bool      // the event was held back until it's scheduled time
+	job            *Job
+}
+
+func (t *jobTrigger) setIdempotencyKey(key string) {
+	t.idempotencyKey = key
+}
+
+func (t *jobTrigger) setJobID(id uint64) {
+	t.jobID = id
+}
+
+func (t *jobTrigger) setQueuedAt(queuedAt time.Time) {
+	t.queuedAt = queuedAt
+}
+
+func (t *jobTrigger) setForks(forks int) {
+	t.forks = forks
+}
+
+func (t *jobTrigger) setConnection(user, keyRef string) {
+	t.sshUser, t.sshKeyRef = user, keyRef
+}
+
+func (t *jobTrigger) setScheduled() {
+	t.scheduled = true
+}
+
+// subsys returns the configuration subsystem that the triggered job runs the
+// playbooks with, as per the forks and the connection settings of the trigger
+func (t *jobTrigger) subsys(m *Manager) configuration.Subsys {
+	c := m.configurationWithForks(t.forks)
+	if t.sshUser == "" && t.sshKeyRef == "" {
+		return c
+	}
+	if s, ok := c.(configuration.ConnectionSetter); ok {
+		return s.WithConnection(t.sshUser, t.sshKeyRef)
+	}
+	return c
+}
+
+// triggeredJob returns the job triggered by the event, if any. It shall be
+// called only after the event is processed
+func (t *jobTrigger) triggeredJob() *Job {
+	return t.job
+}
+
+// checkAndSetActiveJob checks that the job triggered by the event can be run
+// before it is made active, like Manager.checkAndSetActiveJob, and records the
+// job. The job is assigned the reserved id, the idempotency key and the time
+// the event was queued, if any, and the effective forks before it is made
+// active, as the active jobs are read by the api requests
+func (t *jobTrigger) checkAndSetActiveJob(m *Manager, jobDesc string, nodeNames []string,
+	timeout time.Duration, runner JobRunner, doneCb DoneCallback) (*Job, error) {
+	if timeout == 0 {
+		timeout = m.jobTimeout()
+	}
+	forks := m.ansibleForks(t.forks)
+	j, err := m.setActiveJob(jobDesc, nodeNames, false, timeout, runner, doneCb, func(j *Job) {
+		j.id = t.jobID
+		j.idempotencyKey = t.idempotencyKey
+		j.queuedAt = t.queuedAt
+		j.forks = forks
+	})
+	if err != nil {
+		return nil, err
+	}
+	t.job = j
+	return j, nil
+}
+
+// setPlaybook records the playbook that the triggered job runs for the action,
+// as resolved by the configuration subsystem, along with it's version. The
+// tasks that the job is expected to run are looked up from the job history. It
+// shall be called once the job is set, before the job is run
+func (t *jobTrigger) setPlaybook(m *Manager, action configuration.Action, playbook string) {
+	r, ok := t.subsys(m).(configuration.PlaybookResolver)
+	if !ok || t.job == nil {
+		return
+	}
+	path, version := r.ResolvePlaybook(action, playbook)
+	tasks := m.playbookTasks(path, version)
+	t.job.Lock()
+	defer t.job.Unlock()
+	t.job.playbook, t.job.playbookVersion = path, version
+	t.job.expectedTasks = tasks
+}
+
+// asyncJobEvent wraps an event that triggers a job, when the request doesn't
+// wait for the event to be processed or carries an idempotency key. The job's
+// status is available through the placeholder job in the meantime, and the
+// failure to process the event is recorded in job's status
+type asyncJobEvent struct {
+	jobEvent
+	mgr     *Manager
+	pending *Job
+}
+
+func (e *asyncJobEvent) process() error {
+	err := e.jobEvent.process()
+	e.mgr.resolvePendingJob(e.pending, e.triggeredJob(), err)
+	return err
+}
+
+func (e *asyncJobEvent) wrapped() event {
+	return e.jobEvent
+}
+
+func (e *asyncJobEvent) abort(err error) {
+	e.mgr.resolvePendingJob(e.pending, nil, err)
+}
+
+// enqueue adds an event to the request queue without blocking. It returns an
+// error if the queue is full
+func (m *Manager) enqueue(e event) error {
+	select {
+	case m.reqQ <- e:
+		return nil
+	default:
+		return errServiceUnavailable(errReqQueueFull(cap(m.reqQ)), reqQueueRetryAfter)
+	}
+}
+
+// enqueueWithTimeout adds an event to the request queue, waiting upto the
+// timeout for room in the queue if it's full. It returns an error if the queue
+// stays full. It doesn't wait if the timeout is zero, like enqueue
+func (m *Manager) enqueueWithTimeout(e event, timeout time.Duration) error {
+	if timeout <= 0 {
+		return m.enqueue(e)
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case m.reqQ <- e:
+		return nil
+	case <-timer.C:
+		return errServiceUnavailable(errReqQueueFull(cap(m.reqQ)), reqQueueRetryAfter)
+	}
+}
+
+// eventLoop runs the workers that process the events. There are as many
+// workers as the jobs that can run concurrently
 func (m *Manager) eventLoop() {
-	for {
-		me := <-m.reqQ
-		logrus.Debugf("dequeued manager event: %s", me)
-		err := me.process()
-		// log and continue
-		logrus.Debugf("done handling event %s. Error(if any): %v", me, err)
+	m.jobsMutex.Lock()
+	m.releasedQ = make(chan event, cap(m.reqQ))
+	m.eventClaims = map[event]*eventClaim{}
+	m.jobsMutex.Unlock()
+
+	for i := 1; i < m.jobWorkers(); i++ {
+		go m.eventWorker()
 	}
+	m.eventWorker()
 }
@@ -2,17 +2,57 @@ package manager
 
 import (
 	"bufio"
+	"fmt"
 	"io"
 	"time"
 
 	"golang.org/x/net/context"
 
 	"github.com/Sirupsen/logrus"
+	"github.com/contiv/cluster/management/src/configuration"
 	"github.com/contiv/errored"
 )
 
 var errJobCancelled = errored.Errorf("job was cancelled")
 
+// rejoinPollInterval is the interval at which the nodes are checked to have
+// (re)joined the cluster
+var rejoinPollInterval = 5 * time.Second
+
+// waitForNodes waits upto the timeout for the nodes, that pending returns, to
+// (re)join the cluster. It returns the sorted names of the nodes that are still
+// pending on timeout. These nodes are recorded as unreachable in the job's recap
+// so that they are considered failed.
+func waitForNodes(cancelCh CancelChannel, jobLogs io.Writer, timeout time.Duration,
+	pending func() []string) ([]string, error) {
+	timeoutCh := time.After(timeout)
+	for {
+		names := pending()
+		if len(names) == 0 {
+			return nil, nil
+		}
+		select {
+		case <-cancelCh:
+			return nil, errJobCancelled
+		case <-timeoutCh:
+			logUnreachableRecap(jobLogs, "rejoin", names)
+			return names, nil
+		case <-time.After(rejoinPollInterval):
+		}
+	}
+}
+
+// logUnreachableRecap logs a play recap, named after the specified step, that
+// records the hosts as unreachable. The recap is accounted in the job's summary
+// like the ones logged by ansible.
+func logUnreachableRecap(jobLogs io.Writer, step string, hosts []string) {
+	fmt.Fprintf(jobLogs, "\nPLAY RECAP (%s) ****\n", step)
+	for _, host := range hosts {
+		fmt.Fprintf(jobLogs, "%s : ok=0 changed=0 unreachable=1 failed=0\n", host)
+	}
+	fmt.Fprintln(jobLogs)
+}
+
 // helper function to log the stream of bytes from a reader while waiting on
 // the error channel. It returns on first error received on the channel
 func logOutputAndReturnStatus(r io.Reader, errCh chan error, cancelCh CancelChannel,
@@ -23,6 +63,13 @@ func logOutputAndReturnStatus(r io.Reader, errCh chan error, cancelCh CancelChan
 		return <-errCh
 	}
 
+	// the stderr, if available separately, is redirected to the job's stderr logs
+	if sr, ok := r.(configuration.StderrReader); ok {
+		stderrDone := make(chan struct{})
+		go logStderr(sr.Stderr(), jobLogs, stderrDone)
+		defer func() { <-stderrDone }()
+	}
+
 	// redirect read output to job logs
 	t := io.TeeReader(r, jobLogs)
 	s := bufio.NewScanner(t)
@@ -32,6 +79,8 @@ func logOutputAndReturnStatus(r io.Reader, errCh chan error, cancelCh CancelChan
 		select {
 		case <-cancelCh:
 			err = errJobCancelled
+			// the output is closed once the cancelled run has terminated, so the
+			// job is not done while the playbook is still running
 			cancelFunc()
 			for s.Scan() {
 				logrus.Infof("%s", s.Bytes())
@@ -51,6 +100,49 @@ func logOutputAndReturnStatus(r io.Reader, errCh chan error, cancelCh CancelChan
 	}
 }
 
+// logStderr copies the stderr output from the reader to the stderr of job logs
+func logStderr(r io.Reader, jobLogs io.Writer, doneCh chan struct{}) {
+	defer close(doneCh)
+	w := jobLogs
+	if sw, ok := jobLogs.(interface {
+		Stderr() io.Writer
+	}); ok {
+		w = sw.Stderr()
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		logrus.Errorf("failed to log the stderr output. Error: %v", err)
+	}
+}
+
+// configureAction returns the action that configure runs for the specified
+// playbook
+func configureAction(playbook string) configuration.Action {
+	if playbook != "" {
+		return configuration.ActionRunPlaybook
+	}
+	return configuration.ActionConfigure
+}
+
+// configure runs the specified playbook on the hosts with the configuration
+// subsystem, if one is specified. Else it runs the default configuration
+// playbook. In check mode, the playbook reports the changes that it would make
+// without making them.
+func configure(c configuration.Subsys, hosts configuration.SubsysHosts, playbook, extraVars string,
+	check bool) (io.Reader, context.CancelFunc, chan error) {
+	if check {
+		var err error
+		if c, err = withCheck(c); err != nil {
+			errCh := make(chan error, 1)
+			errCh <- err
+			return nil, func() {}, errCh
+		}
+	}
+	if playbook != "" {
+		return c.RunPlaybook(hosts, playbook, extraVars)
+	}
+	return c.Configure(hosts, extraVars)
+}
+
 // commonEventValidate does common validation for events. It returns a map of nodes
 // associted with their name on success
 func (m *Manager) commonEventValidate(nodeNames []string) (map[string]*node, error) {
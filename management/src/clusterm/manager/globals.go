@@ -0,0 +1,152 @@
+package manager
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/contiv/cluster/management/src/configuration"
+	"github.com/contiv/errored"
+)
+
+// globalsTypes are the types that the values of the globals can be constrained
+// to by the globals schema
+var globalsTypes = map[string]struct{}{
+	"string": {},
+	"number": {},
+	"bool":   {},
+	"object": {},
+	"array":  {},
+}
+
+func errInvalidGlobals(problems []GlobalsProblem) error {
+	msgs := []string{}
+	for _, p := range problems {
+		msgs = append(msgs, p.String())
+	}
+	return errored.Errorf("invalid globals: %s", strings.Join(msgs, "; "))
+}
+
+// GlobalsProblem describes a problem found with the globals. The key is empty
+// if the problem is with the globals as a whole, like them not being valid JSON
+type GlobalsProblem struct {
+	Key     string `json:"key,omitempty"`
+	Message string `json:"message"`
+}
+
+// String returns the problem prefixed with the key it's found at, if any
+func (p GlobalsProblem) String() string {
+	if p.Key == "" {
+		return p.Message
+	}
+	return p.Key + ": " + p.Message
+}
+
+// GlobalsValidationReport is the outcome of validating the globals. The
+// globals are valid if no problems are found
+type GlobalsValidationReport struct {
+	Valid    bool             `json:"valid"`
+	Problems []GlobalsProblem `json:"problems"`
+}
+
+// isValidGlobalsType checks if the type is one of the known globals types
+func isValidGlobalsType(typ string) bool {
+	_, ok := globalsTypes[typ]
+	return ok
+}
+
+// globalsType returns the globals type of a JSON decoded value
+func globalsType(val interface{}) string {
+	switch val.(type) {
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "bool"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	default:
+		return "null"
+	}
+}
+
+// validateGlobals checks that the globals are a JSON object, whose keys and
+// the types of their values conform to the configured globals schema. All the
+// problems found are reported. The vault encrypted globals can't be looked
+// into, they are only checked to be decryptable
+func (m *Manager) validateGlobals(extraVars string) *GlobalsValidationReport {
+	report := &GlobalsValidationReport{Problems: []GlobalsProblem{}}
+	defer func() { report.Valid = len(report.Problems) == 0 }()
+
+	if configuration.IsVaultEncrypted(extraVars) {
+		if err := m.validateVaultExtraVars(extraVars); err != nil {
+			report.Problems = append(report.Problems, GlobalsProblem{Message: err.Error()})
+		}
+		return report
+	}
+	if strings.TrimSpace(extraVars) == "" {
+		return report
+	}
+
+	var vars interface{}
+	if err := json.Unmarshal([]byte(extraVars), &vars); err != nil {
+		report.Problems = append(report.Problems, GlobalsProblem{Message: errInvalidJSON("globals", err).Error()})
+		return report
+	}
+	obj, ok := vars.(map[string]interface{})
+	if !ok {
+		report.Problems = append(report.Problems, GlobalsProblem{Message: errNotJSONObject("globals").Error()})
+		return report
+	}
+
+	var schema map[string]string
+	if config := m.getConfig(); config != nil {
+		schema = config.Manager.GlobalsSchema
+	}
+	if len(schema) == 0 {
+		return report
+	}
+	keys := []string{}
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		typ, ok := schema[key]
+		if !ok {
+			report.Problems = append(report.Problems, GlobalsProblem{Key: key, Message: "unknown key"})
+			continue
+		}
+		if actual := globalsType(obj[key]); actual != typ {
+			report.Problems = append(report.Problems, GlobalsProblem{Key: key,
+				Message: "expected a value of type " + typ + ", got " + actual})
+		}
+	}
+	return report
+}
+
+// globalsValidate validates the globals in the request, the same way as they
+// are validated when set, without applying them. The validation report is
+// returned even if the globals are invalid
+func (m *Manager) globalsValidate(w http.ResponseWriter, r *http.Request) {
+	req, err := decodePostRequest(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	out, err := json.Marshal(m.validateGlobals(req.ExtraVars))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(out); err != nil {
+		logrus.Errorf("failed to write response bytes '%s'. Error: %v", out, err)
+	}
+}
@@ -0,0 +1,239 @@
+package manager
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/contiv/cluster/management/src/clusterm/clustermpb"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// grpcServer serves the gRPC front-end of clusterm. The requests are handled
+// by the same Manager handlers as the corresponding REST requests, so the jobs
+// they trigger go through the same request queue
+type grpcServer struct {
+	clustermpb.UnimplementedClustermServer
+	mgr *Manager
+}
+
+// grpcLoop serves the gRPC front-end at the configured gRPC address
+func (m *Manager) grpcLoop() error {
+	l, err := listen(m.grpcAddr, m.config.Manager.ListenBacklog, !m.config.Manager.DisableReuseAddr)
+	if err != nil {
+		logrus.Errorf("Error setting up gRPC listener. Error: %s", err)
+		return err
+	}
+
+	srv := grpc.NewServer()
+	clustermpb.RegisterClustermServer(srv, &grpcServer{mgr: m})
+	if err := srv.Serve(l); err != nil {
+		logrus.Errorf("Error listening for gRPC requests. Error: %s", err)
+		return err
+	}
+
+	return nil
+}
+
+// grpcCode returns the gRPC code corresponding to the http status of an error
+// response
+func grpcCode(httpStatus int) codes.Code {
+	switch httpStatus {
+	case http.StatusBadRequest, http.StatusRequestEntityTooLarge:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict, http.StatusMultiStatus:
+		return codes.Aborted
+	case http.StatusPreconditionFailed:
+		return codes.FailedPrecondition
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case http.StatusNotImplemented:
+		return codes.Unimplemented
+	case http.StatusServiceUnavailable:
+		return codes.Unavailable
+	case http.StatusGatewayTimeout:
+		return codes.DeadlineExceeded
+	}
+	return codes.Internal
+}
+
+// grpcError returns the gRPC error for an error returned by an api handler
+func grpcError(err error) error {
+	return status.Error(grpcCode(httpStatus(err)), err.Error())
+}
+
+// apiRequest forms the APIRequest from a gRPC request to act upon the nodes,
+// like parsePostRequest does for a REST request
+func apiRequest(r *clustermpb.NodesRequest) (*APIRequest, error) {
+	extraVars, err := validateAndSanitizeEmptyExtraVars("extra_vars", r.ExtraVars)
+	if err != nil {
+		return nil, err
+	}
+	return &APIRequest{
+		Nodes:           r.Nodes,
+		Addrs:           r.Addrs,
+		HostGroup:       r.HostGroup,
+		ExtraVars:       extraVars,
+		Playbook:        r.Playbook,
+		Timeout:         r.Timeout,
+		Selector:        r.Selector,
+		IgnoreMissing:   r.IgnoreMissing,
+		IdempotencyKey:  r.IdempotencyKey,
+		Async:           r.Async,
+		ContinueOnError: r.ContinueOnError,
+		ConnectTimeout:  r.ConnectTimeout,
+		HostGroups:      r.HostGroups,
+		Forks:           int(r.Forks),
+		Check:           r.Check,
+		Remove:          r.Remove,
+		Serials:         r.Serials,
+	}, nil
+}
+
+// triggerJob handles a gRPC request that triggers a job, like postJob does for
+// a REST request. The request is recorded in the audit log, with the gRPC
+// method as it's endpoint
+func (s *grpcServer) triggerJob(ctx context.Context, method string, r *clustermpb.NodesRequest,
+	cb postJobCallback) (*clustermpb.JobRef, error) {
+	record := &AuditRecord{
+		Time:           time.Now(),
+		IdempotencyKey: r.IdempotencyKey,
+		Method:         "gRPC",
+		Endpoint:       method,
+		Nodes:          r.Nodes,
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		record.RemoteAddr = p.Addr.String()
+	}
+
+	ref, err := s.runJobCallback(r, cb)
+	record.Status = http.StatusOK
+	if err != nil {
+		record.Status = httpStatus(err)
+		record.Error = err.Error()
+		if len(record.Error) > maxAuditErrorLen {
+			record.Error = record.Error[:maxAuditErrorLen]
+		}
+	} else {
+		record.JobID = ref.Id
+	}
+	s.mgr.appendAuditRecord(record)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return ref, nil
+}
+
+func (s *grpcServer) runJobCallback(r *clustermpb.NodesRequest, cb postJobCallback) (*clustermpb.JobRef, error) {
+	if !s.mgr.isReady() {
+		return nil, errServiceUnavailable(errInitializing(), initializingRetryAfter)
+	}
+	req, err := apiRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	j, err := cb(req)
+	if err != nil {
+		return nil, err
+	}
+	if j == nil {
+		return &clustermpb.JobRef{}, nil
+	}
+	return &clustermpb.JobRef{Id: strconv.FormatUint(j.id, 10)}, nil
+}
+
+func (s *grpcServer) Commission(ctx context.Context, r *clustermpb.NodesRequest) (*clustermpb.JobRef, error) {
+	return s.triggerJob(ctx, clustermpb.Clusterm_Commission_FullMethodName, r, s.mgr.nodesCommission)
+}
+
+func (s *grpcServer) Decommission(ctx context.Context, r *clustermpb.NodesRequest) (*clustermpb.JobRef, error) {
+	return s.triggerJob(ctx, clustermpb.Clusterm_Decommission_FullMethodName, r, s.mgr.nodesDecommission)
+}
+
+func (s *grpcServer) Update(ctx context.Context, r *clustermpb.NodesRequest) (*clustermpb.JobRef, error) {
+	return s.triggerJob(ctx, clustermpb.Clusterm_Update_FullMethodName, r, s.mgr.nodesUpdate)
+}
+
+func (s *grpcServer) Discover(ctx context.Context, r *clustermpb.NodesRequest) (*clustermpb.JobRef, error) {
+	return s.triggerJob(ctx, clustermpb.Clusterm_Discover_FullMethodName, r, s.mgr.nodesDiscover)
+}
+
+func (s *grpcServer) GetNode(ctx context.Context, r *clustermpb.NodeRequest) (*clustermpb.Node, error) {
+	if err := validateNodeFields(r.Fields); err != nil {
+		return nil, grpcError(errBadRequest(err))
+	}
+	info, err := readAll(s.mgr.oneNode(&APIRequest{Nodes: []string{r.Name}, Fields: r.Fields}))
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &clustermpb.Node{Name: r.Name, Info: info}, nil
+}
+
+func (s *grpcServer) GetNodes(ctx context.Context, r *clustermpb.NodesFilter) (*clustermpb.Nodes, error) {
+	if err := validateNodeFields(r.Fields); err != nil {
+		return nil, grpcError(errBadRequest(err))
+	}
+	req := &APIRequest{Tags: r.Tags, Annotations: r.Annotations, Fields: r.Fields}
+	out, err := readAll(s.mgr.allNodes(req))
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	info := map[string]json.RawMessage{}
+	if err := json.Unmarshal(out, &info); err != nil {
+		return nil, grpcError(err)
+	}
+	names := []string{}
+	for name := range info {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	nodes := &clustermpb.Nodes{}
+	for _, name := range names {
+		nodes.Nodes = append(nodes.Nodes, &clustermpb.Node{Name: name, Info: info[name]})
+	}
+	return nodes, nil
+}
+
+func (s *grpcServer) GetJob(ctx context.Context, r *clustermpb.JobRequest) (*clustermpb.Job, error) {
+	j, err := s.mgr.findJob(r.Label)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	info := j.info(true)
+	out, err := json.Marshal(info)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &clustermpb.Job{
+		Id:       info.ID,
+		Desc:     info.Desc,
+		Task:     info.Task,
+		Status:   info.Status,
+		Error:    info.ErrVal,
+		Progress: int32(info.Progress),
+		Info:     out,
+	}, nil
+}
+
+// readAll reads the response returned by an api handler
+func readAll(out io.Reader, err error) ([]byte, error) {
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(out)
+}
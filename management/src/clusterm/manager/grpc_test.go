@@ -0,0 +1,113 @@
+// +build unittest
+
+package manager
+
+import (
+	"encoding/json"
+	"net"
+
+	"github.com/contiv/cluster/management/src/clusterm/clustermpb"
+	"github.com/contiv/cluster/management/src/monitor"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	. "gopkg.in/check.v1"
+)
+
+type grpcSuite struct {
+}
+
+var _ = Suite(&grpcSuite{})
+
+// grpcTestClient serves the gRPC front-end of the manager on a local port and
+// returns a client connected to it, along with a func to stop both
+func grpcTestClient(c *C, m *Manager) (clustermpb.ClustermClient, func()) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	srv := grpc.NewServer()
+	clustermpb.RegisterClustermServer(srv, &grpcServer{mgr: m})
+	go srv.Serve(l)
+
+	conn, err := grpc.Dial(l.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	c.Assert(err, IsNil)
+	return clustermpb.NewClustermClient(conn), func() {
+		conn.Close()
+		srv.Stop()
+	}
+}
+
+func (s *grpcSuite) TestGRPCJobRequests(c *C) {
+	m := &Manager{
+		reqQ:    make(chan event, 2),
+		readyCh: make(chan struct{}),
+		nodes:   map[string]*node{"node1": {Mon: monitor.NewNode("node1", "s1", "1.1.1.1")}},
+	}
+	client, stop := grpcTestClient(c, m)
+	defer stop()
+	ctx := context.Background()
+
+	// the requests are rejected until the manager is ready, like the REST requests
+	_, err := client.Decommission(ctx, &clustermpb.NodesRequest{Nodes: []string{"node1"}, Async: true})
+	c.Assert(status.Code(err), Equals, codes.Unavailable)
+	close(m.readyCh)
+
+	// the request is queued like the corresponding REST request
+	ref, err := client.Decommission(ctx, &clustermpb.NodesRequest{Nodes: []string{"node1"}, Async: true})
+	c.Assert(err, IsNil)
+	c.Assert(m.reqQ, HasLen, 1)
+	e, ok := (<-m.reqQ).(*asyncJobEvent)
+	c.Assert(ok, Equals, true)
+	c.Assert(ref.Id, Equals, "1")
+	c.Assert(e.pending.id, Equals, uint64(1))
+	c.Assert(e.jobEvent.String(), Matches, "decommissionEvent.*node1.*")
+
+	// the errors carry the code corresponding to the http status
+	_, err = client.Decommission(ctx, &clustermpb.NodesRequest{Nodes: []string{"node2"}, Async: true})
+	c.Assert(status.Code(err), Equals, codes.InvalidArgument)
+	c.Assert(status.Convert(err).Message(), Matches, ".*node2.*")
+	c.Assert(m.reqQ, HasLen, 0)
+}
+
+func (s *grpcSuite) TestGRPCGetRequests(c *C) {
+	j := NewJob("job1", nil, nil)
+	j.id = 5
+	m := &Manager{
+		nodes: map[string]*node{
+			"node1": {Mon: monitor.NewNode("node1", "s1", "1.1.1.1"), Tags: map[string]string{"rack": "r1"}},
+			"node2": {Mon: monitor.NewNode("node2", "s2", "1.1.1.2"), Tags: map[string]string{"rack": "r2"}},
+		},
+		jobHistory: []*Job{j},
+		lastJob:    j,
+	}
+	client, stop := grpcTestClient(c, m)
+	defer stop()
+	ctx := context.Background()
+
+	n, err := client.GetNode(ctx, &clustermpb.NodeRequest{Name: "node1", Fields: []string{"serial"}})
+	c.Assert(err, IsNil)
+	c.Assert(n.Name, Equals, "node1")
+	c.Assert(string(n.Info), Equals, `{"serial":"s1"}`)
+
+	_, err = client.GetNode(ctx, &clustermpb.NodeRequest{Name: "node1", Fields: []string{"foo"}})
+	c.Assert(status.Code(err), Equals, codes.InvalidArgument)
+
+	nodes, err := client.GetNodes(ctx, &clustermpb.NodesFilter{Tags: map[string]string{"rack": "r2"},
+		Fields: []string{"name"}})
+	c.Assert(err, IsNil)
+	c.Assert(nodes.Nodes, HasLen, 1)
+	c.Assert(nodes.Nodes[0].Name, Equals, "node2")
+	c.Assert(string(nodes.Nodes[0].Info), Equals, `{"name":"node2"}`)
+
+	for _, label := range []string{"5", jobLabelLast} {
+		job, err := client.GetJob(ctx, &clustermpb.JobRequest{Label: label})
+		c.Assert(err, IsNil)
+		c.Assert(job.Id, Equals, uint64(5))
+		c.Assert(job.Desc, Equals, "job1")
+		c.Assert(job.Status, Equals, Queued.String())
+		info := JobInfo{}
+		c.Assert(json.Unmarshal(job.Info, &info), IsNil)
+		c.Assert(info.ID, Equals, uint64(5))
+	}
+}
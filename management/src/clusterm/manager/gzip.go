@@ -0,0 +1,90 @@
+package manager
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strings"
+)
+
+// gzipResponseWriter compresses the response body written through it.
+// It also flushes the compressed data on every Flush so that the streaming
+// responses like job logs are not held back by the compression.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	gw          *gzip.Writer
+	wroteHeader bool
+}
+
+func (w *gzipResponseWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	// responses without a body are not compressed
+	if code != http.StatusNotModified && code != http.StatusNoContent {
+		w.Header().Set("Content-Encoding", "gzip")
+		// the length of compressed content is not known upfront
+		w.Header().Del("Content-Length")
+		w.gw = gzip.NewWriter(w.ResponseWriter)
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *gzipResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		if w.Header().Get("Content-Type") == "" {
+			// sniff the content type from uncompressed data, else it would be
+			// detected as gzip data
+			w.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.gw == nil {
+		return w.ResponseWriter.Write(b)
+	}
+	return w.gw.Write(b)
+}
+
+func (w *gzipResponseWriter) Flush() {
+	if w.gw != nil {
+		w.gw.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Close flushes any pending compressed data to the response
+func (w *gzipResponseWriter) Close() error {
+	if w.gw == nil {
+		return nil
+	}
+	return w.gw.Close()
+}
+
+// acceptsGzip returns true if the request indicates that client can accept
+// gzip encoded response
+func acceptsGzip(r *http.Request) bool {
+	for _, enc := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		if strings.TrimSpace(strings.Split(enc, ";")[0]) == "gzip" {
+			return true
+		}
+	}
+	return false
+}
+
+// gzipHandler wraps a handler to gzip the responses for the requests that
+// accept gzip encoding
+func gzipHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if !acceptsGzip(r) {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		gw := &gzipResponseWriter{ResponseWriter: w}
+		defer gw.Close()
+		h.ServeHTTP(gw, r)
+	})
+}
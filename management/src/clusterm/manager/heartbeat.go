@@ -0,0 +1,210 @@
+package manager
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/contiv/cluster/management/src/inventory"
+)
+
+const (
+	// NodeReachable is the reachability of a node that responds to the heartbeat
+	NodeReachable = "reachable"
+	// NodeUnreachable is the reachability of a node that missed the configured
+	// number of heartbeats in a row
+	NodeUnreachable = "unreachable"
+
+	// heartbeatProbePort is the port that is probed on a node's management
+	// address. It's the ssh port, that ansible uses to configure the node
+	heartbeatProbePort = "22"
+	// heartbeatProbeTimeout is the longest a heartbeat probe waits for the node
+	heartbeatProbeTimeout = 5 * time.Second
+)
+
+// probeNodeAddr probes the node with specified management address, it returns
+// an error if the node can't be reached within the timeout
+func probeNodeAddr(addr string, timeout time.Duration) error {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(addr, heartbeatProbePort), timeout)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// heartbeatInterval returns the configured interval between the node heartbeats.
+// The heartbeats are disabled if it is zero
+func heartbeatInterval(config *Config) time.Duration {
+	if config.Manager.HeartbeatInterval == "" {
+		return 0
+	}
+	// the interval is validated when the manager is instantiated
+	d, _ := parseTimeout(config.Manager.HeartbeatInterval)
+	return d
+}
+
+// heartbeatMissThreshold returns the configured number of heartbeats that a
+// node may miss in a row, before it is marked unreachable
+func (m *Manager) heartbeatMissThreshold() int {
+	config := m.getConfig()
+	if config == nil || config.Manager.HeartbeatMissThreshold < 1 {
+		return DefaultConfig().Manager.HeartbeatMissThreshold
+	}
+	return config.Manager.HeartbeatMissThreshold
+}
+
+// heartbeatLoop periodically triggers the heartbeat of the commissioned nodes.
+// Unlike the monitoring subsystem's events, the heartbeat notices the nodes
+// going away even if the monitoring subsystem is not functional.
+func (m *Manager) heartbeatLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		select {
+		case m.reqQ <- &heartbeatEvent{mgr: m}:
+		default:
+			logrus.Warnf("request queue is full, skipping the node heartbeat")
+		}
+	}
+}
+
+// heartbeatEvent probes the commissioned nodes. The nodes are probed in the
+// background and the results are processed as a heartbeatResultEvent.
+type heartbeatEvent struct {
+	mgr *Manager
+}
+
+func (e *heartbeatEvent) String() string {
+	return "heartbeatEvent"
+}
+
+func (e *heartbeatEvent) process() error {
+	// the probes of the unreachable nodes take upto the probe timeout, that may
+	// be longer than the heartbeat interval. The heartbeat is skipped meanwhile
+	if e.mgr.heartbeatInFlight {
+		logrus.Debugf("the previous heartbeat is in progress, skipping the node heartbeat")
+		return nil
+	}
+
+	addrs := map[string]string{}
+	for name, n := range e.mgr.nodes {
+		if n.Inv == nil || n.Mon == nil {
+			continue
+		}
+		if status, _ := n.Inv.GetStatus(); status != inventory.Allocated {
+			continue
+		}
+		addr := n.Mon.GetMgmtAddress()
+		if addr == "" {
+			logrus.Debugf("skipping the heartbeat of node %q. Error: %v", name, errNoMgmtAddress())
+			continue
+		}
+		addrs[name] = addr
+	}
+	if len(addrs) == 0 {
+		return nil
+	}
+
+	e.mgr.heartbeatInFlight = true
+	go func() {
+		e.mgr.reqQ <- &heartbeatResultEvent{
+			mgr: e.mgr,
+			results: probeNodes(addrs, func(addr string) error {
+				return e.mgr.probeNode(addr, heartbeatProbeTimeout)
+			}),
+		}
+	}()
+	return nil
+}
+
+// probeNodes probes the nodes concurrently and returns the result of the
+// probes, keyed by node name. The specified addresses are keyed by node name too
+func probeNodes(addrs map[string]string, probe func(addr string) error) map[string]error {
+	var (
+		wg      sync.WaitGroup
+		mutex   sync.Mutex
+		results = map[string]error{}
+	)
+	for name, addr := range addrs {
+		wg.Add(1)
+		go func(name, addr string) {
+			defer wg.Done()
+			err := probe(addr)
+			mutex.Lock()
+			defer mutex.Unlock()
+			results[name] = err
+		}(name, addr)
+	}
+	wg.Wait()
+	return results
+}
+
+// heartbeatResultEvent updates the reachability of the nodes as per the
+// result of their heartbeat probe
+type heartbeatResultEvent struct {
+	mgr     *Manager
+	results map[string]error // the result of probes, keyed by node name
+}
+
+func (e *heartbeatResultEvent) String() string {
+	names := []string{}
+	for name := range e.results {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return fmt.Sprintf("heartbeatResultEvent: nodes: %v", names)
+}
+
+func (e *heartbeatResultEvent) process() error {
+	e.mgr.heartbeatInFlight = false
+	threshold := e.mgr.heartbeatMissThreshold()
+	for name, probeErr := range e.results {
+		// the node may have gone away while it was being probed
+		n, ok := e.mgr.nodes[name]
+		if !ok {
+			continue
+		}
+		publish := e.mgr.trackNodeState(name)
+		e.mgr.nodesMutex.Lock()
+		n.recordHeartbeat(name, probeErr, threshold)
+		e.mgr.nodesMutex.Unlock()
+		publish()
+	}
+	return nil
+}
+
+// recordHeartbeat updates the node's reachability as per the result of it's
+// heartbeat probe. The node is marked unreachable once it misses the threshold
+// number of heartbeats in a row.
+func (n *node) recordHeartbeat(name string, probeErr error, threshold int) {
+	if probeErr == nil {
+		n.missedHeartbeats = 0
+		if n.Reachability == NodeUnreachable {
+			logrus.Infof("node %q is reachable again", name)
+		}
+		n.Reachability = NodeReachable
+		return
+	}
+
+	n.missedHeartbeats++
+	logrus.Debugf("node %q missed %d heartbeat(s). Error: %v", name, n.missedHeartbeats, probeErr)
+	if n.missedHeartbeats >= threshold && n.Reachability != NodeUnreachable {
+		logrus.Warnf("node %q missed %d heartbeats in a row, marking it unreachable. Error: %v",
+			name, n.missedHeartbeats, probeErr)
+		n.Reachability = NodeUnreachable
+	}
+}
+
+// unreachableNodesCount returns the number of nodes that are marked unreachable
+func (m *Manager) unreachableNodesCount() int {
+	count := 0
+	for _, n := range m.nodes {
+		if n.Reachability == NodeUnreachable {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,121 @@
+// +build unittest
+
+package manager
+
+import (
+	"errors"
+	"time"
+
+	"github.com/contiv/cluster/management/src/inventory"
+	"github.com/contiv/cluster/management/src/monitor"
+	. "gopkg.in/check.v1"
+)
+
+type heartbeatSuite struct {
+}
+
+var _ = Suite(&heartbeatSuite{})
+
+func (s *heartbeatSuite) TestRecordHeartbeat(c *C) {
+	n := &node{}
+	errProbe := errors.New("connection refused")
+
+	n.recordHeartbeat("node1", nil, 2)
+	c.Assert(n.Reachability, Equals, NodeReachable)
+
+	// the node is marked unreachable only after missing threshold heartbeats in a row
+	n.recordHeartbeat("node1", errProbe, 2)
+	c.Assert(n.Reachability, Equals, NodeReachable)
+	n.recordHeartbeat("node1", nil, 2)
+	n.recordHeartbeat("node1", errProbe, 2)
+	c.Assert(n.Reachability, Equals, NodeReachable)
+	n.recordHeartbeat("node1", errProbe, 2)
+	c.Assert(n.Reachability, Equals, NodeUnreachable)
+	n.recordHeartbeat("node1", errProbe, 2)
+	c.Assert(n.Reachability, Equals, NodeUnreachable)
+
+	n.recordHeartbeat("node1", nil, 2)
+	c.Assert(n.Reachability, Equals, NodeReachable)
+	c.Assert(n.missedHeartbeats, Equals, 0)
+}
+
+func (s *heartbeatSuite) TestHeartbeat(c *C) {
+	m := &Manager{
+		config: DefaultConfig(),
+		reqQ:   make(chan event, 1),
+		nodes: map[string]*node{
+			"node1": {
+				Mon: monitor.NewNode("node1", "s1", "1.1.1.1"),
+				Inv: inventory.NewAssetWithState(nil, "node1", inventory.Allocated, inventory.Discovered),
+			},
+			"node2": {
+				Mon: monitor.NewNode("node2", "s2", "1.1.1.2"),
+				Inv: inventory.NewAssetWithState(nil, "node2", inventory.Allocated, inventory.Discovered),
+			},
+			// the nodes that are not commissioned are not probed
+			"node3": {
+				Mon: monitor.NewNode("node3", "s3", "1.1.1.3"),
+				Inv: inventory.NewAssetWithState(nil, "node3", inventory.Unallocated, inventory.Discovered),
+			},
+			// nor the nodes whose mgmt address is not known
+			"node4": {
+				Mon: monitor.NewNode("node4", "s4", ""),
+				Inv: inventory.NewAssetWithState(nil, "node4", inventory.Allocated, inventory.Discovered),
+			},
+		},
+		probeNode: func(addr string, timeout time.Duration) error {
+			if addr == "1.1.1.2" {
+				return errors.New("connection refused")
+			}
+			return nil
+		},
+	}
+	m.config.Manager.HeartbeatMissThreshold = 1
+
+	c.Assert((&heartbeatEvent{mgr: m}).process(), IsNil)
+	e := (<-m.reqQ).(*heartbeatResultEvent)
+	c.Assert(e.results, HasLen, 2)
+	c.Assert(e.process(), IsNil)
+
+	c.Assert(m.nodes["node1"].Reachability, Equals, NodeReachable)
+	c.Assert(m.nodes["node2"].Reachability, Equals, NodeUnreachable)
+	c.Assert(m.nodes["node3"].Reachability, Equals, "")
+	c.Assert(m.nodes["node4"].Reachability, Equals, "")
+	c.Assert(m.unreachableNodesCount(), Equals, 1)
+}
+
+func (s *heartbeatSuite) TestHeartbeatInFlight(c *C) {
+	probes := make(chan string, 10)
+	m := &Manager{
+		config: DefaultConfig(),
+		reqQ:   make(chan event, 1),
+		nodes: map[string]*node{
+			"node1": {
+				Mon: monitor.NewNode("node1", "s1", "1.1.1.1"),
+				Inv: inventory.NewAssetWithState(nil, "node1", inventory.Allocated, inventory.Discovered),
+			},
+		},
+		probeNode: func(addr string, timeout time.Duration) error {
+			probes <- addr
+			return nil
+		},
+	}
+
+	c.Assert((&heartbeatEvent{mgr: m}).process(), IsNil)
+	e := (<-m.reqQ).(*heartbeatResultEvent)
+	c.Assert(probes, HasLen, 1)
+
+	// the heartbeat is skipped until the result of the previous one is processed
+	c.Assert((&heartbeatEvent{mgr: m}).process(), IsNil)
+	select {
+	case <-m.reqQ:
+		c.Fatalf("the nodes were probed while the previous heartbeat was in progress")
+	case <-time.After(100 * time.Millisecond):
+	}
+	c.Assert(probes, HasLen, 1)
+
+	c.Assert(e.process(), IsNil)
+	c.Assert((&heartbeatEvent{mgr: m}).process(), IsNil)
+	<-m.reqQ
+	c.Assert(probes, HasLen, 2)
+}
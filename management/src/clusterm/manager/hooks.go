@@ -0,0 +1,151 @@
+package manager
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// HookEvent describes an event, that is about to be or was processed, to the
+// event hooks
+type HookEvent struct {
+	// Name is the name of the event, like 'commission', 'decommission' or 'update'
+	Name string
+	// Nodes are the names of the nodes that the event acts upon. The discover
+	// event acts upon the node addresses instead.
+	Nodes []string
+	// Desc is the description of the event, that is also logged
+	Desc string
+}
+
+// EventHook is implemented by the custom logic that runs around the processing
+// of the events in the request queue, like allocating an address for a node
+// before it is commissioned and releasing it after it is decommissioned.
+//
+// The hook contract:
+//   - the hooks are invoked by the event workers, in the order they are registered,
+//     so they shall return quickly as they hold up the processing of the event.
+//   - with more than one job worker, the events that trigger a job on disjoint
+//     nodes are processed concurrently, so the hooks may be invoked concurrently
+//     for such events and shall be safe for concurrent use. The other events are
+//     processed alone, with no other event processed meanwhile.
+//   - PreEvent is invoked before an event is processed. If it returns an error,
+//     the event is aborted and the error is returned as the outcome of the event.
+//     The hooks that are registered after the failed hook are not invoked.
+//   - PostEvent is invoked after an event is processed, or aborted, with the outcome
+//     of the event. It is invoked for all hooks irrespective of the outcome.
+//   - for the events that trigger a job, the outcome is of starting the job. The
+//     job's status shall be looked up for the outcome of the job itself.
+type EventHook interface {
+	PreEvent(e *HookEvent) error
+	PostEvent(e *HookEvent, err error)
+}
+
+// NoopHook is the event hook that does nothing
+type NoopHook struct{}
+
+// PreEvent allows every event to be processed
+func (NoopHook) PreEvent(e *HookEvent) error { return nil }
+
+// PostEvent ignores the outcome of the event
+func (NoopHook) PostEvent(e *HookEvent, err error) {}
+
+// RegisterHook registers a hook to be invoked around the processing of every
+// event. The hooks shall be registered before the manager is run.
+func (m *Manager) RegisterHook(h EventHook) {
+	m.hooks = append(m.hooks, h)
+}
+
+// wrapperEvent is implemented by the events that wrap another event to
+// control it's processing
+type wrapperEvent interface {
+	event
+	// wrapped returns the wrapped event
+	wrapped() event
+	// abort completes the event with the specified error without processing it
+	abort(err error)
+}
+
+// unwrapEvent returns the innermost event wrapped by an event, or the event
+// itself if it doesn't wrap another event
+func unwrapEvent(e event) event {
+	for {
+		we, ok := e.(wrapperEvent)
+		if !ok {
+			return e
+		}
+		e = we.wrapped()
+	}
+}
+
+// newHookEvent returns the description of the event, or the event wrapped by
+// it, for the event hooks
+func newHookEvent(e event) *HookEvent {
+	e = unwrapEvent(e)
+	he := &HookEvent{
+		Name: strings.TrimSuffix(strings.TrimPrefix(fmt.Sprintf("%T", e), "*manager."), "Event"),
+		Desc: e.String(),
+	}
+	switch te := e.(type) {
+	case *commissionEvent:
+		he.Nodes = te.nodeNames
+	case *decommissionEvent:
+		he.Nodes = te.nodeNames
+	case *updateEvent:
+		he.Nodes = te.nodeNames
+	case *upgradeEvent:
+		he.Nodes = te.nodeNames
+	case *rebootEvent:
+		he.Nodes = te.nodeNames
+	case *bulkCommissionEvent:
+		he.Nodes = te.plan.nodeNames()
+	case *removeNodesEvent:
+		he.Nodes = te.nodeNames
+	case *discoverEvent:
+		he.Nodes = te.nodeAddrs
+	case *setAnnotationsEvent:
+		he.Nodes = []string{te.name}
+	case *discoveredEvent:
+		for _, n := range te.nodes {
+			he.Nodes = append(he.Nodes, n.GetLabel())
+		}
+	case *disappearedEvent:
+		for _, n := range te.nodes {
+			he.Nodes = append(he.Nodes, n.GetLabel())
+		}
+	}
+	return he
+}
+
+// processEvent processes an event, invoking the registered hooks around it
+func (m *Manager) processEvent(e event) error {
+	if len(m.hooks) == 0 {
+		return e.process()
+	}
+
+	he := newHookEvent(e)
+	err := m.preEvent(he)
+	if err != nil {
+		logrus.Errorf("event %s aborted by hook. Error: %v", e, err)
+		if we, ok := e.(wrapperEvent); ok {
+			we.abort(err)
+		}
+	} else {
+		err = e.process()
+	}
+	for _, h := range m.hooks {
+		h.PostEvent(he, err)
+	}
+	return err
+}
+
+// preEvent invokes the pre-event hooks until one of them fails
+func (m *Manager) preEvent(he *HookEvent) error {
+	for _, h := range m.hooks {
+		if err := h.PreEvent(he); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+// +build unittest
+
+package manager
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type hooksSuite struct {
+}
+
+var _ = Suite(&hooksSuite{})
+
+// recordingHook records the events it is invoked for and fails the pre-event
+// hook with preErr, if set
+type recordingHook struct {
+	pre    []string
+	post   []string
+	errs   []error
+	preErr error
+}
+
+func (h *recordingHook) PreEvent(e *HookEvent) error {
+	h.pre = append(h.pre, e.Name)
+	return h.preErr
+}
+
+func (h *recordingHook) PostEvent(e *HookEvent, err error) {
+	h.post = append(h.post, e.Name)
+	h.errs = append(h.errs, err)
+}
+
+// countingEvent counts the times it is processed
+type countingEvent struct {
+	count int
+}
+
+func (e *countingEvent) String() string { return "countingEvent" }
+
+func (e *countingEvent) process() error {
+	e.count++
+	return nil
+}
+
+func (s *hooksSuite) TestHooksInvoked(c *C) {
+	m := &Manager{}
+	h1, h2 := &recordingHook{}, &recordingHook{}
+	m.RegisterHook(h1)
+	m.RegisterHook(NoopHook{})
+	m.RegisterHook(h2)
+
+	e := &countingEvent{}
+	c.Assert(m.processEvent(newWaitableEvent(e)), IsNil)
+	c.Assert(e.count, Equals, 1)
+	for _, h := range []*recordingHook{h1, h2} {
+		c.Assert(h.pre, DeepEquals, []string{"counting"})
+		c.Assert(h.post, DeepEquals, []string{"counting"})
+		c.Assert(h.errs, DeepEquals, []error{nil})
+	}
+}
+
+func (s *hooksSuite) TestPreHookAborts(c *C) {
+	m := &Manager{}
+	h1, h2 := &recordingHook{preErr: fmt.Errorf("ipam failure")}, &recordingHook{}
+	m.RegisterHook(h1)
+	m.RegisterHook(h2)
+
+	e := &countingEvent{}
+	we := newWaitableEvent(e)
+	c.Assert(m.processEvent(we), ErrorMatches, "ipam failure")
+	// the event is not processed and it's waiter is signalled
+	c.Assert(e.count, Equals, 0)
+	c.Assert(we.waitForCompletion(), ErrorMatches, "ipam failure")
+	// the later pre-event hooks are skipped, but all post-event hooks are invoked
+	c.Assert(h2.pre, HasLen, 0)
+	c.Assert(h1.errs, DeepEquals, []error{h1.preErr})
+	c.Assert(h2.errs, DeepEquals, []error{h1.preErr})
+}
+
+func (s *hooksSuite) TestPreHookAbortsAsyncJob(c *C) {
+	m := &Manager{}
+	m.RegisterHook(&recordingHook{preErr: fmt.Errorf("ipam failure")})
+
+	e := newCommissionEvent(m, []string{"node1"}, "", "", "", 0)
+	pending, _ := m.newPendingJob(e.String(), "", nil)
+	c.Assert(m.processEvent(&asyncJobEvent{jobEvent: e, mgr: m, pending: pending}), NotNil)
+	status, err := pending.Status()
+	c.Assert(status, Equals, Errored)
+	c.Assert(err, ErrorMatches, "ipam failure")
+}
+
+func (s *hooksSuite) TestNewHookEvent(c *C) {
+	e := newCommissionEvent(&Manager{}, []string{"node1", "node2"}, "", "", "", 0)
+	he := newHookEvent(newWaitableEvent(e))
+	c.Assert(he.Name, Equals, "commission")
+	c.Assert(he.Nodes, DeepEquals, []string{"node1", "node2"})
+	c.Assert(he.Desc, Equals, e.String())
+}
+
+func (s *hooksSuite) TestNewHookEventBulkCommission(c *C) {
+	plan := &CommissionPlan{Groups: []CommissionPlanGroup{
+		{Nodes: []string{"node1", "node2"}, HostGroup: "service-master"},
+		{Nodes: []string{"node3"}, HostGroup: "service-worker"},
+	}}
+	he := newHookEvent(newBulkCommissionEvent(&Manager{}, plan, 0))
+	c.Assert(he.Name, Equals, "bulkCommission")
+	c.Assert(he.Nodes, DeepEquals, []string{"node1", "node2", "node3"})
+}
+
+func (s *hooksSuite) TestNewHookEventRemoveNodes(c *C) {
+	he := newHookEvent(newRemoveNodesEvent(&Manager{}, []string{"node1", "node2"}))
+	c.Assert(he.Name, Equals, "removeNodes")
+	c.Assert(he.Nodes, DeepEquals, []string{"node1", "node2"})
+}
+
+// barrierHook holds the pre-event hook of an event until the pre-event hooks
+// of n events are invoked, and fails it if they are not invoked in time
+type barrierHook struct {
+	NoopHook
+	sync.Mutex
+	n       int
+	pre     []string
+	arrived chan struct{}
+}
+
+func (h *barrierHook) PreEvent(e *HookEvent) error {
+	h.Lock()
+	h.pre = append(h.pre, e.Name)
+	if len(h.pre) == h.n {
+		close(h.arrived)
+	}
+	h.Unlock()
+	select {
+	case <-h.arrived:
+		return nil
+	case <-time.After(2 * time.Second):
+		return fmt.Errorf("the pre-event hooks of %d events were not invoked together", h.n)
+	}
+}
+
+func (s *hooksSuite) TestHooksInvokedConcurrently(c *C) {
+	cfg := &gatedConfigSubsys{started: make(chan string, 10)}
+	m := newJobWorkersTestManager(cfg, &fakeStatusInventory{}, 2, "node1", "node2")
+	h := &barrierHook{n: 2, arrived: make(chan struct{})}
+	m.RegisterHook(h)
+
+	// the commissions of disjoint nodes are processed, and their hooks invoked, concurrently
+	we1 := newWaitableEvent(newCommissionEvent(m, []string{"node1"}, "", ansibleMasterGroupName, "", 0))
+	we2 := newWaitableEvent(newCommissionEvent(m, []string{"node2"}, "", ansibleMasterGroupName, "", 0))
+	c.Assert(m.enqueue(we1), IsNil)
+	c.Assert(m.enqueue(we2), IsNil)
+	c.Assert(we1.waitForCompletion(), IsNil)
+	c.Assert(we2.waitForCompletion(), IsNil)
+	h.Lock()
+	defer h.Unlock()
+	c.Assert(h.pre, DeepEquals, []string{"commission", "commission"})
+}
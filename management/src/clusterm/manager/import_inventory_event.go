@@ -0,0 +1,150 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/contiv/cluster/management/src/configuration"
+	"github.com/contiv/errored"
+)
+
+func errIncompatibleExportVersion(version int) error {
+	return errored.Errorf("incompatible inventory export version %d. Expected version %d",
+		version, inventoryExportVersion)
+}
+
+// InventoryImportReport describes the changes that an inventory import made, or
+// would make in case of a dry run
+type InventoryImportReport struct {
+	DryRun         bool `json:"dry_run"`
+	GlobalsChanged bool `json:"globals_changed"`
+	// NodesAdded are the nodes that were not known and are added to the inventory
+	NodesAdded []string `json:"nodes_added"`
+	// NodesSkipped are the nodes that are already known, their info is left as is
+	NodesSkipped []string `json:"nodes_skipped"`
+}
+
+// importInventoryEvent restores the nodes and globals from an exported inventory.
+// The nodes that are already known are not overwritten. The configuration in
+// the bundle is not restored, it can be updated as a config change instead.
+type importInventoryEvent struct {
+	mgr    *Manager
+	bundle *InventoryExport
+	dryRun bool
+
+	report *InventoryImportReport
+}
+
+// newImportInventoryEvent creates and returns importInventoryEvent
+func newImportInventoryEvent(mgr *Manager, bundle *InventoryExport, dryRun bool) *importInventoryEvent {
+	return &importInventoryEvent{
+		mgr:    mgr,
+		bundle: bundle,
+		dryRun: dryRun,
+	}
+}
+
+func (e *importInventoryEvent) String() string {
+	return fmt.Sprintf("importInventoryEvent: version: %d exported-at: %s dry-run: %v",
+		e.bundle.Version, e.bundle.ExportedAt, e.dryRun)
+}
+
+func (e *importInventoryEvent) process() error {
+	if e.bundle.Version != inventoryExportVersion {
+		return errBadRequest(errIncompatibleExportVersion(e.bundle.Version))
+	}
+
+	nodes := map[string]json.RawMessage{}
+	if len(e.bundle.Nodes) > 0 {
+		if err := json.Unmarshal(e.bundle.Nodes, &nodes); err != nil {
+			return errBadRequest(errInvalidJSON("nodes", err))
+		}
+	}
+	globals := struct {
+		ExtraVars map[string]interface{} `json:"extra_vars"`
+	}{}
+	if len(e.bundle.Globals) > 0 {
+		if err := json.Unmarshal(e.bundle.Globals, &globals); err != nil {
+			return errBadRequest(errInvalidJSON("globals", err))
+		}
+	}
+
+	report := &InventoryImportReport{
+		DryRun:       e.dryRun,
+		NodesAdded:   []string{},
+		NodesSkipped: []string{},
+	}
+
+	// the globals are restored only if they are set in the bundle
+	var extraVars string
+	if globals.ExtraVars != nil {
+		var err error
+		if extraVars, report.GlobalsChanged, err = e.changedGlobals(globals.ExtraVars); err != nil {
+			return err
+		}
+	}
+
+	names := []string{}
+	for name := range nodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, err := e.mgr.findNode(name); err == nil || e.mgr.inventory.GetAsset(name) != nil {
+			report.NodesSkipped = append(report.NodesSkipped, name)
+			continue
+		}
+		report.NodesAdded = append(report.NodesAdded, name)
+	}
+
+	if !e.dryRun {
+		if err := e.apply(report, extraVars); err != nil {
+			return err
+		}
+	}
+	e.report = report
+	return nil
+}
+
+// changedGlobals returns the encoded globals from the bundle, and true if they
+// differ from the current globals
+func (e *importInventoryEvent) changedGlobals(extraVars map[string]interface{}) (string, bool, error) {
+	// the vault encrypted globals are not revealed, so they are compared as empty
+	currentVars := map[string]interface{}{}
+	if current := e.mgr.configuration.GetGlobals(); !configuration.IsVaultEncrypted(current) {
+		if err := json.Unmarshal([]byte(current), &currentVars); err != nil {
+			return "", false, err
+		}
+	}
+	if reflect.DeepEqual(currentVars, extraVars) {
+		return "", false, nil
+	}
+	out, err := json.Marshal(extraVars)
+	if err != nil {
+		return "", false, err
+	}
+	return string(out), true, nil
+}
+
+// apply makes the changes described in the report
+func (e *importInventoryEvent) apply(report *InventoryImportReport, extraVars string) error {
+	if report.GlobalsChanged {
+		if err := e.mgr.configuration.SetGlobals(extraVars); err != nil {
+			return err
+		}
+	}
+	for _, name := range report.NodesAdded {
+		if err := e.mgr.inventory.AddAsset(name); err != nil {
+			logrus.Errorf("adding imported asset %q to inventory failed. Error: %s", name, err)
+			return err
+		}
+		// the imported node is not discovered yet, so it is marked disappeared until it is
+		if err := e.mgr.inventory.SetAssetDisappeared(name); err != nil {
+			logrus.Errorf("setting imported asset %q to disappeared in inventory failed. Error: %s", name, err)
+		}
+	}
+	return nil
+}
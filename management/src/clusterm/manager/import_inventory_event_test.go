@@ -0,0 +1,78 @@
+// +build unittest
+
+package manager
+
+import (
+	"encoding/json"
+
+	"github.com/contiv/cluster/management/src/configuration"
+	"github.com/contiv/cluster/management/src/inventory"
+	"github.com/contiv/cluster/management/src/mock"
+	"github.com/golang/mock/gomock"
+	. "gopkg.in/check.v1"
+)
+
+type importInventorySuite struct {
+}
+
+var _ = Suite(&importInventorySuite{})
+
+func newTestBundle(version int) *InventoryExport {
+	return &InventoryExport{
+		Version: version,
+		Nodes:   json.RawMessage(`{"node1":{},"node2":{},"node3":{}}`),
+		Globals: json.RawMessage(`{"extra_vars":{"foo":"bar"}}`),
+	}
+}
+
+func (s *importInventorySuite) TestImportInventory(c *C) {
+	ctrl := gomock.NewController(c)
+	defer ctrl.Finish()
+
+	mClient := mock.NewMockSubsysClient(ctrl)
+	inv := inventory.NewGeneralSubsys(mClient)
+	// node1 is live and node2 is known to inventory only
+	c.Assert(inv.RestoreAsset("node2",
+		inventory.NewAssetWithState(mClient, "node2", inventory.Allocated, inventory.Disappeared)), IsNil)
+	cfg := configuration.NewAnsibleSubsys(&configuration.AnsibleSubsysConfig{})
+	m := &Manager{
+		inventory:     inv,
+		configuration: cfg,
+		nodes:         map[string]*node{"node1": {}},
+	}
+
+	exptdReport := &InventoryImportReport{
+		DryRun:         true,
+		GlobalsChanged: true,
+		NodesAdded:     []string{"node3"},
+		NodesSkipped:   []string{"node1", "node2"},
+	}
+	// nothing is changed in a dry run
+	e := newImportInventoryEvent(m, newTestBundle(inventoryExportVersion), true)
+	c.Assert(e.process(), IsNil)
+	c.Assert(e.report, DeepEquals, exptdReport)
+	c.Assert(cfg.GetGlobals(), Equals, configuration.DefaultValidJSON)
+	c.Assert(inv.GetAsset("node3"), IsNil)
+
+	mClient.EXPECT().CreateAsset("node3", gomock.Any())
+	mClient.EXPECT().SetAssetStatus("node3", gomock.Any(), gomock.Any(), gomock.Any()).Times(2)
+	e = newImportInventoryEvent(m, newTestBundle(inventoryExportVersion), false)
+	c.Assert(e.process(), IsNil)
+	exptdReport.DryRun = false
+	c.Assert(e.report, DeepEquals, exptdReport)
+	c.Assert(cfg.GetGlobals(), Equals, `{"foo":"bar"}`)
+	c.Assert(inv.GetAsset("node3"), NotNil)
+	// the live node is not overwritten
+	c.Assert(inv.GetAsset("node1"), IsNil)
+	status, state := inv.GetAsset("node2").GetStatus()
+	c.Assert(status, Equals, inventory.Allocated)
+	c.Assert(state, Equals, inventory.Disappeared)
+}
+
+func (s *importInventorySuite) TestImportInventoryIncompatibleVersion(c *C) {
+	e := newImportInventoryEvent(&Manager{}, newTestBundle(inventoryExportVersion+1), false)
+	err := e.process()
+	c.Assert(err, NotNil)
+	c.Assert(err.Error(), Equals, errIncompatibleExportVersion(inventoryExportVersion+1).Error())
+	c.Assert(httpStatus(err), Equals, 400)
+}
@@ -0,0 +1,39 @@
+package manager
+
+import (
+	"net/http"
+
+	"github.com/contiv/cluster/management/src/ansible"
+	"github.com/contiv/errored"
+)
+
+// errInventoryOverrideDisabled is the error returned when a request specifies
+// an inventory, but the inventory override is not enabled
+func errInventoryOverrideDisabled() error {
+	return &apiError{
+		status: http.StatusForbidden,
+		code:   ErrCodeInventoryOverrideDisabled,
+		err:    errored.Errorf("Inventory override is not enabled, set manager.allow_inventory_override in clusterm configuration to enable it"),
+	}
+}
+
+// errInvalidInventory is the error returned when the inventory specified in a
+// request can't be parsed
+func errInvalidInventory(err error) error {
+	return errored.Errorf("Invalid inventory specified. Error: %v", err)
+}
+
+// validateInventoryOverride makes sure that the inventory, if any, can be
+// used for a run
+func (m *Manager) validateInventoryOverride(inventory string) error {
+	if inventory == "" {
+		return nil
+	}
+	if config := m.getConfig(); config == nil || !config.Manager.AllowInventoryOverride {
+		return errInventoryOverrideDisabled()
+	}
+	if _, err := ansible.ParseInventory(inventory); err != nil {
+		return errBadRequest(errInvalidInventory(err))
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+// +build unittest
+
+package manager
+
+import (
+	"net/http"
+
+	"github.com/contiv/cluster/management/src/configuration"
+	. "gopkg.in/check.v1"
+)
+
+type inventoryOverrideSuite struct {
+}
+
+var _ = Suite(&inventoryOverrideSuite{})
+
+const testInventoryOverride = "[service-master]\nnode1 ansible_ssh_host=1.1.1.1\n"
+
+func (s *inventoryOverrideSuite) TestValidateInventoryOverride(c *C) {
+	m := &Manager{config: DefaultConfig()}
+	c.Assert(m.validateInventoryOverride(""), IsNil)
+
+	// the override is rejected unless enabled
+	err := m.validateInventoryOverride(testInventoryOverride)
+	c.Assert(err, NotNil)
+	c.Assert(httpStatus(err), Equals, http.StatusForbidden)
+
+	m.config.Manager.AllowInventoryOverride = true
+	c.Assert(m.validateInventoryOverride(testInventoryOverride), IsNil)
+	err = m.validateInventoryOverride("[service-master]\nnode1 ansible_ssh_host\n")
+	c.Assert(err, NotNil)
+	c.Assert(httpStatus(err), Equals, http.StatusBadRequest)
+}
+
+func (s *inventoryOverrideSuite) TestPrepareInventoryOverride(c *C) {
+	host := configuration.NewAnsibleHost("node1", "1.1.1.1", ansibleMasterGroupName, map[string]string{})
+	enodes := map[string]*node{"node1": {Cfg: host}}
+
+	ce := newCommissionEvent(&Manager{}, []string{"node1"}, "", ansibleWorkerGroupName, "", 0)
+	ce.inventory = testInventoryOverride
+	ce._enodes = enodes
+	c.Assert(ce.prepareInventory(), IsNil)
+	c.Assert(ce._hosts, Equals, configuration.AnsibleInventory(testInventoryOverride))
+
+	ue := newUpdateEvent(&Manager{}, []string{"node1"}, "", ansibleWorkerGroupName, "", 0)
+	ue.inventory = testInventoryOverride
+	ue._enodes = enodes
+	c.Assert(ue.pepareInventory(), IsNil)
+	c.Assert(ue._hosts, Equals, configuration.AnsibleInventory(testInventoryOverride))
+
+	// the managed inventory is left as is
+	c.Assert(host.GetGroup(), Equals, ansibleMasterGroupName)
+}
@@ -0,0 +1,329 @@
+package manager
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/contiv/cluster/management/src/inventory"
+	"github.com/contiv/errored"
+)
+
+// jobStore persists the records of jobs, so that the job history survives
+// clusterm restarts
+type jobStore interface {
+	PutJob(id uint64, info []byte) error
+	GetAllJobs() ([][]byte, error)
+	DeleteJob(id uint64) error
+}
+
+var errJobInterrupted = errored.Errorf("job was interrupted as clusterm stopped while it was in progress")
+
+// saveJob persists the record of the job, if a job store is available. It is
+// best effort and failures are just logged
+func (m *Manager) saveJob(j *Job) {
+	if m.jobStore == nil {
+		return
+	}
+	info, err := j.MarshalJSON()
+	if err != nil {
+		logrus.Errorf("failed to marshal job %d for saving. Error: %v", j.id, err)
+		return
+	}
+	if err := m.jobStore.PutJob(j.id, info); err != nil {
+		logrus.Errorf("failed to save job %d. Error: %v", j.id, err)
+	}
+}
+
+// JobRetention reports the retention of the job history against it's limits
+type JobRetention struct {
+	// Jobs is the number of jobs in the job history, out of MaxJobs
+	Jobs    int `json:"jobs"`
+	MaxJobs int `json:"max_jobs"`
+	// LogsBytes is the total size of the logs of the jobs in the job history,
+	// out of MaxLogsBytes if the size is limited
+	LogsBytes    int64 `json:"logs_bytes"`
+	MaxLogsBytes int64 `json:"max_logs_bytes,omitempty"`
+	// OldestJobAt is the time the oldest job in the job history finished, if any.
+	// It's pruned once it's older than MaxAge, if the jobs are pruned by age
+	OldestJobAt *time.Time `json:"oldest_job_at,omitempty"`
+	MaxAge      string     `json:"max_age,omitempty"`
+}
+
+// jobHistorySize returns the configured number of jobs kept in the job history
+func jobHistorySize(config *Config) int {
+	if config == nil || config.Manager.JobHistorySize < 1 {
+		return maxJobHistory
+	}
+	return config.Manager.JobHistorySize
+}
+
+// jobLogsMaxBytes returns the configured total size of the logs of the jobs
+// kept in the job history. It is zero if the size is not limited
+func jobLogsMaxBytes(config *Config) int64 {
+	if config == nil {
+		return 0
+	}
+	return config.Manager.JobLogsMaxBytes
+}
+
+// jobHistoryMaxAge returns the configured age after which the jobs are pruned
+// from the job history. It is zero if the jobs are not pruned by age
+func jobHistoryMaxAge(config *Config) time.Duration {
+	if config == nil || config.Manager.JobHistoryMaxAge == "" {
+		return 0
+	}
+	// the max age is validated when the manager is instantiated
+	d, _ := parseTimeout(config.Manager.JobHistoryMaxAge)
+	return d
+}
+
+// addToJobHistory records a finished job in the job history. The oldest jobs
+// are pruned as per the retention configuration, see pruneJobHistory
+func (m *Manager) addToJobHistory(j *Job) {
+	m.jobsMutex.Lock()
+	defer m.jobsMutex.Unlock()
+	m.jobHistory = append(m.jobHistory, j)
+	m.pruneJobHistory(time.Now())
+}
+
+// pruneJobHistory removes the oldest jobs, along with their logs, from the job
+// history and the job store while the history has more jobs than configured,
+// their logs exceed the configured size or they are older than the configured
+// age. The most recent job is always kept, so that the last job stays available.
+// The caller shall hold the jobsMutex
+func (m *Manager) pruneJobHistory(now time.Time) {
+	config := m.getConfig()
+	maxJobs, maxBytes, maxAge := jobHistorySize(config), jobLogsMaxBytes(config), jobHistoryMaxAge(config)
+	logsBytes := int64(0)
+	for _, j := range m.jobHistory {
+		logsBytes += j.logsLen()
+	}
+	for len(m.jobHistory) > 1 {
+		old := m.jobHistory[0]
+		if len(m.jobHistory) <= maxJobs && (maxBytes <= 0 || logsBytes <= maxBytes) &&
+			(maxAge <= 0 || now.Sub(old.doneAt()) <= maxAge) {
+			break
+		}
+		m.jobHistory = m.jobHistory[1:]
+		logsBytes -= old.logsLen()
+		if m.jobStore == nil {
+			continue
+		}
+		if err := m.jobStore.DeleteJob(old.id); err != nil {
+			logrus.Errorf("failed to delete job %d. Error: %v", old.id, err)
+		}
+	}
+}
+
+// jobHistoryCleanerLoop periodically prunes the jobs that got older than the
+// configured age from the job history
+func (m *Manager) jobHistoryCleanerLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		m.jobsMutex.Lock()
+		m.pruneJobHistory(now)
+		m.jobsMutex.Unlock()
+	}
+}
+
+// jobRetention returns the retention of the job history
+func (m *Manager) jobRetention() *JobRetention {
+	config := m.getConfig()
+	m.jobsMutex.Lock()
+	defer m.jobsMutex.Unlock()
+	r := &JobRetention{
+		Jobs:         len(m.jobHistory),
+		MaxJobs:      jobHistorySize(config),
+		MaxLogsBytes: jobLogsMaxBytes(config),
+	}
+	if maxAge := jobHistoryMaxAge(config); maxAge > 0 {
+		r.MaxAge = maxAge.String()
+	}
+	for _, j := range m.jobHistory {
+		r.LogsBytes += j.logsLen()
+	}
+	if len(m.jobHistory) > 0 {
+		oldest := m.jobHistory[0].doneAt()
+		r.OldestJobAt = &oldest
+	}
+	return r
+}
+
+// logsLen returns the size of the job's logs
+func (j *Job) logsLen() int64 {
+	j.logsMutex.Lock()
+	defer j.logsMutex.Unlock()
+	return int64(j.logs.Len())
+}
+
+// doneAt returns the time the job finished, or was created if it never ran
+func (j *Job) doneAt() time.Time {
+	j.Lock()
+	defer j.Unlock()
+	if j.finishedAt.IsZero() {
+		return j.createdAt
+	}
+	return j.finishedAt
+}
+
+// getJobHistory returns the recent jobs, most recent first
+func (m *Manager) getJobHistory() []*Job {
+	m.jobsMutex.Lock()
+	defer m.jobsMutex.Unlock()
+	jobs := make([]*Job, 0, len(m.jobHistory))
+	for i := len(m.jobHistory) - 1; i >= 0; i-- {
+		jobs = append(jobs, m.jobHistory[i])
+	}
+	return jobs
+}
+
+// playbookTasks returns the number of tasks that the most recent completed job
+// of the playbook's version ran. It is zero if there is no such job
+func (m *Manager) playbookTasks(playbook, version string) int {
+	if playbook == "" || version == "" {
+		return 0
+	}
+	for _, j := range m.getJobHistory() {
+		j.Lock()
+		tasks := j.tasks
+		match := j.status == Complete && j.playbook == playbook && j.playbookVersion == version
+		j.Unlock()
+		if match && tasks > 0 {
+			return tasks
+		}
+	}
+	return 0
+}
+
+// findJobByID returns the active, pending or recent job with the specified id
+func (m *Manager) findJobByID(id uint64) *Job {
+	m.jobsMutex.Lock()
+	defer m.jobsMutex.Unlock()
+	if j, ok := m.activeJobs[id]; ok {
+		return j
+	}
+	if j, ok := m.pendingJobs[id]; ok {
+		return j
+	}
+	for _, j := range m.jobHistory {
+		if j.id == id {
+			return j
+		}
+	}
+	return nil
+}
+
+// findJobByIdempotencyKey returns the active, pending or recent job, created within
+// idempotencyKeyTTL, that was triggered by a request with the specified key
+func (m *Manager) findJobByIdempotencyKey(key string) *Job {
+	m.jobsMutex.Lock()
+	defer m.jobsMutex.Unlock()
+	return m.jobByIdempotencyKey(key)
+}
+
+// jobByIdempotencyKey is findJobByIdempotencyKey for the callers that hold the jobsMutex
+func (m *Manager) jobByIdempotencyKey(key string) *Job {
+	matches := func(j *Job) bool {
+		return j.idempotencyKey == key && time.Since(j.createdAt) < idempotencyKeyTTL
+	}
+	for _, jobs := range []map[uint64]*Job{m.activeJobs, m.pendingJobs} {
+		for _, j := range jobs {
+			if matches(j) {
+				return j
+			}
+		}
+	}
+	for i := len(m.jobHistory) - 1; i >= 0; i-- {
+		if matches(m.jobHistory[i]) {
+			return m.jobHistory[i]
+		}
+	}
+	return nil
+}
+
+// restoreJobHistory restores the job history from the job store. The jobs
+// that were queued or running when clusterm stopped are recorded as interrupted.
+// The most recent job is restored as the last job.
+func (m *Manager) restoreJobHistory() error {
+	if m.jobStore == nil {
+		return nil
+	}
+
+	infos, err := m.jobStore.GetAllJobs()
+	if err != nil {
+		return err
+	}
+
+	for _, info := range infos {
+		j, err := newJobFromInfo(info)
+		if err != nil {
+			logrus.Errorf("failed to restore job from %s. Error: %v", info, err)
+			continue
+		}
+		if j.status == Queued || j.status == Running || j.status == Scheduled {
+			j.interrupt()
+			m.saveJob(j)
+		}
+		if j.id > m.jobSeq {
+			m.jobSeq = j.id
+		}
+		m.addToJobHistory(j)
+		m.lastJob = j
+	}
+	return nil
+}
+
+// interrupt marks a job, that was scheduled, queued or running when clusterm
+// stopped, as interrupted. The nodes on which the job didn't finish are marked failed.
+func (j *Job) interrupt() {
+	j.status = Interrupted
+	j.errVal = errJobInterrupted
+	for name, status := range j.nodes {
+		if status == NodePending || status == NodeRunning {
+			j.nodes[name] = NodeFailed
+		}
+	}
+	j.progress = 100
+}
+
+// recoverInterruptedAssets rolls back the assets that were left in a transitional
+// status by a job that was interrupted by clusterm stopping. The assets are
+// rolled back to the status that the job would have set had it failed, i.e.:
+// - an asset being commissioned (provisioning) is set unallocated
+// - an asset being updated (maintenance) is set unallocated
+// - an asset being decommissioned (cancelled) is set decommissioned
+// The rollback is recorded in the logs of the last job, if it was interrupted.
+func (m *Manager) recoverInterruptedAssets() {
+	assets, ok := m.inventory.GetAllAssets().(map[string]*inventory.Asset)
+	if !ok {
+		return
+	}
+
+	rollbacks := map[inventory.AssetStatus]setInvStateCallback{
+		inventory.Provisioning: m.inventory.SetAssetUnallocated,
+		inventory.Maintenance:  m.inventory.SetAssetUnallocated,
+		inventory.Cancelled:    m.inventory.SetAssetDecommissioned,
+	}
+	recovered := false
+	for name, asset := range assets {
+		status, _ := asset.GetStatus()
+		rollbackCb, ok := rollbacks[status]
+		if !ok {
+			continue
+		}
+		msg := fmt.Sprintf("rolling back node %q from %s status as it's job was interrupted", name, status)
+		if err := rollbackCb(name); err != nil {
+			msg = fmt.Sprintf("failed to roll back node %q from %s status. Error: %v", name, status, err)
+		}
+		logrus.Infof("%s", msg)
+		if m.lastJob != nil && m.lastJob.status == Interrupted {
+			m.lastJob.logs.WriteString("\n" + msg)
+			recovered = true
+		}
+	}
+	if recovered {
+		m.saveJob(m.lastJob)
+	}
+}
@@ -0,0 +1,224 @@
+// +build unittest
+
+package manager
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/contiv/cluster/management/src/inventory"
+	"github.com/contiv/cluster/management/src/mock"
+	"github.com/golang/mock/gomock"
+	. "gopkg.in/check.v1"
+)
+
+type jobHistorySuite struct {
+}
+
+var _ = Suite(&jobHistorySuite{})
+
+// testJobStore is an in-memory job store
+type testJobStore map[uint64][]byte
+
+func (s testJobStore) PutJob(id uint64, info []byte) error {
+	s[id] = info
+	return nil
+}
+
+func (s testJobStore) GetAllJobs() ([][]byte, error) {
+	ids := []int{}
+	for id := range s {
+		ids = append(ids, int(id))
+	}
+	sort.Ints(ids)
+	infos := [][]byte{}
+	for _, id := range ids {
+		infos = append(infos, s[uint64(id)])
+	}
+	return infos, nil
+}
+
+func (s testJobStore) DeleteJob(id uint64) error {
+	delete(s, id)
+	return nil
+}
+
+func (s *jobHistorySuite) TestJobInfoRoundTrip(c *C) {
+	j := NewJob("testJob", nil, nil)
+	j.id = 5
+	j.task = "testTask"
+	j.status = Complete
+	j.summary = &JobSummary{Passed: true}
+	j.nodes["node1"] = NodeOk
+	j.progress = 100
+	j.tasks = 3
+	j.logs.WriteString("foo\nbar")
+
+	info, err := j.MarshalJSON()
+	c.Assert(err, IsNil)
+	rj, err := newJobFromInfo(info)
+	c.Assert(err, IsNil)
+	rinfo, err := rj.MarshalJSON()
+	c.Assert(err, IsNil)
+	c.Assert(string(rinfo), Equals, string(info))
+}
+
+func (s *jobHistorySuite) TestPlaybookTasks(c *C) {
+	m := &Manager{}
+	for i, status := range []JobStatus{Complete, Errored, Complete} {
+		j, err := m.checkAndSetActiveJob(status.String(), nil, 0, nil, nil)
+		c.Assert(err, IsNil)
+		j.status = status
+		j.playbook, j.playbookVersion = "site.yml", "v1"
+		j.tasks = 10 + i
+		m.resetActiveJob(j)
+	}
+	// the most recent completed job's tasks are expected
+	c.Assert(m.playbookTasks("site.yml", "v1"), Equals, 12)
+	c.Assert(m.playbookTasks("site.yml", "v2"), Equals, 0)
+	c.Assert(m.playbookTasks("site.yml", ""), Equals, 0)
+}
+
+func (s *jobHistorySuite) TestRestoreJobHistory(c *C) {
+	store := testJobStore{}
+	m := &Manager{jobStore: store}
+	for _, status := range []JobStatus{Complete, Errored, Running} {
+		j, err := m.checkAndSetActiveJob(status.String(), nil, 0, nil, nil)
+		c.Assert(err, IsNil)
+		j.status = status
+		m.resetActiveJob(j)
+	}
+
+	m = &Manager{jobStore: store}
+	c.Assert(m.restoreJobHistory(), IsNil)
+	c.Assert(m.jobSeq, Equals, uint64(3))
+	c.Assert(m.lastJob, NotNil)
+	c.Assert(m.lastJob.id, Equals, uint64(3))
+	status, errVal := m.lastJob.Status()
+	c.Assert(status, Equals, Interrupted)
+	c.Assert(errVal.Error(), Equals, errJobInterrupted.Error())
+
+	// the interrupted status is persisted as well
+	var info JobInfo
+	c.Assert(json.Unmarshal(store[3], &info), IsNil)
+	c.Assert(info.Status, Equals, Interrupted.String())
+
+	jobs := m.getJobHistory()
+	c.Assert(len(jobs), Equals, 3)
+	c.Assert(jobs[0].id, Equals, uint64(3))
+	c.Assert(jobs[2].desc, Equals, Complete.String())
+}
+
+func (s *jobHistorySuite) TestJobHistoryTrim(c *C) {
+	store := testJobStore{}
+	m := &Manager{jobStore: store}
+	for i := 0; i < maxJobHistory+2; i++ {
+		j, err := m.checkAndSetActiveJob("", nil, 0, nil, nil)
+		c.Assert(err, IsNil)
+		m.resetActiveJob(j)
+	}
+
+	c.Assert(len(m.getJobHistory()), Equals, maxJobHistory)
+	c.Assert(len(store), Equals, maxJobHistory)
+	_, ok := store[1]
+	c.Assert(ok, Equals, false)
+}
+
+func (s *jobHistorySuite) TestJobHistoryRetention(c *C) {
+	store := testJobStore{}
+	config := DefaultConfig()
+	config.Manager.JobHistorySize = 4
+	config.Manager.JobLogsMaxBytes = 30
+	m := &Manager{jobStore: store, config: config}
+	for i := 0; i < 6; i++ {
+		j, err := m.checkAndSetActiveJob("", nil, 0, nil, nil)
+		c.Assert(err, IsNil)
+		j.logs.WriteString(strings.Repeat("x", 10))
+		m.saveJob(j)
+		m.resetActiveJob(j)
+	}
+
+	// the logs of only the three most recent jobs fit the limit
+	jobs := m.getJobHistory()
+	c.Assert(jobs, HasLen, 3)
+	c.Assert(store, HasLen, 3)
+	for i, j := range jobs {
+		c.Assert(j.id, Equals, uint64(6-i))
+		c.Assert(j.logsLen(), Equals, int64(10))
+		_, ok := store[j.id]
+		c.Assert(ok, Equals, true)
+	}
+	c.Assert(m.getLastJob().id, Equals, uint64(6))
+
+	r := m.jobRetention()
+	c.Assert(r.Jobs, Equals, 3)
+	c.Assert(r.MaxJobs, Equals, 4)
+	c.Assert(r.LogsBytes, Equals, int64(30))
+	c.Assert(r.MaxLogsBytes, Equals, int64(30))
+	c.Assert(r.OldestJobAt, NotNil)
+	c.Assert(r.MaxAge, Equals, "")
+}
+
+func (s *jobHistorySuite) TestJobHistoryMaxAge(c *C) {
+	store := testJobStore{}
+	config := DefaultConfig()
+	config.Manager.JobHistoryMaxAge = "1h"
+	m := &Manager{jobStore: store, config: config}
+	now := time.Now()
+	for _, age := range []time.Duration{3 * time.Hour, 2 * time.Hour, time.Minute} {
+		j, err := m.checkAndSetActiveJob("", nil, 0, nil, nil)
+		c.Assert(err, IsNil)
+		j.finishedAt = now.Add(-age)
+		m.saveJob(j)
+		m.resetActiveJob(j)
+	}
+	c.Assert(m.getJobHistory(), HasLen, 1)
+	c.Assert(store, HasLen, 1)
+	c.Assert(m.jobRetention().MaxAge, Equals, "1h0m0s")
+
+	// the most recent job is kept, even once it's older than the max age
+	m.jobsMutex.Lock()
+	m.pruneJobHistory(now.Add(2 * time.Hour))
+	m.jobsMutex.Unlock()
+	jobs := m.getJobHistory()
+	c.Assert(jobs, HasLen, 1)
+	c.Assert(jobs[0].id, Equals, uint64(3))
+	c.Assert(m.getLastJob(), Equals, jobs[0])
+}
+
+func (s *jobHistorySuite) TestRecoverInterruptedAssets(c *C) {
+	ctrl := gomock.NewController(c)
+	defer ctrl.Finish()
+
+	mClient := mock.NewMockSubsysClient(ctrl)
+	inv := inventory.NewGeneralSubsys(mClient)
+	exptdStatus := map[string]inventory.AssetStatus{}
+	for name, status := range map[string][2]inventory.AssetStatus{
+		"node1": {inventory.Provisioning, inventory.Unallocated},
+		"node2": {inventory.Maintenance, inventory.Unallocated},
+		"node3": {inventory.Cancelled, inventory.Decommissioned},
+		"node4": {inventory.Allocated, inventory.Allocated},
+	} {
+		c.Assert(inv.RestoreAsset(name,
+			inventory.NewAssetWithState(mClient, name, status[0], inventory.Discovered)), IsNil)
+		exptdStatus[name] = status[1]
+		if status[0] != status[1] {
+			mClient.EXPECT().SetAssetStatus(name, status[1].String(), gomock.Any(), gomock.Any())
+		}
+	}
+
+	lastJob := NewJob("", nil, nil)
+	lastJob.interrupt()
+	m := &Manager{inventory: inv, lastJob: lastJob}
+	m.recoverInterruptedAssets()
+
+	for name, status := range exptdStatus {
+		rStatus, _ := inv.GetAsset(name).GetStatus()
+		c.Assert(rStatus, Equals, status, Commentf("node: %s", name))
+	}
+	logs := lastJob.logs.String()
+	c.Assert(strings.Contains(logs, `rolling back node "node1" from Provisioning status`), Equals, true, Commentf("logs: %s", logs))
+	c.Assert(strings.Contains(logs, `"node4"`), Equals, false, Commentf("logs: %s", logs))
+}
@@ -0,0 +1,192 @@
+package manager
+
+import (
+	"github.com/Sirupsen/logrus"
+)
+
+// jobNodesEvent is implemented by the events that trigger a job. Such an event
+// is held, instead of being processed, while it's job can't run alongside the
+// active jobs
+type jobNodesEvent interface {
+	// jobNodes returns the nodes the triggered job acts upon, and whether the
+	// job can't run alongside other jobs
+	jobNodes() (nodeNames []string, exclusive bool)
+}
+
+// inFlightJobEvent is implemented by the events that don't run their job
+// again while an identical job is active
+type inFlightJobEvent interface {
+	// jobInFlightKey returns the key that identifies the identical requests for the triggered job
+	jobInFlightKey() string
+}
+
+// eventClaim is the claim of an event on the nodes of the job it triggers
+type eventClaim struct {
+	nodes     map[string]struct{}
+	exclusive bool
+}
+
+func newEventClaim(e jobNodesEvent) *eventClaim {
+	nodeNames, exclusive := e.jobNodes()
+	c := &eventClaim{nodes: map[string]struct{}{}, exclusive: exclusive}
+	for _, name := range nodeNames {
+		c.nodes[name] = struct{}{}
+	}
+	return c
+}
+
+// conflicts returns true if either of the claims is exclusive, or they claim a common node
+func (c *eventClaim) conflicts(o *eventClaim) bool {
+	if c.exclusive || o.exclusive {
+		return true
+	}
+	for name := range o.nodes {
+		if _, ok := c.nodes[name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// conflictsWithJob returns true if the claim or the job is exclusive, or the
+// job acts upon a claimed node
+func (c *eventClaim) conflictsWithJob(j *Job) bool {
+	if c.exclusive || j.exclusive {
+		return true
+	}
+	for name := range c.nodes {
+		if j.actsUpon(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// heldEvent is an event that is held until the conflicting jobs are done
+type heldEvent struct {
+	event event
+	claim *eventClaim
+}
+
+// eventWorker processes the events, the held events that are released ahead
+// of the requests
+func (m *Manager) eventWorker() {
+	for {
+		var e event
+		select {
+		case e = <-m.releasedQ:
+		default:
+			select {
+			case e = <-m.releasedQ:
+			case e = <-m.reqQ:
+				logrus.Debugf("dequeued manager event: %s", e)
+				if !m.claimEvent(e) {
+					continue
+				}
+			}
+		}
+		err := m.processClaimedEvent(e)
+		// log and continue
+		logrus.Debugf("done handling event %s. Error(if any): %v", e, err)
+	}
+}
+
+// claimEvent claims the nodes of the job triggered by an event, if the job
+// can run alongside the active jobs and the jobs of the events being
+// processed. Else the event is held until the conflicting jobs are done, and
+// false is returned. The events that don't trigger a job are not claimed
+func (m *Manager) claimEvent(e event) bool {
+	je, ok := unwrapEvent(e).(jobNodesEvent)
+	if !ok {
+		return true
+	}
+
+	// the claim is made before taking the jobsMutex, as the nodes are looked up for some events
+	claim := newEventClaim(je)
+	m.jobsMutex.Lock()
+	defer m.jobsMutex.Unlock()
+	if ie, ok := je.(inFlightJobEvent); ok && m.inFlightJob(ie.jobInFlightKey()) != nil {
+		// the event is processed right away, as it refers to the identical job
+		// instead of running it again
+		return true
+	}
+	if m.canClaim(claim, m.heldEvents) {
+		m.eventClaims[e] = claim
+		return true
+	}
+
+	// the released events are counted as held, so there is always room for them in releasedQ
+	if len(m.heldEvents)+len(m.releasedQ) >= cap(m.releasedQ) {
+		err := errServiceUnavailable(errReqQueueFull(cap(m.reqQ)), reqQueueRetryAfter)
+		logrus.Errorf("event %s aborted. Error: %v", e, err)
+		if we, ok := e.(wrapperEvent); ok {
+			we.abort(err)
+		}
+		return false
+	}
+	logrus.Infof("holding event %s until the conflicting jobs are done", e)
+	m.heldEvents = append(m.heldEvents, &heldEvent{event: e, claim: claim})
+	return false
+}
+
+// canClaim returns true if the claim doesn't conflict with the active jobs,
+// the claims of the events being processed and the earlier held events, and
+// there is room for one more job. The caller shall hold the jobsMutex
+func (m *Manager) canClaim(claim *eventClaim, earlier []*heldEvent) bool {
+	if len(m.activeJobs)+len(m.eventClaims) >= m.jobWorkers() {
+		return false
+	}
+	for _, aj := range m.activeJobs {
+		if claim.conflictsWithJob(aj) {
+			return false
+		}
+	}
+	for _, c := range m.eventClaims {
+		if claim.conflicts(c) {
+			return false
+		}
+	}
+	for _, he := range earlier {
+		if claim.conflicts(he.claim) {
+			return false
+		}
+	}
+	return true
+}
+
+// releaseHeldEvents claims the held events that can be processed now, in the
+// order they were held, and queues them to the workers. The caller shall hold
+// the jobsMutex
+func (m *Manager) releaseHeldEvents() {
+	held := m.heldEvents
+	m.heldEvents = nil
+	for _, he := range held {
+		if !m.canClaim(he.claim, m.heldEvents) {
+			m.heldEvents = append(m.heldEvents, he)
+			continue
+		}
+		logrus.Infof("releasing held event %s", he.event)
+		m.eventClaims[he.event] = he.claim
+		m.releasedQ <- he.event
+	}
+}
+
+// processClaimedEvent processes an event, that was claimed if it triggers a
+// job, and releases it's claim once done. The events that trigger a job are
+// processed alongside each other, while the other events are processed alone
+func (m *Manager) processClaimedEvent(e event) error {
+	if _, ok := unwrapEvent(e).(jobNodesEvent); ok {
+		m.eventsMutex.RLock()
+		defer m.eventsMutex.RUnlock()
+	} else {
+		m.eventsMutex.Lock()
+		defer m.eventsMutex.Unlock()
+	}
+	err := m.processEvent(e)
+
+	m.jobsMutex.Lock()
+	delete(m.eventClaims, e)
+	m.releaseHeldEvents()
+	m.jobsMutex.Unlock()
+	return err
+}
@@ -0,0 +1,250 @@
+// +build unittest
+
+package manager
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/contiv/cluster/management/src/configuration"
+	"github.com/contiv/cluster/management/src/inventory"
+	"github.com/contiv/cluster/management/src/monitor"
+	"golang.org/x/net/context"
+	. "gopkg.in/check.v1"
+)
+
+type jobWorkersSuite struct {
+}
+
+var _ = Suite(&jobWorkersSuite{})
+
+// gatedConfigSubsys reports the playbooks it is asked to run, and runs the ones
+// that have a gate until the gate is closed. The cleanup and the configuration
+// are reported as 'cleanup' and 'configure' playbooks
+type gatedConfigSubsys struct {
+	configuration.Subsys
+	started chan string
+	gates   map[string]chan struct{}
+}
+
+func (f *gatedConfigSubsys) RunPlaybook(nodes configuration.SubsysHosts, playbook,
+	extraVars string) (io.Reader, context.CancelFunc, chan error) {
+	f.started <- playbook
+	errCh := make(chan error, 1)
+	go func() {
+		if gate, ok := f.gates[playbook]; ok {
+			<-gate
+		}
+		errCh <- nil
+	}()
+	return nil, func() {}, errCh
+}
+
+func (f *gatedConfigSubsys) Configure(nodes configuration.SubsysHosts,
+	extraVars string) (io.Reader, context.CancelFunc, chan error) {
+	return f.RunPlaybook(nodes, "configure", extraVars)
+}
+
+func (f *gatedConfigSubsys) Cleanup(nodes configuration.SubsysHosts,
+	extraVars string) (io.Reader, context.CancelFunc, chan error) {
+	return f.RunPlaybook(nodes, "cleanup", extraVars)
+}
+
+// waitPlaybook waits for the next playbook to be run and returns it
+func (f *gatedConfigSubsys) waitPlaybook(c *C) string {
+	select {
+	case playbook := <-f.started:
+		return playbook
+	case <-time.After(5 * time.Second):
+		c.Fatalf("no playbook was run")
+	}
+	return ""
+}
+
+// fakeStatusInventory records the status the assets are set to, irrespective
+// of the status they are in
+type fakeStatusInventory struct {
+	inventory.Subsys
+	sync.Mutex
+	statuses []string
+}
+
+func (f *fakeStatusInventory) record(name, status string) error {
+	f.Lock()
+	defer f.Unlock()
+	f.statuses = append(f.statuses, fmt.Sprintf("%s:%s", name, status))
+	return nil
+}
+
+func (f *fakeStatusInventory) SetAssetProvisioning(name string) error {
+	return f.record(name, inventory.Provisioning.String())
+}
+
+func (f *fakeStatusInventory) SetAssetCommissioned(name string) error {
+	return f.record(name, inventory.Allocated.String())
+}
+
+func (f *fakeStatusInventory) SetAssetInMaintenance(name string) error {
+	return f.record(name, inventory.Maintenance.String())
+}
+
+func (f *fakeStatusInventory) SetAssetUnallocated(name string) error {
+	return f.record(name, inventory.Unallocated.String())
+}
+
+// newJobWorkersTestManager returns a manager with the discovered nodes, that
+// processes the events with the specified number of job workers
+func newJobWorkersTestManager(cfg configuration.Subsys, inv inventory.Subsys, workers int,
+	nodeNames ...string) *Manager {
+	config := DefaultConfig()
+	config.Manager.JobWorkers = workers
+	m := &Manager{
+		configuration: cfg,
+		inventory:     inv,
+		config:        config,
+		reqQ:          make(chan event, 10),
+		nodes:         map[string]*node{},
+		activeJobs:    map[uint64]*Job{},
+		probeNode:     func(addr string, timeout time.Duration) error { return nil },
+	}
+	for i, name := range nodeNames {
+		m.nodes[name] = &node{
+			Mon: monitor.NewNode(name, name, fmt.Sprintf("1.1.1.%d", i+1)),
+			Cfg: configuration.NewAnsibleHost(name, "", ansibleMasterGroupName, map[string]string{}),
+			Inv: inventory.NewAssetWithState(nil, name, inventory.Unallocated, inventory.Discovered),
+		}
+	}
+	go m.eventLoop()
+	return m
+}
+
+// waitJobDone waits for the job to be done and returns it's status
+func waitJobDone(c *C, j *Job) JobStatus {
+	for i := 0; i < 500; i++ {
+		if status, _ := j.Status(); status == Complete || status == Errored {
+			return status
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.Fatalf("job %s is not done", j)
+	return Errored
+}
+
+func (s *jobWorkersSuite) TestOverlappingCommissionsSerialized(c *C) {
+	cfg := &gatedConfigSubsys{
+		started: make(chan string, 10),
+		gates:   map[string]chan struct{}{"first.yml": make(chan struct{})},
+	}
+	inv := &fakeStatusInventory{}
+	m := newJobWorkersTestManager(cfg, inv, 2, "node1", "node2", "node3")
+
+	first := newCommissionEvent(m, []string{"node1", "node2"}, "", ansibleMasterGroupName, "first.yml", 0)
+	second := newCommissionEvent(m, []string{"node2", "node3"}, "", ansibleMasterGroupName, "second.yml", 0)
+	we1, we2 := newWaitableEvent(first), newWaitableEvent(second)
+	c.Assert(m.enqueue(we1), IsNil)
+	c.Assert(we1.waitForCompletion(), IsNil)
+	c.Assert(cfg.waitPlaybook(c), Equals, "first.yml")
+	c.Assert(m.enqueue(we2), IsNil)
+
+	// the second commission is held, instead of failing, while the first one runs
+	select {
+	case err := <-we2.statusCh:
+		c.Fatalf("the overlapping commission was processed. Error: %v", err)
+	case playbook := <-cfg.started:
+		c.Fatalf("the overlapping commission ran %s", playbook)
+	case <-time.After(100 * time.Millisecond):
+	}
+	m.jobsMutex.Lock()
+	c.Assert(m.heldEvents, HasLen, 1)
+	m.jobsMutex.Unlock()
+
+	// the second commission runs once the first one is done
+	close(cfg.gates["first.yml"])
+	c.Assert(we2.waitForCompletion(), IsNil)
+	c.Assert(cfg.waitPlaybook(c), Equals, "second.yml")
+	c.Assert(waitJobDone(c, first.triggeredJob()), Equals, Complete)
+	c.Assert(waitJobDone(c, second.triggeredJob()), Equals, Complete)
+	c.Assert(second.triggeredJob().id > first.triggeredJob().id, Equals, true)
+
+	// the shared node is commissioned by one job after the other
+	inv.Lock()
+	defer inv.Unlock()
+	node2 := []string{}
+	for _, status := range inv.statuses {
+		if strings.HasPrefix(status, "node2:") {
+			node2 = append(node2, status)
+		}
+	}
+	c.Assert(node2, DeepEquals, []string{"node2:Provisioning", "node2:Allocated",
+		"node2:Provisioning", "node2:Allocated"})
+}
+
+func (s *jobWorkersSuite) TestDiscoverNotBlockedByUpdate(c *C) {
+	cfg := &gatedConfigSubsys{
+		started: make(chan string, 10),
+		gates:   map[string]chan struct{}{"update.yml": make(chan struct{})},
+	}
+	m := newJobWorkersTestManager(cfg, &fakeStatusInventory{}, 2, "node1")
+
+	update := newUpdateEvent(m, []string{"node1"}, "", "", "update.yml", 0)
+	we := newWaitableEvent(update)
+	c.Assert(m.enqueue(we), IsNil)
+	c.Assert(we.waitForCompletion(), IsNil)
+	c.Assert(cfg.waitPlaybook(c), Equals, "cleanup")
+	c.Assert(cfg.waitPlaybook(c), Equals, "update.yml")
+
+	// the discover runs to completion while the update is still running
+	discover := newDiscoverEvent(m, []string{"1.1.1.9"}, "", 0)
+	we = newWaitableEvent(discover)
+	c.Assert(m.enqueue(we), IsNil)
+	c.Assert(we.waitForCompletion(), IsNil)
+	c.Assert(cfg.waitPlaybook(c), Equals, "configure")
+	c.Assert(waitJobDone(c, discover.triggeredJob()), Equals, Complete)
+	status, _ := update.triggeredJob().Status()
+	c.Assert(status, Equals, Running)
+
+	close(cfg.gates["update.yml"])
+	c.Assert(waitJobDone(c, update.triggeredJob()), Equals, Complete)
+}
+
+func (s *jobWorkersSuite) TestRediscoverHeldBehindUpdate(c *C) {
+	cfg := &gatedConfigSubsys{
+		started: make(chan string, 10),
+		gates:   map[string]chan struct{}{"update.yml": make(chan struct{})},
+	}
+	m := newJobWorkersTestManager(cfg, &fakeStatusInventory{}, 2, "node1")
+
+	update := newUpdateEvent(m, []string{"node1"}, "", "", "update.yml", 0)
+	we := newWaitableEvent(update)
+	c.Assert(m.enqueue(we), IsNil)
+	c.Assert(we.waitForCompletion(), IsNil)
+	c.Assert(cfg.waitPlaybook(c), Equals, "cleanup")
+	c.Assert(cfg.waitPlaybook(c), Equals, "update.yml")
+
+	// the discover of node1's address is held while the update runs on node1
+	discover := newDiscoverEvent(m, []string{"1.1.1.1"}, "", 0)
+	nodeNames, exclusive := discover.jobNodes()
+	c.Assert(nodeNames, DeepEquals, []string{"node1"})
+	c.Assert(exclusive, Equals, false)
+	we = newWaitableEvent(discover)
+	c.Assert(m.enqueue(we), IsNil)
+	select {
+	case err := <-we.statusCh:
+		c.Fatalf("the re-discover was processed while the update runs. Error: %v", err)
+	case playbook := <-cfg.started:
+		c.Fatalf("the re-discover ran %s while the update runs", playbook)
+	case <-time.After(100 * time.Millisecond):
+	}
+	m.jobsMutex.Lock()
+	c.Assert(m.heldEvents, HasLen, 1)
+	m.jobsMutex.Unlock()
+
+	close(cfg.gates["update.yml"])
+	c.Assert(we.waitForCompletion(), IsNil)
+	c.Assert(cfg.waitPlaybook(c), Equals, "configure")
+	c.Assert(waitJobDone(c, update.triggeredJob()), Equals, Complete)
+	c.Assert(waitJobDone(c, discover.triggeredJob()), Equals, Complete)
+}
@@ -5,16 +5,41 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"reflect"
 	"runtime"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/Sirupsen/logrus"
+	"github.com/contiv/cluster/management/src/ansible"
 	"github.com/contiv/errored"
 )
 
 var notRunningErr = errored.Errorf("job is not Running")
 
+// TimeoutError is the error returned when a job or a wait on it times out. It
+// allows distinguishing a timeout from other failures
+type TimeoutError struct {
+	desc string
+}
+
+// Error returns the description of the timeout
+func (e *TimeoutError) Error() string {
+	return e.desc
+}
+
+// IsTimeoutError checks if the error is a TimeoutError
+func IsTimeoutError(err error) bool {
+	_, ok := err.(*TimeoutError)
+	return ok
+}
+
+func errJobTimedOut(timeout time.Duration) error {
+	return &TimeoutError{desc: fmt.Sprintf("job timed out after %s", timeout)}
+}
+
 // CancelChannel is type of the channle used to signal cancellation of job
 type CancelChannel chan struct{}
 
@@ -25,17 +50,144 @@ type JobRunner func(cancelCh CancelChannel, logs io.Writer) error
 // DoneCallback is called when job completes, errors or is cancelled
 type DoneCallback func(status JobStatus, errVal error)
 
+// NodeStatus denotes the status of a node in a job
+type NodeStatus string
+
+const (
+	// NodePending is the status of a node on which the job hasn't started yet
+	NodePending NodeStatus = "pending"
+	// NodeRunning is the status of a node on which the job is in progress
+	NodeRunning NodeStatus = "running"
+	// NodeOk is the status of a node on which the job succeeded
+	NodeOk NodeStatus = "ok"
+	// NodeFailed is the status of a node on which the job failed
+	NodeFailed NodeStatus = "failed"
+	// NodeFailedVerification is the status of a node that was configured by a
+	// commission job but failed the verification that followed
+	NodeFailedVerification NodeStatus = "commission-failed-verification"
+)
+
+// isFailed returns true if the job failed on the node
+func (s NodeStatus) isFailed() bool {
+	return s == NodeFailed || s == NodeFailedVerification
+}
+
+// LogStream identifies the output stream of a job's logs
+type LogStream string
+
+const (
+	// LogStreamAll denotes the stdout and stderr streams interleaved
+	LogStreamAll LogStream = ""
+	// LogStreamStdout denotes the stdout stream
+	LogStreamStdout LogStream = "stdout"
+	// LogStreamStderr denotes the stderr stream
+	LogStreamStderr LogStream = "stderr"
+)
+
+// IsValid checks if the log stream is one of the known streams
+func (s LogStream) IsValid() bool {
+	return s == LogStreamAll || s == LogStreamStdout || s == LogStreamStderr
+}
+
+// JobSummary contains the structured summary of the ansible run(s) of a job
+type JobSummary struct {
+	// Hosts contains the per host task counts as reported in the play recap
+	Hosts ansible.Recap `json:"hosts"`
+	// Passed is true when the job completed without errors on all hosts
+	Passed bool `json:"passed"`
+	// Versions are the versions of the nodes before and after an upgrade job
+	Versions map[string]NodeVersions `json:"versions,omitempty"`
+	// NodeErrors are the reasons the job skipped some of it's nodes, keyed by node name
+	NodeErrors map[string]string `json:"node_errors,omitempty"`
+	// Forks is the number of nodes that the job configured in parallel
+	Forks int `json:"forks,omitempty"`
+	// HostGroups are the host-groups that the job configured the nodes in, if any
+	HostGroups []string `json:"host_groups,omitempty"`
+	// Verification contains the per host task counts of the verification
+	// playbook, for a commission job that verified the nodes. The counts of
+	// the main run are in Hosts
+	Verification ansible.Recap `json:"verification,omitempty"`
+	// Preflight is the result of the preflight check of a commission job's
+	// nodes, keyed by node name. It is "reachable" for the reachable nodes
+	// and the reason the node is unreachable for the rest, that were skipped
+	Preflight map[string]string `json:"preflight,omitempty"`
+	// Discover is the outcome of a discover job for each of it's addresses
+	Discover *DiscoverResult `json:"discover,omitempty"`
+}
+
+// NodeVersions are the versions of a node before and after it's upgrade. The
+// version is empty if it's not known
+type NodeVersions struct {
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
 // Job corresponds to a long running task, triggered by an event
 type Job struct {
 	sync.Mutex
+	id        uint64
 	runner    JobRunner
+	task      string // name of the task, for jobs restored from history that have no runner
 	done      DoneCallback
 	cancelCh  CancelChannel
 	status    JobStatus
 	errVal    error
 	logs      bytes.Buffer
 	logWriter *MultiWriter
-	desc      string
+	// streamWriters pipe the stdout and stderr logs separately
+	streamWriters map[LogStream]*MultiWriter
+	// runnerDoneCh is closed when the job's runner returns
+	runnerDoneCh chan struct{}
+	// logsMutex serializes the writes to the logs from the job's streams
+	logsMutex sync.Mutex
+	// logsDone is set once the job is done and it's log writers are closed.
+	// It is guarded by logsMutex
+	logsDone bool
+	desc     string
+	summary  *JobSummary
+	nodes    map[string]NodeStatus
+	progress int
+	// tasks is the number of tasks that the job's playbook runs began so far.
+	// expectedTasks is the number of tasks the job is expected to run in all,
+	// like the last completed run of the same playbook did, zero if not known
+	tasks         int
+	expectedTasks int
+	// nodeTasks is the number of tasks each node is done with, i.e. the last
+	// task that it reported a result for
+	nodeTasks map[string]int
+	exclusive bool // an exclusive job can't run alongside other jobs
+	forks     int  // the number of nodes the job configures in parallel, if known
+	check     bool // a check job reports the changes it would make, as it's plan
+	plan      ansible.Plan
+	timeout   time.Duration // the job is cancelled if it runs longer than this, if non-zero
+	timedOut  bool
+	// hostGroups are the host-groups the job configures the nodes in, if any
+	hostGroups []string
+	// preflight is the result of the preflight check of the job's nodes, if any
+	preflight map[string]string
+	// discover is the outcome of a discover job for each of it's addresses
+	discover *DiscoverResult
+	// verifyLogsAt is the offset in the logs at which the verification of the
+	// nodes began. It is zero if the nodes are not verified
+	verifyLogsAt int64
+	// retryEvent, when set, returns an event that re-runs the job on the specified subset of nodes,
+	// cancelling it after the specified timeout
+	retryEvent func(nodeNames []string, timeout time.Duration) jobEvent
+	// inFlightKey, when set, identifies the identical requests for the job
+	inFlightKey string
+	// idempotencyKey, when set, identifies the retries of the request that triggered the job
+	idempotencyKey string
+	createdAt      time.Time
+	// runAt is the time at which a scheduled job is due to run
+	runAt time.Time
+	// queuedAt is the time the event that triggered the job was queued, if known
+	queuedAt   time.Time
+	startedAt  time.Time
+	finishedAt time.Time
+	// playbook and playbookVersion are the path and the version of the main
+	// playbook that the job runs, if known
+	playbook        string
+	playbookVersion string
 }
 
 // NewJob initializes and returns an instance of a job described by the runner and done callback
@@ -48,12 +200,186 @@ func NewJob(desc string, jr JobRunner, done DoneCallback) *Job {
 		status:    Queued,
 		errVal:    nil,
 		logWriter: &MultiWriter{},
+		streamWriters: map[LogStream]*MultiWriter{
+			LogStreamStdout: {},
+			LogStreamStderr: {},
+		},
+		runnerDoneCh: make(chan struct{}),
+		nodes:        make(map[string]NodeStatus),
+		nodeTasks:    make(map[string]int),
+		createdAt:    time.Now(),
 	}
 	j.logWriter.Add(&j.logs)
+	// the stdout is parsed on it's own, so that the stderr doesn't split it's lines
+	j.streamWriters[LogStreamStdout].Add(&nodeStatusWriter{j: j})
 	return j
 }
 
+// setNodes sets the nodes that the job runs on. All nodes begin in pending status
+func (j *Job) setNodes(names []string) {
+	j.Lock()
+	defer j.Unlock()
+	for _, name := range names {
+		j.nodes[name] = NodePending
+	}
+}
+
+// actsUpon returns true if the job runs on the node
+func (j *Job) actsUpon(name string) bool {
+	j.Lock()
+	defer j.Unlock()
+	_, ok := j.nodes[name]
+	return ok
+}
+
+// failNode sets the status of a node as failed, like for a node that the job skips
+func (j *Job) failNode(name string) {
+	j.Lock()
+	defer j.Unlock()
+	if status, ok := j.nodes[name]; ok && !status.isFailed() {
+		j.nodes[name] = NodeFailed
+	}
+}
+
+// updateNodeStatus updates the status of a node based on a task result reported
+// for it. A failed node stays failed for rest of the job.
+func (j *Job) updateNodeStatus(name string, result ansible.TaskResult) {
+	j.Lock()
+	defer j.Unlock()
+	status, ok := j.nodes[name]
+	if !ok || status.isFailed() {
+		return
+	}
+	j.nodeTasks[name] = j.tasks
+	if result.IsFailure() {
+		j.nodes[name] = NodeFailed
+		if j.verifyLogsAt > 0 {
+			j.nodes[name] = NodeFailedVerification
+		}
+		j.updateProgress()
+		return
+	}
+	j.nodes[name] = NodeRunning
+	j.updateProgress()
+}
+
+// beginTask records the beginning of a task in the job's playbook runs
+func (j *Job) beginTask() {
+	j.Lock()
+	defer j.Unlock()
+	j.tasks++
+}
+
+// updateProgress estimates the job's completion percentage from the number of
+// tasks it's nodes are done with, out of the tasks the job is expected to run.
+// A failed node counts as done. When the expected tasks are not known, or the
+// job runs more, it's estimated that atleast one more task is to be run. The
+// progress never goes backwards and stays below 100 until the job is done. It
+// is expected to be called with job's lock held.
+func (j *Job) updateProgress() {
+	if len(j.nodes) == 0 {
+		return
+	}
+	expected := j.expectedTasks
+	if expected == 0 {
+		expected = defaultExpectedTasks
+	}
+	if expected < j.tasks {
+		expected = j.tasks + 1
+	}
+	done := 0
+	for name, status := range j.nodes {
+		if status.isFailed() || status == NodeOk {
+			done += 100
+			continue
+		}
+		done += 100 * j.nodeTasks[name] / expected
+	}
+	progress := done / len(j.nodes)
+	if progress > 99 {
+		progress = 99
+	}
+	if progress > j.progress {
+		j.progress = progress
+	}
+}
+
+// Progress returns an estimate of the job's completion percentage (0-100) at
+// the time of call. It reads 100 only once the job is done
+func (j *Job) Progress() int {
+	j.Lock()
+	defer j.Unlock()
+	return j.progress
+}
+
+// taskCount returns the number of tasks that the job's playbook runs began so far
+func (j *Job) taskCount() int {
+	j.Lock()
+	defer j.Unlock()
+	return j.tasks
+}
+
+// NodeStatus returns the status of the nodes in the job at the time of call
+func (j *Job) NodeStatus() map[string]NodeStatus {
+	j.Lock()
+	defer j.Unlock()
+	nodes := make(map[string]NodeStatus, len(j.nodes))
+	for name, status := range j.nodes {
+		nodes[name] = status
+	}
+	return nodes
+}
+
+// nodeStatusWriter parses the job's stdout as it is written and updates the
+// status of job's nodes
+type nodeStatusWriter struct {
+	j       *Job
+	partial []byte
+}
+
+// jobLogWriter is the writer that a job's runner logs to. Writes to it are
+// logged as stdout, while writes to the writer returned by Stderr() are
+// logged as stderr.
+type jobLogWriter struct {
+	j      *Job
+	stream LogStream
+}
+
+func (w *jobLogWriter) Write(p []byte) (int, error) {
+	w.j.logsMutex.Lock()
+	defer w.j.logsMutex.Unlock()
+	w.j.logWriter.Write(p)
+	w.j.streamWriters[w.stream].Write(p)
+	return len(p), nil
+}
+
+// Stderr returns the writer for logging stderr output of the job
+func (w *jobLogWriter) Stderr() io.Writer {
+	return &jobLogWriter{j: w.j, stream: LogStreamStderr}
+}
+
+func (w *nodeStatusWriter) Write(p []byte) (int, error) {
+	w.partial = append(w.partial, p...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			break
+		}
+		line := string(w.partial[:i])
+		if _, ok := ansible.ParseTaskHeader(line); ok {
+			w.j.beginTask()
+		} else if host, result, ok := ansible.ParseTaskResult(line); ok {
+			w.j.updateNodeStatus(host, result)
+		}
+		w.partial = w.partial[i+1:]
+	}
+	return len(p), nil
+}
+
 func (j *Job) runnerName() string {
+	if j.runner == nil {
+		return j.task
+	}
 	return runtime.FuncForPC(reflect.ValueOf(j.runner).Pointer()).Name()
 }
 
@@ -71,43 +397,208 @@ func (j *Job) setStatus(status JobStatus, err error) {
 
 // Run begins the job and wait for completion. This function blocks
 func (j *Job) Run() {
+	j.Lock()
+	j.startedAt = time.Now()
+	j.Unlock()
 	j.setStatus(Running, nil)
 	defer func() {
+		j.Lock()
+		j.finishedAt = time.Now()
+		j.Unlock()
+		j.summarize()
 		j.done(j.status, j.errVal)
+		// the writers are closed under the lock, so that a writer added as
+		// the job finishes is either closed here or by addLogWriter
+		j.logsMutex.Lock()
+		j.logsDone = true
 		j.logWriter.Close()
+		for _, w := range j.streamWriters {
+			w.Close()
+		}
+		j.logsMutex.Unlock()
 	}()
 
-	if err := j.runner(j.cancelCh, j.logWriter); err != nil {
+	if j.timeout > 0 {
+		go j.cancelOnTimeout(j.runnerDoneCh)
+	}
+	err := j.runner(j.cancelCh, &jobLogWriter{j: j, stream: LogStreamStdout})
+	close(j.runnerDoneCh)
+	if err != nil {
+		if j.isTimedOut() {
+			err = errJobTimedOut(j.timeout)
+		}
 		j.setStatus(Errored, err)
 		return
 	}
 	j.setStatus(Complete, nil)
 }
 
-//Cancel signals canceling a running job
+// cancelOnTimeout cancels the job if the runner doesn't finish within the job's timeout
+func (j *Job) cancelOnTimeout(runnerDoneCh chan struct{}) {
+	select {
+	case <-time.After(j.timeout):
+	case <-runnerDoneCh:
+		return
+	}
+
+	logrus.Errorf("job %s timed out after %s, cancelling it", j, j.timeout)
+	j.Lock()
+	j.timedOut = true
+	j.Unlock()
+	select {
+	case j.cancelCh <- struct{}{}:
+	case <-runnerDoneCh:
+	}
+}
+
+func (j *Job) isTimedOut() bool {
+	j.Lock()
+	defer j.Unlock()
+	return j.timedOut
+}
+
+// beginVerification marks the start of the verification of the job's nodes.
+// The play recap of the logs that follow is summarized separately, as the
+// verification recap, and the nodes that fail are marked as failed verification
+func (j *Job) beginVerification() {
+	offset := j.logsLen()
+	j.Lock()
+	defer j.Unlock()
+	j.verifyLogsAt = offset
+}
+
+// summarize parses the play recap from the job logs and records the job's summary
+func (j *Job) summarize() {
+	j.Lock()
+	verifyLogsAt := j.verifyLogsAt
+	j.Unlock()
+	recap, verification := j.parseRecaps(verifyLogsAt)
+	j.Lock()
+	j.summary = &JobSummary{
+		Hosts: recap,
+		Passed: j.status == Complete && len(recap.FailedHosts()) == 0 &&
+			len(verification.FailedHosts()) == 0 && preflightPassed(j.preflight),
+		Forks:        j.forks,
+		HostGroups:   j.hostGroups,
+		Verification: verification,
+		Preflight:    j.preflight,
+		Discover:     j.discover,
+	}
+	// settle the final status of the nodes
+	for name, status := range j.nodes {
+		if !status.isFailed() {
+			j.nodes[name] = j.settledNodeStatus(name, recap, verification, verifyLogsAt > 0)
+		}
+	}
+	j.progress = 100
+	j.Unlock()
+
+	if !j.check {
+		return
+	}
+	plan, err := ansible.ParsePlan(j.Logs())
+	if err != nil {
+		logrus.Errorf("failed to parse the plan of job %s. Error: %v", j, err)
+		return
+	}
+	j.Lock()
+	j.plan = plan
+	j.Unlock()
+}
+
+// parseRecaps parses the play recap from the job logs, and the verification
+// recap from the logs at the offset that the verification begins at, if any
+func (j *Job) parseRecaps(verifyLogsAt int64) (ansible.Recap, ansible.Recap) {
+	logs, verifyLogs := j.logs.Bytes(), []byte{}
+	if verifyLogsAt > 0 && verifyLogsAt <= int64(len(logs)) {
+		logs, verifyLogs = logs[:verifyLogsAt], logs[verifyLogsAt:]
+	}
+	recap, err := ansible.ParseRecap(bytes.NewReader(logs))
+	if err != nil {
+		logrus.Errorf("failed to parse the play recap of job %s. Error: %v", j, err)
+		recap = ansible.Recap{}
+	}
+	var verification ansible.Recap
+	if verifyLogsAt > 0 {
+		if verification, err = ansible.ParseRecap(bytes.NewReader(verifyLogs)); err != nil {
+			logrus.Errorf("failed to parse the verification recap of job %s. Error: %v", j, err)
+			verification = ansible.Recap{}
+		}
+	}
+	return recap, verification
+}
+
+// settledNodeStatus returns the final status of a node that hasn't failed
+// already. On error, nodes that didn't make it to the recap are considered
+// failed as well. Once the nodes are verified, the nodes that didn't pass the
+// verification failed it. It shall be called with the job's lock held
+func (j *Job) settledNodeStatus(name string, recap, verification ansible.Recap, verifying bool) NodeStatus {
+	h, ok := recap[name]
+	v, verified := verification[name]
+	switch {
+	case ok && h.IsFailed():
+		return NodeFailed
+	case verifying && verified && v.IsFailed():
+		return NodeFailedVerification
+	case verifying && !verified && j.status != Complete:
+		return NodeFailedVerification
+	case ok || j.status == Complete:
+		return NodeOk
+	default:
+		return NodeFailed
+	}
+}
+
+// Cancel signals canceling a running job
 func (j *Job) Cancel() error {
 	// if job is running then run it's cancel function
 	// the job status shall be updated as part of runner
 	j.Lock()
-	defer j.Unlock()
-	if j.status == Running {
-		j.cancelCh <- struct{}{}
-		return nil
+	running := j.status == Running
+	j.Unlock()
+	if !running {
+		return notRunningErr
 	}
-	return notRunningErr
+	// the lock is not held while signaling the runner, as the runner takes
+	// it to update the node status on each write to the logs
+	select {
+	case j.cancelCh <- struct{}{}:
+	case <-j.runnerDoneCh:
+	}
+	return nil
 }
 
 // Status returns the status of a job at the time of call
 func (j *Job) Status() (JobStatus, error) {
+	j.Lock()
+	defer j.Unlock()
 	return j.status, j.errVal
 }
 
+// discoverResult returns the outcome of a discover job for each of it's
+// addresses. It is nil for the other jobs and until a discover job is triggered
+func (j *Job) discoverResult() *DiscoverResult {
+	j.Lock()
+	defer j.Unlock()
+	return j.discover
+}
+
+// Summary returns the summary of the job. It is nil until the job is done
+func (j *Job) Summary() *JobSummary {
+	j.Lock()
+	defer j.Unlock()
+	return j.summary
+}
+
 // Logs returns the current logs associated with the job.
 func (j *Job) Logs() io.Reader {
 	// instead of returning the buffer itself we instead need to return
 	// a reader created over current contents of the buffer without changing
 	// it's read offset. This will allow accessing logs over and over again.
-	return bytes.NewReader(j.logs.Bytes())
+	// The contents are copied as the logs of a running job keep growing.
+	j.logsMutex.Lock()
+	defer j.logsMutex.Unlock()
+	return bytes.NewReader(append([]byte{}, j.logs.Bytes()...))
 }
 
 // PipeLogs pipes the job logs to the specified writer (in addition to underlying log buffer).
@@ -116,27 +607,254 @@ func (j *Job) PipeLogs(w io.Writer) error {
 	if s, _ := j.Status(); s != Running {
 		return notRunningErr
 	}
-	j.logWriter.Add(w)
+	j.logsMutex.Lock()
+	defer j.logsMutex.Unlock()
+	j.addLogWriter(j.logWriter, w)
+	return nil
+}
+
+// addLogWriter adds the writer to the specified log writer of the job. If the
+// job is already done, the writer is closed right away instead, as it would
+// never be closed otherwise. It shall be called with logsMutex held
+func (j *Job) addLogWriter(mw *MultiWriter, w io.Writer) {
+	if !j.logsDone {
+		mw.Add(w)
+		return
+	}
+	if wc, ok := w.(io.WriteCloser); ok {
+		wc.Close()
+	}
+}
+
+// PipeStreamLogs pipes the job logs of the specified stream to the specified writer.
+// This is useful to stream just the stdout or stderr of an ongoing job.
+func (j *Job) PipeStreamLogs(stream LogStream, w io.Writer) error {
+	if stream == LogStreamAll {
+		return j.PipeLogs(w)
+	}
+	if !stream.IsValid() {
+		return errored.Errorf("invalid log stream %q", stream)
+	}
+	if s, _ := j.Status(); s != Running {
+		return notRunningErr
+	}
+	j.logsMutex.Lock()
+	defer j.logsMutex.Unlock()
+	j.addLogWriter(j.streamWriters[stream], w)
 	return nil
 }
 
+// offsetWriter discards the specified number of bytes written to it, before it
+// writes to the underlying writer
+type offsetWriter struct {
+	io.WriteCloser
+	skip int64
+}
+
+func (w *offsetWriter) Write(p []byte) (int, error) {
+	if w.skip >= int64(len(p)) {
+		w.skip -= int64(len(p))
+		return len(p), nil
+	}
+	n, err := w.WriteCloser.Write(p[w.skip:])
+	n += int(w.skip)
+	w.skip = 0
+	return n, err
+}
+
+// logsFromReader is the reader of the job logs from an offset. Closing it
+// closes the pipe of the logs as they are written, if any
+type logsFromReader struct {
+	io.Reader
+	pr *io.PipeReader
+}
+
+func (r *logsFromReader) Close() error {
+	if r.pr == nil {
+		return nil
+	}
+	return r.pr.Close()
+}
+
+// LogsFrom returns the job logs starting at the specified byte offset. The logs
+// written so far are returned first and, if the job is running, are followed
+// by the logs as they are written until the job is done. The logs are skipped
+// until the offset is reached, if it's beyond the logs written so far. It is
+// caller's responsibility to Close the returned reader.
+func (j *Job) LogsFrom(offset int64) io.ReadCloser {
+	j.logsMutex.Lock()
+	defer j.logsMutex.Unlock()
+	// the logs are copied under the lock, so that none are missed or repeated
+	// between the logs written so far and the ones that follow
+	logs := append([]byte{}, j.logs.Bytes()...)
+	skip := offset - int64(len(logs))
+	if skip < 0 {
+		logs, skip = logs[offset:], 0
+	} else {
+		logs = nil
+	}
+	if s, _ := j.Status(); s != Running {
+		return &logsFromReader{Reader: bytes.NewReader(logs)}
+	}
+	r, w := io.Pipe()
+	j.addLogWriter(j.logWriter, &offsetWriter{WriteCloser: w, skip: skip})
+	return &logsFromReader{Reader: io.MultiReader(bytes.NewReader(logs), r), pr: r}
+}
+
+// JobInfo is the JSON representation of a job's info. It includes the summary
+// of the job and the status of the nodes in it, once the job is done
+type JobInfo struct {
+	ID      uint64      `json:"id"`
+	Desc    string      `json:"desc"`
+	Task    string      `json:"task"`
+	Status  string      `json:"status"`
+	ErrVal  string      `json:"error"`
+	Summary *JobSummary `json:"summary,omitempty"`
+	// Plan is the changes that a job run in check mode would make on each
+	// node. It is empty for the other jobs
+	Plan       ansible.Plan          `json:"plan,omitempty"`
+	NodeStatus map[string]NodeStatus `json:"node_status,omitempty"`
+	Progress   int                   `json:"progress"`
+	// Tasks is the number of tasks that the job's playbook runs began
+	Tasks     int        `json:"tasks,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	IdemKey   string     `json:"idempotency_key,omitempty"`
+	RunAt     *time.Time `json:"run_at,omitempty"`
+	// QueuedAt is the time the request for the job was queued for processing
+	QueuedAt *time.Time `json:"queued_at"`
+	// StartedAt and FinishedAt are null until the job starts and finishes, respectively
+	StartedAt  *time.Time `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+	// Duration is the time the job ran for, or has been running for if it's
+	// not finished yet, like "1m30s"
+	Duration string   `json:"duration,omitempty"`
+	Logs     []string `json:"logs,omitempty"`
+	// Playbook is the path of the main playbook that the job runs, and
+	// PlaybookVersion is the hash of it's contents at the time the job was
+	// triggered. The version is empty if the playbook couldn't be read
+	Playbook        string `json:"playbook,omitempty"`
+	PlaybookVersion string `json:"playbook_version,omitempty"`
+}
+
+// info returns the job's info. The logs are included only if withLogs is true
+func (j *Job) info(withLogs bool) JobInfo {
+	j.Lock()
+	status, errVal, summary, plan := j.status, j.errVal, j.summary, j.plan
+	playbook, playbookVersion := j.playbook, j.playbookVersion
+	j.Unlock()
+	info := JobInfo{
+		ID:         j.id,
+		Desc:       j.desc,
+		Task:       j.runnerName(),
+		Status:     status.String(),
+		Summary:    summary,
+		Plan:       plan,
+		NodeStatus: j.NodeStatus(),
+		Progress:   j.Progress(),
+		Tasks:      j.taskCount(),
+		CreatedAt:  j.createdAt,
+		IdemKey:    j.idempotencyKey,
+	}
+	info.Playbook, info.PlaybookVersion = playbook, playbookVersion
+	if !j.runAt.IsZero() {
+		runAt := j.runAt
+		info.RunAt = &runAt
+	}
+	j.setTimingInfo(&info, time.Now())
+	if errVal != nil {
+		info.ErrVal = fmt.Sprintf("%v", errVal)
+	}
+	if withLogs {
+		logs, _ := ioutil.ReadAll(j.Logs())
+		info.Logs = strings.Split(string(logs), "\n")
+	}
+	return info
+}
+
+// setTimingInfo sets the times of the job's lifecycle in it's info. The
+// duration of a running job is computed until now.
+func (j *Job) setTimingInfo(info *JobInfo, now time.Time) {
+	j.Lock()
+	defer j.Unlock()
+	timePtr := func(t time.Time) *time.Time {
+		if t.IsZero() {
+			return nil
+		}
+		return &t
+	}
+	info.QueuedAt = timePtr(j.queuedAt)
+	info.StartedAt = timePtr(j.startedAt)
+	info.FinishedAt = timePtr(j.finishedAt)
+	end := j.finishedAt
+	if end.IsZero() && j.status == Running {
+		end = now
+	}
+	if j.startedAt.IsZero() || end.IsZero() {
+		// the job didn't run, or was interrupted by a restart
+		return
+	}
+	info.Duration = end.Sub(j.startedAt).Round(time.Millisecond).String()
+}
+
 // MarshalJSON marshals and returns the JSON for job info
 func (j *Job) MarshalJSON() ([]byte, error) {
-	toJSON := struct {
-		Desc   string   `json:"desc"`
-		Task   string   `json:"task"`
-		Status string   `json:"status"`
-		ErrVal string   `json:"error"`
-		Logs   []string `json:"logs"`
-	}{
-		Desc:   j.desc,
-		Task:   j.runnerName(),
-		Status: j.status.String(),
-		Logs:   strings.Split(j.logs.String(), "\n"),
-	}
-	if j.errVal != nil {
-		toJSON.ErrVal = fmt.Sprintf("%v", j.errVal)
-	}
-
-	return json.Marshal(toJSON)
+	return json.Marshal(j.info(true))
+}
+
+// newJobFromInfo returns a job restored from it's JSON info. The restored job
+// can't be run and serves only as a record of the job
+func newJobFromInfo(data []byte) (*Job, error) {
+	var info JobInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, err
+	}
+
+	status, ok := jobStatusFromString(info.Status)
+	if !ok {
+		return nil, errored.Errorf("unknown job status %q", info.Status)
+	}
+
+	j := NewJob(info.Desc, nil, nil)
+	j.id = info.ID
+	j.task = info.Task
+	j.status = status
+	if info.ErrVal != "" {
+		j.errVal = errored.Errorf("%s", info.ErrVal)
+	}
+	j.summary = info.Summary
+	j.plan = info.Plan
+	j.check = info.Plan != nil
+	for name, status := range info.NodeStatus {
+		j.nodes[name] = status
+	}
+	j.progress = info.Progress
+	j.tasks = info.Tasks
+	j.createdAt = info.CreatedAt
+	j.idempotencyKey = info.IdemKey
+	j.playbook = info.Playbook
+	j.playbookVersion = info.PlaybookVersion
+	if info.RunAt != nil {
+		j.runAt = *info.RunAt
+	}
+	if info.QueuedAt != nil {
+		j.queuedAt = *info.QueuedAt
+	}
+	if info.StartedAt != nil {
+		j.startedAt = *info.StartedAt
+	}
+	if info.FinishedAt != nil {
+		j.finishedAt = *info.FinishedAt
+	}
+	j.logs.WriteString(strings.Join(info.Logs, "\n"))
+	return j, nil
+}
+
+// jobStatusFromString returns the JobStatus corresponding to it's string value
+func jobStatusFromString(s string) (JobStatus, bool) {
+	for status := Queued; status <= Scheduled; status++ {
+		if status.String() == s {
+			return status, true
+		}
+	}
+	return Queued, false
 }
@@ -12,6 +12,8 @@ import (
 	"sync"
 	"time"
 
+	"github.com/contiv/cluster/management/src/ansible"
+	"github.com/contiv/cluster/management/src/configuration"
 	"github.com/contiv/errored"
 
 	. "gopkg.in/check.v1"
@@ -154,6 +156,63 @@ func (s *jobsSuite) TestJobRunCancel(c *C) {
 	checkDoneCb(c, cbCh)
 }
 
+func (s *jobsSuite) TestJobCancelWhileLogging(c *C) {
+	cbCh := make(chan struct{}, 1)
+	j := NewJob("", func(cancelCh CancelChannel, logs io.Writer) error {
+		// the runner logs a task result, that updates the node status of the
+		// job, while a cancel is pending
+		time.Sleep(200 * time.Millisecond)
+		fmt.Fprintf(logs, "ok: [node1]\n")
+		<-cancelCh
+		return errJobCancelled
+	}, expectDoneCb(c, cbCh, Errored, errJobCancelled))
+	go j.Run()
+	// give some time for job to start
+	time.Sleep(100 * time.Millisecond)
+
+	cancelled := make(chan error, 1)
+	go func() { cancelled <- j.Cancel() }()
+	select {
+	case err := <-cancelled:
+		c.Assert(err, IsNil)
+	case <-time.After(5 * time.Second):
+		c.Fatalf("timeout waiting for the job to be cancelled")
+	}
+
+	checkDoneCb(c, cbCh)
+}
+
+func (s *jobsSuite) TestJobRunTimeout(c *C) {
+	wg := &sync.WaitGroup{}
+	cbCh := make(chan struct{}, 1)
+	timeout := 100 * time.Millisecond
+	exptdErr := errJobTimedOut(timeout)
+	j := NewJob("", cancellableRunner(c, wg, 3*time.Second, errJobCancelled),
+		expectDoneCb(c, cbCh, Errored, exptdErr))
+	j.timeout = timeout
+	wg.Add(1)
+	go j.Run()
+
+	waitAndCheckJobStatus(c, wg, j, Errored, exptdErr)
+	_, err := j.Status()
+	c.Assert(IsTimeoutError(err), Equals, true)
+
+	checkDoneCb(c, cbCh)
+}
+
+func (s *jobsSuite) TestJobRunWithinTimeout(c *C) {
+	wg := &sync.WaitGroup{}
+	cbCh := make(chan struct{}, 1)
+	j := NewJob("", runner(wg, 0, nil), expectDoneCb(c, cbCh, Complete, nil))
+	j.timeout = 1 * time.Second
+	wg.Add(1)
+	go j.Run()
+
+	waitAndCheckJobStatus(c, wg, j, Complete, nil)
+
+	checkDoneCb(c, cbCh)
+}
+
 func (s *jobsSuite) TestJobLogs(c *C) {
 	wg := &sync.WaitGroup{}
 	cbCh := make(chan struct{}, 1)
@@ -237,6 +296,356 @@ func (s *jobsSuite) TestJobPipeLogs(c *C) {
 	checkDoneCb(c, cbCh)
 }
 
+func (s *jobsSuite) TestJobLogsFrom(c *C) {
+	wg := &sync.WaitGroup{}
+	cbCh := make(chan struct{}, 1)
+	startCh, writtenCh := make(chan struct{}), make(chan struct{})
+	j := NewJob("", func(cancelCh CancelChannel, logs io.Writer) error {
+		defer wg.Done()
+		_, _ = logs.Write([]byte("line1\n"))
+		close(writtenCh)
+		<-startCh
+		_, _ = logs.Write([]byte("line2\n"))
+		return nil
+	}, expectDoneCb(c, cbCh, Complete, nil))
+	wg.Add(1)
+	go j.Run()
+	<-writtenCh
+
+	// the logs written so far are followed by the ones written later
+	r1 := j.LogsFrom(3)
+	defer r1.Close()
+	// an offset beyond the logs written so far skips the logs until it's reached
+	r2 := j.LogsFrom(8)
+	defer r2.Close()
+	close(startCh)
+	// the readers are read concurrently, as the job blocks on writing to either
+	out2Ch := make(chan string, 1)
+	go func() {
+		out, _ := ioutil.ReadAll(r2)
+		out2Ch <- string(out)
+	}()
+	out, err := ioutil.ReadAll(r1)
+	c.Assert(err, IsNil)
+	c.Assert(string(out), Equals, "e1\nline2\n")
+	c.Assert(<-out2Ch, Equals, "ne2\n")
+
+	waitAndCheckJobStatus(c, wg, j, Complete, nil)
+	checkDoneCb(c, cbCh)
+
+	// the logs of a job that is done are returned as well
+	out, err = ioutil.ReadAll(j.LogsFrom(6))
+	c.Assert(err, IsNil)
+	c.Assert(string(out), Equals, "line2\n")
+	out, err = ioutil.ReadAll(j.LogsFrom(100))
+	c.Assert(err, IsNil)
+	c.Assert(string(out), Equals, "")
+}
+
+func (s *jobsSuite) TestJobPipeStreamLogs(c *C) {
+	wg := &sync.WaitGroup{}
+	cbCh := make(chan struct{}, 1)
+	startCh := make(chan struct{})
+	exptdOutStr := "stdout line\n"
+	exptdErrStr := "stderr line\n"
+	j := NewJob("", func(cancelCh CancelChannel, logs io.Writer) error {
+		defer wg.Done()
+		<-startCh
+		_, _ = logs.Write([]byte(exptdOutStr))
+		_, _ = logs.(interface {
+			Stderr() io.Writer
+		}).Stderr().Write([]byte(exptdErrStr))
+		return nil
+	}, expectDoneCb(c, cbCh, Complete, nil))
+	wg.Add(1)
+	go j.Run()
+	// give some time for job to start
+	time.Sleep(100 * time.Millisecond)
+	var allBuf, outBuf, errBuf bytes.Buffer
+	c.Assert(j.PipeStreamLogs(LogStreamAll, &allBuf), IsNil)
+	c.Assert(j.PipeStreamLogs(LogStreamStdout, &outBuf), IsNil)
+	c.Assert(j.PipeStreamLogs(LogStreamStderr, &errBuf), IsNil)
+	c.Assert(j.PipeStreamLogs(LogStream("foo"), &errBuf), NotNil)
+	close(startCh)
+
+	waitAndCheckJobStatus(c, wg, j, Complete, nil)
+
+	c.Assert(allBuf.String(), Equals, exptdOutStr+exptdErrStr)
+	c.Assert(outBuf.String(), Equals, exptdOutStr)
+	c.Assert(errBuf.String(), Equals, exptdErrStr)
+
+	checkDoneCb(c, cbCh)
+}
+
+func (s *jobsSuite) TestJobPipeLogsAfterDone(c *C) {
+	wg := &sync.WaitGroup{}
+	cbCh := make(chan struct{}, 1)
+	j := NewJob("", func(cancelCh CancelChannel, logs io.Writer) error {
+		defer wg.Done()
+		_, _ = logs.Write([]byte("line1\n"))
+		return nil
+	}, expectDoneCb(c, cbCh, Complete, nil))
+	wg.Add(1)
+	go j.Run()
+	waitAndCheckJobStatus(c, wg, j, Complete, nil)
+	checkDoneCb(c, cbCh)
+	// wait for the log writers to be closed
+	for done := false; !done; time.Sleep(10 * time.Millisecond) {
+		j.logsMutex.Lock()
+		done = j.logsDone
+		j.logsMutex.Unlock()
+	}
+
+	// a reader that attaches as the job finishes, after the job was found
+	// running, is closed right away instead of being left open
+	j.setStatus(Running, nil)
+	for _, stream := range []LogStream{LogStreamAll, LogStreamStdout, LogStreamStderr} {
+		pr, pw := io.Pipe()
+		c.Assert(j.PipeStreamLogs(stream, pw), IsNil)
+		out, err := ioutil.ReadAll(pr)
+		c.Assert(err, IsNil)
+		c.Assert(string(out), Equals, "")
+	}
+	out, err := ioutil.ReadAll(j.LogsFrom(0))
+	c.Assert(err, IsNil)
+	c.Assert(string(out), Equals, "line1\n")
+}
+
+func (s *jobsSuite) TestJobSummary(c *C) {
+	wg := &sync.WaitGroup{}
+	cbCh := make(chan struct{}, 1)
+	recapStr := `
+PLAY RECAP *********************************************************************
+node1                      : ok=5    changed=2    unreachable=0    failed=0
+node2                      : ok=3    changed=0    unreachable=0    failed=1
+`
+	j := NewJob("", logRunner(c, wg, recapStr), expectDoneCb(c, cbCh, Complete, nil))
+	c.Assert(j.Summary(), IsNil)
+	wg.Add(1)
+	go j.Run()
+
+	waitAndCheckJobStatus(c, wg, j, Complete, nil)
+
+	summary := j.Summary()
+	c.Assert(summary, NotNil)
+	c.Assert(summary.Passed, Equals, false)
+	c.Assert(summary.Hosts["node1"].Ok, Equals, 5)
+	c.Assert(summary.Hosts["node2"].Failed, Equals, 1)
+
+	checkDoneCb(c, cbCh)
+}
+
+func (s *jobsSuite) TestJobNodeStatus(c *C) {
+	wg := &sync.WaitGroup{}
+	cbCh := make(chan struct{}, 1)
+	logStr := `
+TASK [setup] *******************************************************************
+ok: [node1]
+fatal: [node2]: FAILED! => {"changed": false, "failed": true}
+
+PLAY RECAP *********************************************************************
+node1                      : ok=5    changed=2    unreachable=0    failed=0
+node2                      : ok=3    changed=0    unreachable=0    failed=1
+`
+	j := NewJob("", logRunner(c, wg, logStr), expectDoneCb(c, cbCh, Complete, nil))
+	j.setNodes([]string{"node1", "node2", "node3"})
+	c.Assert(j.NodeStatus(), DeepEquals, map[string]NodeStatus{
+		"node1": NodePending, "node2": NodePending, "node3": NodePending})
+	wg.Add(1)
+	go j.Run()
+
+	waitAndCheckJobStatus(c, wg, j, Complete, nil)
+
+	c.Assert(j.NodeStatus(), DeepEquals, map[string]NodeStatus{
+		"node1": NodeOk, "node2": NodeFailed, "node3": NodeOk})
+
+	checkDoneCb(c, cbCh)
+}
+
+func (s *jobsSuite) TestJobVerificationSummary(c *C) {
+	wg := &sync.WaitGroup{}
+	cbCh := make(chan struct{}, 1)
+	verifyErr := errored.Errorf("verification failed")
+	mainLogs := `
+PLAY RECAP *********************************************************************
+node1                      : ok=5    changed=2    unreachable=0    failed=0
+node2                      : ok=5    changed=2    unreachable=0    failed=0
+`
+	verifyLogs := `
+TASK [check services] **********************************************************
+ok: [node1]
+fatal: [node2]: FAILED! => {"changed": false, "failed": true}
+
+PLAY RECAP *********************************************************************
+node1                      : ok=2    changed=0    unreachable=0    failed=0
+node2                      : ok=1    changed=0    unreachable=0    failed=1
+`
+	var j *Job
+	j = NewJob("", func(cancelCh CancelChannel, logs io.Writer) error {
+		defer wg.Done()
+		logs.Write([]byte(mainLogs))
+		j.beginVerification()
+		logs.Write([]byte(verifyLogs))
+		return verifyErr
+	}, expectDoneCb(c, cbCh, Errored, verifyErr))
+	j.setNodes([]string{"node1", "node2"})
+	wg.Add(1)
+	go j.Run()
+
+	waitAndCheckJobStatus(c, wg, j, Errored, verifyErr)
+
+	// the main run and the verification are summarized separately
+	summary := j.Summary()
+	c.Assert(summary.Passed, Equals, false)
+	c.Assert(summary.Hosts["node1"].Ok, Equals, 5)
+	c.Assert(summary.Hosts.FailedHosts(), DeepEquals, []string{})
+	c.Assert(summary.Verification["node1"].Ok, Equals, 2)
+	c.Assert(summary.Verification.FailedHosts(), DeepEquals, []string{"node2"})
+	c.Assert(j.NodeStatus(), DeepEquals, map[string]NodeStatus{
+		"node1": NodeOk, "node2": NodeFailedVerification})
+
+	checkDoneCb(c, cbCh)
+}
+
+func (s *jobsSuite) TestJobPlan(c *C) {
+	wg := &sync.WaitGroup{}
+	cbCh := make(chan struct{}, 1)
+	logStr := `
+TASK [install docker] **********************************************************
+changed: [node1]
+ok: [node2]
+
+PLAY RECAP *********************************************************************
+node1                      : ok=1    changed=1    unreachable=0    failed=0
+node2                      : ok=1    changed=0    unreachable=0    failed=0
+`
+	j := NewJob("", logRunner(c, wg, logStr), expectDoneCb(c, cbCh, Complete, nil))
+	j.check = true
+	wg.Add(1)
+	go j.Run()
+
+	waitAndCheckJobStatus(c, wg, j, Complete, nil)
+	checkDoneCb(c, cbCh)
+
+	expPlan := ansible.Plan{"node1": {{Task: "install docker"}}}
+	info := j.info(false)
+	c.Assert(info.Plan, DeepEquals, expPlan)
+
+	// the plan is restored along with the job
+	out, err := json.Marshal(info)
+	c.Assert(err, IsNil)
+	restored, err := newJobFromInfo(out)
+	c.Assert(err, IsNil)
+	c.Assert(restored.info(false).Plan, DeepEquals, expPlan)
+}
+
+func (s *jobsSuite) TestJobPlaybook(c *C) {
+	dir := c.MkDir()
+	c.Assert(ioutil.WriteFile(dir+"/site.yml", []byte("- hosts: all\n"), 0644), IsNil)
+	m := &Manager{
+		configuration: configuration.NewAnsibleSubsys(&configuration.AnsibleSubsysConfig{
+			ConfigurePlaybook: "site.yml",
+			PlaybookLocation:  dir,
+		}),
+	}
+	t := &jobTrigger{}
+	_, err := t.checkAndSetActiveJob(m, "", nil, 0, nil, nil)
+	c.Assert(err, IsNil)
+	t.setPlaybook(m, configureAction(""), "")
+	info := t.triggeredJob().info(false)
+	c.Assert(info.Playbook, Equals, dir+"/site.yml")
+	c.Assert(info.PlaybookVersion, Matches, "sha256:[0-9a-f]{64}")
+
+	// the playbook is restored along with the job
+	out, err := json.Marshal(info)
+	c.Assert(err, IsNil)
+	restored, err := newJobFromInfo(out)
+	c.Assert(err, IsNil)
+	c.Assert(restored.info(false).Playbook, Equals, info.Playbook)
+	c.Assert(restored.info(false).PlaybookVersion, Equals, info.PlaybookVersion)
+}
+
+func (s *jobsSuite) TestJobNoPlan(c *C) {
+	wg := &sync.WaitGroup{}
+	cbCh := make(chan struct{}, 1)
+	logStr := `
+TASK [install docker] **********************************************************
+changed: [node1]
+`
+	// a job that is not run in check mode has no plan
+	j := NewJob("", logRunner(c, wg, logStr), expectDoneCb(c, cbCh, Complete, nil))
+	wg.Add(1)
+	go j.Run()
+
+	waitAndCheckJobStatus(c, wg, j, Complete, nil)
+	checkDoneCb(c, cbCh)
+	c.Assert(j.info(false).Plan, IsNil)
+}
+
+func (s *jobsSuite) TestJobProgress(c *C) {
+	wg := &sync.WaitGroup{}
+	cbCh := make(chan struct{}, 1)
+	j := NewJob("", logRunner(c, wg, ""), expectDoneCb(c, cbCh, Complete, nil))
+	j.setNodes([]string{"node1", "node2"})
+	j.expectedTasks = 4
+	c.Assert(j.Progress(), Equals, 0)
+
+	j.beginTask()
+	j.updateNodeStatus("node1", ansible.TaskOk)
+	c.Assert(j.Progress(), Equals, 12)
+	j.updateNodeStatus("node2", ansible.TaskSkipped)
+	c.Assert(j.Progress(), Equals, 25)
+	j.beginTask()
+	j.updateNodeStatus("node1", ansible.TaskChanged)
+	c.Assert(j.Progress(), Equals, 37)
+	// the results of the items of a task count once
+	j.updateNodeStatus("node1", ansible.TaskChanged)
+	c.Assert(j.Progress(), Equals, 37)
+	// a failed node is done
+	j.updateNodeStatus("node2", ansible.TaskFailed)
+	c.Assert(j.Progress(), Equals, 75)
+	// progress shouldn't reach 100 before the job is done
+	j.beginTask()
+	j.beginTask()
+	j.updateNodeStatus("node1", ansible.TaskOk)
+	c.Assert(j.Progress(), Equals, 99)
+	j.updateNodeStatus("node3", ansible.TaskOk)
+	c.Assert(j.Progress(), Equals, 99)
+
+	wg.Add(1)
+	go j.Run()
+	waitAndCheckJobStatus(c, wg, j, Complete, nil)
+	c.Assert(j.Progress(), Equals, 100)
+
+	checkDoneCb(c, cbCh)
+}
+
+func (s *jobsSuite) TestJobProgressFromLogs(c *C) {
+	j := NewJob("", nil, nil)
+	j.setNodes([]string{"node1"})
+	w := &jobLogWriter{j: j, stream: LogStreamStdout}
+	// the tasks that the job is expected to run are not known
+	fmt.Fprintf(w, "PLAY [all] ***\n\nTASK [setup] ***\nok: [node1]\n")
+	c.Assert(j.Progress(), Equals, 100/defaultExpectedTasks)
+	c.Assert(j.info(false).Tasks, Equals, 1)
+
+	// the job runs more tasks than expected
+	j.expectedTasks = 1
+	fmt.Fprintf(w, "TASK [install] ***\nchanged: [node1]\n")
+	c.Assert(j.Progress(), Equals, 66)
+}
+
+func (s *jobsSuite) TestJobNodeStatusFromStdout(c *C) {
+	j := NewJob("", nil, nil)
+	j.setNodes([]string{"node1"})
+	w := &jobLogWriter{j: j, stream: LogStreamStdout}
+	// the stderr written amidst a line of stdout doesn't split it
+	fmt.Fprintf(w, "fatal: [no")
+	fmt.Fprintf(w.Stderr(), "warning: [node2]\n")
+	fmt.Fprintf(w, "de1]: FAILED! => {}\n")
+	c.Assert(j.NodeStatus(), DeepEquals, map[string]NodeStatus{"node1": NodeFailed})
+}
+
 func (s *jobsSuite) TestJobInfoMarshal(c *C) {
 	exptdLogStr := `
 	foo
@@ -269,3 +678,42 @@ func (s *jobsSuite) TestJobInfoMarshal(c *C) {
 	c.Assert(exptdInfo.ErrVal, Equals, fmt.Sprintf("%v", exptdErr))
 	c.Assert(exptdInfo.Logs, DeepEquals, strings.Split(exptdLogStr, "\n"))
 }
+
+func (s *jobsSuite) TestJobTimingInfo(c *C) {
+	wg := &sync.WaitGroup{}
+	cbCh := make(chan struct{}, 1)
+	j := NewJob("", runner(wg, 100*time.Millisecond, nil), expectDoneCb(c, cbCh, Complete, nil))
+	j.queuedAt = time.Now()
+
+	info := j.info(false)
+	c.Assert(info.QueuedAt, NotNil)
+	c.Assert(info.StartedAt, IsNil)
+	c.Assert(info.FinishedAt, IsNil)
+	c.Assert(info.Duration, Equals, "")
+
+	wg.Add(1)
+	go j.Run()
+	time.Sleep(50 * time.Millisecond)
+	// a running job reports a live duration and no finish time
+	info = j.info(false)
+	c.Assert(info.StartedAt, NotNil)
+	c.Assert(info.FinishedAt, IsNil)
+	c.Assert(info.Duration, Not(Equals), "")
+	out, err := json.Marshal(info)
+	c.Assert(err, IsNil)
+	c.Assert(string(out), Matches, `.*"finished_at":null.*`)
+
+	waitAndCheckJobStatus(c, wg, j, Complete, nil)
+	checkDoneCb(c, cbCh)
+	info = j.info(false)
+	c.Assert(info.FinishedAt, NotNil)
+	c.Assert(info.FinishedAt.Before(*info.StartedAt), Equals, false)
+	c.Assert(info.Duration, Equals, info.FinishedAt.Sub(*info.StartedAt).Round(time.Millisecond).String())
+
+	// the timing info is restored along with the job
+	out, err = json.Marshal(j.info(false))
+	c.Assert(err, IsNil)
+	restored, err := newJobFromInfo(out)
+	c.Assert(err, IsNil)
+	c.Assert(restored.info(false).Duration, Equals, info.Duration)
+}
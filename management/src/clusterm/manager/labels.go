@@ -0,0 +1,172 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/contiv/errored"
+)
+
+// reservedLabelPrefix is the prefix of the label keys that are reserved for clusterm
+const reservedLabelPrefix = "clusterm/"
+
+var (
+	// labelKeyRegexp matches the valid label keys, like 'rack' or 'example.com/role'
+	labelKeyRegexp = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9._/-]{0,61}[A-Za-z0-9])?$`)
+	// labelValueRegexp matches the valid label values, that may be empty
+	labelValueRegexp = regexp.MustCompile(`^([A-Za-z0-9]([A-Za-z0-9._-]{0,61}[A-Za-z0-9])?)?$`)
+)
+
+// errNoLabels is the error returned when no labels are specified as part of a
+// request that merges the labels of a node
+func errNoLabels() error {
+	return errored.Errorf("no labels specified")
+}
+
+// errInvalidLabel is the error returned when a label's key or value is not in
+// the expected format
+func errInvalidLabel(key, value string) error {
+	return errored.Errorf("invalid label %q. The key and value are expected to be alphanumeric, with '-', '_' or '.' in between, and the key may have a '/' in between", key+"="+value)
+}
+
+// errReservedLabel is the error returned when a label's key is reserved
+func errReservedLabel(key string) error {
+	return errored.Errorf("label key %q is reserved. The keys with prefix %q and the node field names can't be used", key, reservedLabelPrefix)
+}
+
+// validateLabels checks that the labels are in key=value format and that none
+// of their keys are reserved. The node field names are reserved to avoid
+// confusing the labels with the fields in the node info
+func validateLabels(labels map[string]string) error {
+	for k, v := range labels {
+		if !labelKeyRegexp.MatchString(k) || !labelValueRegexp.MatchString(v) {
+			return errInvalidLabel(k, v)
+		}
+		if _, ok := nodeFields[k]; ok || strings.HasPrefix(k, reservedLabelPrefix) {
+			return errReservedLabel(k)
+		}
+	}
+	return nil
+}
+
+// labelStore persists the labels of the nodes
+type labelStore interface {
+	PutLabels(name string, info []byte) error
+	GetAllLabels() (map[string][]byte, error)
+	DeleteLabels(name string) error
+}
+
+// restoreLabels restores the labels of the nodes from the label store. The
+// labels are attached to the nodes as they are discovered.
+func (m *Manager) restoreLabels() error {
+	m.labels = map[string]map[string]string{}
+	if m.labelStore == nil {
+		return nil
+	}
+
+	infos, err := m.labelStore.GetAllLabels()
+	if err != nil {
+		return err
+	}
+
+	for name, info := range infos {
+		labels := map[string]string{}
+		if err := json.Unmarshal(info, &labels); err != nil {
+			logrus.Errorf("failed to restore labels of node %q from %s. Error: %v", name, info, err)
+			continue
+		}
+		m.labels[name] = labels
+	}
+	return nil
+}
+
+// setLabelsEvent sets the labels of a node. Unlike the annotations, the labels
+// are validated and are meant to select the nodes, see matchesSelector
+type setLabelsEvent struct {
+	mgr    *Manager
+	name   string
+	labels map[string]string
+	// merge, when true, adds or updates the labels and leaves the existing
+	// labels with other keys as is, instead of replacing all of them
+	merge bool
+}
+
+// newSetLabelsEvent creates and returns setLabelsEvent
+func newSetLabelsEvent(mgr *Manager, name string, labels map[string]string, merge bool) *setLabelsEvent {
+	return &setLabelsEvent{
+		mgr:    mgr,
+		name:   name,
+		labels: labels,
+		merge:  merge,
+	}
+}
+
+func (e *setLabelsEvent) String() string {
+	return fmt.Sprintf("setLabelsEvent: node: %s labels: %v merge: %v", e.name, e.labels, e.merge)
+}
+
+func (e *setLabelsEvent) process() error {
+	node, err := e.mgr.findNode(e.name)
+	if err != nil {
+		return errBadRequest(err)
+	}
+
+	labels := map[string]string{}
+	if e.merge {
+		for k, v := range e.mgr.labels[e.name] {
+			labels[k] = v
+		}
+	}
+	for k, v := range e.labels {
+		labels[k] = v
+	}
+
+	if e.mgr.labelStore != nil {
+		if len(labels) == 0 {
+			err = e.mgr.labelStore.DeleteLabels(e.name)
+		} else {
+			var info []byte
+			if info, err = json.Marshal(labels); err != nil {
+				return err
+			}
+			err = e.mgr.labelStore.PutLabels(e.name, info)
+		}
+		if err != nil {
+			logrus.Errorf("failed to save labels of node %q. Error: %v", e.name, err)
+			return err
+		}
+	}
+
+	e.mgr.nodesMutex.Lock()
+	defer e.mgr.nodesMutex.Unlock()
+	if len(labels) == 0 {
+		delete(e.mgr.labels, e.name)
+		node.Labels = nil
+		return nil
+	}
+	if e.mgr.labels == nil {
+		e.mgr.labels = map[string]map[string]string{}
+	}
+	e.mgr.labels[e.name] = labels
+	node.Labels = labels
+	return nil
+}
+
+// nodeLabelsSet sets the labels of a node. The labels replace the existing
+// ones, unless they are to be merged. Replacing with no labels deletes them all
+func (m *Manager) nodeLabelsSet(req *APIRequest) error {
+	if req.MergeLabels && len(req.Labels) == 0 {
+		return errBadRequest(errNoLabels())
+	}
+	if err := validateLabels(req.Labels); err != nil {
+		return errBadRequest(err)
+	}
+	me := newWaitableEvent(newSetLabelsEvent(m, req.Nodes[0], req.Labels, req.MergeLabels))
+	if err := m.enqueue(me); err != nil {
+		return err
+	}
+	return me.waitForCompletion()
+}
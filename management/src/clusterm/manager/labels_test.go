@@ -0,0 +1,114 @@
+// +build unittest
+
+package manager
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+type labelsSuite struct {
+}
+
+var _ = Suite(&labelsSuite{})
+
+// fakeLabelStore keeps the labels records in memory
+type fakeLabelStore struct {
+	infos map[string][]byte
+}
+
+func (s *fakeLabelStore) PutLabels(name string, info []byte) error {
+	s.infos[name] = info
+	return nil
+}
+
+func (s *fakeLabelStore) GetAllLabels() (map[string][]byte, error) {
+	return s.infos, nil
+}
+
+func (s *fakeLabelStore) DeleteLabels(name string) error {
+	delete(s.infos, name)
+	return nil
+}
+
+func (s *labelsSuite) TestSetLabels(c *C) {
+	store := &fakeLabelStore{infos: map[string][]byte{}}
+	m := &Manager{
+		nodes:      map[string]*node{"node1": {}},
+		labelStore: store,
+	}
+	c.Assert(m.restoreLabels(), IsNil)
+
+	c.Assert(newSetLabelsEvent(m, "node1", map[string]string{"rack": "r1", "zone": "z1"}, false).process(), IsNil)
+	c.Assert(m.nodes["node1"].Labels, DeepEquals, map[string]string{"rack": "r1", "zone": "z1"})
+	c.Assert(store.infos, HasLen, 1)
+
+	// merge leaves the other labels as is
+	c.Assert(newSetLabelsEvent(m, "node1", map[string]string{"rack": "r2"}, true).process(), IsNil)
+	c.Assert(m.nodes["node1"].Labels, DeepEquals, map[string]string{"rack": "r2", "zone": "z1"})
+
+	// replace drops the other labels
+	c.Assert(newSetLabelsEvent(m, "node1", map[string]string{"role": "worker"}, false).process(), IsNil)
+	c.Assert(m.nodes["node1"].Labels, DeepEquals, map[string]string{"role": "worker"})
+
+	// the labels are restored on restart
+	m2 := &Manager{labelStore: store}
+	c.Assert(m2.restoreLabels(), IsNil)
+	c.Assert(m2.labels, DeepEquals, map[string]map[string]string{"node1": {"role": "worker"}})
+
+	c.Assert(newSetLabelsEvent(m, "node1", nil, false).process(), IsNil)
+	c.Assert(m.nodes["node1"].Labels, IsNil)
+	c.Assert(m.labels, HasLen, 0)
+	c.Assert(store.infos, HasLen, 0)
+
+	err := newSetLabelsEvent(m, "node2", map[string]string{"rack": "r1"}, false).process()
+	c.Assert(err, NotNil)
+	c.Assert(httpStatus(err), Equals, 400)
+}
+
+func (s *labelsSuite) TestSetLabelsRejected(c *C) {
+	m := &Manager{nodes: map[string]*node{"node1": {}}}
+	tests := map[string]struct {
+		labels map[string]string
+		merge  bool
+		exptd  error
+	}{
+		"reserved-prefix": {
+			labels: map[string]string{"clusterm/role": "worker"},
+			exptd:  errReservedLabel("clusterm/role"),
+		},
+		"reserved-field": {
+			labels: map[string]string{"status": "ok"},
+			exptd:  errReservedLabel("status"),
+		},
+		"invalid-key": {
+			labels: map[string]string{"rack id": "r1"},
+			exptd:  errInvalidLabel("rack id", "r1"),
+		},
+		"invalid-value": {
+			labels: map[string]string{"rack": "r1,r2"},
+			exptd:  errInvalidLabel("rack", "r1,r2"),
+		},
+		"no-labels-to-merge": {
+			merge: true,
+			exptd: errNoLabels(),
+		},
+	}
+	for testname, test := range tests {
+		err := m.nodeLabelsSet(&APIRequest{Nodes: []string{"node1"}, Labels: test.labels,
+			MergeLabels: test.merge})
+		c.Assert(err, NotNil, Commentf("test: %s", testname))
+		c.Assert(err.Error(), Equals, test.exptd.Error(), Commentf("test: %s", testname))
+		c.Assert(httpStatus(err), Equals, 400, Commentf("test: %s", testname))
+	}
+	c.Assert(m.nodes["node1"].Labels, IsNil)
+
+	c.Assert(validateLabels(map[string]string{"example.com/role": "worker", "empty": ""}), IsNil)
+}
+
+func (s *labelsSuite) TestLabelsSelectNodes(c *C) {
+	m := newSelectorTestManager()
+	m.nodes["node3"].Labels = map[string]string{"example.com/gpu": "true"}
+	req := &APIRequest{Selector: "example.com/gpu=true"}
+	c.Assert(m.resolveRequestSelector(req), IsNil)
+	c.Assert(req.Nodes, DeepEquals, []string{"node3"})
+}
@@ -0,0 +1,88 @@
+package manager
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+)
+
+// grepGroupSeparator separates the groups of non-contiguous matching lines and
+// their context, like grep does, when context lines are requested
+const grepGroupSeparator = "--"
+
+// maxLogLineLen is the length of the longest log line that can be searched
+const maxLogLineLen = 1 << 20
+
+// grepLogs returns a reader of the lines read from r that match the regular
+// expression, along with context lines before and after each match. Closing
+// the returned reader closes r as well.
+func grepLogs(r io.ReadCloser, re *regexp.Regexp, context int) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(grepLines(r, pw, re, context))
+		r.Close()
+	}()
+	return &grepReader{PipeReader: pr, src: r}
+}
+
+// grepReader is the reader of the grepped lines. Closing it closes the source
+// right away, so that a grep blocked on reading the source is unblocked too
+type grepReader struct {
+	*io.PipeReader
+	src io.Closer
+}
+
+func (r *grepReader) Close() error {
+	r.src.Close()
+	return r.PipeReader.Close()
+}
+
+// grepLines writes the lines read from r, that match the regular expression,
+// to w. The context lines before and after a match are written as well.
+func grepLines(r io.Reader, w io.Writer, re *regexp.Regexp, context int) error {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 4096), maxLogLineLen)
+	var (
+		before    []string // the lines before the current one, upto context lines
+		afterLeft int      // the number of context lines yet to be written after a match
+		written   bool     // true once a line is written
+		lastLine  = -1     // the number of the last written line
+	)
+	for lineNum := 0; s.Scan(); lineNum++ {
+		line := s.Text()
+		if !re.MatchString(line) {
+			if afterLeft > 0 {
+				afterLeft--
+				if _, err := fmt.Fprintln(w, line); err != nil {
+					return err
+				}
+				lastLine = lineNum
+				continue
+			}
+			if context > 0 {
+				if len(before) == context {
+					before = before[1:]
+				}
+				before = append(before, line)
+			}
+			continue
+		}
+
+		if context > 0 && written && lineNum-len(before) > lastLine+1 {
+			if _, err := fmt.Fprintln(w, grepGroupSeparator); err != nil {
+				return err
+			}
+		}
+		for _, l := range append(before, line) {
+			if _, err := fmt.Fprintln(w, l); err != nil {
+				return err
+			}
+		}
+		before = before[:0]
+		afterLeft = context
+		written = true
+		lastLine = lineNum
+	}
+	return s.Err()
+}
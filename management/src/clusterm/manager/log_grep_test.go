@@ -0,0 +1,100 @@
+// +build unittest
+
+package manager
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+type logGrepSuite struct {
+}
+
+var _ = Suite(&logGrepSuite{})
+
+const testGrepLogs = `TASK [a]
+ok: [node1]
+TASK [b]
+fatal: [node1]: FAILED!
+TASK [c]
+skipping: [node1]
+TASK [d]
+TASK [e]
+fatal: [node2]: FAILED!
+`
+
+func (s *logGrepSuite) TestGrepLines(c *C) {
+	tests := map[string]struct {
+		grep    string
+		context int
+		exptd   string
+	}{
+		"no-context": {
+			grep:  "FAILED",
+			exptd: "fatal: [node1]: FAILED!\nfatal: [node2]: FAILED!\n",
+		},
+		"context": {
+			grep:    "FAILED",
+			context: 1,
+			exptd:   "TASK [b]\nfatal: [node1]: FAILED!\nTASK [c]\n--\nTASK [e]\nfatal: [node2]: FAILED!\n",
+		},
+		"overlapping-context": {
+			grep:    "FAILED",
+			context: 3,
+			exptd:   "TASK [a]\nok: [node1]\nTASK [b]\nfatal: [node1]: FAILED!\nTASK [c]\nskipping: [node1]\nTASK [d]\nTASK [e]\nfatal: [node2]: FAILED!\n",
+		},
+		"no-match": {
+			grep:    "node3",
+			context: 2,
+			exptd:   "",
+		},
+	}
+
+	for key, test := range tests {
+		var out bytes.Buffer
+		err := grepLines(strings.NewReader(testGrepLogs), &out, regexp.MustCompile(test.grep), test.context)
+		c.Assert(err, IsNil, Commentf("key: %s", key))
+		c.Assert(out.String(), Equals, test.exptd, Commentf("key: %s", key))
+	}
+}
+
+func (s *logGrepSuite) TestGrepLogs(c *C) {
+	out, err := ioutil.ReadAll(grepLogs(ioutil.NopCloser(strings.NewReader(testGrepLogs)), regexp.MustCompile(`^TASK \[[ab]\]`), 0))
+	c.Assert(err, IsNil)
+	c.Assert(string(out), Equals, "TASK [a]\nTASK [b]\n")
+}
+
+func (s *logGrepSuite) TestGrepLogsClose(c *C) {
+	pr, pw := io.Pipe()
+	out := grepLogs(pr, regexp.MustCompile("foo"), 0)
+	c.Assert(out.Close(), IsNil)
+	// the source is closed even though the grep is blocked on reading it
+	_, err := pw.Write([]byte("foo\n"))
+	c.Assert(err, Equals, io.ErrClosedPipe)
+}
+
+func (s *logGrepSuite) TestLogsGetInvalidGrep(c *C) {
+	m := &Manager{}
+	for key, query := range map[string]string{
+		"invalid-grep":     "grep=foo(",
+		"invalid-context":  "grep=foo&context=bar",
+		"negative-context": "grep=foo&context=-1",
+		"invalid-offset":   "offset=foo",
+		"negative-offset":  "offset=-1",
+		// the offset is in the logs of all streams
+		"offset-with-stream": "offset=0&stream=stderr",
+	} {
+		w := httptest.NewRecorder()
+		r, err := http.NewRequest("GET", "/"+GetJobLogPrefix+"/active?"+query, nil)
+		c.Assert(err, IsNil)
+		get(m.logsGet)(w, r)
+		c.Assert(w.Code, Equals, http.StatusBadRequest, Commentf("key: %s", key))
+	}
+}
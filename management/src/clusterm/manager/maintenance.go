@@ -0,0 +1,127 @@
+package manager
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/contiv/errored"
+)
+
+// errNoMaintenance is the error returned when the maintenance flag is not
+// specified as part of a node maintenance request
+func errNoMaintenance() error {
+	return errored.Errorf("maintenance flag not specified")
+}
+
+// errNodesInMaintenance is the error returned when all the nodes that a job
+// acts upon are in maintenance
+func errNodesInMaintenance(nodeNames []string) error {
+	return errored.Errorf("node(s) %v are in maintenance", nodeNames)
+}
+
+// maintenanceStore persists the nodes that are in maintenance
+type maintenanceStore interface {
+	PutMaintenance(name string, info []byte) error
+	GetAllMaintenance() (map[string][]byte, error)
+	DeleteMaintenance(name string) error
+}
+
+// restoreMaintenance restores the nodes in maintenance from the maintenance
+// store. The flag is attached to the nodes as they are discovered.
+func (m *Manager) restoreMaintenance() error {
+	m.maintenance = map[string]bool{}
+	if m.maintenanceStore == nil {
+		return nil
+	}
+
+	infos, err := m.maintenanceStore.GetAllMaintenance()
+	if err != nil {
+		return err
+	}
+
+	for name := range infos {
+		m.maintenance[name] = true
+	}
+	return nil
+}
+
+// withoutMaintenanceNodes returns the nodes that are not in maintenance, in
+// the same order, along with the ones that are
+func (m *Manager) withoutMaintenanceNodes(nodeNames []string) ([]string, []string) {
+	names := []string{}
+	skipped := []string{}
+	for _, name := range nodeNames {
+		if m.maintenance[name] {
+			skipped = append(skipped, name)
+			continue
+		}
+		names = append(names, name)
+	}
+	return names, skipped
+}
+
+// setMaintenanceEvent puts a node in maintenance or takes it out. The nodes in
+// maintenance are left as is by the monitoring events and are not selected by
+// the node selectors, without them being decommissioned
+type setMaintenanceEvent struct {
+	mgr         *Manager
+	name        string
+	maintenance bool
+}
+
+// newSetMaintenanceEvent creates and returns setMaintenanceEvent
+func newSetMaintenanceEvent(mgr *Manager, name string, maintenance bool) *setMaintenanceEvent {
+	return &setMaintenanceEvent{
+		mgr:         mgr,
+		name:        name,
+		maintenance: maintenance,
+	}
+}
+
+func (e *setMaintenanceEvent) String() string {
+	return fmt.Sprintf("setMaintenanceEvent: node: %s maintenance: %v", e.name, e.maintenance)
+}
+
+func (e *setMaintenanceEvent) process() error {
+	node, err := e.mgr.findNode(e.name)
+	if err != nil {
+		return errBadRequest(err)
+	}
+
+	if e.mgr.maintenanceStore != nil {
+		if e.maintenance {
+			err = e.mgr.maintenanceStore.PutMaintenance(e.name, []byte(time.Now().Format(time.RFC3339)))
+		} else {
+			err = e.mgr.maintenanceStore.DeleteMaintenance(e.name)
+		}
+		if err != nil {
+			logrus.Errorf("failed to save maintenance of node %q. Error: %v", e.name, err)
+			return err
+		}
+	}
+
+	if e.mgr.maintenance == nil {
+		e.mgr.maintenance = map[string]bool{}
+	}
+	if e.maintenance {
+		e.mgr.maintenance[e.name] = true
+	} else {
+		delete(e.mgr.maintenance, e.name)
+	}
+	e.mgr.nodesMutex.Lock()
+	defer e.mgr.nodesMutex.Unlock()
+	node.Maintenance = e.maintenance
+	return nil
+}
+
+func (m *Manager) nodeMaintenanceSet(req *APIRequest) error {
+	if req.Maintenance == nil {
+		return errBadRequest(errNoMaintenance())
+	}
+	me := newWaitableEvent(newSetMaintenanceEvent(m, req.Nodes[0], *req.Maintenance))
+	if err := m.enqueue(me); err != nil {
+		return err
+	}
+	return me.waitForCompletion()
+}
@@ -0,0 +1,98 @@
+// +build unittest
+
+package manager
+
+import (
+	"github.com/contiv/cluster/management/src/monitor"
+	. "gopkg.in/check.v1"
+)
+
+type maintenanceSuite struct {
+}
+
+var _ = Suite(&maintenanceSuite{})
+
+// fakeMaintenanceStore keeps the maintenance records in memory
+type fakeMaintenanceStore struct {
+	infos map[string][]byte
+}
+
+func (s *fakeMaintenanceStore) PutMaintenance(name string, info []byte) error {
+	s.infos[name] = info
+	return nil
+}
+
+func (s *fakeMaintenanceStore) GetAllMaintenance() (map[string][]byte, error) {
+	return s.infos, nil
+}
+
+func (s *fakeMaintenanceStore) DeleteMaintenance(name string) error {
+	delete(s.infos, name)
+	return nil
+}
+
+func (s *maintenanceSuite) TestSetMaintenance(c *C) {
+	store := &fakeMaintenanceStore{infos: map[string][]byte{}}
+	m := &Manager{
+		nodes:            map[string]*node{"node1": {}},
+		maintenanceStore: store,
+	}
+	c.Assert(m.restoreMaintenance(), IsNil)
+
+	c.Assert(newSetMaintenanceEvent(m, "node1", true).process(), IsNil)
+	c.Assert(m.nodes["node1"].Maintenance, Equals, true)
+	c.Assert(m.maintenance, DeepEquals, map[string]bool{"node1": true})
+	c.Assert(store.infos, HasLen, 1)
+
+	// the maintenance is restored on restart
+	m2 := &Manager{maintenanceStore: store}
+	c.Assert(m2.restoreMaintenance(), IsNil)
+	c.Assert(m2.maintenance, DeepEquals, map[string]bool{"node1": true})
+
+	c.Assert(newSetMaintenanceEvent(m, "node1", false).process(), IsNil)
+	c.Assert(m.nodes["node1"].Maintenance, Equals, false)
+	c.Assert(m.maintenance, HasLen, 0)
+	c.Assert(store.infos, HasLen, 0)
+
+	err := newSetMaintenanceEvent(m, "node2", true).process()
+	c.Assert(err, NotNil)
+	c.Assert(httpStatus(err), Equals, 400)
+
+	err = m.nodeMaintenanceSet(&APIRequest{Nodes: []string{"node1"}})
+	c.Assert(err, NotNil)
+	c.Assert(err.Error(), Equals, errNoMaintenance().Error())
+	c.Assert(httpStatus(err), Equals, 400)
+}
+
+func (s *maintenanceSuite) TestMaintenanceNodeNotSelected(c *C) {
+	m := newSelectorTestManager()
+	m.nodes["node2"].Maintenance = true
+	req := &APIRequest{Selector: "rack=r1"}
+	c.Assert(m.resolveRequestSelector(req), IsNil)
+	c.Assert(req.Nodes, DeepEquals, []string{"node1"})
+
+	m.nodes["node1"].Maintenance = true
+	req = &APIRequest{Selector: "rack=r1"}
+	c.Assert(m.resolveRequestSelector(req), NotNil)
+}
+
+func (s *maintenanceSuite) TestDisappearedMaintenanceNode(c *C) {
+	mon := monitor.NewNode("node1", "s1", "1.1.1.1")
+	m := &Manager{nodes: map[string]*node{"node1-s1": {Maintenance: true}}}
+	// the inventory state of the node is left as is
+	c.Assert(newDisappearedEvent(m, []monitor.SubsysNode{mon}).process(), IsNil)
+	c.Assert(m.nodes["node1-s1"].Mon, Equals, mon)
+}
+
+func (s *maintenanceSuite) TestScheduledUpdateSkipsMaintenanceNodes(c *C) {
+	m := &Manager{maintenance: map[string]bool{"node1": true, "node2": true}}
+	names, skipped := m.withoutMaintenanceNodes([]string{"node3", "node1", "node2"})
+	c.Assert(names, DeepEquals, []string{"node3"})
+	c.Assert(skipped, DeepEquals, []string{"node1", "node2"})
+
+	e := newUpdateEvent(m, []string{"node1", "node2"}, "", "", "", 0)
+	e.setScheduled()
+	err := e.process()
+	c.Assert(err, NotNil)
+	c.Assert(err.Error(), Equals, errNodesInMaintenance([]string{"node1", "node2"}).Error())
+}
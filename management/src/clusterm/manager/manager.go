@@ -12,6 +12,9 @@
 package manager
 
 import (
+	"sync"
+	"time"
+
 	"github.com/contiv/cluster/management/src/boltdb"
 	"github.com/contiv/cluster/management/src/configuration"
 	"github.com/contiv/cluster/management/src/inventory"
@@ -26,9 +29,40 @@ import (
 // node is an aggregate structure that contains information about a cluster
 // node as seen by cluster management subsystems.
 type node struct {
-	Mon monitor.SubsysNode       `json:"monitoring_state"`
-	Inv inventory.SubsysAsset    `json:"inventory_state"`
-	Cfg configuration.SubsysHost `json:"configuration_state"`
+	Mon  monitor.SubsysNode       `json:"monitoring_state"`
+	Inv  inventory.SubsysAsset    `json:"inventory_state"`
+	Cfg  configuration.SubsysHost `json:"configuration_state"`
+	Tags map[string]string        `json:"tags"`
+	// Annotations are the free-form metadata about the node, set by the user
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// Labels are the validated key-values set by the user, that select the
+	// node along with it's tags
+	Labels map[string]string `json:"labels,omitempty"`
+	// Maintenance is true if the node is in maintenance, in which case it is
+	// left as is by the monitoring events and is not selected by node selectors
+	Maintenance bool `json:"maintenance,omitempty"`
+	// Version is the version the node was last upgraded to, while TargetVersion
+	// is the version of the latest upgrade, that may have failed on the node
+	Version       string `json:"version,omitempty"`
+	TargetVersion string `json:"target_version,omitempty"`
+	// Reachability is the result of the node's heartbeat, it is empty if the
+	// node was not probed yet
+	Reachability string `json:"reachability,omitempty"`
+	// missedHeartbeats is the number of heartbeats the node missed in a row
+	missedHeartbeats int
+	// discoveredAt is the time the node was last reported as discovered by
+	// the monitoring subsystem
+	discoveredAt time.Time
+	// lastExtraVars are the request extra vars of the latest commission or
+	// update of the node
+	lastExtraVars string
+}
+
+// nodeInfo is the info of a node along with the flags derived from it's state
+type nodeInfo struct {
+	*node
+	// Unmanaged is true for the node that is discovered but not commissioned yet
+	Unmanaged bool `json:"unmanaged"`
 }
 
 // Manager integrates the cluster infra services like node discovery, inventory
@@ -39,11 +73,98 @@ type Manager struct {
 	monitor       monitor.Subsys
 	reqQ          chan event
 	addr          string
+	grpcAddr      string // the address the gRPC front-end is served at, if enabled
 	nodes         map[string]*node
-	activeJob     *Job // there can be only one active job at a time
+	activeJobs    map[uint64]*Job // the jobs that are running, keyed by job id
 	lastJob       *Job
-	config        *Config
-	configFile    string // file containing clusterm config, when clusterm is started with a config file
+	// jobStore persists the job history. It is nil if the inventory backend doesn't support it
+	jobStore   jobStore
+	jobHistory []*Job // recent jobs, oldest first
+	jobSeq     uint64 // id of the most recently created job
+	// hooks are invoked around the processing of every event
+	hooks []EventHook
+	// annotationStore persists the node annotations. It is nil if the inventory
+	// backend doesn't support it
+	annotationStore annotationStore
+	// auditStore persists the audit log. It is nil if the inventory backend
+	// doesn't support it, in which case the audit records are only logged
+	auditStore auditStore
+	// annotations are the annotations of known nodes, including the nodes that
+	// are not discovered yet, keyed by node name
+	annotations map[string]map[string]string
+	// pendingJobs are the placeholders for jobs of async requests that are not yet processed
+	pendingJobs map[uint64]*Job
+	// scheduledJobs are the jobs that are held back until their scheduled time
+	scheduledJobs map[uint64]*scheduledJob
+	// heldEvents are the events that trigger a job, that are held until the
+	// conflicting jobs are done, oldest first
+	heldEvents []*heldEvent
+	// releasedQ queues the held events that can be processed now, ahead of the
+	// requests. It's sized like the request queue
+	releasedQ chan event
+	// eventClaims are the claims of the events being processed on the nodes of
+	// the jobs they trigger
+	eventClaims map[event]*eventClaim
+	// eventsMutex is held for reading while an event that triggers a job is
+	// processed, and for writing while any other event is processed, as the
+	// latter update the state shared by the events
+	eventsMutex sync.RWMutex
+	// jobsMutex protects the active, pending and last job, the job history and
+	// the held and claimed events
+	jobsMutex  sync.Mutex
+	config     *Config
+	configFile string // file containing clusterm config, when clusterm is started with a config file
+	// configVersion is the version of the config, that is incremented on every
+	// change to it. It is accessed atomically
+	configVersion uint64
+	// debugToken is the token required to access the debug endpoints, when they are enabled
+	debugToken string
+	// readyCh is closed once the initial sync of the nodes with the monitoring
+	// subsystem is complete. The requests that act upon the nodes are rejected until then
+	readyCh         chan struct{}
+	initialSyncOnce sync.Once
+	// probeNode probes a node's management address as part of it's heartbeat,
+	// or before it's discovery
+	probeNode func(addr string, timeout time.Duration) error
+	// heartbeatInFlight is true while the nodes are probed for a heartbeat,
+	// until the result of the probes is processed. It's only accessed by the events
+	heartbeatInFlight bool
+	// startedAt is the time the manager was instantiated
+	startedAt time.Time
+	// nodeEvents publishes the transitions in the state of nodes to the subscribers
+	nodeEvents *nodeEventsBroker
+	// nodeHistoryStore persists the history of nodes. It is nil if the
+	// inventory backend doesn't support it
+	nodeHistoryStore nodeHistoryStore
+	// nodeHistory are the recent events of the nodes, oldest first, keyed by node name
+	nodeHistory      map[string][]NodeEvent
+	nodeHistoryMutex sync.Mutex
+	// nodesMutex protects the nodes and their info. The events and the job
+	// callbacks hold it for writing just while they update the nodes in memory,
+	// not while they update the inventory, while the API handlers and the
+	// running jobs hold it for reading to look the nodes up. The nodes are only
+	// added and removed by the events, so the events don't hold it for reading.
+	nodesMutex sync.RWMutex
+	// configMutex protects the config, that is replaced on a change while the
+	// API handlers and the running jobs read it. See getConfig
+	configMutex sync.RWMutex
+	// maintenanceStore persists the nodes in maintenance. It is nil if the
+	// inventory backend doesn't support it
+	maintenanceStore maintenanceStore
+	// maintenance are the known nodes that are in maintenance, including the
+	// nodes that are not discovered yet
+	maintenance map[string]bool
+	// droppedMonitorEvents is the number of monitor events that were rejected
+	// as the request queue stayed full. It is accessed atomically
+	droppedMonitorEvents uint64
+	// labelStore persists the node labels. It is nil if the inventory backend
+	// doesn't support it
+	labelStore labelStore
+	// labels are the labels of known nodes, including the nodes that are not
+	// discovered yet, keyed by node name
+	labels map[string]map[string]string
+	// basePath is the path prefix that the REST endpoints are served under, if any
+	basePath string
 }
 
 // NewManager initializes and returns an instance of the Manager. It returns nil
@@ -53,47 +174,191 @@ func NewManager(config *Config, configFile string) (*Manager, error) {
 		return nil, errored.Errorf("nil config passed")
 	}
 
-	var err error
-	config.Ansible.ExtraVariables, err = validateAndSanitizeEmptyExtraVars(
-		"ansible.ExtraVariables configuration", config.Ansible.ExtraVariables)
-	if err != nil {
+	if err := validateStartupConfig(config); err != nil {
 		return nil, err
 	}
 
+	addr, err := normalizeListenAddr(config.Manager.Addr)
+	if err != nil {
+		return nil, errored.Errorf("invalid listen address configuration. Error: %s", err)
+	}
+
+	grpcAddr := ""
+	if config.Manager.GRPCAddr != "" {
+		if grpcAddr, err = normalizeListenAddr(config.Manager.GRPCAddr); err != nil {
+			return nil, errored.Errorf("invalid gRPC listen address configuration. Error: %s", err)
+		}
+	}
+
+	basePath, err := normalizeBasePath(config.Manager.BasePath)
+	if err != nil {
+		return nil, errored.Errorf("invalid base path configuration. Error: %s", err)
+	}
+
+	debugToken := ""
+	if config.Manager.DebugEndpoints {
+		if debugToken, err = readDebugToken(config.Manager.DebugTokenFile); err != nil {
+			return nil, errored.Errorf("invalid debug endpoints configuration. Error: %s", err)
+		}
+	}
+
 	m := &Manager{
 		monitor:       monitor.NewSerfSubsys(&config.Serf),
 		configuration: configuration.NewAnsibleSubsys(&config.Ansible),
-		reqQ:          make(chan event, 100),
-		addr:          config.Manager.Addr,
+		reqQ:          make(chan event, reqQueueSize(config)),
+		addr:          addr,
+		grpcAddr:      grpcAddr,
+		basePath:      basePath,
 		nodes:         make(map[string]*node),
+		activeJobs:    make(map[uint64]*Job),
 		config:        config,
 		configFile:    configFile,
+		readyCh:       make(chan struct{}),
+		debugToken:    debugToken,
+		probeNode:     probeNodeAddr,
+		startedAt:     time.Now(),
+		nodeEvents:    newNodeEventsBroker(),
+	}
+	if err := m.initInventory(); err != nil {
+		return nil, err
+	}
+
+	if err := m.restoreState(); err != nil {
+		return nil, err
+	}
+
+	if err := m.monitor.RegisterCb(monitor.Discovered, m.enqueueDiscoveredEvent); err != nil {
+		return nil, errored.Errorf("failed to register node discovery callback. Error: %s", err)
+	}
+
+	if err := m.monitor.RegisterCb(monitor.Disappeared, m.enqueueMonitorEvent); err != nil {
+		return nil, errored.Errorf("failed to register node disappearance callback. Error: %s", err)
+	}
+
+	return m, nil
+}
+
+// validateStartupConfig validates the configuration that clusterm is started
+// with. The empty ansible extra variables are sanitized as well
+func validateStartupConfig(config *Config) error {
+	var err error
+	config.Ansible.ExtraVariables, err = validateAndSanitizeEmptyExtraVars(
+		"ansible.ExtraVariables configuration", config.Ansible.ExtraVariables)
+	if err != nil {
+		return err
+	}
+
+	for name, timeout := range map[string]string{
+		"job timeout":             config.Manager.JobTimeout,
+		"heartbeat interval":      config.Manager.HeartbeatInterval,
+		"job history max age":     config.Manager.JobHistoryMaxAge,
+		"read header timeout":     config.Manager.ReadHeaderTimeout,
+		"write timeout":           config.Manager.WriteTimeout,
+		"job write timeout":       config.Manager.JobWriteTimeout,
+		"monitor enqueue timeout": config.Manager.MonitorEnqueueTimeout,
+	} {
+		if timeout == "" {
+			continue
+		}
+		if _, err := parseTimeout(timeout); err != nil {
+			return errored.Errorf("invalid %s configuration. Error: %s", name, err)
+		}
+	}
+
+	if config.Manager.JobHistorySize < 0 || config.Manager.JobLogsMaxBytes < 0 {
+		return errored.Errorf("invalid job history configuration. The job history size and job logs max bytes can't be negative")
+	}
+
+	if config.Manager.ListenBacklog < 0 {
+		return errored.Errorf("invalid listen backlog configuration. The backlog can't be negative")
+	}
+
+	if config.Manager.AnsibleForks < 0 || config.Manager.AnsibleForks > maxAnsibleForks {
+		return errored.Errorf("invalid ansible forks configuration. Error: %s",
+			errInvalidForks(config.Manager.AnsibleForks))
+	}
+
+	for key, typ := range config.Manager.GlobalsSchema {
+		if !isValidGlobalsType(typ) {
+			return errored.Errorf("invalid globals schema configuration. Unknown type %q of key %q", typ, key)
+		}
+	}
+
+	if config.Manager.DefaultHostGroup != "" && !IsValidHostGroup(config.Manager.DefaultHostGroup) {
+		return errored.Errorf("invalid default host-group configuration: %q",
+			config.Manager.DefaultHostGroup)
 	}
+	return nil
+}
+
+// initInventory initializes the configured inventory subsystem
+func (m *Manager) initInventory() error {
 	// We give priority to boltdb inventory if both are set in config
-	if config.Inventory.BoltDB != nil {
-		if m.inventory, err = boltdbinv.NewBoltdbSubsys(*config.Inventory.BoltDB); err != nil {
-			return nil, err
+	if m.config.Inventory.BoltDB != nil {
+		if err := m.initBoltdb(*m.config.Inventory.BoltDB); err != nil {
+			return err
 		}
-	} else if config.Inventory.Collins != nil {
-		if m.inventory, err = collinsinv.NewCollinsSubsys(*config.Inventory.Collins); err != nil {
-			return nil, err
+	} else if m.config.Inventory.Collins != nil {
+		var err error
+		if m.inventory, err = collinsinv.NewCollinsSubsys(*m.config.Inventory.Collins); err != nil {
+			return err
 		}
 	} else {
 		// if no inventory config was provided then we default to boltDb
-		if m.inventory, err = boltdbinv.NewBoltdbSubsys(boltdb.DefaultConfig()); err != nil {
-			return nil, err
+		if err := m.initBoltdb(boltdb.DefaultConfig()); err != nil {
+			return err
 		}
 	}
+	return nil
+}
 
-	if err := m.monitor.RegisterCb(monitor.Discovered, m.enqueueMonitorEvent); err != nil {
-		return nil, errored.Errorf("failed to register node discovery callback. Error: %s", err)
+// restoreState restores the state, like the job history and the node labels,
+// that is persisted across the restarts of clusterm
+func (m *Manager) restoreState() error {
+	if err := m.restoreJobHistory(); err != nil {
+		return errored.Errorf("failed to restore job history. Error: %s", err)
 	}
+	m.recoverInterruptedAssets()
+	if err := m.restoreAnnotations(); err != nil {
+		return errored.Errorf("failed to restore node annotations. Error: %s", err)
+	}
+	if err := m.restoreNodeHistory(); err != nil {
+		return errored.Errorf("failed to restore node history. Error: %s", err)
+	}
+	if err := m.restoreMaintenance(); err != nil {
+		return errored.Errorf("failed to restore node maintenance. Error: %s", err)
+	}
+	if err := m.restoreLabels(); err != nil {
+		return errored.Errorf("failed to restore node labels. Error: %s", err)
+	}
+	return nil
+}
 
-	if err := m.monitor.RegisterCb(monitor.Disappeared, m.enqueueMonitorEvent); err != nil {
-		return nil, errored.Errorf("failed to register node disappearance callback. Error: %s", err)
+// reqQueueSize returns the configured size of the request queue
+func reqQueueSize(config *Config) int {
+	if config.Manager.ReqQueueSize < 1 {
+		return DefaultConfig().Manager.ReqQueueSize
 	}
+	return config.Manager.ReqQueueSize
+}
 
-	return m, nil
+// initBoltdb initializes the boltdb based inventory. The boltdb client is
+// shared to persist the job history as well
+func (m *Manager) initBoltdb(config boltdb.Config) error {
+	client, err := boltdb.NewClientFromConfig(config)
+	if err != nil {
+		return err
+	}
+	if m.inventory, err = boltdbinv.NewBoltdbSubsysFromClient(client); err != nil {
+		return err
+	}
+	m.jobStore = client
+	m.annotationStore = client
+	m.auditStore = client
+	m.nodeHistoryStore = client
+	m.maintenanceStore = client
+	m.labelStore = client
+	return nil
 }
 
 // Run triggers the manager loops
@@ -102,15 +367,52 @@ func (m *Manager) Run() error {
 	eg, _ := errgroup.WithContext(context.Background())
 
 	// start http server for servicing REST api endpoints. It feeds api/ux events.
+	// The manager stops once the api loop returns, like when clusterm is stopped
+	// by a signal, see stopOnSignal
 	apiServingCh := make(chan struct{}, 1)
-	eg.Go(func() error { return m.apiLoop(apiServingCh) })
+	stopCh := make(chan error, 2)
+	eg.Go(func() error {
+		err := m.apiLoop(apiServingCh)
+		stopCh <- err
+		return err
+	})
+
+	// start gRPC server for servicing the gRPC front-end, if enabled. It feeds
+	// api events like the REST api does
+	if m.grpcAddr != "" {
+		eg.Go(m.grpcLoop)
+	}
 
 	// start monitor subsystem. It feeds node state monitoring events.
 	// It needs to be started after api loop as monitor subsystem post events through API endpoints.
-	// Additionally, we wait for api loop to signal that it has setup socket to receive requests
-	<-apiServingCh
+	// Additionally, we wait for api loop to signal that it has setup socket to receive requests.
+	// Note that the manager is ready to act upon the nodes only after the monitor
+	// subsystem delivers the existing nodes, see enqueueDiscoveredEvent
+	select {
+	case <-apiServingCh:
+	case err := <-stopCh:
+		return err
+	}
 	eg.Go(m.monitorLoop)
 
+	// start the node heartbeat loop, if enabled. It feeds the heartbeat events.
+	if interval := heartbeatInterval(m.config); interval > 0 {
+		eg.Go(
+			func() error {
+				m.heartbeatLoop(interval)
+				return nil
+			})
+	}
+
+	// start the job history cleaner, if the jobs are pruned by age
+	if maxAge := jobHistoryMaxAge(m.config); maxAge > 0 {
+		eg.Go(
+			func() error {
+				m.jobHistoryCleanerLoop(jobHistoryCleanInterval)
+				return nil
+			})
+	}
+
 	// start signal handler loop.
 	// It needs to be started after api loop as signal handler posts events through API endpoints.
 	eg.Go(
@@ -126,5 +428,6 @@ func (m *Manager) Run() error {
 			return nil
 		})
 
-	return eg.Wait()
+	go func() { stopCh <- eg.Wait() }()
+	return <-stopCh
 }
@@ -20,12 +20,13 @@ func (m *Manager) enqueueMonitorEvent(events []monitor.Event) {
 			logrus.Errorf("unexpected monitor event type %v", e.Type)
 			continue
 		}
-		if err := NewClient(m.addr).PostMonitorEvent(eventName,
+		if err := NewClient(m.addr).WithBasePath(m.basePath).PostMonitorEvent(eventName,
 			[]MonitorNode{
 				{
 					Label:    e.Node.GetLabel(),
 					Serial:   e.Node.GetSerial(),
 					MgmtAddr: e.Node.GetMgmtAddress(),
+					Tags:     e.Node.GetTags(),
 				},
 			}); err != nil {
 			logrus.Errorf("error posting monitor event %q. Error: %v", eventName, err)
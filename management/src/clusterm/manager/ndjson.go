@@ -0,0 +1,99 @@
+package manager
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// ndjsonContentType is the media type of the newline delimited JSON responses
+const ndjsonContentType = "application/x-ndjson"
+
+// NodeStreamEntry is the info of a node as streamed, one per line, in the
+// newline delimited JSON listing of the nodes, and as listed in the ordered
+// listing of the nodes
+type NodeStreamEntry struct {
+	Name string          `json:"name"`
+	Info json.RawMessage `json:"info"`
+}
+
+// acceptsNDJSON returns true if the request accepts a newline delimited JSON
+// response, as indicated by it's Accept header
+func acceptsNDJSON(r *http.Request) bool {
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType := strings.ToLower(strings.TrimSpace(strings.Split(accept, ";")[0]))
+		if mediaType == ndjsonContentType {
+			return true
+		}
+	}
+	return false
+}
+
+// ndjsonNegotiated serves the requests that accept a newline delimited JSON
+// response with the streaming handler ndjsonH, and the others with h
+func ndjsonNegotiated(h, ndjsonH http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !acceptsNDJSON(r) {
+			h(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Accept")
+		w.Header().Set("Content-Type", ndjsonContentType)
+		ndjsonH(w, r)
+	}
+}
+
+// allNodesNDJSON streams the info of all known nodes as newline delimited JSON,
+// in the order of node names. The nodes are marshaled one at a time as the
+// stream is read, so the info of all nodes is not held in memory and the nodes
+// are not locked for the duration of the stream. The nodes removed while the
+// stream is read are skipped.
+func (m *Manager) allNodesNDJSON(req *APIRequest) (io.Reader, error) {
+	m.nodesMutex.RLock()
+	names := make([]string, 0, len(m.nodes))
+	for name := range m.nodes {
+		names = append(names, name)
+	}
+	m.nodesMutex.RUnlock()
+	sort.Strings(names)
+
+	pr, pw := io.Pipe()
+	go func() {
+		enc := json.NewEncoder(pw)
+		for _, name := range names {
+			entry, err := m.nodeStreamEntry(name, req)
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+			if entry == nil {
+				continue
+			}
+			// fails once the reader is closed, like when the client goes away
+			if err := enc.Encode(entry); err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+		pw.Close()
+	}()
+	return pr, nil
+}
+
+// nodeStreamEntry returns the streamed info of the specified node. It returns
+// nil if the node doesn't exist anymore or doesn't match the request's filters
+func (m *Manager) nodeStreamEntry(name string, req *APIRequest) (*NodeStreamEntry, error) {
+	m.nodesMutex.RLock()
+	defer m.nodesMutex.RUnlock()
+	node, ok := m.nodes[name]
+	if !ok || !node.hasTags(req.Tags) || !node.hasAnnotations(req.Annotations) {
+		return nil, nil
+	}
+	info, err := json.Marshal(node.selectFields(req.Fields))
+	if err != nil {
+		return nil, err
+	}
+	return &NodeStreamEntry{Name: name, Info: info}, nil
+}
@@ -0,0 +1,83 @@
+package manager
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"reflect"
+
+	"github.com/contiv/errored"
+)
+
+// NodeDiff describes a difference between the info of two nodes. The field is
+// identified by it's json path in the node info, like 'tags.rack'. A nil value
+// means that the field is not set for the respective node.
+type NodeDiff struct {
+	Field string      `json:"field"`
+	A     interface{} `json:"a"`
+	B     interface{} `json:"b"`
+}
+
+// errNodesDiffArgs is the error returned when the nodes to be compared are not specified
+func errNodesDiffArgs() error {
+	return errored.Errorf("Two nodes shall be specified to be compared, as query variables 'a' and 'b'")
+}
+
+// errDiffNodeNotExists is the error returned when a node to be compared doesn't
+// exist. The arg identifies the node, i.e. 'a' or 'b'
+func errDiffNodeNotExists(arg, name string) error {
+	return &apiError{
+		status: http.StatusNotFound,
+		code:   ErrCodeNodeNotFound,
+		err:    errored.Errorf("node %q, specified as %q, doesn't exist", name, arg),
+	}
+}
+
+// diffNodes returns the differences between the info of two nodes, sorted by the field
+func diffNodes(a, b *node) ([]NodeDiff, error) {
+	aFields, err := flattenValue(a)
+	if err != nil {
+		return nil, err
+	}
+	bFields, err := flattenValue(b)
+	if err != nil {
+		return nil, err
+	}
+
+	diffs := []NodeDiff{}
+	for _, field := range unionFields(aFields, bFields) {
+		diff := NodeDiff{Field: field, A: aFields[field], B: bFields[field]}
+		if reflect.DeepEqual(diff.A, diff.B) {
+			continue
+		}
+		diffs = append(diffs, diff)
+	}
+	return diffs, nil
+}
+
+func (m *Manager) nodesDiff(req *APIRequest) (io.Reader, error) {
+	m.nodesMutex.RLock()
+	defer m.nodesMutex.RUnlock()
+	if len(req.Nodes) != 2 || req.Nodes[0] == "" || req.Nodes[1] == "" {
+		return nil, errBadRequest(errNodesDiffArgs())
+	}
+	a, err := m.findNode(req.Nodes[0])
+	if err != nil {
+		return nil, errDiffNodeNotExists("a", req.Nodes[0])
+	}
+	b, err := m.findNode(req.Nodes[1])
+	if err != nil {
+		return nil, errDiffNodeNotExists("b", req.Nodes[1])
+	}
+
+	diffs, err := diffNodes(a, b)
+	if err != nil {
+		return nil, err
+	}
+	out, err := json.Marshal(diffs)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(out), nil
+}
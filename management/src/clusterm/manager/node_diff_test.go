@@ -0,0 +1,74 @@
+// +build unittest
+
+package manager
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/contiv/cluster/management/src/configuration"
+	"github.com/contiv/cluster/management/src/monitor"
+	. "gopkg.in/check.v1"
+)
+
+type nodeDiffSuite struct {
+}
+
+var _ = Suite(&nodeDiffSuite{})
+
+func newNodeDiffTestManager() *Manager {
+	return &Manager{
+		nodes: map[string]*node{
+			"node1": {
+				Mon: monitor.NewNode("node1", "s1", "1.1.1.1"),
+				Cfg: configuration.NewAnsibleHost("node1", "1.1.1.1", ansibleMasterGroupName,
+					map[string]string{"foo": "bar"}),
+				Tags:        map[string]string{"rack": "r1"},
+				Annotations: map[string]string{"owner": "ops"},
+			},
+			"node2": {
+				Mon: monitor.NewNode("node2", "s2", "1.1.1.2"),
+				Cfg: configuration.NewAnsibleHost("node2", "1.1.1.2", ansibleMasterGroupName,
+					map[string]string{"foo": "baz"}),
+				Tags: map[string]string{"rack": "r1"},
+			},
+		},
+	}
+}
+
+func (s *nodeDiffSuite) TestNodesDiff(c *C) {
+	m := newNodeDiffTestManager()
+	r, err := m.nodesDiff(&APIRequest{Nodes: []string{"node1", "node2"}})
+	c.Assert(err, IsNil)
+	out, err := ioutil.ReadAll(r)
+	c.Assert(err, IsNil)
+	diffs := []NodeDiff{}
+	c.Assert(json.Unmarshal(out, &diffs), IsNil)
+
+	byField := map[string]NodeDiff{}
+	for _, d := range diffs {
+		byField[d.Field] = d
+	}
+	c.Assert(byField["configuration_state.inventory_vars.foo"], DeepEquals,
+		NodeDiff{Field: "configuration_state.inventory_vars.foo", A: "bar", B: "baz"})
+	c.Assert(byField["annotations.owner"], DeepEquals, NodeDiff{Field: "annotations.owner", A: "ops"})
+	// the same values are not reported
+	_, ok := byField["tags.rack"]
+	c.Assert(ok, Equals, false)
+	_, ok = byField["configuration_state.host_group"]
+	c.Assert(ok, Equals, false)
+}
+
+func (s *nodeDiffSuite) TestNodesDiffErrors(c *C) {
+	m := newNodeDiffTestManager()
+	_, err := m.nodesDiff(&APIRequest{Nodes: []string{"node1", ""}})
+	c.Assert(httpStatus(err), Equals, http.StatusBadRequest)
+
+	_, err = m.nodesDiff(&APIRequest{Nodes: []string{"node1", "node3"}})
+	c.Assert(httpStatus(err), Equals, http.StatusNotFound)
+	c.Assert(err, ErrorMatches, `node "node3", specified as "b", doesn't exist`)
+
+	_, err = m.nodesDiff(&APIRequest{Nodes: []string{"node3", "node1"}})
+	c.Assert(err, ErrorMatches, `node "node3", specified as "a", doesn't exist`)
+}
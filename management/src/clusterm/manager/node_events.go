@@ -0,0 +1,267 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/contiv/cluster/management/src/inventory"
+	"github.com/contiv/errored"
+)
+
+const (
+	// NodeEventCommissioned is the event of a node that got commissioned
+	NodeEventCommissioned = "commissioned"
+	// NodeEventDecommissioned is the event of a node that got decommissioned
+	NodeEventDecommissioned = "decommissioned"
+	// NodeEventDiscovered is the event of a node that is discovered by the monitoring subsystem
+	NodeEventDiscovered = "discovered"
+	// NodeEventDisappeared is the event of a node that disappeared from the monitoring subsystem
+	NodeEventDisappeared = "disappeared"
+	// NodeEventRemoved is the event of a decommissioned node that got removed
+	NodeEventRemoved = "removed"
+	// NodeEventUnreachable is the event of a node that missed it's heartbeats
+	NodeEventUnreachable = "unreachable"
+	// NodeEventReachable is the event of an unreachable node that is reachable again
+	NodeEventReachable = "reachable"
+	// NodeEventChanged is the event of a node that changed to an intermediate
+	// state, like 'Provisioning' during it's commission
+	NodeEventChanged = "changed"
+	// NodeEventJobSucceeded is the event of a job that succeeded on a node.
+	// It is recorded in the node's history but not streamed
+	NodeEventJobSucceeded = "job-succeeded"
+	// NodeEventJobFailed is the event of a job that failed on a node.
+	// It is recorded in the node's history but not streamed
+	NodeEventJobFailed = "job-failed"
+
+	// nodeEventsBacklog is the number of node events that are buffered for a
+	// subscriber. The events are dropped for a subscriber that falls behind
+	nodeEventsBacklog = 64
+)
+
+// NodeState is the state of a node, as tracked by clusterm
+type NodeState struct {
+	// Status is the node's status in the inventory, like 'Allocated'
+	Status string `json:"status"`
+	// State is the node's state in the inventory, like 'Discovered'
+	State string `json:"state"`
+	// Reachability is the node's reachability as per it's heartbeats, if known
+	Reachability string `json:"reachability,omitempty"`
+}
+
+// NodeEvent is a transition in the state of a node
+type NodeEvent struct {
+	Node     string    `json:"node"`
+	Event    string    `json:"event"`
+	OldState NodeState `json:"old_state"`
+	NewState NodeState `json:"new_state"`
+	// JobID is the id of the job, for the events of a job's outcome
+	JobID uint64    `json:"job_id,omitempty"`
+	Time  time.Time `json:"time"`
+}
+
+// nodeState returns the state of the node. The state of a node that doesn't
+// exist, or is not in the inventory yet, is empty
+func (m *Manager) nodeState(name string) NodeState {
+	m.nodesMutex.RLock()
+	defer m.nodesMutex.RUnlock()
+	n, ok := m.nodes[name]
+	if !ok {
+		return NodeState{}
+	}
+	s := NodeState{Reachability: n.Reachability}
+	if n.Inv != nil {
+		status, state := n.Inv.GetStatus()
+		s.Status, s.State = status.String(), state.String()
+	}
+	return s
+}
+
+// nodeEventKind returns the kind of event for the transition of a node's state
+func nodeEventKind(old, cur NodeState) string {
+	switch {
+	case cur == NodeState{} && old != NodeState{}:
+		return NodeEventRemoved
+	case cur.Reachability == NodeUnreachable && old.Reachability != NodeUnreachable:
+		return NodeEventUnreachable
+	case old.Reachability == NodeUnreachable && cur.Reachability == NodeReachable:
+		return NodeEventReachable
+	case cur.State != old.State && cur.State == inventory.Disappeared.String():
+		return NodeEventDisappeared
+	case cur.State != old.State && cur.State == inventory.Discovered.String():
+		return NodeEventDiscovered
+	case cur.Status != old.Status && cur.Status == inventory.Allocated.String():
+		return NodeEventCommissioned
+	case cur.Status != old.Status && cur.Status == inventory.Decommissioned.String():
+		return NodeEventDecommissioned
+	default:
+		return NodeEventChanged
+	}
+}
+
+// trackNodeState records the node's current state and returns a func that
+// publishes the change in node's state, if any, since the recorded one. The
+// change is recorded in the node's history as well
+func (m *Manager) trackNodeState(name string) func() {
+	old := m.nodeState(name)
+	return func() {
+		cur := m.nodeState(name)
+		if cur == old {
+			return
+		}
+		ev := NodeEvent{
+			Node:     name,
+			Event:    nodeEventKind(old, cur),
+			OldState: old,
+			NewState: cur,
+			Time:     time.Now(),
+		}
+		m.recordNodeEvent(ev)
+		m.nodeEvents.publish(ev)
+	}
+}
+
+// publishNodeChange publishes a change of the node that doesn't transition it's
+// state, like a change in it's mgmt address. The change is recorded in the
+// node's history as well
+func (m *Manager) publishNodeChange(name string) {
+	s := m.nodeState(name)
+	ev := NodeEvent{
+		Node:     name,
+		Event:    NodeEventChanged,
+		OldState: s,
+		NewState: s,
+		Time:     time.Now(),
+	}
+	m.recordNodeEvent(ev)
+	m.nodeEvents.publish(ev)
+}
+
+// nodeEventsBroker fans out the node events to the subscribers. The events are
+// published without blocking, so a slow subscriber doesn't hold up the
+// publisher, like the event loop.
+type nodeEventsBroker struct {
+	sync.Mutex
+	subs map[*nodeEventsSub]struct{}
+}
+
+func newNodeEventsBroker() *nodeEventsBroker {
+	return &nodeEventsBroker{subs: map[*nodeEventsSub]struct{}{}}
+}
+
+// publish sends the event to all the subscribers. It's a no-op on a nil broker
+func (b *nodeEventsBroker) publish(ev NodeEvent) {
+	if b == nil {
+		return
+	}
+	logrus.Debugf("node %q %s: %+v -> %+v", ev.Node, ev.Event, ev.OldState, ev.NewState)
+	b.Lock()
+	defer b.Unlock()
+	for s := range b.subs {
+		select {
+		case s.ch <- ev:
+		default:
+			logrus.Warnf("node events subscriber is falling behind, dropping event for node %q", ev.Node)
+		}
+	}
+}
+
+// subscribe returns a stream of the node events, as server-sent events. The
+// subscriber is removed when the stream is closed.
+func (b *nodeEventsBroker) subscribe() io.ReadCloser {
+	r, w := io.Pipe()
+	s := &nodeEventsSub{
+		broker: b,
+		ch:     make(chan NodeEvent, nodeEventsBacklog),
+		doneCh: make(chan struct{}),
+		r:      r,
+	}
+	b.Lock()
+	b.subs[s] = struct{}{}
+	b.Unlock()
+
+	go s.run(w)
+	return s
+}
+
+func (b *nodeEventsBroker) unsubscribe(s *nodeEventsSub) {
+	b.Lock()
+	defer b.Unlock()
+	delete(b.subs, s)
+}
+
+// nodeEventsSub is a subscriber of the node events. Reading from it returns the
+// events as server-sent events
+type nodeEventsSub struct {
+	broker *nodeEventsBroker
+	ch     chan NodeEvent
+	doneCh chan struct{}
+	once   sync.Once
+	r      *io.PipeReader
+}
+
+func (s *nodeEventsSub) Read(p []byte) (int, error) {
+	return s.r.Read(p)
+}
+
+// Close removes the subscriber and ends the stream
+func (s *nodeEventsSub) Close() error {
+	s.once.Do(func() {
+		s.broker.unsubscribe(s)
+		close(s.doneCh)
+	})
+	return s.r.Close()
+}
+
+// run writes the events to the stream until the subscriber is closed
+func (s *nodeEventsSub) run(w *io.PipeWriter) {
+	defer w.Close()
+	// a comment is written right away, so that the response starts before
+	// the first event
+	if _, err := io.WriteString(w, ": subscribed to node events\n\n"); err != nil {
+		s.Close()
+		return
+	}
+	for {
+		select {
+		case ev := <-s.ch:
+			if err := writeServerSentEvent(w, ev.Event, ev); err != nil {
+				logrus.Debugf("failed to write node event, closing the subscriber. Error: %v", err)
+				s.Close()
+				return
+			}
+		case <-s.doneCh:
+			return
+		}
+	}
+}
+
+// writeServerSentEvent writes the value as the json data of a server-sent event
+func writeServerSentEvent(w io.Writer, event string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+	return err
+}
+
+func (m *Manager) nodeEventsGet(noop *APIRequest) (io.Reader, error) {
+	if m.nodeEvents == nil {
+		return nil, errored.Errorf("node events are not available")
+	}
+	return m.nodeEvents.subscribe(), nil
+}
+
+// eventStream sets the headers of a server-sent events stream on the response
+func eventStream(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		h(w, r)
+	}
+}
@@ -0,0 +1,145 @@
+// +build unittest
+
+package manager
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/contiv/cluster/management/src/inventory"
+	. "gopkg.in/check.v1"
+)
+
+type nodeEventsSuite struct {
+}
+
+var _ = Suite(&nodeEventsSuite{})
+
+// readServerSentEvent reads the next event from the stream, skipping the comments
+func readServerSentEvent(c *C, r *bufio.Reader) (string, NodeEvent) {
+	var (
+		event string
+		ev    NodeEvent
+	)
+	for {
+		line, err := r.ReadString('\n')
+		c.Assert(err, IsNil)
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			c.Assert(json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &ev), IsNil)
+		case line == "" && event != "":
+			return event, ev
+		}
+	}
+}
+
+func (s *nodeEventsSuite) TestNodeEventKind(c *C) {
+	unallocated := NodeState{Status: inventory.Unallocated.String(), State: inventory.Discovered.String()}
+	provisioning := NodeState{Status: inventory.Provisioning.String(), State: inventory.Discovered.String()}
+	allocated := NodeState{Status: inventory.Allocated.String(), State: inventory.Discovered.String()}
+	decommissioned := NodeState{Status: inventory.Decommissioned.String(), State: inventory.Discovered.String()}
+	disappeared := NodeState{Status: inventory.Allocated.String(), State: inventory.Disappeared.String()}
+	unreachable := allocated
+	unreachable.Reachability = NodeUnreachable
+	reachable := allocated
+	reachable.Reachability = NodeReachable
+
+	for _, test := range []struct {
+		old, cur NodeState
+		exptd    string
+	}{
+		{NodeState{}, unallocated, NodeEventDiscovered},
+		{unallocated, provisioning, NodeEventChanged},
+		{provisioning, allocated, NodeEventCommissioned},
+		{allocated, decommissioned, NodeEventDecommissioned},
+		{allocated, disappeared, NodeEventDisappeared},
+		{disappeared, allocated, NodeEventDiscovered},
+		{reachable, unreachable, NodeEventUnreachable},
+		{unreachable, reachable, NodeEventReachable},
+	} {
+		c.Assert(nodeEventKind(test.old, test.cur), Equals, test.exptd, Commentf("test: %+v", test))
+	}
+}
+
+func (s *nodeEventsSuite) TestPublishStateChange(c *C) {
+	m := &Manager{
+		nodes: map[string]*node{
+			"node1": {Inv: inventory.NewAssetWithState(nil, "node1", inventory.Provisioning, inventory.Discovered)},
+		},
+		nodeEvents: newNodeEventsBroker(),
+	}
+	stream := m.nodeEvents.subscribe()
+	defer stream.Close()
+	r := bufio.NewReader(stream)
+
+	// no event is published if the state doesn't change
+	m.trackNodeState("node1")()
+	publish := m.trackNodeState("node1")
+	m.nodes["node1"].Inv = inventory.NewAssetWithState(nil, "node1", inventory.Allocated, inventory.Discovered)
+	publish()
+
+	event, ev := readServerSentEvent(c, r)
+	c.Assert(event, Equals, NodeEventCommissioned)
+	c.Assert(ev.Node, Equals, "node1")
+	c.Assert(ev.Event, Equals, NodeEventCommissioned)
+	c.Assert(ev.OldState.Status, Equals, inventory.Provisioning.String())
+	c.Assert(ev.NewState.Status, Equals, inventory.Allocated.String())
+	c.Assert(ev.NewState.State, Equals, inventory.Discovered.String())
+}
+
+func (s *nodeEventsSuite) TestSlowSubscriberDoesntBlock(c *C) {
+	b := newNodeEventsBroker()
+	stream := b.subscribe()
+	defer stream.Close()
+
+	// the stream is not read, yet publishing more than the backlog returns
+	doneCh := make(chan struct{})
+	go func() {
+		for i := 0; i < 2*nodeEventsBacklog; i++ {
+			b.publish(NodeEvent{Node: "node1", Event: NodeEventChanged})
+		}
+		close(doneCh)
+	}()
+	select {
+	case <-doneCh:
+	case <-time.After(5 * time.Second):
+		c.Fatalf("publishing to a slow subscriber blocked")
+	}
+}
+
+func (s *nodeEventsSuite) TestDisconnectUnsubscribes(c *C) {
+	m := &Manager{nodeEvents: newNodeEventsBroker()}
+	srvr := httptest.NewServer(eventStream(get(m.nodeEventsGet)))
+	defer srvr.Close()
+
+	clstrC := NewClient(strings.TrimPrefix(srvr.URL, "http://"))
+	stream, err := clstrC.StreamNodeEvents()
+	c.Assert(err, IsNil)
+	line, err := bufio.NewReader(stream).ReadString('\n')
+	c.Assert(err, IsNil)
+	c.Assert(strings.HasPrefix(line, ":"), Equals, true)
+	m.nodeEvents.Lock()
+	c.Assert(m.nodeEvents.subs, HasLen, 1)
+	m.nodeEvents.Unlock()
+
+	// the subscriber is removed once the client goes away
+	c.Assert(stream.Close(), IsNil)
+	for i := 0; ; i++ {
+		m.nodeEvents.Lock()
+		n := len(m.nodeEvents.subs)
+		m.nodeEvents.Unlock()
+		if n == 0 {
+			break
+		}
+		if i > 500 {
+			c.Fatalf("subscriber was not removed on disconnect")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,76 @@
+package manager
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/contiv/cluster/management/src/configuration"
+	"github.com/contiv/errored"
+)
+
+// errExtraVarsNotSupported is the error returned when the effective extra vars
+// of a node are requested but the configuration subsystem can't report them
+func errExtraVarsNotSupported() error {
+	return &apiError{
+		status: http.StatusNotImplemented,
+		code:   ErrCodeNotSupported,
+		err:    errored.Errorf("the configuration subsystem doesn't support reporting the effective extra vars"),
+	}
+}
+
+// NodeExtraVars are the extra vars that the runs on a node receive
+type NodeExtraVars struct {
+	// ExtraVars are the configured, global and request extra vars merged in that
+	// order, the later ones taking precedence. The request extra vars are the ones
+	// of the latest commission or update of the node, if any
+	ExtraVars map[string]interface{} `json:"extra_vars"`
+	// VaultEncrypted is true if some of the extra vars are vault encrypted, in
+	// which case they are not revealed
+	VaultEncrypted bool `json:"vault_encrypted,omitempty"`
+}
+
+// setLastExtraVars records the request extra vars of the latest commission or
+// update of the nodes
+func (m *Manager) setLastExtraVars(nodeNames []string, extraVars string) {
+	m.nodesMutex.Lock()
+	defer m.nodesMutex.Unlock()
+	for _, name := range nodeNames {
+		if node, err := m.findNode(name); err == nil {
+			node.lastExtraVars = extraVars
+		}
+	}
+}
+
+// nodeExtraVarsGet returns the effective extra vars of a node, so that the
+// precedence of the extra vars can be debugged
+func (m *Manager) nodeExtraVarsGet(req *APIRequest) (io.Reader, error) {
+	m.nodesMutex.RLock()
+	defer m.nodesMutex.RUnlock()
+	node, err := m.findNode(req.Nodes[0])
+	if err != nil {
+		return nil, err
+	}
+	merger, ok := m.configuration.(configuration.ExtraVarsMerger)
+	if !ok {
+		return nil, errExtraVarsNotSupported()
+	}
+	extraVars := node.lastExtraVars
+	if extraVars == "" {
+		extraVars = configuration.DefaultValidJSON
+	}
+	vars, vault, err := merger.EffectiveExtraVars(extraVars)
+	if err != nil {
+		return nil, err
+	}
+	nodeVars := NodeExtraVars{ExtraVars: make(map[string]interface{}), VaultEncrypted: vault}
+	if err := json.Unmarshal([]byte(vars), &nodeVars.ExtraVars); err != nil {
+		return nil, err
+	}
+	out, err := json.Marshal(nodeVars)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(out), nil
+}
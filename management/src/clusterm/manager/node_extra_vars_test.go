@@ -0,0 +1,59 @@
+// +build unittest
+
+package manager
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/contiv/cluster/management/src/configuration"
+	. "gopkg.in/check.v1"
+)
+
+type nodeExtraVarsSuite struct {
+}
+
+var _ = Suite(&nodeExtraVarsSuite{})
+
+func (s *nodeExtraVarsSuite) TestNodeExtraVarsGet(c *C) {
+	m := &Manager{
+		nodes: map[string]*node{"node1": {}},
+		configuration: configuration.NewAnsibleSubsys(&configuration.AnsibleSubsysConfig{
+			ExtraVariables: `{"foo":"config","bar":"config"}`,
+		}),
+	}
+	c.Assert(m.configuration.SetGlobals(`{"bar":"globals","baz":"globals"}`), IsNil)
+
+	getVars := func(name string) (*NodeExtraVars, error) {
+		r, err := m.nodeExtraVarsGet(&APIRequest{Nodes: []string{name}})
+		if err != nil {
+			return nil, err
+		}
+		vars := &NodeExtraVars{}
+		c.Assert(json.NewDecoder(r).Decode(vars), IsNil)
+		return vars, nil
+	}
+
+	// without a commission or update, the configured and global vars apply
+	vars, err := getVars("node1")
+	c.Assert(err, IsNil)
+	c.Assert(vars.ExtraVars, DeepEquals, map[string]interface{}{
+		"foo": "config", "bar": "globals", "baz": "globals"})
+
+	// the request vars of the latest run take precedence
+	m.setLastExtraVars([]string{"node1", "node2"}, `{"baz":"request"}`)
+	vars, err = getVars("node1")
+	c.Assert(err, IsNil)
+	c.Assert(vars.ExtraVars, DeepEquals, map[string]interface{}{
+		"foo": "config", "bar": "globals", "baz": "request"})
+	c.Assert(vars.VaultEncrypted, Equals, false)
+
+	_, err = getVars("node2")
+	c.Assert(err, ErrorMatches, nodeNotExistsError("node2").Error())
+
+	// the configuration subsystem may not support reporting the vars
+	m.configuration = &fakeConfigSubsys{}
+	_, err = getVars("node1")
+	c.Assert(err, NotNil)
+	c.Assert(httpStatus(err), Equals, http.StatusNotImplemented)
+}
@@ -0,0 +1,114 @@
+package manager
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// nodeHistoryStore persists the history of the nodes
+type nodeHistoryStore interface {
+	PutNodeHistory(name string, info []byte) error
+	GetAllNodeHistory() (map[string][]byte, error)
+}
+
+// restoreNodeHistory restores the history of the nodes from the node history store
+func (m *Manager) restoreNodeHistory() error {
+	m.nodeHistoryMutex.Lock()
+	defer m.nodeHistoryMutex.Unlock()
+	m.nodeHistory = map[string][]NodeEvent{}
+	if m.nodeHistoryStore == nil {
+		return nil
+	}
+
+	infos, err := m.nodeHistoryStore.GetAllNodeHistory()
+	if err != nil {
+		return err
+	}
+
+	for name, info := range infos {
+		history := []NodeEvent{}
+		if err := json.Unmarshal(info, &history); err != nil {
+			logrus.Errorf("failed to restore history of node %q from %s. Error: %v", name, info, err)
+			continue
+		}
+		m.nodeHistory[name] = history
+	}
+	return nil
+}
+
+// recordNodeEvent appends the event to the node's history. Only the most recent
+// maxNodeHistory events are kept for a node. Persisting the history is best
+// effort and failures are just logged.
+func (m *Manager) recordNodeEvent(ev NodeEvent) {
+	m.nodeHistoryMutex.Lock()
+	defer m.nodeHistoryMutex.Unlock()
+	if m.nodeHistory == nil {
+		m.nodeHistory = map[string][]NodeEvent{}
+	}
+	history := append(m.nodeHistory[ev.Node], ev)
+	if len(history) > maxNodeHistory {
+		history = history[len(history)-maxNodeHistory:]
+	}
+	m.nodeHistory[ev.Node] = history
+
+	if m.nodeHistoryStore == nil {
+		return
+	}
+	info, err := json.Marshal(history)
+	if err != nil {
+		logrus.Errorf("failed to marshal history of node %q for saving. Error: %v", ev.Node, err)
+		return
+	}
+	if err := m.nodeHistoryStore.PutNodeHistory(ev.Node, info); err != nil {
+		logrus.Errorf("failed to save history of node %q. Error: %v", ev.Node, err)
+	}
+}
+
+// recordJobOutcome records the outcome of a finished job in the history of
+// each of it's nodes
+func (m *Manager) recordJobOutcome(j *Job) {
+	for name, status := range j.NodeStatus() {
+		event := NodeEventJobSucceeded
+		if status.isFailed() {
+			event = NodeEventJobFailed
+		}
+		state := m.nodeState(name)
+		m.recordNodeEvent(NodeEvent{
+			Node:     name,
+			Event:    event,
+			OldState: state,
+			NewState: state,
+			JobID:    j.id,
+			Time:     time.Now(),
+		})
+	}
+}
+
+// getNodeHistory returns the history of the node, oldest event first
+func (m *Manager) getNodeHistory(name string) ([]NodeEvent, bool) {
+	m.nodeHistoryMutex.Lock()
+	defer m.nodeHistoryMutex.Unlock()
+	history, ok := m.nodeHistory[name]
+	return append([]NodeEvent{}, history...), ok
+}
+
+func (m *Manager) nodeHistoryGet(req *APIRequest) (io.Reader, error) {
+	m.nodesMutex.RLock()
+	defer m.nodesMutex.RUnlock()
+	name := req.Nodes[0]
+	history, ok := m.getNodeHistory(name)
+	if _, err := m.findNode(name); err != nil && !ok {
+		// the history of a node is kept even after the node goes away
+		return nil, err
+	}
+
+	out, err := json.Marshal(history)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(out), nil
+}
@@ -0,0 +1,98 @@
+// +build unittest
+
+package manager
+
+import (
+	"encoding/json"
+
+	"github.com/contiv/cluster/management/src/inventory"
+	. "gopkg.in/check.v1"
+)
+
+type nodeHistorySuite struct {
+}
+
+var _ = Suite(&nodeHistorySuite{})
+
+// fakeNodeHistoryStore keeps the node history in memory
+type fakeNodeHistoryStore struct {
+	infos map[string][]byte
+}
+
+func (s *fakeNodeHistoryStore) PutNodeHistory(name string, info []byte) error {
+	s.infos[name] = info
+	return nil
+}
+
+func (s *fakeNodeHistoryStore) GetAllNodeHistory() (map[string][]byte, error) {
+	return s.infos, nil
+}
+
+func (s *nodeHistorySuite) TestRecordAndRestore(c *C) {
+	store := &fakeNodeHistoryStore{infos: map[string][]byte{}}
+	m := &Manager{
+		nodes: map[string]*node{
+			"node1": {Inv: inventory.NewAssetWithState(nil, "node1", inventory.Unallocated, inventory.Discovered)},
+		},
+		nodeHistoryStore: store,
+	}
+	c.Assert(m.restoreNodeHistory(), IsNil)
+
+	publish := m.trackNodeState("node1")
+	m.nodes["node1"].Inv = inventory.NewAssetWithState(nil, "node1", inventory.Allocated, inventory.Discovered)
+	publish()
+	j := NewJob("", nil, nil)
+	j.id = 7
+	j.setNodes([]string{"node1"})
+	j.failNode("node1")
+	m.recordJobOutcome(j)
+
+	history, ok := m.getNodeHistory("node1")
+	c.Assert(ok, Equals, true)
+	c.Assert(history, HasLen, 2)
+	c.Assert(history[0].Event, Equals, NodeEventCommissioned)
+	c.Assert(history[1].Event, Equals, NodeEventJobFailed)
+	c.Assert(history[1].JobID, Equals, uint64(7))
+
+	// the history is restored on restart
+	m = &Manager{nodeHistoryStore: store}
+	c.Assert(m.restoreNodeHistory(), IsNil)
+	restored, ok := m.getNodeHistory("node1")
+	c.Assert(ok, Equals, true)
+	c.Assert(restored, HasLen, 2)
+	c.Assert(restored[0].Event, Equals, NodeEventCommissioned)
+	c.Assert(restored[1].Event, Equals, NodeEventJobFailed)
+}
+
+func (s *nodeHistorySuite) TestHistoryIsBounded(c *C) {
+	m := &Manager{}
+	for i := 0; i < maxNodeHistory+10; i++ {
+		m.recordNodeEvent(NodeEvent{Node: "node1", Event: NodeEventChanged, JobID: uint64(i)})
+	}
+	history, _ := m.getNodeHistory("node1")
+	c.Assert(history, HasLen, maxNodeHistory)
+	// the oldest events are dropped
+	c.Assert(history[0].JobID, Equals, uint64(10))
+	c.Assert(history[maxNodeHistory-1].JobID, Equals, uint64(maxNodeHistory+9))
+}
+
+func (s *nodeHistorySuite) TestNodeHistoryGet(c *C) {
+	m := &Manager{nodes: map[string]*node{"node1": {}}}
+	m.recordNodeEvent(NodeEvent{Node: "node2", Event: NodeEventDisappeared})
+
+	// a known node without history has an empty history
+	out, err := m.nodeHistoryGet(&APIRequest{Nodes: []string{"node1"}})
+	c.Assert(err, IsNil)
+	history := []NodeEvent{}
+	c.Assert(json.NewDecoder(out).Decode(&history), IsNil)
+	c.Assert(history, HasLen, 0)
+
+	// the history is kept for a node that went away
+	out, err = m.nodeHistoryGet(&APIRequest{Nodes: []string{"node2"}})
+	c.Assert(err, IsNil)
+	c.Assert(json.NewDecoder(out).Decode(&history), IsNil)
+	c.Assert(history, HasLen, 1)
+
+	_, err = m.nodeHistoryGet(&APIRequest{Nodes: []string{"node3"}})
+	c.Assert(err, NotNil)
+}
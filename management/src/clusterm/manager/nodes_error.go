@@ -0,0 +1,60 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// NodesError is the error returned by a request that acts upon each of it's
+// nodes independently, like a decommission request that continues on error,
+// when it fails for some of the nodes. It reports the outcome for every node.
+type NodesError struct {
+	// Accepted are the nodes that the request's job acts upon
+	Accepted []string `json:"accepted"`
+	// Failed are the reasons the request failed for the rest of the nodes,
+	// keyed by node name
+	Failed map[string]string `json:"failed"`
+	// JobID is the id of the job that acts upon the accepted nodes, if any
+	JobID string `json:"job_id,omitempty"`
+}
+
+// Error returns the nodes that were skipped along with the reasons
+func (e *NodesError) Error() string {
+	names := []string{}
+	for name := range e.Failed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	reasons := []string{}
+	for _, name := range names {
+		reasons = append(reasons, fmt.Sprintf("%s: %s", name, e.Failed[name]))
+	}
+	return fmt.Sprintf("request failed for nodes %v, accepted for nodes %v. Errors: %s",
+		names, e.Accepted, strings.Join(reasons, "; "))
+}
+
+// IsNodesError checks if the error is a NodesError
+func IsNodesError(err error) bool {
+	_, ok := err.(*NodesError)
+	return ok
+}
+
+// writeNodesError writes the http response for a NodesError, the per node
+// outcome is written as json
+func writeNodesError(w http.ResponseWriter, e *NodesError) {
+	out, err := json.Marshal(e)
+	if err != nil {
+		http.Error(w, e.Error(), httpStatus(e))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(httpStatus(e))
+	if _, err := w.Write(out); err != nil {
+		logrus.Errorf("failed to write response bytes '%s'. Error: %v", out, err)
+	}
+}
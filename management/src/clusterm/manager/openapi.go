@@ -0,0 +1,276 @@
+package manager
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"io"
+	"path"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// openAPIVersion is the version of the OpenAPI specification that the spec conforms to
+	openAPIVersion = "3.0.3"
+	// apiVersion is the version of clusterm's REST API
+	apiVersion = "1"
+)
+
+// pathParamRE matches the variables in the url of a route, like '{tag}'
+var pathParamRE = regexp.MustCompile(`{([^}:]+)(:[^}]*)?}`)
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+func (m *Manager) openAPIGet(noop *APIRequest) (io.Reader, error) {
+	spec := newOpenAPISpec(m.apiRoutes())
+	if m.basePath != "" {
+		spec["servers"] = []interface{}{map[string]interface{}{"url": m.basePath}}
+	}
+	out, err := json.Marshal(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	return bytes.NewReader(out), nil
+}
+
+// newOpenAPISpec generates the OpenAPI spec that describes the specified routes.
+// The schemas of the request and responses are generated from the respective
+// types, so the spec stays in sync with the routes that are served.
+func newOpenAPISpec(routes map[string][]apiRoute) map[string]interface{} {
+	g := newSchemaGenerator()
+	paths := map[string]map[string]interface{}{}
+	for method, items := range routes {
+		for _, route := range items {
+			url := pathParamRE.ReplaceAllString(route.url, "{$1}")
+			if _, ok := paths[url]; !ok {
+				paths[url] = map[string]interface{}{}
+			}
+			op := map[string]interface{}{
+				"summary":   route.summary,
+				"responses": g.responses(route.resp),
+			}
+			if params := pathParams(route.url); len(params) > 0 {
+				op["parameters"] = params
+			}
+			if method != "GET" {
+				op["requestBody"] = map[string]interface{}{
+					"content": jsonContent(g.schema(reflect.TypeOf(APIRequest{}))),
+				}
+			}
+			paths[url][strings.ToLower(method)] = op
+		}
+	}
+
+	return map[string]interface{}{
+		"openapi": openAPIVersion,
+		"info": map[string]interface{}{
+			"title":   "clusterm",
+			"version": apiVersion,
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": g.schemas,
+		},
+	}
+}
+
+// pathParams returns the parameters for the variables in the url of a route
+func pathParams(url string) []interface{} {
+	params := []interface{}{}
+	for _, match := range pathParamRE.FindAllStringSubmatch(url, -1) {
+		params = append(params, map[string]interface{}{
+			"name":     match[1],
+			"in":       "path",
+			"required": true,
+			"schema":   map[string]interface{}{"type": "string"},
+		})
+	}
+	return params
+}
+
+func jsonContent(schema interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"application/json": map[string]interface{}{"schema": schema},
+	}
+}
+
+func textContent() map[string]interface{} {
+	return map[string]interface{}{
+		"text/plain": map[string]interface{}{
+			"schema": map[string]interface{}{"type": "string"},
+		},
+	}
+}
+
+// schemaGenerator generates the schemas of the types. The schemas of the named
+// structs are collected as the components of the spec and referred by name
+type schemaGenerator struct {
+	pkgPath string
+	schemas map[string]interface{}
+}
+
+func newSchemaGenerator() *schemaGenerator {
+	return &schemaGenerator{
+		pkgPath: reflect.TypeOf(APIRequest{}).PkgPath(),
+		schemas: map[string]interface{}{},
+	}
+}
+
+// errorContent returns the content of a failed request's response. It's an
+// APIError for the common failures, and plain text otherwise
+func (g *schemaGenerator) errorContent() map[string]interface{} {
+	content := textContent()
+	content["application/json"] = map[string]interface{}{"schema": g.schema(reflect.TypeOf(APIError{}))}
+	return content
+}
+
+// responses returns the responses of a route that responds with a value like resp
+func (g *schemaGenerator) responses(resp interface{}) map[string]interface{} {
+	resps := map[string]interface{}{
+		"default": map[string]interface{}{
+			"description": "The request failed. The common failures are described by a JSON body with the error's code",
+			"content":     g.errorContent(),
+		},
+	}
+	switch resp.(type) {
+	case nil:
+		resps["200"] = map[string]interface{}{"description": "The request succeeded"}
+	case string:
+		resps["200"] = map[string]interface{}{
+			"description": "The request succeeded",
+			"content":     textContent(),
+		}
+	case JobRef:
+		// the job requests respond with '202 Accepted' when they are made
+		// with 'async=true' query parameter
+		resps["200"] = map[string]interface{}{
+			"description": "The job was run",
+			"content":     jsonContent(g.schema(reflect.TypeOf(resp))),
+		}
+		resps["202"] = map[string]interface{}{
+			"description": "The job was accepted",
+			"content":     jsonContent(g.schema(reflect.TypeOf(resp))),
+		}
+	default:
+		resps["200"] = map[string]interface{}{
+			"description": "The request succeeded",
+			"content":     jsonContent(g.schema(reflect.TypeOf(resp))),
+		}
+	}
+	return resps
+}
+
+// schema returns the schema of the values of specified type, as they are
+// encoded in json
+func (g *schemaGenerator) schema(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if s, ok := marshalerSchema(t); ok {
+		return s
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		return g.structRef(t)
+	default:
+		// interfaces can hold any value
+		return map[string]interface{}{}
+	}
+}
+
+// marshalerSchema returns the schema of the values of the types that are
+// encoded as they marshal themselves, like time. It returns false for the rest
+func marshalerSchema(t reflect.Type) (map[string]interface{}, bool) {
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}, true
+	case t.Implements(jsonMarshalerType) || reflect.PtrTo(t).Implements(jsonMarshalerType):
+		// the encoding is up to the type
+		return map[string]interface{}{}, true
+	case t.Implements(textMarshalerType) || reflect.PtrTo(t).Implements(textMarshalerType):
+		return map[string]interface{}{"type": "string"}, true
+	}
+	return nil, false
+}
+
+// structRef returns the reference to the schema of a named struct, that is
+// added to the component schemas once
+func (g *schemaGenerator) structRef(t reflect.Type) map[string]interface{} {
+	name := t.Name()
+	if t.PkgPath() != g.pkgPath {
+		name = path.Base(t.PkgPath()) + "." + name
+	}
+	if _, ok := g.schemas[name]; !ok {
+		// the placeholder stops the recursion for the self referring types
+		g.schemas[name] = map[string]interface{}{}
+		g.schemas[name] = g.structSchema(t)
+	}
+	return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+}
+
+// structSchema returns the schema of a struct's fields
+func (g *schemaGenerator) structSchema(t reflect.Type) map[string]interface{} {
+	props := map[string]interface{}{}
+	g.addFields(t, props)
+	return map[string]interface{}{"type": "object", "properties": props}
+}
+
+// addFields adds the schema of the struct's fields to the properties. The fields
+// of the embedded structs are added as is, like the json encoding does
+func (g *schemaGenerator) addFields(t reflect.Type, props map[string]interface{}) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				g.addFields(ft, props)
+				continue
+			}
+		}
+		if f.PkgPath != "" {
+			// unexported fields are not encoded
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		props[name] = g.schema(f.Type)
+	}
+}
@@ -0,0 +1,61 @@
+// +build unittest
+
+package manager
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+type openAPISuite struct {
+}
+
+var _ = Suite(&openAPISuite{})
+
+func (s *openAPISuite) TestOpenAPISpec(c *C) {
+	m := &Manager{config: DefaultConfig()}
+	r, err := m.openAPIGet(nil)
+	c.Assert(err, IsNil)
+	out, err := ioutil.ReadAll(r)
+	c.Assert(err, IsNil)
+
+	spec := struct {
+		OpenAPI string                                       `json:"openapi"`
+		Paths   map[string]map[string]map[string]interface{} `json:"paths"`
+		Comps   struct {
+			Schemas map[string]map[string]interface{} `json:"schemas"`
+		} `json:"components"`
+	}{}
+	c.Assert(json.Unmarshal(out, &spec), IsNil)
+	c.Assert(spec.OpenAPI, Equals, openAPIVersion)
+
+	// every route is described in the spec
+	for method, routes := range m.apiRoutes() {
+		for _, route := range routes {
+			op, ok := spec.Paths[route.url][strings.ToLower(method)]
+			c.Assert(ok, Equals, true, Commentf("route: %s %s", method, route.url))
+			c.Assert(op["summary"], Equals, route.summary)
+			_, ok = op["requestBody"]
+			c.Assert(ok, Equals, method != "GET", Commentf("route: %s %s", method, route.url))
+		}
+	}
+
+	params := spec.Paths["/"+getNodeInfo]["get"]["parameters"].([]interface{})
+	c.Assert(params, HasLen, 1)
+	c.Assert(params[0].(map[string]interface{})["name"], Equals, "tag")
+
+	// the schemas are generated from the types
+	props := spec.Comps.Schemas["APIRequest"]["properties"].(map[string]interface{})
+	c.Assert(props["nodes"], DeepEquals, map[string]interface{}{
+		"type":  "array",
+		"items": map[string]interface{}{"type": "string"},
+	})
+	c.Assert(props["bundle"], DeepEquals, map[string]interface{}{"$ref": "#/components/schemas/InventoryExport"})
+	_, ok := props["Grep"]
+	c.Assert(ok, Equals, false)
+	_, ok = spec.Comps.Schemas["JobInfo"]
+	c.Assert(ok, Equals, true)
+}
@@ -0,0 +1,87 @@
+package manager
+
+import (
+	"sort"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/contiv/errored"
+)
+
+// errNoMgmtAddress is the preflight error of a node whose management address
+// is not known
+func errNoMgmtAddress() error {
+	return errored.Errorf("management address of the node is not known")
+}
+
+// preflightNodes checks that the nodes' management address can be connected to,
+// like ansible does to configure them. The nodes are probed concurrently and
+// the result is returned keyed by node name. It is NodeReachable for the
+// reachable nodes and the probe's error for the rest
+func (m *Manager) preflightNodes(nodeNames []string) map[string]string {
+	results := map[string]string{}
+	addrs := map[string]string{}
+	m.nodesMutex.RLock()
+	for _, name := range nodeNames {
+		n, ok := m.nodes[name]
+		if !ok || n.Mon == nil || n.Mon.GetMgmtAddress() == "" {
+			results[name] = errNoMgmtAddress().Error()
+			continue
+		}
+		addrs[name] = n.Mon.GetMgmtAddress()
+	}
+	m.nodesMutex.RUnlock()
+
+	for name, err := range probeNodes(addrs, func(addr string) error {
+		return m.probeNode(addr, heartbeatProbeTimeout)
+	}) {
+		if err != nil {
+			results[name] = err.Error()
+			continue
+		}
+		results[name] = NodeReachable
+	}
+	return results
+}
+
+// preflightRequest runs the preflight check of the request's nodes. If some of
+// the nodes are unreachable, the request is failed with a NodesError listing
+// them, unless it continues on error, in which case the unreachable nodes are
+// skipped. It returns the result of the check along with the skipped nodes'
+// errors, keyed by node name
+func (m *Manager) preflightRequest(req *APIRequest) (map[string]string, map[string]string, error) {
+	results := m.preflightNodes(req.Nodes)
+	reachable := []string{}
+	unreachable := map[string]string{}
+	for _, name := range req.Nodes {
+		if results[name] != NodeReachable {
+			unreachable[name] = results[name]
+			continue
+		}
+		reachable = append(reachable, name)
+	}
+	if len(unreachable) == 0 {
+		return results, nil, nil
+	}
+	if !req.ContinueOnError || len(reachable) == 0 {
+		return nil, nil, &NodesError{Accepted: []string{}, Failed: unreachable}
+	}
+	names := []string{}
+	for name := range unreachable {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	logrus.Warnf("skipping the unreachable node(s) %v that failed the preflight check", names)
+	req.Nodes = reachable
+	return results, unreachable, nil
+}
+
+// preflightPassed returns true if all the nodes passed the preflight check, or
+// if the nodes were not checked
+func preflightPassed(preflight map[string]string) bool {
+	for _, result := range preflight {
+		if result != NodeReachable {
+			return false
+		}
+	}
+	return true
+}
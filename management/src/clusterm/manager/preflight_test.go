@@ -0,0 +1,85 @@
+// +build unittest
+
+package manager
+
+import (
+	"errors"
+	"time"
+
+	"github.com/contiv/cluster/management/src/monitor"
+	. "gopkg.in/check.v1"
+)
+
+type preflightSuite struct {
+}
+
+var _ = Suite(&preflightSuite{})
+
+func newPreflightTestManager() *Manager {
+	return &Manager{
+		nodes: map[string]*node{
+			"node1": {Mon: monitor.NewNode("node1", "s1", "1.1.1.1")},
+			"node2": {Mon: monitor.NewNode("node2", "s2", "1.1.1.2")},
+			// the node without a management address is unreachable
+			"node3": {},
+		},
+		probeNode: func(addr string, timeout time.Duration) error {
+			if addr == "1.1.1.2" {
+				return errors.New("connection refused")
+			}
+			return nil
+		},
+	}
+}
+
+func (s *preflightSuite) TestPreflightNodes(c *C) {
+	m := newPreflightTestManager()
+	c.Assert(m.preflightNodes([]string{"node1", "node2", "node3"}), DeepEquals, map[string]string{
+		"node1": NodeReachable,
+		"node2": "connection refused",
+		"node3": errNoMgmtAddress().Error(),
+	})
+}
+
+func (s *preflightSuite) TestPreflightRequest(c *C) {
+	m := newPreflightTestManager()
+
+	req := &APIRequest{Nodes: []string{"node1"}}
+	results, skipped, err := m.preflightRequest(req)
+	c.Assert(err, IsNil)
+	c.Assert(results, DeepEquals, map[string]string{"node1": NodeReachable})
+	c.Assert(skipped, IsNil)
+
+	// the request fails for all the nodes, listing the unreachable ones
+	req = &APIRequest{Nodes: []string{"node1", "node2"}}
+	_, _, err = m.preflightRequest(req)
+	c.Assert(err, DeepEquals, &NodesError{
+		Accepted: []string{},
+		Failed:   map[string]string{"node2": "connection refused"},
+	})
+	c.Assert(httpStatus(err), Equals, 409)
+	c.Assert(req.Nodes, DeepEquals, []string{"node1", "node2"})
+
+	// the unreachable nodes are skipped when continuing on error
+	req = &APIRequest{Nodes: []string{"node1", "node2"}, ContinueOnError: true}
+	results, skipped, err = m.preflightRequest(req)
+	c.Assert(err, IsNil)
+	c.Assert(req.Nodes, DeepEquals, []string{"node1"})
+	c.Assert(skipped, DeepEquals, map[string]string{"node2": "connection refused"})
+	c.Assert(results, HasLen, 2)
+	c.Assert(preflightPassed(results), Equals, false)
+
+	// unless all the nodes are unreachable
+	req = &APIRequest{Nodes: []string{"node2", "node3"}, ContinueOnError: true}
+	_, _, err = m.preflightRequest(req)
+	c.Assert(IsNodesError(err), Equals, true)
+}
+
+func (s *preflightSuite) TestPreflightSummary(c *C) {
+	j := NewJob("test", nil, func(status JobStatus, errRet error) {})
+	j.preflight = map[string]string{"node1": NodeReachable, "node2": "connection refused"}
+	j.status = Complete
+	j.summarize()
+	c.Assert(j.Summary().Preflight, DeepEquals, j.preflight)
+	c.Assert(j.Summary().Passed, Equals, false)
+}
@@ -0,0 +1,108 @@
+package manager
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/contiv/cluster/management/src/monitor"
+	"github.com/contiv/errored"
+)
+
+// initializingRetryAfter is the number of seconds after which a request, that
+// was rejected as clusterm is initializing, may be retried
+const initializingRetryAfter = 10
+
+// errInitializing is the error returned when a request that acts upon the nodes
+// is received before the initial sync of the nodes with the monitoring subsystem
+func errInitializing() error {
+	return errored.Errorf("clusterm is initializing, the nodes are not yet synced with the monitoring subsystem. Please retry in sometime")
+}
+
+// enqueueDiscoveredEvent enqueues the discovered monitor events. The first
+// callback from the monitoring subsystem delivers the nodes that exist at
+// startup. The manager is marked ready only once they are all processed, and
+// is not marked ready if any of them fails, so that the requests don't act
+// upon an incomplete set of nodes.
+func (m *Manager) enqueueDiscoveredEvent(events []monitor.Event) {
+	initial := false
+	m.initialSyncOnce.Do(func() {
+		initial = true
+		if err := m.syncNodes(events); err != nil {
+			logrus.Errorf("initial sync of the nodes failed, clusterm is not ready. Error: %v", err)
+			return
+		}
+		logrus.Infof("initial sync of the nodes is complete, clusterm is ready")
+		close(m.readyCh)
+	})
+	if !initial {
+		m.enqueueMonitorEvent(events)
+	}
+}
+
+// syncNodes queues the discovered events of the nodes and waits for them to be
+// processed. Unlike enqueueMonitorEvent, the events are queued directly instead
+// of being posted to the api, so that their outcome is known. It returns the
+// first error that the events failed with, if any
+func (m *Manager) syncNodes(events []monitor.Event) error {
+	wes := []*waitableEvent{}
+	var err error
+	for _, e := range events {
+		node, nerr := normalizeMonitorNode(MonitorNode{
+			Label:    e.Node.GetLabel(),
+			Serial:   e.Node.GetSerial(),
+			MgmtAddr: e.Node.GetMgmtAddress(),
+			Tags:     e.Node.GetTags(),
+		})
+		if nerr != nil {
+			err = nerr
+			break
+		}
+		we := newWaitableEvent(newDiscoveredEvent(m, []monitor.SubsysNode{
+			monitor.NewNodeWithTags(node.Label, node.Serial, node.MgmtAddr, node.Tags)}))
+		if err = m.queueMonitorEvent(we); err != nil {
+			break
+		}
+		wes = append(wes, we)
+	}
+	// the events that were queued are waited upon even after a failure
+	for _, we := range wes {
+		if werr := we.waitForCompletion(); werr != nil && err == nil {
+			err = werr
+		}
+	}
+	return err
+}
+
+// isReady returns true once the manager has completed the initial sync of the
+// nodes with the monitoring subsystem. Note that the api being served doesn't
+// imply that the manager is ready.
+func (m *Manager) isReady() bool {
+	select {
+	case <-m.readyCh:
+		return true
+	default:
+		return false
+	}
+}
+
+// whenReady rejects the requests with a '503 Service Unavailable' response
+// until the manager is ready, so that the requests don't act upon an
+// incomplete set of nodes
+func (m *Manager) whenReady(hdlr http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !m.isReady() {
+			writeError(w, errServiceUnavailable(errInitializing(), initializingRetryAfter))
+			return
+		}
+		hdlr(w, r)
+	}
+}
+
+func (m *Manager) readyzGet(noop *APIRequest) (io.Reader, error) {
+	if !m.isReady() {
+		return nil, errServiceUnavailable(errInitializing(), initializingRetryAfter)
+	}
+	return bytes.NewReader([]byte("ok")), nil
+}
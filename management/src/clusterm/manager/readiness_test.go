@@ -0,0 +1,99 @@
+// +build unittest
+
+package manager
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+
+	"github.com/contiv/cluster/management/src/inventory"
+	"github.com/contiv/cluster/management/src/monitor"
+	. "gopkg.in/check.v1"
+)
+
+type readinessSuite struct {
+}
+
+var _ = Suite(&readinessSuite{})
+
+func (s *readinessSuite) TestWhenReady(c *C) {
+	m := &Manager{
+		reqQ:    make(chan event, 2),
+		readyCh: make(chan struct{}),
+	}
+	called := 0
+	hdlr := m.whenReady(func(w http.ResponseWriter, r *http.Request) {
+		called++
+	})
+	r, err := http.NewRequest("POST", "/"+PostNodesCommission, strings.NewReader("{}"))
+	c.Assert(err, IsNil)
+
+	w := httptest.NewRecorder()
+	hdlr(w, r)
+	c.Assert(w.Code, Equals, http.StatusServiceUnavailable)
+	c.Assert(w.Header().Get("Retry-After"), Equals, strconv.Itoa(initializingRetryAfter))
+	c.Assert(decodeAPIError(c, w), DeepEquals, APIError{Code: ErrCodeServiceUnavailable,
+		Message: errInitializing().Error()})
+	c.Assert(called, Equals, 0)
+	_, err = m.readyzGet(&APIRequest{})
+	c.Assert(httpStatus(err), Equals, http.StatusServiceUnavailable)
+
+	// the initial sync is marked only once, after the first discovered callback
+	m.enqueueDiscoveredEvent([]monitor.Event{})
+	m.enqueueDiscoveredEvent([]monitor.Event{})
+	c.Assert(m.reqQ, HasLen, 0)
+
+	w = httptest.NewRecorder()
+	hdlr(w, r)
+	c.Assert(called, Equals, 1)
+	_, err = m.readyzGet(&APIRequest{})
+	c.Assert(err, IsNil)
+}
+
+// addAssetInventory adds the assets, except the one it is set to fail to add
+type addAssetInventory struct {
+	inventory.Subsys
+	failName string
+}
+
+func (i *addAssetInventory) AddAsset(name string) error {
+	if name == i.failName {
+		return fmt.Errorf("test failure")
+	}
+	return nil
+}
+
+func (i *addAssetInventory) GetAsset(name string) inventory.SubsysAsset {
+	return nil
+}
+
+func (s *readinessSuite) TestReadyAfterInitialSync(c *C) {
+	events := []monitor.Event{
+		{Type: monitor.Discovered, Node: monitor.NewNode("node1", "s1", "1.1.1.1")},
+		{Type: monitor.Discovered, Node: monitor.NewNode("node2", "s2", "1.1.1.2")},
+	}
+
+	// the manager is ready once the startup nodes are processed
+	m := newJobWorkersTestManager(&gatedConfigSubsys{}, &addAssetInventory{}, 2)
+	m.readyCh = make(chan struct{})
+	m.enqueueDiscoveredEvent(events)
+	c.Assert(m.isReady(), Equals, true)
+	m.nodesMutex.RLock()
+	c.Assert(m.nodes, HasLen, 2)
+	m.nodesMutex.RUnlock()
+
+	// the manager is not ready if a startup node fails to be processed
+	m = newJobWorkersTestManager(&gatedConfigSubsys{}, &addAssetInventory{failName: "node2-s2"}, 2)
+	m.readyCh = make(chan struct{})
+	m.enqueueDiscoveredEvent(events)
+	c.Assert(m.isReady(), Equals, false)
+
+	// the manager is not ready if a startup node can't be queued
+	m = &Manager{config: DefaultConfig(), reqQ: make(chan event), readyCh: make(chan struct{})}
+	m.config.Manager.MonitorEnqueueTimeout = "10ms"
+	m.enqueueDiscoveredEvent(events)
+	c.Assert(m.isReady(), Equals, false)
+}
@@ -0,0 +1,149 @@
+package manager
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/contiv/cluster/management/src/configuration"
+	"github.com/contiv/errored"
+)
+
+func errNodesNotRejoined(nodeNames []string, timeout time.Duration) error {
+	return errored.Errorf("nodes %v didn't rejoin the cluster within %s of reboot", nodeNames, timeout)
+}
+
+// rebootEvent triggers the reboot workflow
+type rebootEvent struct {
+	jobTrigger
+	mgr       *Manager
+	nodeNames []string
+	extraVars string
+	playbook  string
+	timeout   time.Duration // the job is cancelled if it runs longer than this
+	// waitRejoin, when true, makes the job wait for the rebooted nodes to be
+	// discovered again, upto the rejoin timeout
+	waitRejoin    bool
+	rejoinTimeout time.Duration
+
+	_hosts  configuration.SubsysHosts
+	_enodes map[string]*node
+}
+
+// newRebootEvent creates and returns rebootEvent
+func newRebootEvent(mgr *Manager, nodeNames []string, extraVars, playbook string, waitRejoin bool,
+	rejoinTimeout, timeout time.Duration) *rebootEvent {
+	return &rebootEvent{
+		mgr:           mgr,
+		nodeNames:     nodeNames,
+		extraVars:     extraVars,
+		playbook:      playbook,
+		timeout:       timeout,
+		waitRejoin:    waitRejoin,
+		rejoinTimeout: rejoinTimeout,
+	}
+}
+
+func (e *rebootEvent) String() string {
+	return fmt.Sprintf("rebootEvent: nodes:%v extra-vars: %v playbook: %q wait-rejoin: %v",
+		e.nodeNames, configuration.RedactExtraVars(e.extraVars), e.playbook, e.waitRejoin)
+}
+
+func (e *rebootEvent) process() error {
+	// err shouldn't be redefined below
+	var (
+		err error
+		job *Job
+	)
+
+	job, err = e.checkAndSetActiveJob(
+		e.mgr,
+		e.String(),
+		e.nodeNames,
+		e.timeout,
+		e.rebootRunner,
+		func(status JobStatus, errRet error) {
+			if status == Errored {
+				logrus.Errorf("reboot job failed. Error: %v", errRet)
+			}
+		})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			e.mgr.resetActiveJob(job)
+		}
+	}()
+	e.setPlaybook(e.mgr, configuration.ActionRunPlaybook, e.playbook)
+
+	// the job can be retried on the subset of nodes that fail
+	job.retryEvent = func(nodeNames []string, timeout time.Duration) jobEvent {
+		return newRebootEvent(e.mgr, nodeNames, e.extraVars, e.playbook, e.waitRejoin,
+			e.rejoinTimeout, timeout)
+	}
+
+	// validate event data
+	if e._enodes, err = e.mgr.commonEventValidate(e.nodeNames); err != nil {
+		return err
+	}
+
+	// prepare inventory
+	hosts := []*configuration.AnsibleHost{}
+	for _, node := range e._enodes {
+		hosts = append(hosts, node.Cfg.(*configuration.AnsibleHost))
+	}
+	e._hosts = hosts
+
+	// trigger node reboot
+	go e.mgr.runActiveJob(job)
+
+	return nil
+}
+
+// jobNodes returns the nodes the triggered job acts upon
+func (e *rebootEvent) jobNodes() ([]string, bool) {
+	return e.nodeNames, false
+}
+
+// rebootRunner is the job runner that runs the reboot playbook on one or more
+// nodes and, if requested, waits for them to rejoin the cluster
+func (e *rebootEvent) rebootRunner(cancelCh CancelChannel, jobLogs io.Writer) error {
+	rebootedAt := time.Now()
+	outReader, cancelFunc, errCh := e.subsys(e.mgr).RunPlaybook(e._hosts, e.playbook, e.extraVars)
+	if err := logOutputAndReturnStatus(outReader, errCh, cancelCh, cancelFunc, jobLogs); err != nil {
+		return err
+	}
+	if !e.waitRejoin {
+		return nil
+	}
+
+	fmt.Fprintf(jobLogs, "==> waiting upto %s for nodes %v to rejoin the cluster\n", e.rejoinTimeout, e.nodeNames)
+	pending, err := waitForNodes(cancelCh, jobLogs, e.rejoinTimeout,
+		func() []string { return e.pendingRejoin(rebootedAt) })
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		return errNodesNotRejoined(pending, e.rejoinTimeout)
+	}
+	fmt.Fprintf(jobLogs, "==> all nodes rejoined the cluster\n")
+	return nil
+}
+
+// pendingRejoin returns the sorted names of the nodes that have not been
+// discovered since the specified time
+func (e *rebootEvent) pendingRejoin(since time.Time) []string {
+	e.mgr.nodesMutex.RLock()
+	defer e.mgr.nodesMutex.RUnlock()
+	pending := []string{}
+	for name, node := range e._enodes {
+		if !node.discoveredAt.After(since) {
+			pending = append(pending, name)
+		}
+	}
+	sort.Strings(pending)
+	return pending
+}
@@ -0,0 +1,81 @@
+// +build unittest
+
+package manager
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/contiv/cluster/management/src/ansible"
+	. "gopkg.in/check.v1"
+)
+
+type rebootSuite struct {
+}
+
+var _ = Suite(&rebootSuite{})
+
+func newTestRebootEvent(cfg *fakeConfigSubsys, waitRejoin bool, rejoinTimeout time.Duration) *rebootEvent {
+	e := newRebootEvent(&Manager{configuration: cfg}, []string{"node1", "node2"}, "", "reboot.yml",
+		waitRejoin, rejoinTimeout, 0)
+	e._enodes = map[string]*node{"node1": {}, "node2": {}}
+	return e
+}
+
+func (s *rebootSuite) TestReboot(c *C) {
+	cfg := &fakeConfigSubsys{}
+	e := newTestRebootEvent(cfg, false, time.Millisecond)
+	var logs bytes.Buffer
+	c.Assert(e.rebootRunner(make(CancelChannel), &logs), IsNil)
+	c.Assert(cfg.ran, DeepEquals, []string{"reboot.yml"})
+}
+
+func (s *rebootSuite) TestRebootWaitRejoin(c *C) {
+	defer func(interval time.Duration) { rejoinPollInterval = interval }(rejoinPollInterval)
+	rejoinPollInterval = time.Millisecond
+
+	e := newTestRebootEvent(&fakeConfigSubsys{}, true, time.Minute)
+	// the nodes rejoin once rebooted
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		e.mgr.nodesMutex.Lock()
+		defer e.mgr.nodesMutex.Unlock()
+		for _, n := range e._enodes {
+			n.discoveredAt = time.Now()
+		}
+	}()
+	var logs bytes.Buffer
+	c.Assert(e.rebootRunner(make(CancelChannel), &logs), IsNil)
+}
+
+func (s *rebootSuite) TestRebootRejoinTimeout(c *C) {
+	defer func(interval time.Duration) { rejoinPollInterval = interval }(rejoinPollInterval)
+	rejoinPollInterval = time.Millisecond
+
+	e := newTestRebootEvent(&fakeConfigSubsys{}, true, 20*time.Millisecond)
+	// node1 was discovered before the reboot and it doesn't rejoin
+	e._enodes["node1"].discoveredAt = time.Now()
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		e.mgr.nodesMutex.Lock()
+		defer e.mgr.nodesMutex.Unlock()
+		e._enodes["node2"].discoveredAt = time.Now()
+	}()
+	var logs bytes.Buffer
+	err := e.rebootRunner(make(CancelChannel), &logs)
+	c.Assert(err, NotNil)
+	c.Assert(err.Error(), Equals, errNodesNotRejoined([]string{"node1"}, 20*time.Millisecond).Error())
+
+	// the node that didn't rejoin is failed in the recap
+	recap, err := ansible.ParseRecap(&logs)
+	c.Assert(err, IsNil)
+	c.Assert(recap.FailedHosts(), DeepEquals, []string{"node1"})
+}
+
+func (s *rebootSuite) TestRebootRejoinCancel(c *C) {
+	e := newTestRebootEvent(&fakeConfigSubsys{}, true, time.Minute)
+	cancelCh := make(CancelChannel, 1)
+	cancelCh <- struct{}{}
+	var logs bytes.Buffer
+	c.Assert(e.rebootRunner(cancelCh, &logs), Equals, errJobCancelled)
+}
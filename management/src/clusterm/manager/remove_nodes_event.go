@@ -0,0 +1,82 @@
+package manager
+
+import (
+	"fmt"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/contiv/cluster/management/src/inventory"
+	"github.com/contiv/errored"
+)
+
+func errNodeNotDecommissioned(name string, status inventory.AssetStatus) error {
+	return errored.Errorf("node %q is not decommissioned, it's status is %q", name, status)
+}
+
+// removeNodesEvent removes the decommissioned nodes from the manager and the
+// inventory, along with their annotations and labels. The nodes are known afresh if they
+// are discovered again, like after being re-imaged
+type removeNodesEvent struct {
+	mgr       *Manager
+	nodeNames []string
+}
+
+// newRemoveNodesEvent creates and returns removeNodesEvent
+func newRemoveNodesEvent(mgr *Manager, nodeNames []string) *removeNodesEvent {
+	return &removeNodesEvent{
+		mgr:       mgr,
+		nodeNames: nodeNames,
+	}
+}
+
+func (e *removeNodesEvent) String() string {
+	return fmt.Sprintf("removeNodesEvent: nodes: %v", e.nodeNames)
+}
+
+func (e *removeNodesEvent) process() error {
+	for _, name := range e.nodeNames {
+		if err := e.removeNode(name); err != nil {
+			logrus.Errorf("failed to remove node %q. Error: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// removeNode removes a node, as long as it is still decommissioned
+func (e *removeNodesEvent) removeNode(name string) error {
+	node, err := e.mgr.findNode(name)
+	if err != nil {
+		return err
+	}
+	if node.Inv != nil {
+		if status, _ := node.Inv.GetStatus(); status != inventory.Decommissioned {
+			return errNodeNotDecommissioned(name, status)
+		}
+	}
+	defer e.mgr.trackNodeState(name)()
+
+	if err := e.mgr.inventory.RemoveAsset(name); err != nil {
+		return err
+	}
+	if e.mgr.annotationStore != nil {
+		if err := e.mgr.annotationStore.DeleteAnnotations(name); err != nil {
+			logrus.Errorf("failed to delete annotations of node %q. Error: %v", name, err)
+		}
+	}
+	delete(e.mgr.annotations, name)
+	if e.mgr.maintenanceStore != nil && e.mgr.maintenance[name] {
+		if err := e.mgr.maintenanceStore.DeleteMaintenance(name); err != nil {
+			logrus.Errorf("failed to delete maintenance of node %q. Error: %v", name, err)
+		}
+	}
+	delete(e.mgr.maintenance, name)
+	if e.mgr.labelStore != nil && len(e.mgr.labels[name]) > 0 {
+		if err := e.mgr.labelStore.DeleteLabels(name); err != nil {
+			logrus.Errorf("failed to delete labels of node %q. Error: %v", name, err)
+		}
+	}
+	delete(e.mgr.labels, name)
+	e.mgr.nodesMutex.Lock()
+	defer e.mgr.nodesMutex.Unlock()
+	delete(e.mgr.nodes, name)
+	return nil
+}
@@ -0,0 +1,77 @@
+// +build unittest
+
+package manager
+
+import (
+	"github.com/contiv/cluster/management/src/ansible"
+	"github.com/contiv/cluster/management/src/inventory"
+	"github.com/contiv/cluster/management/src/mock"
+	"github.com/golang/mock/gomock"
+	. "gopkg.in/check.v1"
+)
+
+type removeNodesSuite struct {
+}
+
+var _ = Suite(&removeNodesSuite{})
+
+func (s *removeNodesSuite) TestRemoveNodes(c *C) {
+	ctrl := gomock.NewController(c)
+	defer ctrl.Finish()
+
+	mClient := mock.NewMockSubsysClient(ctrl)
+	inv := inventory.NewGeneralSubsys(mClient)
+	m := &Manager{
+		inventory:   inv,
+		nodes:       map[string]*node{},
+		annotations: map[string]map[string]string{"node1": {"owner": "foo"}},
+	}
+	for name, status := range map[string]inventory.AssetStatus{
+		"node1": inventory.Decommissioned,
+		"node2": inventory.Allocated,
+	} {
+		a := inventory.NewAssetWithState(mClient, name, status, inventory.Discovered)
+		c.Assert(inv.RestoreAsset(name, a), IsNil)
+		m.nodes[name] = &node{Inv: a}
+	}
+
+	// only the decommissioned node is removed
+	mClient.EXPECT().DeleteAsset("node1")
+	c.Assert(newRemoveNodesEvent(m, []string{"node1", "node2", "node3"}).process(), IsNil)
+	c.Assert(m.nodes["node1"], IsNil)
+	c.Assert(inv.GetAsset("node1"), IsNil)
+	c.Assert(m.annotations["node1"], IsNil)
+	c.Assert(m.nodes["node2"], NotNil)
+	c.Assert(inv.GetAsset("node2"), NotNil)
+
+	// the removal is recorded in the node's history
+	history := m.nodeHistory["node1"]
+	c.Assert(history, HasLen, 1)
+	c.Assert(history[0].Event, Equals, NodeEventRemoved)
+}
+
+func (s *removeNodesSuite) TestDecommissionAndRemove(c *C) {
+	m := &Manager{reqQ: make(chan event, 1)}
+	e := newDecommissionEvent(m, []string{"node1", "node2"}, "", "", 0, 0)
+	e._names = e.nodeNames
+	e.job = NewJob("", nil, nil)
+
+	// the nodes are kept as decommissioned by default
+	e.removeDecommissionedNodes()
+	c.Assert(m.reqQ, HasLen, 0)
+
+	e.remove = true
+	e.removeDecommissionedNodes()
+	c.Assert(m.reqQ, HasLen, 1)
+	c.Assert((<-m.reqQ).(*removeNodesEvent).nodeNames, DeepEquals, []string{"node1", "node2"})
+
+	// the nodes that failed the cleanup are not removed when continuing on error
+	e.continueOnError = true
+	e.job.setNodes(e._names)
+	e.job.updateNodeStatus("node1", ansible.TaskOk)
+	e.job.updateNodeStatus("node2", ansible.TaskFailed)
+	e.job.setStatus(Complete, nil)
+	e.job.summarize()
+	e.removeDecommissionedNodes()
+	c.Assert((<-m.reqQ).(*removeNodesEvent).nodeNames, DeepEquals, []string{"node1"})
+}
@@ -0,0 +1,162 @@
+package manager
+
+import (
+	"sort"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/contiv/errored"
+)
+
+// scheduledJob is a job event that is held back until it's scheduled time
+type scheduledJob struct {
+	event   jobEvent
+	pending *Job
+	timer   *time.Timer
+}
+
+// errInvalidRunAt is the error returned when an invalid schedule is specified
+// as part of a request
+func errInvalidRunAt(runAt string) error {
+	return errored.Errorf("Invalid run_at specified: %q. Expected a RFC3339 time in the future like 2016-01-02T15:04:05Z", runAt)
+}
+
+// errRunAtAndDelay is the error returned when both run_at and delay are
+// specified as part of a request
+func errRunAtAndDelay() error {
+	return errored.Errorf("only one of run_at and delay can be specified")
+}
+
+// errJobNotCancellable is the error returned when the job to be cancelled is
+// neither a scheduled job that is yet to run nor a running job
+func errJobNotCancellable(label string) error {
+	return errored.Errorf("job %q is neither a scheduled job that is yet to run nor a running job", label)
+}
+
+// requestRunAt returns the time at which the job triggered by the request is
+// scheduled to run. It is zero if the job shall run immediately.
+func requestRunAt(req *APIRequest) (time.Time, error) {
+	switch {
+	case req.RunAt != "" && req.Delay != "":
+		return time.Time{}, errBadRequest(errRunAtAndDelay())
+	case req.RunAt != "":
+		runAt, err := time.Parse(time.RFC3339, req.RunAt)
+		if err != nil || !runAt.After(time.Now()) {
+			return time.Time{}, errBadRequest(errInvalidRunAt(req.RunAt))
+		}
+		return runAt, nil
+	case req.Delay != "":
+		delay, err := parseTimeout(req.Delay)
+		if err != nil {
+			return time.Time{}, errBadRequest(err)
+		}
+		return time.Now().Add(delay), nil
+	}
+	return time.Time{}, nil
+}
+
+// scheduleJobEvent holds the event that triggers a job until the specified
+// time, when it is enqueued for processing. The scheduled requests are always
+// async, a placeholder job is returned with the id that the triggered job
+// will have. The scheduled jobs don't survive clusterm restarts, they are
+// recorded as interrupted instead.
+func (m *Manager) scheduleJobEvent(req *APIRequest, e jobEvent, runAt time.Time) (*Job, error) {
+	forks, err := requestForks(req)
+	if err != nil {
+		return nil, err
+	}
+	e.setForks(forks)
+	sshUser, sshKeyRef, err := m.requestConnection(req)
+	if err != nil {
+		return nil, err
+	}
+	e.setConnection(sshUser, sshKeyRef)
+
+	pending, reserved := m.newPendingJob(e.String(), req.IdempotencyKey, func(j *Job) {
+		j.status = Scheduled
+		j.runAt = runAt
+	})
+	if !reserved {
+		logrus.Infof("request with idempotency key %q was already processed. Job: %s", req.IdempotencyKey, pending)
+		return pending, nil
+	}
+	req.Async = true
+	e.setScheduled()
+	e.setIdempotencyKey(req.IdempotencyKey)
+	e.setJobID(pending.id)
+
+	m.jobsMutex.Lock()
+	if m.scheduledJobs == nil {
+		m.scheduledJobs = make(map[uint64]*scheduledJob)
+	}
+	m.scheduledJobs[pending.id] = &scheduledJob{
+		event:   e,
+		pending: pending,
+		timer:   time.AfterFunc(runAt.Sub(time.Now()), func() { m.runScheduledJob(pending.id) }),
+	}
+	m.jobsMutex.Unlock()
+	m.saveJob(pending)
+
+	logrus.Infof("scheduled job %d to run at %s: %s", pending.id, runAt, e)
+	return pending, nil
+}
+
+// runScheduledJob enqueues the event of a scheduled job that is due
+func (m *Manager) runScheduledJob(id uint64) {
+	m.jobsMutex.Lock()
+	sj, ok := m.scheduledJobs[id]
+	delete(m.scheduledJobs, id)
+	m.jobsMutex.Unlock()
+	if !ok {
+		// the job was cancelled
+		return
+	}
+
+	now := time.Now()
+	sj.event.setQueuedAt(now)
+	sj.pending.Lock()
+	sj.pending.status = Queued
+	sj.pending.queuedAt = now
+	sj.pending.Unlock()
+	if err := m.enqueue(&asyncJobEvent{jobEvent: sj.event, mgr: m, pending: sj.pending}); err != nil {
+		logrus.Errorf("failed to enqueue scheduled job %d. Error: %v", id, err)
+		m.resolvePendingJob(sj.pending, nil, err)
+	}
+}
+
+// cancelScheduledJob cancels a scheduled job that is yet to run. The cancelled
+// job is recorded in the job history.
+func (m *Manager) cancelScheduledJob(id uint64) bool {
+	m.jobsMutex.Lock()
+	sj, ok := m.scheduledJobs[id]
+	if ok {
+		sj.timer.Stop()
+		delete(m.scheduledJobs, id)
+	}
+	m.jobsMutex.Unlock()
+	if !ok {
+		return false
+	}
+
+	m.resolvePendingJob(sj.pending, nil, errJobCancelled)
+	return true
+}
+
+// getScheduledJobs returns the scheduled jobs that are yet to run, the ones
+// scheduled to run earliest first
+func (m *Manager) getScheduledJobs() []*Job {
+	m.jobsMutex.Lock()
+	defer m.jobsMutex.Unlock()
+	jobs := make([]*Job, 0, len(m.scheduledJobs))
+	for _, sj := range m.scheduledJobs {
+		jobs = append(jobs, sj.pending)
+	}
+	sort.Sort(byJobRunAt(jobs))
+	return jobs
+}
+
+type byJobRunAt []*Job
+
+func (s byJobRunAt) Len() int           { return len(s) }
+func (s byJobRunAt) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byJobRunAt) Less(i, j int) bool { return s[i].runAt.Before(s[j].runAt) }
@@ -0,0 +1,117 @@
+// +build unittest
+
+package manager
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type scheduledJobsSuite struct {
+}
+
+var _ = Suite(&scheduledJobsSuite{})
+
+func newScheduledJobsTestManager() *Manager {
+	return &Manager{
+		config:     DefaultConfig(),
+		reqQ:       make(chan event, 1),
+		nodes:      map[string]*node{"node1": {}},
+		activeJobs: map[uint64]*Job{},
+	}
+}
+
+func (s *scheduledJobsSuite) postUpdate(c *C, m *Manager, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("POST", "/"+PostNodesUpdate, strings.NewReader(body))
+	c.Assert(err, IsNil)
+	postJob(m.nodesUpdate)(w, r)
+	return w
+}
+
+func (s *scheduledJobsSuite) getJobs(c *C, m *Manager, state string) []JobInfo {
+	out, err := m.jobsGet(&APIRequest{State: state})
+	c.Assert(err, IsNil)
+	body, err := ioutil.ReadAll(out)
+	c.Assert(err, IsNil)
+	jobs := []JobInfo{}
+	c.Assert(json.Unmarshal(body, &jobs), IsNil)
+	return jobs
+}
+
+func (s *scheduledJobsSuite) TestScheduleAndCancel(c *C) {
+	m := newScheduledJobsTestManager()
+
+	w := s.postUpdate(c, m, `{"nodes":["node1"],"delay":"1h"}`)
+	c.Assert(w.Code, Equals, http.StatusAccepted)
+	ref := JobRef{}
+	c.Assert(json.Unmarshal(w.Body.Bytes(), &ref), IsNil)
+	c.Assert(ref.ID, Equals, "1")
+	// the event is held back
+	c.Assert(m.reqQ, HasLen, 0)
+
+	jobs := s.getJobs(c, m, "scheduled")
+	c.Assert(jobs, HasLen, 1)
+	c.Assert(jobs[0].Status, Equals, Scheduled.String())
+	c.Assert(jobs[0].RunAt, NotNil)
+	c.Assert(s.getJobs(c, m, "running"), HasLen, 0)
+
+	c.Assert(m.jobCancel(&APIRequest{Job: ref.ID}), IsNil)
+	c.Assert(s.getJobs(c, m, "scheduled"), HasLen, 0)
+	j, err := m.findJob(ref.ID)
+	c.Assert(err, IsNil)
+	status, errVal := j.Status()
+	c.Assert(status, Equals, Errored)
+	c.Assert(errVal, Equals, errJobCancelled)
+
+	// a job that is not scheduled can't be cancelled
+	err = m.jobCancel(&APIRequest{Job: ref.ID})
+	c.Assert(err, NotNil)
+	c.Assert(httpStatus(err), Equals, http.StatusBadRequest)
+}
+
+func (s *scheduledJobsSuite) TestScheduledJobRuns(c *C) {
+	m := newScheduledJobsTestManager()
+
+	w := s.postUpdate(c, m, `{"nodes":["node1"],"delay":"10ms"}`)
+	c.Assert(w.Code, Equals, http.StatusAccepted)
+
+	select {
+	case e := <-m.reqQ:
+		_, ok := e.(*asyncJobEvent)
+		c.Assert(ok, Equals, true)
+	case <-time.After(5 * time.Second):
+		c.Fatalf("scheduled job was not enqueued")
+	}
+	c.Assert(s.getJobs(c, m, "scheduled"), HasLen, 0)
+	j, err := m.findJob("1")
+	c.Assert(err, IsNil)
+	status, _ := j.Status()
+	c.Assert(status, Equals, Queued)
+}
+
+func (s *scheduledJobsSuite) TestScheduleErrors(c *C) {
+	m := newScheduledJobsTestManager()
+	past := time.Now().Add(-time.Hour).Format(time.RFC3339)
+	tests := map[string]string{
+		"run-at-and-delay": `{"nodes":["node1"],"delay":"1h","run_at":"2099-01-02T15:04:05Z"}`,
+		"run-at-in-past":   `{"nodes":["node1"],"run_at":"` + past + `"}`,
+		"invalid-run-at":   `{"nodes":["node1"],"run_at":"tomorrow"}`,
+		"invalid-delay":    `{"nodes":["node1"],"delay":"-1h"}`,
+	}
+	for key, body := range tests {
+		w := s.postUpdate(c, m, body)
+		c.Assert(w.Code, Equals, http.StatusBadRequest, Commentf("key: %s", key))
+	}
+	c.Assert(s.getJobs(c, m, "scheduled"), HasLen, 0)
+
+	_, err := m.jobsGet(&APIRequest{State: "foo"})
+	c.Assert(err, NotNil)
+	c.Assert(httpStatus(err), Equals, http.StatusBadRequest)
+}
@@ -0,0 +1,133 @@
+package manager
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/contiv/errored"
+)
+
+// errSelectorAndNodes is the error returned when a request specifies both the
+// node names and a node selector
+func errSelectorAndNodes() error {
+	return errored.Errorf("Both nodes and selector specified, only one of them is expected")
+}
+
+// errNoNodesSelected is the error returned when a node selector doesn't
+// select any of the known nodes
+func errNoNodesSelected(selector string) error {
+	return errored.Errorf("No nodes match the selector %q", selector)
+}
+
+// errNoSelector is the error returned when a selector resolution request
+// doesn't specify the selector
+func errNoSelector() error {
+	return errored.Errorf("no selector specified")
+}
+
+// SelectorResolution is the outcome of resolving a node selector, without
+// acting upon the selected nodes
+type SelectorResolution struct {
+	Selector string `json:"selector"`
+	// Nodes are the names of the nodes that the selector selects, in order
+	Nodes []string `json:"nodes"`
+	// Maintenance are the names of the nodes that match the selector, but are
+	// not selected as they are in maintenance
+	Maintenance []string `json:"maintenance,omitempty"`
+}
+
+// parseSelector parses a node selector of form 'key1=value1,key2=value2'
+func parseSelector(selector string) (map[string]string, error) {
+	return parseTagFilters(parseListValues([]string{selector}))
+}
+
+// matchesSelector returns true if the node has a tag, a label or an annotation
+// with the value specified in the selector, for each of the selector's keys
+func (n *node) matchesSelector(selector map[string]string) bool {
+	for k, v := range selector {
+		if val, ok := n.Tags[k]; ok && val == v {
+			continue
+		}
+		if val, ok := n.Labels[k]; ok && val == v {
+			continue
+		}
+		if val, ok := n.Annotations[k]; ok && val == v {
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+// resolveRequestSelector sets the nodes of a request, that specifies a node
+// selector instead of the node names, to the known nodes that match the selector.
+// The nodes in maintenance are not selected
+func (m *Manager) resolveRequestSelector(req *APIRequest) error {
+	m.nodesMutex.RLock()
+	defer m.nodesMutex.RUnlock()
+	if strings.TrimSpace(req.Selector) == "" {
+		return nil
+	}
+	if len(req.Nodes) > 0 {
+		return errBadRequest(errSelectorAndNodes())
+	}
+	selector, err := parseSelector(req.Selector)
+	if err != nil {
+		return err
+	}
+	names, _ := m.selectNodes(selector)
+	if len(names) == 0 {
+		return errBadRequest(errNoNodesSelected(req.Selector))
+	}
+	req.Nodes = names
+	return nil
+}
+
+// selectNodes returns the names of the known nodes that match the selector,
+// in order, along with the ones that match but are not selected as they are
+// in maintenance. It is expected to be called with the nodes locked
+func (m *Manager) selectNodes(selector map[string]string) ([]string, []string) {
+	names := []string{}
+	inMaintenance := []string{}
+	for name, n := range m.nodes {
+		if !n.matchesSelector(selector) {
+			continue
+		}
+		if n.Maintenance {
+			inMaintenance = append(inMaintenance, name)
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	sort.Strings(inMaintenance)
+	return names, inMaintenance
+}
+
+// selectorResolve returns the nodes that the request's selector selects, as
+// they would be by a commission, decommission or update request. Unlike those,
+// no nodes being selected is not an error
+func (m *Manager) selectorResolve(req *APIRequest) (io.Reader, error) {
+	if req.Selector == "" {
+		return nil, errBadRequest(errNoSelector())
+	}
+	selector, err := parseSelector(req.Selector)
+	if err != nil {
+		return nil, err
+	}
+	m.nodesMutex.RLock()
+	names, inMaintenance := m.selectNodes(selector)
+	m.nodesMutex.RUnlock()
+	out, err := json.Marshal(&SelectorResolution{
+		Selector:    req.Selector,
+		Nodes:       names,
+		Maintenance: inMaintenance,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(out), nil
+}
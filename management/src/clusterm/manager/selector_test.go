@@ -0,0 +1,107 @@
+// +build unittest
+
+package manager
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	"github.com/contiv/cluster/management/src/monitor"
+	. "gopkg.in/check.v1"
+)
+
+type selectorSuite struct {
+}
+
+var _ = Suite(&selectorSuite{})
+
+func newSelectorTestManager() *Manager {
+	return &Manager{
+		nodes: map[string]*node{
+			"node1": {
+				Mon:         monitor.NewNode("node1", "s1", "1.1.1.1"),
+				Tags:        map[string]string{"rack": "r1"},
+				Annotations: map[string]string{"role": "worker"},
+			},
+			"node2": {
+				Mon:  monitor.NewNode("node2", "s2", "1.1.1.2"),
+				Tags: map[string]string{"rack": "r1", "role": "master"},
+			},
+			"node3": {
+				Mon:  monitor.NewNode("node3", "s3", "1.1.1.3"),
+				Tags: map[string]string{"rack": "r2", "role": "worker"},
+			},
+		},
+	}
+}
+
+func (s *selectorSuite) TestResolveRequestSelector(c *C) {
+	m := newSelectorTestManager()
+	tests := map[string][]string{
+		"rack=r1":               {"node1", "node2"},
+		"role=worker":           {"node1", "node3"},
+		" rack=r1, role=worker": {"node1"},
+	}
+	for selector, exptd := range tests {
+		req := &APIRequest{Selector: selector}
+		c.Assert(m.resolveRequestSelector(req), IsNil, Commentf("selector: %s", selector))
+		c.Assert(req.Nodes, DeepEquals, exptd, Commentf("selector: %s", selector))
+	}
+
+	// the nodes specified in a request without a selector are left as is
+	req := &APIRequest{Nodes: []string{"node1"}}
+	c.Assert(m.resolveRequestSelector(req), IsNil)
+	c.Assert(req.Nodes, DeepEquals, []string{"node1"})
+}
+
+func (s *selectorSuite) TestResolveRequestSelectorErrors(c *C) {
+	m := newSelectorTestManager()
+	tests := map[string]*APIRequest{
+		"nodes-and-selector": {Nodes: []string{"node1"}, Selector: "rack=r1"},
+		"invalid-selector":   {Selector: "rack"},
+		"no-match":           {Selector: "rack=r3"},
+	}
+	for key, req := range tests {
+		err := m.resolveRequestSelector(req)
+		c.Assert(err, NotNil, Commentf("key: %s", key))
+		c.Assert(httpStatus(err), Equals, http.StatusBadRequest, Commentf("key: %s", key))
+	}
+
+	_, err := m.nodesUpdate(&APIRequest{Nodes: []string{"node1"}, Selector: "rack=r1"})
+	c.Assert(err, ErrorMatches, errSelectorAndNodes().Error())
+}
+
+func (s *selectorSuite) TestSelectorResolve(c *C) {
+	m := newSelectorTestManager()
+	m.config = DefaultConfig()
+	m.nodes["node2"].Maintenance = true
+	router := m.apiRouter(0)
+	tests := map[string]struct {
+		selector    string
+		exptdStatus int
+		exptd       *SelectorResolution
+	}{
+		"match": {"rack=r1", http.StatusOK,
+			&SelectorResolution{Selector: "rack=r1", Nodes: []string{"node1"}, Maintenance: []string{"node2"}}},
+		"annotation": {"role=worker", http.StatusOK,
+			&SelectorResolution{Selector: "role=worker", Nodes: []string{"node1", "node3"}}},
+		"no-match":  {"rack=r3", http.StatusOK, &SelectorResolution{Selector: "rack=r3", Nodes: []string{}}},
+		"malformed": {"rack", http.StatusBadRequest, nil},
+		"missing":   {"", http.StatusBadRequest, nil},
+	}
+	for key, test := range tests {
+		vals := url.Values{}
+		vals.Set("selector", test.selector)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/"+GetNodesResolve+"?"+vals.Encode(), nil))
+		c.Assert(w.Code, Equals, test.exptdStatus, Commentf("key: %s", key))
+		if test.exptd == nil {
+			continue
+		}
+		resolution := &SelectorResolution{}
+		c.Assert(json.NewDecoder(w.Body).Decode(resolution), IsNil, Commentf("key: %s", key))
+		c.Assert(resolution, DeepEquals, test.exptd, Commentf("key: %s", key))
+	}
+}
@@ -0,0 +1,80 @@
+package manager
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/contiv/errored"
+)
+
+// errSerialsAndNodes is the error returned when a request specifies the node
+// serials along with the node names or a node selector
+func errSerialsAndNodes() error {
+	return errored.Errorf("serials specified along with nodes or selector, only one of them is expected")
+}
+
+// errUnknownSerials is the error returned when no known node has some of the
+// serials specified in a request
+func errUnknownSerials(serials []string) error {
+	return errored.Errorf("Unknown serial(s) specified: %v", serials)
+}
+
+// errAmbiguousSerials is the error returned when more than one known node has
+// some of the serials specified in a request. The matching nodes are keyed by serial
+func errAmbiguousSerials(matches map[string][]string) error {
+	serials := []string{}
+	for serial := range matches {
+		serials = append(serials, serial)
+	}
+	sort.Strings(serials)
+	reasons := []string{}
+	for _, serial := range serials {
+		reasons = append(reasons, serial+": "+strings.Join(matches[serial], ","))
+	}
+	return errored.Errorf("Ambiguous serial(s) specified, each matches more than one node. Matches: %s",
+		strings.Join(reasons, "; "))
+}
+
+// resolveRequestSerials sets the nodes of a request, that specifies the node
+// serials instead of the node names, to the known nodes with those serials.
+// The request fails if a serial doesn't match exactly one known node
+func (m *Manager) resolveRequestSerials(req *APIRequest) error {
+	if len(req.Serials) == 0 {
+		return nil
+	}
+	if len(req.Nodes) > 0 || strings.TrimSpace(req.Selector) != "" {
+		return errBadRequest(errSerialsAndNodes())
+	}
+	m.nodesMutex.RLock()
+	defer m.nodesMutex.RUnlock()
+	bySerial := map[string][]string{}
+	for name, n := range m.nodes {
+		if n.Mon == nil || n.Mon.GetSerial() == "" {
+			continue
+		}
+		bySerial[n.Mon.GetSerial()] = append(bySerial[n.Mon.GetSerial()], name)
+	}
+	names := []string{}
+	unknown := []string{}
+	ambiguous := map[string][]string{}
+	for _, serial := range req.Serials {
+		serial = strings.TrimSpace(serial)
+		switch matches := bySerial[serial]; len(matches) {
+		case 0:
+			unknown = append(unknown, serial)
+		case 1:
+			names = append(names, matches[0])
+		default:
+			sort.Strings(matches)
+			ambiguous[serial] = matches
+		}
+	}
+	if len(unknown) > 0 {
+		return errBadRequest(errUnknownSerials(unknown))
+	}
+	if len(ambiguous) > 0 {
+		return errBadRequest(errAmbiguousSerials(ambiguous))
+	}
+	req.Nodes = names
+	return nil
+}
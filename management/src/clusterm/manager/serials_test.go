@@ -0,0 +1,61 @@
+// +build unittest
+
+package manager
+
+import (
+	"net/http"
+
+	"github.com/contiv/cluster/management/src/monitor"
+	. "gopkg.in/check.v1"
+)
+
+type serialsSuite struct {
+}
+
+var _ = Suite(&serialsSuite{})
+
+func newSerialsTestManager() *Manager {
+	return &Manager{
+		nodes: map[string]*node{
+			"node1": {Mon: monitor.NewNode("node1", "s1", "1.1.1.1")},
+			"node2": {Mon: monitor.NewNode("node2", "s2", "1.1.1.2")},
+			// a node re-imaged under another name, before it's old record is removed
+			"node3": {Mon: monitor.NewNode("node3", "s2", "1.1.1.3")},
+			"node4": {},
+		},
+	}
+}
+
+func (s *serialsSuite) TestResolveRequestSerials(c *C) {
+	m := newSerialsTestManager()
+	req := &APIRequest{Serials: []string{"s1"}}
+	c.Assert(m.resolveRequestSerials(req), IsNil)
+	c.Assert(req.Nodes, DeepEquals, []string{"node1"})
+
+	// the nodes are left as is when no serials are specified
+	req = &APIRequest{Nodes: []string{"node4"}}
+	c.Assert(m.resolveRequestSerials(req), IsNil)
+	c.Assert(req.Nodes, DeepEquals, []string{"node4"})
+}
+
+func (s *serialsSuite) TestResolveRequestSerialsErrors(c *C) {
+	m := newSerialsTestManager()
+	tests := map[string]struct {
+		req   *APIRequest
+		exptd error
+	}{
+		"nodes-and-serials":    {&APIRequest{Nodes: []string{"node1"}, Serials: []string{"s1"}}, errSerialsAndNodes()},
+		"selector-and-serials": {&APIRequest{Selector: "rack=r1", Serials: []string{"s1"}}, errSerialsAndNodes()},
+		"unknown":              {&APIRequest{Serials: []string{"s1", "s3", "s4"}}, errUnknownSerials([]string{"s3", "s4"})},
+		"ambiguous": {&APIRequest{Serials: []string{"s1", "s2"}},
+			errAmbiguousSerials(map[string][]string{"s2": {"node2", "node3"}})},
+	}
+	for key, test := range tests {
+		err := m.resolveRequestSerials(test.req)
+		c.Assert(err, NotNil, Commentf("key: %s", key))
+		c.Assert(err.Error(), Equals, test.exptd.Error(), Commentf("key: %s", key))
+		c.Assert(httpStatus(err), Equals, http.StatusBadRequest, Commentf("key: %s", key))
+	}
+	c.Assert(errAmbiguousSerials(map[string][]string{"s2": {"node2", "node3"}}).Error(), Matches,
+		".*Matches: s2: node2,node3$")
+}
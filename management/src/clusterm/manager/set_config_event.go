@@ -3,7 +3,11 @@ package manager
 import (
 	"fmt"
 	"io"
+	"net/http"
 	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
 
 	"github.com/contiv/errored"
 )
@@ -12,10 +16,69 @@ func configChangeNotPermittedError(config string) error {
 	return errored.Errorf("%q configuration can't be changed. Only changes to ansible configuration are allowed.", config)
 }
 
+func errConfigVersionRequired() error {
+	return &apiError{
+		status: http.StatusPreconditionRequired,
+		code:   ErrCodeConfigVersionRequired,
+		err:    errored.Errorf("the version of the configuration that the request is based on is not specified"),
+	}
+}
+
+func errConfigVersionMismatch(version, current uint64) error {
+	return &apiError{
+		status: http.StatusConflict,
+		code:   ErrCodeConfigVersionMismatch,
+		err: errored.Errorf("the configuration has changed since version %d, current version is %d. "+
+			"Please get the configuration and try again", version, current),
+	}
+}
+
+func errInvalidConfigVersion(version string) error {
+	return errored.Errorf("invalid configuration version: %q", version)
+}
+
+// formatConfigVersion formats a configuration version as an ETag
+func formatConfigVersion(version uint64) string {
+	return fmt.Sprintf("%q", strconv.FormatUint(version, 10))
+}
+
+// parseConfigVersion parses a configuration version from an ETag, quoted or not
+func parseConfigVersion(etag string) (uint64, error) {
+	version, err := strconv.ParseUint(strings.Trim(etag, `"`), 10, 64)
+	if err != nil {
+		return 0, errInvalidConfigVersion(etag)
+	}
+	return version, nil
+}
+
+// currentConfigVersion returns the version of the current configuration. It is
+// incremented on every change to the configuration
+func (m *Manager) currentConfigVersion() uint64 {
+	return atomic.LoadUint64(&m.configVersion)
+}
+
+// getConfig returns the current configuration. The configuration is replaced,
+// and not modified, on a change, so the returned configuration stays as is
+func (m *Manager) getConfig() *Config {
+	m.configMutex.RLock()
+	defer m.configMutex.RUnlock()
+	return m.config
+}
+
+// setConfig replaces the current configuration and bumps it's version
+func (m *Manager) setConfig(config *Config) {
+	m.configMutex.Lock()
+	defer m.configMutex.Unlock()
+	m.config = config
+	atomic.AddUint64(&m.configVersion, 1)
+}
+
 // setConfigEvent triggers the update to global configuration
 type setConfigEvent struct {
 	mgr    *Manager
 	config *Config
+	// version is the version of the configuration that the update is based on
+	version uint64
 }
 
 // newSetConfigEvent creates and returns setConfigEvent
@@ -32,11 +95,19 @@ func (e *setConfigEvent) String() string {
 
 func (e *setConfigEvent) process() error {
 	// err shouldn't be redefined below
-	var err error
+	var (
+		err error
+		job *Job
+	)
+
+	// the configuration shall not have changed since the version the update is based on
+	if current := e.mgr.currentConfigVersion(); e.version != current {
+		return errConfigVersionMismatch(e.version, current)
+	}
 
 	// we set a noop job to ensure that even for the short time this event is
 	// run no other job get's enqueued and catches us in middle of things
-	err = e.mgr.checkAndSetActiveJob(
+	job, err = e.mgr.checkAndSetExclusiveJob(
 		e.String(),
 		e.noopRunner,
 		func(status JobStatus, errRet error) { return })
@@ -45,45 +116,62 @@ func (e *setConfigEvent) process() error {
 	}
 	defer func() {
 		if err != nil {
-			e.mgr.resetActiveJob()
+			e.mgr.resetActiveJob(job)
 		}
 	}()
 
 	// merge the config with default and validate
-	finalConfig, err := DefaultConfig().MergeFromConfig(e.config)
+	finalConfig, err := validateConfig(e.mgr.getConfig(), e.config)
 	if err != nil {
 		return err
 	}
 	e.config = finalConfig
-	err = e.eventValidate()
-	if err != nil {
-		return err
-	}
 
 	// update manager's config
-	e.mgr.config = e.config
+	e.mgr.setConfig(e.config)
 
 	// trigger the noop job
-	go e.mgr.runActiveJob()
+	go e.mgr.runActiveJob(job)
 
 	return nil
 }
 
-func (e *setConfigEvent) eventValidate() error {
+// validateConfig merges the specified configuration with the default values
+// and validates it as an update to the current configuration. It returns the
+// merged configuration.
+func validateConfig(current, config *Config) (*Config, error) {
+	if config == nil {
+		return nil, errNilConfig()
+	}
+	finalConfig, err := DefaultConfig().MergeFromConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
 	// make sure we are only changing ansible related config.
 	// Changes to monitoring, inventory and manager config is not supported
-
-	if !reflect.DeepEqual(e.config.Serf, e.mgr.config.Serf) {
-		return configChangeNotPermittedError("serf")
+	if !reflect.DeepEqual(finalConfig.Serf, current.Serf) {
+		return nil, configChangeNotPermittedError("serf")
 	}
-	if !reflect.DeepEqual(e.config.Inventory, e.mgr.config.Inventory) {
-		return configChangeNotPermittedError("inventory")
+	if !reflect.DeepEqual(finalConfig.Inventory, current.Inventory) {
+		return nil, configChangeNotPermittedError("inventory")
 	}
-	if !reflect.DeepEqual(e.config.Manager, e.mgr.config.Manager) {
-		return configChangeNotPermittedError("manager")
+	if !reflect.DeepEqual(finalConfig.Manager, current.Manager) {
+		return nil, configChangeNotPermittedError("manager")
 	}
 
-	return nil
+	if finalConfig.Ansible.ExtraVariables, err = validateAndSanitizeEmptyExtraVars(
+		"ansible.ExtraVariables configuration", finalConfig.Ansible.ExtraVariables); err != nil {
+		return nil, err
+	}
+
+	return finalConfig, nil
+}
+
+// jobNodes returns the nodes the triggered job acts upon. The job can't run
+// alongside other jobs
+func (e *setConfigEvent) jobNodes() ([]string, bool) {
+	return nil, true
 }
 
 func (e *setConfigEvent) noopRunner(cancelCh CancelChannel, jobLogs io.Writer) error {
@@ -1,6 +1,10 @@
 package manager
 
-import "fmt"
+import (
+	"fmt"
+
+	"github.com/contiv/cluster/management/src/configuration"
+)
 
 // setGlobalsEvent triggers the update to global configuration
 type setGlobalsEvent struct {
@@ -17,7 +21,7 @@ func newSetGlobalsEvent(mgr *Manager, extraVars string) *setGlobalsEvent {
 }
 
 func (e *setGlobalsEvent) String() string {
-	return fmt.Sprintf("setGlobalsEvent: %s", e.extraVars)
+	return fmt.Sprintf("setGlobalsEvent: %s", configuration.RedactExtraVars(e.extraVars))
 }
 
 func (e *setGlobalsEvent) process() error {
@@ -2,6 +2,8 @@ package manager
 
 import (
 	"bufio"
+	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
 	"strings"
@@ -43,9 +45,41 @@ func (m *Manager) signalLoop() {
 				logrus.Errorf("failed to reparse config. Error: %v", err)
 				continue
 			}
-			if err := NewClient(m.addr).PostConfig(config); err != nil {
+			// the config file takes precedence over the changes made since
+			if err := NewClient(m.addr).WithBasePath(m.basePath).PostConfig(config, m.currentConfigVersion()); err != nil {
 				logrus.Errorf("error posting config. Error: %v", err)
 			}
 		}
 	}
 }
+
+// StoppedError is returned by Run when clusterm is stopped by a signal
+type StoppedError struct {
+	// Signal is the signal that stopped clusterm
+	Signal os.Signal
+}
+
+// Error returns the description of the stop
+func (e *StoppedError) Error() string {
+	return fmt.Sprintf("clusterm was stopped by signal %s", e.Signal)
+}
+
+// stopOnSignal closes the api server when clusterm is stopped by a signal. This
+// closes the listener, which removes the unix socket file if clusterm is served
+// on one. The signal is sent on the returned channel once the server is closed
+func stopOnSignal(srv *http.Server) <-chan os.Signal {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
+	stoppedCh := make(chan os.Signal, 1)
+	go func() {
+		sig := <-c
+		// a repeated signal stops clusterm right away
+		signal.Stop(c)
+		logrus.Infof("received signal %s, stopping", sig)
+		if err := srv.Close(); err != nil {
+			logrus.Errorf("failed to close the api server. Error: %v", err)
+		}
+		stoppedCh <- sig
+	}()
+	return stoppedCh
+}
@@ -0,0 +1,92 @@
+package manager
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// unknownNodeState is the state of a node that has no inventory info
+const unknownNodeState = "Unknown"
+
+// Status is a summary of clusterm's state, that is easy to eyeball
+type Status struct {
+	// Ready is true once clusterm is ready to act upon the nodes
+	Ready bool `json:"ready"`
+	// StartedAt is the time clusterm was started
+	StartedAt time.Time `json:"started_at"`
+	// Uptime is the duration for which clusterm is running, like "1h2m3s"
+	Uptime string `json:"uptime"`
+	// ReqQueueDepth is the number of requests pending processing
+	ReqQueueDepth int `json:"req_queue_depth"`
+	// ReqQueueCapacity is the number of requests that can be pending processing
+	ReqQueueCapacity int `json:"req_queue_capacity"`
+	// ActiveJobs are the ids of the jobs that are running, most recent first
+	ActiveJobs []uint64 `json:"active_jobs"`
+	// NodesByState is the number of nodes in each inventory state, like 'Discovered'
+	NodesByState map[string]int `json:"nodes_by_state"`
+	// NodesByStatus is the number of nodes in each inventory status, like 'Allocated'
+	NodesByStatus map[string]int `json:"nodes_by_status"`
+	// LastJob is the outcome of the most recently finished job, if any
+	LastJob *JobOutcome `json:"last_job"`
+	// JobRetention is the retention of the job history against it's limits
+	JobRetention *JobRetention `json:"job_retention"`
+}
+
+// JobOutcome is the outcome of a finished job
+type JobOutcome struct {
+	ID         uint64     `json:"id"`
+	Status     string     `json:"status"`
+	ErrVal     string     `json:"error,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// status returns the summary of clusterm's state at the specified time
+func (m *Manager) status(now time.Time) Status {
+	s := Status{
+		Ready:            m.isReady(),
+		StartedAt:        m.startedAt,
+		Uptime:           now.Sub(m.startedAt).Round(time.Second).String(),
+		ReqQueueDepth:    len(m.reqQ),
+		ReqQueueCapacity: cap(m.reqQ),
+		ActiveJobs:       []uint64{},
+		NodesByState:     map[string]int{},
+		NodesByStatus:    map[string]int{},
+		JobRetention:     m.jobRetention(),
+	}
+	for _, j := range m.getActiveJobs() {
+		s.ActiveJobs = append(s.ActiveJobs, j.id)
+	}
+	m.nodesMutex.RLock()
+	defer m.nodesMutex.RUnlock()
+	for _, n := range m.nodes {
+		if n.Inv == nil {
+			s.NodesByState[unknownNodeState]++
+			s.NodesByStatus[unknownNodeState]++
+			continue
+		}
+		status, state := n.Inv.GetStatus()
+		s.NodesByState[state.String()]++
+		s.NodesByStatus[status.String()]++
+	}
+	if j := m.getLastJob(); j != nil {
+		info := j.info(false)
+		s.LastJob = &JobOutcome{
+			ID:         info.ID,
+			Status:     info.Status,
+			ErrVal:     info.ErrVal,
+			FinishedAt: info.FinishedAt,
+		}
+	}
+	return s
+}
+
+func (m *Manager) statusGet(noop *APIRequest) (io.Reader, error) {
+	out, err := json.Marshal(m.status(time.Now()))
+	if err != nil {
+		return nil, err
+	}
+
+	return bytes.NewReader(out), nil
+}
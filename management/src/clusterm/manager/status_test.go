@@ -0,0 +1,78 @@
+// +build unittest
+
+package manager
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/contiv/cluster/management/src/inventory"
+	. "gopkg.in/check.v1"
+)
+
+type statusSuite struct {
+}
+
+var _ = Suite(&statusSuite{})
+
+func (s *statusSuite) TestStatus(c *C) {
+	startedAt := time.Now().Add(-90 * time.Minute)
+	lastJob := NewJob("", nil, nil)
+	lastJob.id = 3
+	lastJob.status = Errored
+	lastJob.errVal = errors.New("test failure")
+	activeJob := NewJob("", nil, nil)
+	activeJob.id = 4
+	m := &Manager{
+		reqQ:      make(chan event, 2),
+		readyCh:   make(chan struct{}),
+		startedAt: startedAt,
+		nodes: map[string]*node{
+			"node1": {Inv: inventory.NewAssetWithState(nil, "node1", inventory.Allocated, inventory.Discovered)},
+			"node2": {Inv: inventory.NewAssetWithState(nil, "node2", inventory.Allocated, inventory.Discovered)},
+			"node3": {Inv: inventory.NewAssetWithState(nil, "node3", inventory.Unallocated, inventory.Disappeared)},
+			"node4": {},
+		},
+		activeJobs: map[uint64]*Job{activeJob.id: activeJob},
+		lastJob:    lastJob,
+	}
+	c.Assert(m.enqueue(&blockingEvent{}), IsNil)
+
+	st := m.status(startedAt.Add(90*time.Minute + 400*time.Millisecond))
+	c.Assert(st.Ready, Equals, false)
+	c.Assert(st.StartedAt, Equals, startedAt)
+	c.Assert(st.Uptime, Equals, "1h30m0s")
+	c.Assert(st.ReqQueueDepth, Equals, 1)
+	c.Assert(st.ReqQueueCapacity, Equals, 2)
+	c.Assert(st.ActiveJobs, DeepEquals, []uint64{4})
+	c.Assert(st.NodesByState, DeepEquals, map[string]int{
+		inventory.Discovered.String():  2,
+		inventory.Disappeared.String(): 1,
+		unknownNodeState:               1,
+	})
+	c.Assert(st.NodesByStatus, DeepEquals, map[string]int{
+		inventory.Allocated.String():   2,
+		inventory.Unallocated.String(): 1,
+		unknownNodeState:               1,
+	})
+	c.Assert(st.LastJob, NotNil)
+	c.Assert(st.LastJob.ID, Equals, uint64(3))
+	c.Assert(st.LastJob.Status, Equals, Errored.String())
+	c.Assert(st.LastJob.ErrVal, Equals, "test failure")
+}
+
+func (s *statusSuite) TestStatusGetNoJobs(c *C) {
+	readyCh := make(chan struct{})
+	close(readyCh)
+	m := &Manager{reqQ: make(chan event, 1), readyCh: readyCh, startedAt: time.Now()}
+
+	out, err := m.statusGet(&APIRequest{})
+	c.Assert(err, IsNil)
+	st := Status{}
+	c.Assert(json.NewDecoder(out).Decode(&st), IsNil)
+	c.Assert(st.Ready, Equals, true)
+	c.Assert(st.ActiveJobs, DeepEquals, []uint64{})
+	c.Assert(st.NodesByState, DeepEquals, map[string]int{})
+	c.Assert(st.LastJob, IsNil)
+}
@@ -3,6 +3,8 @@ package manager
 import (
 	"fmt"
 	"io"
+	"strings"
+	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/contiv/cluster/management/src/configuration"
@@ -11,37 +13,81 @@ import (
 
 // updateEvent triggers the upgrade workflow
 type updateEvent struct {
+	jobTrigger
 	mgr       *Manager
 	nodeNames []string
 	extraVars string
 	hostGroup string
+	// extraGroups are the host-groups the nodes are added to, in addition to hostGroup
+	extraGroups []string
+	playbook    string
+	timeout     time.Duration // the job is cancelled if it runs longer than this
+	// inventory, if set, is the ansible inventory that is used for the run
+	// instead of the managed one
+	inventory string
+	// check, when true, runs the configuration playbook in check mode. The job
+	// reports the changes it would make as it's plan, and the nodes are left as is
+	check bool
 
 	_hosts  configuration.SubsysHosts
 	_enodes map[string]*node
 }
 
 // newUpdateEvent creates and returns updateEvent
-func newUpdateEvent(mgr *Manager, nodeNames []string, extraVars, hostGroup string) *updateEvent {
+func newUpdateEvent(mgr *Manager, nodeNames []string, extraVars, hostGroup, playbook string,
+	timeout time.Duration) *updateEvent {
 	return &updateEvent{
 		mgr:       mgr,
 		nodeNames: nodeNames,
 		extraVars: extraVars,
 		hostGroup: hostGroup,
+		playbook:  playbook,
+		timeout:   timeout,
 	}
 }
 
 func (e *updateEvent) String() string {
-	return fmt.Sprintf("updateEvent: nodes: %v extra-vars: %v host-group: %q", e.nodeNames, e.extraVars, e.hostGroup)
+	return fmt.Sprintf("updateEvent: nodes: %v extra-vars: %v host-groups: %q playbook: %q check: %v",
+		e.nodeNames, configuration.RedactExtraVars(e.extraVars), e.hostGroups(), e.playbook, e.check)
 }
 
 func (e *updateEvent) process() error {
 	// err shouldn't be redefined below
-	var err error
+	var (
+		err error
+		job *Job
+	)
+
+	if e.scheduled {
+		// the nodes put in maintenance since the update was scheduled are skipped
+		var skipped []string
+		if e.nodeNames, skipped = e.mgr.withoutMaintenanceNodes(e.nodeNames); len(skipped) > 0 {
+			logrus.Infof("skipping the node(s) %v in maintenance from the scheduled update", skipped)
+			if len(e.nodeNames) == 0 {
+				return errNodesInMaintenance(skipped)
+			}
+		}
+	}
+
+	// an identical request that is already in flight, is not run again
+	key := e.jobInFlightKey()
+	if aj := e.mgr.findInFlightJob(key); aj != nil {
+		logrus.Infof("an identical job is already active, not running it again. Job: %s", aj)
+		e.job = aj
+		return nil
+	}
 
-	err = e.mgr.checkAndSetActiveJob(
+	job, err = e.checkAndSetActiveJob(
+		e.mgr,
 		e.String(),
-		e.updateRunner,
+		e.nodeNames,
+		e.timeout,
+		e.runner(),
 		func(status JobStatus, errRet error) {
+			if e.check {
+				// the nodes are left as is in check mode
+				return
+			}
 			if status == Errored {
 				logrus.Errorf("configuration job failed. Error: %v", errRet)
 				// set assets as unallocated
@@ -56,9 +102,23 @@ func (e *updateEvent) process() error {
 	}
 	defer func() {
 		if err != nil {
-			e.mgr.resetActiveJob()
+			e.mgr.resetActiveJob(job)
 		}
 	}()
+	e.setPlaybook(e.mgr, configureAction(e.playbook), e.playbook)
+
+	job.inFlightKey = key
+	job.check = e.check
+	job.hostGroups = e.hostGroups()
+
+	// the job can be retried on the subset of nodes that fail
+	job.retryEvent = func(nodeNames []string, timeout time.Duration) jobEvent {
+		re := newUpdateEvent(e.mgr, nodeNames, e.extraVars, e.hostGroup, e.playbook, timeout)
+		re.extraGroups = e.extraGroups
+		re.inventory = e.inventory
+		re.check = e.check
+		return re
+	}
 
 	// validate event data
 	if err = e.eventValidate(); err != nil {
@@ -70,18 +130,42 @@ func (e *updateEvent) process() error {
 		return err
 	}
 
-	//set assets as in-maintenance
-	if err = e.mgr.setAssetsStatusAtomic(e.nodeNames, e.mgr.inventory.SetAssetInMaintenance,
-		e.mgr.inventory.SetAssetCommissioned); err != nil {
-		return err
+	//set assets as in-maintenance, unless the nodes are left as is
+	if !e.check {
+		if err = e.mgr.setAssetsStatusAtomic(e.nodeNames, e.mgr.inventory.SetAssetInMaintenance,
+			e.mgr.inventory.SetAssetCommissioned); err != nil {
+			return err
+		}
 	}
 
+	e.mgr.setLastExtraVars(e.nodeNames, e.extraVars)
+
 	// trigger node upgrade event
-	go e.mgr.runActiveJob()
+	go e.mgr.runActiveJob(job)
 
 	return nil
 }
 
+// hostGroups returns all the host-groups the nodes are added to, if any
+func (e *updateEvent) hostGroups() []string {
+	return joinHostGroups(e.hostGroup, e.extraGroups)
+}
+
+// jobNodes returns the nodes the triggered job acts upon
+func (e *updateEvent) jobNodes() ([]string, bool) {
+	return e.nodeNames, false
+}
+
+// jobInFlightKey returns the key that identifies the identical requests for the triggered job
+func (e *updateEvent) jobInFlightKey() string {
+	kind := "update"
+	if e.check {
+		kind = "update-check"
+	}
+	return inFlightKey(kind, e.nodeNames, strings.Join(e.hostGroups(), ","), e.playbook,
+		e.extraVars+e.inventory)
+}
+
 // eventValidate perfoms the validations
 func (e *updateEvent) eventValidate() error {
 	var err error
@@ -90,12 +174,15 @@ func (e *updateEvent) eventValidate() error {
 		return err
 	}
 
-	if e.hostGroup != "" && !IsValidHostGroup(e.hostGroup) {
-		return errored.Errorf("invalid host-group specified: %q", e.hostGroup)
+	groups := e.hostGroups()
+	for _, group := range groups {
+		if !IsValidHostGroup(group) {
+			return errored.Errorf("invalid host-group specified: %q", group)
+		}
 	}
 
 	// when workers are being configured, make sure that there is atleast one service-master
-	if e.hostGroup == ansibleWorkerGroupName {
+	if inHostGroup(groups, ansibleWorkerGroupName) && !inHostGroup(groups, ansibleMasterGroupName) {
 		masterCommissioned := false
 		for name := range e.mgr.nodes {
 			if _, ok := e._enodes[name]; ok {
@@ -134,11 +221,22 @@ func (e *updateEvent) eventValidate() error {
 
 // pepareInventory prepares the inventory for update event.
 func (e *updateEvent) pepareInventory() error {
+	if e.inventory != "" {
+		// the managed inventory is left as is
+		e._hosts = configuration.AnsibleInventory(e.inventory)
+		return nil
+	}
 	hosts := []*configuration.AnsibleHost{}
+	e.mgr.nodesMutex.Lock()
+	defer e.mgr.nodesMutex.Unlock()
 	for _, node := range e._enodes {
 		host := node.Cfg.(*configuration.AnsibleHost)
-		if e.hostGroup != "" {
-			host.SetGroup(e.hostGroup)
+		if e.check {
+			// the node's host-groups are not changed in check mode
+			host = host.Clone()
+		}
+		if groups := e.hostGroups(); len(groups) > 0 {
+			host.SetGroups(groups)
 		}
 		hosts = append(hosts, host)
 	}
@@ -147,22 +245,38 @@ func (e *updateEvent) pepareInventory() error {
 	return nil
 }
 
+// runner returns the job runner for the event
+func (e *updateEvent) runner() JobRunner {
+	if e.check {
+		return e.checkRunner
+	}
+	return e.updateRunner
+}
+
+// checkRunner is the job runner that runs the configuration playbook on one or
+// more nodes in check mode. The cleanup playbook is not run, as the changes
+// it makes would be reverted by the configuration playbook anyways
+func (e *updateEvent) checkRunner(cancelCh CancelChannel, jobLogs io.Writer) error {
+	outReader, cancelFunc, errCh := configure(e.subsys(e.mgr), e._hosts, e.playbook, e.extraVars, true)
+	return logOutputAndReturnStatus(outReader, errCh, cancelCh, cancelFunc, jobLogs)
+}
+
 // updateRunner is the job runner that runs a cleanup playbook followed by provision playbook
 // on one or more nodes. In case of provision failure the cleanup playbook it run again.
 func (e *updateEvent) updateRunner(cancelCh CancelChannel, jobLogs io.Writer) error {
-	outReader, cancelFunc, errCh := e.mgr.configuration.Cleanup(e._hosts, e.extraVars)
+	outReader, cancelFunc, errCh := e.subsys(e.mgr).Cleanup(e._hosts, e.extraVars)
 	if err := logOutputAndReturnStatus(outReader, errCh, cancelCh, cancelFunc, jobLogs); err != nil {
 		logrus.Errorf("first cleanup failed. Error: %s", err)
 		// XXX: is there a case where we should continue on error here?
 		return err
 	}
-	outReader, cancelFunc, errCh = e.mgr.configuration.Configure(e._hosts, e.extraVars)
+	outReader, cancelFunc, errCh = configure(e.subsys(e.mgr), e._hosts, e.playbook, e.extraVars, false)
 	cfgErr := logOutputAndReturnStatus(outReader, errCh, cancelCh, cancelFunc, jobLogs)
 	if cfgErr == nil {
 		return nil
 	}
 	logrus.Errorf("configuration failed, starting cleanup. Error: %s", cfgErr)
-	outReader, cancelFunc, errCh = e.mgr.configuration.Cleanup(e._hosts, e.extraVars)
+	outReader, cancelFunc, errCh = e.subsys(e.mgr).Cleanup(e._hosts, e.extraVars)
 	if err := logOutputAndReturnStatus(outReader, errCh, cancelCh, cancelFunc, jobLogs); err != nil {
 		logrus.Errorf("second cleanup failed. Error: %s", err)
 	}
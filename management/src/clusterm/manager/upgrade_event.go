@@ -0,0 +1,198 @@
+package manager
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/contiv/cluster/management/src/configuration"
+	"github.com/contiv/errored"
+)
+
+// upgradeEvent triggers the upgrade of nodes to a specific version
+type upgradeEvent struct {
+	jobTrigger
+	mgr       *Manager
+	nodeNames []string
+	version   string
+	extraVars string
+	hostGroup string
+	timeout   time.Duration // the job is cancelled if it runs longer than this
+
+	_hosts  configuration.SubsysHosts
+	_enodes map[string]*node
+	// _versions are the versions of the nodes before the upgrade, keyed by node name
+	_versions map[string]string
+}
+
+// newUpgradeEvent creates and returns upgradeEvent
+func newUpgradeEvent(mgr *Manager, nodeNames []string, version, extraVars, hostGroup string,
+	timeout time.Duration) *upgradeEvent {
+	return &upgradeEvent{
+		mgr:       mgr,
+		nodeNames: nodeNames,
+		version:   version,
+		extraVars: extraVars,
+		hostGroup: hostGroup,
+		timeout:   timeout,
+	}
+}
+
+func (e *upgradeEvent) String() string {
+	return fmt.Sprintf("upgradeEvent: nodes: %v version: %q extra-vars: %v host-group: %q",
+		e.nodeNames, e.version, configuration.RedactExtraVars(e.extraVars), e.hostGroup)
+}
+
+func (e *upgradeEvent) process() error {
+	// err shouldn't be redefined below
+	var (
+		err error
+		job *Job
+	)
+
+	// an identical request that is already in flight, is not run again
+	key := e.jobInFlightKey()
+	if aj := e.mgr.findInFlightJob(key); aj != nil {
+		logrus.Infof("an identical job is already active, not running it again. Job: %s", aj)
+		e.job = aj
+		return nil
+	}
+
+	job, err = e.checkAndSetActiveJob(
+		e.mgr,
+		e.String(),
+		e.nodeNames,
+		e.timeout,
+		e.upgradeRunner,
+		func(status JobStatus, errRet error) {
+			if status == Errored {
+				logrus.Errorf("upgrade job failed. Error: %v", errRet)
+			}
+			e.recordVersions()
+			// the nodes stay commissioned, even if the upgrade failed on them
+			e.mgr.setAssetsStatusBestEffort(e.nodeNames, e.mgr.inventory.SetAssetCommissioned)
+		})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			e.mgr.resetActiveJob(job)
+		}
+	}()
+	e.setPlaybook(e.mgr, configuration.ActionUpgrade, "")
+
+	job.inFlightKey = key
+
+	// the job can be retried on the subset of nodes that fail
+	job.retryEvent = func(nodeNames []string, timeout time.Duration) jobEvent {
+		return newUpgradeEvent(e.mgr, nodeNames, e.version, e.extraVars, e.hostGroup, timeout)
+	}
+
+	// validate event data
+	if err = e.eventValidate(); err != nil {
+		return err
+	}
+
+	// prepare inventory
+	if err = e.pepareInventory(); err != nil {
+		return err
+	}
+
+	//set assets as in-maintenance
+	if err = e.mgr.setAssetsStatusAtomic(e.nodeNames, e.mgr.inventory.SetAssetInMaintenance,
+		e.mgr.inventory.SetAssetCommissioned); err != nil {
+		return err
+	}
+
+	// trigger node upgrade event
+	go e.mgr.runActiveJob(job)
+
+	return nil
+}
+
+// jobNodes returns the nodes the triggered job acts upon
+func (e *upgradeEvent) jobNodes() ([]string, bool) {
+	return e.nodeNames, false
+}
+
+// jobInFlightKey returns the key that identifies the identical requests for the triggered job
+func (e *upgradeEvent) jobInFlightKey() string {
+	return inFlightKey("upgrade:"+e.version, e.nodeNames, e.hostGroup, "", e.extraVars)
+}
+
+// eventValidate perfoms the validations
+func (e *upgradeEvent) eventValidate() error {
+	var err error
+	e._enodes, err = e.mgr.commonEventValidate(e.nodeNames)
+	if err != nil {
+		return err
+	}
+
+	if e.version == "" {
+		return errNoVersion()
+	}
+
+	if e.hostGroup != "" && !IsValidHostGroup(e.hostGroup) {
+		return errored.Errorf("invalid host-group specified: %q", e.hostGroup)
+	}
+	return nil
+}
+
+// pepareInventory prepares the inventory for upgrade event. The version to
+// upgrade to is passed to the upgrade playbook as a host variable, that is
+// set just for this run.
+func (e *upgradeEvent) pepareInventory() error {
+	hosts := []*configuration.AnsibleHost{}
+	e._versions = map[string]string{}
+	e.mgr.nodesMutex.Lock()
+	defer e.mgr.nodesMutex.Unlock()
+	for name, node := range e._enodes {
+		host := node.Cfg.(*configuration.AnsibleHost)
+		if e.hostGroup != "" {
+			host.SetGroup(e.hostGroup)
+		}
+		host = host.Clone()
+		host.SetVar(ansibleUpgradeVersionHostVar, e.version)
+		hosts = append(hosts, host)
+
+		e._versions[name] = node.Version
+		node.TargetVersion = e.version
+	}
+	e._hosts = hosts
+
+	return nil
+}
+
+// recordVersions records the version on the nodes that were upgraded and the
+// versions of all the nodes, before and after the upgrade, in the job's summary
+func (e *upgradeEvent) recordVersions() {
+	status := e.job.NodeStatus()
+	versions := map[string]NodeVersions{}
+	e.mgr.nodesMutex.Lock()
+	for name, node := range e._enodes {
+		if status[name] == NodeOk {
+			node.Version = e.version
+		}
+		versions[name] = NodeVersions{Before: e._versions[name], After: node.Version}
+	}
+	e.mgr.nodesMutex.Unlock()
+
+	e.job.Lock()
+	defer e.job.Unlock()
+	if e.job.summary == nil {
+		e.job.summary = &JobSummary{}
+	}
+	e.job.summary.Versions = versions
+}
+
+// upgradeRunner is the job runner that runs the upgrade playbook on one or more nodes
+func (e *upgradeEvent) upgradeRunner(cancelCh CancelChannel, jobLogs io.Writer) error {
+	outReader, cancelFunc, errCh := e.subsys(e.mgr).Upgrade(e._hosts, e.extraVars)
+	if err := logOutputAndReturnStatus(outReader, errCh, cancelCh, cancelFunc, jobLogs); err != nil {
+		logrus.Errorf("upgrade failed. Error: %s", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+// +build unittest
+
+package manager
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+
+	"github.com/contiv/cluster/management/src/configuration"
+	"golang.org/x/net/context"
+	. "gopkg.in/check.v1"
+)
+
+type upgradeSuite struct {
+}
+
+var _ = Suite(&upgradeSuite{})
+
+func (f *fakeConfigSubsys) Upgrade(nodes configuration.SubsysHosts,
+	extraVars string) (io.Reader, context.CancelFunc, chan error) {
+	return f.RunPlaybook(nodes, "upgrade", extraVars)
+}
+
+func newTestUpgradeEvent(cfg *fakeConfigSubsys) *upgradeEvent {
+	e := newUpgradeEvent(&Manager{configuration: cfg}, []string{"node1", "node2"}, "1.2.0", "", "", 0)
+	e._enodes = map[string]*node{
+		"node1": {
+			Cfg:     configuration.NewAnsibleHost("node1", "1.1.1.1", ansibleMasterGroupName, map[string]string{}),
+			Version: "1.1.0",
+		},
+		"node2": {
+			Cfg: configuration.NewAnsibleHost("node2", "1.1.1.2", ansibleWorkerGroupName, map[string]string{}),
+		},
+	}
+	return e
+}
+
+func (s *upgradeSuite) TestUpgradeRunner(c *C) {
+	cfg := &fakeConfigSubsys{}
+	e := newTestUpgradeEvent(cfg)
+	var logs bytes.Buffer
+	c.Assert(e.upgradeRunner(make(CancelChannel), &logs), IsNil)
+	c.Assert(cfg.ran, DeepEquals, []string{"upgrade"})
+}
+
+func (s *upgradeSuite) TestPrepareInventory(c *C) {
+	e := newTestUpgradeEvent(&fakeConfigSubsys{})
+	c.Assert(e.pepareInventory(), IsNil)
+	c.Assert(e._hosts, HasLen, 2)
+	for _, h := range e._hosts.([]*configuration.AnsibleHost) {
+		out, err := json.Marshal(h)
+		c.Assert(err, IsNil)
+		c.Assert(string(out), Matches, `.*"upgrade_version":"1.2.0".*`)
+	}
+	// the version is set only for the upgrade run
+	for name, n := range e._enodes {
+		out, err := json.Marshal(n.Cfg)
+		c.Assert(err, IsNil)
+		c.Assert(string(out), Not(Matches), `.*upgrade_version.*`, Commentf("node: %s", name))
+		c.Assert(n.TargetVersion, Equals, "1.2.0")
+	}
+}
+
+func (s *upgradeSuite) TestRecordVersions(c *C) {
+	e := newTestUpgradeEvent(&fakeConfigSubsys{})
+	c.Assert(e.pepareInventory(), IsNil)
+	e.job = NewJob("", nil, nil)
+	e.job.nodes = map[string]NodeStatus{"node1": NodeOk, "node2": NodeFailed}
+
+	e.recordVersions()
+	c.Assert(e._enodes["node1"].Version, Equals, "1.2.0")
+	c.Assert(e._enodes["node2"].Version, Equals, "")
+	c.Assert(e.job.Summary().Versions, DeepEquals, map[string]NodeVersions{
+		"node1": {Before: "1.1.0", After: "1.2.0"},
+		"node2": {Before: "", After: ""},
+	})
+}
@@ -1,11 +1,119 @@
 package manager
 
 import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/Sirupsen/logrus"
+	"github.com/contiv/cluster/management/src/configuration"
 	"github.com/contiv/cluster/management/src/inventory"
 	"github.com/contiv/errored"
 )
 
+// unixSocketPath returns the path of the unix socket if the address is of
+// form 'unix:/path/to/sock'
+func unixSocketPath(addr string) (string, bool) {
+	if !strings.HasPrefix(addr, unixAddrPrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(addr, unixAddrPrefix), true
+}
+
+func errInvalidListenAddr(addr, reason string) error {
+	return errored.Errorf("malformed address %q, %s. Expected address of form ':9999', '0.0.0.0:9999', '[::1]:9999' or 'unix:/path/to/sock'", addr, reason)
+}
+
+// normalizeListenAddr validates the address that clusterm listens on and
+// returns it in a form that can be used for listening as well as to form the
+// request urls. A bare port is treated as a port on all interfaces.
+func normalizeListenAddr(addr string) (string, error) {
+	if _, ok := unixSocketPath(addr); ok {
+		return addr, nil
+	}
+	addr = strings.TrimSpace(addr)
+	if _, err := strconv.ParseUint(addr, 10, 16); err == nil {
+		addr = ":" + addr
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", errInvalidListenAddr(addr, err.Error())
+	}
+	if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+		return "", errInvalidListenAddr(addr, "port should be a number between 0 and 65535")
+	}
+	if strings.Contains(host, "%") {
+		// zone is allowed only with ipv6 link local addresses
+		if ip := net.ParseIP(strings.SplitN(host, "%", 2)[0]); ip == nil || ip.To4() != nil {
+			return "", errInvalidListenAddr(addr, "host is not a valid ipv6 address")
+		}
+	} else if strings.Contains(host, ":") && net.ParseIP(host) == nil {
+		return "", errInvalidListenAddr(addr, "host is not a valid ipv6 address")
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+func errInvalidBasePath(basePath string) error {
+	return errored.Errorf("malformed base path %q. Expected a clean path of form '/prefix', without query, fragment or variables", basePath)
+}
+
+// cleanBasePath returns the base path of the REST endpoints in the form
+// '/prefix', without a trailing slash. It is empty for the endpoints that are
+// served at the root
+func cleanBasePath(basePath string) string {
+	basePath = strings.Trim(strings.TrimSpace(basePath), "/")
+	if basePath == "" {
+		return ""
+	}
+	return "/" + basePath
+}
+
+// normalizeBasePath validates the base path that clusterm serves the REST
+// endpoints under and returns it cleaned, see cleanBasePath
+func normalizeBasePath(basePath string) (string, error) {
+	basePath = cleanBasePath(basePath)
+	if basePath == "" {
+		return "", nil
+	}
+	if strings.ContainsAny(basePath, "?#{}% \t") || path.Clean(basePath) != basePath {
+		return "", errInvalidBasePath(basePath)
+	}
+	return basePath, nil
+}
+
+// urlHost returns the host part of the request urls for the specified address.
+// It encloses the bare ipv6 addresses in brackets.
+func urlHost(addr string) string {
+	if host, port, err := net.SplitHostPort(addr); err == nil {
+		return net.JoinHostPort(host, port)
+	}
+	if ip := net.ParseIP(addr); ip != nil && ip.To4() == nil {
+		return "[" + addr + "]"
+	}
+	return addr
+}
+
+// readDebugToken reads the token to access the debug endpoints from the specified file
+func readDebugToken(file string) (string, error) {
+	if file == "" {
+		return "", errored.Errorf("a debug token file is required when the debug endpoints are enabled")
+	}
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", errored.Errorf("failed to read debug token file %q. Error: %v", file, err)
+	}
+	token := strings.TrimSpace(string(b))
+	if token == "" {
+		return "", errored.Errorf("debug token file %q is empty", file)
+	}
+	return token, nil
+}
+
 func nodeNotExistsError(nameOrAddr string) error {
 	return errored.Errorf("node with name or address %q doesn't exists", nameOrAddr)
 }
@@ -35,6 +143,121 @@ func (m *Manager) findNodeByMgmtAddr(addr string) (*node, error) {
 	return nil, nodeNotExistsError(addr)
 }
 
+func errInvalidNodeField(field string) error {
+	fields := []string{}
+	for f := range nodeFields {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+	return errored.Errorf("unknown node field %q. Valid fields are: %s", field, strings.Join(fields, ","))
+}
+
+// hasTags checks if the node has all the specified tags with matching values
+func (n *node) hasTags(tags map[string]string) bool {
+	for k, v := range tags {
+		if val, ok := n.Tags[k]; !ok || val != v {
+			return false
+		}
+	}
+	return true
+}
+
+// nodeFields maps the names of node fields that can be selected in node info
+// to the functions that return the respective field's value
+var nodeFields = map[string]func(n *node) interface{}{
+	"name": func(n *node) interface{} {
+		if n.Mon == nil {
+			return ""
+		}
+		return n.Mon.GetLabel()
+	},
+	"serial": func(n *node) interface{} {
+		if n.Mon == nil {
+			return ""
+		}
+		return n.Mon.GetSerial()
+	},
+	"addr": func(n *node) interface{} {
+		if n.Mon == nil {
+			return ""
+		}
+		return n.Mon.GetMgmtAddress()
+	},
+	"status": func(n *node) interface{} {
+		if n.Inv == nil {
+			return ""
+		}
+		status, _ := n.Inv.GetStatus()
+		return status.String()
+	},
+	"state": func(n *node) interface{} {
+		if n.Inv == nil {
+			return ""
+		}
+		_, state := n.Inv.GetStatus()
+		return state.String()
+	},
+	"host_group": func(n *node) interface{} {
+		if n.Cfg == nil {
+			return ""
+		}
+		return n.Cfg.GetGroup()
+	},
+	"host_groups": func(n *node) interface{} {
+		if n.Cfg == nil {
+			return []string{}
+		}
+		return n.Cfg.GetGroups()
+	},
+	"tags": func(n *node) interface{} {
+		return n.Tags
+	},
+	"annotations": func(n *node) interface{} {
+		return n.Annotations
+	},
+	"labels": func(n *node) interface{} {
+		return n.Labels
+	},
+	"version": func(n *node) interface{} {
+		return n.Version
+	},
+	"target_version": func(n *node) interface{} {
+		return n.TargetVersion
+	},
+	"reachability": func(n *node) interface{} {
+		return n.Reachability
+	},
+	"unmanaged": func(n *node) interface{} {
+		return n.isUnmanaged()
+	},
+	"maintenance": func(n *node) interface{} {
+		return n.Maintenance
+	},
+}
+
+// validateNodeFields checks that the specified fields can be selected in node info
+func validateNodeFields(fields []string) error {
+	for _, field := range fields {
+		if _, ok := nodeFields[field]; !ok {
+			return errInvalidNodeField(field)
+		}
+	}
+	return nil
+}
+
+// selectFields returns the node's info limited to the specified fields. It
+// returns the node itself if no fields are specified.
+func (n *node) selectFields(fields []string) interface{} {
+	if len(fields) == 0 {
+		return nodeInfo{node: n, Unmanaged: n.isUnmanaged()}
+	}
+	info := map[string]interface{}{}
+	for _, field := range fields {
+		info[field] = nodeFields[field](n)
+	}
+	return info
+}
+
 func (m *Manager) isMasterNode(name string) (bool, error) {
 	n, err := m.findNode(name)
 	if err != nil {
@@ -43,7 +266,7 @@ func (m *Manager) isMasterNode(name string) (bool, error) {
 	if n.Cfg == nil {
 		return false, nodeConfigNotExistsError(name)
 	}
-	return n.Cfg.GetGroup() == ansibleMasterGroupName, nil
+	return inHostGroup(n.Cfg.GetGroups(), ansibleMasterGroupName), nil
 }
 
 func (m *Manager) isWorkerNode(name string) (bool, error) {
@@ -54,7 +277,7 @@ func (m *Manager) isWorkerNode(name string) (bool, error) {
 	if n.Cfg == nil {
 		return false, nodeConfigNotExistsError(name)
 	}
-	return n.Cfg.GetGroup() == ansibleWorkerGroupName, nil
+	return inHostGroup(n.Cfg.GetGroups(), ansibleWorkerGroupName), nil
 }
 
 func (m *Manager) isDiscoveredNode(name string) (bool, error) {
@@ -100,56 +323,331 @@ func (m *Manager) isDiscoveredAndAllocatedNode(name string) (bool, error) {
 	return state == inventory.Discovered && status == inventory.Allocated, nil
 }
 
+// isUnmanaged checks if the node is discovered by the monitoring subsystem but
+// is not commissioned yet, i.e. it's a candidate awaiting commission
+func (n *node) isUnmanaged() bool {
+	if n.Inv == nil {
+		return false
+	}
+	status, state := n.Inv.GetStatus()
+	return state == inventory.Discovered && status == inventory.Unallocated
+}
+
 type setInvStateCallback func(name string) error
 
 // tries to set the newStatus as state of all assets, it continues on failures
 func (m *Manager) setAssetsStatusBestEffort(names []string, newStatusCb setInvStateCallback) {
 	for _, name := range names {
+		publish := m.trackNodeState(name)
 		if err := newStatusCb(name); err != nil {
 			logrus.Errorf("failed to update %s's state in inventory, Error: %v", name, err)
 			continue
 		}
+		publish()
 	}
 }
 
 // try to atomically set the newStatus as state of all assets or revert to revertStatus in case of failure
 func (m *Manager) setAssetsStatusAtomic(names []string, newStatusCb setInvStateCallback, revertStatusCb setInvStateCallback) error {
 	for i, name := range names {
+		publish := m.trackNodeState(name)
 		if err := newStatusCb(name); err != nil {
 			// try to revert back to original state in case of failure
 			m.setAssetsStatusBestEffort(names[0:i+1], revertStatusCb)
 			return errored.Errorf("failed to update %s's state in inventory, Error: %v", name, err)
 		}
+		publish()
 	}
 	return nil
 }
 
-// checkAndGetNewJob() is a wrapper to check that there are no active jobs before a job is run
-func (m *Manager) checkAndSetActiveJob(jobDesc string, runner JobRunner, doneCb DoneCallback) error {
-	if m.activeJob != nil {
-		return errActiveJob(m.activeJob.String())
+// checkAndSetActiveJob() is a wrapper to check that a job can be run before it
+// is made active. A job can run alongside other active jobs as long as the number
+// of active jobs is within the configured job workers and the job doesn't act
+// upon any of the nodes that other active jobs act upon. The job is cancelled if
+// it runs longer than the specified timeout or, if it is zero, the configured
+// job timeout.
+func (m *Manager) checkAndSetActiveJob(jobDesc string, nodeNames []string, timeout time.Duration,
+	runner JobRunner, doneCb DoneCallback) (*Job, error) {
+	if timeout == 0 {
+		timeout = m.jobTimeout()
 	}
-	m.activeJob = NewJob(jobDesc, runner, doneCb)
-	return nil
+	return m.setActiveJob(jobDesc, nodeNames, false, timeout, runner, doneCb, nil)
+}
+
+// checkAndSetExclusiveJob() is a wrapper to check that there are no active jobs
+// before a job, that can't run alongside other jobs, is run
+func (m *Manager) checkAndSetExclusiveJob(jobDesc string, runner JobRunner, doneCb DoneCallback) (*Job, error) {
+	return m.setActiveJob(jobDesc, nil, true, 0, runner, doneCb, nil)
+}
+
+// setActiveJob creates the job and makes it active, if it can be run. The job
+// is initialized by initJob, if set, before it is made active
+func (m *Manager) setActiveJob(jobDesc string, nodeNames []string, exclusive bool,
+	timeout time.Duration, runner JobRunner, doneCb DoneCallback, initJob func(j *Job)) (*Job, error) {
+	m.jobsMutex.Lock()
+	defer m.jobsMutex.Unlock()
+	for _, aj := range m.activeJobs {
+		if exclusive || aj.exclusive || len(m.activeJobs) >= m.jobWorkers() {
+			return nil, errActiveJob(aj.String())
+		}
+		for _, name := range nodeNames {
+			if aj.actsUpon(name) {
+				return nil, errConflictingJob(name, aj.String())
+			}
+		}
+	}
+
+	j := NewJob(jobDesc, runner, doneCb)
+	j.exclusive = exclusive
+	j.timeout = timeout
+	j.setNodes(nodeNames)
+	if initJob != nil {
+		initJob(j)
+	}
+	if j.id == 0 {
+		// the job is assigned the next id, unless an id was reserved for it
+		m.jobSeq++
+		j.id = m.jobSeq
+	}
+	if m.activeJobs == nil {
+		m.activeJobs = make(map[uint64]*Job)
+	}
+	m.activeJobs[j.id] = j
+	return j, nil
+}
+
+// jobWorkers returns the number of jobs that are allowed to run concurrently
+func (m *Manager) jobWorkers() int {
+	config := m.getConfig()
+	if config == nil || config.Manager.JobWorkers < 1 {
+		return 1
+	}
+	return config.Manager.JobWorkers
+}
+
+// jobTimeout returns the configured duration after which a job is cancelled.
+// It is zero if jobs are not timed out
+func (m *Manager) jobTimeout() time.Duration {
+	config := m.getConfig()
+	if config == nil || config.Manager.JobTimeout == "" {
+		return 0
+	}
+	// the value is validated when the manager is initialized
+	timeout, _ := time.ParseDuration(config.Manager.JobTimeout)
+	return timeout
+}
+
+// monitorEnqueueTimeout returns the configured duration for which a monitor
+// event waits for room in the request queue. It is zero if the event doesn't wait
+func (m *Manager) monitorEnqueueTimeout() time.Duration {
+	config := m.getConfig()
+	if config == nil || config.Manager.MonitorEnqueueTimeout == "" {
+		return 0
+	}
+	// the value is validated when the manager is initialized
+	timeout, _ := time.ParseDuration(config.Manager.MonitorEnqueueTimeout)
+	return timeout
 }
 
-// resetActiveJob() is a helper to reset active jobs if any
-func (m *Manager) resetActiveJob() {
-	if m.activeJob != nil {
-		m.lastJob = m.activeJob
+// serverTimeouts returns the configured timeouts of the api server, for reading
+// the request headers, writing the responses and writing the responses of the
+// requests that trigger a job. A timeout is zero if it is not configured
+func (m *Manager) serverTimeouts() (readHeader, write, jobWrite time.Duration) {
+	if m.config == nil {
+		return 0, 0, 0
 	}
-	m.activeJob = nil
+	// the values are validated when the manager is initialized
+	readHeader, _ = parseTimeout(m.config.Manager.ReadHeaderTimeout)
+	write, _ = parseTimeout(m.config.Manager.WriteTimeout)
+	jobWrite, _ = parseTimeout(m.config.Manager.JobWriteTimeout)
+	return readHeader, write, jobWrite
+}
+
+// ansibleForks returns the number of nodes that a job configures in parallel.
+// The configured default is returned if forks is zero
+func (m *Manager) ansibleForks(forks int) int {
+	if forks > 0 {
+		return forks
+	}
+	config := m.getConfig()
+	if config == nil || config.Manager.AnsibleForks < 1 {
+		return DefaultConfig().Manager.AnsibleForks
+	}
+	return config.Manager.AnsibleForks
+}
+
+// configurationWithForks returns the configuration subsystem that configures
+// the specified number of nodes in parallel, if the subsystem supports it
+func (m *Manager) configurationWithForks(forks int) configuration.Subsys {
+	if l, ok := m.configuration.(configuration.ForksLimiter); ok {
+		return l.WithForks(m.ansibleForks(forks))
+	}
+	return m.configuration
+}
+
+// resetActiveJob() is a helper to reset an active job and record it as the last job
+func (m *Manager) resetActiveJob(j *Job) {
+	m.jobsMutex.Lock()
+	delete(m.activeJobs, j.id)
+	m.lastJob = j
+	// the events held on the job can be processed now
+	m.releaseHeldEvents()
+	m.jobsMutex.Unlock()
+
+	m.saveJob(j)
+	m.addToJobHistory(j)
+	m.recordJobOutcome(j)
 }
 
 // runActiveJob() is a wrapper to run the job and reset the active job once the actual job is done
-func (m *Manager) runActiveJob() {
-	if m.activeJob == nil {
-		logrus.Errorf("run called without an active job")
+func (m *Manager) runActiveJob(j *Job) {
+	// record the job before running it, so it's known as interrupted if clusterm stops meanwhile
+	m.saveJob(j)
+	j.Run()
+	// reset the active job once done
+	m.resetActiveJob(j)
+}
+
+// inFlightKey returns the key that identifies the identical requests for a job,
+// irrespective of the order of nodes in them
+func inFlightKey(task string, nodeNames []string, hostGroup, playbook, extraVars string) string {
+	names := append([]string{}, nodeNames...)
+	sort.Strings(names)
+	return fmt.Sprintf("%s nodes:%v host-group:%q playbook:%q extra-vars:%s",
+		task, names, hostGroup, playbook, extraVars)
+}
+
+// findInFlightJob returns the active job triggered by a request identified
+// by the key, if any
+func (m *Manager) findInFlightJob(key string) *Job {
+	m.jobsMutex.Lock()
+	defer m.jobsMutex.Unlock()
+	return m.inFlightJob(key)
+}
+
+// inFlightJob is findInFlightJob for the callers that hold the jobsMutex
+func (m *Manager) inFlightJob(key string) *Job {
+	for _, j := range m.activeJobs {
+		if j.inFlightKey == key {
+			return j
+		}
+	}
+	return nil
+}
+
+// newPendingJob reserves a job id and returns a placeholder job with that id
+// for a request, until the request's event is processed. The placeholder job
+// records the request's idempotency key, if any, and is initialized by
+// initJob, if set, before it is made pending. If a job was already triggered
+// by a request with the same idempotency key, that job is returned instead
+// and no id is reserved. The key is looked up and reserved together, so that
+// the concurrent retries of a request don't trigger a job each
+func (m *Manager) newPendingJob(desc, idempotencyKey string, initJob func(j *Job)) (j *Job, reserved bool) {
+	m.jobsMutex.Lock()
+	defer m.jobsMutex.Unlock()
+	if idempotencyKey != "" {
+		if j := m.jobByIdempotencyKey(idempotencyKey); j != nil {
+			return j, false
+		}
+	}
+	j = NewJob(desc, nil, nil)
+	j.idempotencyKey = idempotencyKey
+	if initJob != nil {
+		initJob(j)
+	}
+	m.jobSeq++
+	j.id = m.jobSeq
+	if m.pendingJobs == nil {
+		m.pendingJobs = make(map[uint64]*Job)
+	}
+	m.pendingJobs[j.id] = j
+	return j, true
+}
+
+// removePendingJob removes the placeholder job of a request that failed to be queued
+func (m *Manager) removePendingJob(pending *Job) {
+	m.jobsMutex.Lock()
+	defer m.jobsMutex.Unlock()
+	delete(m.pendingJobs, pending.id)
+}
+
+// resolvePendingJob removes the placeholder job once the request's event is
+// processed. If the event failed, the failure is recorded in the status of
+// the triggered job, or of the placeholder job if no job was triggered.
+func (m *Manager) resolvePendingJob(pending, triggered *Job, err error) {
+	m.jobsMutex.Lock()
+	delete(m.pendingJobs, pending.id)
+	m.jobsMutex.Unlock()
+
+	if err == nil && triggered != nil && triggered.id != pending.id {
+		// the request was served by an identical job that was already active
+		pending.Lock()
+		pending.status = Complete
+		pending.logs.WriteString(fmt.Sprintf("the request was served by identical job %d", triggered.id))
+		pending.Unlock()
+		m.saveJob(pending)
+		m.addToJobHistory(pending)
 		return
 	}
-	m.activeJob.Run()
-	// reset the active job once done
-	m.resetActiveJob()
+	if err == nil {
+		return
+	}
+
+	j := triggered
+	if j == nil {
+		j = pending
+		m.addToJobHistory(j)
+	}
+	j.Lock()
+	j.status = Errored
+	j.errVal = err
+	j.Unlock()
+	m.saveJob(j)
+}
+
+// getActiveJobs returns the active jobs, most recently started first
+func (m *Manager) getActiveJobs() []*Job {
+	m.jobsMutex.Lock()
+	defer m.jobsMutex.Unlock()
+	jobs := make([]*Job, 0, len(m.activeJobs))
+	for _, j := range m.activeJobs {
+		jobs = append(jobs, j)
+	}
+	sort.Sort(byJobIDDesc(jobs))
+	return jobs
+}
+
+// getLastJob returns the most recently finished job
+func (m *Manager) getLastJob() *Job {
+	m.jobsMutex.Lock()
+	defer m.jobsMutex.Unlock()
+	return m.lastJob
+}
+
+type byJobIDDesc []*Job
+
+func (s byJobIDDesc) Len() int           { return len(s) }
+func (s byJobIDDesc) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byJobIDDesc) Less(i, j int) bool { return s[i].id > s[j].id }
+
+// inHostGroup returns true if the group is one of the host-groups
+func inHostGroup(hostGroups []string, group string) bool {
+	for _, g := range hostGroups {
+		if g == group {
+			return true
+		}
+	}
+	return false
+}
+
+// joinHostGroups returns the primary host-group followed by the extra ones
+func joinHostGroups(hostGroup string, extraGroups []string) []string {
+	groups := []string{}
+	if hostGroup != "" {
+		groups = append(groups, hostGroup)
+	}
+	return append(groups, extraGroups...)
 }
 
 // IsValidHostGroup checks if the passed hostGroup is valid
@@ -3,6 +3,9 @@
 package manager
 
 import (
+	"io/ioutil"
+	"os"
+
 	"github.com/contiv/errored"
 	. "gopkg.in/check.v1"
 )
@@ -64,3 +67,150 @@ func (s *eventUtilsSuite) TestSetStatusBestEffortFailure(c *C) {
 	mgr.setAssetsStatusBestEffort(strs, failureCb(&setStrs, 2))
 	c.Assert(strs, DeepEquals, setStrs)
 }
+
+func (s *eventUtilsSuite) TestCheckAndSetActiveJob(c *C) {
+	config := DefaultConfig()
+	config.Manager.JobWorkers = 2
+	m := &Manager{config: config}
+
+	j1, err := m.checkAndSetActiveJob("job1", []string{"node1", "node2"}, 0, nil, nil)
+	c.Assert(err, IsNil)
+	// a job on overlapping nodes can't run alongside
+	_, err = m.checkAndSetActiveJob("job2", []string{"node3", "node2"}, 0, nil, nil)
+	c.Assert(err, NotNil)
+	c.Assert(err.Error(), Equals, errConflictingJob("node2", j1.String()).Error())
+	// an exclusive job can't run alongside
+	_, err = m.checkAndSetExclusiveJob("job2", nil, nil)
+	c.Assert(err, NotNil)
+	j2, err := m.checkAndSetActiveJob("job2", []string{"node3"}, 0, nil, nil)
+	c.Assert(err, IsNil)
+	// no more jobs than the job workers can run
+	_, err = m.checkAndSetActiveJob("job3", []string{"node4"}, 0, nil, nil)
+	c.Assert(err, NotNil)
+
+	jobs := m.getActiveJobs()
+	c.Assert(len(jobs), Equals, 2)
+	c.Assert(jobs[0], Equals, j2)
+
+	m.resetActiveJob(j1)
+	m.resetActiveJob(j2)
+	c.Assert(m.getLastJob(), Equals, j2)
+	j3, err := m.checkAndSetExclusiveJob("job3", nil, nil)
+	c.Assert(err, IsNil)
+	// no job can run alongside an exclusive job
+	_, err = m.checkAndSetActiveJob("job4", []string{"node4"}, 0, nil, nil)
+	c.Assert(err, NotNil)
+	c.Assert(err.Error(), Equals, errActiveJob(j3.String()).Error())
+}
+
+func (s *eventUtilsSuite) TestNormalizeListenAddr(c *C) {
+	valid := map[string]string{
+		":9999":              ":9999",
+		"9999":               ":9999",
+		"0.0.0.0:9999":       "0.0.0.0:9999",
+		"[::1]:9999":         "[::1]:9999",
+		"[fe80::1%eth0]:999": "[fe80::1%eth0]:999",
+		"localhost:9999":     "localhost:9999",
+		"unix:/tmp/sock":     "unix:/tmp/sock",
+	}
+	for addr, exptd := range valid {
+		normalized, err := normalizeListenAddr(addr)
+		c.Assert(err, IsNil, Commentf("addr: %s", addr))
+		c.Assert(normalized, Equals, exptd, Commentf("addr: %s", addr))
+	}
+
+	for _, addr := range []string{"::1:9999", "1.1.1.1", "1.1.1.1:foo", ":99999", "[1::2::3]:9999", "[1.1.1.1%eth0]:9999"} {
+		_, err := normalizeListenAddr(addr)
+		c.Assert(err, NotNil, Commentf("addr: %s", addr))
+	}
+}
+
+func (s *eventUtilsSuite) TestNormalizeBasePath(c *C) {
+	valid := map[string]string{
+		"":           "",
+		"/":          "",
+		"/clusterm":  "/clusterm",
+		"clusterm/":  "/clusterm",
+		" /api/v1/ ": "/api/v1",
+		"/a.b/c-d_e": "/a.b/c-d_e",
+	}
+	for basePath, exptd := range valid {
+		normalized, err := normalizeBasePath(basePath)
+		c.Assert(err, IsNil, Commentf("base path: %s", basePath))
+		c.Assert(normalized, Equals, exptd, Commentf("base path: %s", basePath))
+	}
+
+	for _, basePath := range []string{"/a//b", "/a/../b", "/a?b=c", "/a#b", "/{tag}", "/a b"} {
+		_, err := normalizeBasePath(basePath)
+		c.Assert(err, NotNil, Commentf("base path: %s", basePath))
+	}
+}
+
+func (s *eventUtilsSuite) TestURLHost(c *C) {
+	for addr, exptd := range map[string]string{
+		"[::1]:9999":     "[::1]:9999",
+		"::1":            "[::1]",
+		"1.1.1.1:9999":   "1.1.1.1:9999",
+		"localhost:9999": "localhost:9999",
+	} {
+		c.Assert(urlHost(addr), Equals, exptd, Commentf("addr: %s", addr))
+	}
+}
+
+func (s *eventUtilsSuite) TestInFlightRequestDedup(c *C) {
+	m := &Manager{config: DefaultConfig()}
+	j, err := m.checkAndSetActiveJob("job1", []string{"node1", "node2"}, 0, nil, nil)
+	c.Assert(err, IsNil)
+	j.inFlightKey = inFlightKey("commission", []string{"node1", "node2"}, ansibleMasterGroupName, "", "{}")
+
+	// an identical request, irrespective of the nodes order, shares the active job
+	e := newCommissionEvent(m, []string{"node2", "node1"}, "{}", ansibleMasterGroupName, "", 0)
+	c.Assert(e.process(), IsNil)
+	c.Assert(m.getActiveJobs(), DeepEquals, []*Job{j})
+
+	// a request that is not identical conflicts with the active job
+	e = newCommissionEvent(m, []string{"node2", "node1"}, "{}", ansibleWorkerGroupName, "", 0)
+	c.Assert(e.process(), NotNil)
+	u := newUpdateEvent(m, []string{"node2", "node1"}, "{}", ansibleMasterGroupName, "", 0)
+	c.Assert(u.process(), NotNil)
+}
+
+func (s *eventUtilsSuite) TestAnsibleForks(c *C) {
+	m := &Manager{}
+	c.Assert(m.ansibleForks(0), Equals, DefaultConfig().Manager.AnsibleForks)
+	c.Assert(m.ansibleForks(20), Equals, 20)
+
+	m.config = DefaultConfig()
+	m.config.Manager.AnsibleForks = 50
+	c.Assert(m.ansibleForks(0), Equals, 50)
+	c.Assert(m.ansibleForks(20), Equals, 20)
+
+	// the job records the effective forks in it's summary
+	t := &jobTrigger{}
+	j, err := t.checkAndSetActiveJob(m, "", nil, 0, nil, nil)
+	c.Assert(err, IsNil)
+	j.summarize()
+	c.Assert(j.Summary().Forks, Equals, 50)
+}
+
+func (s *eventUtilsSuite) TestReadDebugToken(c *C) {
+	f, err := ioutil.TempFile("", "debug-token")
+	c.Assert(err, IsNil)
+	defer os.Remove(f.Name())
+
+	// empty token file
+	_, err = readDebugToken(f.Name())
+	c.Assert(err, NotNil)
+
+	_, err = f.WriteString("secret\n")
+	c.Assert(err, IsNil)
+	c.Assert(f.Close(), IsNil)
+	token, err := readDebugToken(f.Name())
+	c.Assert(err, IsNil)
+	c.Assert(token, Equals, "secret")
+
+	for _, file := range []string{"", f.Name() + "-nonexistent"} {
+		_, err = readDebugToken(file)
+		c.Assert(err, NotNil, Commentf("file: %s", file))
+	}
+}
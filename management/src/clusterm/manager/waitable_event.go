@@ -1,6 +1,9 @@
 package manager
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+)
 
 // waitableEvent provides a way to wait for event's processing to complete
 // and return the event's processing status.
@@ -10,13 +13,22 @@ import "fmt"
 type waitableEvent struct {
 	inEvent  event
 	statusCh chan error
+	timeout  time.Duration
 }
 
 // newWaitableEvent creates and returns waitableEvent event
 func newWaitableEvent(e event) *waitableEvent {
+	return newWaitableEventWithTimeout(e, 0)
+}
+
+// newWaitableEventWithTimeout creates and returns waitableEvent event, the wait on
+// which times out after specified duration. A zero timeout waits forever.
+func newWaitableEventWithTimeout(e event, timeout time.Duration) *waitableEvent {
 	return &waitableEvent{
-		inEvent:  e,
-		statusCh: make(chan error),
+		inEvent: e,
+		// the channel is buffered so the processing doesn't block if the wait timed out
+		statusCh: make(chan error, 1),
+		timeout:  timeout,
 	}
 }
 
@@ -33,9 +45,29 @@ func (e *waitableEvent) process() error {
 	return err
 }
 
+func (e *waitableEvent) wrapped() event {
+	return e.inEvent
+}
+
+func (e *waitableEvent) abort(err error) {
+	if we, ok := e.inEvent.(wrapperEvent); ok {
+		we.abort(err)
+	}
+	e.statusCh <- err
+}
+
+// waitForCompletion waits for the event's processing to complete and returns it's
+// status. It returns a TimeoutError if the wait times out. Note that the event
+// is still processed after the wait times out.
 func (e *waitableEvent) waitForCompletion() error {
+	var timeoutCh <-chan time.Time
+	if e.timeout > 0 {
+		timeoutCh = time.After(e.timeout)
+	}
 	select {
 	case err := <-e.statusCh:
 		return err
+	case <-timeoutCh:
+		return &TimeoutError{desc: fmt.Sprintf("timed out after %s waiting for %s to be processed", e.timeout, e.inEvent)}
 	}
 }
@@ -0,0 +1,205 @@
+package manager
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// yamlContentType is the media type of the YAML responses
+const yamlContentType = "application/yaml"
+
+// yamlMediaTypes are the media types that a client can accept to get a YAML response
+var yamlMediaTypes = map[string]struct{}{
+	yamlContentType:      {},
+	"application/x-yaml": {},
+	"text/yaml":          {},
+}
+
+// yamlPlainRegexp matches the strings that can be written as plain YAML scalars
+var yamlPlainRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_./-]*$`)
+
+// yamlReservedWords are the plain scalars that YAML parsers may not read as strings
+var yamlReservedWords = map[string]struct{}{
+	"true": {}, "false": {}, "yes": {}, "no": {}, "on": {}, "off": {},
+	"y": {}, "n": {}, "null": {},
+}
+
+// acceptsYAML returns true if the request prefers a YAML response over JSON,
+// as indicated by it's Accept header
+func acceptsYAML(r *http.Request) bool {
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType := strings.ToLower(strings.TrimSpace(strings.Split(accept, ";")[0]))
+		if _, ok := yamlMediaTypes[mediaType]; ok {
+			return true
+		}
+		if mediaType == "application/json" {
+			return false
+		}
+	}
+	return false
+}
+
+// bufferedResponseWriter holds back the response written through it
+type bufferedResponseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *bufferedResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *bufferedResponseWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+}
+
+func (w *bufferedResponseWriter) Write(b []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.body.Write(b)
+}
+
+// yamlNegotiated wraps a handler of a JSON response to return the response as
+// YAML for the requests that accept it.
+// Note: this reads the complete response before writing it, so it shall not
+// be used with streaming responses.
+func yamlNegotiated(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept")
+		if !acceptsYAML(r) {
+			h(w, r)
+			return
+		}
+
+		bw := &bufferedResponseWriter{header: w.Header()}
+		h(bw, r)
+		if bw.status == 0 {
+			bw.status = http.StatusOK
+		}
+		if bw.status != http.StatusOK {
+			// errors and responses without a body are passed as is
+			w.WriteHeader(bw.status)
+			if _, err := w.Write(bw.body.Bytes()); err != nil {
+				logrus.Errorf("failed to write response bytes '%s'. Error: %v", bw.body.Bytes(), err)
+			}
+			return
+		}
+
+		out, err := jsonToYAML(bw.body.Bytes())
+		if err != nil {
+			w.Header().Del("ETag")
+			writeError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", yamlContentType)
+		if _, err := w.Write(out); err != nil {
+			logrus.Errorf("failed to write response bytes '%s'. Error: %v", out, err)
+		}
+	}
+}
+
+// jsonToYAML converts a JSON document to YAML. The mapping keys are sorted in
+// the YAML document.
+func jsonToYAML(data []byte) ([]byte, error) {
+	var v interface{}
+	d := json.NewDecoder(bytes.NewReader(data))
+	// preserve the numbers as is
+	d.UseNumber()
+	if err := d.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	switch val := v.(type) {
+	case map[string]interface{}:
+		if len(val) > 0 {
+			writeYAMLMap(&buf, val, "")
+			return buf.Bytes(), nil
+		}
+	case []interface{}:
+		if len(val) > 0 {
+			writeYAMLSeq(&buf, val, "")
+			return buf.Bytes(), nil
+		}
+	}
+	buf.WriteString(yamlScalar(v) + "\n")
+	return buf.Bytes(), nil
+}
+
+func writeYAMLMap(buf *bytes.Buffer, m map[string]interface{}, indent string) {
+	keys := []string{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		buf.WriteString(indent + yamlString(k) + ":")
+		writeYAMLValue(buf, m[k], indent)
+	}
+}
+
+func writeYAMLSeq(buf *bytes.Buffer, s []interface{}, indent string) {
+	for _, item := range s {
+		buf.WriteString(indent + "-")
+		writeYAMLValue(buf, item, indent)
+	}
+}
+
+// writeYAMLValue writes the value of a mapping key or a sequence entry, whose
+// key or '-' indicator is already written at the specified indentation
+func writeYAMLValue(buf *bytes.Buffer, v interface{}, indent string) {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		if len(val) > 0 {
+			buf.WriteString("\n")
+			writeYAMLMap(buf, val, indent+"  ")
+			return
+		}
+	case []interface{}:
+		if len(val) > 0 {
+			buf.WriteString("\n")
+			writeYAMLSeq(buf, val, indent+"  ")
+			return
+		}
+	}
+	buf.WriteString(" " + yamlScalar(v) + "\n")
+}
+
+// yamlScalar returns the flow representation of a scalar or an empty collection
+func yamlScalar(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return strconv.FormatBool(val)
+	case json.Number:
+		return val.String()
+	case string:
+		return yamlString(val)
+	case map[string]interface{}:
+		return "{}"
+	case []interface{}:
+		return "[]"
+	}
+	// not reached for the values decoded from JSON
+	return "null"
+}
+
+// yamlString returns the string as a plain scalar if it can't be read as
+// another type, else as a double quoted scalar
+func yamlString(s string) string {
+	if _, ok := yamlReservedWords[strings.ToLower(s)]; !ok && yamlPlainRegexp.MatchString(s) {
+		return s
+	}
+	// the escapes in a go quoted string are valid in a YAML double quoted scalar
+	return strconv.Quote(s)
+}
@@ -127,6 +127,39 @@ func (c *Client) GetAsset(tag string) (Asset, error) {
 	return collinsResp.Data.Asset, nil
 }
 
+// DeleteAsset deletes the asset with specified tag
+func (c *Client) DeleteAsset(tag string) error {
+	params := &url.Values{}
+	params.Set("reason", "removed by clusterm")
+
+	reqURL := c.config.URL + "/api/asset/" + tag + "?" + params.Encode()
+	req, err := http.NewRequest("DELETE", reqURL, nil)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(c.config.User, c.config.Password)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			body = []byte{}
+		}
+		return errored.Errorf("status code %d unexpected. Response body: %q",
+			resp.StatusCode, body)
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		logrus.Warnf("asset %q doesn't exist", tag)
+	}
+
+	return nil
+}
+
 // GetAllAssets queries and returns a all the assets
 func (c *Client) GetAllAssets() (interface{}, error) {
 	reqURL := c.config.URL + "/api/assets"
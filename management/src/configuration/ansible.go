@@ -1,8 +1,11 @@
 package configuration
 
 import (
+	"crypto/sha256"
 	"encoding/json"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"strings"
 
 	"golang.org/x/net/context"
@@ -19,25 +22,62 @@ type AnsibleSubsysConfig struct {
 	UpgradePlaybook   string `json:"upgrade_playbook"`
 	PlaybookLocation  string `json:"playbook_location"`
 	ExtraVariables    string `json:"extra_variables"`
+	// AllowedPlaybooks lists the playbooks, in addition to the configure, cleanup
+	// and upgrade playbooks, that can be requested to be run on a per event basis.
+	AllowedPlaybooks []string `json:"allowed_playbooks,omitempty"`
+	// DrainPlaybook, if set, is run to drain the workloads from nodes before they
+	// are decommissioned. The playbook is expected to finish once the nodes are empty.
+	DrainPlaybook string `json:"drain_playbook,omitempty"`
+	// RebootPlaybook, if set, is run to reboot the nodes on a reboot request.
+	RebootPlaybook string `json:"reboot_playbook,omitempty"`
+	// VerifyPlaybook, if set, is run to verify the nodes once they are configured
+	// on a commission request, like that their services are up. The nodes that
+	// fail the verification are not commissioned.
+	VerifyPlaybook string `json:"verify_playbook,omitempty"`
+	// VaultPasswordFile is the file with the password of the ansible-vault, that
+	// the vault encrypted extra vars are decrypted with. The encrypted extra vars
+	// are not accepted if it is not set
+	VaultPasswordFile string `json:"vault_password_file,omitempty"`
 	// XXX: revisit the user credential configuration. We may need to allow other provisions.
 	User        string `json:"user"`
 	PrivKeyFile string `json:"priv_key_file"`
+	// SSHKeys is the keystore of the private keys, other than the default one,
+	// that the nodes can be connected with on a per event basis. The keys are
+	// referred to by their name, the private key file is never exposed
+	SSHKeys map[string]string `json:"ssh_keys,omitempty"`
 }
 
 // AnsibleSubsys implements the configuration subsystem based on ansible
 type AnsibleSubsys struct {
 	config          *AnsibleSubsysConfig
 	globalExtraVars string
+	// forks is the number of hosts that the playbooks are run on in parallel.
+	// The ansible's default is used if it is zero
+	forks int
+	// check, when true, runs the playbooks in check mode
+	check bool
+	// user and keyRef, if set, are the user and the reference of the private
+	// key in the keystore that the nodes are connected with, instead of the
+	// configured ones
+	user   string
+	keyRef string
 }
 
 // AnsibleHost describes host related info relevant for ansible inventory
 type AnsibleHost struct {
 	addr  string
 	group string
-	tag   string
-	vars  map[string]string
+	// extraGroups are the groups the host belongs to, in addition to it's group
+	extraGroups []string
+	tag         string
+	vars        map[string]string
 }
 
+// AnsibleInventory is an ansible inventory in INI format. When it's passed as
+// the hosts of a run, it's used as is instead of an inventory generated from
+// the managed hosts
+type AnsibleInventory string
+
 // NewAnsibleHost instantiates and returns AnsibleHost
 func NewAnsibleHost(tag, addr, group string, vars map[string]string) *AnsibleHost {
 	return &AnsibleHost{
@@ -58,28 +98,67 @@ func (h *AnsibleHost) GetGroup() string {
 	return h.group
 }
 
+// GetGroups returns all the ansible inventory groups of the host, starting with
+// the one returned by GetGroup
+func (h *AnsibleHost) GetGroups() []string {
+	return append([]string{h.group}, h.extraGroups...)
+}
+
+// SetAddr sets the address that the host is connected at
+func (h *AnsibleHost) SetAddr(addr string) {
+	h.addr = addr
+}
+
 // SetVar sets a host variable value
 func (h *AnsibleHost) SetVar(key, val string) {
 	h.vars[key] = val
 }
 
-// SetGroup sets the host's group
+// Clone returns a copy of the host. The copy's variables and group can be set
+// without affecting the host, like for the variables that apply to a single run
+func (h *AnsibleHost) Clone() *AnsibleHost {
+	vars := make(map[string]string, len(h.vars))
+	for k, v := range h.vars {
+		vars[k] = v
+	}
+	c := NewAnsibleHost(h.tag, h.addr, h.group, vars)
+	c.extraGroups = append([]string(nil), h.extraGroups...)
+	return c
+}
+
+// SetGroup sets the host's group. The host is removed from rest of the groups
 func (h *AnsibleHost) SetGroup(group string) {
-	h.group = group
+	h.SetGroups([]string{group})
+}
+
+// SetGroups sets the groups of the host. The first group is the one returned
+// by GetGroup
+func (h *AnsibleHost) SetGroups(groups []string) {
+	h.group, h.extraGroups = "", nil
+	if len(groups) > 0 {
+		h.group = groups[0]
+		h.extraGroups = append(h.extraGroups, groups[1:]...)
+	}
 }
 
 // MarshalJSON satisfies the json marshaller interface and shall encode asset info in json
 func (h *AnsibleHost) MarshalJSON() ([]byte, error) {
+	var hostGroups []string
+	if len(h.extraGroups) > 0 {
+		hostGroups = h.GetGroups()
+	}
 	return json.Marshal(struct {
-		Tag       string            `json:"inventory_name"`
-		HostGroup string            `json:"host_group"`
-		Addr      string            `json:"ssh_address"`
-		Vars      map[string]string `json:"inventory_vars"`
+		Tag        string            `json:"inventory_name"`
+		HostGroup  string            `json:"host_group"`
+		HostGroups []string          `json:"host_groups,omitempty"`
+		Addr       string            `json:"ssh_address"`
+		Vars       map[string]string `json:"inventory_vars"`
 	}{
-		Tag:       h.tag,
-		HostGroup: h.group,
-		Addr:      h.addr,
-		Vars:      h.vars,
+		Tag:        h.tag,
+		HostGroup:  h.group,
+		HostGroups: hostGroups,
+		Addr:       h.addr,
+		Vars:       h.vars,
 	})
 }
 
@@ -114,69 +193,241 @@ func mergeExtraVars(dst, src string) (string, error) {
 	return string(o), nil
 }
 
-func (a *AnsibleSubsys) ansibleRunner(nodes []*AnsibleHost, playbook, extraVars string) (io.Reader, context.CancelFunc, chan error) {
-	// make error channel buffered, so it doesn't block
-	errCh := make(chan error, 1)
+// IsVaultEncrypted checks if the extra vars are ansible-vault encrypted, instead
+// of plaintext JSON
+func IsVaultEncrypted(extraVars string) bool {
+	return strings.HasPrefix(strings.TrimSpace(extraVars), vaultHeader)
+}
+
+// RedactExtraVars returns the extra vars as is, unless they are vault encrypted
+// in which case a placeholder is returned
+func RedactExtraVars(extraVars string) string {
+	if IsVaultEncrypted(extraVars) {
+		return RedactedVaultVars
+	}
+	return extraVars
+}
 
-	iNodes := []ansible.InventoryHost{}
-	for _, n := range nodes {
-		iNodes = append(iNodes, ansible.NewInventoryHost(n.tag, n.addr, n.group, n.vars))
+// newInventory returns the ansible inventory for the specified hosts
+func newInventory(nodes SubsysHosts) (ansible.Inventory, error) {
+	switch hosts := nodes.(type) {
+	case AnsibleInventory:
+		return ansible.ParseInventory(string(hosts))
+	case []*AnsibleHost:
+		iNodes := []ansible.InventoryHost{}
+		for _, n := range hosts {
+			// a host that belongs to several groups is listed under each of them
+			for _, group := range n.GetGroups() {
+				iNodes = append(iNodes, ansible.NewInventoryHost(n.tag, n.addr, group, n.vars))
+			}
+		}
+		return ansible.NewInventory(iNodes), nil
+	default:
+		return ansible.Inventory{}, errored.Errorf("unexpected hosts of type %T", nodes)
 	}
+}
 
-	// Pick extra variables for ansible, if any.
-	// Merge the variables with following precedence (top one taking higher precedence):
-	// - variables specified per action (i.e. configure, cleanup, upgrade)
-	// - variables specified as globals
-	// - variables specified at configuration time
+// mergedExtraVars picks the extra variables for ansible, if any.
+// Merge the variables with following precedence (top one taking higher precedence):
+// - variables specified per action (i.e. configure, cleanup, upgrade)
+// - variables specified as globals
+// - variables specified at configuration time
+// The vault encrypted variables can't be merged, they are returned as is and
+// take precedence over the plaintext variables in the same order.
+func (a *AnsibleSubsys) mergedExtraVars(extraVars string) (string, []string, error) {
+	var err error
 	vars := DefaultValidJSON
-	vars, err := mergeExtraVars(vars, a.config.ExtraVariables)
+	vaultVars := []string{}
+	for _, v := range []string{a.config.ExtraVariables, a.globalExtraVars, extraVars} {
+		if IsVaultEncrypted(v) {
+			vaultVars = append(vaultVars, v)
+			continue
+		}
+		if vars, err = mergeExtraVars(vars, v); err != nil {
+			return "", nil, err
+		}
+	}
+	return vars, vaultVars, nil
+}
+
+// EffectiveExtraVars returns the plaintext extra vars that an action run with
+// the specified extra vars receives, see mergedExtraVars for the precedence.
+// The returned bool is true if some of the extra vars are vault encrypted, in
+// which case they are not included
+func (a *AnsibleSubsys) EffectiveExtraVars(extraVars string) (string, bool, error) {
+	vars, vaultVars, err := a.mergedExtraVars(extraVars)
+	if err != nil {
+		return "", false, err
+	}
+	return vars, len(vaultVars) > 0, nil
+}
+
+func (a *AnsibleSubsys) ansibleRunner(nodes SubsysHosts, playbook, extraVars string) (io.Reader, context.CancelFunc, chan error) {
+	// make error channel buffered, so it doesn't block
+	errCh := make(chan error, 1)
+
+	inventory, err := newInventory(nodes)
 	if err != nil {
 		errCh <- err
 		return nil, nil, errCh
 	}
-	vars, err = mergeExtraVars(vars, a.globalExtraVars)
+
+	vars, vaultVars, err := a.mergedExtraVars(extraVars)
 	if err != nil {
 		errCh <- err
 		return nil, nil, errCh
 	}
-	vars, err = mergeExtraVars(vars, extraVars)
+	if len(vaultVars) > 0 && a.config.VaultPasswordFile == "" {
+		errCh <- errored.Errorf("vault encrypted extra vars can't be decrypted as no vault password file is configured")
+		return nil, nil, errCh
+	}
+
+	user, privKeyFile, err := a.connection()
 	if err != nil {
 		errCh <- err
 		return nil, nil, errCh
 	}
 
 	ctxt, cancelFunc := context.WithCancel(context.Background())
-	runner := ansible.NewRunner(ansible.NewInventory(iNodes), playbook, a.config.User,
-		a.config.PrivKeyFile, vars, ctxt)
-	r, w := io.Pipe()
-	go func(outStream io.Writer, errCh chan error) {
-		defer r.Close()
-		if err := runner.Run(outStream, outStream); err != nil {
+	runner := ansible.NewRunner(inventory, playbook, user, privKeyFile, vars, ctxt)
+	if len(vaultVars) > 0 {
+		runner.SetVaultVars(vaultVars, a.config.VaultPasswordFile)
+	}
+	runner.SetForks(a.forks)
+	runner.SetCheck(a.check)
+	outR, outW := io.Pipe()
+	errR, errW := io.Pipe()
+	go func(outStream, errStream *io.PipeWriter, errCh chan error) {
+		defer outStream.Close()
+		defer errStream.Close()
+		if err := runner.Run(outStream, errStream); err != nil {
 			errCh <- err
 			return
 		}
 		errCh <- nil
 		return
-	}(w, errCh)
-	return r, cancelFunc, errCh
+	}(outW, errW, errCh)
+	return &ansibleOutput{Reader: outR, stderr: errR}, cancelFunc, errCh
+}
+
+// ansibleOutput provides the stdout and stderr of an ansible run as separate readers
+type ansibleOutput struct {
+	io.Reader
+	stderr io.Reader
+}
+
+// Stderr returns the reader for stderr output of the ansible run
+func (o *ansibleOutput) Stderr() io.Reader {
+	return o.stderr
+}
+
+// WithForks returns a copy of the subsystem that runs the playbooks on at most
+// forks hosts in parallel. The copy is meant for a single run, the globals set
+// on it don't affect the subsystem
+func (a *AnsibleSubsys) WithForks(forks int) Subsys {
+	c := *a
+	c.forks = forks
+	return &c
+}
+
+// WithCheck returns a copy of the subsystem that runs the playbooks in check
+// mode, with the diff of the changes. Like WithForks, the copy is meant for a
+// single run
+func (a *AnsibleSubsys) WithCheck() Subsys {
+	c := *a
+	c.check = true
+	return &c
+}
+
+// IsValidKeyRef checks if the key reference names a private key in the keystore
+func (a *AnsibleSubsys) IsValidKeyRef(keyRef string) bool {
+	_, ok := a.config.SSHKeys[keyRef]
+	return ok
+}
+
+// WithConnection returns a copy of the subsystem that connects to the nodes as
+// the specified user, with the private key that the key reference names in the
+// keystore. The configured user or key is used if the respective one is empty.
+// Like WithForks, the copy is meant for a single run
+func (a *AnsibleSubsys) WithConnection(user, keyRef string) Subsys {
+	c := *a
+	c.user, c.keyRef = user, keyRef
+	return &c
+}
+
+// connection returns the user and the private key file that the nodes are
+// connected with
+func (a *AnsibleSubsys) connection() (string, string, error) {
+	user, privKeyFile := a.config.User, a.config.PrivKeyFile
+	if a.user != "" {
+		user = a.user
+	}
+	if a.keyRef != "" {
+		var ok bool
+		if privKeyFile, ok = a.config.SSHKeys[a.keyRef]; !ok {
+			return "", "", errored.Errorf("unknown ssh key reference %q", a.keyRef)
+		}
+	}
+	return user, privKeyFile, nil
+}
+
+// playbookPath returns the path of the playbook, relative to the configured
+// playbook location
+func (a *AnsibleSubsys) playbookPath(playbook string) string {
+	return strings.Join([]string{a.config.PlaybookLocation, playbook}, "/")
 }
 
 // Configure triggers the ansible playbook for configuration on specified nodes
 func (a *AnsibleSubsys) Configure(nodes SubsysHosts, extraVars string) (io.Reader, context.CancelFunc, chan error) {
-	return a.ansibleRunner(nodes.([]*AnsibleHost), strings.Join([]string{a.config.PlaybookLocation,
-		a.config.ConfigurePlaybook}, "/"), extraVars)
+	return a.ansibleRunner(nodes, a.playbookPath(a.config.ConfigurePlaybook), extraVars)
 }
 
 // Cleanup triggers the ansible playbook for cleanup on specified nodes
 func (a *AnsibleSubsys) Cleanup(nodes SubsysHosts, extraVars string) (io.Reader, context.CancelFunc, chan error) {
-	return a.ansibleRunner(nodes.([]*AnsibleHost), strings.Join([]string{a.config.PlaybookLocation,
-		a.config.CleanupPlaybook}, "/"), extraVars)
+	return a.ansibleRunner(nodes, a.playbookPath(a.config.CleanupPlaybook), extraVars)
 }
 
 // Upgrade triggers the ansible playbook for upgrade on specified nodes
 func (a *AnsibleSubsys) Upgrade(nodes SubsysHosts, extraVars string) (io.Reader, context.CancelFunc, chan error) {
-	return a.ansibleRunner(nodes.([]*AnsibleHost), strings.Join([]string{a.config.PlaybookLocation,
-		a.config.UpgradePlaybook}, "/"), extraVars)
+	return a.ansibleRunner(nodes, a.playbookPath(a.config.UpgradePlaybook), extraVars)
+}
+
+// RunPlaybook triggers the specified ansible playbook on specified nodes. The playbook
+// is looked up relative to the configured playbook location.
+func (a *AnsibleSubsys) RunPlaybook(nodes SubsysHosts, playbook, extraVars string) (io.Reader, context.CancelFunc, chan error) {
+	return a.ansibleRunner(nodes, a.playbookPath(playbook), extraVars)
+}
+
+// ResolvePlaybook returns the path of the playbook that the action runs, along
+// with the sha256 hash of the playbook's contents as it's version. The version
+// is empty if the playbook can't be read
+func (a *AnsibleSubsys) ResolvePlaybook(action Action, playbook string) (string, string) {
+	switch action {
+	case ActionConfigure:
+		playbook = a.config.ConfigurePlaybook
+	case ActionCleanup:
+		playbook = a.config.CleanupPlaybook
+	case ActionUpgrade:
+		playbook = a.config.UpgradePlaybook
+	}
+	path := a.playbookPath(playbook)
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return path, ""
+	}
+	return path, fmt.Sprintf("sha256:%x", sha256.Sum256(contents))
+}
+
+// IsValidPlaybook checks if the specified playbook is one of the known playbooks
+func (a *AnsibleSubsys) IsValidPlaybook(playbook string) bool {
+	known := append([]string{a.config.ConfigurePlaybook, a.config.CleanupPlaybook,
+		a.config.UpgradePlaybook}, a.config.AllowedPlaybooks...)
+	for _, p := range known {
+		if p != "" && p == playbook {
+			return true
+		}
+	}
+	return false
 }
 
 // SetGlobals sets the extra vars at a ansible subsys level
@@ -3,7 +3,11 @@
 package configuration
 
 import (
+	"crypto/sha256"
 	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
 	"testing"
 
 	. "gopkg.in/check.v1"
@@ -69,3 +73,159 @@ func (s *ansibleSuite) TestMergeExtraVarsInvalidJSON(c *C) {
 	c.Assert(err, ErrorMatches, "failed to unmarshal src extra vars.*",
 		Commentf("output string: %s", out))
 }
+
+func (s *ansibleSuite) TestIsValidPlaybook(c *C) {
+	a := NewAnsibleSubsys(&AnsibleSubsysConfig{
+		ConfigurePlaybook: "site.yml",
+		CleanupPlaybook:   "cleanup.yml",
+		AllowedPlaybooks:  []string{"custom.yml"},
+	})
+	c.Assert(a.IsValidPlaybook("site.yml"), Equals, true)
+	c.Assert(a.IsValidPlaybook("cleanup.yml"), Equals, true)
+	c.Assert(a.IsValidPlaybook("custom.yml"), Equals, true)
+	c.Assert(a.IsValidPlaybook("unknown.yml"), Equals, false)
+	c.Assert(a.IsValidPlaybook(""), Equals, false)
+}
+
+const testVaultVars = `$ANSIBLE_VAULT;1.1;AES256
+62313365396662343061393464336163383764373764613633653634306231386433626436623361
+6134333665353966363534333632666535333761666131620a663537646436643839616531643561`
+
+func (s *ansibleSuite) TestVaultEncryptedExtraVars(c *C) {
+	c.Assert(IsVaultEncrypted(testVaultVars), Equals, true)
+	c.Assert(IsVaultEncrypted("\n"+testVaultVars), Equals, true)
+	c.Assert(IsVaultEncrypted(`{"foo":"bar"}`), Equals, false)
+	c.Assert(RedactExtraVars(testVaultVars), Equals, RedactedVaultVars)
+	c.Assert(RedactExtraVars(`{"foo":"bar"}`), Equals, `{"foo":"bar"}`)
+}
+
+func (s *ansibleSuite) TestVaultExtraVarsWithoutPassword(c *C) {
+	a := NewAnsibleSubsys(&AnsibleSubsysConfig{ExtraVariables: DefaultValidJSON})
+	c.Assert(a.SetGlobals(testVaultVars), IsNil)
+	_, _, errCh := a.ansibleRunner([]*AnsibleHost{}, "site.yml", `{}`)
+	c.Assert(<-errCh, ErrorMatches, ".*no vault password file is configured.*")
+}
+
+func (s *ansibleSuite) TestEffectiveExtraVars(c *C) {
+	a := NewAnsibleSubsys(&AnsibleSubsysConfig{ExtraVariables: `{"foo":"config","bar":"config"}`})
+	c.Assert(a.SetGlobals(`{"bar":"globals","baz":"globals"}`), IsNil)
+	m, ok := Subsys(a).(ExtraVarsMerger)
+	c.Assert(ok, Equals, true)
+	vars, vault, err := m.EffectiveExtraVars(`{"baz":"request"}`)
+	c.Assert(err, IsNil)
+	c.Assert(vault, Equals, false)
+	c.Assert(vars, Equals, `{"bar":"globals","baz":"request","foo":"config"}`)
+
+	// the vault encrypted vars are left out
+	vars, vault, err = m.EffectiveExtraVars(testVaultVars)
+	c.Assert(err, IsNil)
+	c.Assert(vault, Equals, true)
+	c.Assert(vars, Equals, `{"bar":"globals","baz":"globals","foo":"config"}`)
+}
+
+func (s *ansibleSuite) TestWithForks(c *C) {
+	a := NewAnsibleSubsys(&AnsibleSubsysConfig{})
+	c.Assert(a.SetGlobals(`{"foo": "bar"}`), IsNil)
+	f, ok := Subsys(a).(ForksLimiter)
+	c.Assert(ok, Equals, true)
+	w := f.WithForks(20).(*AnsibleSubsys)
+	c.Assert(w.forks, Equals, 20)
+	c.Assert(w.GetGlobals(), Equals, a.GetGlobals())
+	// the subsystem itself is not affected
+	c.Assert(a.forks, Equals, 0)
+}
+
+func (s *ansibleSuite) TestWithCheck(c *C) {
+	a := NewAnsibleSubsys(&AnsibleSubsysConfig{})
+	w := a.WithForks(20).(CheckModeRunner).WithCheck().(*AnsibleSubsys)
+	c.Assert(w.check, Equals, true)
+	c.Assert(w.forks, Equals, 20)
+	c.Assert(a.check, Equals, false)
+}
+
+func (s *ansibleSuite) TestWithConnection(c *C) {
+	a := NewAnsibleSubsys(&AnsibleSubsysConfig{
+		User:        "cluster-admin",
+		PrivKeyFile: "/etc/clusterm/id_rsa",
+		SSHKeys:     map[string]string{"batch2": "/etc/clusterm/batch2_rsa"},
+	})
+	c.Assert(a.IsValidKeyRef("batch2"), Equals, true)
+	c.Assert(a.IsValidKeyRef("batch3"), Equals, false)
+
+	user, key, err := a.connection()
+	c.Assert(err, IsNil)
+	c.Assert(user, Equals, "cluster-admin")
+	c.Assert(key, Equals, "/etc/clusterm/id_rsa")
+
+	w, ok := Subsys(a).(ConnectionSetter)
+	c.Assert(ok, Equals, true)
+	user, key, err = w.WithConnection("ops", "batch2").(*AnsibleSubsys).connection()
+	c.Assert(err, IsNil)
+	c.Assert(user, Equals, "ops")
+	c.Assert(key, Equals, "/etc/clusterm/batch2_rsa")
+
+	// the configured user is used if only the key is specified
+	user, _, err = a.WithConnection("", "batch2").(*AnsibleSubsys).connection()
+	c.Assert(err, IsNil)
+	c.Assert(user, Equals, "cluster-admin")
+
+	_, _, err = a.WithConnection("", "batch3").(*AnsibleSubsys).connection()
+	c.Assert(err, ErrorMatches, `unknown ssh key reference "batch3"`)
+	// the subsystem itself is not affected
+	c.Assert(a.user, Equals, "")
+	c.Assert(a.keyRef, Equals, "")
+}
+
+func (s *ansibleSuite) TestHostGroups(c *C) {
+	h := NewAnsibleHost("node1", "1.1.1.1", "master", map[string]string{})
+	c.Assert(h.GetGroups(), DeepEquals, []string{"master"})
+	out, err := json.Marshal(h)
+	c.Assert(err, IsNil)
+	c.Assert(string(out), Not(Matches), ".*host_groups.*")
+
+	h.SetGroups([]string{"master", "etcd"})
+	c.Assert(h.GetGroup(), Equals, "master")
+	c.Assert(h.GetGroups(), DeepEquals, []string{"master", "etcd"})
+	c.Assert(h.Clone().GetGroups(), DeepEquals, []string{"master", "etcd"})
+	out, err = json.Marshal(h)
+	c.Assert(err, IsNil)
+	c.Assert(string(out), Matches, `.*"host_groups":\["master","etcd"\].*`)
+
+	// the host is listed under each of it's groups
+	inv, err := newInventory([]*AnsibleHost{h})
+	c.Assert(err, IsNil)
+	c.Assert(inv.Hosts, HasLen, 2)
+	c.Assert(inv.Hosts["master"][0].Alias, Equals, "node1")
+	c.Assert(inv.Hosts["etcd"][0].Alias, Equals, "node1")
+
+	// setting a single group drops rest of the groups
+	h.SetGroup("worker")
+	c.Assert(h.GetGroups(), DeepEquals, []string{"worker"})
+}
+
+func (s *ansibleSuite) TestResolvePlaybook(c *C) {
+	dir := c.MkDir()
+	contents := []byte("- hosts: all\n")
+	c.Assert(ioutil.WriteFile(filepath.Join(dir, "site.yml"), contents, 0644), IsNil)
+	a := NewAnsibleSubsys(&AnsibleSubsysConfig{
+		ConfigurePlaybook: "site.yml",
+		CleanupPlaybook:   "cleanup.yml",
+		PlaybookLocation:  dir,
+	})
+	r, ok := Subsys(a).(PlaybookResolver)
+	c.Assert(ok, Equals, true)
+
+	version := fmt.Sprintf("sha256:%x", sha256.Sum256(contents))
+	path, v := r.ResolvePlaybook(ActionConfigure, "")
+	c.Assert(path, Equals, dir+"/site.yml")
+	c.Assert(v, Equals, version)
+
+	path, v = r.ResolvePlaybook(ActionRunPlaybook, "site.yml")
+	c.Assert(path, Equals, dir+"/site.yml")
+	c.Assert(v, Equals, version)
+
+	// the version is not known for a playbook that can't be read
+	path, v = r.ResolvePlaybook(ActionCleanup, "")
+	c.Assert(path, Equals, dir+"/cleanup.yml")
+	c.Assert(v, Equals, "")
+}
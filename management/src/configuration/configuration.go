@@ -20,18 +20,95 @@ type Subsys interface {
 	// Cleanup triggers the configuration upgrade on specified set of nodes.
 	// It return a error channel that the caller can wait on to get completion status.
 	Upgrade(nodes SubsysHosts, extraVars string) (io.Reader, context.CancelFunc, chan error)
+	// RunPlaybook triggers the specified playbook on specified set of nodes.
+	// It return a error channel that the caller can wait on to get completion status.
+	RunPlaybook(nodes SubsysHosts, playbook, extraVars string) (io.Reader, context.CancelFunc, chan error)
+	// IsValidPlaybook checks if the specified playbook is allowed to be run
+	IsValidPlaybook(playbook string) bool
 	// SetGlobals sets the extra vars at a configuration subsys level
 	SetGlobals(extraVars string) error
 	// GetGlobals return the value of extra vars at a configuration subsys level
 	GetGlobals() string
 }
 
+// ForksLimiter is implemented by the Subsys that can limit the number of nodes
+// that an action is run on in parallel
+type ForksLimiter interface {
+	// WithForks returns a Subsys that runs the actions on at most forks nodes
+	// in parallel
+	WithForks(forks int) Subsys
+}
+
+// CheckModeRunner is implemented by the Subsys that can run the actions in
+// check mode, reporting the changes that they would make without making them
+type CheckModeRunner interface {
+	// WithCheck returns a Subsys that runs the actions in check mode
+	WithCheck() Subsys
+}
+
+// ConnectionSetter is implemented by the Subsys that can connect to the nodes
+// with other than the configured credentials on a per action basis
+type ConnectionSetter interface {
+	// IsValidKeyRef checks if the key reference names a key in the keystore
+	IsValidKeyRef(keyRef string) bool
+	// WithConnection returns a Subsys that connects to the nodes as the
+	// specified user, with the key that the key reference names. The configured
+	// user or key is used if the respective one is empty
+	WithConnection(user, keyRef string) Subsys
+}
+
+// Action identifies an action that the Subsys triggers on the nodes
+type Action string
+
+const (
+	// ActionConfigure is the action triggered by Configure
+	ActionConfigure Action = "configure"
+	// ActionCleanup is the action triggered by Cleanup
+	ActionCleanup Action = "cleanup"
+	// ActionUpgrade is the action triggered by Upgrade
+	ActionUpgrade Action = "upgrade"
+	// ActionRunPlaybook is the action triggered by RunPlaybook
+	ActionRunPlaybook Action = "run-playbook"
+)
+
+// PlaybookResolver is implemented by the Subsys that can report the playbook
+// that an action runs, like to correlate the failures with playbook changes
+type PlaybookResolver interface {
+	// ResolvePlaybook returns the path of the playbook that the action runs,
+	// along with the version of it's contents. The playbook is the one passed
+	// to RunPlaybook and is ignored for the other actions. The version is
+	// empty if the playbook can't be read
+	ResolvePlaybook(action Action, playbook string) (string, string)
+}
+
+// ExtraVarsMerger is implemented by the Subsys that can report the extra vars
+// that an action receives, after merging them with the configured and global
+// extra vars
+type ExtraVarsMerger interface {
+	// EffectiveExtraVars returns the plaintext extra vars that an action run
+	// with the specified extra vars receives. The returned bool is true if
+	// some of the extra vars are vault encrypted, and hence not included
+	EffectiveExtraVars(extraVars string) (string, bool, error)
+}
+
+// StderrReader is implemented by the output readers returned by the Subsys actions
+// that make the stderr output of an action available separately. In that case
+// reading from the StderrReader itself returns the stdout output of the action.
+// Both the readers need to be read for the action to make progress.
+type StderrReader interface {
+	io.Reader
+	Stderr() io.Reader
+}
+
 // SubsysHost denotes a host in configuration subsystem
 type SubsysHost interface {
 	// GetTag returns the name/tag associated with the host in configuration sub-system
 	GetTag() string
 	//GetGroup returns the group/role associated with the host in configuration sub-system
 	GetGroup() string
+	// GetGroups returns all the groups/roles associated with the host, starting
+	// with the one returned by GetGroup
+	GetGroups() []string
 	// SubsysHost shall satisfy the json marshaller interface to encode host's info in json
 	json.Marshaler
 }
@@ -3,4 +3,11 @@ package configuration
 const (
 	// DefaultValidJSON is the default JSON used when extra vars is received as empty string
 	DefaultValidJSON = `{}`
+
+	// vaultHeader is the header of the ansible-vault encrypted content
+	vaultHeader = "$ANSIBLE_VAULT;"
+
+	// RedactedVaultVars replaces the vault encrypted extra vars in the logs and
+	// descriptions of the actions
+	RedactedVaultVars = "<vault encrypted>"
 )
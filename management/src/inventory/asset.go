@@ -3,6 +3,7 @@ package inventory
 import (
 	"encoding/json"
 	"strings"
+	"sync"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/contiv/errored"
@@ -101,8 +102,11 @@ var lifecycleStates = map[AssetStatus]map[AssetState]bool{
 
 // Asset denotes a host or vm that is managed by the inventory susystem
 type Asset struct {
-	client     SubsysClient
-	name       string
+	client SubsysClient
+	name   string
+	// mutex protects the status and state of the asset. It is not held while
+	// the status is updated in the inventory
+	mutex      sync.Mutex
 	status     AssetStatus
 	prevStatus AssetStatus
 	state      AssetState
@@ -148,13 +152,14 @@ func NewAsset(client SubsysClient, name string) (*Asset, error) {
 // SetStatus updates the status and/or state of an asset in the inventory after
 // performing lifecyslce related validations.
 func (a *Asset) SetStatus(status AssetStatus, state AssetState) error {
-	if a.status == status && a.state == state {
+	curStatus, curState := a.GetStatus()
+	if curStatus == status && curState == state {
 		logrus.Infof("asset already in status: %q and state: %q, no action required", status, state)
 		return nil
 	}
 
-	if _, ok := lifecycleStatus[a.status][status]; !ok && a.status != status {
-		return errored.Errorf("transition from %q to %q is not allowed", a.status, status)
+	if _, ok := lifecycleStatus[curStatus][status]; !ok && curStatus != status {
+		return errored.Errorf("transition from %q to %q is not allowed", curStatus, status)
 	}
 
 	if _, ok := lifecycleStates[status][state]; !ok {
@@ -165,6 +170,8 @@ func (a *Asset) SetStatus(status AssetStatus, state AssetState) error {
 		return err
 	}
 
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
 	a.prevStatus = a.status
 	a.prevState = a.state
 	a.status = status
@@ -175,6 +182,8 @@ func (a *Asset) SetStatus(status AssetStatus, state AssetState) error {
 
 // GetStatus returns the current status and state of an asset.
 func (a *Asset) GetStatus() (AssetStatus, AssetState) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
 	return a.status, a.state
 }
 
@@ -186,6 +195,8 @@ func (a *Asset) GetTag() string {
 // MarshalJSON implements the json marshaller for asset. It is done this way
 // than making the fields public inorder to safeguard against direct state interpolation.
 func (a *Asset) MarshalJSON() ([]byte, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
 	return json.Marshal(struct {
 		Name       string `json:"name"`
 		Status     string `json:"status"`
@@ -12,6 +12,13 @@ func NewBoltdbSubsys(config boltdb.Config) (*inventory.GeneralSubsys, error) {
 	if err != nil {
 		return nil, err
 	}
+	return NewBoltdbSubsysFromClient(client)
+}
+
+// NewBoltdbSubsysFromClient initializes and return an instance of boltdb based
+// inventory subsystem that uses the specified client. This allows sharing the
+// boltdb client with other users of the same db file.
+func NewBoltdbSubsysFromClient(client *boltdb.Client) (*inventory.GeneralSubsys, error) {
 	subsys := inventory.NewGeneralSubsys(client)
 
 	// restore any previously added hosts
@@ -25,6 +25,8 @@ type Subsys interface {
 	SetAssetInMaintenance(name string) error
 	//SetAssetUnallocated sets an asset status to unallocated
 	SetAssetUnallocated(name string) error
+	//RemoveAsset removes an asset from the inventory
+	RemoveAsset(name string) error
 	//GetAsset finds and returns the asset in inventory
 	GetAsset(name string) SubsysAsset
 	//GetAllAssets returns all the assets in inventory
@@ -38,6 +40,7 @@ type SubsysClient interface {
 	CreateState(name, description, status string) error
 	AddAssetLog(tag, mtype, message string) error
 	SetAssetStatus(tag, status, state, reason string) error
+	DeleteAsset(tag string) error
 }
 
 // SubsysAsset denotes a single asset in inventory subsystem
@@ -1,10 +1,15 @@
 package inventory
 
+import "sync"
+
 // GeneralSubsys implements the inventory sub-system. It is instantiated using
 // the New* methods of specific subsystems like collins, boltdb and so on
 type GeneralSubsys struct {
 	client SubsysClient
 	assets map[string]*Asset
+	// assetsMutex protects the assets. It is not held while the subsystem
+	// client is invoked, so that a slow inventory doesn't hold up the lookups
+	assetsMutex sync.RWMutex
 }
 
 // NewGeneralSubsys returns a instance of GeneralSubsys initialized with a subsystem client
@@ -17,6 +22,8 @@ func NewGeneralSubsys(client SubsysClient) *GeneralSubsys {
 
 // RestoreAsset makes the subsystem update asset info
 func (ci *GeneralSubsys) RestoreAsset(name string, asset *Asset) error {
+	ci.assetsMutex.Lock()
+	defer ci.assetsMutex.Unlock()
 	if _, ok := ci.assets[name]; ok {
 		return errAssetExists(name)
 	}
@@ -28,7 +35,7 @@ func (ci *GeneralSubsys) RestoreAsset(name string, asset *Asset) error {
 
 //AddAsset adds an asset to collins in 'Discovered' status
 func (ci *GeneralSubsys) AddAsset(name string) error {
-	if _, ok := ci.assets[name]; ok {
+	if _, err := ci.asset(name); err == nil {
 		return errAssetExists(name)
 	}
 
@@ -36,95 +43,133 @@ func (ci *GeneralSubsys) AddAsset(name string) error {
 	if err != nil {
 		return err
 	}
+	ci.assetsMutex.Lock()
+	defer ci.assetsMutex.Unlock()
 	ci.assets[name] = host
 
 	return nil
 }
 
+//RemoveAsset removes an asset from the inventory
+func (ci *GeneralSubsys) RemoveAsset(name string) error {
+	if _, err := ci.asset(name); err != nil {
+		return err
+	}
+
+	if err := ci.client.DeleteAsset(name); err != nil {
+		return err
+	}
+	ci.assetsMutex.Lock()
+	defer ci.assetsMutex.Unlock()
+	delete(ci.assets, name)
+
+	return nil
+}
+
 //SetAssetDiscovered sets an asset state to discovered
 func (ci *GeneralSubsys) SetAssetDiscovered(name string) error {
-	if _, ok := ci.assets[name]; !ok {
-		return errAssetNotExists(name)
+	a, err := ci.asset(name)
+	if err != nil {
+		return err
 	}
 
-	status, _ := ci.assets[name].GetStatus()
-	return ci.assets[name].SetStatus(status, Discovered)
+	status, _ := a.GetStatus()
+	return a.SetStatus(status, Discovered)
 }
 
 //SetAssetDisappeared sets an asset state to disappeared
 func (ci *GeneralSubsys) SetAssetDisappeared(name string) error {
-	if _, ok := ci.assets[name]; !ok {
-		return errAssetNotExists(name)
+	a, err := ci.asset(name)
+	if err != nil {
+		return err
 	}
 
-	status, _ := ci.assets[name].GetStatus()
-	return ci.assets[name].SetStatus(status, Disappeared)
+	status, _ := a.GetStatus()
+	return a.SetStatus(status, Disappeared)
 }
 
 //SetAssetProvisioning sets an asset state to provisioning
 func (ci *GeneralSubsys) SetAssetProvisioning(name string) error {
-	if _, ok := ci.assets[name]; !ok {
-		return errAssetNotExists(name)
+	a, err := ci.asset(name)
+	if err != nil {
+		return err
 	}
 
-	_, state := ci.assets[name].GetStatus()
-	return ci.assets[name].SetStatus(Provisioning, state)
+	_, state := a.GetStatus()
+	return a.SetStatus(Provisioning, state)
 }
 
 //SetAssetCommissioned sets an asset status to unallocated
 func (ci *GeneralSubsys) SetAssetCommissioned(name string) error {
-	if _, ok := ci.assets[name]; !ok {
-		return errAssetNotExists(name)
+	a, err := ci.asset(name)
+	if err != nil {
+		return err
 	}
 
-	_, state := ci.assets[name].GetStatus()
+	_, state := a.GetStatus()
 	// collins equivalent of commissioned status in allocated
-	return ci.assets[name].SetStatus(Allocated, state)
+	return a.SetStatus(Allocated, state)
 }
 
 //SetAssetCancelled sets an asset state to cancelled
 func (ci *GeneralSubsys) SetAssetCancelled(name string) error {
-	if _, ok := ci.assets[name]; !ok {
-		return errAssetNotExists(name)
+	a, err := ci.asset(name)
+	if err != nil {
+		return err
 	}
 
-	_, state := ci.assets[name].GetStatus()
-	return ci.assets[name].SetStatus(Cancelled, state)
+	_, state := a.GetStatus()
+	return a.SetStatus(Cancelled, state)
 }
 
 //SetAssetDecommissioned sets an asset status to decommissioned
 func (ci *GeneralSubsys) SetAssetDecommissioned(name string) error {
-	if _, ok := ci.assets[name]; !ok {
-		return errAssetNotExists(name)
+	a, err := ci.asset(name)
+	if err != nil {
+		return err
 	}
 
-	_, state := ci.assets[name].GetStatus()
-	return ci.assets[name].SetStatus(Decommissioned, state)
+	_, state := a.GetStatus()
+	return a.SetStatus(Decommissioned, state)
 }
 
 //SetAssetInMaintenance sets an asset state to decommissioned
 func (ci *GeneralSubsys) SetAssetInMaintenance(name string) error {
-	if _, ok := ci.assets[name]; !ok {
-		return errAssetNotExists(name)
+	a, err := ci.asset(name)
+	if err != nil {
+		return err
 	}
 
-	_, state := ci.assets[name].GetStatus()
-	return ci.assets[name].SetStatus(Maintenance, state)
+	_, state := a.GetStatus()
+	return a.SetStatus(Maintenance, state)
 }
 
 //SetAssetUnallocated sets an asset status to unallocated
 func (ci *GeneralSubsys) SetAssetUnallocated(name string) error {
-	if _, ok := ci.assets[name]; !ok {
-		return errAssetNotExists(name)
+	a, err := ci.asset(name)
+	if err != nil {
+		return err
 	}
 
-	_, state := ci.assets[name].GetStatus()
-	return ci.assets[name].SetStatus(Unallocated, state)
+	_, state := a.GetStatus()
+	return a.SetStatus(Unallocated, state)
+}
+
+// asset returns the asset with specified name, it returns an error if the
+// asset doesn't exist
+func (ci *GeneralSubsys) asset(name string) (*Asset, error) {
+	ci.assetsMutex.RLock()
+	defer ci.assetsMutex.RUnlock()
+	a, ok := ci.assets[name]
+	if !ok {
+		return nil, errAssetNotExists(name)
+	}
+	return a, nil
 }
 
 //GetAsset finds and returns the asset in inventory
 func (ci *GeneralSubsys) GetAsset(name string) SubsysAsset {
-	if a, ok := ci.assets[name]; ok {
+	if a, err := ci.asset(name); err == nil {
 		return a
 	}
 	return nil
@@ -132,5 +177,11 @@ func (ci *GeneralSubsys) GetAsset(name string) SubsysAsset {
 
 //GetAllAssets returns all the assets in inventory
 func (ci *GeneralSubsys) GetAllAssets() SubsysAssets {
-	return ci.assets
+	ci.assetsMutex.RLock()
+	defer ci.assetsMutex.RUnlock()
+	assets := make(map[string]*Asset, len(ci.assets))
+	for name, a := range ci.assets {
+		assets[name] = a
+	}
+	return assets
 }
@@ -20,6 +20,9 @@ type Subsys interface {
 	// Start triggers the monitor subsystems and delivers the node monitor
 	// events to the client. Start should block and optionall returns error
 	// when it encounters a non-revcoverable condition.
+	// The first Discovered callback shall deliver the nodes that exist when
+	// the subsystem is started, if any, as the client relies on it to know
+	// when it's initial view of the nodes is complete.
 	Start() error
 }
 
@@ -33,6 +36,8 @@ type SubsysNode interface {
 	// GetAddress return the management address associated with the host. This address is
 	// used for pushing configuration to provision a host with cluster level services.
 	GetMgmtAddress() string
+	// GetTags returns the tags associated with the node in the monitoring system, if any.
+	GetTags() map[string]string
 	// SubsysNode shall satisfy the json marshaller interface to encode node's info in json
 	json.Marshaler
 }
@@ -7,6 +7,7 @@ type Node struct {
 	label  string
 	serial string
 	addr   string
+	tags   map[string]string
 }
 
 // NewNode returns an instamce of node in monitoring subsystem
@@ -18,6 +19,17 @@ func NewNode(label, serial, addr string) *Node {
 	}
 }
 
+// NewNodeWithTags returns an instance of node in monitoring subsystem along with
+// the tags associated with it
+func NewNodeWithTags(label, serial, addr string, tags map[string]string) *Node {
+	return &Node{
+		label:  label,
+		serial: serial,
+		addr:   addr,
+		tags:   tags,
+	}
+}
+
 // GetLabel returns the label associated with the node in the monitoring system.
 // This is usually the hostname but can be anything more descriptive.
 func (n *Node) GetLabel() string {
@@ -35,6 +47,11 @@ func (n *Node) GetMgmtAddress() string {
 	return n.addr
 }
 
+// GetTags returns the tags associated with the node in the monitoring system.
+func (n *Node) GetTags() map[string]string {
+	return n.tags
+}
+
 // MarshalJSON satisfies the json marshaller interface and shall encode asset info in json
 func (n *Node) MarshalJSON() ([]byte, error) {
 	return json.Marshal(struct {
@@ -46,6 +46,7 @@ func serferCb(cb EventCb) serfer.HandlerFunc {
 			n.label = mbr.Tags[nodeLabel]
 			n.serial = mbr.Tags[nodeSerial]
 			n.addr = mbr.Tags[nodeAddr]
+			n.tags = mbr.Tags
 			e := Event{Node: n}
 			switch name {
 			case "member-join":
@@ -111,6 +112,7 @@ func (sm *SerfSubsys) restore() error {
 				label:  mbr.Tags[nodeLabel],
 				serial: mbr.Tags[nodeSerial],
 				addr:   mbr.Tags[nodeAddr],
+				tags:   mbr.Tags,
 			},
 		}
 		logrus.Debugf("monitor event: %+v", e)
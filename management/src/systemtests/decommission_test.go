@@ -58,6 +58,20 @@ func (s *SystemTestSuite) TestDecommissionNodeFailureRemainingWorker(c *C) {
 	s.assertMatch(c, exptdOut, out)
 }
 
+func (s *SystemTestSuite) TestDecommissionNodeFailureLastMaster(c *C) {
+	nodeName := validNodeNames[0]
+
+	// commission the node as the only master
+	s.commissionNode(c, nodeName, ansibleMasterGroupName, s.tbn1)
+
+	// decommission the master node without forcing it
+	cmdStr := fmt.Sprintf("clusterctl node decommission %s", nodeName)
+	out, err := s.tbn1.RunCommandWithOutput(cmdStr)
+	s.Assert(c, err, NotNil, Commentf("output: %s", out))
+	s.assertMatch(c, ".*will leave no master node in the cluster.*", out)
+	s.checkProvisionStatus(c, s.tbn1, nodeName, "Allocated")
+}
+
 func (s *SystemTestSuite) TestDecommissionNodesFailureDisappeared(c *C) {
 	nodeNames := validNodeNames
 	nodeName := validNodeNames[1]
@@ -96,7 +110,7 @@ func (s *SystemTestSuite) TestDecommissionNodesFailureAlreadyDecommissioned(c *C
 
 	//try to decommission all the nodes
 	nodesStr := strings.Join(nodeNames, " ")
-	cmdStr := fmt.Sprintf("clusterctl nodes decommission %s", nodesStr)
+	cmdStr := fmt.Sprintf("clusterctl nodes decommission --force %s", nodesStr)
 	out, err := s.tbn1.RunCommandWithOutput(cmdStr)
 	s.Assert(c, err, NotNil, Commentf("output: %s", out))
 	exptStr := fmt.Sprintf(".*failed to update %s.*transition from.*%s.*%s.*is not allowed.*", nodeName, "Decommissioned", "Cancelled")
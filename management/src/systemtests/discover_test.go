@@ -8,14 +8,16 @@ import (
 	. "gopkg.in/check.v1"
 )
 
-func (s *SystemTestSuite) TestDiscoverNodeFailureAlreadyExist(c *C) {
+func (s *SystemTestSuite) TestDiscoverExistingNode(c *C) {
 	nodeName := validNodeNames[0]
 	nodeAddr := validNodeAddrs[0]
 	cmdStr := fmt.Sprintf("clusterctl discover %s", nodeAddr)
 	out, err := s.tbn1.RunCommandWithOutput(cmdStr)
-	s.Assert(c, err, NotNil, Commentf("output: %s", out))
-	exptdOut := fmt.Sprintf(".*one or more nodes already exist.*%s.*%s.*", nodeName, nodeAddr)
-	s.assertMatch(c, exptdOut, out)
+	s.Assert(c, err, IsNil, Commentf("output: %s", out))
+
+	// the existing node is re-discovered, it's not duplicated
+	s.waitForSerfMembership(c, s.tbn1, nodeName, "alive")
+	s.getNodeInfoSuccess(c, nodeName)
 }
 
 func (s *SystemTestSuite) TestDiscoverNodeSuccess(c *C) {
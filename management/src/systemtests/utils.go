@@ -219,8 +219,8 @@ func (s *SystemTestSuite) updateNodes(c *C, nodeNames []string, hostGroup string
 }
 
 func (s *SystemTestSuite) decommissionNode(c *C, nodeName string, nut vagrantssh.TestbedNode) {
-	// decommission the node
-	cmdStr := fmt.Sprintf("clusterctl node decommission %s", nodeName)
+	// decommission the node, it may be the last master node
+	cmdStr := fmt.Sprintf("clusterctl node decommission --force %s", nodeName)
 	out, err := s.tbn1.RunCommandWithOutput(cmdStr)
 	s.Assert(c, err, IsNil, Commentf("output: %s", out))
 	s.checkProvisionStatus(c, s.tbn1, nodeName, "Decommissioned")
@@ -230,9 +230,9 @@ func (s *SystemTestSuite) decommissionNode(c *C, nodeName string, nut vagrantssh
 }
 
 func (s *SystemTestSuite) decommissionNodes(c *C, nodeNames []string) {
-	// decommission the nodes
+	// decommission the nodes, they may include the last master node
 	nodesStr := strings.Join(nodeNames, " ")
-	cmdStr := fmt.Sprintf("clusterctl nodes decommission %s", nodesStr)
+	cmdStr := fmt.Sprintf("clusterctl nodes decommission --force %s", nodesStr)
 	out, err := s.tbn1.RunCommandWithOutput(cmdStr)
 	s.Assert(c, err, IsNil, Commentf("output: %s", out))
 	for _, name := range nodeNames {